@@ -22,9 +22,12 @@ const lastLimit = 1000
 
 // MemData implements in-memory data store
 type MemData struct {
-	posts     map[string][]store.Comment // key is siteID
-	metaUsers map[string]metaUser        // key is userID
-	metaPosts map[store.Locator]metaPost // key is post's locator
+	posts     map[string][]store.Comment      // key is siteID
+	metaUsers map[string]metaUser             // key is userID
+	metaPosts map[store.Locator]metaPost      // key is post's locator
+	reports   map[string][]store.Report       // key is siteID
+	subscrs   map[string][]store.Subscription // key is siteID
+	changes   map[string][]engine.Change      // key is siteID
 	sync.RWMutex
 }
 
@@ -40,6 +43,8 @@ type metaUser struct {
 	Verified     bool
 	Blocked      bool
 	BlockedUntil time.Time
+	Shadow       bool
+	ShadowUntil  time.Time
 	Details      engine.UserDetailEntry
 }
 
@@ -50,6 +55,9 @@ func NewMemData() *MemData {
 		posts:     map[string][]store.Comment{},
 		metaUsers: map[string]metaUser{},
 		metaPosts: map[store.Locator]metaPost{},
+		reports:   map[string][]store.Report{},
+		subscrs:   map[string][]store.Subscription{},
+		changes:   map[string][]engine.Change{},
 	}
 	return result
 }
@@ -71,6 +79,7 @@ func (m *MemData) Create(comment store.Comment) (commentID string, err error) {
 	}
 	comments = append(comments, comment)
 	m.posts[comment.Locator.SiteID] = comments
+	m.addChange(comment.Locator.SiteID, engine.Change{Event: engine.ChangeCreate, Comment: &comment})
 	return comment.ID, nil
 }
 
@@ -92,6 +101,12 @@ func (m *MemData) Find(req engine.FindRequest) (comments []store.Comment, err er
 			return c.Locator == req.Locator && (req.Since.IsZero() || c.Timestamp.After(req.Since))
 		})
 
+	case req.Locator.SiteID != "" && req.Pending: // find pending comments for site
+		comments = m.match(m.posts[req.Locator.SiteID], func(c store.Comment) bool {
+			return c.Pending && !c.Deleted
+		})
+		req.Sort = "time"
+
 	case req.Locator.SiteID != "" && req.Locator.URL == "" && req.UserID == "": // find last comments for site
 		if req.Limit > lastLimit || req.Limit == 0 {
 			req.Limit = lastLimit
@@ -141,7 +156,11 @@ func (m *MemData) Get(req engine.GetRequest) (comment store.Comment, err error)
 func (m *MemData) Update(comment store.Comment) error {
 	m.Lock()
 	defer m.Unlock()
-	return m.updateComment(comment)
+	if err := m.updateComment(comment); err != nil {
+		return err
+	}
+	m.addChange(comment.Locator.SiteID, engine.Change{Event: engine.ChangeUpdate, Comment: &comment})
+	return nil
 }
 
 // Count returns number of comments for post or user
@@ -152,7 +171,7 @@ func (m *MemData) Count(req engine.FindRequest) (count int, err error) {
 	switch {
 	case req.Locator.URL != "": // comment's count for post
 		comments := m.match(m.posts[req.Locator.SiteID], func(c store.Comment) bool {
-			return c.Locator == req.Locator && !c.Deleted
+			return c.Locator == req.Locator && !c.Deleted && !c.Pending
 		})
 		return len(comments), nil
 	case req.UserID != "":
@@ -247,7 +266,11 @@ func (m *MemData) Flag(req engine.FlagRequest) (val bool, err error) {
 		return m.checkFlag(req), nil
 	}
 	// write flag value
-	return m.setFlag(req)
+	if val, err = m.setFlag(req); err != nil {
+		return val, err
+	}
+	m.addChange(req.Locator.SiteID, engine.Change{Event: engine.ChangeFlag, Flag: &req})
+	return val, nil
 }
 
 // ListFlags get list of flagged keys, like blocked & verified user
@@ -275,6 +298,14 @@ func (m *MemData) ListFlags(req engine.FlagRequest) (res []interface{}, err erro
 			}
 		}
 		return res, nil
+
+	case engine.ShadowBlocked:
+		for _, u := range m.metaUsers {
+			if u.SiteID == req.Locator.SiteID && u.Shadow && u.ShadowUntil.After(time.Now()) {
+				res = append(res, store.BlockedUser{ID: u.UserID, Until: u.ShadowUntil})
+			}
+		}
+		return res, nil
 	}
 
 	return nil, errors.Errorf("flag %s not listable", req.Flag)
@@ -285,7 +316,7 @@ func (m *MemData) ListFlags(req engine.FlagRequest) (res []interface{}, err erro
 // and all site's details listing under the same function (and not to extend engine interface by two separate functions).
 func (m *MemData) UserDetail(req engine.UserDetailRequest) ([]engine.UserDetailEntry, error) {
 	switch req.Detail {
-	case engine.UserEmail:
+	case engine.UserEmail, engine.UserDigest, engine.UserBio, engine.UserWebsite, engine.UserMuted:
 		if req.UserID == "" {
 			return nil, errors.New("userid cannot be empty in request for single detail")
 		}
@@ -297,7 +328,11 @@ func (m *MemData) UserDetail(req engine.UserDetailRequest) ([]engine.UserDetailE
 			return m.getUserDetail(req)
 		}
 
-		return m.setUserDetail(req)
+		res, err := m.setUserDetail(req)
+		if err == nil {
+			m.addChange(req.Locator.SiteID, engine.Change{Event: engine.ChangeUserDetail, UserDetail: &req})
+		}
+		return res, err
 	case engine.AllUserDetails:
 		// list of all details returned in case request is a read request
 		// (Update is not set) and does not have UserID or Detail set
@@ -312,13 +347,103 @@ func (m *MemData) UserDetail(req engine.UserDetailRequest) ([]engine.UserDetailE
 	}
 }
 
+// Report adds report to comment and returns all reports of this comment, gets reports of comment
+// or all reports of site if CommentID not set
+func (m *MemData) Report(req engine.ReportRequest) ([]store.Report, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if req.Update != nil {
+		if req.Update.CommentID == "" || req.Update.UserID == "" {
+			return nil, errors.New("comment id and user id required for report")
+		}
+		reports := []store.Report{}
+		for _, r := range m.reports[req.Locator.SiteID] {
+			if r.CommentID != req.Update.CommentID || r.UserID != req.Update.UserID {
+				reports = append(reports, r)
+			}
+		}
+		m.reports[req.Locator.SiteID] = append(reports, *req.Update)
+		req.CommentID = req.Update.CommentID
+	}
+
+	res := []store.Report{}
+	for _, r := range m.reports[req.Locator.SiteID] {
+		if req.CommentID == "" || r.CommentID == req.CommentID {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+// Subscription adds subscription and returns it, gets subscriptions of post if URL set, of user if UserID set
+// or all subscriptions of site
+func (m *MemData) Subscription(req engine.SubscriptionRequest) ([]store.Subscription, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if req.Update != nil {
+		if req.Update.UserID == "" || req.Update.Locator.URL == "" {
+			return nil, errors.New("user id and url required for subscription")
+		}
+		m.deleteSubscriptions(req.Locator.SiteID, req.Update.UserID, req.Update.Locator.URL, req.Update.CommentID)
+		m.subscrs[req.Locator.SiteID] = append(m.subscrs[req.Locator.SiteID], *req.Update)
+		return []store.Subscription{*req.Update}, nil
+	}
+
+	res := []store.Subscription{}
+	for _, s := range m.subscrs[req.Locator.SiteID] {
+		if (req.Locator.URL == "" || s.Locator.URL == req.Locator.URL) && (req.UserID == "" || s.UserID == req.UserID) {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
 // Delete post(s), user, comment, user details, or everything
 func (m *MemData) Delete(req engine.DeleteRequest) error {
-
 	m.Lock()
 	defer m.Unlock()
 
+	if err := m.delete(req); err != nil {
+		return err
+	}
+	if !req.Reports && !req.Subscription {
+		m.addChange(req.Locator.SiteID, engine.Change{Event: engine.ChangeDelete, Delete: &req})
+	}
+	return nil
+}
+
+// Changes returns entries of site's change log with sequence number greater than req.Since, oldest first,
+// or the last entry only with req.Last
+func (m *MemData) Changes(req engine.ChangesRequest) ([]engine.Change, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	res := []engine.Change{}
+	changes := m.changes[req.Locator.SiteID]
+	if req.Last && len(changes) > 0 {
+		return append(res, changes[len(changes)-1]), nil
+	}
+	for _, c := range changes {
+		if req.Limit > 0 && len(res) >= req.Limit {
+			break
+		}
+		if c.Seq > req.Since {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func (m *MemData) delete(req engine.DeleteRequest) error {
 	switch {
+	case req.Reports && req.CommentID != "": // delete reports of comment
+		m.deleteReports(req.Locator.SiteID, req.CommentID)
+		return nil
+	case req.Subscription && req.UserID != "": // delete subscription(s) of user
+		m.deleteSubscriptions(req.Locator.SiteID, req.UserID, req.Locator.URL, req.CommentID)
+		return nil
 	case req.UserDetail != "": // delete user detail
 		return m.deleteUserDetail(req.Locator, req.UserID, req.UserDetail)
 	case req.Locator.URL != "" && req.CommentID != "" && req.UserDetail == "": // delete comment
@@ -340,6 +465,8 @@ func (m *MemData) Delete(req engine.DeleteRequest) error {
 			return errors.New("not found")
 		}
 		m.posts[req.Locator.SiteID] = []store.Comment{}
+		delete(m.reports, req.Locator.SiteID)
+		delete(m.subscrs, req.Locator.SiteID)
 		return nil
 	}
 
@@ -356,9 +483,32 @@ func (m *MemData) deleteComment(loc store.Locator, id string, mode store.DeleteM
 	}
 
 	comments[0].SetDeleted(mode)
+	m.deleteReports(loc.SiteID, id)
 	return m.updateComment(comments[0])
 }
 
+func (m *MemData) deleteReports(siteID, commentID string) {
+	reports := []store.Report{}
+	for _, r := range m.reports[siteID] {
+		if r.CommentID != commentID {
+			reports = append(reports, r)
+		}
+	}
+	m.reports[siteID] = reports
+}
+
+// deleteSubscriptions removes user's subscription to the post or to the thread, all subscriptions of user if no url
+func (m *MemData) deleteSubscriptions(siteID, userID, url, commentID string) {
+	subscrs := []store.Subscription{}
+	for _, s := range m.subscrs[siteID] {
+		if s.UserID == userID && (url == "" || (s.Locator.URL == url && s.CommentID == commentID)) {
+			continue
+		}
+		subscrs = append(subscrs, s)
+	}
+	m.subscrs[siteID] = subscrs
+}
+
 // Close store
 func (m *MemData) Close() error {
 	return nil
@@ -373,6 +523,13 @@ func (m *MemData) checkFlag(req engine.FlagRequest) (val bool) {
 			}
 			return meta.Blocked && meta.BlockedUntil.After(time.Now())
 		}
+	case engine.ShadowBlocked:
+		if meta, ok := m.metaUsers[req.UserID]; ok {
+			if meta.SiteID != req.Locator.SiteID {
+				return false
+			}
+			return meta.Shadow && meta.ShadowUntil.After(time.Now())
+		}
 	case engine.Verified:
 		if meta, ok := m.metaUsers[req.UserID]; ok {
 			if meta.SiteID != req.Locator.SiteID {
@@ -413,6 +570,17 @@ func (m *MemData) setFlag(req engine.FlagRequest) (res bool, err error) {
 		}
 		m.metaUsers[req.UserID] = meta
 
+	case engine.ShadowBlocked:
+		meta := m.metaUsers[req.UserID]
+		meta.UserID, meta.SiteID, meta.Shadow, meta.ShadowUntil = req.UserID, req.Locator.SiteID, status, time.Time{}
+		if status {
+			meta.ShadowUntil = time.Now().AddDate(100, 0, 0) // permanent is 100years
+			if req.TTL > 0 {
+				meta.ShadowUntil = time.Now().Add(req.TTL)
+			}
+		}
+		m.metaUsers[req.UserID] = meta
+
 	case engine.Verified:
 		meta := metaUser{
 			UserID:   req.UserID,
@@ -443,6 +611,14 @@ func (m *MemData) getUserDetail(req engine.UserDetailRequest) ([]engine.UserDeta
 		switch req.Detail {
 		case engine.UserEmail:
 			return []engine.UserDetailEntry{{UserID: req.UserID, Email: meta.Details.Email}}, nil
+		case engine.UserDigest:
+			return []engine.UserDetailEntry{{UserID: req.UserID, Digest: meta.Details.Digest}}, nil
+		case engine.UserBio:
+			return []engine.UserDetailEntry{{UserID: req.UserID, Bio: meta.Details.Bio}}, nil
+		case engine.UserWebsite:
+			return []engine.UserDetailEntry{{UserID: req.UserID, Website: meta.Details.Website}}, nil
+		case engine.UserMuted:
+			return []engine.UserDetailEntry{{UserID: req.UserID, Muted: meta.Details.Muted}}, nil
 		}
 	}
 
@@ -473,6 +649,22 @@ func (m *MemData) setUserDetail(req engine.UserDetailRequest) ([]engine.UserDeta
 		entry.Details.Email = req.Update
 		m.metaUsers[req.UserID] = entry
 		return []engine.UserDetailEntry{{UserID: req.UserID, Email: req.Update}}, nil
+	case engine.UserDigest:
+		entry.Details.Digest = req.Update
+		m.metaUsers[req.UserID] = entry
+		return []engine.UserDetailEntry{{UserID: req.UserID, Digest: req.Update}}, nil
+	case engine.UserBio:
+		entry.Details.Bio = req.Update
+		m.metaUsers[req.UserID] = entry
+		return []engine.UserDetailEntry{{UserID: req.UserID, Bio: req.Update}}, nil
+	case engine.UserWebsite:
+		entry.Details.Website = req.Update
+		m.metaUsers[req.UserID] = entry
+		return []engine.UserDetailEntry{{UserID: req.UserID, Website: req.Update}}, nil
+	case engine.UserMuted:
+		entry.Details.Muted = req.Update
+		m.metaUsers[req.UserID] = entry
+		return []engine.UserDetailEntry{{UserID: req.UserID, Muted: req.Update}}, nil
 	}
 
 	return []engine.UserDetailEntry{}, nil
@@ -493,6 +685,9 @@ func (m *MemData) listDetails(loc store.Locator) ([]engine.UserDetailEntry, erro
 // deletion of the absent entry doesn't produce error.
 // Trying to delete user with wrong siteID doesn't to anything and doesn't produce error.
 func (m *MemData) deleteUserDetail(locator store.Locator, userID string, userDetail engine.UserDetail) error {
+	if userDetail == engine.AllUserDetails { // subscriptions are useless without user details
+		m.deleteSubscriptions(locator.SiteID, userID, "", "")
+	}
 	var entry metaUser
 	if meta, ok := m.metaUsers[userID]; ok {
 		if meta.SiteID != locator.SiteID {
@@ -509,6 +704,14 @@ func (m *MemData) deleteUserDetail(locator store.Locator, userID string, userDet
 	switch userDetail {
 	case engine.UserEmail:
 		entry.Details.Email = ""
+	case engine.UserDigest:
+		entry.Details.Digest = ""
+	case engine.UserBio:
+		entry.Details.Bio = ""
+	case engine.UserWebsite:
+		entry.Details.Website = ""
+	case engine.UserMuted:
+		entry.Details.Muted = ""
 	case engine.AllUserDetails:
 		entry.Details = engine.UserDetailEntry{UserID: userID}
 	}
@@ -532,6 +735,13 @@ func (m *MemData) get(loc store.Locator, commentID string) (store.Comment, error
 	return comments[0], nil
 }
 
+// addChange appends entry to site's change log, sequence is number of the entry
+func (m *MemData) addChange(siteID string, change engine.Change) {
+	change.Seq = uint64(len(m.changes[siteID]) + 1)
+	change.Timestamp = time.Now()
+	m.changes[siteID] = append(m.changes[siteID], change)
+}
+
 func (m *MemData) updateComment(comment store.Comment) error {
 	comments := m.posts[comment.Locator.SiteID]
 	for i, c := range comments {
@@ -542,6 +752,7 @@ func (m *MemData) updateComment(comment store.Comment) error {
 		c.Orig = comment.Orig
 		c.Score = comment.Score
 		c.Votes = comment.Votes
+		c.VotedIPs = comment.VotedIPs
 		c.Pin = comment.Pin
 		c.Deleted = comment.Deleted
 		c.User = comment.User
@@ -621,6 +621,109 @@ func TestMemData_DeleteComment(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestMemData_Report(t *testing.T) {
+	b := prepMem(t)
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	report := func(commentID, userID string, reason store.ReportReason) []store.Report {
+		res, err := b.Report(engine.ReportRequest{Locator: loc, Update: &store.Report{Locator: loc, CommentID: commentID,
+			UserID: userID, Reason: reason}})
+		require.NoError(t, err)
+		return res
+	}
+	assert.Equal(t, 1, len(report("id-1", "user2", store.ReportSpam)))
+	assert.Equal(t, 2, len(report("id-1", "user3", store.ReportSpam)))
+	res := report("id-1", "user2", store.ReportAbuse)
+	require.Equal(t, 2, len(res), "report of the same user replaced")
+	assert.Equal(t, store.ReportAbuse, res[1].Reason)
+	assert.Equal(t, 1, len(report("id-2", "user2", store.ReportOther)))
+
+	res, err := b.Report(engine.ReportRequest{Locator: loc})
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(res), "all reports of site")
+
+	require.NoError(t, b.Delete(engine.DeleteRequest{Locator: loc, CommentID: "id-1", Reports: true}))
+	res, err = b.Report(engine.ReportRequest{Locator: loc, CommentID: "id-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res), "reports dismissed")
+	comment, err := b.Get(getReq(loc, "id-1"))
+	require.NoError(t, err)
+	assert.False(t, comment.Deleted, "comment kept")
+
+	require.NoError(t, b.Delete(engine.DeleteRequest{Locator: loc, CommentID: "id-2"}))
+	res, err = b.Report(engine.ReportRequest{Locator: loc})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res), "reports removed with comment")
+
+	_, err = b.Report(engine.ReportRequest{Locator: loc, Update: &store.Report{CommentID: "id-1"}})
+	assert.Error(t, err)
+}
+
+func TestMemData_Changes(t *testing.T) {
+	b := prepMem(t) // two comments created
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := b.Flag(engine.FlagRequest{Locator: loc, Flag: engine.ReadOnly, Update: engine.FlagTrue})
+	require.NoError(t, err)
+	require.NoError(t, b.Delete(engine.DeleteRequest{Locator: loc, CommentID: "id-1", DeleteMode: store.SoftDelete}))
+
+	res, err := b.Changes(engine.ChangesRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	require.Equal(t, 4, len(res))
+	assert.Equal(t, engine.ChangeCreate, res[0].Event)
+	assert.Equal(t, "id-2", res[1].Comment.ID)
+	assert.Equal(t, engine.ChangeFlag, res[2].Event)
+	assert.Equal(t, engine.ChangeDelete, res[3].Event)
+	assert.Equal(t, uint64(4), res[3].Seq)
+
+	res, err = b.Changes(engine.ChangesRequest{Locator: store.Locator{SiteID: "radio-t"}, Since: 1, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, uint64(2), res[0].Seq)
+	assert.Equal(t, uint64(3), res[1].Seq)
+
+	res, err = b.Changes(engine.ChangesRequest{Locator: store.Locator{SiteID: "radio-t"}, Last: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, uint64(4), res[0].Seq)
+}
+
+func TestMemData_Subscription(t *testing.T) {
+	b := prepMem(t)
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	subscribe := func(loc store.Locator, userID, commentID string) {
+		_, err := b.Subscription(engine.SubscriptionRequest{Locator: loc, Update: &store.Subscription{Locator: loc,
+			UserID: userID, CommentID: commentID}})
+		require.NoError(t, err)
+	}
+	subscribe(loc, "user1", "")
+	subscribe(loc, "user1", "")
+	subscribe(loc, "user1", "id-1")
+	subscribe(store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, "user2", "")
+
+	res, err := b.Subscription(engine.SubscriptionRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(res), "all subscriptions of site, the same subscription replaced")
+	res, err = b.Subscription(engine.SubscriptionRequest{Locator: loc})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(res), "subscriptions of post")
+	res, err = b.Subscription(engine.SubscriptionRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(res), "subscriptions of user")
+
+	require.NoError(t, b.Delete(engine.DeleteRequest{Locator: loc, UserID: "user1", CommentID: "id-1", Subscription: true}))
+	res, err = b.Subscription(engine.SubscriptionRequest{Locator: loc, UserID: "user1"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "", res[0].CommentID, "post subscription kept")
+
+	require.NoError(t, b.Delete(engine.DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Subscription: true}))
+	res, err = b.Subscription(engine.SubscriptionRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res), "all subscriptions of user removed")
+
+	_, err = b.Subscription(engine.SubscriptionRequest{Locator: loc, Update: &store.Subscription{Locator: loc}})
+	assert.Error(t, err)
+}
+
 func TestMemData_Close(t *testing.T) {
 	b := prepMem(t)
 	assert.NoError(t, b.Close())
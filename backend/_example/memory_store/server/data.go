@@ -106,6 +106,36 @@ func (s *RPC) userDetailHndl(id uint64, params json.RawMessage) (rr jrpc.Respons
 	return jrpc.EncodeResponse(id, value, err)
 }
 
+// reportHndl adds report or gets reports of comment or site
+func (s *RPC) reportHndl(id uint64, params json.RawMessage) (rr jrpc.Response) {
+	req := engine.ReportRequest{}
+	if err := json.Unmarshal(params, &req); err != nil {
+		return jrpc.Response{Error: err.Error()}
+	}
+	value, err := s.eng.Report(req)
+	return jrpc.EncodeResponse(id, value, err)
+}
+
+// subscriptionHndl adds subscription or gets subscriptions of post, user or site
+func (s *RPC) subscriptionHndl(id uint64, params json.RawMessage) (rr jrpc.Response) {
+	req := engine.SubscriptionRequest{}
+	if err := json.Unmarshal(params, &req); err != nil {
+		return jrpc.Response{Error: err.Error()}
+	}
+	value, err := s.eng.Subscription(req)
+	return jrpc.EncodeResponse(id, value, err)
+}
+
+// changesHndl gets entries of site's change log after sequence number
+func (s *RPC) changesHndl(id uint64, params json.RawMessage) (rr jrpc.Response) {
+	req := engine.ChangesRequest{}
+	if err := json.Unmarshal(params, &req); err != nil {
+		return jrpc.Response{Error: err.Error()}
+	}
+	value, err := s.eng.Changes(req)
+	return jrpc.EncodeResponse(id, value, err)
+}
+
 // deleteHndl delete post(s), user, comment, user details, or everything
 func (s *RPC) deleteHndl(id uint64, params json.RawMessage) (rr jrpc.Response) {
 	req := engine.DeleteRequest{}
@@ -219,6 +219,57 @@ func TestRPC_listFlagsHndl(t *testing.T) {
 	assert.Equal(t, []interface{}{"u1"}, flags)
 }
 
+func TestRPC_reportHndl(t *testing.T) {
+	port, teardown := prepTestStore(t)
+	defer teardown()
+	api := fmt.Sprintf("http://localhost:%d/test", port)
+
+	re := engine.RPC{Client: jrpc.Client{API: api, Client: http.Client{Timeout: 1 * time.Second}}}
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "test-site"}
+	res, err := re.Report(engine.ReportRequest{Locator: loc, Update: &store.Report{Locator: loc, CommentID: "c1",
+		UserID: "u1", Reason: store.ReportSpam, Text: "ads"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "ads", res[0].Text)
+
+	res, err = re.Report(engine.ReportRequest{Locator: loc, CommentID: "c1"})
+	require.NoError(t, err)
+	assert.Equal(t, []store.Report{{Locator: loc, CommentID: "c1", UserID: "u1", Reason: store.ReportSpam, Text: "ads"}}, res)
+}
+
+func TestRPC_subscriptionHndl(t *testing.T) {
+	port, teardown := prepTestStore(t)
+	defer teardown()
+	api := fmt.Sprintf("http://localhost:%d/test", port)
+
+	re := engine.RPC{Client: jrpc.Client{API: api, Client: http.Client{Timeout: 1 * time.Second}}}
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "test-site"}
+	res, err := re.Subscription(engine.SubscriptionRequest{Locator: loc, Update: &store.Subscription{Locator: loc,
+		UserID: "u1", CommentID: "c1"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+
+	res, err = re.Subscription(engine.SubscriptionRequest{Locator: store.Locator{SiteID: "test-site"}, UserID: "u1"})
+	require.NoError(t, err)
+	assert.Equal(t, []store.Subscription{{Locator: loc, UserID: "u1", CommentID: "c1"}}, res)
+}
+
+func TestRPC_changesHndl(t *testing.T) {
+	port, teardown := prepTestStore(t)
+	defer teardown()
+	api := fmt.Sprintf("http://localhost:%d/test", port)
+
+	re := engine.RPC{Client: jrpc.Client{API: api, Client: http.Client{Timeout: 1 * time.Second}}}
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "test-site"}
+	_, err := re.Create(store.Comment{ID: "c1", Locator: loc, User: store.User{ID: "u1"}})
+	require.NoError(t, err)
+	res, err := re.Changes(engine.ChangesRequest{Locator: store.Locator{SiteID: "test-site"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, engine.ChangeCreate, res[0].Event)
+	assert.Equal(t, "c1", res[0].Comment.ID)
+}
+
 func TestRPC_userDetailHndl(t *testing.T) {
 	port, teardown := prepTestStore(t)
 	defer teardown()
@@ -33,17 +33,20 @@ func NewRPC(e engine.Interface, a admin.Store, i image.Store, r *jrpc.Server) *R
 func (s *RPC) addHandlers() {
 	// data store handlers
 	s.Group("store", jrpc.HandlersGroup{
-		"create":      s.createHndl,
-		"find":        s.findHndl,
-		"get":         s.getHndl,
-		"update":      s.updateHndl,
-		"count":       s.countHndl,
-		"info":        s.infoHndl,
-		"flag":        s.flagHndl,
-		"list_flags":  s.listFlagsHndl,
-		"user_detail": s.userDetailHndl,
-		"delete":      s.deleteHndl,
-		"close":       s.closeHndl,
+		"create":       s.createHndl,
+		"find":         s.findHndl,
+		"get":          s.getHndl,
+		"update":       s.updateHndl,
+		"count":        s.countHndl,
+		"info":         s.infoHndl,
+		"flag":         s.flagHndl,
+		"list_flags":   s.listFlagsHndl,
+		"user_detail":  s.userDetailHndl,
+		"report":       s.reportHndl,
+		"subscription": s.subscriptionHndl,
+		"changes":      s.changesHndl,
+		"delete":       s.deleteHndl,
+		"close":        s.closeHndl,
 	})
 
 	// admin store handlers
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"path"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/migrator"
+)
+
+// MigrateStoreCommand set of flags and command for copying all data between storage engines
+type MigrateStoreCommand struct {
+	Sites     []string   `long:"site" env:"SITE" default:"remark" description:"site names" env-delim:","`
+	Src       StoreGroup `group:"src" namespace:"src" env-namespace:"SRC"`
+	Dst       StoreGroup `group:"dst" namespace:"dst" env-namespace:"DST"`
+	StateFile string     `long:"state" env:"STATE" default:"./var/migrate-store.json" description:"state file to resume interrupted migration"`
+	PageSize  int        `long:"page" default:"100" description:"number of posts to request at once"`
+	CommonOpts
+}
+
+// Execute runs migration with MigrateStoreCommand parameters, entry point for "migrate-store" command
+func (mc *MigrateStoreCommand) Execute(_ []string) error {
+	log.Printf("[INFO] start store migration from %s to %s, sites %v", mc.Src.Type, mc.Dst.Type, mc.Sites)
+	resetEnv("SECRET")
+
+	if mc.Src == mc.Dst {
+		return errors.New("source and destination stores are the same")
+	}
+
+	if err := makeDirs(path.Dir(mc.StateFile)); err != nil {
+		return errors.Wrap(err, "can't make directory for state file")
+	}
+
+	src, err := makeEngine(mc.Src, mc.Sites)
+	if err != nil {
+		return errors.Wrap(err, "failed to make source store")
+	}
+	defer func() {
+		if e := src.Close(); e != nil {
+			log.Printf("[WARN] failed to close source store, %v", e)
+		}
+	}()
+
+	dst, err := makeEngine(mc.Dst, mc.Sites)
+	if err != nil {
+		return errors.Wrap(err, "failed to make destination store")
+	}
+	defer func() {
+		if e := dst.Close(); e != nil {
+			log.Printf("[WARN] failed to close destination store, %v", e)
+		}
+	}()
+
+	m := migrator.EngineMigrator{Src: src, Dst: dst, StateFile: mc.StateFile, PageSize: mc.PageSize}
+	for _, site := range mc.Sites {
+		stats, err := m.Migrate(site)
+		if err != nil {
+			return errors.Wrapf(err, "failed to migrate site %s, run again to resume", site)
+		}
+		log.Printf("[INFO] completed %s, posts=%d (skipped %d), comments=%d, details=%d, blocked=%d, verified=%d",
+			site, stats.Posts, stats.Skipped, stats.Comments, stats.Details, stats.Blocked, stats.Verified)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/umputun/go-flags"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestMigrateStore_Execute(t *testing.T) {
+	dir := "/tmp/remark-migrate-store"
+	defer os.RemoveAll(dir)
+
+	// prepare source bolt store
+	grp := StoreGroup{Type: "bolt"}
+	grp.Bolt.Path, grp.Bolt.Timeout = dir+"/bolt", time.Second
+	src, err := makeEngine(grp, []string{"remark"})
+	require.NoError(t, err)
+	c := store.Comment{ID: "id1", Text: "some text", Timestamp: time.Date(2017, 12, 20, 15, 18, 22, 0, time.Local),
+		Locator: store.Locator{SiteID: "remark", URL: "https://example.com"}, User: store.User{ID: "user1"}}
+	_, err = src.Create(c)
+	require.NoError(t, err)
+	require.NoError(t, src.Close())
+
+	cmd := MigrateStoreCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err = p.ParseArgs([]string{"--site=remark", "--src.type=bolt", "--src.bolt.path=" + dir + "/bolt",
+		"--dst.type=sql", "--dst.sql.dsn=" + dir + "/sql/remark.sqlite", "--state=" + dir + "/state.json"})
+	require.NoError(t, err)
+	require.NoError(t, cmd.Execute(nil))
+
+	dst, err := engine.NewSQLDB(engine.SQLParams{Driver: "sqlite3", DSN: dir + "/sql/remark.sqlite"}, "remark")
+	require.NoError(t, err)
+	defer dst.Close()
+	res, err := dst.Get(engine.GetRequest{Locator: c.Locator, CommentID: "id1"})
+	require.NoError(t, err)
+	assert.Equal(t, "some text", res.Text)
+
+	_, err = os.Stat(dir + "/state.json")
+	assert.NoError(t, err, "state file created")
+}
+
+func TestMigrateStore_ExecuteFailed(t *testing.T) {
+	cmd := MigrateStoreCommand{}
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--src.type=bolt", "--dst.type=bolt"})
+	require.NoError(t, err)
+	assert.EqualError(t, cmd.Execute(nil), "source and destination stores are the same")
+
+	_, err = p.ParseArgs([]string{"--src.type=bolt", "--src.bolt.path=/dev/null/bad", "--dst.type=sql",
+		"--dst.sql.dsn=/tmp/remark-migrate-bad.sqlite", "--state=/tmp/remark-migrate-bad.json"})
+	require.NoError(t, err)
+	assert.Error(t, cmd.Execute(nil))
+}
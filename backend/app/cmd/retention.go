@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store/service"
+)
+
+// RetentionCommand set of flags and command for applying retention policy of the site on running server
+type RetentionCommand struct {
+	Site        string        `short:"s" long:"site" env:"SITE" default:"remark" description:"site name"`
+	Dry         bool          `long:"dry" description:"dry mode, only reports data to be removed"`
+	AdminPasswd string        `long:"admin-passwd" env:"ADMIN_PASSWD" required:"true" description:"admin basic auth password"`
+	Timeout     time.Duration `long:"timeout" default:"15m" description:"retention timeout"`
+	CommonOpts
+}
+
+// Execute runs retention with RetentionCommand parameters, entry point for "retention" command.
+// Policy of the site set on the server with --retention.* options
+func (rc *RetentionCommand) Execute(_ []string) error {
+	log.Printf("[INFO] apply retention policy, site %s, dry %v", rc.Site, rc.Dry)
+	resetEnv("SECRET", "ADMIN_PASSWD")
+
+	client := http.Client{}
+	ctx, cancel := context.WithTimeout(context.Background(), rc.Timeout)
+	defer cancel()
+	retentionURL := fmt.Sprintf("%s/api/v1/admin/retention?site=%s", rc.RemarkURL, rc.Site)
+	if rc.Dry {
+		retentionURL += "&dry=1"
+	}
+	req, err := http.NewRequest(http.MethodPost, retentionURL, nil)
+	if err != nil {
+		return errors.Wrapf(err, "can't make retention request for %s", retentionURL)
+	}
+	req.SetBasicAuth("admin", rc.AdminPasswd)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "request failed for %s", retentionURL)
+	}
+	defer func() {
+		if err = resp.Body.Close(); err != nil {
+			log.Printf("[WARN] failed to close response, %s", err)
+		}
+	}()
+
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+
+	report := service.RetentionReport{}
+	if err = json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return errors.Wrap(err, "can't decode retention report")
+	}
+	action := "removed"
+	if report.Dry {
+		action = "to be removed"
+	}
+	log.Printf("[INFO] completed, %s: voted ips of %d comments, ips of %d comments, %d emails, %d deleted comments",
+		action, report.VotedIPs, report.UserIPs, report.Emails, report.Deleted)
+	return nil
+}
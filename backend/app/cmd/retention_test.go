@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/umputun/go-flags"
+)
+
+func TestRetention_Execute(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/admin/retention", r.URL.Path)
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "remark", r.URL.Query().Get("site"))
+		user, passwd, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "admin", user)
+		assert.Equal(t, "secret", passwd)
+		fmt.Fprintf(w, `{"site":"remark","dry":%v,"voted_ips":1,"user_ips":2,"emails":3,"deleted":4}`, r.URL.Query().Get("dry") == "1")
+	}))
+	defer ts.Close()
+
+	for _, args := range [][]string{{"--site=remark", "--admin-passwd=secret"}, {"--site=remark", "--admin-passwd=secret", "--dry"}} {
+		cmd := RetentionCommand{}
+		cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+		p := flags.NewParser(&cmd, flags.Default)
+		_, err := p.ParseArgs(args)
+		require.NoError(t, err)
+		assert.NoError(t, cmd.Execute(nil))
+	}
+}
+
+func TestRetention_ExecuteFailed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+		fmt.Fprint(w, "some error")
+	}))
+	defer ts.Close()
+
+	cmd := RetentionCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--site=remark", "--admin-passwd=secret"})
+	require.NoError(t, err)
+	assert.EqualError(t, cmd.Execute(nil), `error response "500 Internal Server Error", some error`)
+
+	cmd.SetCommon(CommonOpts{RemarkURL: "http://127.0.0.1:1", SharedSecret: "123456"})
+	assert.Error(t, cmd.Execute(nil))
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/crypt"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// RotateKeyCommand set of flags and command for re-encryption of user details and ips with the new key in place
+type RotateKeyCommand struct {
+	Sites    []string   `long:"site" env:"SITE" default:"remark" description:"site names" env-delim:","`
+	Store    StoreGroup `group:"store" namespace:"store" env-namespace:"STORE"`
+	OldKey   string     `long:"old-key" env:"OLD_KEY" description:"encryption key data encrypted with, empty if not encrypted yet"`
+	NewKey   string     `long:"new-key" env:"NEW_KEY" description:"new encryption key, empty to decrypt data"`
+	IPs      bool       `long:"ips" env:"IPS" description:"re-encrypt hashes of voters' ips as well"`
+	PageSize int        `long:"page" default:"100" description:"number of posts to request at once"`
+	CommonOpts
+}
+
+// rotateStats counts values re-encrypted on the site
+type rotateStats struct {
+	details  int // users with details re-encrypted
+	comments int // comments with voters' ips re-encrypted
+	kept     int // comments with author's ip left encrypted with the old key, immutable in store
+}
+
+// Execute runs re-encryption with RotateKeyCommand parameters, entry point for "rotate-key" command.
+// All values of the site checked before the first write, so the wrong old key changes nothing
+func (rc *RotateKeyCommand) Execute(_ []string) error {
+	log.Printf("[INFO] start rotation of encryption key, sites %v, ips %v", rc.Sites, rc.IPs)
+	resetEnv("SECRET", "OLD_KEY", "NEW_KEY")
+
+	if rc.OldKey == rc.NewKey {
+		return errors.New("old and new keys are the same")
+	}
+	var from, to *crypt.Crypter
+	var err error
+	if rc.OldKey != "" {
+		if from, err = crypt.New(rc.OldKey); err != nil {
+			return errors.Wrap(err, "bad old key")
+		}
+	}
+	if rc.NewKey != "" {
+		if to, err = crypt.New(rc.NewKey); err != nil {
+			return errors.Wrap(err, "bad new key")
+		}
+	}
+
+	eng, err := makeEngine(rc.Store, rc.Sites)
+	if err != nil {
+		return errors.Wrap(err, "failed to make store")
+	}
+	defer func() {
+		if e := eng.Close(); e != nil {
+			log.Printf("[WARN] failed to close store, %v", e)
+		}
+	}()
+
+	for _, site := range rc.Sites {
+		if _, err = rc.rotate(eng, site, from, to, false); err != nil {
+			return errors.Wrapf(err, "failed to check site %s, nothing changed", site)
+		}
+		stats, e := rc.rotate(eng, site, from, to, true)
+		if e != nil {
+			return errors.Wrapf(e, "failed to rotate key of site %s", site)
+		}
+		log.Printf("[INFO] completed %s, details=%d, comments=%d", site, stats.details, stats.comments)
+		if stats.kept > 0 {
+			log.Printf("[WARN] %d comments of %s keep author's ip encrypted with the old key, "+
+				"keep it in --encryption.old-keys to see these ips", stats.kept, site)
+		}
+	}
+	return nil
+}
+
+// rotate re-encrypts user details and voters' ips of the site, only checks all of them can be decrypted if write not set
+func (rc *RotateKeyCommand) rotate(eng engine.Interface, siteID string, from, to *crypt.Crypter, write bool) (stats rotateStats, err error) {
+	details, err := eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, Detail: engine.AllUserDetails})
+	if err != nil {
+		return stats, errors.Wrapf(err, "can't get user details of %s", siteID)
+	}
+	for _, d := range details {
+		changed := false
+		for detail, value := range d.Values() {
+			if value == "" || to.IsCurrent(value) {
+				continue
+			}
+			res, e := crypt.Reencrypt(value, from, to)
+			if e != nil {
+				return stats, errors.Wrapf(e, "can't re-encrypt %s of user %s", detail, d.UserID)
+			}
+			changed = true
+			if !write {
+				continue
+			}
+			req := engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: d.UserID, Detail: detail, Update: res}
+			if _, e = eng.UserDetail(req); e != nil {
+				return stats, errors.Wrapf(e, "can't save %s of user %s", detail, d.UserID)
+			}
+		}
+		if changed {
+			stats.details++
+		}
+	}
+
+	if !rc.IPs {
+		return stats, nil
+	}
+
+	pageSize := rc.PageSize
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	for skip := 0; ; skip += pageSize {
+		posts, e := eng.Info(engine.InfoRequest{Locator: store.Locator{SiteID: siteID}, Limit: pageSize, Skip: skip})
+		if e != nil {
+			return stats, errors.Wrapf(e, "can't get list of posts for %s", siteID)
+		}
+		for _, post := range posts {
+			comments, e := eng.Find(engine.FindRequest{Locator: store.Locator{SiteID: siteID, URL: post.URL}, Sort: "time"})
+			if e != nil {
+				return stats, errors.Wrapf(e, "can't get comments of %s", post.URL)
+			}
+			for _, c := range comments {
+				if e = rc.rotateIPs(eng, c, from, to, write, &stats); e != nil {
+					return stats, e
+				}
+			}
+		}
+		if len(posts) < pageSize {
+			return stats, nil
+		}
+	}
+}
+
+// rotateIPs re-encrypts voters' ips of the comment. Author's ip is immutable in store, so it only checked
+// and counted if it stays encrypted with the old key
+func (rc *RotateKeyCommand) rotateIPs(eng engine.Interface, c store.Comment, from, to *crypt.Crypter, write bool, stats *rotateStats) error {
+	if crypt.IsEncrypted(c.User.IP) && !to.IsCurrent(c.User.IP) {
+		if _, err := from.Decrypt(c.User.IP); err != nil {
+			return errors.Wrapf(err, "can't decrypt ip of comment %s", c.ID)
+		}
+		stats.kept++
+	}
+
+	changed := false
+	votedIPs := make(map[string]store.VotedIPInfo, len(c.VotedIPs))
+	for ipHash, v := range c.VotedIPs {
+		res := ipHash
+		switch {
+		case to.IsCurrent(ipHash):
+		case !crypt.IsEncrypted(ipHash) && to != nil: // encrypted deterministically to match ips of new votes
+			res = to.EncryptDeterministic(ipHash)
+		case crypt.IsEncrypted(ipHash):
+			var err error
+			if res, err = crypt.Reencrypt(ipHash, from, to); err != nil {
+				return errors.Wrapf(err, "can't re-encrypt voters' ips of comment %s", c.ID)
+			}
+		}
+		changed = changed || res != ipHash
+		votedIPs[res] = v
+	}
+	if !changed {
+		return nil
+	}
+	stats.comments++
+	if !write {
+		return nil
+	}
+	c.VotedIPs = votedIPs
+	return errors.Wrapf(eng.Update(c), "can't save comment %s", c.ID)
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/umputun/go-flags"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/crypt"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestRotateKey_Execute(t *testing.T) {
+	dir := "/tmp/remark-rotate-key"
+	defer os.RemoveAll(dir)
+	_ = os.RemoveAll(dir)
+
+	oldKey, newKey := "old-key-0123456789", "new-key-0123456789"
+	old, err := crypt.New(oldKey)
+	require.NoError(t, err)
+	grp := StoreGroup{Type: "bolt"}
+	grp.Bolt.Path, grp.Bolt.Timeout = dir, time.Second
+	eng, err := makeEngine(grp, []string{"remark"})
+	require.NoError(t, err)
+	locator := store.Locator{SiteID: "remark", URL: "https://example.com"}
+	email, err := old.Encrypt("user1@example.com")
+	require.NoError(t, err)
+	_, err = eng.UserDetail(engine.UserDetailRequest{Locator: locator, UserID: "user1", Detail: engine.UserEmail, Update: email})
+	require.NoError(t, err)
+	_, err = eng.UserDetail(engine.UserDetailRequest{Locator: locator, UserID: "user2", Detail: engine.UserEmail, Update: "user2@example.com"})
+	require.NoError(t, err)
+	c := store.Comment{ID: "id1", Text: "some text", Timestamp: time.Date(2017, 12, 20, 15, 18, 22, 0, time.Local),
+		Locator: locator, User: store.User{ID: "user1", IP: old.EncryptDeterministic("ip-hash-1")},
+		VotedIPs: map[string]store.VotedIPInfo{old.EncryptDeterministic("ip-hash-2"): {Value: true}, "ip-hash-3": {Value: false}}}
+	_, err = eng.Create(c)
+	require.NoError(t, err)
+	require.NoError(t, eng.Close())
+
+	run := func(args ...string) error {
+		cmd := RotateKeyCommand{}
+		cmd.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+		p := flags.NewParser(&cmd, flags.Default)
+		_, err = p.ParseArgs(append([]string{"--site=remark", "--store.type=bolt", "--store.bolt.path=" + dir}, args...))
+		require.NoError(t, err)
+		return cmd.Execute(nil)
+	}
+
+	// wrong old key changes nothing
+	err = run("--old-key=bad-key-0123456789", "--new-key="+newKey, "--ips")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to check site remark, nothing changed")
+	assert.Error(t, run("--old-key="+oldKey, "--new-key="+oldKey))
+	assert.Error(t, run("--old-key="+oldKey, "--new-key=short"))
+
+	require.NoError(t, run("--old-key="+oldKey, "--new-key="+newKey, "--ips"))
+
+	c2, err := crypt.New(newKey)
+	require.NoError(t, err)
+	eng, err = makeEngine(grp, []string{"remark"})
+	require.NoError(t, err)
+	defer eng.Close()
+	details, err := eng.UserDetail(engine.UserDetailRequest{Locator: locator, Detail: engine.AllUserDetails})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(details))
+	for _, d := range details {
+		assert.True(t, c2.IsCurrent(d.Email), d.Email)
+		dec, e := c2.Decrypt(d.Email)
+		require.NoError(t, e)
+		assert.Equal(t, d.UserID+"@example.com", dec)
+	}
+	res, err := eng.Get(engine.GetRequest{Locator: locator, CommentID: "id1"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]store.VotedIPInfo{c2.EncryptDeterministic("ip-hash-2"): {Value: true},
+		c2.EncryptDeterministic("ip-hash-3"): {Value: false}}, res.VotedIPs)
+	assert.Equal(t, c.User.IP, res.User.IP, "author's ip immutable")
+}
@@ -10,6 +10,7 @@ import (
 	"os/signal"
 	"path"
 	"regexp"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
@@ -18,7 +19,6 @@ import (
 	"github.com/go-pkgz/jrpc"
 	"github.com/go-pkgz/lcw/eventbus"
 	log "github.com/go-pkgz/lgr"
-	"github.com/kyokomi/emoji"
 	"github.com/pkg/errors"
 	bolt "go.etcd.io/bbolt"
 
@@ -31,13 +31,20 @@ import (
 
 	"github.com/umputun/remark42/backend/app/migrator"
 	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/replica"
 	"github.com/umputun/remark42/backend/app/rest/api"
 	"github.com/umputun/remark42/backend/app/rest/proxy"
 	"github.com/umputun/remark42/backend/app/store"
 	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/audit"
+	"github.com/umputun/remark42/backend/app/store/crypt"
 	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/history"
 	"github.com/umputun/remark42/backend/app/store/image"
+	"github.com/umputun/remark42/backend/app/store/limiter"
+	"github.com/umputun/remark42/backend/app/store/search"
 	"github.com/umputun/remark42/backend/app/store/service"
+	"github.com/umputun/remark42/backend/app/store/spam"
 	"github.com/umputun/remark42/backend/app/templates"
 )
 
@@ -53,6 +60,17 @@ type ServerCommand struct {
 	SSL        SSLGroup        `group:"ssl" namespace:"ssl" env-namespace:"SSL"`
 	Stream     StreamGroup     `group:"stream" namespace:"stream" env-namespace:"STREAM"`
 	ImageProxy ImageProxyGroup `group:"image-proxy" namespace:"image-proxy" env-namespace:"IMAGE_PROXY"`
+	Moderation ModerationGroup `group:"moderation" namespace:"moderation" env-namespace:"MODERATION"`
+	Spam       SpamGroup       `group:"spam" namespace:"spam" env-namespace:"SPAM"`
+	Audit      AuditGroup      `group:"audit" namespace:"audit" env-namespace:"AUDIT"`
+	Report     ReportGroup     `group:"report" namespace:"report" env-namespace:"REPORT"`
+	Search     SearchGroup     `group:"search" namespace:"search" env-namespace:"SEARCH"`
+	History    HistoryGroup    `group:"history" namespace:"history" env-namespace:"HISTORY"`
+	Replica    ReplicaGroup    `group:"replica" namespace:"replica" env-namespace:"REPLICA"`
+	Encryption EncryptionGroup `group:"encryption" namespace:"encryption" env-namespace:"ENCRYPTION"`
+	Retention  RetentionGroup  `group:"retention" namespace:"retention" env-namespace:"RETENTION"`
+	Registry   RegistryGroup   `group:"registry" namespace:"registry" env-namespace:"REGISTRY"`
+	RateLimit  RateLimitGroup  `group:"ratelimit" namespace:"ratelimit" env-namespace:"RATELIMIT"`
 
 	Sites            []string      `long:"site" env:"SITE" default:"remark" description:"site names" env-delim:","`
 	AnonymousVote    bool          `long:"anon-vote" env:"ANON_VOTE" description:"enable anonymous votes (works only with VOTES_IP enabled)"`
@@ -62,6 +80,7 @@ type ServerCommand struct {
 	LegacyImageProxy bool          `long:"img-proxy" env:"IMG_PROXY" description:"[deprecated, use image-proxy.http2https] enable image proxy"`
 	MaxCommentSize   int           `long:"max-comment" env:"MAX_COMMENT_SIZE" default:"2048" description:"max comment size"`
 	MaxVotes         int           `long:"max-votes" env:"MAX_VOTES" default:"-1" description:"maximum number of votes per comment"`
+	MaxMentions      int           `long:"max-mentions" env:"MAX_MENTIONS" default:"5" description:"maximum number of users mentioned in comment, 0 to disable"`
 	RestrictVoteIP   bool          `long:"votes-ip" env:"VOTES_IP" description:"restrict votes from the same ip"`
 	DurationVoteIP   time.Duration `long:"votes-ip-time" env:"VOTES_IP_TIME" default:"5m" description:"same ip vote duration"`
 	LowScore         int           `long:"low-score" env:"LOW_SCORE" default:"-5" description:"low score threshold"`
@@ -74,6 +93,7 @@ type ServerCommand struct {
 	UpdateLimit      float64       `long:"update-limit" env:"UPDATE_LIMIT" default:"0.5" description:"updates/sec limit"`
 	RestrictedWords  []string      `long:"restricted-words" env:"RESTRICTED_WORDS" description:"words prohibited to use in comments" env-delim:","`
 	EnableEmoji      bool          `long:"emoji" env:"EMOJI" description:"enable emoji"`
+	Reactions        []string      `long:"reactions" env:"REACTIONS" description:"reactions allowed on comments, empty to disable" env-delim:","`
 	SimpleView       bool          `long:"simpler-view" env:"SIMPLE_VIEW" description:"minimal comment editor mode"`
 	ProxyCORS        bool          `long:"proxy-cors" env:"PROXY_CORS" description:"disable internal CORS and delegate it to proxy"`
 
@@ -122,11 +142,18 @@ type AuthGroup struct {
 
 // StoreGroup defines options group for store params
 type StoreGroup struct {
-	Type string `long:"type" env:"TYPE" description:"type of storage" choice:"bolt" choice:"rpc" default:"bolt"` // nolint
+	Type string `long:"type" env:"TYPE" description:"type of storage" choice:"bolt" choice:"sql" choice:"rpc" default:"bolt"` // nolint
 	Bolt struct {
-		Path    string        `long:"path" env:"PATH" default:"./var" description:"parent dir for bolt files"`
-		Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"30s" description:"bolt timeout"`
+		Path        string        `long:"path" env:"PATH" default:"./var" description:"parent dir for bolt files"`
+		Timeout     time.Duration `long:"timeout" env:"TIMEOUT" default:"30s" description:"bolt timeout"`
+		ChangesAge  time.Duration `long:"changes-age" env:"CHANGES_AGE" default:"720h" description:"max age of change log entries, 0 - unlimited"`
+		ChangesMax  int           `long:"changes-max" env:"CHANGES_MAX" default:"100000" description:"max number of change log entries per site, 0 - unlimited"`
+		MigrateOnly bool          `long:"migrate-only" env:"MIGRATE_ONLY" description:"upgrade schema of bolt files and exit, server only"`
 	} `group:"bolt" namespace:"bolt" env-namespace:"BOLT"`
+	SQL struct {
+		Driver string `long:"driver" env:"DRIVER" description:"sql driver" choice:"sqlite3" choice:"postgres" default:"sqlite3"` // nolint
+		DSN    string `long:"dsn" env:"DSN" default:"./var/remark42.sqlite" description:"sql data source name (sqlite file or postgres connection string)"`
+	} `group:"sql" namespace:"sql" env-namespace:"SQL"`
 	RPC RPCGroup `group:"rpc" namespace:"rpc" env-namespace:"RPC"`
 }
 
@@ -175,8 +202,9 @@ type CacheGroup struct {
 type AdminGroup struct {
 	Type   string `long:"type" env:"TYPE" description:"type of admin store" choice:"shared" choice:"rpc" default:"shared"` //nolint
 	Shared struct {
-		Admins []string `long:"id" env:"ID" description:"admin(s) ids" env-delim:","`
-		Email  []string `long:"email" env:"EMAIL" description:"admin emails" env-delim:","`
+		Admins   []string `long:"id" env:"ID" description:"admin(s) ids" env-delim:","`
+		Email    []string `long:"email" env:"EMAIL" description:"admin emails" env-delim:","`
+		Settings string   `long:"settings" env:"SETTINGS" default:"./var/settings.json" description:"per-site settings file, empty to disable"`
 	} `group:"shared" namespace:"shared" env-namespace:"SHARED"`
 	RPC RPCGroup `group:"rpc" namespace:"rpc" env-namespace:"RPC"`
 }
@@ -193,19 +221,36 @@ type SMTPGroup struct {
 
 // NotifyGroup defines options for notification
 type NotifyGroup struct {
-	Type      []string `long:"type" env:"TYPE" description:"type of notification" choice:"none" choice:"telegram" choice:"email" default:"none" env-delim:","` //nolint
+	Type      []string `long:"type" env:"TYPE" description:"type of notification" choice:"none" choice:"telegram" choice:"email" choice:"webhook" default:"none" env-delim:","` //nolint
 	QueueSize int      `long:"queue" env:"QUEUE" description:"size of notification queue" default:"100"`
-	Telegram  struct {
+	Queue     struct {
+		File       string        `long:"file" env:"FILE" description:"persistent notification queue bolt file location, i.e. ./var/notify_queue.db, in-memory queue if not set"`
+		Attempts   int           `long:"attempts" env:"ATTEMPTS" default:"10" description:"max delivery attempts of notification to a destination"`
+		RetryDelay time.Duration `long:"retry_delay" env:"RETRY_DELAY" default:"10s" description:"delay before the second attempt, doubled for each next one"`
+	} `group:"queue" namespace:"queue" env-namespace:"QUEUE"`
+	Telegram struct {
 		Token   string        `long:"token" env:"TOKEN" description:"telegram token"`
 		Channel string        `long:"chan" env:"CHAN" description:"telegram channel"`
 		Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"5s" description:"telegram timeout"`
 		API     string        `long:"api" env:"API" default:"https://api.telegram.org/bot" description:"telegram api prefix"`
 	} `group:"telegram" namespace:"telegram" env-namespace:"TELEGRAM"`
 	Email struct {
-		From                string `long:"from_address" env:"FROM" description:"from email address"`
-		VerificationSubject string `long:"verification_subj" env:"VERIFICATION_SUBJ" description:"verification message subject"`
-		AdminNotifications  bool   `long:"notify_admin" env:"ADMIN" description:"notify admin on new comments via ADMIN_SHARED_EMAIL"`
+		From                string        `long:"from_address" env:"FROM" description:"from email address"`
+		VerificationSubject string        `long:"verification_subj" env:"VERIFICATION_SUBJ" description:"verification message subject"`
+		AdminNotifications  bool          `long:"notify_admin" env:"ADMIN" description:"notify admin on new comments via ADMIN_SHARED_EMAIL"`
+		DigestFile          string        `long:"digest_file" env:"DIGEST_FILE" default:"./var/digest.db" description:"pending digest notifications bolt file location, empty to disable digests"`
+		DigestCheck         time.Duration `long:"digest_check" env:"DIGEST_CHECK" default:"1m" description:"interval of pending digests check"`
 	} `group:"email" namespace:"email" env-namespace:"EMAIL"`
+	Webhook struct {
+		URL        string        `long:"url" env:"URL" description:"webhook url"`
+		Secret     string        `long:"secret" env:"SECRET" description:"secret to sign webhook requests with HMAC-SHA256"`
+		Template   string        `long:"template" env:"TEMPLATE" description:"path to go template of webhook request body, json if not set"`
+		Events     []string      `long:"event" env:"EVENT" choice:"create" choice:"update" choice:"delete" choice:"vote" choice:"report" env-delim:"," description:"events sent to webhook, all if not set"` //nolint
+		Timeout    time.Duration `long:"timeout" env:"TIMEOUT" default:"5s" description:"webhook request timeout"`
+		Retries    int           `long:"retries" env:"RETRIES" default:"5" description:"max delivery attempts"`
+		RetryDelay time.Duration `long:"retry_delay" env:"RETRY_DELAY" default:"1s" description:"delay before the second attempt, doubled for each next one"`
+		DeadLetter string        `long:"dead_letter" env:"DEAD_LETTER" default:"./var/webhook_dead_letter.log" description:"log of undelivered webhook requests, empty to disable"`
+	} `group:"webhook" namespace:"webhook" env-namespace:"WEBHOOK"`
 }
 
 // SSLGroup defines options group for server ssl params
@@ -225,6 +270,94 @@ type StreamGroup struct {
 	MaxActive       int           `long:"max" env:"MAX" default:"500" description:"max number of parallel streams"`
 }
 
+// ModerationGroup defines options for pre-moderation of new comments
+type ModerationGroup struct {
+	Sites    []string `long:"site" env:"SITE" description:"sites with pre-moderation, comments held until approved" env-delim:","`
+	Verified bool     `long:"verified" env:"VERIFIED" description:"auto-approve comments of verified users"`
+	Approved int      `long:"approved" env:"APPROVED" default:"0" description:"auto-approve users with this number of approved comments"`
+}
+
+// SpamGroup defines options for spam checker
+type SpamGroup struct {
+	Type      string  `long:"type" env:"TYPE" description:"type of spam checker" choice:"none" choice:"bayes" choice:"akismet" default:"none"` // nolint
+	Threshold float64 `long:"threshold" env:"THRESHOLD" default:"0.9" description:"spam score threshold, 0..1"`
+	Reject    bool    `long:"reject" env:"REJECT" description:"reject spam instead of holding it for review"`
+	Bayes     struct {
+		Path string `long:"path" env:"PATH" default:"./var/spam.db" description:"bayes classifier db file"`
+	} `group:"bayes" namespace:"bayes" env-namespace:"BAYES"`
+	Akismet struct {
+		URL     string        `long:"url" env:"URL" default:"https://rest.akismet.com" description:"akismet api url"`
+		Key     string        `long:"key" env:"KEY" description:"akismet api key"`
+		Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"5s" description:"akismet request timeout"`
+	} `group:"akismet" namespace:"akismet" env-namespace:"AKISMET"`
+}
+
+// AuditGroup defines options for audit log of admin actions
+type AuditGroup struct {
+	File string `long:"file" env:"FILE" description:"audit log bolt file location, i.e. ./var/audit.db, disabled if not set"`
+}
+
+// ReportGroup defines options for user reports of comments
+type ReportGroup struct {
+	Threshold map[string]int `long:"threshold" env:"THRESHOLD" description:"hide comment pending review after this number of reports, per site, i.e. site-id:5" env-delim:","`
+}
+
+// SearchGroup defines options for full-text search of comments
+type SearchGroup struct {
+	File string `long:"file" env:"FILE" description:"search index bolt file location, i.e. ./var/search.db, disabled if not set"`
+}
+
+// HistoryGroup defines options for revisions of edited comments
+type HistoryGroup struct {
+	File string `long:"file" env:"FILE" default:"./var/history.db" description:"comments history bolt file location, empty to disable"`
+}
+
+// ReplicaGroup defines options for read-only replica mode
+type ReplicaGroup struct {
+	Primary     string        `long:"primary" env:"PRIMARY" description:"url of primary instance, enables read-only replica mode"`
+	AdminPasswd string        `long:"admin-passwd" env:"ADMIN_PASSWD" description:"admin basic auth password of primary"`
+	Interval    time.Duration `long:"interval" env:"INTERVAL" default:"5s" description:"interval of pulling changes from primary"`
+	TimeOut     time.Duration `long:"timeout" env:"TIMEOUT" default:"5m" description:"timeout of requests to primary, full resync included"`
+	State       string        `long:"state" env:"STATE" default:"./var/replica.json" description:"file keeping replication state, empty to resync on each start"`
+}
+
+// EncryptionGroup defines options for encryption of user details and ips at rest
+type EncryptionGroup struct {
+	Key     string   `long:"key" env:"KEY" description:"encryption key of user emails and other details, at least 16 characters, empty to disable"`
+	OldKeys []string `long:"old-keys" env:"OLD_KEYS" description:"previous encryption keys, used to read data encrypted before rotation" env-delim:","`
+	IPs     bool     `long:"ips" env:"IPS" description:"encrypt hashes of users' ips as well"`
+}
+
+// RetentionGroup defines options for retention of personal data
+type RetentionGroup struct {
+	VotedIPs map[string]int `long:"voted-ips" env:"VOTED_IPS" description:"drop voters' ips after this number of days, per site, i.e. site-id:30" env-delim:","`
+	UserIP   map[string]int `long:"user-ip" env:"USER_IP" description:"clear ip of comment's author after this number of days, per site" env-delim:","`
+	Emails   map[string]int `long:"emails" env:"EMAILS" description:"delete emails of users inactive for this number of days, per site" env-delim:","`
+	Deleted  map[string]int `long:"deleted" env:"DELETED" description:"hard-delete soft-deleted comments after this number of days, per site" env-delim:","`
+	Interval time.Duration  `long:"interval" env:"INTERVAL" default:"24h" description:"interval of applying retention policies"`
+}
+
+// RateLimitGroup defines options for posting rate limits of users, per site
+type RateLimitGroup struct {
+	Interval map[string]time.Duration `long:"interval" env:"INTERVAL" description:"min interval between comments of user, per site, i.e. site-id:30s" env-delim:","`
+	PerPost  map[string]int           `long:"per-post" env:"PER_POST" description:"max comments of user on a post per hour, per site" env-delim:","`
+	PerSite  map[string]int           `long:"per-site" env:"PER_SITE" description:"max comments of user on the site per hour, per site" env-delim:","`
+	New      struct {
+		Age      map[string]int           `long:"age" env:"AGE" description:"user is new for this number of days since the first comment, per site" env-delim:","`
+		Approved map[string]int           `long:"approved" env:"APPROVED" description:"user is new until this number of approved comments, per site" env-delim:","`
+		Interval map[string]time.Duration `long:"interval" env:"INTERVAL" description:"min interval between comments of new user, per site" env-delim:","`
+		PerPost  map[string]int           `long:"per-post" env:"PER_POST" description:"max comments of new user on a post per hour, per site" env-delim:","`
+		PerSite  map[string]int           `long:"per-site" env:"PER_SITE" description:"max comments of new user on the site per hour, per site" env-delim:","`
+	} `group:"new" namespace:"new" env-namespace:"NEW"`
+	Store     string `long:"store" env:"STORE" description:"store of recent comments, redis shared by instances" choice:"mem" choice:"redis" default:"mem"` // nolint
+	RedisAddr string `long:"redis_addr" env:"REDIS_ADDR" description:"address of redis store, address of redis cache if not set"`
+}
+
+// RegistryGroup defines options for sites managed at runtime
+type RegistryGroup struct {
+	File string `long:"file" env:"FILE" description:"registry of sites managed at runtime, i.e. ./var/sites.json, disabled if not set"`
+}
+
 // RPCGroup defines options for remote modules (plugins)
 type RPCGroup struct {
 	API          string        `long:"api" env:"API" description:"rpc extension api url"`
@@ -252,6 +385,8 @@ type serverApp struct {
 	notifyService *notify.Service
 	imageService  *image.Service
 	authenticator *auth.Service
+	replica       *replica.Replica
+	backups       *siteBackups
 	terminated    chan struct{}
 
 	authRefreshCache *authRefreshCache // stored only to close it properly on shutdown
@@ -259,8 +394,11 @@ type serverApp struct {
 
 // Execute is the entry point for "server" command, called by flag parser
 func (s *ServerCommand) Execute(_ []string) error {
-	log.Printf("[INFO] start server on port %d", s.Port)
 	resetEnv("SECRET", "AUTH_GOOGLE_CSEC", "AUTH_GITHUB_CSEC", "AUTH_FACEBOOK_CSEC", "AUTH_YANDEX_CSEC", "ADMIN_PASSWD")
+	if s.Store.Type == "bolt" && s.Store.Bolt.MigrateOnly {
+		return s.migrateSchema()
+	}
+	log.Printf("[INFO] start server on port %d", s.Port)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() { // catch signal and invoke graceful termination
@@ -334,6 +472,15 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 	}
 	log.Printf("[INFO] root url=%s", s.RemarkURL)
 
+	registry, err := s.makeRegistry()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make sites registry")
+	}
+	if registry != nil {
+		s.Sites = registry.Enabled()
+		log.Printf("[INFO] sites from registry %v", s.Sites)
+	}
+
 	storeEngine, err := s.makeDataStore()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to make data store engine")
@@ -344,6 +491,11 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 		return nil, errors.Wrap(err, "failed to make admin store")
 	}
 
+	settingsStore, err := s.makeSettingsStore(adminStore)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make site settings store")
+	}
+
 	imageService, err := s.makePicturesStore()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to make pictures store")
@@ -356,13 +508,73 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 		AdminStore:             adminStore,
 		MaxCommentSize:         s.MaxCommentSize,
 		MaxVotes:               s.MaxVotes,
+		Reactions:              s.Reactions,
 		PositiveScore:          s.PositiveScore,
 		ImageService:           imageService,
 		TitleExtractor:         service.NewTitleExtractor(http.Client{Timeout: time.Second * 5}),
 		RestrictedWordsMatcher: service.NewRestrictedWordsMatcher(service.StaticRestrictedWordsLister{Words: s.RestrictedWords}),
+		SettingsStore:          settingsStore,
+	}
+	if settingsStore != nil {
+		dataService.RestrictedWordsMatcher = service.NewRestrictedWordsMatcher(
+			service.SettingsRestrictedWordsLister{Settings: settingsStore, Words: s.RestrictedWords})
 	}
 	dataService.RestrictSameIPVotes.Enabled = s.RestrictVoteIP
 	dataService.RestrictSameIPVotes.Duration = s.DurationVoteIP
+	dataService.Moderation.Sites = s.Moderation.Sites
+	dataService.Moderation.ApproveVerified = s.Moderation.Verified
+	dataService.Moderation.ApproveAfter = s.Moderation.Approved
+	dataService.ReportThreshold = s.Report.Threshold
+	dataService.Retention = s.makeRetention()
+	if sites := s.rateLimitSites(); len(sites) > 0 {
+		for _, site := range sites {
+			log.Printf("[INFO] rate limits of %s, %+v", site, s.rateLimitPolicy(site))
+		}
+		dataService.RateLimit.Policy = s.rateLimitPolicy
+		if dataService.RateLimit.Limiter, err = s.makeLimiter(); err != nil {
+			_ = dataService.Close()
+			return nil, errors.Wrap(err, "failed to make rate limiter")
+		}
+	}
+
+	if dataService.Encryption.Crypter, err = s.makeCrypter(); err != nil {
+		_ = dataService.Close()
+		return nil, errors.Wrap(err, "failed to make encryption")
+	}
+	dataService.Encryption.IPs = s.Encryption.IPs
+	// refuse to start with the wrong key, details encrypted with it can't be read
+	for _, site := range s.Sites {
+		err = dataService.CheckEncryption(site)
+		if errors.Is(err, crypt.ErrNoKey) || errors.Is(err, crypt.ErrWrongKey) {
+			_ = dataService.Close()
+			return nil, errors.Wrap(err, "wrong or missing encryption key")
+		}
+		if err != nil {
+			log.Printf("[WARN] can't check encryption of %s, %v", site, err)
+		}
+	}
+
+	if dataService.SearchIndex, err = s.makeSearchIndex(); err != nil {
+		_ = dataService.Close()
+		return nil, errors.Wrap(err, "failed to make search index")
+	}
+	historyStore, err := s.makeHistoryStore()
+	if err != nil {
+		_ = dataService.Close()
+		return nil, errors.Wrap(err, "failed to make history store")
+	}
+	if historyStore != nil { // nil *history.Bolt would make non-nil interface
+		dataService.HistoryStore = historyStore
+	}
+
+	spamChecker, err := s.makeSpamChecker()
+	if err != nil {
+		_ = dataService.Close()
+		return nil, errors.Wrap(err, "failed to make spam checker")
+	}
+	dataService.SpamFilter.Checker = spamChecker
+	dataService.SpamFilter.Threshold = s.Spam.Threshold
+	dataService.SpamFilter.Reject = s.Spam.Reject
 
 	loadingCache, err := s.makeCache()
 	if err != nil {
@@ -376,22 +588,29 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 		return nil, errors.Wrap(err, "failed to make avatar store")
 	}
 	authRefreshCache := newAuthRefreshCache()
-	authenticator, err := s.makeAuthenticator(dataService, avatarStore, adminStore, authRefreshCache)
+	authenticator, err := s.makeAuthenticator(dataService, avatarStore, adminStore, authRefreshCache, registry)
 	if err != nil {
 		_ = dataService.Close()
 		return nil, errors.Wrap(err, "failed to make authenticator")
 	}
 
-	exporter := &migrator.Native{DataStore: dataService}
+	auditStore, err := s.makeAuditStore()
+	if err != nil {
+		_ = dataService.Close()
+		return nil, errors.Wrap(err, "failed to make audit store")
+	}
+
+	exporter := &migrator.Native{DataStore: dataService, AuditStore: auditStore, HistoryStore: dataService.HistoryStore}
 
 	migr := &api.Migrator{
 		Cache:             loadingCache,
-		NativeImporter:    &migrator.Native{DataStore: dataService},
+		NativeImporter:    &migrator.Native{DataStore: dataService, AuditStore: auditStore, HistoryStore: dataService.HistoryStore},
 		DisqusImporter:    &migrator.Disqus{DataStore: dataService},
 		WordPressImporter: &migrator.WordPress{DataStore: dataService},
-		NativeExporter:    &migrator.Native{DataStore: dataService},
+		NativeExporter:    &migrator.Native{DataStore: dataService, AuditStore: auditStore, HistoryStore: dataService.HistoryStore},
 		URLMapperMaker:    migrator.NewURLMapper,
 		KeyStore:          adminStore,
+		AuditStore:        auditStore,
 	}
 
 	var emailNotifications bool
@@ -417,11 +636,8 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 		RemarkURL:     s.RemarkURL,
 		ImageService:  imageService,
 	}
-	emojiFmt := store.CommentConverterFunc(func(text string) string { return text })
-	if s.EnableEmoji {
-		emojiFmt = func(text string) string { return emoji.Sprint(text) }
-	}
-	commentFormatter := store.NewCommentFormatter(imgProxy, emojiFmt)
+	commentFormatter := store.NewCommentFormatter(imgProxy) // emoji converted by rest handlers, can be set per site
+	commentFormatter.Mentions, commentFormatter.MaxMentions = dataService, s.MaxMentions
 
 	sslConfig, err := s.makeSSLConfig()
 	if err != nil {
@@ -429,6 +645,12 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 		return nil, errors.Wrap(err, "failed to make config of ssl server params")
 	}
 
+	replicaSrv, primaryProxy, err := s.makeReplica(storeEngine, &migrator.Native{DataStore: dataService}, loadingCache)
+	if err != nil {
+		_ = dataService.Close()
+		return nil, errors.Wrap(err, "failed to make replica")
+	}
+
 	srv := &api.Rest{
 		Version:          s.Revision,
 		DataService:      dataService,
@@ -445,6 +667,9 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 		SSLConfig:        sslConfig,
 		UpdateLimiter:    s.UpdateLimit,
 		ImageService:     imageService,
+		AuditStore:       auditStore,
+		Replica:          replicaSrv,
+		PrimaryProxy:     primaryProxy,
 		Streamer: &api.Streamer{
 			TimeOut:   s.Stream.TimeOut,
 			Refresh:   s.Stream.RefreshInterval,
@@ -459,6 +684,19 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 
 	srv.ScoreThresholds.Low, srv.ScoreThresholds.Critical = s.LowScore, s.CriticalScore
 
+	backups := &siteBackups{newBackup: func(siteID string) migrator.AutoBackup {
+		return migrator.AutoBackup{
+			Exporter:       exporter,
+			BackupLocation: s.BackupLocation,
+			SiteID:         siteID,
+			KeepMax:        s.MaxBackupFiles,
+			Duration:       24 * time.Hour,
+		}
+	}}
+	if sm := s.makeSiteManager(registry, storeEngine, adminStore, dataService, auditStore, backups); sm != nil && replicaSrv == nil {
+		srv.SiteManager = sm // replica follows sites of primary, admin requests proxied to primary
+	}
+
 	var devAuth *provider.DevAuthServer
 	if s.Auth.Dev {
 		da, errDevAuth := authenticator.DevAuth()
@@ -480,6 +718,8 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 		notifyService:    notifyService,
 		imageService:     imageService,
 		authenticator:    authenticator,
+		replica:          replicaSrv,
+		backups:          backups,
 		terminated:       make(chan struct{}),
 		authRefreshCache: authRefreshCache,
 	}, nil
@@ -499,6 +739,9 @@ func (a *serverApp) run(ctx context.Context) error {
 	}()
 
 	a.activateBackup(ctx) // runs in goroutine for each site
+	if a.replica == nil && len(a.dataService.Retention) > 0 && a.Retention.Interval > 0 {
+		go a.activateRetention(ctx) // replica gets data already removed on primary
+	}
 	if a.Auth.Dev {
 		go a.devAuth.Run(ctx) // dev oauth2 server on :8084
 	}
@@ -510,6 +753,14 @@ func (a *serverApp) run(ctx context.Context) error {
 
 	go a.imageService.Cleanup(ctx) // pictures cleanup for staging images
 
+	if a.replica != nil {
+		go a.replica.Run(ctx) // pulls changes from primary
+	}
+
+	if a.dataService.SearchIndex != nil {
+		go a.buildSearchIndex(ctx) // comments served while index built
+	}
+
 	a.restSrv.Run(a.Port)
 
 	// shutdown procedures after HTTP server is stopped
@@ -522,6 +773,11 @@ func (a *serverApp) run(ctx context.Context) error {
 	if e := a.avatarStore.Close(); e != nil {
 		log.Printf("[WARN] failed to close avatar store, %s", e)
 	}
+	if a.restSrv.AuditStore != nil {
+		if e := a.restSrv.AuditStore.Close(); e != nil {
+			log.Printf("[WARN] failed to close audit store, %s", e)
+		}
+	}
 	if e := a.restSrv.Cache.Close(); e != nil {
 		log.Printf("[WARN] failed to close rest server cache, %s", e)
 	}
@@ -545,42 +801,125 @@ func (a *serverApp) Wait() {
 
 // activateBackup runs background backups for each site
 func (a *serverApp) activateBackup(ctx context.Context) {
-	for _, siteID := range a.Sites {
-		backup := migrator.AutoBackup{
-			Exporter:       a.exporter,
-			BackupLocation: a.BackupLocation,
-			SiteID:         siteID,
-			KeepMax:        a.MaxBackupFiles,
-			Duration:       24 * time.Hour,
+	a.backups.run(ctx, a.Sites)
+}
+
+// buildSearchIndex indexes existing comments of sites with empty search index, on the first start with search enabled
+func (a *serverApp) buildSearchIndex(ctx context.Context) {
+	for _, site := range a.Sites {
+		if ctx.Err() != nil {
+			log.Printf("[INFO] search index build terminated, %v", ctx.Err())
+			return
+		}
+		if count, e := a.dataService.SearchIndex.Count(site); e != nil || count > 0 {
+			continue
+		}
+		log.Printf("[INFO] build search index for %s", site)
+		count, e := a.dataService.ReindexSearch(site)
+		if e != nil {
+			log.Printf("[WARN] failed to build search index for %s, %s", site, e)
+			continue
+		}
+		log.Printf("[INFO] search index for %s built, %d comments", site, count)
+	}
+}
+
+// activateRetention applies retention policies of sites on start and every interval
+func (a *serverApp) activateRetention(ctx context.Context) {
+	log.Printf("[INFO] activate retention policies, interval %v", a.Retention.Interval)
+	ticker := time.NewTicker(a.Retention.Interval)
+	defer ticker.Stop()
+	for {
+		for siteID := range a.dataService.Retention {
+			report, err := a.dataService.ApplyRetention(siteID, false)
+			if err != nil {
+				log.Printf("[WARN] failed to apply retention policy of %s, %v", siteID, err)
+			}
+			if !report.Changed() {
+				continue
+			}
+			a.restSrv.Cache.Flush(cache.Flusher(siteID)) // no scopes, drops all cached responses of the site
+			if a.restSrv.AuditStore != nil {
+				entry := audit.Entry{SiteID: siteID, Action: audit.ActionRetention, Params: report.Params(),
+					Actor: audit.Actor{ID: "retention", Name: "retention policy"}}
+				if e := a.restSrv.AuditStore.Add(entry); e != nil {
+					log.Printf("[WARN] can't add audit entry %+v, %v", entry, e)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("[INFO] retention terminated, %v", ctx.Err())
+			return
+		case <-ticker.C:
 		}
-		go backup.Do(ctx)
 	}
 }
 
 // makeDataStore creates store for all sites
 func (s *ServerCommand) makeDataStore() (result engine.Interface, err error) {
 	log.Printf("[INFO] make data store, type=%s", s.Store.Type)
+	return makeEngine(s.Store, s.Sites)
+}
 
-	switch s.Store.Type {
+// migrateSchema opens bolt files of all sites, upgrading their schema to the current version, and closes them
+func (s *ServerCommand) migrateSchema() error {
+	eng, err := makeEngine(s.Store, s.Sites)
+	if err != nil {
+		return errors.Wrap(err, "failed to migrate schema")
+	}
+	defer func() {
+		if e := eng.Close(); e != nil {
+			log.Printf("[WARN] failed to close data store, %v", e)
+		}
+	}()
+	if boltEng, ok := eng.(*engine.BoltDB); ok {
+		for _, site := range s.Sites {
+			version, e := boltEng.SchemaVersion(site)
+			if e != nil {
+				return errors.Wrapf(e, "can't get schema version of %s", site)
+			}
+			log.Printf("[INFO] schema of %s is up to date, version %d", site, version)
+		}
+	}
+	return nil
+}
+
+// makeEngine creates storage engine from store params for all sites
+func makeEngine(grp StoreGroup, sites []string) (result engine.Interface, err error) {
+	switch grp.Type {
 	case "bolt":
-		if err = makeDirs(s.Store.Bolt.Path); err != nil {
+		if err = makeDirs(grp.Bolt.Path); err != nil {
 			return nil, errors.Wrap(err, "failed to create bolt store")
 		}
-		sites := []engine.BoltSite{}
-		for _, site := range s.Sites {
-			sites = append(sites, engine.BoltSite{SiteID: site, FileName: fmt.Sprintf("%s/%s.db", s.Store.Bolt.Path, site)})
+		boltSites := []engine.BoltSite{}
+		for _, site := range sites {
+			boltSites = append(boltSites, engine.BoltSite{SiteID: site, FileName: fmt.Sprintf("%s/%s.db", grp.Bolt.Path, site)})
+		}
+		eng, e := engine.NewBoltDB(bolt.Options{Timeout: grp.Bolt.Timeout}, boltSites...)
+		if e != nil {
+			return nil, errors.Wrap(e, "can't initialize data store")
 		}
-		result, err = engine.NewBoltDB(bolt.Options{Timeout: s.Store.Bolt.Timeout}, sites...)
+		eng.ChangesRetention = engine.ChangesRetention{MaxAge: grp.Bolt.ChangesAge, MaxCount: grp.Bolt.ChangesMax}
+		eng.SitesPath = grp.Bolt.Path // sites added at runtime
+		return eng, nil
+	case "sql":
+		if grp.SQL.Driver == "sqlite3" {
+			if err = makeDirs(path.Dir(grp.SQL.DSN)); err != nil {
+				return nil, errors.Wrap(err, "failed to create sql store")
+			}
+		}
+		result, err = engine.NewSQLDB(engine.SQLParams{Driver: grp.SQL.Driver, DSN: grp.SQL.DSN}, sites...)
 	case "rpc":
 		r := &engine.RPC{Client: jrpc.Client{
-			API:        s.Store.RPC.API,
-			Client:     http.Client{Timeout: s.Store.RPC.TimeOut},
-			AuthUser:   s.Store.RPC.AuthUser,
-			AuthPasswd: s.Store.RPC.AuthPassword,
+			API:        grp.RPC.API,
+			Client:     http.Client{Timeout: grp.RPC.TimeOut},
+			AuthUser:   grp.RPC.AuthUser,
+			AuthPasswd: grp.RPC.AuthPassword,
 		}}
 		return r, nil
 	default:
-		return nil, errors.Errorf("unsupported store type %s", s.Store.Type)
+		return nil, errors.Errorf("unsupported store type %s", grp.Type)
 	}
 	return result, errors.Wrap(err, "can't initialize data store")
 }
@@ -642,6 +981,220 @@ func (s *ServerCommand) makePicturesStore() (*image.Service, error) {
 	return nil, errors.Errorf("unsupported pictures store type %s", s.Image.Type)
 }
 
+func (s *ServerCommand) makeAuditStore() (audit.Store, error) {
+	if s.Audit.File == "" {
+		log.Printf("[INFO] audit log disabled")
+		return nil, nil
+	}
+	log.Printf("[INFO] make audit store, file=%s", s.Audit.File)
+	if err := makeDirs(path.Dir(s.Audit.File)); err != nil {
+		return nil, errors.Wrap(err, "failed to create audit store directory")
+	}
+	return audit.NewBoltStorage(s.Audit.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+}
+
+// makeRegistry makes registry of sites managed at runtime, with sites set by options registered on the first start.
+// Returns nil if registry disabled
+func (s *ServerCommand) makeRegistry() (*admin.Registry, error) {
+	if s.Registry.File == "" {
+		log.Printf("[INFO] sites registry disabled")
+		return nil, nil
+	}
+	log.Printf("[INFO] make sites registry, file=%s", s.Registry.File)
+	if err := makeDirs(path.Dir(s.Registry.File)); err != nil {
+		return nil, errors.Wrap(err, "failed to create sites registry directory")
+	}
+	return admin.NewRegistry(s.Registry.File, s.Sites)
+}
+
+// makeSiteManager makes manager of sites, nil if registry disabled or store engine can't add sites at runtime
+func (s *ServerCommand) makeSiteManager(registry *admin.Registry, eng engine.Interface, adminStore admin.Store,
+	dataService *service.DataStore, auditStore audit.Store, backups *siteBackups) *siteManager {
+	engSites, ok := eng.(engine.SiteManager)
+	if registry == nil || !ok {
+		log.Printf("[INFO] sites management disabled")
+		return nil
+	}
+	staticStore, _ := adminStore.(*admin.StaticStore)
+	return &siteManager{
+		registry:    registry,
+		engine:      engSites,
+		adminStore:  staticStore,
+		dataService: dataService,
+		exporter:    &migrator.Native{DataStore: dataService, AuditStore: auditStore, HistoryStore: dataService.HistoryStore},
+		importer:    &migrator.Native{DataStore: dataService, AuditStore: auditStore, HistoryStore: dataService.HistoryStore},
+		backups:     backups,
+	}
+}
+
+func (s *ServerCommand) makeSearchIndex() (*search.Index, error) {
+	if s.Search.File == "" {
+		log.Printf("[INFO] search disabled")
+		return nil, nil
+	}
+	log.Printf("[INFO] make search index, file=%s", s.Search.File)
+	if err := makeDirs(path.Dir(s.Search.File)); err != nil {
+		return nil, errors.Wrap(err, "failed to create search index directory")
+	}
+	return search.NewIndex(s.Search.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+}
+
+func (s *ServerCommand) makeHistoryStore() (*history.Bolt, error) {
+	if s.History.File == "" {
+		log.Printf("[INFO] comments history disabled")
+		return nil, nil
+	}
+	log.Printf("[INFO] make history store, file=%s", s.History.File)
+	if err := makeDirs(path.Dir(s.History.File)); err != nil {
+		return nil, errors.Wrap(err, "failed to create history store directory")
+	}
+	return history.NewBoltStorage(s.History.File, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+}
+
+// makeRetention makes retention policies of sites from number of days set per site for each rule.
+// All sites set in options included, registered or not, so sites created at runtime retained too
+func (s *ServerCommand) makeRetention() map[string]service.RetentionPolicy {
+	res := map[string]service.RetentionPolicy{}
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+	sites := map[string]bool{}
+	for _, m := range []map[string]int{s.Retention.VotedIPs, s.Retention.UserIP, s.Retention.Emails, s.Retention.Deleted} {
+		for site := range m {
+			sites[site] = true
+		}
+	}
+	for site := range sites {
+		policy := service.RetentionPolicy{VotedIPs: days(s.Retention.VotedIPs[site]), UserIP: days(s.Retention.UserIP[site]),
+			Emails: days(s.Retention.Emails[site]), Deleted: days(s.Retention.Deleted[site])}
+		if policy.Enabled() {
+			log.Printf("[INFO] retention policy of %s, %+v", site, policy)
+			res[site] = policy
+		}
+	}
+	return res
+}
+
+// rateLimitPolicy makes posting rate limits of the site, resolved on each comment so sites created at runtime
+// limited too. New users limited only if the site sets any of new user's limits
+func (s *ServerCommand) rateLimitPolicy(site string) service.RateLimitPolicy {
+	rl := s.RateLimit
+	return service.RateLimitPolicy{
+		RateLimits:  service.RateLimits{Interval: rl.Interval[site], PerPost: rl.PerPost[site], PerSite: rl.PerSite[site]},
+		NewUsers:    service.RateLimits{Interval: rl.New.Interval[site], PerPost: rl.New.PerPost[site], PerSite: rl.New.PerSite[site]},
+		NewAge:      time.Duration(rl.New.Age[site]) * 24 * time.Hour,
+		NewApproved: rl.New.Approved[site],
+	}
+}
+
+// rateLimitSites returns sorted ids of sites with any of posting rate limits set, registered or not
+func (s *ServerCommand) rateLimitSites() []string {
+	uniq := map[string]bool{}
+	rl := s.RateLimit
+	for _, m := range []map[string]int{rl.PerPost, rl.PerSite, rl.New.Age, rl.New.Approved, rl.New.PerPost, rl.New.PerSite} {
+		for site := range m {
+			uniq[site] = true
+		}
+	}
+	for _, m := range []map[string]time.Duration{rl.Interval, rl.New.Interval} {
+		for site := range m {
+			uniq[site] = true
+		}
+	}
+	res := []string{}
+	for site := range uniq {
+		if s.rateLimitPolicy(site).Enabled() {
+			res = append(res, site)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// makeLimiter makes limiter of posting rate with store of recent comments in memory of the instance
+// or in redis shared by instances
+func (s *ServerCommand) makeLimiter() (*limiter.Limiter, error) {
+	if s.RateLimit.Store != "redis" {
+		if s.Cache.Type == "redis_pub_sub" {
+			log.Printf("[WARN] rate limits kept in memory of the instance and not shared with other instances, " +
+				"use --ratelimit.store=redis")
+		}
+		return &limiter.Limiter{Store: limiter.NewMemStore()}, nil
+	}
+	addr := s.RateLimit.RedisAddr
+	if addr == "" {
+		addr = s.Cache.RedisAddr
+	}
+	log.Printf("[INFO] rate limits kept in redis %s", addr)
+	redisStore, err := limiter.NewRedisStore(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &limiter.Limiter{Store: redisStore}, nil
+}
+
+// makeCrypter makes encryption of user details with the current and old keys, nil if key not set
+func (s *ServerCommand) makeCrypter() (*crypt.Crypter, error) {
+	if s.Encryption.Key == "" {
+		if s.Encryption.IPs {
+			return nil, errors.New("encryption of ips requires encryption key")
+		}
+		return nil, nil
+	}
+	log.Printf("[INFO] encryption of user details enabled, ips %v", s.Encryption.IPs)
+	return crypt.New(s.Encryption.Key, s.Encryption.OldKeys...)
+}
+
+// makeReplica makes replica following primary instance and proxy to primary, nils if replica mode not enabled
+func (s *ServerCommand) makeReplica(eng engine.Interface, importer replica.Importer, loadingCache LoadingCache) (*replica.Replica, http.Handler, error) {
+	if s.Replica.Primary == "" {
+		return nil, nil, nil
+	}
+	if !strings.HasPrefix(s.Replica.Primary, "http://") && !strings.HasPrefix(s.Replica.Primary, "https://") {
+		return nil, nil, errors.Errorf("invalid primary url %s", s.Replica.Primary)
+	}
+	log.Printf("[INFO] read-only replica of %s", s.Replica.Primary)
+	if s.Replica.State != "" {
+		if err := makeDirs(path.Dir(s.Replica.State)); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to create replica state directory")
+		}
+	}
+	r := &replica.Replica{
+		Primary:     s.Replica.Primary,
+		AdminPasswd: s.Replica.AdminPasswd,
+		Sites:       s.Sites,
+		Engine:      eng,
+		Importer:    importer,
+		Flush:       func(siteID string) { loadingCache.Flush(cache.Flusher(siteID)) }, // no scopes, drops all cached responses
+		Interval:    s.Replica.Interval,
+		StateFile:   s.Replica.State,
+		Client:      http.Client{Timeout: s.Replica.TimeOut},
+	}
+	proxy, err := r.Proxy()
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, proxy, nil
+}
+
+func (s *ServerCommand) makeSpamChecker() (service.SpamChecker, error) {
+	log.Printf("[INFO] make spam checker, type=%s", s.Spam.Type)
+	switch s.Spam.Type {
+	case "none", "":
+		return nil, nil
+	case "bayes":
+		if err := makeDirs(path.Dir(s.Spam.Bayes.Path)); err != nil {
+			return nil, errors.Wrap(err, "failed to create spam db directory")
+		}
+		return spam.NewBayes(s.Spam.Bayes.Path, bolt.Options{Timeout: 30 * time.Second})
+	case "akismet":
+		if s.Spam.Akismet.Key == "" {
+			return nil, errors.New("akismet key not set")
+		}
+		return spam.NewAkismet(spam.AkismetParams{URL: s.Spam.Akismet.URL, Key: s.Spam.Akismet.Key,
+			Blog: s.RemarkURL, Timeout: s.Spam.Akismet.Timeout}), nil
+	}
+	return nil, errors.Errorf("unsupported spam checker type %s", s.Spam.Type)
+}
+
 func (s *ServerCommand) makeAdminStore() (admin.Store, error) {
 	log.Printf("[INFO] make admin store, type=%s", s.Admin.Type)
 
@@ -669,6 +1222,24 @@ func (s *ServerCommand) makeAdminStore() (admin.Store, error) {
 	}
 }
 
+// makeSettingsStore makes per-site settings store. Rpc admin store serves settings too,
+// shared one keeps them in the file. Nil if settings file not set
+func (s *ServerCommand) makeSettingsStore(adminStore admin.Store) (admin.SettingsStore, error) {
+	if rpcStore, ok := adminStore.(*admin.RPC); ok {
+		log.Printf("[INFO] make site settings store, type=rpc")
+		return rpcStore, nil
+	}
+	if s.Admin.Shared.Settings == "" {
+		log.Printf("[INFO] site settings disabled")
+		return nil, nil
+	}
+	log.Printf("[INFO] make site settings store, file=%s", s.Admin.Shared.Settings)
+	if err := makeDirs(path.Dir(s.Admin.Shared.Settings)); err != nil {
+		return nil, errors.Wrap(err, "failed to create site settings directory")
+	}
+	return admin.NewFileSettings(s.Admin.Shared.Settings)
+}
+
 func (s *ServerCommand) makeCache() (LoadingCache, error) {
 	log.Printf("[INFO] make cache, type=%s", s.Cache.Type)
 	switch s.Cache.Type {
@@ -826,9 +1397,13 @@ func (s *ServerCommand) makeNotify(dataStore *service.DataStore, authenticator *
 				UnsubscribeURL:      s.RemarkURL + "/email/unsubscribe.html",
 				// TODO: uncomment after #560 frontend part is ready and URL is known
 				// SubscribeURL:        s.RemarkURL + "/subscribe.html?token=",
-				TokenGenFn: func(userID, email, site string) (string, error) {
+				TokenGenFn: func(userID, email, site, subscriptionID string) (string, error) {
+					handshake := userID + "::" + email
+					if subscriptionID != "" { // unsubscribe from single post or thread
+						handshake += "::" + subscriptionID
+					}
 					claims := token.Claims{
-						Handshake: &token.Handshake{ID: userID + "::" + email},
+						Handshake: &token.Handshake{ID: handshake},
 						StandardClaims: jwt.StandardClaims{
 							Audience:  site,
 							ExpiresAt: time.Now().Add(100 * 365 * 24 * time.Hour).Unix(),
@@ -854,11 +1429,31 @@ func (s *ServerCommand) makeNotify(dataStore *service.DataStore, authenticator *
 				Password: s.SMTP.Password,
 				TimeOut:  s.SMTP.TimeOut,
 			}
+			if s.Notify.Email.DigestFile != "" {
+				log.Printf("[INFO] make digest store, file=%s", s.Notify.Email.DigestFile)
+				if err := makeDirs(path.Dir(s.Notify.Email.DigestFile)); err != nil {
+					return nil, errors.Wrap(err, "failed to create digest store directory")
+				}
+				digest, err := notify.NewDigestStore(s.Notify.Email.DigestFile, bolt.Options{Timeout: s.Store.Bolt.Timeout})
+				if err != nil {
+					return nil, errors.Wrap(err, "failed to make digest store")
+				}
+				emailParams.Digest, emailParams.DigestCheckInterval = digest, s.Notify.Email.DigestCheck
+			}
 			emailService, err := notify.NewEmail(emailParams, smtpParams)
 			if err != nil {
+				if emailParams.Digest != nil {
+					_ = emailParams.Digest.Close()
+				}
 				return nil, errors.Wrap(err, "failed to create email notification destination")
 			}
 			destinations = append(destinations, emailService)
+		case "webhook":
+			webhook, err := s.makeWebhook()
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to create webhook notification destination")
+			}
+			destinations = append(destinations, webhook)
 		case "none":
 			notifyService = notify.NopService
 		default:
@@ -866,6 +1461,19 @@ func (s *ServerCommand) makeNotify(dataStore *service.DataStore, authenticator *
 		}
 	}
 
+	if len(destinations) > 0 && s.Notify.Queue.File != "" {
+		log.Printf("[INFO] make notify with persistent queue, types=%s, file=%s", s.Notify.Type, s.Notify.Queue.File)
+		if err := makeDirs(path.Dir(s.Notify.Queue.File)); err != nil {
+			return nil, errors.Wrap(err, "failed to create notification queue directory")
+		}
+		queue, err := notify.NewQueue(s.Notify.Queue.File, bolt.Options{Timeout: s.Store.Bolt.Timeout},
+			notify.QueueParams{MaxAttempts: s.Notify.Queue.Attempts, RetryDelay: s.Notify.Queue.RetryDelay})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to make notification queue")
+		}
+		return notify.NewQueuedService(dataStore, queue, 0, destinations...), nil
+	}
+
 	if len(destinations) > 0 {
 		log.Printf("[INFO] make notify, types=%s", s.Notify.Type)
 		notifyService = notify.NewService(dataStore, s.Notify.QueueSize, destinations...)
@@ -873,6 +1481,33 @@ func (s *ServerCommand) makeNotify(dataStore *service.DataStore, authenticator *
 	return notifyService, nil
 }
 
+func (s *ServerCommand) makeWebhook() (*notify.Webhook, error) {
+	params := notify.WebhookParams{
+		URL:           s.Notify.Webhook.URL,
+		Secret:        s.Notify.Webhook.Secret,
+		Timeout:       s.Notify.Webhook.Timeout,
+		Retries:       s.Notify.Webhook.Retries,
+		RetryDelay:    s.Notify.Webhook.RetryDelay,
+		DeadLetterLog: s.Notify.Webhook.DeadLetter,
+	}
+	for _, e := range s.Notify.Webhook.Events {
+		params.Events = append(params.Events, notify.Event(e))
+	}
+	if s.Notify.Webhook.Template != "" {
+		tmpl, err := ioutil.ReadFile(s.Notify.Webhook.Template)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read webhook template %s", s.Notify.Webhook.Template)
+		}
+		params.Template = string(tmpl)
+	}
+	if params.DeadLetterLog != "" {
+		if err := makeDirs(path.Dir(params.DeadLetterLog)); err != nil {
+			return nil, errors.Wrap(err, "failed to create webhook dead letter log directory")
+		}
+	}
+	return notify.NewWebhook(params)
+}
+
 func (s *ServerCommand) makeSSLConfig() (config api.SSLConfig, err error) {
 	switch s.SSL.Type {
 	case "none":
@@ -903,7 +1538,8 @@ func (s *ServerCommand) makeSSLConfig() (config api.SSLConfig, err error) {
 	return config, err
 }
 
-func (s *ServerCommand) makeAuthenticator(ds *service.DataStore, avas avatar.Store, admns admin.Store, authRefreshCache *authRefreshCache) (*auth.Service, error) {
+func (s *ServerCommand) makeAuthenticator(ds *service.DataStore, avas avatar.Store, admns admin.Store,
+	authRefreshCache *authRefreshCache, registry *admin.Registry) (*auth.Service, error) {
 	authenticator := auth.NewService(auth.Opts{
 		URL:            strings.TrimSuffix(s.RemarkURL, "/"),
 		Issuer:         "remark42",
@@ -950,6 +1586,11 @@ func (s *ServerCommand) makeAuthenticator(ds *service.DataStore, avas avatar.Sto
 			if claims.User.Audience == "" { // reject empty aud, made with old (pre 0.8.x) version of auth package
 				return false
 			}
+			if registry != nil { // reject tokens of sites disabled or deleted at runtime
+				if site, ok := registry.Get(claims.User.Audience); !ok || site.Disabled {
+					return false
+				}
+			}
 			return !claims.User.BoolAttr("blocked")
 		}),
 		JWTQuery:          "jwt", // change default from "token" as it used for deleteme
@@ -15,13 +15,22 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/go-pkgz/auth/token"
 	"github.com/umputun/go-flags"
+	bolt "go.etcd.io/bbolt"
 	"go.uber.org/goleak"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/crypt"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/limiter"
+	"github.com/umputun/remark42/backend/app/store/service"
 )
 
 func TestServerApp(t *testing.T) {
@@ -91,6 +100,27 @@ func TestServerApp_DevMode(t *testing.T) {
 	app.Wait()
 }
 
+func TestServerApp_SearchIndexBuild(t *testing.T) {
+	port := chooseRandomUnusedPort()
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		return o
+	})
+	_, err := app.dataService.Engine.Create(store.Comment{ID: "c1", Text: "existing comment",
+		Locator: store.Locator{SiteID: "remark", URL: "https://radio-t.com/blah1"}, User: store.User{ID: "user1", Name: "user1"}})
+	require.NoError(t, err)
+
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
+	assert.Eventually(t, func() bool {
+		count, e := app.dataService.SearchIndex.Count("remark")
+		return e == nil && count == 1
+	}, 5*time.Second, 50*time.Millisecond, "existing comments indexed in background")
+
+	cancel()
+	app.Wait()
+}
+
 func TestServerApp_AnonMode(t *testing.T) {
 	port := chooseRandomUnusedPort()
 	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
@@ -216,10 +246,10 @@ func TestServerApp_WithSSL(t *testing.T) {
 	// prepare options
 	p := flags.NewParser(&opts, flags.Default)
 	port := chooseRandomUnusedPort()
-	_, err := p.ParseArgs([]string{"--admin-passwd=password", "--port=" + strconv.Itoa(port), "--store.bolt.path=/tmp/xyz", "--backup=/tmp",
-		"--avatar.type=bolt", "--avatar.bolt.file=/tmp/ava-test.db", "--notify.type=none",
-		"--ssl.type=static", "--ssl.cert=testdata/cert.pem", "--ssl.key=testdata/key.pem",
-		"--ssl.port=" + strconv.Itoa(sslPort), "--image.fs.path=/tmp"})
+	_, err := p.ParseArgs(append(tempFilesArgs(t), "--admin-passwd=password", "--port="+strconv.Itoa(port),
+		"--store.bolt.path=/tmp/xyz", "--backup=/tmp", "--avatar.type=bolt", "--avatar.bolt.file=/tmp/ava-test.db",
+		"--notify.type=none", "--ssl.type=static", "--ssl.cert=testdata/cert.pem", "--ssl.key=testdata/key.pem",
+		"--ssl.port="+strconv.Itoa(sslPort), "--image.fs.path=/tmp"))
 	require.NoError(t, err)
 
 	// create app
@@ -262,6 +292,39 @@ func TestServerApp_WithSSL(t *testing.T) {
 	app.Wait()
 }
 
+func TestServerApp_WithSQLStore(t *testing.T) {
+
+	opts := ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+
+	// prepare options
+	p := flags.NewParser(&opts, flags.Default)
+	port := chooseRandomUnusedPort()
+	_, err := p.ParseArgs(append(tempFilesArgs(t), "--admin-passwd=password", "--cache.type=none",
+		"--store.type=sql", "--store.sql.dsn=/tmp/remark-test-sql/remark42.sqlite",
+		"--port="+strconv.Itoa(port), "--avatar.fs.path=/tmp"))
+	require.NoError(t, err)
+	defer os.RemoveAll("/tmp/remark-test-sql")
+	opts.Auth.Github.CSEC, opts.Auth.Github.CID = "csec", "cid"
+	opts.BackupLocation, opts.Image.FS.Path = "/tmp", "/tmp"
+
+	// create app
+	app, err := opts.newServerApp()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/find?site=remark&url=https://example.com", port))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	cancel()
+	app.Wait()
+}
+
 func TestServerApp_WithRemote(t *testing.T) {
 
 	opts := ServerCommand{}
@@ -270,9 +333,9 @@ func TestServerApp_WithRemote(t *testing.T) {
 	// prepare options
 	p := flags.NewParser(&opts, flags.Default)
 	port := chooseRandomUnusedPort()
-	_, err := p.ParseArgs([]string{"--admin-passwd=password", "--cache.type=none",
+	_, err := p.ParseArgs(append(tempFilesArgs(t), "--admin-passwd=password", "--cache.type=none",
 		"--store.type=rpc", "--store.rpc.api=http://127.0.0.1",
-		"--port=" + strconv.Itoa(port), "--admin.type=rpc", "--admin.rpc.api=http://127.0.0.1", "--avatar.fs.path=/tmp"})
+		"--port="+strconv.Itoa(port), "--admin.type=rpc", "--admin.rpc.api=http://127.0.0.1", "--avatar.fs.path=/tmp", "--audit.file="))
 	require.NoError(t, err)
 	opts.Auth.Github.CSEC, opts.Auth.Github.CID = "csec", "cid"
 	opts.BackupLocation, opts.Image.FS.Path = "/tmp", "/tmp"
@@ -305,7 +368,7 @@ func TestServerApp_Failed(t *testing.T) {
 	p := flags.NewParser(&opts, flags.Default)
 
 	// RO bolt location
-	_, err := p.ParseArgs([]string{"--backup=/tmp", "--store.bolt.path=/dev/null", "--image.fs.path=/tmp"})
+	_, err := p.ParseArgs(append(tempFilesArgs(t), "--backup=/tmp", "--store.bolt.path=/dev/null", "--image.fs.path=/tmp"))
 	assert.NoError(t, err)
 	_, err = opts.newServerApp()
 	assert.EqualError(t, err, "failed to make data store engine: failed to create bolt store: can't make directory /dev/null: mkdir /dev/null: not a directory")
@@ -315,7 +378,7 @@ func TestServerApp_Failed(t *testing.T) {
 	opts = ServerCommand{}
 	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
 
-	_, err = p.ParseArgs([]string{"--store.bolt.path=/tmp", "--backup=/dev/null/not-writable"})
+	_, err = p.ParseArgs(append(tempFilesArgs(t), "--store.bolt.path=/tmp", "--backup=/dev/null/not-writable"))
 	assert.NoError(t, err)
 	_, err = opts.newServerApp()
 	assert.EqualError(t, err, "failed to create backup store: can't make directory /dev/null/not-writable: mkdir /dev/null: not a directory")
@@ -325,7 +388,7 @@ func TestServerApp_Failed(t *testing.T) {
 	opts = ServerCommand{}
 	opts.SetCommon(CommonOpts{RemarkURL: "demo.remark42.com", SharedSecret: "123456"})
 
-	_, err = p.ParseArgs([]string{"--backup=/tmp", "----store.bolt.path=/tmp"})
+	_, err = p.ParseArgs(append(tempFilesArgs(t), "--backup=/tmp", "----store.bolt.path=/tmp"))
 	assert.NoError(t, err)
 	_, err = opts.newServerApp()
 	assert.EqualError(t, err, "invalid remark42 url demo.remark42.com")
@@ -346,7 +409,8 @@ func TestServerApp_Failed(t *testing.T) {
 	opts = ServerCommand{}
 	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
 	p = flags.NewParser(&opts, flags.Default)
-	_, err = p.ParseArgs([]string{"--store.bolt.path=/tmp", "--cache.type=redis_pub_sub", "--cache.redis_addr=wrong_address"})
+	_, err = p.ParseArgs(append(tempFilesArgs(t), "--store.bolt.path=/tmp", "--cache.type=redis_pub_sub",
+		"--cache.redis_addr=wrong_address"))
 	assert.NoError(t, err)
 	_, err = opts.newServerApp()
 	assert.EqualError(t, err,
@@ -386,8 +450,9 @@ func TestServerApp_MainSignal(t *testing.T) {
 
 	p := flags.NewParser(&s, flags.Default)
 	port := chooseRandomUnusedPort()
-	args := []string{"test", "--store.bolt.path=/tmp/xyz", "--backup=/tmp", "--avatar.type=bolt",
-		"--avatar.bolt.file=/tmp/ava-test.db", "--port=" + strconv.Itoa(port), "--notify.type=none", "--image.fs.path=/tmp"}
+	args := append([]string{"test", "--store.bolt.path=/tmp/xyz", "--backup=/tmp", "--avatar.type=bolt",
+		"--avatar.bolt.file=/tmp/ava-test.db", "--port=" + strconv.Itoa(port), "--notify.type=none", "--image.fs.path=/tmp"},
+		tempFilesArgs(t)...)
 	defer os.Remove("/tmp/ava-test.db")
 	_, err := p.ParseArgs(args)
 	require.NoError(t, err)
@@ -586,6 +651,271 @@ func TestServer_loadEmailTemplate(t *testing.T) {
 	assert.Equal(t, r, "")
 }
 
+func TestServer_makeNotifyQueue(t *testing.T) {
+	queueFile := os.TempDir() + "/test-remark-cmd-queue/notify_queue.db"
+	defer os.RemoveAll(os.TempDir() + "/test-remark-cmd-queue")
+	cmd := ServerCommand{}
+	cmd.Notify.Type = []string{"webhook"}
+	cmd.Notify.Webhook.URL = "http://127.0.0.1:1/hook"
+	cmd.Notify.Queue.File = queueFile
+	srv, err := cmd.makeNotify(nil, nil)
+	require.NoError(t, err)
+	stats, err := srv.QueueStats("remark")
+	require.NoError(t, err, "persistent queue used")
+	assert.Equal(t, 0, stats.Pending)
+	srv.Close()
+	_, err = os.Stat(queueFile)
+	assert.NoError(t, err)
+
+	cmd.Notify.Queue.File = ""
+	srv, err = cmd.makeNotify(nil, nil)
+	require.NoError(t, err)
+	_, err = srv.QueueStats("remark")
+	assert.EqualError(t, err, "persistent notification queue disabled")
+	srv.Close()
+}
+
+func TestServer_makeSearchIndex(t *testing.T) {
+	indexFile := os.TempDir() + "/test-remark-cmd-search/search.db"
+	defer os.RemoveAll(os.TempDir() + "/test-remark-cmd-search")
+	cmd := ServerCommand{}
+	cmd.Search.File = indexFile
+	idx, err := cmd.makeSearchIndex()
+	require.NoError(t, err)
+	require.NotNil(t, idx)
+	count, err := idx.Count("remark")
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+	require.NoError(t, idx.Close())
+
+	cmd.Search.File = ""
+	idx, err = cmd.makeSearchIndex()
+	require.NoError(t, err)
+	assert.Nil(t, idx, "search disabled")
+}
+
+func TestServer_makeHistoryStore(t *testing.T) {
+	historyFile := os.TempDir() + "/test-remark-cmd-history/history.db"
+	defer os.RemoveAll(os.TempDir() + "/test-remark-cmd-history")
+	cmd := ServerCommand{}
+	cmd.History.File = historyFile
+	historyStore, err := cmd.makeHistoryStore()
+	require.NoError(t, err)
+	require.NotNil(t, historyStore)
+	require.NoError(t, historyStore.Close())
+	_, err = os.Stat(historyFile)
+	assert.NoError(t, err)
+
+	cmd.History.File = ""
+	historyStore, err = cmd.makeHistoryStore()
+	require.NoError(t, err)
+	assert.Nil(t, historyStore, "history disabled")
+}
+
+func TestServer_makeSettingsStore(t *testing.T) {
+	settingsDir := os.TempDir() + "/test-remark-cmd-settings"
+	defer os.RemoveAll(settingsDir)
+	cmd := ServerCommand{}
+	cmd.Admin.Shared.Settings = settingsDir + "/settings.json"
+	settingsStore, err := cmd.makeSettingsStore(admin.NewStaticStore("secret", []string{"remark"}, nil, ""))
+	require.NoError(t, err)
+	require.NotNil(t, settingsStore)
+	assert.IsType(t, &admin.FileSettings{}, settingsStore)
+	_, err = os.Stat(settingsDir)
+	assert.NoError(t, err, "settings directory created")
+
+	rpcStore := &admin.RPC{}
+	settingsStore, err = cmd.makeSettingsStore(rpcStore)
+	require.NoError(t, err)
+	assert.Equal(t, rpcStore, settingsStore, "rpc admin store serves settings")
+
+	cmd.Admin.Shared.Settings = ""
+	settingsStore, err = cmd.makeSettingsStore(admin.NewStaticStore("secret", []string{"remark"}, nil, ""))
+	require.NoError(t, err)
+	assert.Nil(t, settingsStore, "settings disabled")
+}
+
+func TestServer_makeReplica(t *testing.T) {
+	stateDir := os.TempDir() + "/test-remark-cmd-replica"
+	defer os.RemoveAll(stateDir)
+	cmd := ServerCommand{}
+	cmd.Sites = []string{"remark"}
+	r, proxy, err := cmd.makeReplica(nil, nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, r, "replica mode disabled")
+	assert.Nil(t, proxy)
+
+	cmd.Replica.Primary, cmd.Replica.Interval, cmd.Replica.State = "https://primary.example.com", time.Second, stateDir+"/replica.json"
+	r, proxy, err = cmd.makeReplica(nil, nil, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.NotNil(t, proxy)
+	assert.Equal(t, []string{"remark"}, r.Sites)
+	_, err = os.Stat(stateDir)
+	assert.NoError(t, err, "state directory created")
+
+	cmd.Replica.Primary = "primary.example.com"
+	_, _, err = cmd.makeReplica(nil, nil, nil)
+	assert.EqualError(t, err, "invalid primary url primary.example.com")
+}
+
+func TestServerApp_MigrateOnly(t *testing.T) {
+	dir := os.TempDir() + "/test-remark-cmd-migrate"
+	defer os.RemoveAll(dir)
+	_ = os.RemoveAll(dir)
+
+	grp := StoreGroup{Type: "bolt"}
+	grp.Bolt.Path, grp.Bolt.Timeout = dir, time.Second
+	eng, err := makeEngine(grp, []string{"remark"})
+	require.NoError(t, err)
+	require.NoError(t, eng.Close())
+
+	// drop schema version, as in db made before versioning
+	db, err := bolt.Open(dir+"/remark.db", 0600, &bolt.Options{})
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket([]byte("meta")) }))
+	require.NoError(t, db.Close())
+
+	opts := ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	p := flags.NewParser(&opts, flags.Default)
+	_, err = p.ParseArgs(append(tempFilesArgs(t), "--site=remark", "--store.bolt.path="+dir, "--store.bolt.migrate-only"))
+	require.NoError(t, err)
+	require.NoError(t, opts.Execute(nil))
+
+	_, err = os.Stat(dir + "/remark.db.v0.bak")
+	assert.NoError(t, err, "backup made before migration")
+	eng, err = makeEngine(grp, []string{"remark"})
+	require.NoError(t, err)
+	defer eng.Close()
+	version, err := eng.(*engine.BoltDB).SchemaVersion("remark")
+	require.NoError(t, err)
+	assert.True(t, version > 0)
+}
+
+func TestServer_makeCrypter(t *testing.T) {
+	cmd := ServerCommand{}
+	c, err := cmd.makeCrypter()
+	require.NoError(t, err)
+	assert.Nil(t, c, "encryption disabled")
+
+	cmd.Encryption.IPs = true
+	_, err = cmd.makeCrypter()
+	assert.EqualError(t, err, "encryption of ips requires encryption key")
+
+	cmd.Encryption.Key, cmd.Encryption.OldKeys = "new-key-0123456789", []string{"old-key-0123456789"}
+	c, err = cmd.makeCrypter()
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	old, err := crypt.New("old-key-0123456789")
+	require.NoError(t, err)
+	enc, err := old.Encrypt("user@example.com")
+	require.NoError(t, err)
+	dec, err := c.Decrypt(enc)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", dec, "old key used for decryption")
+
+	cmd.Encryption.Key = "short"
+	_, err = cmd.makeCrypter()
+	assert.EqualError(t, err, "encryption key should be at least 16 characters")
+}
+
+func TestServer_makeRetention(t *testing.T) {
+	cmd := ServerCommand{Sites: []string{"remark"}}
+	assert.Equal(t, map[string]service.RetentionPolicy{}, cmd.makeRetention(), "no policies")
+
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--retention.voted-ips=remark:30", "--retention.emails=remark:365",
+		"--retention.deleted=runtime:7", "--retention.user-ip=other:0"})
+	require.NoError(t, err)
+	day := 24 * time.Hour
+	assert.Equal(t, map[string]service.RetentionPolicy{
+		"remark":  {VotedIPs: 30 * day, Emails: 365 * day},
+		"runtime": {Deleted: 7 * day},
+	}, cmd.makeRetention(), "site created at runtime included")
+}
+
+func TestServer_rateLimitPolicy(t *testing.T) {
+	cmd := ServerCommand{Sites: []string{"remark", "other"}}
+	assert.Equal(t, []string{}, cmd.rateLimitSites(), "no limits")
+	assert.False(t, cmd.rateLimitPolicy("remark").Enabled())
+
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--ratelimit.interval=remark:30s", "--ratelimit.per-post=remark:5",
+		"--ratelimit.new.age=remark:3", "--ratelimit.new.approved=remark:2", "--ratelimit.new.per-site=remark:10",
+		"--ratelimit.per-site=runtime:20", "--ratelimit.new.age=other:1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"remark", "runtime"}, cmd.rateLimitSites(), "site created at runtime included")
+	assert.Equal(t, service.RateLimitPolicy{
+		RateLimits: service.RateLimits{Interval: 30 * time.Second, PerPost: 5},
+		NewUsers:   service.RateLimits{PerSite: 10},
+		NewAge:     3 * 24 * time.Hour, NewApproved: 2,
+	}, cmd.rateLimitPolicy("remark"))
+	assert.Equal(t, service.RateLimitPolicy{RateLimits: service.RateLimits{PerSite: 20}}, cmd.rateLimitPolicy("runtime"))
+	assert.False(t, cmd.rateLimitPolicy("other").Enabled(), "age of new users alone limits nothing")
+
+}
+
+func TestServer_makeLimiter(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	cmd := ServerCommand{}
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err = p.ParseArgs([]string{"--cache.type=redis_pub_sub", "--cache.redis_addr=" + mr.Addr()})
+	require.NoError(t, err)
+	l, err := cmd.makeLimiter()
+	require.NoError(t, err)
+	assert.IsType(t, &limiter.MemStore{}, l.Store, "memory by default, even with redis cache")
+
+	cmd.RateLimit.Store = "redis"
+	l, err = cmd.makeLimiter()
+	require.NoError(t, err)
+	require.IsType(t, &limiter.RedisStore{}, l.Store, "redis of cache")
+	assert.NoError(t, l.Store.(*limiter.RedisStore).Close())
+
+	cmd.RateLimit.RedisAddr = "127.0.0.1:1"
+	_, err = cmd.makeLimiter()
+	assert.Error(t, err, "wrong redis address")
+}
+
+func TestServerApp_WrongEncryptionKey(t *testing.T) {
+	dir := "/tmp/remark-encryption"
+	defer os.RemoveAll(dir)
+	_ = os.RemoveAll(dir)
+
+	// details encrypted with another key
+	grp := StoreGroup{Type: "bolt"}
+	grp.Bolt.Path, grp.Bolt.Timeout = dir, time.Second
+	eng, err := makeEngine(grp, []string{"remark"})
+	require.NoError(t, err)
+	other, err := crypt.New("other-key-0123456789")
+	require.NoError(t, err)
+	email, err := other.Encrypt("user@example.com")
+	require.NoError(t, err)
+	_, err = eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "remark"}, UserID: "user1",
+		Detail: engine.UserEmail, Update: email})
+	require.NoError(t, err)
+	require.NoError(t, eng.Close())
+
+	opts := ServerCommand{}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	p := flags.NewParser(&opts, flags.Default)
+	_, err = p.ParseArgs(append(tempFilesArgs(t), "--backup=/tmp", "--image.fs.path=/tmp", "--avatar.fs.path=/tmp",
+		"--store.bolt.path="+dir, "--audit.file=", "--search.file=", "--history.file=", "--notify.queue.file=",
+		"--encryption.key=key-0123456789abcdef"))
+	require.NoError(t, err)
+	_, err = opts.newServerApp()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "wrong or missing encryption key")
+
+	opts.Encryption.Key = ""
+	_, err = opts.newServerApp()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "value encrypted, but no encryption key set")
+}
+
 func chooseRandomUnusedPort() (port int) {
 	for i := 0; i < 10; i++ {
 		port = 40000 + int(rand.Int31n(10000))
@@ -627,7 +957,7 @@ func prepServerApp(t *testing.T, fn func(o ServerCommand) ServerCommand) (*serve
 
 	// prepare options
 	p := flags.NewParser(&cmd, flags.Default)
-	_, err := p.ParseArgs([]string{"--admin-passwd=password", "--site=remark"})
+	_, err := p.ParseArgs(append(tempFilesArgs(t), "--admin-passwd=password", "--site=remark"))
 	require.NoError(t, err)
 	cmd.Avatar.FS.Path, cmd.Avatar.Type, cmd.BackupLocation, cmd.Image.FS.Path = "/tmp", "fs", "/tmp", "/tmp"
 	cmd.Store.Bolt.Path = fmt.Sprintf("/tmp/%d", cmd.Port)
@@ -657,6 +987,18 @@ func prepServerApp(t *testing.T, fn func(o ServerCommand) ServerCommand) (*serve
 	return createAppFromCmd(t, cmd)
 }
 
+// tempFilesArgs returns args enabling optional services with data files in temp dir removed after the test
+func tempFilesArgs(t *testing.T) []string {
+	dir, err := ioutil.TempDir("", "remark42-cmd")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return []string{"--audit.file=" + dir + "/audit.db", "--search.file=" + dir + "/search.db",
+		"--history.file=" + dir + "/history.db", "--registry.file=" + dir + "/sites.json",
+		"--admin.shared.settings=" + dir + "/settings.json", "--notify.queue.file=" + dir + "/notify_queue.db",
+		"--notify.email.digest_file=" + dir + "/digest.db", "--notify.webhook.dead_letter=" + dir + "/webhook_dead_letter.log",
+		"--spam.bayes.path=" + dir + "/spam.db", "--replica.state=" + dir + "/replica.json"}
+}
+
 func createAppFromCmd(t *testing.T, cmd ServerCommand) (*serverApp, context.Context, context.CancelFunc) {
 	app, err := cmd.newServerApp()
 	require.NoError(t, err)
@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/migrator"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/service"
+)
+
+// siteManager creates, disables, renames and deletes sites at runtime. Registry of sites is the source
+// of enabled sites for engine, admin store, auth and backups
+type siteManager struct {
+	registry    *admin.Registry
+	engine      engine.SiteManager
+	adminStore  *admin.StaticStore // nil for rpc admin store, managing sites by itself
+	dataService *service.DataStore
+	exporter    migrator.Exporter
+	importer    migrator.Importer
+	backups     *siteBackups
+
+	lock sync.Mutex // one change of sites at a time
+}
+
+// List returns all sites but deleted
+func (m *siteManager) List() []admin.Site {
+	return m.registry.List()
+}
+
+// Create makes new enabled site
+func (m *siteManager) Create(siteID string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.registry.Get(siteID); ok {
+		return errors.Wrap(admin.ErrSiteExists, siteID)
+	}
+	if err := m.engine.AddSite(siteID); err != nil {
+		return errors.Wrapf(err, "can't add store of site %s", siteID)
+	}
+	if err := m.registry.Add(siteID); err != nil {
+		if e := m.engine.RemoveSite(siteID, true); e != nil {
+			log.Printf("[WARN] can't remove store of site %s, %v", siteID, e)
+		}
+		return err
+	}
+	m.backups.start(siteID)
+	m.sync()
+	return nil
+}
+
+// SetEnabled enables or disables the site. Store of disabled site closed, the data kept
+func (m *siteManager) SetEnabled(siteID string, enabled bool) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	site, ok := m.registry.Get(siteID)
+	if !ok {
+		return errors.Wrap(admin.ErrSiteNotFound, siteID)
+	}
+	if site.Disabled != enabled {
+		return nil // already in requested state
+	}
+
+	if enabled {
+		if err := m.engine.AddSite(siteID); err != nil {
+			return errors.Wrapf(err, "can't open store of site %s", siteID)
+		}
+		if err := m.registry.SetDisabled(siteID, false); err != nil {
+			return err
+		}
+		m.backups.start(siteID)
+		m.sync()
+		return nil
+	}
+
+	if err := m.registry.SetDisabled(siteID, true); err != nil {
+		return err
+	}
+	m.sync()
+	m.backups.stop(siteID)
+	return errors.Wrapf(m.engine.RemoveSite(siteID, false), "can't close store of site %s", siteID)
+}
+
+// Rename moves all data of the site to the new id, with export of the site imported to the new one.
+// Subscriptions, reports and change log of the site are not moved
+func (m *siteManager) Rename(siteID, newID string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	site, ok := m.registry.Get(siteID)
+	if !ok {
+		return errors.Wrap(admin.ErrSiteNotFound, siteID)
+	}
+	if _, ok = m.registry.Get(newID); ok {
+		return errors.Wrap(admin.ErrSiteExists, newID)
+	}
+
+	if site.Disabled { // store of disabled site closed, opened for export
+		if err := m.engine.AddSite(siteID); err != nil {
+			return errors.Wrapf(err, "can't open store of site %s", siteID)
+		}
+	}
+	if err := m.engine.AddSite(newID); err != nil {
+		return errors.Wrapf(err, "can't add store of site %s", newID)
+	}
+	m.sync(siteID, newID) // both sites enabled in admin store while copying, as comments checked by it
+	if err := m.copySite(siteID, newID); err != nil {
+		m.sync()
+		if e := m.engine.RemoveSite(newID, true); e != nil {
+			log.Printf("[WARN] can't remove store of site %s, %v", newID, e)
+		}
+		if site.Disabled {
+			if e := m.engine.RemoveSite(siteID, false); e != nil {
+				log.Printf("[WARN] can't close store of site %s, %v", siteID, e)
+			}
+		}
+		return err
+	}
+	if err := m.registry.Rename(siteID, newID); err != nil {
+		return err
+	}
+	m.sync()
+
+	m.backups.stop(siteID)
+	m.dropSite(siteID)
+	if site.Disabled {
+		return errors.Wrapf(m.engine.RemoveSite(newID, false), "can't close store of site %s", newID)
+	}
+	m.backups.start(newID)
+	return nil
+}
+
+// Delete removes the site with all its data
+func (m *siteManager) Delete(siteID string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	site, ok := m.registry.Get(siteID)
+	if !ok {
+		return errors.Wrap(admin.ErrSiteNotFound, siteID)
+	}
+	if err := m.registry.Delete(siteID); err != nil {
+		return err
+	}
+	m.sync()
+	m.backups.stop(siteID)
+	if site.Disabled { // store of disabled site closed, opened to drop the data
+		if err := m.engine.AddSite(siteID); err != nil {
+			return errors.Wrapf(err, "can't open store of site %s", siteID)
+		}
+	}
+	m.dropSite(siteID)
+	return nil
+}
+
+// copySite exports all data of the site and imports it to another site
+func (m *siteManager) copySite(fromID, toID string) error {
+	r, w := io.Pipe()
+	go func() {
+		_, err := m.exporter.Export(w, fromID)
+		_ = w.CloseWithError(err)
+	}()
+	count, err := m.importer.Import(r, toID)
+	_ = r.CloseWithError(err) // unblocks exporter if import failed before reading all
+	if err != nil {
+		return errors.Wrapf(err, "can't copy site %s to %s", fromID, toID)
+	}
+	log.Printf("[INFO] site %s copied to %s, %d comments", fromID, toID, count)
+	return nil
+}
+
+// dropSite removes store of the site, its search index and comments history. Errors logged only,
+// as the site is not in registry anymore
+func (m *siteManager) dropSite(siteID string) {
+	if err := m.engine.RemoveSite(siteID, true); err != nil {
+		log.Printf("[WARN] can't remove store of site %s, %v", siteID, err)
+	}
+	if m.dataService.SearchIndex != nil {
+		if err := m.dataService.SearchIndex.DeleteSite(siteID); err != nil {
+			log.Printf("[WARN] can't delete search index of site %s, %v", siteID, err)
+		}
+	}
+	if m.dataService.HistoryStore != nil {
+		if err := m.dataService.HistoryStore.DeleteSite(siteID); err != nil {
+			log.Printf("[WARN] can't delete comments history of site %s, %v", siteID, err)
+		}
+	}
+}
+
+// sync sets enabled sites of admin store from registry, with extra sites enabled in addition. Should run under lock
+func (m *siteManager) sync(extra ...string) {
+	if m.adminStore != nil {
+		m.adminStore.SetSites(append(m.registry.Enabled(), extra...))
+	}
+}
+
+// siteBackups runs auto backups of sites, started and stopped with sites at runtime
+type siteBackups struct {
+	newBackup func(siteID string) migrator.AutoBackup
+
+	lock    sync.Mutex
+	ctx     context.Context // nil till run
+	cancels map[string]context.CancelFunc
+}
+
+// run starts backups of the sites, backups of all sites stopped on ctx cancellation
+func (b *siteBackups) run(ctx context.Context, sites []string) {
+	b.lock.Lock()
+	b.ctx, b.cancels = ctx, map[string]context.CancelFunc{}
+	b.lock.Unlock()
+	for _, siteID := range sites {
+		b.start(siteID)
+	}
+}
+
+// start runs backup of the site, ignored before run
+func (b *siteBackups) start(siteID string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.ctx == nil {
+		return
+	}
+	if _, ok := b.cancels[siteID]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(b.ctx)
+	b.cancels[siteID] = cancel
+	backup := b.newBackup(siteID)
+	go backup.Do(ctx)
+}
+
+// stop cancels backup of the site
+func (b *siteBackups) stop(siteID string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if cancel, ok := b.cancels[siteID]; ok {
+		cancel()
+		delete(b.cancels, siteID)
+	}
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-pkgz/auth/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestServerApp_Sites(t *testing.T) {
+	port := chooseRandomUnusedPort()
+	dir := os.TempDir() + "/test-remark-cmd-sites"
+	defer os.RemoveAll(dir)
+	_ = os.RemoveAll(dir)
+	app, ctx, cancel := prepServerApp(t, func(o ServerCommand) ServerCommand {
+		o.Port = port
+		o.Store.Bolt.Path = dir
+		o.Audit.File, o.Search.File, o.History.File = dir+"/audit.db", dir+"/search.db", dir+"/history.db"
+		o.Registry.File = dir + "/sites.json"
+		o.Notify.Type = []string{"none"}
+		return o
+	})
+	require.NotNil(t, app.restSrv.SiteManager)
+
+	go func() { _ = app.run(ctx) }()
+	waitForHTTPServerStart(port)
+
+	client := http.Client{Timeout: 10 * time.Second}
+	send := func(method, uri, body string) (code int, sites []admin.Site) {
+		req, err := http.NewRequest(method, fmt.Sprintf("http://localhost:%d%s", port, uri), strings.NewReader(body))
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if strings.HasPrefix(uri, "/api/v1/admin/sites") && resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&sites))
+		}
+		return resp.StatusCode, sites
+	}
+	ids := func(sites []admin.Site) (res []string) {
+		for _, s := range sites {
+			res = append(res, fmt.Sprintf("%s:%v", s.ID, !s.Disabled))
+		}
+		return res
+	}
+	addComment := func(site string) int {
+		code, _ := send(http.MethodPost, "/api/v1/comment",
+			`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "`+site+`"}}`)
+		return code
+	}
+	addUserComment := func(site string) int {
+		claims := token.Claims{
+			StandardClaims: jwt.StandardClaims{Audience: site, Issuer: "remark", ExpiresAt: time.Now().Add(time.Minute).Unix()},
+			User:           &token.User{ID: "dev", Name: "developer one"},
+		}
+		tkn, err := app.restSrv.Authenticator.TokenService().Token(claims)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%d/api/v1/comment", port),
+			strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "`+site+`"}}`))
+		require.NoError(t, err)
+		req.Header.Set("X-JWT", tkn)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	code, sites := send(http.MethodPost, "/api/v1/admin/sites/blog", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"remark:true", "blog:true"}, ids(sites))
+	assert.Equal(t, http.StatusCreated, addComment("blog"))
+	_, err := os.Stat(app.Store.Bolt.Path + "/blog.db")
+	assert.NoError(t, err)
+
+	code, sites = send(http.MethodPut, "/api/v1/admin/sites/blog?rename=news", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"remark:true", "news:true"}, ids(sites))
+	comments, err := app.dataService.Engine.Find(engine.FindRequest{Locator: store.Locator{SiteID: "news", URL: "https://radio-t.com/blah1"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(comments), "comments moved to the new site")
+	assert.Equal(t, "news", comments[0].Locator.SiteID)
+	_, err = os.Stat(app.Store.Bolt.Path + "/blog.db")
+	assert.True(t, os.IsNotExist(err), "store of old site removed")
+	assert.NotEqual(t, http.StatusCreated, addComment("blog"))
+	assert.Equal(t, http.StatusUnauthorized, addUserComment("blog"), "token of removed site rejected")
+	assert.Equal(t, http.StatusCreated, addUserComment("news"))
+
+	code, sites = send(http.MethodPut, "/api/v1/admin/sites/news?enabled=0", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"remark:true", "news:false"}, ids(sites))
+	assert.NotEqual(t, http.StatusCreated, addComment("news"))
+	assert.Equal(t, http.StatusUnauthorized, addUserComment("news"), "token of disabled site rejected")
+	code, _ = send(http.MethodPut, "/api/v1/admin/sites/news?enabled=1", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, http.StatusCreated, addComment("news"))
+
+	code, sites = send(http.MethodDelete, "/api/v1/admin/sites/news", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"remark:true"}, ids(sites))
+	_, err = os.Stat(app.Store.Bolt.Path + "/news.db")
+	assert.True(t, os.IsNotExist(err), "store of deleted site removed")
+	code, _ = send(http.MethodDelete, "/api/v1/admin/sites/news", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	cancel()
+	app.Wait()
+
+	registry, err := admin.NewRegistry(app.Registry.File, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"remark"}, registry.Enabled(), "registry persisted")
+}
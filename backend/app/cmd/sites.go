@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+// SitesCommand set of flags and command for managing sites of running server
+type SitesCommand struct {
+	Action      string        `long:"action" choice:"list" choice:"create" choice:"disable" choice:"enable" choice:"rename" choice:"delete" default:"list" description:"sites action"` //nolint
+	Name        string        `long:"name" description:"site name, required for all actions but list"`
+	To          string        `long:"to" description:"new site name for rename action"`
+	AdminPasswd string        `long:"admin-passwd" env:"ADMIN_PASSWD" required:"true" description:"admin basic auth password"`
+	Timeout     time.Duration `long:"timeout" default:"15m" description:"sites action timeout"`
+	CommonOpts
+}
+
+// Execute runs sites action with SitesCommand parameters, entry point for "sites" command
+func (sc *SitesCommand) Execute(_ []string) error {
+	log.Printf("[INFO] sites %s %s", sc.Action, sc.Name)
+	resetEnv("SECRET", "ADMIN_PASSWD")
+
+	method, query := http.MethodGet, ""
+	switch sc.Action {
+	case "create":
+		method = http.MethodPost
+	case "disable":
+		method, query = http.MethodPut, "?enabled=0"
+	case "enable":
+		method, query = http.MethodPut, "?enabled=1"
+	case "rename":
+		if sc.To == "" {
+			return errors.New("new site name required for rename")
+		}
+		method, query = http.MethodPut, "?rename="+url.QueryEscape(sc.To)
+	case "delete":
+		method = http.MethodDelete
+	}
+	sitesURL := fmt.Sprintf("%s/api/v1/admin/sites", sc.RemarkURL)
+	if sc.Action != "list" {
+		if sc.Name == "" {
+			return errors.Errorf("site name required for %s", sc.Action)
+		}
+		sitesURL += "/" + url.PathEscape(sc.Name) + query
+	}
+
+	client := http.Client{}
+	ctx, cancel := context.WithTimeout(context.Background(), sc.Timeout)
+	defer cancel()
+	req, err := http.NewRequest(method, sitesURL, nil)
+	if err != nil {
+		return errors.Wrapf(err, "can't make sites request for %s", sitesURL)
+	}
+	req.SetBasicAuth("admin", sc.AdminPasswd)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "request failed for %s", sitesURL)
+	}
+	defer func() {
+		if err = resp.Body.Close(); err != nil {
+			log.Printf("[WARN] failed to close response, %s", err)
+		}
+	}()
+
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+
+	sites := []admin.Site{}
+	if err = json.NewDecoder(resp.Body).Decode(&sites); err != nil {
+		return errors.Wrap(err, "can't decode sites")
+	}
+	for _, s := range sites {
+		status := "enabled"
+		if s.Disabled {
+			status = "disabled"
+		}
+		log.Printf("[INFO] site %s, %s, created %s", s.ID, status, s.Created.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/umputun/go-flags"
+)
+
+func TestSites_Execute(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.String())
+		user, passwd, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "admin", user)
+		assert.Equal(t, "secret", passwd)
+		fmt.Fprint(w, `[{"id":"remark","created":"2020-06-01T10:00:00Z"},{"id":"blog","disabled":true}]`)
+	}))
+	defer ts.Close()
+
+	for _, args := range [][]string{
+		{"--admin-passwd=secret"},
+		{"--admin-passwd=secret", "--action=create", "--name=blog"},
+		{"--admin-passwd=secret", "--action=disable", "--name=blog"},
+		{"--admin-passwd=secret", "--action=enable", "--name=blog"},
+		{"--admin-passwd=secret", "--action=rename", "--name=blog", "--to=news"},
+		{"--admin-passwd=secret", "--action=delete", "--name=news"},
+	} {
+		cmd := SitesCommand{}
+		cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+		p := flags.NewParser(&cmd, flags.Default)
+		_, err := p.ParseArgs(args)
+		require.NoError(t, err)
+		assert.NoError(t, cmd.Execute(nil), args)
+	}
+	assert.Equal(t, []string{"GET /api/v1/admin/sites", "POST /api/v1/admin/sites/blog",
+		"PUT /api/v1/admin/sites/blog?enabled=0", "PUT /api/v1/admin/sites/blog?enabled=1",
+		"PUT /api/v1/admin/sites/blog?rename=news", "DELETE /api/v1/admin/sites/news"}, requests)
+}
+
+func TestSites_ExecuteFailed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprint(w, "site exists")
+	}))
+	defer ts.Close()
+
+	cmd := SitesCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--admin-passwd=secret", "--action=create", "--name=blog"})
+	require.NoError(t, err)
+	assert.EqualError(t, cmd.Execute(nil), `error response "409 Conflict", site exists`)
+
+	cmd.Name = ""
+	assert.EqualError(t, cmd.Execute(nil), "site name required for create")
+	cmd.Action, cmd.Name = "rename", "blog"
+	assert.EqualError(t, cmd.Execute(nil), "new site name required for rename")
+
+	cmd.SetCommon(CommonOpts{RemarkURL: "http://127.0.0.1:1", SharedSecret: "123456"})
+	cmd.Action = "list"
+	assert.Error(t, cmd.Execute(nil))
+}
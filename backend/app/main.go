@@ -15,13 +15,17 @@ import (
 
 // Opts with all cli commands and flags
 type Opts struct {
-	ServerCmd  cmd.ServerCommand  `command:"server"`
-	ImportCmd  cmd.ImportCommand  `command:"import"`
-	BackupCmd  cmd.BackupCommand  `command:"backup"`
-	RestoreCmd cmd.RestoreCommand `command:"restore"`
-	AvatarCmd  cmd.AvatarCommand  `command:"avatar"`
-	CleanupCmd cmd.CleanupCommand `command:"cleanup"`
-	RemapCmd   cmd.RemapCommand   `command:"remap"`
+	ServerCmd       cmd.ServerCommand       `command:"server"`
+	ImportCmd       cmd.ImportCommand       `command:"import"`
+	BackupCmd       cmd.BackupCommand       `command:"backup"`
+	RestoreCmd      cmd.RestoreCommand      `command:"restore"`
+	AvatarCmd       cmd.AvatarCommand       `command:"avatar"`
+	CleanupCmd      cmd.CleanupCommand      `command:"cleanup"`
+	RemapCmd        cmd.RemapCommand        `command:"remap"`
+	MigrateStoreCmd cmd.MigrateStoreCommand `command:"migrate-store"`
+	RotateKeyCmd    cmd.RotateKeyCommand    `command:"rotate-key"`
+	RetentionCmd    cmd.RetentionCommand    `command:"retention"`
+	SitesCmd        cmd.SitesCommand        `command:"sites"`
 
 	RemarkURL    string `long:"url" env:"REMARK_URL" required:"true" description:"url to remark"`
 	SharedSecret string `long:"secret" env:"SECRET" required:"true" description:"shared secret key"`
@@ -26,7 +26,11 @@ func Test_Main(t *testing.T) {
 
 	port := chooseRandomUnusedPort()
 	os.Args = []string{"test", "server", "--secret=123456", "--store.bolt.path=" + dir, "--backup=/tmp",
-		"--avatar.fs.path=" + dir, "--port=" + strconv.Itoa(port), "--url=https://demo.remark42.com", "--dbg", "--notify.type=none"}
+		"--avatar.fs.path=" + dir, "--port=" + strconv.Itoa(port), "--url=https://demo.remark42.com", "--dbg", "--notify.type=none",
+		"--audit.file=" + dir + "/audit.db", "--search.file=" + dir + "/search.db", "--history.file=" + dir + "/history.db",
+		"--registry.file=" + dir + "/sites.json", "--admin.shared.settings=" + dir + "/settings.json",
+		"--notify.queue.file=" + dir + "/notify_queue.db", "--notify.email.digest_file=" + dir + "/digest.db",
+		"--notify.webhook.dead_letter=" + dir + "/webhook_dead_letter.log", "--replica.state=" + dir + "/replica.json"}
 
 	done := make(chan struct{})
 	go func() {
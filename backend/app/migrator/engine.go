@@ -0,0 +1,415 @@
+package migrator
+
+import (
+	"crypto/sha1" //nolint:gosec // used for checksums only
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// EngineMigrator copies all data of the site from one storage engine to another directly, without export/import.
+// Comments copied as-is, including votes and voted ips, as well as flags (blocked, verified, read-only), user details and reports.
+// Progress saved to the state file after each post, so interrupted migration can be resumed by running it again.
+// Posts migrated before are compared with the source by checksum and copied again if changed since.
+type EngineMigrator struct {
+	Src       engine.Interface
+	Dst       engine.Interface
+	StateFile string // resume state, optional
+	PageSize  int    // number of posts requested from source at once
+}
+
+// EngineMigrateStats reports results of the migration
+type EngineMigrateStats struct {
+	Posts    int // total posts in source
+	Comments int // comments copied during this run
+	Skipped  int // posts skipped as already migrated
+	Details  int // user details entries copied
+	Blocked  int // blocked users copied, shadow blocked included
+	Verified int // verified users copied
+	Reports  int // reports of comments copied
+	Subscrs  int // email subscriptions copied
+}
+
+// engineMigrateState kept in the state file, separately for each site
+type engineMigrateState struct {
+	Sites map[string]*siteMigrateState `json:"sites"`
+}
+
+type siteMigrateState struct {
+	Posts   map[string]string `json:"posts"` // url -> checksum of migrated and verified post
+	Flags   bool              `json:"flags"`
+	Details bool              `json:"details"`
+	Reports bool              `json:"reports"`
+	Subscrs bool              `json:"subscriptions"`
+}
+
+const defaultMigratePageSize = 100
+
+// Migrate copies site's data from Src to Dst. Each post verified after copy by comparing
+// number of comments and checksum, mismatch terminates migration.
+func (m *EngineMigrator) Migrate(siteID string) (stats EngineMigrateStats, err error) {
+	log.Printf("[INFO] migrate store for site %s", siteID)
+	st, err := m.loadState()
+	if err != nil {
+		return stats, err
+	}
+	if st.Sites[siteID] == nil {
+		st.Sites[siteID] = &siteMigrateState{Posts: map[string]string{}}
+	}
+	siteState := st.Sites[siteID]
+
+	if !siteState.Details {
+		if stats.Details, err = m.copyDetails(siteID); err != nil {
+			return stats, err
+		}
+		siteState.Details = true
+		if err = m.saveState(st); err != nil {
+			return stats, err
+		}
+	}
+
+	if !siteState.Flags {
+		if stats.Blocked, stats.Verified, err = m.copyFlags(siteID); err != nil {
+			return stats, err
+		}
+		siteState.Flags = true
+		if err = m.saveState(st); err != nil {
+			return stats, err
+		}
+	}
+
+	pageSize := m.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultMigratePageSize
+	}
+
+	for skip := 0; ; skip += pageSize {
+		posts, e := m.Src.Info(engine.InfoRequest{Locator: store.Locator{SiteID: siteID}, Limit: pageSize, Skip: skip})
+		if e != nil {
+			return stats, errors.Wrapf(e, "can't get list of posts for %s", siteID)
+		}
+		for _, post := range posts {
+			stats.Posts++
+			locator := store.Locator{SiteID: siteID, URL: post.URL}
+			comments, e := m.Src.Find(engine.FindRequest{Locator: locator, Sort: "time"})
+			if e != nil {
+				return stats, errors.Wrapf(e, "can't get comments for %s", post.URL)
+			}
+			if migrated, done := siteState.Posts[post.URL]; done {
+				// post could get new or changed comments since the previous run, copy it again if so
+				checksum, e := commentsChecksum(comments)
+				if e != nil {
+					return stats, e
+				}
+				if checksum == migrated {
+					stats.Skipped++
+					continue
+				}
+				log.Printf("[INFO] post %s changed since previous run, migrate again", post.URL)
+			}
+			count, checksum, e := m.copyPost(locator, comments)
+			if e != nil {
+				return stats, e
+			}
+			stats.Comments += count
+			siteState.Posts[post.URL] = checksum
+			if e = m.saveState(st); e != nil {
+				return stats, e
+			}
+			log.Printf("[DEBUG] migrated %s, %d comments", post.URL, count)
+			if stats.Posts%pageSize == 0 {
+				log.Printf("[INFO] site %s, migrated %d posts, %d comments", siteID, stats.Posts, stats.Comments)
+			}
+		}
+		if len(posts) < pageSize {
+			break
+		}
+	}
+
+	if !siteState.Reports {
+		if stats.Reports, err = m.copyReports(siteID); err != nil {
+			return stats, err
+		}
+		siteState.Reports = true
+		if err = m.saveState(st); err != nil {
+			return stats, err
+		}
+	}
+
+	if !siteState.Subscrs {
+		if stats.Subscrs, err = m.copySubscriptions(siteID); err != nil {
+			return stats, err
+		}
+		siteState.Subscrs = true
+		if err = m.saveState(st); err != nil {
+			return stats, err
+		}
+	}
+
+	log.Printf("[INFO] site %s migrated, %+v", siteID, stats)
+	return stats, nil
+}
+
+// copyPost copies comments of the post missing or different in destination, read-only flag and verifies the result
+func (m *EngineMigrator) copyPost(locator store.Locator, comments []store.Comment) (count int, checksum string, err error) {
+	for _, c := range comments {
+		existing, e := m.Dst.Get(engine.GetRequest{Locator: locator, CommentID: c.ID})
+		if e != nil {
+			if _, e = m.Dst.Create(c); e != nil {
+				return count, "", errors.Wrapf(e, "can't create comment %s for %s", c.ID, locator.URL)
+			}
+			if !c.Deleted {
+				count++
+				continue
+			}
+			existing = c
+			existing.Deleted = false
+		} else {
+			// already copied by previous run, update if changed in source since
+			same, e := sameComment(existing, c)
+			if e != nil {
+				return count, "", e
+			}
+			if same {
+				continue
+			}
+		}
+		if c.Deleted && !existing.Deleted {
+			// delete comment to update counters and references, exact content restored by update below
+			req := engine.DeleteRequest{Locator: locator, CommentID: c.ID, DeleteMode: deleteMode(c)}
+			if e := m.Dst.Delete(req); e != nil {
+				return count, "", errors.Wrapf(e, "can't delete comment %s for %s", c.ID, locator.URL)
+			}
+		}
+		if e := m.Dst.Update(c); e != nil {
+			return count, "", errors.Wrapf(e, "can't update comment %s for %s", c.ID, locator.URL)
+		}
+		count++
+	}
+
+	ro, err := m.Src.Flag(engine.FlagRequest{Flag: engine.ReadOnly, Locator: locator})
+	if err != nil {
+		return count, "", errors.Wrapf(err, "can't get read-only status for %s", locator.URL)
+	}
+	if ro {
+		if _, err = m.Dst.Flag(engine.FlagRequest{Flag: engine.ReadOnly, Locator: locator, Update: engine.FlagTrue}); err != nil {
+			return count, "", errors.Wrapf(err, "can't set read-only status for %s", locator.URL)
+		}
+	}
+
+	checksum, err = m.verifyPost(locator, comments)
+	return count, checksum, err
+}
+
+// verifyPost compares source comments with destination by count and checksum
+func (m *EngineMigrator) verifyPost(locator store.Locator, srcComments []store.Comment) (string, error) {
+	dstComments, err := m.Dst.Find(engine.FindRequest{Locator: locator, Sort: "time"})
+	if err != nil {
+		return "", errors.Wrapf(err, "can't get migrated comments for %s", locator.URL)
+	}
+	if len(srcComments) != len(dstComments) {
+		return "", errors.Errorf("verification failed for %s, %d comments in source, %d in destination",
+			locator.URL, len(srcComments), len(dstComments))
+	}
+	srcSum, err := commentsChecksum(srcComments)
+	if err != nil {
+		return "", err
+	}
+	dstSum, err := commentsChecksum(dstComments)
+	if err != nil {
+		return "", err
+	}
+	if srcSum != dstSum {
+		return "", errors.Errorf("verification failed for %s, checksum mismatch %s != %s", locator.URL, srcSum, dstSum)
+	}
+	return srcSum, nil
+}
+
+// copyDetails copies all user details for the site
+func (m *EngineMigrator) copyDetails(siteID string) (int, error) {
+	details, err := m.Src.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, Detail: engine.AllUserDetails})
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't get user details for %s", siteID)
+	}
+	for _, entry := range details {
+		for detail, value := range map[engine.UserDetail]string{engine.UserEmail: entry.Email, engine.UserDigest: entry.Digest,
+			engine.UserBio: entry.Bio, engine.UserWebsite: entry.Website, engine.UserMuted: entry.Muted} {
+			if value == "" {
+				continue
+			}
+			req := engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: entry.UserID,
+				Detail: detail, Update: value}
+			if _, err = m.Dst.UserDetail(req); err != nil {
+				return 0, errors.Wrapf(err, "can't set user details for %s", entry.UserID)
+			}
+		}
+	}
+	log.Printf("[DEBUG] migrated %d user details for %s", len(details), siteID)
+	return len(details), nil
+}
+
+// copyReports copies all reports of comments for the site
+func (m *EngineMigrator) copyReports(siteID string) (int, error) {
+	locator := store.Locator{SiteID: siteID}
+	reports, err := m.Src.Report(engine.ReportRequest{Locator: locator})
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't get reports for %s", siteID)
+	}
+	for i := range reports {
+		if _, err = m.Dst.Report(engine.ReportRequest{Locator: locator, Update: &reports[i]}); err != nil {
+			return i, errors.Wrapf(err, "can't add report for %s", reports[i].CommentID)
+		}
+	}
+	log.Printf("[DEBUG] migrated %d reports for %s", len(reports), siteID)
+	return len(reports), nil
+}
+
+// copySubscriptions copies all email subscriptions for the site
+func (m *EngineMigrator) copySubscriptions(siteID string) (int, error) {
+	locator := store.Locator{SiteID: siteID}
+	subscrs, err := m.Src.Subscription(engine.SubscriptionRequest{Locator: locator})
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't get subscriptions for %s", siteID)
+	}
+	for i := range subscrs {
+		if _, err = m.Dst.Subscription(engine.SubscriptionRequest{Locator: locator, Update: &subscrs[i]}); err != nil {
+			return i, errors.Wrapf(err, "can't add subscription of %s", subscrs[i].UserID)
+		}
+	}
+	log.Printf("[DEBUG] migrated %d subscriptions for %s", len(subscrs), siteID)
+	return len(subscrs), nil
+}
+
+// copyFlags copies blocked and shadow blocked users with remaining block time and verified users.
+// Read-only flags set per post in copyPost.
+func (m *EngineMigrator) copyFlags(siteID string) (blocked, verified int, err error) {
+	locator := store.Locator{SiteID: siteID}
+
+	for _, flag := range []engine.Flag{engine.Blocked, engine.ShadowBlocked} {
+		blockedList, e := m.Src.ListFlags(engine.FlagRequest{Flag: flag, Locator: locator})
+		if e != nil {
+			return blocked, 0, errors.Wrapf(e, "can't get %s users for %s", flag, siteID)
+		}
+		for _, v := range blockedList {
+			u, ok := v.(store.BlockedUser)
+			if !ok {
+				return blocked, 0, errors.Errorf("unexpected blocked user type %T", v)
+			}
+			ttl := time.Until(u.Until)
+			if ttl <= 0 {
+				continue
+			}
+			req := engine.FlagRequest{Flag: flag, Locator: locator, UserID: u.ID, Update: engine.FlagTrue, TTL: ttl}
+			if _, e = m.Dst.Flag(req); e != nil {
+				return blocked, 0, errors.Wrapf(e, "can't set %s for user %s", flag, u.ID)
+			}
+			blocked++
+		}
+	}
+
+	verifiedList, err := m.Src.ListFlags(engine.FlagRequest{Flag: engine.Verified, Locator: locator})
+	if err != nil {
+		return blocked, 0, errors.Wrapf(err, "can't get verified users for %s", siteID)
+	}
+	for _, v := range verifiedList {
+		userID, ok := v.(string)
+		if !ok {
+			return blocked, verified, errors.Errorf("unexpected verified user type %T", v)
+		}
+		req := engine.FlagRequest{Flag: engine.Verified, Locator: locator, UserID: userID, Update: engine.FlagTrue}
+		if _, err = m.Dst.Flag(req); err != nil {
+			return blocked, verified, errors.Wrapf(err, "can't set verified user %s", userID)
+		}
+		verified++
+	}
+	return blocked, verified, nil
+}
+
+func (m *EngineMigrator) loadState() (*engineMigrateState, error) {
+	st := &engineMigrateState{Sites: map[string]*siteMigrateState{}}
+	if m.StateFile == "" {
+		return st, nil
+	}
+	data, err := ioutil.ReadFile(m.StateFile)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read state file %s", m.StateFile)
+	}
+	if err = json.Unmarshal(data, st); err != nil {
+		return nil, errors.Wrapf(err, "can't parse state file %s", m.StateFile)
+	}
+	if st.Sites == nil {
+		st.Sites = map[string]*siteMigrateState{}
+	}
+	log.Printf("[INFO] resume migration from %s", m.StateFile)
+	return st, nil
+}
+
+// saveState writes state to temp file and renames it, to avoid broken state on crash
+func (m *EngineMigrator) saveState(st *engineMigrateState) error {
+	if m.StateFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return errors.Wrap(err, "can't marshal state")
+	}
+	tmpFile := m.StateFile + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		return errors.Wrapf(err, "can't write state file %s", tmpFile)
+	}
+	return errors.Wrapf(os.Rename(tmpFile, m.StateFile), "can't save state file %s", m.StateFile)
+}
+
+// commentsChecksum makes sha1 of json-serialized comments sorted by id
+func commentsChecksum(comments []store.Comment) (string, error) {
+	sorted := make([]store.Comment, len(comments))
+	copy(sorted, comments)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	h := sha1.New() //nolint:gosec // used for checksums only
+	for _, c := range sorted {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return "", errors.Wrapf(err, "can't marshal comment %s", c.ID)
+		}
+		if _, err = h.Write(data); err != nil {
+			return "", errors.Wrap(err, "can't make checksum")
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sameComment checks if two versions of the comment are identical
+func sameComment(c1, c2 store.Comment) (bool, error) {
+	sum1, err := commentsChecksum([]store.Comment{c1})
+	if err != nil {
+		return false, err
+	}
+	sum2, err := commentsChecksum([]store.Comment{c2})
+	if err != nil {
+		return false, err
+	}
+	return sum1 == sum2, nil
+}
+
+// deleteMode detects how the deleted comment was removed, hard delete clears user info in addition to content
+func deleteMode(c store.Comment) store.DeleteMode {
+	hard := c
+	hard.SetDeleted(store.HardDelete)
+	if c.User.ID == hard.User.ID && c.User.Name == hard.User.Name && c.User.Picture == "" && c.User.IP == "" {
+		return store.HardDelete
+	}
+	return store.SoftDelete
+}
@@ -0,0 +1,278 @@
+package migrator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestEngineMigrator_Migrate(t *testing.T) {
+	src, dst, teardown := prepEngines(t)
+	defer teardown()
+
+	stateFile := "/tmp/remark-migrate-state.json"
+	defer os.Remove(stateFile)
+
+	m := EngineMigrator{Src: src, Dst: dst, StateFile: stateFile, PageSize: 2}
+	stats, err := m.Migrate("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, EngineMigrateStats{Posts: 3, Comments: 7, Details: 1, Blocked: 2, Verified: 1, Reports: 1, Subscrs: 1}, stats)
+
+	for _, url := range []string{"https://radio-t.com/1", "https://radio-t.com/2", "https://radio-t.com/3"} {
+		loc := store.Locator{SiteID: "radio-t", URL: url}
+		srcComments, e := src.Find(engine.FindRequest{Locator: loc, Sort: "time"})
+		require.NoError(t, e)
+		dstComments, e := dst.Find(engine.FindRequest{Locator: loc, Sort: "time"})
+		require.NoError(t, e)
+		assert.Equal(t, len(srcComments), len(dstComments))
+		for i := range srcComments {
+			assert.Equal(t, srcComments[i].VotedIPs, dstComments[i].VotedIPs)
+			assert.Equal(t, srcComments[i].Text, dstComments[i].Text)
+		}
+	}
+
+	c, err := dst.Count(engine.FindRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/1"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, c, "deleted comment not counted")
+
+	ro, err := dst.Flag(engine.FlagRequest{Flag: engine.ReadOnly, Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/2"}})
+	require.NoError(t, err)
+	assert.True(t, ro)
+
+	blocked, err := dst.Flag(engine.FlagRequest{Flag: engine.Blocked, Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2"})
+	require.NoError(t, err)
+	assert.True(t, blocked)
+	shadowBlocked, err := dst.Flag(engine.FlagRequest{Flag: engine.ShadowBlocked, Locator: store.Locator{SiteID: "radio-t"}, UserID: "user3"})
+	require.NoError(t, err)
+	assert.True(t, shadowBlocked)
+
+	verified, err := dst.Flag(engine.FlagRequest{Flag: engine.Verified, Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1"})
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	details, err := dst.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Detail: engine.UserEmail})
+	require.NoError(t, err)
+	assert.Equal(t, []engine.UserDetailEntry{{UserID: "user1", Email: "user1@example.com"}}, details)
+	details, err = dst.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Detail: engine.UserDigest})
+	require.NoError(t, err)
+	assert.Equal(t, []engine.UserDetailEntry{{UserID: "user1", Digest: "daily"}}, details)
+	details, err = dst.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Detail: engine.UserBio})
+	require.NoError(t, err)
+	assert.Equal(t, []engine.UserDetailEntry{{UserID: "user1", Bio: "about me"}}, details)
+
+	reports, err := dst.Report(engine.ReportRequest{Locator: store.Locator{SiteID: "radio-t"}, CommentID: "id-3-0"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(reports))
+	assert.Equal(t, "user2", reports[0].UserID)
+
+	subscrs, err := dst.Subscription(engine.SubscriptionRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(subscrs))
+	assert.Equal(t, "https://radio-t.com/3", subscrs[0].Locator.URL)
+
+	// second run skips everything
+	stats, err = m.Migrate("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, EngineMigrateStats{Posts: 3, Skipped: 3}, stats)
+}
+
+func TestEngineMigrator_Resume(t *testing.T) {
+	src, dst, teardown := prepEngines(t)
+	defer teardown()
+
+	stateFile := "/tmp/remark-migrate-state.json"
+	defer os.Remove(stateFile)
+
+	// simulate interrupted run, one post done and one comment of the next post copied
+	loc := store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/3"}
+	comments, err := src.Find(engine.FindRequest{Locator: loc, Sort: "time"})
+	require.NoError(t, err)
+	checksum, err := commentsChecksum(comments)
+	require.NoError(t, err)
+	state := `{"sites":{"radio-t":{"posts":{"https://radio-t.com/3":"` + checksum + `"},"flags":true,"details":true}}}`
+	require.NoError(t, ioutil.WriteFile(stateFile, []byte(state), 0600))
+	c, err := src.Get(engine.GetRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/2"}, CommentID: "id-2-0"})
+	require.NoError(t, err)
+	_, err = dst.Create(c)
+	require.NoError(t, err)
+
+	m := EngineMigrator{Src: src, Dst: dst, StateFile: stateFile}
+	stats, err := m.Migrate("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, EngineMigrateStats{Posts: 3, Skipped: 1, Comments: 3, Reports: 1, Subscrs: 1}, stats)
+
+	comments, err = dst.Find(engine.FindRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/2"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(comments))
+
+	_, err = dst.Find(engine.FindRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/3"}})
+	assert.Error(t, err, "post marked as done in state, not copied")
+}
+
+func TestEngineMigrator_ResumeChanged(t *testing.T) {
+	src, dst, teardown := prepEngines(t)
+	defer teardown()
+
+	stateFile := "/tmp/remark-migrate-state.json"
+	defer os.Remove(stateFile)
+
+	m := EngineMigrator{Src: src, Dst: dst, StateFile: stateFile}
+	_, err := m.Migrate("radio-t")
+	require.NoError(t, err)
+
+	// posts changed in source after the first run, new comment, edited comment and hard deleted comment
+	ts := time.Date(2017, 12, 20, 15, 30, 0, 0, time.Local)
+	_, err = src.Create(store.Comment{ID: "id-1-new", Text: "new text", Timestamp: ts, User: store.User{ID: "user2"},
+		Locator: store.Locator{URL: "https://radio-t.com/1", SiteID: "radio-t"}})
+	require.NoError(t, err)
+	c, err := src.Get(engine.GetRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/2"}, CommentID: "id-2-0"})
+	require.NoError(t, err)
+	c.Text = "edited text"
+	require.NoError(t, src.Update(c))
+	require.NoError(t, src.Delete(engine.DeleteRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/3"},
+		CommentID: "id-3-1", DeleteMode: store.HardDelete}))
+
+	stats, err := m.Migrate("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, EngineMigrateStats{Posts: 3, Comments: 3}, stats)
+
+	c, err = dst.Get(engine.GetRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/1"}, CommentID: "id-1-new"})
+	require.NoError(t, err)
+	assert.Equal(t, "new text", c.Text)
+	c, err = dst.Get(engine.GetRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/2"}, CommentID: "id-2-0"})
+	require.NoError(t, err)
+	assert.Equal(t, "edited text", c.Text)
+	c, err = dst.Get(engine.GetRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/3"}, CommentID: "id-3-1"})
+	require.NoError(t, err)
+	assert.True(t, c.Deleted)
+	assert.Equal(t, "deleted", c.User.ID)
+
+	count, err := dst.Count(engine.FindRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/1"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = dst.Count(engine.FindRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/3"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "hard deleted comment not counted")
+
+	// nothing changed since, all posts skipped
+	stats, err = m.Migrate("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, EngineMigrateStats{Posts: 3, Skipped: 3}, stats)
+}
+
+func TestEngineMigrator_VerifyFailed(t *testing.T) {
+	src, dst, teardown := prepEngines(t)
+	defer teardown()
+
+	// destination has a comment missing in source
+	c, err := src.Get(engine.GetRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/1"}, CommentID: "id-1-0"})
+	require.NoError(t, err)
+	c.ID = "id-1-extra"
+	_, err = dst.Create(c)
+	require.NoError(t, err)
+
+	m := EngineMigrator{Src: src, Dst: dst}
+	_, err = m.Migrate("radio-t")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "verification failed for https://radio-t.com/1, 2 comments in source, 3 in destination")
+}
+
+func TestEngineMigrator_deleteMode(t *testing.T) {
+	c := store.Comment{ID: "id1", Text: "text", User: store.User{ID: "user1", Name: "user name", IP: "ip"}}
+	soft, hard := c, c
+	soft.SetDeleted(store.SoftDelete)
+	hard.SetDeleted(store.HardDelete)
+	assert.Equal(t, store.SoftDelete, deleteMode(soft))
+	assert.Equal(t, store.HardDelete, deleteMode(hard))
+}
+
+func TestEngineMigrator_BadState(t *testing.T) {
+	stateFile := "/tmp/remark-migrate-state.json"
+	defer os.Remove(stateFile)
+	require.NoError(t, ioutil.WriteFile(stateFile, []byte("bad json"), 0600))
+
+	m := EngineMigrator{StateFile: stateFile}
+	_, err := m.Migrate("radio-t")
+	assert.Error(t, err)
+}
+
+// prepEngines makes source bolt store with 3 posts and empty destination sql store
+func prepEngines(t *testing.T) (src, dst engine.Interface, teardown func()) {
+	srcFile, dstFile := "/tmp/remark-migrate-src.db", "/tmp/remark-migrate-dst.db"
+	_ = os.Remove(srcFile)
+	_ = os.Remove(dstFile)
+
+	b, err := engine.NewBoltDB(bolt.Options{}, engine.BoltSite{FileName: srcFile, SiteID: "radio-t"})
+	require.NoError(t, err)
+	s, err := engine.NewSQLDB(engine.SQLParams{Driver: "sqlite3", DSN: dstFile}, "radio-t")
+	require.NoError(t, err)
+
+	ts := time.Date(2017, 12, 20, 15, 18, 22, 0, time.Local)
+	for i := 1; i <= 3; i++ {
+		for j := 0; j < i; j++ {
+			c := store.Comment{
+				ID:        fmt.Sprintf("id-%d-%d", i, j),
+				Text:      fmt.Sprintf("text %d %d", i, j),
+				Timestamp: ts.Add(time.Duration(i*10+j) * time.Second),
+				Locator:   store.Locator{URL: fmt.Sprintf("https://radio-t.com/%d", i), SiteID: "radio-t"},
+				User:      store.User{ID: fmt.Sprintf("user%d", j+1), Name: "user name"},
+				Score:     j,
+				VotedIPs:  map[string]store.VotedIPInfo{"ip1": {Timestamp: ts, Value: true}},
+			}
+			_, err = b.Create(c)
+			require.NoError(t, err)
+		}
+	}
+	// extra deleted comment
+	c := store.Comment{ID: "id-deleted", Timestamp: ts, User: store.User{ID: "user1"},
+		Locator: store.Locator{URL: "https://radio-t.com/1", SiteID: "radio-t"}}
+	_, err = b.Create(c)
+	require.NoError(t, err)
+	require.NoError(t, b.Delete(engine.DeleteRequest{Locator: c.Locator, CommentID: c.ID, DeleteMode: store.SoftDelete}))
+
+	_, err = b.Flag(engine.FlagRequest{Flag: engine.ReadOnly, Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/2"},
+		Update: engine.FlagTrue})
+	require.NoError(t, err)
+	_, err = b.Flag(engine.FlagRequest{Flag: engine.Blocked, Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2",
+		Update: engine.FlagTrue, TTL: time.Hour})
+	require.NoError(t, err)
+	_, err = b.Flag(engine.FlagRequest{Flag: engine.ShadowBlocked, Locator: store.Locator{SiteID: "radio-t"}, UserID: "user3",
+		Update: engine.FlagTrue})
+	require.NoError(t, err)
+	_, err = b.Flag(engine.FlagRequest{Flag: engine.Verified, Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1",
+		Update: engine.FlagTrue})
+	require.NoError(t, err)
+	_, err = b.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1",
+		Detail: engine.UserEmail, Update: "user1@example.com"})
+	require.NoError(t, err)
+	_, err = b.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1",
+		Detail: engine.UserDigest, Update: "daily"})
+	require.NoError(t, err)
+	_, err = b.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1",
+		Detail: engine.UserBio, Update: "about me"})
+	require.NoError(t, err)
+	_, err = b.Report(engine.ReportRequest{Locator: store.Locator{SiteID: "radio-t"}, Update: &store.Report{
+		Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/3"}, CommentID: "id-3-0", UserID: "user2",
+		Reason: store.ReportSpam, Timestamp: ts}})
+	require.NoError(t, err)
+	_, err = b.Subscription(engine.SubscriptionRequest{Locator: store.Locator{SiteID: "radio-t"}, Update: &store.Subscription{
+		Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/3"}, UserID: "user1", Timestamp: ts}})
+	require.NoError(t, err)
+
+	teardown = func() {
+		require.NoError(t, b.Close())
+		require.NoError(t, s.Close())
+		_ = os.Remove(srcFile)
+		_ = os.Remove(dstFile)
+	}
+	return b, s, teardown
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/audit"
+	"github.com/umputun/remark42/backend/app/store/history"
 	"github.com/umputun/remark42/backend/app/store/service"
 )
 
@@ -20,16 +22,21 @@ const defaultConcurrent = 8
 
 // Native implements exporter and importer for internal store format
 // {"version": 1, comments:[{...}\n,{}], meta: {meta}}
-// each comments starts from the new line
+// each comments starts from the new line. Audit log of the site included in meta if AuditStore defined,
+// revisions of edited comments if HistoryStore defined
 type Native struct {
-	DataStore  Store
-	Concurrent int
+	DataStore    Store
+	AuditStore   audit.Store
+	HistoryStore history.Store
+	Concurrent   int
 }
 
 type meta struct {
 	Version int                    `json:"version"`
 	Users   []service.UserMetaData `json:"users"`
 	Posts   []service.PostMetaData `json:"posts"`
+	Audit   []audit.Entry          `json:"audit,omitempty"`
+	History []history.Revision     `json:"history,omitempty"`
 }
 
 // Export all comments to writer as json strings. Each comment is one string, separated by "\n"
@@ -80,6 +87,16 @@ func (n *Native) exportMeta(siteID string, w io.Writer) (err error) {
 	if err != nil {
 		return errors.Wrap(err, "can't get meta")
 	}
+	if n.AuditStore != nil {
+		if m.Audit, err = n.AuditStore.List(audit.Request{SiteID: siteID}); err != nil {
+			return errors.Wrap(err, "can't get audit log")
+		}
+	}
+	if n.HistoryStore != nil {
+		if m.History, err = n.HistoryStore.List(siteID, ""); err != nil {
+			return errors.Wrap(err, "can't get comments history")
+		}
+	}
 
 	if err = json.NewEncoder(w).Encode(m); err != nil {
 		return errors.Wrap(err, "can't encode meta")
@@ -109,6 +126,11 @@ func WithMapper(reader io.Reader, mapper Mapper) io.Reader {
 		for i := range m.Posts {
 			m.Posts[i].URL = mapper.URL(m.Posts[i].URL)
 		}
+		for i := range m.Audit {
+			if m.Audit[i].URL != "" {
+				m.Audit[i].URL = mapper.URL(m.Audit[i].URL)
+			}
+		}
 		if err = enc.Encode(m); err != nil {
 			return
 		}
@@ -156,6 +178,7 @@ func (n *Native) Import(reader io.Reader, siteID string) (size int, err error) {
 		comment := store.Comment{}
 		err = dec.Decode(&comment)
 		comment.Imported = true
+		comment.Locator.SiteID = siteID // backup can be imported to another site
 		if err == io.EOF {
 			break
 		}
@@ -190,7 +213,26 @@ func (n *Native) Import(reader io.Reader, siteID string) (size int, err error) {
 	}
 	log.Printf("[INFO] imported %d comments from %d records", comments, total)
 
-	err = n.DataStore.SetMetas(siteID, m.Users, m.Posts)
+	if err = n.DataStore.SetMetas(siteID, m.Users, m.Posts); err != nil {
+		return int(comments), err
+	}
+
+	if n.AuditStore != nil && len(m.Audit) > 0 {
+		for i := range m.Audit {
+			m.Audit[i].SiteID = siteID
+		}
+		if err = n.AuditStore.Add(m.Audit...); err != nil {
+			return int(comments), errors.Wrap(err, "failed to import audit log")
+		}
+	}
 
-	return int(comments), err
+	if n.HistoryStore != nil && len(m.History) > 0 {
+		for i := range m.History {
+			m.History[i].SiteID = siteID
+		}
+		if err = n.HistoryStore.Add(m.History...); err != nil {
+			return int(comments), errors.Wrap(err, "failed to import comments history")
+		}
+	}
+	return int(comments), nil
 }
@@ -16,7 +16,9 @@ import (
 
 	"github.com/umputun/remark42/backend/app/store"
 	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/audit"
 	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/history"
 	"github.com/umputun/remark42/backend/app/store/service"
 )
 
@@ -101,6 +103,125 @@ func TestNative_Import(t *testing.T) {
 	assert.Equal(t, false, b.IsVerified("radio-t", "user2"))
 }
 
+func TestNative_ExportImportAudit(t *testing.T) {
+	b, teardown := prep(t) // write 2 comments
+	defer teardown()
+
+	auditDB := fmt.Sprintf("/tmp/%d-audit.db", rand.Int())
+	auditStore, err := audit.NewBoltStorage(auditDB, bolt.Options{})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, auditStore.Close())
+		_ = os.Remove(auditDB)
+	}()
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, auditStore.Add(
+		audit.Entry{SiteID: "radio-t", Timestamp: ts, Action: audit.ActionPin, Actor: audit.Actor{ID: "admin1"},
+			CommentID: "efbc17f177ee1a1c0ee6e1e025749966ec071adc", URL: "https://radio-t.com"},
+		audit.Entry{SiteID: "other", Timestamp: ts, Action: audit.ActionBlock, Actor: audit.Actor{ID: "admin1"}, UserID: "user2"},
+	))
+
+	buf := &bytes.Buffer{}
+	_, err = (&Native{DataStore: b, AuditStore: auditStore}).Export(buf, "radio-t")
+	require.NoError(t, err)
+	m := struct {
+		Audit []audit.Entry `json:"audit"`
+	}{}
+	require.NoError(t, json.NewDecoder(strings.NewReader(buf.String())).Decode(&m))
+	require.Equal(t, 1, len(m.Audit), "only entries of exported site")
+	assert.Equal(t, audit.ActionPin, m.Audit[0].Action)
+
+	mapper, err := NewURLMapper(strings.NewReader(`https://radio-t.com* https://rdt.c*`))
+	require.NoError(t, err)
+	b.AdminStore = admin.NewStaticStore("12345", nil, []string{}, "")
+	_, err = (&Native{DataStore: b, AuditStore: auditStore}).Import(WithMapper(buf, mapper), "radio-t")
+	require.NoError(t, err)
+
+	entries, err := auditStore.List(audit.Request{SiteID: "radio-t"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries), "same entry replaced")
+	assert.Equal(t, m.Audit[0].ID, entries[0].ID)
+	assert.Equal(t, "https://rdt.c", entries[0].URL)
+	assert.Equal(t, "admin1", entries[0].Actor.ID)
+	assert.Equal(t, ts, entries[0].Timestamp.UTC())
+}
+
+func TestNative_ExportImportHistory(t *testing.T) {
+	b, teardown := prep(t) // write 2 comments
+	defer teardown()
+
+	historyDB := fmt.Sprintf("/tmp/%d-history.db", rand.Int())
+	defer os.Remove(historyDB)
+	historyStore, err := history.NewBoltStorage(historyDB, bolt.Options{})
+	require.NoError(t, err)
+	b.HistoryStore = historyStore // closed with data store
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err = b.EditComment(locator, "efbc17f177ee1a1c0ee6e1e025749966ec071adc", service.EditRequest{Orig: "edited", Text: "edited"})
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	_, err = (&Native{DataStore: b, HistoryStore: historyStore}).Export(buf, "radio-t")
+	require.NoError(t, err)
+	m := struct {
+		History []history.Revision `json:"history"`
+	}{}
+	require.NoError(t, json.NewDecoder(strings.NewReader(buf.String())).Decode(&m))
+	require.Equal(t, 2, len(m.History), "original and edited revisions")
+	assert.Contains(t, m.History[0].Text, "some text, <a href=\"http://radio-t.com\"")
+	assert.Equal(t, "edited", m.History[1].Orig)
+
+	_, err = (&Native{DataStore: b, HistoryStore: historyStore}).Import(buf, "radio-t")
+	require.NoError(t, err)
+	revisions, err := historyStore.List("radio-t", "efbc17f177ee1a1c0ee6e1e025749966ec071adc")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(revisions), "history restored")
+	assert.Equal(t, m.History, revisions)
+}
+
+func TestNative_ExportImportReactions(t *testing.T) {
+	b, teardown := prep(t) // write 2 comments
+	defer teardown()
+
+	b.Reactions = []string{"👍", "😂"}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	id := "efbc17f177ee1a1c0ee6e1e025749966ec071adc"
+	for _, user := range []string{"user1", "user2"} {
+		_, err := b.React(service.ReactReq{Locator: locator, CommentID: id, UserID: user, Reaction: "😂"})
+		require.NoError(t, err)
+	}
+
+	buf := &bytes.Buffer{}
+	_, err := (&Native{DataStore: b}).Export(buf, "radio-t")
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `"reacted_by":{"😂":["user1","user2"]}`)
+
+	_, err = (&Native{DataStore: b}).Import(buf, "radio-t")
+	require.NoError(t, err)
+	comment, err := b.Get(locator, id, store.User{ID: "user2"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"😂": 2}, comment.Reactions, "reactions restored")
+	assert.Equal(t, []string{"😂"}, comment.Reacted)
+}
+
+func TestNative_ExportImportProfile(t *testing.T) {
+	b, teardown := prep(t) // write 2 comments
+	defer teardown()
+
+	_, err := b.SetUserProfile("radio-t", "user1", service.ProfileDetails{Bio: "about me", Website: "https://example.com"})
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	_, err = (&Native{DataStore: b}).Export(buf, "radio-t")
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `"details":{"user_id":"user1","bio":"about me","website":"https://example.com"}`)
+
+	_, err = (&Native{DataStore: b}).Import(buf, "radio-t")
+	require.NoError(t, err)
+	profile, err := b.GetUserProfile("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, service.ProfileDetails{Bio: "about me", Website: "https://example.com"}, profile, "profile restored")
+}
+
 func TestNative_ImportWithMapper(t *testing.T) {
 	b, teardown := prep(t) // write 2 comments
 	defer teardown()
@@ -140,6 +261,32 @@ func TestNative_ImportWithMapper(t *testing.T) {
 	assert.Equal(t, false, b.IsVerified("radio-t", "user2"))
 }
 
+func TestNative_ImportToAnotherSite(t *testing.T) {
+	b, teardown := prep(t) // write 2 comments
+	defer teardown()
+	sitesPath := fmt.Sprintf("/tmp/migrator-%d", rand.Intn(999999999))
+	require.NoError(t, os.MkdirAll(sitesPath, 0700))
+	defer os.RemoveAll(sitesPath)
+	eng := b.Engine.(*engine.BoltDB)
+	eng.SitesPath = sitesPath
+	require.NoError(t, eng.AddSite("site2"))
+
+	buf := &bytes.Buffer{}
+	r := Native{DataStore: b}
+	_, err := r.Export(buf, "radio-t")
+	require.NoError(t, err)
+	size, err := r.Import(buf, "site2")
+	require.NoError(t, err)
+	assert.Equal(t, 2, size)
+
+	comments, err := b.Last("site2", 10, time.Time{}, store.User{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(comments))
+	for _, c := range comments {
+		assert.Equal(t, "site2", c.Locator.SiteID)
+	}
+}
+
 func TestNative_ImportWrongVersion(t *testing.T) {
 	b, teardown := prep(t) // write 2 comments
 	defer teardown()
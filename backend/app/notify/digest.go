@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// DigestItem is a single notification waiting for delivery as a part of digest
+type DigestItem struct {
+	ID           string           `json:"id"`
+	SiteID       string           `json:"site"`
+	Email        string           `json:"email"`   // recipient
+	UserID       string           `json:"user_id"` // recipient's user id, used for unsubscribe link
+	Mode         store.DigestMode `json:"mode"`
+	UserName     string           `json:"user_name"` // author of the comment
+	UserPicture  string           `json:"user_picture,omitempty"`
+	CommentText  string           `json:"text"`
+	CommentLink  string           `json:"link"`
+	CommentDate  time.Time        `json:"comment_time"`
+	PostTitle    string           `json:"post_title,omitempty"`
+	Subscription string           `json:"subscription,omitempty"` // "post" or "thread" for subscriber, "mention" for mentioned user, empty for reply
+	Timestamp    time.Time        `json:"time"`                   // time item queued
+}
+
+// DigestStore keeps pending digest items in bolt db, so they survive restarts.
+// Each site has its own bucket, key is email!!ts!!id, value is json-serialized DigestItem
+type DigestStore struct {
+	db *bolt.DB
+}
+
+// tsKeyFormat keeps items of the same recipient sorted by time
+const tsKeyFormat = "2006-01-02T15:04:05.000000000Z"
+
+// NewDigestStore makes digest store in fileName
+func NewDigestStore(fileName string, options bolt.Options) (*DigestStore, error) {
+	db, err := bolt.Open(fileName, 0600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to make boltdb for %s", fileName)
+	}
+	return &DigestStore{db: db}, nil
+}
+
+// Add items, missing ID and Timestamp filled automatically
+func (d *DigestStore) Add(items ...DigestItem) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		for _, item := range items {
+			if item.SiteID == "" || item.Email == "" {
+				return errors.New("site id and email required for digest item")
+			}
+			if item.ID == "" {
+				item.ID = uuid.New().String()
+			}
+			if item.Timestamp.IsZero() {
+				item.Timestamp = time.Now()
+			}
+			bkt, err := tx.CreateBucketIfNotExists([]byte(item.SiteID))
+			if err != nil {
+				return errors.Wrapf(err, "can't make bucket for %s", item.SiteID)
+			}
+			data, err := json.Marshal(item)
+			if err != nil {
+				return errors.Wrapf(err, "can't marshal digest item %s", item.ID)
+			}
+			if err = bkt.Put(digestKey(item), data); err != nil {
+				return errors.Wrapf(err, "can't put digest item %s", item.ID)
+			}
+		}
+		return nil
+	})
+}
+
+// List all pending items grouped by site and recipient, each group sorted from oldest to newest
+func (d *DigestStore) List() (res [][]DigestItem, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(site []byte, bkt *bolt.Bucket) error {
+			var group []DigestItem
+			err := bkt.ForEach(func(k, v []byte) error {
+				item := DigestItem{}
+				if e := json.Unmarshal(v, &item); e != nil {
+					return errors.Wrapf(e, "can't unmarshal digest item %s", string(k))
+				}
+				if len(group) > 0 && group[0].Email != item.Email {
+					res = append(res, group)
+					group = nil
+				}
+				group = append(group, item)
+				return nil
+			})
+			if len(group) > 0 {
+				res = append(res, group)
+			}
+			return err
+		})
+	})
+	return res, err
+}
+
+// Delete items, usually after delivery
+func (d *DigestStore) Delete(items ...DigestItem) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		for _, item := range items {
+			bkt := tx.Bucket([]byte(item.SiteID))
+			if bkt == nil {
+				continue
+			}
+			if err := bkt.Delete(digestKey(item)); err != nil {
+				return errors.Wrapf(err, "can't delete digest item %s", item.ID)
+			}
+		}
+		return nil
+	})
+}
+
+// Close bolt db
+func (d *DigestStore) Close() error {
+	return errors.Wrap(d.db.Close(), "can't close digest db")
+}
+
+func digestKey(item DigestItem) []byte {
+	return []byte(item.Email + "!!" + item.Timestamp.UTC().Format(tsKeyFormat) + "!!" + item.ID)
+}
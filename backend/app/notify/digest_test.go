@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+const testDigestDB = "/tmp/test-remark-digest.db"
+
+func TestDigestStore_AddListDelete(t *testing.T) {
+	d, teardown := prepDigestStore(t)
+	defer teardown()
+
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	err := d.Add(
+		DigestItem{SiteID: "radio-t", Email: "u1@example.com", Mode: store.DigestDaily, CommentLink: "l2", Timestamp: ts.Add(time.Minute)},
+		DigestItem{SiteID: "radio-t", Email: "u1@example.com", Mode: store.DigestDaily, CommentLink: "l1", Timestamp: ts},
+		DigestItem{SiteID: "radio-t", Email: "u2@example.com", Mode: store.DigestHourly, CommentLink: "l3"},
+		DigestItem{SiteID: "remark", Email: "u1@example.com", Mode: store.DigestHourly, CommentLink: "l4"},
+	)
+	require.NoError(t, err)
+
+	res, err := d.List()
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res), "grouped by site and email")
+	require.Equal(t, 2, len(res[0]))
+	assert.Equal(t, "l1", res[0][0].CommentLink, "oldest first")
+	assert.Equal(t, "l2", res[0][1].CommentLink)
+	assert.NotEmpty(t, res[0][0].ID)
+	require.Equal(t, 1, len(res[1]))
+	assert.Equal(t, "u2@example.com", res[1][0].Email)
+	assert.False(t, res[1][0].Timestamp.IsZero())
+	require.Equal(t, 1, len(res[2]))
+	assert.Equal(t, "remark", res[2][0].SiteID)
+
+	require.NoError(t, d.Delete(res[0]...))
+	require.NoError(t, d.Delete(DigestItem{SiteID: "bad", Email: "u1@example.com"}), "no bucket for site")
+	res, err = d.List()
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(res))
+
+	assert.EqualError(t, d.Add(DigestItem{SiteID: "radio-t"}), "site id and email required for digest item")
+}
+
+func TestDigestStore_Reopen(t *testing.T) {
+	d, teardown := prepDigestStore(t)
+	defer teardown()
+
+	require.NoError(t, d.Add(DigestItem{SiteID: "radio-t", Email: "u1@example.com", Mode: store.DigestDaily}))
+	require.NoError(t, d.Close())
+
+	d2, err := NewDigestStore(testDigestDB, bolt.Options{})
+	require.NoError(t, err)
+	defer d2.Close()
+	res, err := d2.List()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res), "pending items survive restart")
+
+	_, err = NewDigestStore("/dev/null/bad.db", bolt.Options{})
+	assert.Error(t, err)
+}
+
+func prepDigestStore(t *testing.T) (d *DigestStore, teardown func()) {
+	_ = os.Remove(testDigestDB)
+	d, err := NewDigestStore(testDigestDB, bolt.Options{})
+	require.NoError(t, err)
+	return d, func() {
+		_ = d.Close()
+		_ = os.Remove(testDigestDB)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 
+	"github.com/umputun/remark42/backend/app/store"
 	"github.com/umputun/remark42/backend/app/templates"
 )
 
@@ -30,7 +31,12 @@ type EmailParams struct {
 	SubscribeURL             string   // full subscribe handler URL
 	UnsubscribeURL           string   // full unsubscribe handler URL
 
-	TokenGenFn func(userID, email, site string) (string, error) // Unsubscribe token generation function
+	Digest              *DigestStore  // pending notifications of users with digest mode, all sent immediately if nil
+	DigestTemplatePath  string        // path to digest message template
+	DigestCheckInterval time.Duration // how often pending digests checked for delivery
+
+	// Unsubscribe token generation function, subscriptionID set for unsubscribe from single post or thread
+	TokenGenFn func(userID, email, site, subscriptionID string) (string, error)
 }
 
 // SMTPParams contain settings for smtp server connection
@@ -51,6 +57,10 @@ type Email struct {
 	smtp       smtpClientCreator
 	msgTmpl    *template.Template // parsed request message template
 	verifyTmpl *template.Template // parsed verification message template
+	digestTmpl *template.Template // parsed digest message template
+
+	digestCancel context.CancelFunc // stops background digests delivery
+	digestDone   chan struct{}      // closed on digests delivery termination
 }
 
 // default email client implementation
@@ -93,6 +103,17 @@ type msgTmplData struct {
 	Email             string
 	UnsubscribeLink   string
 	ForAdmin          bool
+	ReportReason      string
+	ReportText        string
+	Subscription      string // "post" or "thread" for notification of subscriber, "mention" for mentioned user
+}
+
+// digestTmplData store data for digest message template execution
+type digestTmplData struct {
+	Items           []DigestItem
+	Mode            string // "hourly" or "daily"
+	Email           string
+	UnsubscribeLink string
 }
 
 // verifyTmplData store data for verification message template execution
@@ -109,9 +130,12 @@ const (
 	defaultEmailTimeout                  = 10 * time.Second
 	defaultEmailTemplatePath             = "email_reply.html.tmpl"
 	defaultEmailVerificationTemplatePath = "email_confirmation_subscription.html.tmpl"
+	defaultEmailDigestTemplatePath       = "email_digest.html.tmpl"
+	defaultDigestCheckInterval           = time.Minute
 )
 
-// NewEmail makes new Email object, returns error in case of e.MsgTemplate or e.VerificationTemplate parsing error
+// NewEmail makes new Email object, returns error in case of e.MsgTemplate or e.VerificationTemplate parsing error.
+// Starts background delivery of digests if emailParams.Digest set, stopped by Close
 func NewEmail(emailParams EmailParams, smtpParams SMTPParams) (*Email, error) {
 	// set up Email emailParams
 	res := Email{EmailParams: emailParams}
@@ -131,6 +155,15 @@ func NewEmail(emailParams EmailParams, smtpParams SMTPParams) (*Email, error) {
 		return nil, errors.Wrap(err, "can't set templates")
 	}
 
+	if res.Digest != nil {
+		if res.DigestCheckInterval <= 0 {
+			res.DigestCheckInterval = defaultDigestCheckInterval
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		res.digestCancel, res.digestDone = cancel, make(chan struct{})
+		go res.runDigests(ctx)
+	}
+
 	log.Printf("[DEBUG] Create new email notifier for server %s with user %s, timeout=%s",
 		res.Host, res.Username, res.TimeOut)
 
@@ -163,11 +196,25 @@ func (e *Email) setTemplates() error {
 		return errors.Wrapf(err, "can't parse verification template")
 	}
 
+	if e.Digest == nil { // digest template not used without digest store
+		return nil
+	}
+	if e.DigestTemplatePath == "" {
+		e.DigestTemplatePath = defaultEmailDigestTemplatePath
+	}
+	digestTmplFile, err := fs.ReadFile(e.DigestTemplatePath)
+	if err != nil {
+		return errors.Wrapf(err, "can't read digest template")
+	}
+	if e.digestTmpl, err = template.New("digestTmpl").Parse(string(digestTmplFile)); err != nil {
+		return errors.Wrapf(err, "can't parse digest template")
+	}
+
 	return nil
 }
 
 // Send email about comment reply to Request.Emails and Email.AdminEmails
-// if they're set.
+// if they're set. Notifications of users with digest mode queued for digest delivery.
 // Thread safe
 func (e *Email) Send(ctx context.Context, req Request) error {
 	select {
@@ -176,9 +223,27 @@ func (e *Email) Send(ctx context.Context, req Request) error {
 	default:
 	}
 
+	event := req.event()
+	if event != EventCreate && event != EventReport { // changes of existing comments not sent over email
+		return nil
+	}
+
 	result := new(multierror.Error)
 
+	if req.Report != nil { // reported comment, admins only
+		for _, email := range e.AdminEmails {
+			err := e.buildAndSendMessage(ctx, req, email, true)
+			result = multierror.Append(errors.Wrapf(err, "problem sending admin report notification to %q", email))
+		}
+		return result.ErrorOrNil()
+	}
+
 	for _, email := range req.Emails {
+		if mode := req.digests[email]; e.Digest != nil && mode.Period() > 0 {
+			err := e.Digest.Add(e.makeDigestItem(req, email, mode))
+			result = multierror.Append(errors.Wrapf(err, "problem queueing digest notification to %q", email))
+			continue
+		}
 		err := e.buildAndSendMessage(ctx, req, email, false)
 		result = multierror.Append(errors.Wrapf(err, "problem sending user email notification to %q", email))
 	}
@@ -205,6 +270,96 @@ func (e *Email) buildAndSendMessage(ctx context.Context, req Request, email stri
 		})
 }
 
+// makeDigestItem makes pending digest item for the recipient of Request notification
+func (e *Email) makeDigestItem(req Request, email string, mode store.DigestMode) DigestItem {
+	item := DigestItem{
+		SiteID:      req.Comment.Locator.SiteID,
+		Email:       email,
+		UserID:      req.parent.User.ID,
+		Mode:        mode,
+		UserName:    req.Comment.User.Name,
+		UserPicture: req.Comment.User.Picture,
+		CommentText: req.Comment.Text,
+		CommentLink: req.Comment.Locator.URL + uiNav + req.Comment.ID,
+		CommentDate: req.Comment.Timestamp,
+		PostTitle:   req.Comment.PostTitle,
+	}
+	if sub, ok := req.subscriptions[email]; ok {
+		item.UserID, item.Subscription = sub.UserID, "post"
+		if sub.CommentID != "" {
+			item.Subscription = "thread"
+		}
+	}
+	if userID, ok := req.mentions[email]; ok {
+		item.UserID, item.Subscription = userID, "mention"
+	}
+	return item
+}
+
+// runDigests checks pending digests periodically till ctx canceled
+func (e *Email) runDigests(ctx context.Context) {
+	defer close(e.digestDone)
+	ticker := time.NewTicker(e.DigestCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.sendDigests(ctx, time.Now()); err != nil {
+				log.Printf("[WARN] failed to send digests, %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sendDigests sends single message to each recipient with the oldest pending item waiting longer than digest period
+// of the recipient, and removes delivered items. Undelivered items kept for the next attempt.
+func (e *Email) sendDigests(ctx context.Context, now time.Time) error {
+	groups, err := e.Digest.List()
+	if err != nil {
+		return errors.Wrap(err, "can't list pending digests")
+	}
+
+	result := new(multierror.Error)
+	for _, items := range groups {
+		mode := items[len(items)-1].Mode // the latest item has the current mode of the recipient
+		if now.Sub(items[0].Timestamp) < mode.Period() {
+			continue
+		}
+		msg, err := e.buildDigestMessage(items)
+		if err != nil {
+			result = multierror.Append(result, err)
+			continue
+		}
+		email := items[0].Email
+		log.Printf("[DEBUG] send %s digest via %s, %d items", mode, e, len(items))
+		err = repeater.NewDefault(5, time.Millisecond*250).Do(ctx, func() error {
+			return e.sendMessage(emailMessage{from: e.From, to: email, message: msg})
+		})
+		if err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "problem sending digest to %q", email))
+			continue
+		}
+		if err = e.Digest.Delete(items...); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+// Close stops digests delivery and closes digest store. Pending items delivered after restart
+func (e *Email) Close() error {
+	if e.Digest == nil {
+		return nil
+	}
+	if e.digestCancel != nil {
+		e.digestCancel()
+		<-e.digestDone
+	}
+	return e.Digest.Close()
+}
+
 // SendVerification email verification VerificationRequest.Email if it's set.
 // Thread safe
 func (e *Email) SendVerification(ctx context.Context, req VerificationRequest) error {
@@ -248,17 +403,61 @@ func (e *Email) buildVerificationMessage(user, email, token, site string) (strin
 	return e.buildMessage(subject, msg.String(), email, "text/html", "")
 }
 
+// buildDigestMessage generates digest email message for pending items of the same recipient
+func (e *Email) buildDigestMessage(items []DigestItem) (string, error) {
+	last := items[len(items)-1]
+	subject := fmt.Sprintf("Your %s digest: %d new comments", last.Mode, len(items))
+	if len(items) == 1 {
+		subject = fmt.Sprintf("Your %s digest: 1 new comment", last.Mode)
+	}
+
+	token, err := e.TokenGenFn(last.UserID, last.Email, last.SiteID, "")
+	if err != nil {
+		return "", errors.Wrapf(err, "error creating token for unsubscribe link")
+	}
+	unsubscribeLink := e.UnsubscribeURL + "?site=" + last.SiteID + "&tkn=" + token
+
+	msg := bytes.Buffer{}
+	err = e.digestTmpl.Execute(&msg, digestTmplData{
+		Items:           items,
+		Mode:            string(last.Mode),
+		Email:           last.Email,
+		UnsubscribeLink: unsubscribeLink,
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "error executing template to build digest message")
+	}
+	return e.buildMessage(subject, msg.String(), last.Email, "text/html", unsubscribeLink)
+}
+
 // buildMessageFromRequest generates email message based on Request using e.MsgTemplate
 func (e *Email) buildMessageFromRequest(req Request, email string, forAdmin bool) (string, error) {
 	subject := "New reply to your comment"
 	if forAdmin {
 		subject = "New comment to your site"
 	}
+	if req.Report != nil {
+		subject = "Comment reported as " + string(req.Report.Reason)
+	}
+
+	tokenUserID, subscriptionID, subscription := req.parent.User.ID, "", ""
+	if sub, ok := req.subscriptions[email]; ok && !forAdmin {
+		tokenUserID, subscriptionID, subscription = sub.UserID, sub.ID(), "post"
+		subject = "New comment to the post you follow"
+		if sub.CommentID != "" {
+			subscription = "thread"
+			subject = "New reply in the thread you follow"
+		}
+	}
+	if userID, ok := req.mentions[email]; ok && !forAdmin {
+		tokenUserID, subscription = userID, "mention"
+		subject = "You were mentioned in a comment"
+	}
 	if req.Comment.PostTitle != "" {
 		subject += fmt.Sprintf(" for %q", req.Comment.PostTitle)
 	}
 
-	token, err := e.TokenGenFn(req.parent.User.ID, email, req.Comment.Locator.SiteID)
+	token, err := e.TokenGenFn(tokenUserID, email, req.Comment.Locator.SiteID, subscriptionID)
 	if err != nil {
 		return "", errors.Wrapf(err, "error creating token for unsubscribe link")
 	}
@@ -279,6 +478,11 @@ func (e *Email) buildMessageFromRequest(req Request, email string, forAdmin bool
 		Email:           email,
 		UnsubscribeLink: unsubscribeLink,
 		ForAdmin:        forAdmin,
+		Subscription:    subscription,
+	}
+	if req.Report != nil {
+		tmplData.ReportReason = string(req.Report.Reason)
+		tmplData.ReportText = req.Report.Text
 	}
 	// in case of message to admin, parent message might be empty
 	if req.Comment.ParentID != "" {
@@ -5,13 +5,17 @@ import (
 	"context"
 	"errors"
 	"io"
+	"io/ioutil"
+	"mime/quotedprintable"
 	"net/smtp"
+	"strings"
 	"sync"
 	"testing"
 	"text/template"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/umputun/remark42/backend/app/store"
 )
@@ -247,6 +251,213 @@ Content-Transfer-Encoding: quoted-printable
 MIME-version: 1.0
 Content-Type: text/html; charset="UTF-8"
 Date: `)
+
+	req.Event = EventVote
+	assert.NoError(t, email.Send(context.TODO(), req))
+	assert.Equal(t, 3, fakeSMTP.readQuitCount(), "votes not sent by email")
+}
+
+func TestEmail_SendReport(t *testing.T) {
+	email, err := NewEmail(EmailParams{
+		From:                     "from@example.org",
+		AdminEmails:              []string{"admin@example.org"},
+		VerificationTemplatePath: "testdata/verification.html.tmpl",
+		MsgTemplatePath:          "../../templates/email_reply.html.tmpl",
+		TokenGenFn:               TokenGenFn,
+	}, SMTPParams{})
+	require.NoError(t, err)
+	fakeSMTP := fakeTestSMTP{}
+	email.smtp = &fakeSMTP
+
+	req := Request{
+		Comment: store.Comment{ID: "999", User: store.User{ID: "1", Name: "test_user"}, ParentID: "1", PostTitle: "test_title"},
+		Report:  &store.Report{CommentID: "999", UserID: "2", Reason: store.ReportAbuse, Text: "rude"},
+		Emails:  []string{"test@example.org"},
+	}
+	assert.NoError(t, email.Send(context.TODO(), req))
+	assert.Equal(t, 1, fakeSMTP.readQuitCount(), "sent to admin only")
+	assert.Equal(t, "admin@example.org", fakeSMTP.readRcpt())
+
+	res, err := email.buildMessageFromRequest(req, email.AdminEmails[0], true)
+	require.NoError(t, err)
+	assert.Contains(t, res, `Subject: Comment reported as abuse for "test_title"`)
+	body, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(res)))
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `Comment from test_user reported as abuse in «test_title»: rude`)
+}
+
+func TestEmail_SendSubscription(t *testing.T) {
+	var tokenArgs []string
+	email, err := NewEmail(EmailParams{
+		From:                     "from@example.org",
+		VerificationTemplatePath: "testdata/verification.html.tmpl",
+		MsgTemplatePath:          "../../templates/email_reply.html.tmpl",
+		UnsubscribeURL:           "https://remark42.com/api/v1/email/unsubscribe",
+		TokenGenFn: func(userID, email, site, subscriptionID string) (string, error) {
+			tokenArgs = []string{userID, email, site, subscriptionID}
+			return "token", nil
+		},
+	}, SMTPParams{})
+	require.NoError(t, err)
+
+	loc := store.Locator{SiteID: "remark", URL: "https://example.com/post"}
+	postSub := store.Subscription{Locator: loc, UserID: "u2"}
+	threadSub := store.Subscription{Locator: loc, UserID: "u3", CommentID: "1"}
+	req := Request{
+		Comment:       store.Comment{ID: "999", Locator: loc, User: store.User{ID: "1", Name: "test_user"}, PostTitle: "test_title"},
+		Emails:        []string{"u2@example.org", "u3@example.org"},
+		subscriptions: map[string]store.Subscription{"u2@example.org": postSub, "u3@example.org": threadSub},
+	}
+
+	res, err := email.buildMessageFromRequest(req, "u2@example.org", false)
+	require.NoError(t, err)
+	assert.Contains(t, res, `Subject: New comment to the post you follow for "test_title"`)
+	assert.Equal(t, []string{"u2", "u2@example.org", "remark", postSub.ID()}, tokenArgs)
+	assert.Contains(t, res, "List-Unsubscribe: <https://remark42.com/api/v1/email/unsubscribe?site=remark&tkn=token>")
+	body, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(res)))
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `New comment from test_user on the post you follow «test_title»`)
+	assert.NotContains(t, string(body), "u2@example.org</a> for")
+
+	res, err = email.buildMessageFromRequest(req, "u3@example.org", false)
+	require.NoError(t, err)
+	assert.Contains(t, res, `Subject: New reply in the thread you follow for "test_title"`)
+	assert.Equal(t, []string{"u3", "u3@example.org", "remark", threadSub.ID()}, tokenArgs)
+	body, err = ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(res)))
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `New reply from test_user in the thread you follow to «test_title»`)
+
+	res, err = email.buildMessageFromRequest(req, "admin@example.org", true)
+	require.NoError(t, err)
+	assert.Contains(t, res, `Subject: New comment to your site for "test_title"`)
+	assert.Equal(t, "", tokenArgs[3], "no subscription for admin")
+}
+
+func TestEmail_SendMention(t *testing.T) {
+	var tokenArgs []string
+	email, err := NewEmail(EmailParams{
+		From:                     "from@example.org",
+		VerificationTemplatePath: "testdata/verification.html.tmpl",
+		MsgTemplatePath:          "../../templates/email_reply.html.tmpl",
+		UnsubscribeURL:           "https://remark42.com/api/v1/email/unsubscribe",
+		TokenGenFn: func(userID, email, site, subscriptionID string) (string, error) {
+			tokenArgs = []string{userID, email, site, subscriptionID}
+			return "token", nil
+		},
+	}, SMTPParams{})
+	require.NoError(t, err)
+
+	loc := store.Locator{SiteID: "remark", URL: "https://example.com/post"}
+	req := Request{
+		Comment:  store.Comment{ID: "999", Locator: loc, User: store.User{ID: "1", Name: "test_user"}, PostTitle: "test_title"},
+		Emails:   []string{"u2@example.org"},
+		mentions: map[string]string{"u2@example.org": "u2"},
+	}
+	res, err := email.buildMessageFromRequest(req, "u2@example.org", false)
+	require.NoError(t, err)
+	assert.Contains(t, res, `Subject: You were mentioned in a comment for "test_title"`)
+	assert.Equal(t, []string{"u2", "u2@example.org", "remark", ""}, tokenArgs)
+	body, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(res)))
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `test_user mentioned you in a comment to «test_title»`)
+
+	item := email.makeDigestItem(req, "u2@example.org", store.DigestDaily)
+	assert.Equal(t, "u2", item.UserID)
+	assert.Equal(t, "mention", item.Subscription)
+}
+
+func TestEmail_SendDigest(t *testing.T) {
+	digest, teardown := prepDigestStore(t)
+	defer teardown()
+	var tokenArgs []string
+	email, err := NewEmail(EmailParams{
+		From:                     "from@example.org",
+		VerificationTemplatePath: "testdata/verification.html.tmpl",
+		MsgTemplatePath:          "../../templates/email_reply.html.tmpl",
+		UnsubscribeURL:           "https://remark42.com/api/v1/email/unsubscribe",
+		TokenGenFn: func(userID, email, site, subscriptionID string) (string, error) {
+			tokenArgs = []string{userID, email, site, subscriptionID}
+			return "token", nil
+		},
+		Digest:              digest,
+		DigestTemplatePath:  "../../templates/email_digest.html.tmpl",
+		DigestCheckInterval: time.Hour,
+	}, SMTPParams{})
+	require.NoError(t, err)
+	fakeSMTP := fakeTestSMTP{}
+	email.smtp = &fakeSMTP
+
+	loc := store.Locator{SiteID: "remark", URL: "https://example.com/post"}
+	req := Request{
+		Comment:       store.Comment{ID: "c1", Locator: loc, User: store.User{ID: "u1", Name: "test_user"}, ParentID: "p1", PostTitle: "test_title", Text: "reply text"},
+		parent:        store.Comment{ID: "p1", Locator: loc, User: store.User{ID: "u2", Name: "parent_user"}},
+		Emails:        []string{"u2@example.org", "u3@example.org", "u4@example.org"},
+		subscriptions: map[string]store.Subscription{"u3@example.org": {Locator: loc, UserID: "u3", CommentID: "p1"}},
+		digests:       map[string]store.DigestMode{"u2@example.org": store.DigestHourly, "u3@example.org": store.DigestHourly},
+	}
+	require.NoError(t, email.Send(context.TODO(), req))
+	assert.Equal(t, 1, fakeSMTP.readQuitCount(), "sent immediately to u4 only")
+	assert.Equal(t, "u4@example.org", fakeSMTP.readRcpt())
+
+	req.Comment.ID, req.Comment.Text = "c2", "another reply"
+	require.NoError(t, email.Send(context.TODO(), req))
+	assert.Equal(t, 2, fakeSMTP.readQuitCount())
+
+	require.NoError(t, email.sendDigests(context.TODO(), time.Now()))
+	assert.Equal(t, 2, fakeSMTP.readQuitCount(), "digests are not due yet")
+
+	fakeSMTP.buff.Reset()
+	require.NoError(t, email.sendDigests(context.TODO(), time.Now().Add(time.Hour)))
+	assert.Equal(t, 4, fakeSMTP.readQuitCount(), "single digest message to each of u2 and u3")
+	assert.Equal(t, []string{"u3", "u3@example.org", "remark", ""}, tokenArgs, "unsubscribe from all notifications")
+	res, err := digest.List()
+	require.NoError(t, err)
+	assert.Empty(t, res, "delivered items removed")
+
+	body, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(fakeSMTP.buff.String())))
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "Subject: Your hourly digest: 2 new comments")
+	assert.Contains(t, string(body), "New reply on your comment to «test_title»")
+	assert.Contains(t, string(body), "New reply in the thread you follow to «test_title»")
+	assert.Contains(t, string(body), `<a href="https://example.com/post#remark42__comment-c1"`)
+	assert.Contains(t, string(body), "another reply")
+	assert.Contains(t, string(body), "List-Unsubscribe: <https://remark42.com/api/v1/email/unsubscribe?site=remark&tkn=token>")
+
+	assert.NoError(t, email.Close())
+}
+
+func TestEmail_SendDigestFailed(t *testing.T) {
+	digest, teardown := prepDigestStore(t)
+	defer teardown()
+	email, err := NewEmail(EmailParams{
+		VerificationTemplatePath: "testdata/verification.html.tmpl",
+		MsgTemplatePath:          "testdata/msg.html.tmpl",
+		TokenGenFn:               TokenGenFn,
+		Digest:                   digest,
+		DigestTemplatePath:       "../../templates/email_digest.html.tmpl",
+		DigestCheckInterval:      time.Hour,
+	}, SMTPParams{})
+	require.NoError(t, err)
+	email.smtp = &fakeTestSMTP{fail: map[string]bool{"create": true}}
+
+	require.NoError(t, digest.Add(DigestItem{SiteID: "remark", Email: "u1@example.org", Mode: store.DigestDaily,
+		Timestamp: time.Now().Add(-25 * time.Hour)}))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Error(t, email.sendDigests(ctx, time.Now()))
+	res, err := digest.List()
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(res), "undelivered item kept")
+
+	_, err = NewEmail(EmailParams{
+		VerificationTemplatePath: "testdata/verification.html.tmpl",
+		MsgTemplatePath:          "testdata/msg.html.tmpl",
+		Digest:                   digest,
+		DigestTemplatePath:       "testdata/bad.html.tmpl",
+	}, SMTPParams{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't set templates: can't parse digest template")
+	assert.NoError(t, email.Close())
 }
 
 func TestEmail_SendVerification(t *testing.T) {
@@ -398,7 +609,7 @@ func (f *fakeTestSMTP) readQuitCount() int {
 	return f.quitCount
 }
 
-func TokenGenFn(user, _, _ string) (string, error) {
+func TokenGenFn(user, _, _, _ string) (string, error) {
 	if user == "error" {
 		return "", errors.New("token generation error")
 	}
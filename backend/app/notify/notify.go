@@ -4,10 +4,13 @@ package notify
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
 
 	"github.com/umputun/remark42/backend/app/store"
 )
@@ -18,6 +21,9 @@ type Service struct {
 	destinations      []Destination
 	queue             chan Request
 	verificationQueue chan VerificationRequest
+	durable           *Queue        // persistent queue of requests, in-memory queue used if not set
+	wakeup            chan struct{} // signals new or retried requests in durable queue
+	delivered         chan struct{} // closed on termination of durable queue delivery
 
 	closed uint32 // non-zero means closed. uses uint instead of bool for atomic
 	ctx    context.Context
@@ -35,15 +41,34 @@ type Destination interface {
 type Store interface {
 	Get(locator store.Locator, id string, user store.User) (store.Comment, error)
 	GetUserEmail(siteID string, userID string) (string, error)
+	Subscriptions(locator store.Locator, userID string) ([]store.Subscription, error)
+	GetUserDigest(siteID, userID string) (store.DigestMode, error)
 }
 
-// Request notification for a Comment
+// Request notification for a Comment. Request with Report is an alert for admins about reported comment
 type Request struct {
-	Comment     store.Comment
-	parent      store.Comment
-	Emails      []string
+	Comment       store.Comment
+	Event         Event // new comment if not set
+	Report        *store.Report
+	parent        store.Comment
+	Emails        []string
+	subscriptions map[string]store.Subscription // email -> subscription to post or thread caused notification
+	mentions      map[string]string             // email -> id of user mentioned in the comment
+	digests       map[string]store.DigestMode   // email -> digest mode of recipient, not set for immediate delivery
 }
 
+// Event defines change of the comment caused notification
+type Event string
+
+// enum of all events
+const (
+	EventCreate Event = "create"
+	EventUpdate Event = "update"
+	EventDelete Event = "delete"
+	EventVote   Event = "vote"
+	EventReport Event = "report"
+)
+
 // VerificationRequest notification for user
 type VerificationRequest struct {
 	SiteID string
@@ -53,6 +78,7 @@ type VerificationRequest struct {
 }
 
 const defaultQueueSize = 100
+const defaultQueueCheck = time.Second
 const uiNav = "#remark42__comment-"
 
 // NewService makes notification service routing comments to all destinations.
@@ -76,16 +102,60 @@ func NewService(dataService Store, size int, destinations ...Destination) *Servi
 	return &res
 }
 
+// NewQueuedService makes notification service keeping requests in persistent queue until delivered to all destinations.
+// Each destination retried separately with backoff defined by queue, delivery is at-least-once, even across restarts.
+// Queue checked for requests ready to retry every checkInterval and closed by Close of the service.
+func NewQueuedService(dataService Store, queue *Queue, checkInterval time.Duration, destinations ...Destination) *Service {
+	res := NewService(dataService, 0, destinations...)
+	res.durable, res.wakeup, res.delivered = queue, make(chan struct{}, 1), make(chan struct{})
+	if checkInterval <= 0 {
+		checkInterval = defaultQueueCheck
+	}
+	go res.deliver(checkInterval)
+	log.Printf("[INFO] use persistent notification queue, max attempts=%d, retry delay=%s",
+		queue.MaxAttempts, queue.RetryDelay)
+	return res
+}
+
 // Submit Request to internal channel if not busy, drop if can't send
 func (s *Service) Submit(req Request) {
 	if len(s.destinations) == 0 || atomic.LoadUint32(&s.closed) != 0 {
 		return
 	}
-	if s.dataService != nil && req.Comment.ParentID != "" {
-		if p, err := s.dataService.Get(req.Comment.Locator, req.Comment.ParentID, store.User{}); err == nil {
-			req.parent = p
-			req.Emails = deduplicateStrings(s.getNotificationEmails(req, p))
+	if s.dataService != nil && req.event() == EventCreate {
+		recipients := map[string]string{} // email -> user id
+		if req.Comment.ParentID != "" {
+			if p, err := s.dataService.Get(req.Comment.Locator, req.Comment.ParentID, store.User{}); err == nil {
+				req.parent = p
+				recipients = s.getNotificationEmails(req, p)
+				for email := range recipients {
+					req.Emails = append(req.Emails, email)
+				}
+			}
+		}
+		req.mentions = s.getMentionEmails(req)
+		for email, userID := range req.mentions {
+			req.Emails = append(req.Emails, email)
+			recipients[email] = userID
+		}
+		req.subscriptions = s.getSubscriptionEmails(req)
+		for email, sub := range req.subscriptions {
+			req.Emails = append(req.Emails, email)
+			recipients[email] = sub.UserID
+		}
+		req.digests = s.getDigestModes(req.Comment.Locator.SiteID, recipients)
+	}
+	if s.durable != nil {
+		names := make([]string, 0, len(s.destinations))
+		for _, dest := range s.destinations {
+			names = append(names, dest.String())
 		}
+		if _, err := s.durable.Put(req, names...); err != nil {
+			log.Printf("[WARN] can't put notification to persistent queue, %v", err)
+			return
+		}
+		s.wake()
+		return
 	}
 	select {
 	case s.queue <- req:
@@ -94,9 +164,21 @@ func (s *Service) Submit(req Request) {
 	}
 }
 
-// getNotificationEmails returns list of emails for notifications for provided comment.
-// Emails is not added to the returned list in case original message is from the same user as the notification receiver.
-func (s *Service) getNotificationEmails(req Request, notifyComment store.Comment) (result []string) {
+// event returns event of the request, requests without event set are new comments or reports
+func (r Request) event() Event {
+	if r.Event != "" {
+		return r.Event
+	}
+	if r.Report != nil {
+		return EventReport
+	}
+	return EventCreate
+}
+
+// getNotificationEmails returns emails for notifications for provided comment, mapped to user ids.
+// Emails is not added to the result in case original message is from the same user as the notification receiver.
+func (s *Service) getNotificationEmails(req Request, notifyComment store.Comment) map[string]string {
+	result := map[string]string{}
 	// add current user email only if the user is not the one who wrote the original comment
 	if notifyComment.User.ID != req.Comment.User.ID {
 		email, err := s.dataService.GetUserEmail(req.Comment.Locator.SiteID, notifyComment.User.ID)
@@ -104,17 +186,135 @@ func (s *Service) getNotificationEmails(req Request, notifyComment store.Comment
 			log.Printf("[WARN] can't read email for %s, %v", notifyComment.User.ID, err)
 		}
 		if email != "" {
-			result = append(result, email)
+			result[email] = notifyComment.User.ID
 		}
 	}
 	if notifyComment.ParentID != "" {
 		if p, err := s.dataService.Get(req.Comment.Locator, notifyComment.ParentID, store.User{}); err == nil {
-			result = append(result, s.getNotificationEmails(req, p)...)
+			for email, userID := range s.getNotificationEmails(req, p) {
+				if _, ok := result[email]; !ok {
+					result[email] = userID
+				}
+			}
 		}
 	}
 	return result
 }
 
+// getMentionEmails returns emails of users mentioned in provided comment, mapped to user ids.
+// Emails already notified as replies and the author of the comment are skipped.
+func (s *Service) getMentionEmails(req Request) map[string]string {
+	notified := map[string]bool{}
+	for _, email := range req.Emails {
+		notified[email] = true
+	}
+	res := map[string]string{}
+	for _, userID := range req.Comment.Mentions {
+		if userID == req.Comment.User.ID {
+			continue
+		}
+		email, err := s.dataService.GetUserEmail(req.Comment.Locator.SiteID, userID)
+		if err != nil {
+			log.Printf("[WARN] can't read email for %s, %v", userID, err)
+		}
+		if email == "" || notified[email] {
+			continue
+		}
+		res[email] = userID
+	}
+	return res
+}
+
+// getDigestModes returns digest modes of recipients (email -> user id), recipients with immediate delivery skipped
+func (s *Service) getDigestModes(siteID string, recipients map[string]string) map[string]store.DigestMode {
+	res := map[string]store.DigestMode{}
+	for email, userID := range recipients {
+		mode, err := s.dataService.GetUserDigest(siteID, userID)
+		if err != nil {
+			log.Printf("[WARN] can't read digest mode for %s, %v", userID, err)
+			continue
+		}
+		if mode.Period() > 0 {
+			res[email] = mode
+		}
+	}
+	return res
+}
+
+// getSubscriptionEmails returns emails of users subscribed to the post or to the thread of provided comment.
+// Emails already notified as replies and the author of the comment are skipped, so nobody gets the same comment twice.
+// Thread subscription preferred over post subscription of the same user as more specific one.
+func (s *Service) getSubscriptionEmails(req Request) map[string]store.Subscription {
+	subs, err := s.dataService.Subscriptions(req.Comment.Locator, "")
+	if err != nil {
+		log.Printf("[WARN] can't read subscriptions for %s, %v", req.Comment.Locator.URL, err)
+		return nil
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+
+	// collect all parents of the comment, thread subscribers notified about replies at any level
+	thread := map[string]bool{}
+	p := req.parent
+	for p.ID != "" && !thread[p.ID] {
+		thread[p.ID] = true
+		if p.ParentID == "" {
+			break
+		}
+		if p, err = s.dataService.Get(req.Comment.Locator, p.ParentID, store.User{}); err != nil {
+			break
+		}
+	}
+
+	notified := map[string]bool{}
+	for _, email := range req.Emails {
+		notified[email] = true
+	}
+
+	res := map[string]store.Subscription{}
+	for _, sub := range subs {
+		if sub.UserID == req.Comment.User.ID || (sub.CommentID != "" && !thread[sub.CommentID]) {
+			continue
+		}
+		email, e := s.dataService.GetUserEmail(req.Comment.Locator.SiteID, sub.UserID)
+		if e != nil {
+			log.Printf("[WARN] can't read email for %s, %v", sub.UserID, e)
+		}
+		if email == "" || notified[email] {
+			continue
+		}
+		if prev, ok := res[email]; ok && prev.CommentID != "" {
+			continue
+		}
+		res[email] = sub
+	}
+	return res
+}
+
+// QueueStats returns pending requests count and failed requests of persistent queue for the site
+func (s *Service) QueueStats(siteID string) (QueueStats, error) {
+	if s.durable == nil {
+		return QueueStats{}, ErrQueueDisabled
+	}
+	return s.durable.Stats(siteID)
+}
+
+// Retry failed or pending request of persistent queue right now
+func (s *Service) Retry(siteID, id string) error {
+	if s.durable == nil {
+		return ErrQueueDisabled
+	}
+	if err := s.durable.Retry(siteID, id); err != nil {
+		return err
+	}
+	s.wake()
+	return nil
+}
+
+// ErrQueueDisabled returned by queue methods of service without persistent queue
+var ErrQueueDisabled = errors.New("persistent notification queue disabled")
+
 // SubmitVerification to internal channel if not busy, drop if can't send
 func (s *Service) SubmitVerification(req VerificationRequest) {
 	if len(s.destinations) == 0 || atomic.LoadUint32(&s.closed) != 0 {
@@ -127,7 +327,7 @@ func (s *Service) SubmitVerification(req VerificationRequest) {
 	}
 }
 
-// Close queue channel and wait for completion
+// Close queue channel and wait for completion, closes destinations implementing io.Closer
 func (s *Service) Close() {
 	if s.queue != nil {
 		log.Print("[DEBUG] close notifier")
@@ -137,6 +337,19 @@ func (s *Service) Close() {
 		<-s.ctx.Done()
 	}
 	atomic.StoreUint32(&s.closed, 1)
+	if s.durable != nil {
+		<-s.delivered
+		if err := s.durable.Close(); err != nil {
+			log.Printf("[WARN] failed to close persistent queue, %v", err)
+		}
+	}
+	for _, dest := range s.destinations {
+		if c, ok := dest.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Printf("[WARN] failed to close %s, %v", dest, err)
+			}
+		}
+	}
 }
 
 func (s *Service) do() {
@@ -178,22 +391,72 @@ func (s *Service) do() {
 	}
 }
 
-// NopService is do-nothing notifier, without destinations
-var NopService = &Service{}
-
-// deduplicateStrings returns provided slice of strings will all duplicates removed.
-// Resulting slice is not sorted.
-func deduplicateStrings(source []string) []string {
-	set := make(map[string]struct{})
+// deliver sends requests from persistent queue on wakeup and every checkInterval till service closed
+func (s *Service) deliver(checkInterval time.Duration) {
+	defer close(s.delivered)
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		s.deliverDue()
+		select {
+		case <-s.wakeup:
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
 
-	for _, k := range source {
-		set[k] = struct{}{}
+// deliverDue sends all requests ready for delivery and records results in the queue.
+// Attempts interrupted by termination of the service are not recorded, so requests sent again after restart.
+func (s *Service) deliverDue() {
+	records, err := s.durable.due(time.Now())
+	if err != nil {
+		log.Printf("[WARN] can't get notifications from persistent queue, %v", err)
+		return
+	}
+	dests := map[string]Destination{}
+	for _, dest := range s.destinations {
+		dests[dest.String()] = dest
 	}
 
-	result := make([]string, 0, len(set))
-	for k := range set {
-		result = append(result, k)
+	var wg sync.WaitGroup
+	for _, rec := range records {
+		req := rec.Request.request()
+		wg.Add(len(rec.Deliveries))
+		for _, d := range rec.Deliveries {
+			go func(id, name string) {
+				defer wg.Done()
+				dest, ok := dests[name]
+				err := errors.Errorf("destination %s not configured", name)
+				if ok {
+					err = dest.Send(s.ctx, req)
+				}
+				if s.ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					log.Printf("[WARN] failed to send to %s, %s", name, err)
+				}
+				if e := s.durable.Update(id, name, err); e != nil {
+					log.Printf("[WARN] can't update delivery status of %s to %s, %v", id, name, e)
+				}
+			}(rec.ID, d.Destination)
+		}
+		wg.Wait()
+		if s.ctx.Err() != nil {
+			return
+		}
 	}
+}
 
-	return result
+// wake delivery of persistent queue, doesn't block if wakeup already pending
+func (s *Service) wake() {
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
 }
+
+// NopService is do-nothing notifier, without destinations
+var NopService = &Service{}
@@ -1,6 +1,7 @@
 package notify
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
 
 	"github.com/umputun/remark42/backend/app/store"
 )
@@ -139,6 +141,23 @@ func TestService_WithParent(t *testing.T) {
 	assert.Equal(t, "", destRes[1].parent.ID)
 }
 
+func TestService_Report(t *testing.T) {
+	dest := &MockDest{id: 1}
+	dataStore := &mockStore{data: map[string]store.Comment{}}
+	dataStore.data["p1"] = store.Comment{ID: "p1", User: store.User{ID: "u1"}}
+
+	s := NewService(dataStore, 1, dest)
+	s.Submit(Request{Comment: store.Comment{ID: "c1", ParentID: "p1"}, Report: &store.Report{CommentID: "c1"}})
+	time.Sleep(time.Millisecond * 110)
+	s.Close()
+
+	destRes := dest.Get()
+	require.Equal(t, 1, len(destRes))
+	assert.Equal(t, "c1", destRes[0].Report.CommentID)
+	assert.Equal(t, "", destRes[0].parent.ID, "parent not loaded for report")
+	assert.Empty(t, destRes[0].Emails, "no user's emails for report")
+}
+
 func TestService_EmailRetrieval(t *testing.T) {
 	dest := &MockDest{id: 1}
 	dataStore := &mockStore{data: map[string]store.Comment{}, emailData: map[string]string{}}
@@ -198,6 +217,101 @@ func TestService_EmailRetrieval(t *testing.T) {
 	s.Close()
 }
 
+func TestService_Subscriptions(t *testing.T) {
+	dest := &MockDest{id: 1}
+	dataStore := &mockStore{data: map[string]store.Comment{}, emailData: map[string]string{}}
+
+	loc := store.Locator{SiteID: "remark42", URL: "https://example.com/post"}
+	dataStore.data["p1"] = store.Comment{ID: "p1", Locator: loc, User: store.User{ID: "u1"}}
+	dataStore.data["p2"] = store.Comment{ID: "p2", Locator: loc, ParentID: "p1", User: store.User{ID: "u2"}}
+	dataStore.data["p3"] = store.Comment{ID: "p3", Locator: loc, ParentID: "p2", User: store.User{ID: "u3"}}
+	dataStore.data["p4"] = store.Comment{ID: "p4", Locator: loc, User: store.User{ID: "u4"}}
+	for _, u := range []string{"u1", "u2", "u3", "u4", "u5", "u6"} {
+		dataStore.emailData[u] = u + "@example.com"
+	}
+	dataStore.subscriptions = []store.Subscription{
+		{Locator: loc, UserID: "u5"},                  // whole post
+		{Locator: loc, UserID: "u2", CommentID: "p1"}, // thread, also notified as author of parent
+		{Locator: loc, UserID: "u4", CommentID: "p1"}, // thread
+		{Locator: loc, UserID: "u3"},                  // whole post, author of p3
+		{Locator: loc, UserID: "u6"},                  // whole post and thread
+		{Locator: loc, UserID: "u6", CommentID: "p1"},
+		{Locator: store.Locator{SiteID: "remark42", URL: "https://example.com/other"}, UserID: "u1"},
+	}
+
+	s := NewService(dataStore, 1, dest)
+	s.Submit(Request{Comment: dataStore.data["p3"]})
+	time.Sleep(time.Millisecond * 110)
+	destRes := dest.Get()
+	require.Equal(t, 1, len(destRes))
+	assert.ElementsMatch(t, []string{"u1@example.com", "u2@example.com", "u4@example.com", "u5@example.com",
+		"u6@example.com"}, destRes[0].Emails, "reply to any level of thread, each email once")
+	assert.Equal(t, map[string]store.Subscription{
+		"u4@example.com": {Locator: loc, UserID: "u4", CommentID: "p1"},
+		"u5@example.com": {Locator: loc, UserID: "u5"},
+		"u6@example.com": {Locator: loc, UserID: "u6", CommentID: "p1"},
+	}, destRes[0].subscriptions, "replies not counted as subscriptions, thread subscription preferred")
+
+	s.Submit(Request{Comment: dataStore.data["p4"]})
+	time.Sleep(time.Millisecond * 110)
+	s.Close()
+	destRes = dest.Get()
+	require.Equal(t, 2, len(destRes))
+	assert.ElementsMatch(t, []string{"u3@example.com", "u5@example.com", "u6@example.com"}, destRes[1].Emails,
+		"new top-level comment, post subscribers only")
+}
+
+func TestService_Mentions(t *testing.T) {
+	dest := &MockDest{id: 1}
+	dataStore := &mockStore{data: map[string]store.Comment{}, emailData: map[string]string{}}
+
+	loc := store.Locator{SiteID: "remark42", URL: "https://example.com/post"}
+	dataStore.data["p1"] = store.Comment{ID: "p1", Locator: loc, User: store.User{ID: "u1"}}
+	dataStore.data["p2"] = store.Comment{ID: "p2", Locator: loc, ParentID: "p1", User: store.User{ID: "u2"},
+		Mentions: []string{"u1", "u3", "u4", "u5"}}
+	for _, u := range []string{"u1", "u2", "u3", "u5"} {
+		dataStore.emailData[u] = u + "@example.com"
+	}
+	dataStore.subscriptions = []store.Subscription{{Locator: loc, UserID: "u5"}}
+
+	s := NewService(dataStore, 1, dest)
+	s.Submit(Request{Comment: dataStore.data["p2"]})
+	time.Sleep(time.Millisecond * 110)
+	s.Close()
+	destRes := dest.Get()
+	require.Equal(t, 1, len(destRes))
+	assert.ElementsMatch(t, []string{"u1@example.com", "u3@example.com", "u5@example.com"}, destRes[0].Emails,
+		"each email once, mentioned user without email skipped")
+	assert.Equal(t, map[string]string{"u3@example.com": "u3", "u5@example.com": "u5"}, destRes[0].mentions,
+		"reply to parent's author not counted as mention, mention preferred over subscription")
+	assert.Empty(t, destRes[0].subscriptions)
+}
+
+func TestService_Digests(t *testing.T) {
+	dest := &MockDest{id: 1}
+	dataStore := &mockStore{data: map[string]store.Comment{}, emailData: map[string]string{},
+		digests: map[string]store.DigestMode{"u1": store.DigestDaily, "u3": store.DigestHourly}}
+
+	loc := store.Locator{SiteID: "remark42", URL: "https://example.com/post"}
+	dataStore.data["p1"] = store.Comment{ID: "p1", Locator: loc, User: store.User{ID: "u1"}}
+	dataStore.data["p2"] = store.Comment{ID: "p2", Locator: loc, ParentID: "p1", User: store.User{ID: "u2"}}
+	dataStore.data["p3"] = store.Comment{ID: "p3", Locator: loc, ParentID: "p2", User: store.User{ID: "u4"}}
+	for _, u := range []string{"u1", "u2", "u3"} {
+		dataStore.emailData[u] = u + "@example.com"
+	}
+	dataStore.subscriptions = []store.Subscription{{Locator: loc, UserID: "u3"}}
+
+	s := NewService(dataStore, 1, dest)
+	s.Submit(Request{Comment: dataStore.data["p3"]})
+	time.Sleep(time.Millisecond * 110)
+	s.Close()
+	destRes := dest.Get()
+	require.Equal(t, 1, len(destRes))
+	assert.ElementsMatch(t, []string{"u1@example.com", "u2@example.com", "u3@example.com"}, destRes[0].Emails)
+	assert.Equal(t, map[string]store.DigestMode{"u1@example.com": store.DigestDaily, "u3@example.com": store.DigestHourly},
+		destRes[0].digests, "immediate delivery for u2")
+}
+
 func TestService_Recursive(t *testing.T) {
 	dest := &MockDest{id: 1}
 	dataStore := &mockStore{data: map[string]store.Comment{}, emailData: map[string]string{}}
@@ -271,6 +385,63 @@ func TestService_Recursive(t *testing.T) {
 	s.Close()
 }
 
+func TestService_Queued(t *testing.T) {
+	q, teardown := prepQueue(t, QueueParams{MaxAttempts: 2, RetryDelay: 10 * time.Millisecond})
+	defer teardown()
+	d1, d2 := &MockDest{id: 1}, &failingDest{failures: 10}
+	s := NewQueuedService(nil, q, time.Millisecond*5, d1, d2)
+
+	s.Submit(Request{Comment: store.Comment{ID: "100", Locator: store.Locator{SiteID: "remark"}}})
+	s.Submit(Request{Comment: store.Comment{ID: "101", Locator: store.Locator{SiteID: "remark"}}})
+	time.Sleep(time.Millisecond * 100)
+	require.Equal(t, 2, len(d1.Get()), "got all comments to d1")
+	assert.Equal(t, int32(4), atomic.LoadInt32(&d2.attempts), "two attempts for each comment to d2")
+
+	stats, err := s.QueueStats("remark")
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Pending)
+	require.Equal(t, 2, len(stats.Failed))
+	assert.Equal(t, "101", stats.Failed[0].CommentID)
+	assert.Equal(t, DeliveryDelivered, stats.Failed[0].Deliveries[0].Status)
+	assert.Equal(t, DeliveryFailed, stats.Failed[0].Deliveries[1].Status)
+	assert.Equal(t, "failed attempt 4", stats.Failed[0].Deliveries[1].LastError)
+
+	atomic.StoreInt32(&d2.failures, 0)
+	require.NoError(t, s.Retry("remark", stats.Failed[1].ID))
+	assert.Error(t, s.Retry("remark", "bad"))
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, 2, len(d1.Get()), "delivered destination not retried")
+	stats, err = s.QueueStats("remark")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(stats.Failed), "retried comment delivered")
+	assert.Equal(t, "101", stats.Failed[0].CommentID)
+	s.Close()
+
+	s = NewService(nil, 1, d1)
+	_, err = s.QueueStats("remark")
+	assert.EqualError(t, err, "persistent notification queue disabled")
+	assert.EqualError(t, s.Retry("remark", "id"), "persistent notification queue disabled")
+	s.Close()
+}
+
+func TestService_QueuedRestart(t *testing.T) {
+	q, teardown := prepQueue(t, QueueParams{})
+	defer teardown()
+	blocked := &MockDest{id: 1}
+	s := NewQueuedService(nil, q, time.Hour, &failingDest{failures: 10}) // not the same destination as blocked
+	s.Submit(Request{Comment: store.Comment{ID: "100"}})
+	s.Close()
+
+	q, err := NewQueue(testQueueDB, bolt.Options{}, QueueParams{})
+	require.NoError(t, err)
+	d := &failingDest{}
+	s = NewQueuedService(nil, q, time.Hour, d, blocked)
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&d.attempts), "pending request delivered after restart")
+	assert.Equal(t, 0, len(blocked.Get()), "new destination doesn't get old requests")
+	s.Close()
+}
+
 func TestService_Nop(t *testing.T) {
 	s := NopService
 	s.Submit(Request{Comment: store.Comment{}})
@@ -278,9 +449,29 @@ func TestService_Nop(t *testing.T) {
 	assert.Equal(t, uint32(1), atomic.LoadUint32(&s.closed))
 }
 
+// failingDest fails first failures attempts to send
+type failingDest struct {
+	failures int32
+	attempts int32
+}
+
+func (f *failingDest) Send(_ context.Context, _ Request) error {
+	n := atomic.AddInt32(&f.attempts, 1)
+	if n <= atomic.LoadInt32(&f.failures) {
+		return fmt.Errorf("failed attempt %d", n)
+	}
+	return nil
+}
+
+func (f *failingDest) SendVerification(_ context.Context, _ VerificationRequest) error { return nil }
+
+func (f *failingDest) String() string { return "failing" }
+
 type mockStore struct {
-	data      map[string]store.Comment
-	emailData map[string]string
+	data          map[string]store.Comment
+	emailData     map[string]string
+	subscriptions []store.Subscription
+	digests       map[string]store.DigestMode
 }
 
 func (m mockStore) Get(_ store.Locator, id string, _ store.User) (store.Comment, error) {
@@ -298,3 +489,20 @@ func (m mockStore) GetUserEmail(_, userID string) (string, error) {
 	}
 	return email, nil
 }
+
+func (m mockStore) Subscriptions(locator store.Locator, _ string) ([]store.Subscription, error) {
+	res := []store.Subscription{}
+	for _, sub := range m.subscriptions {
+		if sub.Locator.URL == locator.URL {
+			res = append(res, sub)
+		}
+	}
+	return res, nil
+}
+
+func (m mockStore) GetUserDigest(_, userID string) (store.DigestMode, error) {
+	if mode, ok := m.digests[userID]; ok {
+		return mode, nil
+	}
+	return store.DigestImmediate, nil
+}
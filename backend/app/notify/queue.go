@@ -0,0 +1,291 @@
+package notify
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// QueueParams contain settings of persistent queue
+type QueueParams struct {
+	MaxAttempts int           // max number of delivery attempts to a destination, delivery failed after that
+	RetryDelay  time.Duration // delay before the second attempt, doubled for each next one
+}
+
+// Queue keeps notification requests in bolt db until delivered to all destinations, so they survive restarts.
+// Each destination has own delivery status of the request, failed deliveries kept for review and manual retry.
+// Key is ts!!id, value is json-serialized queueRecord
+type Queue struct {
+	QueueParams
+	db *bolt.DB
+}
+
+// QueueItem is a single request in the queue with delivery status for each destination
+type QueueItem struct {
+	ID         string     `json:"id"`
+	SiteID     string     `json:"site"`
+	CommentID  string     `json:"comment_id"`
+	Event      Event      `json:"event"`
+	Created    time.Time  `json:"created"`
+	Deliveries []Delivery `json:"deliveries"`
+}
+
+// Delivery is status of queued request delivery to a single destination
+type Delivery struct {
+	Destination string         `json:"destination"`
+	Status      DeliveryStatus `json:"status"`
+	Attempts    int            `json:"attempts"`
+	NextAttempt time.Time      `json:"next_attempt"`
+	LastError   string         `json:"last_error,omitempty"`
+	Updated     time.Time      `json:"updated"`
+}
+
+// DeliveryStatus defines state of delivery to a destination
+type DeliveryStatus string
+
+// enum of all delivery statuses
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// QueueStats is a summary of the queue for a site
+type QueueStats struct {
+	Pending int         `json:"pending"` // number of requests waiting for delivery to at least one destination
+	Failed  []QueueItem `json:"failed"`  // requests failed to deliver to at least one destination
+}
+
+// queueRecord is stored in bolt, keeps request with all fields needed for delivery after restart
+type queueRecord struct {
+	QueueItem
+	Request queuedRequest `json:"request"`
+}
+
+// queuedRequest is a serializable copy of Request, including unexported fields
+type queuedRequest struct {
+	Comment       store.Comment                 `json:"comment"`
+	Event         Event                         `json:"event,omitempty"`
+	Report        *store.Report                 `json:"report,omitempty"`
+	Parent        store.Comment                 `json:"parent"`
+	Emails        []string                      `json:"emails,omitempty"`
+	Subscriptions map[string]store.Subscription `json:"subscriptions,omitempty"`
+	Digests       map[string]store.DigestMode   `json:"digests,omitempty"`
+	Mentions      map[string]string             `json:"mentions,omitempty"`
+}
+
+const (
+	queueBucketName   = "queue"
+	queueMaxAttempts  = 10
+	queueRetryDelay   = 10 * time.Second
+	queueMaxRetryWait = 24 * time.Hour
+)
+
+// NewQueue makes persistent queue in fileName
+func NewQueue(fileName string, options bolt.Options, params QueueParams) (*Queue, error) {
+	db, err := bolt.Open(fileName, 0600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to make boltdb for %s", fileName)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, e := tx.CreateBucketIfNotExists([]byte(queueBucketName))
+		return e
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create top level bucket %s", queueBucketName)
+	}
+	res := Queue{QueueParams: params, db: db}
+	if res.MaxAttempts <= 0 {
+		res.MaxAttempts = queueMaxAttempts
+	}
+	if res.RetryDelay <= 0 {
+		res.RetryDelay = queueRetryDelay
+	}
+	return &res, nil
+}
+
+// Put request to the queue with pending delivery to each of destinations
+func (q *Queue) Put(req Request, destinations ...string) (QueueItem, error) {
+	now := time.Now()
+	rec := queueRecord{
+		QueueItem: QueueItem{ID: uuid.New().String(), SiteID: req.Comment.Locator.SiteID, CommentID: req.Comment.ID,
+			Event: req.event(), Created: now},
+		Request: queuedRequest{Comment: req.Comment, Event: req.Event, Report: req.Report, Parent: req.parent,
+			Emails: req.Emails, Subscriptions: req.subscriptions, Digests: req.digests, Mentions: req.mentions},
+	}
+	for _, dest := range destinations {
+		rec.Deliveries = append(rec.Deliveries,
+			Delivery{Destination: dest, Status: DeliveryPending, NextAttempt: now, Updated: now})
+	}
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		return q.save(tx.Bucket([]byte(queueBucketName)), rec)
+	})
+	return rec.QueueItem, errors.Wrapf(err, "can't put request for comment %s", req.Comment.ID)
+}
+
+// due returns requests with pending deliveries ready for the next attempt at the given time,
+// deliveries of each record limited to destinations it should be sent to. Oldest requests first.
+func (q *Queue) due(now time.Time) (res []queueRecord, err error) {
+	err = q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(queueBucketName)).ForEach(func(k, v []byte) error {
+			rec := queueRecord{}
+			if e := json.Unmarshal(v, &rec); e != nil {
+				return errors.Wrapf(e, "can't unmarshal queue record %s", string(k))
+			}
+			var due []Delivery
+			for _, d := range rec.Deliveries {
+				if d.Status == DeliveryPending && !d.NextAttempt.After(now) {
+					due = append(due, d)
+				}
+			}
+			if len(due) == 0 {
+				return nil
+			}
+			rec.Deliveries = due
+			res = append(res, rec)
+			return nil
+		})
+	})
+	return res, err
+}
+
+// Update records result of delivery attempt to destination. Successful delivery marked as delivered,
+// failed one scheduled for retry with exponential backoff or marked as failed after MaxAttempts.
+// Request removed from the queue once delivered to all destinations.
+func (q *Queue) Update(id, destination string, sendErr error) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(queueBucketName))
+		rec, err := q.find(bkt, id)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		delivered := true
+		for i := range rec.Deliveries {
+			d := &rec.Deliveries[i]
+			if d.Destination == destination {
+				d.Attempts++
+				d.Updated = now
+				switch {
+				case sendErr == nil:
+					d.Status, d.LastError = DeliveryDelivered, ""
+				case d.Attempts >= q.MaxAttempts:
+					d.Status, d.LastError = DeliveryFailed, sendErr.Error()
+				default:
+					d.LastError, d.NextAttempt = sendErr.Error(), now.Add(q.backoff(d.Attempts))
+				}
+			}
+			delivered = delivered && d.Status == DeliveryDelivered
+		}
+		if delivered {
+			return errors.Wrapf(bkt.Delete(queueKey(rec.QueueItem)), "can't delete queue record %s", id)
+		}
+		return q.save(bkt, rec)
+	})
+}
+
+// Retry resets failed and pending deliveries of the site's request, all of them attempted again immediately
+func (q *Queue) Retry(siteID, id string) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(queueBucketName))
+		rec, err := q.find(bkt, id)
+		if err != nil {
+			return err
+		}
+		if rec.SiteID != siteID {
+			return errors.Errorf("can't find queue record %s", id)
+		}
+		now := time.Now()
+		for i := range rec.Deliveries {
+			d := &rec.Deliveries[i]
+			if d.Status != DeliveryDelivered {
+				d.Status, d.Attempts, d.NextAttempt, d.Updated = DeliveryPending, 0, now, now
+			}
+		}
+		return q.save(bkt, rec)
+	})
+}
+
+// Stats returns number of pending requests and all failed requests of the site, the most recent failures first
+func (q *Queue) Stats(siteID string) (res QueueStats, err error) {
+	res.Failed = []QueueItem{}
+	err = q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(queueBucketName)).ForEach(func(k, v []byte) error {
+			rec := queueRecord{}
+			if e := json.Unmarshal(v, &rec); e != nil {
+				return errors.Wrapf(e, "can't unmarshal queue record %s", string(k))
+			}
+			if rec.SiteID != siteID {
+				return nil
+			}
+			pending, failed := false, false
+			for _, d := range rec.Deliveries {
+				pending = pending || d.Status == DeliveryPending
+				failed = failed || d.Status == DeliveryFailed
+			}
+			if pending {
+				res.Pending++
+			}
+			if failed {
+				res.Failed = append(res.Failed, rec.QueueItem)
+			}
+			return nil
+		})
+	})
+	sort.Slice(res.Failed, func(i, j int) bool { return res.Failed[i].Created.After(res.Failed[j].Created) })
+	return res, err
+}
+
+// Close bolt db
+func (q *Queue) Close() error {
+	return errors.Wrap(q.db.Close(), "can't close queue db")
+}
+
+// backoff returns delay after given number of failed attempts, RetryDelay doubled for each attempt after the first one
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.RetryDelay
+	for i := 1; i < attempts && delay < queueMaxRetryWait; i++ {
+		delay *= 2
+	}
+	if delay > queueMaxRetryWait {
+		delay = queueMaxRetryWait
+	}
+	return delay
+}
+
+// find record by id, keys start with timestamp, so all of them checked
+func (q *Queue) find(bkt *bolt.Bucket, id string) (rec queueRecord, err error) {
+	suffix := "!!" + id
+	c := bkt.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if strings.HasSuffix(string(k), suffix) {
+			err = json.Unmarshal(v, &rec)
+			return rec, errors.Wrapf(err, "can't unmarshal queue record %s", id)
+		}
+	}
+	return rec, errors.Errorf("can't find queue record %s", id)
+}
+
+func (q *Queue) save(bkt *bolt.Bucket, rec queueRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrapf(err, "can't marshal queue record %s", rec.ID)
+	}
+	return errors.Wrapf(bkt.Put(queueKey(rec.QueueItem), data), "can't put queue record %s", rec.ID)
+}
+
+func (r queuedRequest) request() Request {
+	return Request{Comment: r.Comment, Event: r.Event, Report: r.Report, parent: r.Parent, Emails: r.Emails,
+		subscriptions: r.Subscriptions, digests: r.Digests, mentions: r.Mentions}
+}
+
+func queueKey(item QueueItem) []byte {
+	return []byte(item.Created.UTC().Format(tsKeyFormat) + "!!" + item.ID)
+}
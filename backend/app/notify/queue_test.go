@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+const testQueueDB = "/tmp/test-remark-queue.db"
+
+func TestQueue_PutUpdate(t *testing.T) {
+	q, teardown := prepQueue(t, QueueParams{MaxAttempts: 3, RetryDelay: time.Minute})
+	defer teardown()
+
+	req := Request{Comment: store.Comment{ID: "c1", Locator: store.Locator{SiteID: "remark", URL: "http://example.com"}},
+		parent: store.Comment{ID: "p1"}, Emails: []string{"u1@example.com"},
+		digests:  map[string]store.DigestMode{"u1@example.com": store.DigestDaily},
+		mentions: map[string]string{"u1@example.com": "u1"}}
+	item, err := q.Put(req, "d1", "d2")
+	require.NoError(t, err)
+	assert.Equal(t, "remark", item.SiteID)
+	assert.Equal(t, "c1", item.CommentID)
+	assert.Equal(t, EventCreate, item.Event)
+	require.Equal(t, 2, len(item.Deliveries))
+
+	recs, err := q.due(time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(recs))
+	assert.Equal(t, req, recs[0].Request.request(), "unexported fields of request restored")
+
+	require.NoError(t, q.Update(item.ID, "d1", nil))
+	require.NoError(t, q.Update(item.ID, "d2", errors.New("send error")))
+	recs, err = q.due(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(recs), "d1 delivered, d2 waits for retry")
+	recs, err = q.due(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(recs))
+	require.Equal(t, 1, len(recs[0].Deliveries))
+	d := recs[0].Deliveries[0]
+	assert.Equal(t, "d2", d.Destination)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, "send error", d.LastError)
+
+	stats, err := q.Stats("remark")
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Pending)
+	assert.Equal(t, 0, len(stats.Failed))
+
+	require.NoError(t, q.Update(item.ID, "d2", errors.New("send error")))
+	recs, err = q.due(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(recs), "backoff doubled")
+	require.NoError(t, q.Update(item.ID, "d2", errors.New("final error")))
+
+	stats, err = q.Stats("remark")
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Pending)
+	require.Equal(t, 1, len(stats.Failed))
+	assert.Equal(t, item.ID, stats.Failed[0].ID)
+	assert.Equal(t, DeliveryDelivered, stats.Failed[0].Deliveries[0].Status)
+	assert.Equal(t, DeliveryFailed, stats.Failed[0].Deliveries[1].Status)
+	assert.Equal(t, 3, stats.Failed[0].Deliveries[1].Attempts)
+	assert.Equal(t, "final error", stats.Failed[0].Deliveries[1].LastError)
+	stats, err = q.Stats("other")
+	require.NoError(t, err)
+	assert.Equal(t, QueueStats{Failed: []QueueItem{}}, stats)
+
+	assert.EqualError(t, q.Retry("other", item.ID), "can't find queue record "+item.ID)
+	assert.EqualError(t, q.Update("bad", "d1", nil), "can't find queue record bad")
+	require.NoError(t, q.Retry("remark", item.ID))
+	recs, err = q.due(time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(recs))
+	require.Equal(t, 1, len(recs[0].Deliveries), "only failed delivery retried")
+	assert.Equal(t, 0, recs[0].Deliveries[0].Attempts)
+
+	require.NoError(t, q.Update(item.ID, "d2", nil))
+	stats, err = q.Stats("remark")
+	require.NoError(t, err)
+	assert.Equal(t, QueueStats{Failed: []QueueItem{}}, stats, "delivered request removed")
+}
+
+func TestQueue_Reopen(t *testing.T) {
+	q, teardown := prepQueue(t, QueueParams{})
+	defer teardown()
+	assert.Equal(t, queueMaxAttempts, q.MaxAttempts)
+	assert.Equal(t, queueRetryDelay, q.RetryDelay)
+
+	_, err := q.Put(Request{Comment: store.Comment{ID: "c1"}, Event: EventVote}, "d1")
+	require.NoError(t, err)
+	require.NoError(t, q.Close())
+
+	q2, err := NewQueue(testQueueDB, bolt.Options{}, QueueParams{})
+	require.NoError(t, err)
+	defer q2.Close()
+	recs, err := q2.due(time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(recs), "pending request survives restart")
+	assert.Equal(t, EventVote, recs[0].Event)
+
+	_, err = NewQueue("/dev/null/bad.db", bolt.Options{}, QueueParams{})
+	assert.Error(t, err)
+}
+
+func TestQueue_Backoff(t *testing.T) {
+	q := Queue{QueueParams: QueueParams{RetryDelay: time.Second}}
+	assert.Equal(t, time.Second, q.backoff(1))
+	assert.Equal(t, 2*time.Second, q.backoff(2))
+	assert.Equal(t, 8*time.Second, q.backoff(4))
+	assert.Equal(t, queueMaxRetryWait, q.backoff(100))
+}
+
+func prepQueue(t *testing.T, params QueueParams) (q *Queue, teardown func()) {
+	_ = os.Remove(testQueueDB)
+	q, err := NewQueue(testQueueDB, bolt.Options{}, params)
+	require.NoError(t, err)
+	return q, func() {
+		_ = q.Close()
+		_ = os.Remove(testQueueDB)
+	}
+}
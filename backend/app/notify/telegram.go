@@ -85,6 +85,9 @@ func NewTelegram(token, channelID string, timeout time.Duration, api string) (*T
 
 // Send to telegram channel
 func (t *Telegram) Send(ctx context.Context, req Request) error {
+	if event := req.event(); event != EventCreate && event != EventReport { // new comments and reports only
+		return nil
+	}
 	client := http.Client{Timeout: telegramTimeOut}
 	log.Printf("[DEBUG] send telegram notification to %s, comment id %s", t.channelID, req.Comment.ID)
 
@@ -101,6 +104,9 @@ func (t *Telegram) Send(ctx context.Context, req Request) error {
 		t.apiPrefix, t.token, t.channelID)
 
 	msg := fmt.Sprintf("%s\n\n%s\n\n%s", from, req.Comment.Orig, link)
+	if req.Report != nil {
+		msg = fmt.Sprintf("⚠ reported as %s %s\n\n%s", req.Report.Reason, req.Report.Text, msg)
+	}
 	msg = html.UnescapeString(msg)
 	body := struct {
 		Text string `json:"text"`
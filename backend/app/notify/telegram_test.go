@@ -71,6 +71,9 @@ func TestTelegram_Send(t *testing.T) {
 	err = tb.Send(context.TODO(), Request{Comment: c, parent: cp})
 	assert.NoError(t, err)
 
+	err = tb.Send(context.TODO(), Request{Comment: c, Report: &store.Report{Reason: store.ReportSpam}})
+	assert.NoError(t, err)
+
 	tb, err = NewTelegram("non-json-resp", "remark_test", 2*time.Second, ts.URL+"/")
 	assert.Error(t, err, "should failed")
 	err = tb.Send(context.TODO(), Request{Comment: c, parent: cp})
@@ -0,0 +1,272 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/go-pkgz/repeater"
+	"github.com/go-pkgz/repeater/strategy"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// WebhookParams contain settings for webhook notifications
+type WebhookParams struct {
+	URL           string        // webhook url, request body POSTed to
+	Secret        string        // secret of HMAC-SHA256 body signature in X-Remark42-Signature header, not signed if empty
+	Template      string        // go template of request body, WebhookPayload sent as json if empty
+	ContentType   string        // content type of request body
+	Events        []Event       // events to send, all events if empty
+	Timeout       time.Duration // timeout of single request
+	Retries       int           // max number of delivery attempts
+	RetryDelay    time.Duration // delay before the second attempt, doubled for each next one
+	DeadLetterLog string        // file undelivered requests appended to, not logged if empty
+}
+
+// Webhook implements notify.Destination for generic outgoing webhook, like slack, mattermost or discord incoming webhooks
+type Webhook struct {
+	WebhookParams
+	tmpl   *template.Template
+	client http.Client
+	lock   sync.Mutex // serializes writes to dead letter log
+}
+
+// WebhookPayload is the json body of webhook request and the data of user-defined body template
+type WebhookPayload struct {
+	Event     Event          `json:"event"`
+	Link      string         `json:"link"` // link to the comment
+	Comment   store.Comment  `json:"comment"`
+	Parent    *store.Comment `json:"parent,omitempty"` // parent of the new comment
+	Report    *store.Report  `json:"report,omitempty"`
+	Timestamp time.Time      `json:"time"`
+}
+
+// deadLetter is a single record of dead letter log
+type deadLetter struct {
+	Timestamp time.Time `json:"time"`
+	URL       string    `json:"url"`
+	Event     Event     `json:"event"`
+	CommentID string    `json:"comment_id"`
+	Error     string    `json:"error"`
+	Body      string    `json:"body"`
+}
+
+const (
+	webhookTimeOut     = 5 * time.Second
+	webhookRetries     = 5
+	webhookRetryDelay  = time.Second
+	webhookContentType = "application/json"
+	webhookSignature   = "X-Remark42-Signature"
+	webhookEvent       = "X-Remark42-Event"
+)
+
+// errWebhookRejected returned for 4xx responses, such requests are not retried
+var errWebhookRejected = errors.New("webhook rejected request")
+
+// NewWebhook makes webhook destination, returns error in case of template parsing error
+func NewWebhook(params WebhookParams) (*Webhook, error) {
+	if params.URL == "" {
+		return nil, errors.New("webhook url required")
+	}
+	res := Webhook{WebhookParams: params}
+	if res.Timeout <= 0 {
+		res.Timeout = webhookTimeOut
+	}
+	if res.Retries <= 0 {
+		res.Retries = webhookRetries
+	}
+	if res.RetryDelay <= 0 {
+		res.RetryDelay = webhookRetryDelay
+	}
+	if res.ContentType == "" {
+		res.ContentType = webhookContentType
+	}
+	res.client = http.Client{Timeout: res.Timeout}
+
+	if res.Template != "" {
+		funcs := template.FuncMap{
+			// json makes quoted and escaped json value, i.e. {"text": {{json .Comment.Orig}}}
+			"json": func(v interface{}) (string, error) {
+				buf := bytes.Buffer{}
+				enc := json.NewEncoder(&buf)
+				enc.SetEscapeHTML(false) // keep <url|text> links of slack and mattermost readable
+				err := enc.Encode(v)
+				return strings.TrimSuffix(buf.String(), "\n"), err
+			},
+		}
+		tmpl, err := template.New("webhook").Funcs(funcs).Parse(res.Template)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't parse webhook template")
+		}
+		res.tmpl = tmpl
+	}
+
+	log.Printf("[DEBUG] create new webhook notifier for %s, events=%v, timeout=%s, retries=%d",
+		res.URL, res.Events, res.Timeout, res.Retries)
+	return &res, nil
+}
+
+// Send request to webhook, retries with exponential backoff and logs undelivered request to dead letter log.
+// Thread safe
+func (w *Webhook) Send(ctx context.Context, req Request) error {
+	event := req.event()
+	if !w.accepts(event) {
+		return nil
+	}
+
+	body, err := w.buildBody(req)
+	if err != nil {
+		return errors.Wrapf(err, "can't make webhook body for comment %s", req.Comment.ID)
+	}
+
+	log.Printf("[DEBUG] send webhook notification to %s, event %s, comment id %s", w.URL, event, req.Comment.ID)
+	backoff := &strategy.Backoff{Duration: w.RetryDelay, Repeats: w.Retries, Factor: 2}
+	err = repeater.New(backoff).Do(ctx, func() error { return w.post(ctx, event, body) }, errWebhookRejected)
+	if err != nil {
+		w.logDeadLetter(event, req.Comment.ID, body, err)
+		return errors.Wrapf(err, "can't send webhook notification for comment %s", req.Comment.ID)
+	}
+	return nil
+}
+
+// SendVerification is not implemented for webhook
+func (w *Webhook) SendVerification(_ context.Context, _ VerificationRequest) error {
+	return nil
+}
+
+func (w *Webhook) String() string {
+	return "webhook: " + w.URL
+}
+
+// accepts checks if event should be sent to webhook
+func (w *Webhook) accepts(event Event) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// buildBody makes request body with user-defined template or as json of WebhookPayload
+func (w *Webhook) buildBody(req Request) ([]byte, error) {
+	payload := WebhookPayload{
+		Event:     req.event(),
+		Link:      req.Comment.Locator.URL + uiNav + req.Comment.ID,
+		Comment:   safeComment(req.Comment),
+		Report:    req.Report,
+		Timestamp: time.Now(),
+	}
+	if req.parent.ID != "" {
+		parent := safeComment(req.parent)
+		payload.Parent = &parent
+	}
+
+	if w.tmpl == nil {
+		return json.Marshal(payload)
+	}
+	buf := bytes.Buffer{}
+	if err := w.tmpl.Execute(&buf, payload); err != nil {
+		return nil, errors.Wrap(err, "can't execute webhook template")
+	}
+	return buf.Bytes(), nil
+}
+
+// post makes single attempt to deliver body
+func (w *Webhook) post(ctx context.Context, event Event, body []byte) error {
+	r, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to make webhook request")
+	}
+	r.Header.Set("Content-Type", w.ContentType)
+	r.Header.Set(webhookEvent, string(event))
+	if w.Secret != "" {
+		r.Header.Set(webhookSignature, "sha256="+sign(body, w.Secret))
+	}
+
+	resp, err := w.client.Do(r.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to get webhook response")
+	}
+	defer func() {
+		// drain body to reuse connection
+		if _, err = io.Copy(ioutil.Discard, resp.Body); err != nil {
+			log.Printf("[WARN] can't read webhook response body, %s", err)
+		}
+		if err = resp.Body.Close(); err != nil {
+			log.Printf("[WARN] can't close webhook response body, %s", err)
+		}
+	}()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		log.Printf("[WARN] webhook %s rejected request with status code %d", w.URL, resp.StatusCode)
+		return errWebhookRejected
+	}
+	return errors.Errorf("unexpected webhook status code %d", resp.StatusCode)
+}
+
+// logDeadLetter appends undelivered request to dead letter log as a single json line
+func (w *Webhook) logDeadLetter(event Event, commentID string, body []byte, sendErr error) {
+	if w.DeadLetterLog == "" {
+		return
+	}
+	rec, err := json.Marshal(deadLetter{Timestamp: time.Now(), URL: w.URL, Event: event, CommentID: commentID,
+		Error: sendErr.Error(), Body: string(body)})
+	if err != nil {
+		log.Printf("[WARN] can't marshal dead letter for comment %s, %v", commentID, err)
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	fh, err := os.OpenFile(w.DeadLetterLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		log.Printf("[WARN] can't open dead letter log %s, %v", w.DeadLetterLog, err)
+		return
+	}
+	if _, err = fmt.Fprintf(fh, "%s\n", rec); err != nil {
+		log.Printf("[WARN] can't write dead letter log %s, %v", w.DeadLetterLog, err)
+	}
+	if err = fh.Close(); err != nil {
+		log.Printf("[WARN] can't close dead letter log %s, %v", w.DeadLetterLog, err)
+	}
+}
+
+// sign makes hex-encoded HMAC-SHA256 of body
+func sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// safeComment drops user's ip, votes and reactions of the comment sent to external service
+func safeComment(c store.Comment) store.Comment {
+	c.User.IP = ""
+	c.Votes = nil
+	c.VotedIPs = nil
+	c.ReactedBy = nil
+	c.Spam = nil
+	return c
+}
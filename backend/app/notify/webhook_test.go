@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+func TestWebhook_New(t *testing.T) {
+	wh, err := NewWebhook(WebhookParams{URL: "http://example.com/hook"})
+	require.NoError(t, err)
+	assert.Equal(t, webhookTimeOut, wh.Timeout)
+	assert.Equal(t, webhookRetries, wh.Retries)
+	assert.Equal(t, webhookRetryDelay, wh.RetryDelay)
+	assert.Equal(t, "application/json", wh.ContentType)
+	assert.Equal(t, "webhook: http://example.com/hook", wh.String())
+	assert.NoError(t, wh.SendVerification(context.Background(), VerificationRequest{}))
+
+	_, err = NewWebhook(WebhookParams{})
+	assert.EqualError(t, err, "webhook url required")
+	_, err = NewWebhook(WebhookParams{URL: "http://example.com/hook", Template: "{{.Comment"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't parse webhook template")
+}
+
+func TestWebhook_SendJSON(t *testing.T) {
+	var received []*http.Request
+	var bodies [][]byte
+	lock := sync.Mutex{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		lock.Lock()
+		received, bodies = append(received, r), append(bodies, body)
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	wh, err := NewWebhook(WebhookParams{URL: ts.URL, Secret: "secret123"})
+	require.NoError(t, err)
+
+	loc := store.Locator{SiteID: "remark", URL: "https://example.com/post"}
+	req := Request{
+		Comment: store.Comment{ID: "c1", ParentID: "p1", Locator: loc, Text: "some text", Score: 2,
+			User: store.User{ID: "u1", Name: "user1", IP: "127.0.0.1"}, Votes: map[string]bool{"u2": true}},
+		parent: store.Comment{ID: "p1", Locator: loc, Text: "parent text", User: store.User{ID: "u2", Name: "user2"}},
+	}
+	require.NoError(t, wh.Send(context.Background(), req))
+	require.Equal(t, 1, len(received))
+	assert.Equal(t, "application/json", received[0].Header.Get("Content-Type"))
+	assert.Equal(t, "create", received[0].Header.Get("X-Remark42-Event"))
+	mac := hmac.New(sha256.New, []byte("secret123"))
+	_, _ = mac.Write(bodies[0])
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), received[0].Header.Get("X-Remark42-Signature"))
+
+	payload := WebhookPayload{}
+	require.NoError(t, json.Unmarshal(bodies[0], &payload))
+	assert.Equal(t, EventCreate, payload.Event)
+	assert.Equal(t, "https://example.com/post#remark42__comment-c1", payload.Link)
+	assert.Equal(t, "some text", payload.Comment.Text)
+	assert.Equal(t, "", payload.Comment.User.IP, "ip not sent")
+	assert.Nil(t, payload.Comment.Votes, "votes not sent")
+	require.NotNil(t, payload.Parent)
+	assert.Equal(t, "parent text", payload.Parent.Text)
+
+	req.Event = EventVote
+	require.NoError(t, wh.Send(context.Background(), req))
+	require.Equal(t, 2, len(received))
+	assert.Equal(t, "vote", received[1].Header.Get("X-Remark42-Event"))
+
+	wh.Events = []Event{EventCreate, EventDelete}
+	require.NoError(t, wh.Send(context.Background(), req))
+	assert.Equal(t, 2, len(received), "vote event filtered")
+}
+
+func TestWebhook_SendTemplate(t *testing.T) {
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "", r.Header.Get("X-Remark42-Signature"), "no signature without secret")
+	}))
+	defer ts.Close()
+
+	wh, err := NewWebhook(WebhookParams{URL: ts.URL,
+		Template: `{"text": {{json (printf "%s %sd comment: %s <%s>" .Comment.User.Name .Event .Comment.Orig .Link)}}}`})
+	require.NoError(t, err)
+	req := Request{Comment: store.Comment{ID: "c1", Orig: `text with "quotes"`, User: store.User{Name: "user1"},
+		Locator: store.Locator{SiteID: "remark", URL: "https://example.com/post"}}, Event: EventUpdate}
+	require.NoError(t, wh.Send(context.Background(), req))
+	assert.Equal(t, `{"text": "user1 updated comment: text with \"quotes\" <https://example.com/post#remark42__comment-c1>"}`,
+		string(body))
+
+	wh, err = NewWebhook(WebhookParams{URL: ts.URL, Template: `{{.Comment.NoSuchField}}`})
+	require.NoError(t, err)
+	err = wh.Send(context.Background(), req)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't execute webhook template")
+}
+
+func TestWebhook_Retries(t *testing.T) {
+	deadLetterLog := "/tmp/test-remark-webhook-dead-letter.log"
+	_ = os.Remove(deadLetterLog)
+	defer os.Remove(deadLetterLog)
+
+	var attempts int
+	status := http.StatusBadGateway
+	lock := sync.Mutex{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(status)
+		}
+	}))
+	defer ts.Close()
+
+	wh, err := NewWebhook(WebhookParams{URL: ts.URL, Retries: 3, RetryDelay: 10 * time.Millisecond, DeadLetterLog: deadLetterLog})
+	require.NoError(t, err)
+	req := Request{Comment: store.Comment{ID: "c1"}, Event: EventDelete}
+
+	st := time.Now()
+	require.NoError(t, wh.Send(context.Background(), req))
+	assert.Equal(t, 3, attempts, "delivered on the third attempt")
+	assert.True(t, time.Since(st) >= 30*time.Millisecond, "backoff 10ms and 20ms")
+	_, err = os.Stat(deadLetterLog)
+	assert.True(t, os.IsNotExist(err), "nothing in dead letter log")
+
+	attempts = -10
+	err = wh.Send(context.Background(), req)
+	require.Error(t, err)
+	assert.Equal(t, -7, attempts, "gave up after three attempts")
+
+	attempts, status = 0, http.StatusBadRequest
+	err = wh.Send(context.Background(), req)
+	assert.EqualError(t, err, "can't send webhook notification for comment c1: webhook rejected request")
+	assert.Equal(t, 1, attempts, "rejected request not retried")
+
+	data, err := ioutil.ReadFile(deadLetterLog)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Equal(t, 2, len(lines), "two undelivered requests")
+	rec := deadLetter{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &rec))
+	assert.Equal(t, ts.URL, rec.URL)
+	assert.Equal(t, EventDelete, rec.Event)
+	assert.Equal(t, "c1", rec.CommentID)
+	assert.Equal(t, "webhook rejected request", rec.Error)
+	assert.Contains(t, rec.Body, `"event":"delete"`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, wh.Send(ctx, req), "canceled context")
+}
@@ -0,0 +1,339 @@
+// Package replica keeps local store of read-only replica in sync with primary remark42 instance.
+// Replica pulls change log of each site from admin api of primary, applies changes to local engine
+// and makes full resync from native export of primary on the first start or if the log has a gap,
+// i.e. entries replica didn't get were dropped by retention on primary.
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// pageSize is number of change log entries requested at once, max allowed by primary
+const pageSize = 1000
+
+// Importer replaces all comments of the site with imported ones, implemented by migrator.Native
+type Importer interface {
+	Import(reader io.Reader, siteID string) (int, error)
+}
+
+// Replica follows primary instance, all sites synced on each interval tick
+type Replica struct {
+	Primary     string              // root url of primary instance
+	AdminPasswd string              // admin basic auth password of primary
+	Sites       []string            // sites to replicate
+	Engine      engine.Interface    // local store
+	Importer    Importer            // used for full resync
+	Flush       func(siteID string) // evicts cached responses of the site after changes applied, optional
+	Interval    time.Duration
+	StateFile   string // keeps applied sequence numbers between restarts, each start makes full resync if not set
+	Client      http.Client
+
+	lock   sync.RWMutex
+	status map[string]SiteStatus
+}
+
+// SiteStatus shows how far replica of the site is behind primary
+type SiteStatus struct {
+	SiteID  string    `json:"site"`
+	Seq     uint64    `json:"seq"`             // the last applied sequence number of change log of primary
+	Synced  time.Time `json:"synced"`          // the last time replica caught up with primary
+	Lag     float64   `json:"lag"`             // seconds since the last catch up
+	Resyncs int       `json:"resyncs"`         // number of full resyncs made
+	Error   string    `json:"error,omitempty"` // the last error, cleared on successful sync
+	loaded  bool      // sequence number known, from state file or full resync
+}
+
+// Run syncs all sites every interval until context canceled
+func (r *Replica) Run(ctx context.Context) {
+	log.Printf("[INFO] start replica of %s, sites %v, interval %v", r.Primary, r.Sites, r.Interval)
+	if err := r.loadState(); err != nil {
+		log.Printf("[WARN] can't load replica state, full resync required, %v", err)
+	}
+	for {
+		for _, siteID := range r.Sites {
+			if err := r.Sync(ctx, siteID); err != nil {
+				log.Printf("[WARN] failed to sync %s, %v", siteID, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("[INFO] replica terminated, %v", ctx.Err())
+			return
+		case <-time.After(r.Interval):
+		}
+	}
+}
+
+// Sync applies all new changes of the site made on primary, makes full resync if needed.
+// Stops at the change failed to apply, so it is retried on the next sync and replica never skips a change
+func (r *Replica) Sync(ctx context.Context, siteID string) (err error) {
+	st := r.Status(siteID)
+	defer func() {
+		if err != nil {
+			st.Error = err.Error()
+		}
+		r.setStatus(st)
+	}()
+
+	if !st.loaded {
+		if err = r.resync(ctx, &st); err != nil {
+			return err
+		}
+	}
+
+	for {
+		changes, e := r.changes(ctx, siteID, st.Seq)
+		if e != nil {
+			return e
+		}
+		if len(changes) > 0 && changes[0].Seq != st.Seq+1 {
+			log.Printf("[WARN] gap in change log of %s, expected %d, got %d", siteID, st.Seq+1, changes[0].Seq)
+			if err = r.resync(ctx, &st); err != nil {
+				return err
+			}
+			continue
+		}
+		applied, applyErr := 0, error(nil)
+		for _, c := range changes {
+			if e := r.apply(c); e != nil {
+				applyErr = errors.Wrapf(e, "can't apply change %d of %s", c.Seq, siteID)
+				break
+			}
+			st.Seq = c.Seq
+			applied++
+		}
+		if applied > 0 {
+			r.flush(siteID)
+			if e := r.saveState(st); e != nil {
+				log.Printf("[WARN] can't save replica state, %v", e)
+			}
+		}
+		if applyErr != nil {
+			return applyErr
+		}
+		if len(changes) < pageSize {
+			st.Synced, st.Error = time.Now(), ""
+			return nil
+		}
+	}
+}
+
+// Status of the replicated site
+func (r *Replica) Status(siteID string) SiteStatus {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	st, ok := r.status[siteID]
+	if !ok {
+		return SiteStatus{SiteID: siteID}
+	}
+	if !st.Synced.IsZero() {
+		st.Lag = time.Since(st.Synced).Seconds()
+	}
+	return st
+}
+
+// Proxy makes handler sending requests to primary
+func (r *Replica) Proxy() (http.Handler, error) {
+	u, err := url.Parse(r.Primary)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't parse primary url %s", r.Primary)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Host = u.Host
+	}
+	return proxy, nil
+}
+
+// resync replaces all comments of the site with export of primary. Head of primary's change log taken before export,
+// so changes made during export applied again on top of it, applying the same change twice makes no difference
+func (r *Replica) resync(ctx context.Context, st *SiteStatus) error {
+	log.Printf("[INFO] full resync of %s from %s", st.SiteID, r.Primary)
+	head, err := r.head(ctx, st.SiteID)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.get(ctx, "export", url.Values{"site": {st.SiteID}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint
+	count, err := r.Importer.Import(resp.Body, st.SiteID)
+	if err != nil {
+		return errors.Wrapf(err, "can't import %s", st.SiteID)
+	}
+	log.Printf("[INFO] resync of %s completed, %d comments, seq %d", st.SiteID, count, head)
+
+	st.Seq, st.loaded = head, true
+	st.Resyncs++
+	r.flush(st.SiteID)
+	return r.saveState(*st)
+}
+
+// apply single change to local engine. Created or updated comment saved as is,
+// so the change applied the second time, i.e. after resync, makes no difference
+func (r *Replica) apply(c engine.Change) error {
+	switch c.Event {
+	case engine.ChangeCreate, engine.ChangeUpdate:
+		if c.Comment == nil {
+			return errors.Errorf("no comment in %s change", c.Event)
+		}
+		if _, err := r.Engine.Get(engine.GetRequest{Locator: c.Comment.Locator, CommentID: c.Comment.ID}); err == nil {
+			return r.Engine.Update(*c.Comment)
+		}
+		_, err := r.Engine.Create(*c.Comment)
+		return err
+	case engine.ChangeDelete:
+		if c.Delete == nil {
+			return errors.New("no request in delete change")
+		}
+		return r.Engine.Delete(*c.Delete)
+	case engine.ChangeFlag:
+		if c.Flag == nil {
+			return errors.New("no request in flag change")
+		}
+		_, err := r.Engine.Flag(*c.Flag)
+		return err
+	case engine.ChangeUserDetail:
+		if c.UserDetail == nil {
+			return errors.New("no request in user detail change")
+		}
+		_, err := r.Engine.UserDetail(*c.UserDetail)
+		return err
+	}
+	return errors.Errorf("unknown change event %q", c.Event)
+}
+
+// changes gets page of change log of the site after sequence number
+func (r *Replica) changes(ctx context.Context, siteID string, since uint64) ([]engine.Change, error) {
+	query := url.Values{"site": {siteID}, "since": {fmt.Sprintf("%d", since)}, "limit": {fmt.Sprintf("%d", pageSize)}}
+	resp, err := r.get(ctx, "changes", query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint
+	changes := []engine.Change{}
+	if err = json.NewDecoder(resp.Body).Decode(&changes); err != nil {
+		return nil, errors.Wrapf(err, "can't decode changes of %s", siteID)
+	}
+	return changes, nil
+}
+
+// head gets sequence number of the last entry of change log of the site
+func (r *Replica) head(ctx context.Context, siteID string) (uint64, error) {
+	resp, err := r.get(ctx, "changes/head", url.Values{"site": {siteID}})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close() // nolint
+	res := struct {
+		Seq uint64 `json:"seq"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return 0, errors.Wrapf(err, "can't decode head of changes of %s", siteID)
+	}
+	return res.Seq, nil
+}
+
+// get makes request to admin api of primary, response with status other than 200 is an error
+func (r *Replica) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := strings.TrimSuffix(r.Primary, "/") + "/api/v1/admin/" + path + "?" + query.Encode()
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't make request to %s", u)
+	}
+	req.SetBasicAuth("admin", r.AdminPasswd)
+	resp, err := r.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "request to %s failed", u)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return nil, errors.Errorf("request to %s failed with %s, %s", u, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (r *Replica) flush(siteID string) {
+	if r.Flush != nil {
+		r.Flush(siteID)
+	}
+}
+
+func (r *Replica) setStatus(st SiteStatus) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.status == nil {
+		r.status = map[string]SiteStatus{}
+	}
+	st.Lag = 0
+	r.status[st.SiteID] = st
+}
+
+// loadState reads applied sequence numbers of all sites from state file
+func (r *Replica) loadState() error {
+	if r.StateFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(r.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "can't read %s", r.StateFile)
+	}
+	state := map[string]uint64{}
+	if err = json.Unmarshal(data, &state); err != nil {
+		return errors.Wrapf(err, "can't unmarshal %s", r.StateFile)
+	}
+	for siteID, seq := range state {
+		r.setStatus(SiteStatus{SiteID: siteID, Seq: seq, loaded: true})
+	}
+	return nil
+}
+
+// saveState writes applied sequence numbers of all sites to state file, with the status of the site updated
+func (r *Replica) saveState(st SiteStatus) error {
+	r.setStatus(st)
+	if r.StateFile == "" {
+		return nil
+	}
+	state := map[string]uint64{}
+	r.lock.RLock()
+	for siteID, s := range r.status {
+		if s.loaded {
+			state[siteID] = s.Seq
+		}
+	}
+	r.lock.RUnlock()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "can't marshal replica state")
+	}
+	// write to temp file and rename, so state file is never partially written
+	tmp := r.StateFile + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return errors.Wrapf(err, "can't write %s", tmp)
+	}
+	return errors.Wrapf(os.Rename(tmp, r.StateFile), "can't rename %s", tmp)
+}
@@ -0,0 +1,300 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/migrator"
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/service"
+)
+
+func TestReplica_Sync(t *testing.T) {
+	primary, ts, teardown := prepPrimary(t)
+	defer teardown()
+	local, r, teardownLocal := prepReplica(t, ts.URL, "")
+	defer teardownLocal()
+
+	flushed := 0
+	r.Flush = func(siteID string) {
+		assert.Equal(t, "radio-t", siteID)
+		flushed++
+	}
+
+	// the first sync makes full resync
+	require.NoError(t, r.Sync(context.Background(), "radio-t"))
+	st := r.Status("radio-t")
+	assert.Equal(t, uint64(2), st.Seq)
+	assert.Equal(t, 1, st.Resyncs)
+	assert.Equal(t, "", st.Error)
+	assert.False(t, st.Synced.IsZero())
+	assert.Equal(t, 1, flushed)
+	assertComments(t, local, "id-1", "id-2")
+
+	// changes applied
+	c := comment(3, "new comment")
+	_, err := primary.Create(c)
+	require.NoError(t, err)
+	c = comment(1, "edited text")
+	require.NoError(t, primary.Update(c))
+	require.NoError(t, primary.Delete(engine.DeleteRequest{Locator: c.Locator, CommentID: "id-2", DeleteMode: store.HardDelete}))
+	_, err = primary.Flag(engine.FlagRequest{Locator: c.Locator, UserID: "user2", Flag: engine.Blocked, Update: engine.FlagTrue})
+	require.NoError(t, err)
+	_, err = primary.UserDetail(engine.UserDetailRequest{Locator: c.Locator, UserID: "user1", Detail: engine.UserEmail, Update: "u1@example.com"})
+	require.NoError(t, err)
+
+	require.NoError(t, r.Sync(context.Background(), "radio-t"))
+	st = r.Status("radio-t")
+	assert.Equal(t, uint64(7), st.Seq)
+	assert.Equal(t, 1, st.Resyncs, "no resync")
+	assert.Equal(t, 2, flushed)
+	assertComments(t, local, "id-1", "id-3")
+	res, err := local.Get(engine.GetRequest{Locator: c.Locator, CommentID: "id-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "edited text", res.Text)
+	blocked, err := local.Flag(engine.FlagRequest{Locator: c.Locator, UserID: "user2", Flag: engine.Blocked})
+	require.NoError(t, err)
+	assert.True(t, blocked)
+	details, err := local.UserDetail(engine.UserDetailRequest{Locator: c.Locator, UserID: "user1", Detail: engine.UserEmail})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(details))
+	assert.Equal(t, "u1@example.com", details[0].Email)
+
+	// nothing changed
+	require.NoError(t, r.Sync(context.Background(), "radio-t"))
+	assert.Equal(t, 2, flushed, "not flushed without changes")
+
+	// gap in change log, entries 8 and 9 dropped on primary
+	primary.ChangesRetention.MaxCount = 1
+	for n := 4; n <= 6; n++ {
+		_, err = primary.Create(comment(n, "some text"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, r.Sync(context.Background(), "radio-t"))
+	st = r.Status("radio-t")
+	assert.Equal(t, uint64(10), st.Seq)
+	assert.Equal(t, 2, st.Resyncs, "resync on gap")
+	assertComments(t, local, "id-1", "id-3", "id-4", "id-5", "id-6")
+}
+
+func TestReplica_SyncFailed(t *testing.T) {
+	_, ts, teardown := prepPrimary(t)
+	defer teardown()
+	_, r, teardownLocal := prepReplica(t, ts.URL, "")
+	defer teardownLocal()
+
+	r.AdminPasswd = "bad"
+	err := r.Sync(context.Background(), "radio-t")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401 Unauthorized")
+	st := r.Status("radio-t")
+	assert.Contains(t, st.Error, "401 Unauthorized")
+	assert.Equal(t, 0, st.Resyncs)
+
+	r.AdminPasswd = "password"
+	require.NoError(t, r.Sync(context.Background(), "radio-t"))
+	assert.Equal(t, "", r.Status("radio-t").Error, "error cleared")
+}
+
+func TestReplica_SyncApplyFailed(t *testing.T) {
+	bad := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v1/admin/changes", r.URL.Path)
+		c3, c5 := comment(3, "text 3"), comment(5, "text 5")
+		changes := []engine.Change{{Seq: 3, Event: engine.ChangeCreate, Comment: &c3},
+			{Seq: 4, Event: engine.ChangeCreate}, {Seq: 5, Event: engine.ChangeCreate, Comment: &c5}}
+		if !bad {
+			c4 := comment(4, "text 4")
+			changes[1].Comment = &c4
+		}
+		since, err := strconv.Atoi(r.URL.Query().Get("since"))
+		require.NoError(t, err)
+		require.NoError(t, json.NewEncoder(w).Encode(changes[since-2:]))
+	}))
+	defer ts.Close()
+	local, r, teardownLocal := prepReplica(t, ts.URL, "")
+	defer teardownLocal()
+	r.setStatus(SiteStatus{SiteID: "radio-t", Seq: 2, loaded: true})
+
+	err := r.Sync(context.Background(), "radio-t")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't apply change 4 of radio-t")
+	st := r.Status("radio-t")
+	assert.Equal(t, uint64(3), st.Seq, "stopped before failed change")
+	assert.Contains(t, st.Error, "can't apply change 4")
+	assertComments(t, local, "id-3")
+
+	bad = false
+	require.NoError(t, r.Sync(context.Background(), "radio-t"))
+	st = r.Status("radio-t")
+	assert.Equal(t, uint64(5), st.Seq, "failed change retried")
+	assert.Equal(t, "", st.Error)
+	assertComments(t, local, "id-3", "id-4", "id-5")
+}
+
+func TestReplica_State(t *testing.T) {
+	primary, ts, teardown := prepPrimary(t)
+	defer teardown()
+	stateFile := os.TempDir() + "/test-remark-replica-state.json"
+	defer os.Remove(stateFile)
+	_ = os.Remove(stateFile)
+
+	local, r, teardownLocal := prepReplica(t, ts.URL, stateFile)
+	defer teardownLocal()
+	require.NoError(t, r.loadState(), "no state file")
+	require.NoError(t, r.Sync(context.Background(), "radio-t"))
+	data, err := ioutil.ReadFile(stateFile)
+	require.NoError(t, err)
+	assert.Equal(t, `{"radio-t":2}`, string(data))
+
+	_, err = primary.Create(comment(3, "new comment"))
+	require.NoError(t, err)
+
+	// restarted replica continues from the saved sequence number
+	r2 := &Replica{Primary: ts.URL, AdminPasswd: "password", Sites: []string{"radio-t"}, Engine: local,
+		Importer: r.Importer, StateFile: stateFile}
+	require.NoError(t, r2.loadState())
+	require.NoError(t, r2.Sync(context.Background(), "radio-t"))
+	st := r2.Status("radio-t")
+	assert.Equal(t, uint64(3), st.Seq)
+	assert.Equal(t, 0, st.Resyncs)
+	assertComments(t, local, "id-1", "id-2", "id-3")
+
+	require.NoError(t, ioutil.WriteFile(stateFile, []byte("bad"), 0600))
+	assert.Error(t, r2.loadState())
+}
+
+func TestReplica_Run(t *testing.T) {
+	_, ts, teardown := prepPrimary(t)
+	defer teardown()
+	local, r, teardownLocal := prepReplica(t, ts.URL, "")
+	defer teardownLocal()
+	r.Interval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	r.Run(ctx)
+	assert.Equal(t, uint64(2), r.Status("radio-t").Seq)
+	assert.Equal(t, 1, r.Status("radio-t").Resyncs)
+	assertComments(t, local, "id-1", "id-2")
+}
+
+func TestReplica_Proxy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/comment", r.URL.Path)
+		assert.Equal(t, "site=radio-t", r.URL.RawQuery)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	r := Replica{Primary: ts.URL}
+	proxy, err := r.Proxy()
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "http://replica.example.com/api/v1/comment?site=radio-t", nil)
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	r = Replica{Primary: "bad url\x7f"}
+	_, err = r.Proxy()
+	assert.Error(t, err)
+}
+
+// prepPrimary makes store of primary with two comments and server of its admin api
+func prepPrimary(t *testing.T) (eng *engine.BoltDB, ts *httptest.Server, teardown func()) {
+	dbFile := os.TempDir() + "/test-remark-replica-primary.db"
+	_ = os.Remove(dbFile)
+	eng, err := engine.NewBoltDB(bolt.Options{}, engine.BoltSite{FileName: dbFile, SiteID: "radio-t"})
+	require.NoError(t, err)
+	for _, c := range []store.Comment{comment(1, "some text"), comment(2, "some text 2")} {
+		_, err = eng.Create(c)
+		require.NoError(t, err)
+	}
+	dataStore := &service.DataStore{Engine: eng, AdminStore: admin.NewStaticStore("secret", nil, nil, "")}
+	exporter := &migrator.Native{DataStore: dataStore}
+
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, passwd, ok := r.BasicAuth(); !ok || user != "admin" || passwd != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case "/api/v1/admin/changes":
+			since, err := strconv.ParseUint(query.Get("since"), 10, 64)
+			require.NoError(t, err)
+			limit, err := strconv.Atoi(query.Get("limit"))
+			require.NoError(t, err)
+			changes, err := eng.Changes(engine.ChangesRequest{Locator: store.Locator{SiteID: query.Get("site")}, Since: since, Limit: limit})
+			require.NoError(t, err)
+			require.NoError(t, json.NewEncoder(w).Encode(changes))
+		case "/api/v1/admin/changes/head":
+			changes, err := eng.Changes(engine.ChangesRequest{Locator: store.Locator{SiteID: query.Get("site")}, Last: true})
+			require.NoError(t, err)
+			res := map[string]uint64{"seq": 0}
+			if len(changes) > 0 {
+				res["seq"] = changes[0].Seq
+			}
+			require.NoError(t, json.NewEncoder(w).Encode(res))
+		case "/api/v1/admin/export":
+			_, err := exporter.Export(w, query.Get("site"))
+			require.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return eng, ts, func() {
+		ts.Close()
+		require.NoError(t, eng.Close())
+		_ = os.Remove(dbFile)
+	}
+}
+
+// prepReplica makes empty local store and replica of primary
+func prepReplica(t *testing.T, primaryURL, stateFile string) (eng *engine.BoltDB, r *Replica, teardown func()) {
+	dbFile := os.TempDir() + "/test-remark-replica-local.db"
+	_ = os.Remove(dbFile)
+	eng, err := engine.NewBoltDB(bolt.Options{}, engine.BoltSite{FileName: dbFile, SiteID: "radio-t"})
+	require.NoError(t, err)
+	dataStore := &service.DataStore{Engine: eng, AdminStore: admin.NewStaticStore("secret", nil, nil, "")}
+
+	r = &Replica{Primary: primaryURL, AdminPasswd: "password", Sites: []string{"radio-t"}, Engine: eng,
+		Importer: &migrator.Native{DataStore: dataStore}, Interval: time.Second, StateFile: stateFile}
+	return eng, r, func() {
+		require.NoError(t, eng.Close())
+		_ = os.Remove(dbFile)
+	}
+}
+
+func comment(n int, text string) store.Comment {
+	return store.Comment{ID: fmt.Sprintf("id-%d", n), Text: text, Timestamp: time.Date(2020, 5, 10, 15, n, 0, 0, time.UTC),
+		Locator: store.Locator{URL: "https://radio-t.com/p/1", SiteID: "radio-t"}, User: store.User{ID: "user1", Name: "user name"}}
+}
+
+// assertComments checks ids of all not deleted comments of the post in local store
+func assertComments(t *testing.T, eng engine.Interface, ids ...string) {
+	comments, err := eng.Find(engine.FindRequest{Locator: store.Locator{URL: "https://radio-t.com/p/1", SiteID: "radio-t"}, Sort: "+time"})
+	require.NoError(t, err)
+	res := []string{}
+	for _, c := range comments {
+		if !c.Deleted {
+			res = append(res, c.ID)
+		}
+	}
+	assert.Equal(t, ids, res)
+}
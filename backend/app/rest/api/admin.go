@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"path"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -13,9 +14,13 @@ import (
 	log "github.com/go-pkgz/lgr"
 	R "github.com/go-pkgz/rest"
 
+	"github.com/umputun/remark42/backend/app/notify"
 	"github.com/umputun/remark42/backend/app/rest"
 	"github.com/umputun/remark42/backend/app/store"
+	adminstore "github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/audit"
 	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/service"
 )
 
 // admin provides router for all requests available for admin users only
@@ -25,8 +30,22 @@ type admin struct {
 	authenticator *auth.Service
 	readOnlyAge   int
 	migrator      *Migrator
+	notifyService *notify.Service
+	auditStore    audit.Store
+	siteManager   SiteManager
 }
 
+// SiteManager creates, disables, renames and deletes sites at runtime
+type SiteManager interface {
+	List() []adminstore.Site
+	Create(siteID string) error
+	SetEnabled(siteID string, enabled bool) error
+	Rename(siteID, newID string) error
+	Delete(siteID string) error
+}
+
+var errSitesDisabled = errors.New("sites management disabled")
+
 type adminStore interface {
 	Delete(locator store.Locator, commentID string, mode store.DeleteMode) error
 	DeleteUser(siteID string, userID string, mode store.DeleteMode) error
@@ -35,11 +54,25 @@ type adminStore interface {
 	IsBlocked(siteID string, userID string) bool
 	SetBlock(siteID string, userID string, status bool, ttl time.Duration) error
 	BlockedUsers(siteID string) ([]store.BlockedUser, error)
+	IsShadowBlocked(siteID string, userID string) bool
+	SetShadowBlock(siteID string, userID string, status bool, ttl time.Duration) error
+	ShadowBlockedUsers(siteID string) ([]store.BlockedUser, error)
 	Info(locator store.Locator, readonlyAge int) (store.PostInfo, error)
+	SiteOptions(siteID string, global adminstore.SiteOptions) adminstore.SiteOptions
+	Settings(siteID string) (adminstore.Settings, error)
+	SetSettings(siteID string, settings adminstore.Settings) error
 	SetTitle(locator store.Locator, commentID string) (comment store.Comment, err error)
 	SetVerified(siteID string, userID string, status bool) error
 	SetReadOnly(locator store.Locator, status bool) error
 	SetPin(locator store.Locator, commentID string, status bool) error
+	Pending(siteID string, limit, skip int) ([]store.Comment, error)
+	Approve(locator store.Locator, commentID string) (store.Comment, error)
+	Reject(locator store.Locator, commentID string) error
+	Reported(siteID string, limit, skip int) ([]service.ReportedComment, error)
+	DismissReports(locator store.Locator, commentID string) error
+	Changes(siteID string, since uint64, limit int) ([]engine.Change, error)
+	ChangesHead(siteID string) (uint64, error)
+	ApplyRetention(siteID string, dry bool) (service.RetentionReport, error)
 }
 
 // DELETE /comment/{id}?site=siteID&url=post-url - removes comment
@@ -55,6 +88,10 @@ func (a *admin) deleteCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.SiteID, locator.URL, lastCommentsScope))
+	if a.notifyService != nil {
+		a.notifyService.Submit(notify.Request{Comment: store.Comment{ID: id, Locator: locator}, Event: notify.EventDelete})
+	}
+	addAudit(a.auditStore, r, audit.Entry{Action: audit.ActionDelete, CommentID: id, URL: locator.URL})
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, R.JSON{"id": id, "locator": locator})
 }
@@ -71,6 +108,7 @@ func (a *admin) deleteUserCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	a.cache.Flush(cache.Flusher(siteID).Scopes(userID, siteID, lastCommentsScope))
+	addAudit(a.auditStore, r, audit.Entry{Action: audit.ActionDeleteUser, UserID: userID})
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, R.JSON{"user_id": userID, "site_id": siteID})
 }
@@ -131,15 +169,24 @@ func (a *admin) deleteMeRequestCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 
 	a.cache.Flush(cache.Flusher(claims.Audience).Scopes(claims.Audience, claims.User.ID, lastCommentsScope))
+	if a.auditStore != nil {
+		entry := audit.Entry{SiteID: claims.Audience, Action: audit.ActionDeleteMe, UserID: claims.User.ID,
+			Actor: audit.Actor{ID: claims.User.ID, Name: claims.User.Name}}
+		if err = a.auditStore.Add(entry); err != nil {
+			log.Printf("[WARN] can't add audit entry %+v, %v", entry, err)
+		}
+	}
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, R.JSON{"user_id": claims.User.ID, "site_id": claims.Audience})
 }
 
-// PUT /user/{userid}?site=side-id&block=1&ttl=7d - block or unblock user
+// PUT /user/{userid}?site=side-id&block=1&shadow=1&ttl=7d - block or unblock user.
+// Shadow block keeps comments of the user visible to the user and admins only, unblock resets both blocks
 func (a *admin) setBlockCtrl(w http.ResponseWriter, r *http.Request) {
 	userID := chi.URLParam(r, "userid")
 	siteID := r.URL.Query().Get("site")
 	blockStatus := r.URL.Query().Get("block") == "1"
+	shadow := blockStatus && r.URL.Query().Get("shadow") == "1"
 
 	ttl := time.Duration(0) // unlimited duration by default
 	if ttlParam := r.URL.Query().Get("ttl"); ttlParam != "" {
@@ -148,22 +195,36 @@ func (a *admin) setBlockCtrl(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := a.dataService.SetBlock(siteID, userID, blockStatus, ttl); err != nil {
+	// only one block mode active at a time, the other one reset
+	setBlock, resetBlock := a.dataService.SetBlock, a.dataService.SetShadowBlock
+	if shadow {
+		setBlock, resetBlock = a.dataService.SetShadowBlock, a.dataService.SetBlock
+	}
+	if err := setBlock(siteID, userID, blockStatus, ttl); err != nil {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set blocking status", rest.ErrActionRejected)
 		return
 	}
+	if err := resetBlock(siteID, userID, false, 0); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't reset blocking status", rest.ErrActionRejected)
+		return
+	}
 
-	// delete comments for permanently blocked user.
-	if blockStatus && ttl == time.Duration(0) {
+	// delete comments for permanently blocked user, comments of shadow blocked user kept
+	if blockStatus && !shadow && ttl == time.Duration(0) {
 		if err := a.dataService.DeleteUser(siteID, userID, store.SoftDelete); err != nil {
 			log.Printf("[WARN] can't delete comments for blocked user %s on site %s, %v", userID, siteID, err)
 		}
 	}
 	a.cache.Flush(cache.Flusher(siteID).Scopes(userID, siteID, lastCommentsScope))
-	render.JSON(w, r, R.JSON{"user_id": userID, "site_id": siteID, "block": blockStatus})
+	params := map[string]string{"block": strconv.FormatBool(blockStatus), "ttl": ttl.String()}
+	if shadow {
+		params["shadow"] = "true"
+	}
+	addAudit(a.auditStore, r, audit.Entry{Action: audit.ActionBlock, UserID: userID, Params: params})
+	render.JSON(w, r, R.JSON{"user_id": userID, "site_id": siteID, "block": blockStatus, "shadow": shadow})
 }
 
-// GET /blocked?site=siteID - list blocked users
+// GET /blocked?site=siteID - list blocked users, shadow blocked users included with shadow mark
 func (a *admin) blockedUsersCtrl(w http.ResponseWriter, r *http.Request) {
 	siteID := r.URL.Query().Get("site")
 	users, err := a.dataService.BlockedUsers(siteID)
@@ -171,6 +232,12 @@ func (a *admin) blockedUsersCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get blocked users", rest.ErrSiteNotFound)
 		return
 	}
+	shadowBlocked, err := a.dataService.ShadowBlockedUsers(siteID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get shadow blocked users", rest.ErrSiteNotFound)
+		return
+	}
+	users = append(users, shadowBlocked...)
 	render.JSON(w, r, users)
 }
 
@@ -178,15 +245,16 @@ func (a *admin) blockedUsersCtrl(w http.ResponseWriter, r *http.Request) {
 func (a *admin) setReadOnlyCtrl(w http.ResponseWriter, r *http.Request) {
 	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
 	roStatus := r.URL.Query().Get("ro") == "1"
+	readOnlyAge := a.dataService.SiteOptions(locator.SiteID, adminstore.SiteOptions{ReadOnlyAge: a.readOnlyAge}).ReadOnlyAge
 
 	isRoByAge := func(info store.PostInfo) bool {
-		return a.readOnlyAge > 0 && !info.FirstTS.IsZero() &&
-			info.FirstTS.AddDate(0, 0, a.readOnlyAge).Before(time.Now())
+		return readOnlyAge > 0 && !info.FirstTS.IsZero() &&
+			info.FirstTS.AddDate(0, 0, readOnlyAge).Before(time.Now())
 	}
 
 	// don't allow to reset ro for posts turned to ro by ReadOnlyAge
 	if !roStatus {
-		if info, e := a.dataService.Info(locator, a.readOnlyAge); e == nil && isRoByAge(info) {
+		if info, e := a.dataService.Info(locator, readOnlyAge); e == nil && isRoByAge(info) {
 			rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("rejected"),
 				"read-only due the age", rest.ErrActionRejected)
 			return
@@ -198,6 +266,8 @@ func (a *admin) setReadOnlyCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL, locator.SiteID))
+	addAudit(a.auditStore, r, audit.Entry{Action: audit.ActionReadOnly, URL: locator.URL,
+		Params: map[string]string{"ro": strconv.FormatBool(roStatus)}})
 	render.JSON(w, r, R.JSON{"locator": locator, "read-only": roStatus})
 }
 
@@ -214,6 +284,8 @@ func (a *admin) setTitleCtrl(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[INFO] set comment's title %s to %q", id, c.PostTitle)
 
 	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL, lastCommentsScope))
+	addAudit(a.auditStore, r, audit.Entry{Action: audit.ActionTitle, CommentID: id, URL: locator.URL,
+		Params: map[string]string{"title": c.PostTitle}})
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, R.JSON{"id": id, "locator": locator})
 }
@@ -229,6 +301,8 @@ func (a *admin) setVerifyCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	a.cache.Flush(cache.Flusher(siteID).Scopes(siteID, userID))
+	addAudit(a.auditStore, r, audit.Entry{Action: audit.ActionVerify, UserID: userID,
+		Params: map[string]string{"verified": strconv.FormatBool(verifyStatus)}})
 	render.JSON(w, r, R.JSON{"user": userID, "verified": verifyStatus})
 }
 
@@ -244,5 +318,345 @@ func (a *admin) setPinCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL))
+	addAudit(a.auditStore, r, audit.Entry{Action: audit.ActionPin, CommentID: commentID, URL: locator.URL,
+		Params: map[string]string{"pin": strconv.FormatBool(pinStatus)}})
 	render.JSON(w, r, R.JSON{"id": commentID, "locator": locator, "pin": pinStatus})
 }
+
+// GET /pending?site=siteID&limit=100&skip=10 - list comments waiting for approval, oldest first
+func (a *admin) pendingCommentsCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil {
+		limit = 0
+	}
+	skip, err := strconv.Atoi(r.URL.Query().Get("skip"))
+	if err != nil {
+		skip = 0
+	}
+
+	comments, err := a.dataService.Pending(siteID, limit, skip)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get pending comments", rest.ErrSiteNotFound)
+		return
+	}
+	render.JSON(w, r, comments)
+}
+
+// PUT /approve/{id}?site=siteID&url=post-url - publish pending comment and notify subscribers
+func (a *admin) approveCommentCtrl(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	log.Printf("[INFO] approve comment %s", id)
+
+	comment, err := a.dataService.Approve(locator, id)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't approve comment", rest.ErrActionRejected)
+		return
+	}
+	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.SiteID, locator.URL, comment.User.ID, lastCommentsScope))
+
+	if a.notifyService != nil && !a.dataService.IsShadowBlocked(locator.SiteID, comment.User.ID) {
+		a.notifyService.Submit(notify.Request{Comment: comment})
+	}
+	addAudit(a.auditStore, r, audit.Entry{Action: audit.ActionApprove, CommentID: id, URL: locator.URL})
+	render.JSON(w, r, R.JSON{"id": id, "locator": locator, "approved": true})
+}
+
+// PUT /reject/{id}?site=siteID&url=post-url - delete pending comment
+func (a *admin) rejectCommentCtrl(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	log.Printf("[INFO] reject comment %s", id)
+
+	if err := a.dataService.Reject(locator, id); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't reject comment", rest.ErrActionRejected)
+		return
+	}
+	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.SiteID, locator.URL, lastCommentsScope))
+	addAudit(a.auditStore, r, audit.Entry{Action: audit.ActionReject, CommentID: id, URL: locator.URL})
+	render.JSON(w, r, R.JSON{"id": id, "locator": locator, "approved": false})
+}
+
+// GET /reports?site=siteID&limit=100&skip=10 - list reported comments with reports, the most reported first
+func (a *admin) reportedCommentsCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil {
+		limit = 0
+	}
+	skip, err := strconv.Atoi(r.URL.Query().Get("skip"))
+	if err != nil {
+		skip = 0
+	}
+
+	comments, err := a.dataService.Reported(siteID, limit, skip)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get reported comments", rest.ErrSiteNotFound)
+		return
+	}
+	render.JSON(w, r, comments)
+}
+
+// DELETE /reports/{id}?site=siteID&url=post-url - dismiss all reports of the comment and keep comment as is
+func (a *admin) dismissReportsCtrl(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	log.Printf("[INFO] dismiss reports of comment %s", id)
+
+	if err := a.dataService.DismissReports(locator, id); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't dismiss reports", rest.ErrActionRejected)
+		return
+	}
+	addAudit(a.auditStore, r, audit.Entry{Action: audit.ActionDismiss, CommentID: id, URL: locator.URL})
+	render.JSON(w, r, R.JSON{"id": id, "locator": locator, "dismissed": true})
+}
+
+// GET /notify/queue?site=siteID - number of pending notifications and failed deliveries, the most recent first
+func (a *admin) notifyQueueCtrl(w http.ResponseWriter, r *http.Request) {
+	if a.notifyService == nil {
+		rest.SendErrorJSON(w, r, http.StatusNotImplemented, notify.ErrQueueDisabled, "can't get notification queue", rest.ErrActionRejected)
+		return
+	}
+	stats, err := a.notifyService.QueueStats(r.URL.Query().Get("site"))
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, notify.ErrQueueDisabled) {
+			code = http.StatusNotImplemented
+		}
+		rest.SendErrorJSON(w, r, code, err, "can't get notification queue", rest.ErrInternal)
+		return
+	}
+	render.JSON(w, r, stats)
+}
+
+// PUT /notify/queue/{id}?site=siteID - retry delivery of queued notification now
+func (a *admin) notifyRetryCtrl(w http.ResponseWriter, r *http.Request) {
+	if a.notifyService == nil {
+		rest.SendErrorJSON(w, r, http.StatusNotImplemented, notify.ErrQueueDisabled, "can't retry notification", rest.ErrActionRejected)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	siteID := r.URL.Query().Get("site")
+	log.Printf("[INFO] retry notification %s", id)
+
+	if err := a.notifyService.Retry(siteID, id); err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, notify.ErrQueueDisabled) {
+			code = http.StatusNotImplemented
+		}
+		rest.SendErrorJSON(w, r, code, err, "can't retry notification", rest.ErrActionRejected)
+		return
+	}
+	addAudit(a.auditStore, r, audit.Entry{Action: audit.ActionRetry, Params: map[string]string{"notification": id}})
+	render.JSON(w, r, R.JSON{"id": id, "retry": true})
+}
+
+// GET /audit?site=siteID&action=block&actor=user-id&from=unix_ts_msec&to=unix_ts_msec&limit=100&skip=10
+// list admin actions, newest first
+func (a *admin) auditCtrl(w http.ResponseWriter, r *http.Request) {
+	if a.auditStore == nil {
+		rest.SendErrorJSON(w, r, http.StatusNotImplemented, errors.New("audit log disabled"), "can't get audit log", rest.ErrActionRejected)
+		return
+	}
+	query := r.URL.Query()
+	req := audit.Request{SiteID: query.Get("site"), Action: audit.Action(query.Get("action")), ActorID: query.Get("actor")}
+	req.Limit, _ = strconv.Atoi(query.Get("limit"))
+	req.Skip, _ = strconv.Atoi(query.Get("skip"))
+	if ts, err := strconv.ParseInt(query.Get("from"), 10, 64); err == nil {
+		req.From = time.Unix(0, ts*1000000)
+	}
+	if ts, err := strconv.ParseInt(query.Get("to"), 10, 64); err == nil {
+		req.To = time.Unix(0, ts*1000000)
+	}
+
+	entries, err := a.auditStore.List(req)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get audit log", rest.ErrInternal)
+		return
+	}
+	render.JSON(w, r, entries)
+}
+
+// GET /changes?site=siteID&since=seq&limit=100 - entries of site's change log after sequence number, oldest first
+func (a *admin) changesCtrl(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var since uint64
+	if query.Get("since") != "" {
+		var err error
+		if since, err = strconv.ParseUint(query.Get("since"), 10, 64); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "bad since sequence number", rest.ErrDecode)
+			return
+		}
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+
+	changes, err := a.dataService.Changes(query.Get("site"), since, limit)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get changes", rest.ErrInternal)
+		return
+	}
+	render.JSON(w, r, changes)
+}
+
+// GET /changes/head?site=siteID - sequence number of the last entry of site's change log, 0 for empty log
+func (a *admin) changesHeadCtrl(w http.ResponseWriter, r *http.Request) {
+	seq, err := a.dataService.ChangesHead(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get head of changes", rest.ErrInternal)
+		return
+	}
+	render.JSON(w, r, R.JSON{"seq": seq})
+}
+
+// POST /retention?site=siteID&dry=1 - removes personal data of the site by its retention policy,
+// dry mode only counts data to be removed
+func (a *admin) retentionCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	dry := r.URL.Query().Get("dry") == "1"
+	log.Printf("[INFO] apply retention policy of %s, dry %v", siteID, dry)
+
+	report, err := a.dataService.ApplyRetention(siteID, dry)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't apply retention policy", rest.ErrInternal)
+		return
+	}
+	if !dry && report.Changed() {
+		a.cache.Flush(cache.Flusher(siteID)) // no scopes, drops all cached responses of the site
+		addAudit(a.auditStore, r, audit.Entry{Action: audit.ActionRetention, Params: report.Params()})
+	}
+	render.JSON(w, r, report)
+}
+
+// GET /settings?site=siteID - returns settings of the site, overriding global options
+func (a *admin) getSettingsCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	settings, err := a.dataService.Settings(siteID)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if err == service.ErrSettingsDisabled {
+			code = http.StatusNotImplemented
+		}
+		rest.SendErrorJSON(w, r, code, err, "can't get site settings", rest.ErrActionRejected)
+		return
+	}
+	render.JSON(w, r, settings)
+}
+
+// PUT /settings?site=siteID - replaces settings of the site, body is settings json.
+// Fields not set (null) are not overridden and global options used
+func (a *admin) setSettingsCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	settings := adminstore.Settings{}
+	if err := render.DecodeJSON(http.MaxBytesReader(w, r.Body, hardBodyLimit), &settings); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind settings", rest.ErrDecode)
+		return
+	}
+	if err := settings.Validate(); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid site settings", rest.ErrActionRejected)
+		return
+	}
+	if err := a.dataService.SetSettings(siteID, settings); err != nil {
+		code := http.StatusInternalServerError
+		if err == service.ErrSettingsDisabled {
+			code = http.StatusNotImplemented
+		}
+		rest.SendErrorJSON(w, r, code, err, "can't set site settings", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] settings of %s set to %v", siteID, settings.Params())
+	a.cache.Flush(cache.Flusher(siteID)) // settings change rendered comments and config of the site
+	addAudit(a.auditStore, r, audit.Entry{Action: audit.ActionSettings, Params: settings.Params()})
+	render.JSON(w, r, settings)
+}
+
+// GET /sites - list of sites, basic auth admin only
+func (a *admin) sitesCtrl(w http.ResponseWriter, r *http.Request) {
+	if a.siteManager == nil {
+		rest.SendErrorJSON(w, r, http.StatusNotImplemented, errSitesDisabled, "can't list sites", rest.ErrActionRejected)
+		return
+	}
+	render.JSON(w, r, a.siteManager.List())
+}
+
+// POST /sites/{id} - create new site, basic auth admin only
+func (a *admin) createSiteCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "id")
+	a.siteAction(w, r, siteID, map[string]string{"op": "create"}, func() error {
+		if !adminstore.ValidSiteID(siteID) {
+			return errors.New("invalid site id")
+		}
+		return a.siteManager.Create(siteID)
+	})
+}
+
+// PUT /sites/{id}?enabled=0 - disable or enable site, PUT /sites/{id}?rename=new-id - rename site.
+// Basic auth admin only
+func (a *admin) updateSiteCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "id")
+	if newID := r.URL.Query().Get("rename"); newID != "" {
+		a.siteAction(w, r, siteID, map[string]string{"op": "rename", "to": newID}, func() error {
+			if !adminstore.ValidSiteID(newID) {
+				return errors.New("invalid site id")
+			}
+			if err := a.siteManager.Rename(siteID, newID); err != nil {
+				return err
+			}
+			a.cache.Flush(cache.Flusher(newID))
+			return nil
+		})
+		return
+	}
+
+	enabled := r.URL.Query().Get("enabled") != "0"
+	op := "enable"
+	if !enabled {
+		op = "disable"
+	}
+	a.siteAction(w, r, siteID, map[string]string{"op": op}, func() error { return a.siteManager.SetEnabled(siteID, enabled) })
+}
+
+// DELETE /sites/{id} - delete site with all its data, basic auth admin only
+func (a *admin) deleteSiteCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "id")
+	a.siteAction(w, r, siteID, map[string]string{"op": "delete"}, func() error { return a.siteManager.Delete(siteID) })
+}
+
+// siteAction runs action of site manager, responds with the list of sites on success
+func (a *admin) siteAction(w http.ResponseWriter, r *http.Request, siteID string, params map[string]string, fn func() error) {
+	if a.siteManager == nil {
+		rest.SendErrorJSON(w, r, http.StatusNotImplemented, errSitesDisabled, "can't "+params["op"]+" site", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] %s site %s %v", params["op"], siteID, params)
+	if err := fn(); err != nil {
+		code := http.StatusBadRequest
+		switch {
+		case errors.Is(err, adminstore.ErrSiteNotFound):
+			code = http.StatusNotFound
+		case errors.Is(err, adminstore.ErrSiteExists):
+			code = http.StatusConflict
+		}
+		rest.SendErrorJSON(w, r, code, err, "can't "+params["op"]+" site", rest.ErrActionRejected)
+		return
+	}
+	a.cache.Flush(cache.Flusher(siteID)) // no scopes, drops all cached responses of the site
+	addAudit(a.auditStore, r, audit.Entry{SiteID: siteID, Action: audit.ActionSite, Params: params})
+	render.JSON(w, r, a.siteManager.List())
+}
+
+// addAudit records admin action made by user from request, site taken from request if not set.
+// Failure logged and doesn't affect the action.
+func addAudit(auditStore audit.Store, r *http.Request, entry audit.Entry) {
+	if auditStore == nil {
+		return
+	}
+	if entry.SiteID == "" {
+		entry.SiteID = r.URL.Query().Get("site")
+	}
+	user := rest.GetUserOrEmpty(r)
+	entry.Actor = audit.Actor{ID: user.ID, Name: user.Name}
+	if err := auditStore.Add(entry); err != nil {
+		log.Printf("[WARN] can't add audit entry %+v, %v", entry, err)
+	}
+}
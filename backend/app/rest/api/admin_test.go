@@ -3,13 +3,16 @@ package api
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -19,8 +22,13 @@ import (
 	R "github.com/go-pkgz/rest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
 
+	"github.com/umputun/remark42/backend/app/notify"
 	"github.com/umputun/remark42/backend/app/store"
+	adminstore "github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/audit"
+	"github.com/umputun/remark42/backend/app/store/engine"
 	"github.com/umputun/remark42/backend/app/store/service"
 )
 
@@ -250,6 +258,124 @@ func TestAdmin_Pin(t *testing.T) {
 	assert.False(t, cr.Pin)
 }
 
+func TestAdmin_Pending(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	srv.DataService.Moderation.Sites = []string{"remark42"}
+
+	c := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	id1 := addComment(t, c, ts)
+	id2 := addComment(t, c, ts)
+
+	find := func() []store.Comment {
+		res, code := get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah")
+		require.Equal(t, http.StatusOK, code)
+		comments := commentsWithInfo{}
+		require.NoError(t, json.Unmarshal([]byte(res), &comments))
+		return comments.Comments
+	}
+	assert.Equal(t, 0, len(find()), "pending comments hidden")
+
+	byID := func(id, tkn string) int {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/id/"+id+"?site=remark42&url=https://radio-t.com/blah", nil)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, tkn)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusNotFound, byID(id1, ""), "pending comment hidden from anonymous")
+	assert.Equal(t, http.StatusNotFound, byID(id1, anonToken), "pending comment hidden from other user")
+	assert.Equal(t, http.StatusOK, byID(id1, devToken), "pending comment visible to author")
+	_, code := getWithAdminAuth(t, ts.URL+"/api/v1/id/"+id1+"?site=remark42&url=https://radio-t.com/blah")
+	assert.Equal(t, http.StatusOK, code, "pending comment visible to admin")
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/pending?site=remark42", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	req.SetBasicAuth("admin", "password")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	pending := []store.Comment{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&pending))
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, 2, len(pending))
+	assert.Equal(t, id1, pending[0].ID)
+	assert.True(t, pending[0].Pending)
+
+	moderate := func(action, id string) int {
+		req, err := http.NewRequest(http.MethodPut,
+			fmt.Sprintf("%s/api/v1/admin/%s/%s?site=remark42&url=https://radio-t.com/blah", ts.URL, action, id), nil)
+		require.NoError(t, err)
+		requireAdminOnly(t, req)
+		req.SetBasicAuth("admin", "password")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, moderate("approve", id1))
+	assert.Equal(t, http.StatusBadRequest, moderate("approve", id1), "already approved")
+	assert.Equal(t, http.StatusOK, moderate("reject", id2))
+	assert.Equal(t, http.StatusBadRequest, moderate("reject", id2), "already rejected")
+
+	comments := find()
+	require.Equal(t, 1, len(comments), "approved comment visible")
+	assert.Equal(t, id1, comments[0].ID)
+	assert.False(t, comments[0].Pending)
+}
+
+func TestAdmin_Reports(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	id1 := addComment(t, c, ts)
+	id2 := addComment(t, c, ts)
+	locator := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}
+	for _, r := range []struct{ id, user string }{{id1, "u1"}, {id2, "u1"}, {id2, "u2"}} {
+		_, _, err := srv.DataService.Report(service.ReportRequest{Locator: locator, CommentID: r.id,
+			User: store.User{ID: r.user}, Reason: store.ReportSpam})
+		require.NoError(t, err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/reports?site=remark42", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	req.SetBasicAuth("admin", "password")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	reported := []service.ReportedComment{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&reported))
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, 2, len(reported))
+	assert.Equal(t, id2, reported[0].Comment.ID, "most reported first")
+	assert.Equal(t, 2, len(reported[0].Reports))
+	assert.Equal(t, id1, reported[1].Comment.ID)
+
+	req, err = http.NewRequest(http.MethodDelete,
+		fmt.Sprintf("%s/api/v1/admin/reports/%s?site=remark42&url=https://radio-t.com/blah", ts.URL, id2), nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	reported, err = srv.DataService.Reported("remark42", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(reported), "reports of the second comment dismissed")
+	assert.Equal(t, id1, reported[0].Comment.ID)
+
+	entries, err := srv.adminRest.auditStore.List(audit.Request{SiteID: "remark42", Action: audit.ActionDismiss})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, id2, entries[0].CommentID)
+}
+
 func TestAdmin_Block(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
@@ -362,6 +488,115 @@ func TestAdmin_Block(t *testing.T) {
 	assert.False(t, srv.adminRest.dataService.IsBlocked("remark42", "user2"))
 }
 
+func TestAdmin_ShadowBlock(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	locator := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}
+	id1, err := srv.DataService.Create(store.Comment{Text: "test test #1", Locator: locator,
+		User: store.User{Name: "developer one", ID: "dev"}})
+	require.NoError(t, err)
+	_, err = srv.DataService.Create(store.Comment{Text: "test test #2", Locator: locator,
+		User: store.User{Name: "user2", ID: "user2"}})
+	require.NoError(t, err)
+
+	block := func(val int) R.JSON {
+		req, e := http.NewRequest(http.MethodPut,
+			fmt.Sprintf("%s/api/v1/admin/user/%s?site=remark42&block=%d&shadow=1", ts.URL, "dev", val), nil)
+		require.NoError(t, e)
+		resp, e := sendReq(t, req, adminUmputunToken)
+		require.NoError(t, e)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		j := R.JSON{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&j))
+		require.NoError(t, resp.Body.Close())
+		return j
+	}
+	findComments := func(body string, code int) []store.Comment {
+		require.Equal(t, http.StatusOK, code)
+		comments := commentsWithInfo{}
+		require.NoError(t, json.Unmarshal([]byte(body), &comments))
+		return comments.Comments
+	}
+	findURL := ts.URL + "/api/v1/find?site=remark42&url=https://radio-t.com/blah&sort=+time"
+
+	j := block(1)
+	assert.Equal(t, true, j["block"])
+	assert.Equal(t, true, j["shadow"])
+	assert.True(t, srv.DataService.IsShadowBlocked("remark42", "dev"))
+	assert.False(t, srv.DataService.IsBlocked("remark42", "dev"), "not blocked in regular mode")
+
+	// shadow blocked user can post, comment not counted for others
+	addComment(t, store.Comment{Text: "test test #3", Locator: locator}, ts)
+
+	comments := findComments(get(t, findURL))
+	require.Equal(t, 1, len(comments), "comments of shadow blocked user hidden")
+	assert.Equal(t, "user2", comments[0].User.ID)
+
+	comments = findComments(getWithDevAuth(t, findURL))
+	require.Equal(t, 3, len(comments), "user sees own comments")
+	assert.False(t, comments[0].Deleted)
+	assert.False(t, comments[0].User.ShadowBlocked, "user not aware of block")
+
+	comments = findComments(getWithAdminAuth(t, findURL))
+	require.Equal(t, 3, len(comments), "admin sees all comments")
+	assert.True(t, comments[0].User.ShadowBlocked, "marked for admin")
+	assert.False(t, comments[1].User.ShadowBlocked)
+
+	idURL := ts.URL + "/api/v1/id/" + id1 + "?site=remark42&url=https://radio-t.com/blah"
+	_, code := get(t, idURL)
+	assert.Equal(t, http.StatusNotFound, code, "comment by id hidden from anonymous")
+	req, err := http.NewRequest(http.MethodGet, idURL, nil)
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, anonToken)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "comment by id hidden from other user")
+	_, code = getWithDevAuth(t, idURL)
+	assert.Equal(t, http.StatusOK, code, "comment by id visible to the user")
+
+	body, code := get(t, ts.URL+"/api/v1/last/10?site=remark42")
+	assert.Equal(t, http.StatusOK, code)
+	last := []store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &last))
+	assert.Equal(t, 1, len(last))
+	body, code = getWithAdminAuth(t, ts.URL+"/api/v1/last/10?site=remark42")
+	assert.Equal(t, http.StatusOK, code)
+	require.NoError(t, json.Unmarshal([]byte(body), &last))
+	require.Equal(t, 3, len(last), "admin sees last comments of shadow blocked user, not cached for others")
+	assert.True(t, last[0].User.ShadowBlocked, "marked for admin")
+	body, code = getWithDevAuth(t, ts.URL+"/api/v1/last/10?site=remark42")
+	assert.Equal(t, http.StatusOK, code)
+	require.NoError(t, json.Unmarshal([]byte(body), &last))
+	assert.Equal(t, 1, len(last), "not leaked from admin's cache")
+
+	resp, err = post(t, ts.URL+"/api/v1/counts?site=remark42", `["https://radio-t.com/blah"]`)
+	require.NoError(t, err)
+	pi := []store.PostInfo{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&pi))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, []store.PostInfo{{URL: "https://radio-t.com/blah", Count: 1}}, pi)
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/blocked?site=remark42", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	users := []store.BlockedUser{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&users))
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, 1, len(users))
+	assert.Equal(t, "dev", users[0].ID)
+	assert.True(t, users[0].Shadow)
+
+	// unblock resets shadow block
+	j = block(0)
+	assert.Equal(t, false, j["block"])
+	assert.Equal(t, false, j["shadow"])
+	assert.False(t, srv.DataService.IsShadowBlocked("remark42", "dev"))
+	comments = findComments(get(t, findURL))
+	assert.Equal(t, 3, len(comments), "comments visible again")
+}
+
 func TestAdmin_BlockedList(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
@@ -847,3 +1082,500 @@ func TestAdmin_GetUserInfo(t *testing.T) {
 	_, code = getWithAdminAuth(t, fmt.Sprintf("%s/api/v1/admin/user/userX?site=remark42&url=https://radio-t.com/blah", ts.URL))
 	assert.Equal(t, 400, code, "no info about user")
 }
+
+func TestAdmin_Audit(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	c := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	id1 := addComment(t, c, ts)
+
+	client := http.Client{}
+	send := func(method, url string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+url, nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	resp := send(http.MethodPut, fmt.Sprintf("/api/v1/admin/pin/%s?site=remark42&url=https://radio-t.com/blah&pin=1", id1))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+	resp = send(http.MethodPut, "/api/v1/admin/user/dev?site=remark42&block=1&ttl=10h")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/audit?site=remark42", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	list := func(query string) []audit.Entry {
+		resp = send(http.MethodGet, "/api/v1/admin/audit?site=remark42"+query)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		entries := []audit.Entry{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+		require.NoError(t, resp.Body.Close())
+		return entries
+	}
+
+	entries := list("")
+	require.Equal(t, 2, len(entries))
+	assert.Equal(t, audit.ActionBlock, entries[0].Action)
+	assert.Equal(t, "dev", entries[0].UserID)
+	assert.Equal(t, map[string]string{"block": "true", "ttl": "10h0m0s"}, entries[0].Params)
+	assert.Equal(t, audit.ActionPin, entries[1].Action)
+	assert.Equal(t, id1, entries[1].CommentID)
+	assert.Equal(t, "https://radio-t.com/blah", entries[1].URL)
+	assert.Equal(t, "admin", entries[1].Actor.ID)
+
+	entries = list("&action=pin")
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, id1, entries[0].CommentID)
+
+	entries = list("&actor=someone")
+	assert.Equal(t, 0, len(entries))
+
+	entries = list("&limit=1&skip=1")
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, audit.ActionPin, entries[0].Action)
+
+	entries = list(fmt.Sprintf("&from=%d", time.Now().Add(time.Hour).UnixNano()/1000000))
+	assert.Equal(t, 0, len(entries))
+	entries = list(fmt.Sprintf("&to=%d", time.Now().Add(time.Hour).UnixNano()/1000000))
+	assert.Equal(t, 2, len(entries))
+}
+
+func TestAdmin_NotifyQueue(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	send := func(method, url string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+url, nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	resp := send(http.MethodGet, "/api/v1/admin/notify/queue?site=remark42")
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode, "no notify service")
+	require.NoError(t, resp.Body.Close())
+
+	srv.adminRest.notifyService = notify.NewService(srv.DataService, 1, &notify.MockDest{})
+	resp = send(http.MethodGet, "/api/v1/admin/notify/queue?site=remark42")
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode, "no persistent queue")
+	require.NoError(t, resp.Body.Close())
+	resp = send(http.MethodPut, "/api/v1/admin/notify/queue/some-id?site=remark42")
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode, "no persistent queue")
+	require.NoError(t, resp.Body.Close())
+	srv.adminRest.notifyService.Close()
+
+	queueFile := os.TempDir() + "/test-remark-notify-queue.db"
+	_ = os.Remove(queueFile)
+	defer os.Remove(queueFile)
+	q, err := notify.NewQueue(queueFile, bolt.Options{}, notify.QueueParams{MaxAttempts: 1})
+	require.NoError(t, err)
+	dest := &failingDestination{}
+	atomic.StoreInt32(&dest.fail, 1)
+	srv.privRest.notifyService = notify.NewQueuedService(srv.DataService, q, time.Hour, dest)
+	srv.adminRest.notifyService = srv.privRest.notifyService
+	defer srv.privRest.notifyService.Close()
+
+	c := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	id1 := addComment(t, c, ts)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&dest.attempts))
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/notify/queue?site=remark42", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp = send(http.MethodGet, "/api/v1/admin/notify/queue?site=remark42")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	stats := notify.QueueStats{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, 0, stats.Pending)
+	require.Equal(t, 1, len(stats.Failed))
+	assert.Equal(t, id1, stats.Failed[0].CommentID)
+	require.Equal(t, 1, len(stats.Failed[0].Deliveries))
+	assert.Equal(t, notify.DeliveryFailed, stats.Failed[0].Deliveries[0].Status)
+	assert.Equal(t, "destination unavailable", stats.Failed[0].Deliveries[0].LastError)
+
+	resp = send(http.MethodPut, "/api/v1/admin/notify/queue/bad-id?site=remark42")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	atomic.StoreInt32(&dest.fail, 0)
+	notificationID := stats.Failed[0].ID
+	resp = send(http.MethodPut, "/api/v1/admin/notify/queue/"+notificationID+"?site=remark42")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&dest.attempts))
+
+	stats, err = srv.adminRest.notifyService.QueueStats("remark42")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(stats.Failed), "delivered on retry")
+
+	entries, err := srv.adminRest.auditStore.List(audit.Request{SiteID: "remark42", Action: audit.ActionRetry})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, map[string]string{"notification": notificationID}, entries[0].Params)
+}
+
+// failingDestination is a notify destination failing all requests while fail set
+type failingDestination struct {
+	fail     int32
+	attempts int32
+}
+
+func (f *failingDestination) Send(_ context.Context, _ notify.Request) error {
+	atomic.AddInt32(&f.attempts, 1)
+	if atomic.LoadInt32(&f.fail) != 0 {
+		return errors.New("destination unavailable")
+	}
+	return nil
+}
+
+func (f *failingDestination) SendVerification(_ context.Context, _ notify.VerificationRequest) error {
+	return nil
+}
+
+func (f *failingDestination) String() string { return "failing destination" }
+
+func TestAdmin_Changes(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	c := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	id1 := addComment(t, c, ts)
+	c.Text = "test test #2"
+	id2 := addComment(t, c, ts)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/changes?site=remark42", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	send := func(method, url string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+url, nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	list := func(query string) []engine.Change {
+		resp := send(http.MethodGet, "/api/v1/admin/changes?site=remark42"+query)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		changes := []engine.Change{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&changes))
+		require.NoError(t, resp.Body.Close())
+		return changes
+	}
+
+	changes := list("")
+	require.Equal(t, 2, len(changes))
+	assert.Equal(t, engine.ChangeCreate, changes[0].Event)
+	assert.Equal(t, id1, changes[0].Comment.ID)
+	assert.Equal(t, id2, changes[1].Comment.ID)
+	assert.True(t, changes[1].Seq > changes[0].Seq)
+
+	resp := send(http.MethodDelete, fmt.Sprintf("/api/v1/admin/comment/%s?site=remark42&url=https://radio-t.com/blah", id1))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	changes = list(fmt.Sprintf("&since=%d", changes[1].Seq))
+	require.Equal(t, 1, len(changes))
+	assert.Equal(t, engine.ChangeDelete, changes[0].Event)
+	assert.Equal(t, id1, changes[0].Delete.CommentID)
+
+	changes = list("&limit=1")
+	require.Equal(t, 1, len(changes))
+	assert.Equal(t, id1, changes[0].Comment.ID)
+
+	resp = send(http.MethodGet, "/api/v1/admin/changes/head?site=remark42")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	head := struct{ Seq uint64 }{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&head))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, changes[0].Seq+2, head.Seq, "seq of the delete")
+
+	resp = send(http.MethodGet, "/api/v1/admin/changes?site=remark42&since=bad")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+}
+
+func TestAdmin_Retention(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	id1 := addComment(t, c, ts)
+	c.Text = "test test #2"
+	id2 := addComment(t, c, ts)
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/retention?site=remark42", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	send := func(method, url string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+url, nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	apply := func(query string) (report service.RetentionReport) {
+		resp := send(http.MethodPost, "/api/v1/admin/retention?site=remark42"+query)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+		require.NoError(t, resp.Body.Close())
+		return report
+	}
+
+	resp := send(http.MethodDelete, fmt.Sprintf("/api/v1/admin/comment/%s?site=remark42&url=https://radio-t.com/blah", id1))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, service.RetentionReport{SiteID: "remark42"}, apply(""), "no policy")
+
+	srv.DataService.Retention = map[string]service.RetentionPolicy{"remark42": {UserIP: time.Nanosecond, Deleted: time.Nanosecond}}
+	assert.Equal(t, service.RetentionReport{SiteID: "remark42", Dry: true, UserIPs: 1, Deleted: 1}, apply("&dry=1"))
+	entries, err := srv.AuditStore.List(audit.Request{SiteID: "remark42", Action: audit.ActionRetention})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(entries), "dry run not audited")
+
+	assert.Equal(t, service.RetentionReport{SiteID: "remark42", UserIPs: 1, Deleted: 1}, apply(""))
+	comment, err := srv.DataService.Engine.Get(engine.GetRequest{Locator: c.Locator, CommentID: id2})
+	require.NoError(t, err)
+	assert.Equal(t, "", comment.User.IP)
+	comment, err = srv.DataService.Engine.Get(engine.GetRequest{Locator: c.Locator, CommentID: id1})
+	require.NoError(t, err)
+	assert.Equal(t, "deleted", comment.User.ID)
+
+	entries, err = srv.AuditStore.List(audit.Request{SiteID: "remark42", Action: audit.ActionRetention})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, map[string]string{"voted_ips": "0", "user_ips": "1", "emails": "0", "deleted": "1"}, entries[0].Params)
+	assert.Equal(t, "admin", entries[0].Actor.ID)
+}
+
+func TestAdmin_Settings(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	send := func(method, url, body string) (int, string) {
+		req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, string(b)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/settings?site=remark42", strings.NewReader("{}"))
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	code, _ := send(http.MethodGet, "/api/v1/admin/settings?site=remark42", "")
+	assert.Equal(t, http.StatusNotImplemented, code, "settings store not set")
+	code, _ = send(http.MethodPut, "/api/v1/admin/settings?site=remark42", "{}")
+	assert.Equal(t, http.StatusNotImplemented, code, "settings store not set")
+
+	settingsFile := os.TempDir() + "/test-remark-settings.json"
+	defer os.Remove(settingsFile)
+	settingsStore, err := adminstore.NewFileSettings(settingsFile)
+	require.NoError(t, err)
+	srv.DataService.SettingsStore = settingsStore
+
+	code, body := send(http.MethodGet, "/api/v1/admin/settings?site=remark42", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"restricted_words":null,"reactions":null}`+"\n", body, "nothing overridden")
+
+	code, _ = send(http.MethodPut, "/api/v1/admin/settings?site=remark42", `{"low_score":-5,"critical_score":-3}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = send(http.MethodPut, "/api/v1/admin/settings?site=remark42", `{"low_score":"bad"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = send(http.MethodPut, "/api/v1/admin/settings?site=remark42",
+		`{"max_comment_size":100,"edit_duration":60,"readonly_age":0,"anon_vote":true,"emoji_enabled":false}`)
+	require.Equal(t, http.StatusOK, code)
+	settings, err := srv.DataService.Settings("remark42")
+	require.NoError(t, err)
+	assert.Equal(t, 100, *settings.MaxCommentSize)
+	assert.Equal(t, 60, *settings.EditDuration)
+	assert.Nil(t, settings.LowScore)
+
+	code, body = send(http.MethodGet, "/api/v1/config?site=remark42", "")
+	require.Equal(t, http.StatusOK, code)
+	j := R.JSON{}
+	require.NoError(t, json.Unmarshal([]byte(body), &j))
+	assert.Equal(t, 60.0, j["edit_duration"])
+	assert.Equal(t, 100.0, j["max_comment_size"])
+	assert.Equal(t, 0.0, j["readonly_age"])
+	assert.Equal(t, -5.0, j["low_score"], "global option")
+	assert.True(t, j["anon_vote"].(bool))
+	assert.False(t, j["emoji_enabled"].(bool))
+
+	c := store.Comment{Text: "test :smile:", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	id := addComment(t, c, ts)
+	comment, err := srv.DataService.Engine.Get(engine.GetRequest{Locator: c.Locator, CommentID: id})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>test :smile:</p>\n", comment.Text, "emoji disabled for the site")
+
+	entries, err := srv.AuditStore.List(audit.Request{SiteID: "remark42", Action: audit.ActionSettings})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, map[string]string{"max_comment_size": "100", "edit_duration": "60", "readonly_age": "0",
+		"anon_vote": "true", "emoji_enabled": "false"}, entries[0].Params)
+	assert.Equal(t, "admin", entries[0].Actor.ID)
+
+	code, _ = send(http.MethodPut, "/api/v1/admin/settings?site=remark42", "{}")
+	require.Equal(t, http.StatusOK, code)
+	id = addComment(t, c, ts)
+	comment, err = srv.DataService.Engine.Get(engine.GetRequest{Locator: c.Locator, CommentID: id})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>test 😄 </p>\n", comment.Text, "global emoji option")
+}
+
+func TestAdmin_Sites(t *testing.T) {
+	_, srv, teardown := startupT(t)
+	defer teardown()
+
+	send := func(ts *httptest.Server, method, url string) (*http.Response, []adminstore.Site) {
+		req, err := http.NewRequest(method, ts.URL+url, nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		sites := []adminstore.Site{}
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&sites))
+		}
+		return resp, sites
+	}
+
+	// management disabled without site manager
+	ts := httptest.NewServer(srv.routes())
+	resp, _ := send(ts, http.MethodGet, "/api/v1/admin/sites")
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	resp, _ = send(ts, http.MethodPost, "/api/v1/admin/sites/blog")
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	ts.Close()
+
+	sm := &fakeSiteManager{sites: []adminstore.Site{{ID: "remark42"}}}
+	srv.SiteManager = sm
+	ts = httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/sites", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err = sendReq(t, req, adminUmputunToken) // admin by token is not allowed to manage sites
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, sites := send(ts, http.MethodGet, "/api/v1/admin/sites")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []adminstore.Site{{ID: "remark42"}}, sites)
+
+	resp, sites = send(ts, http.MethodPost, "/api/v1/admin/sites/blog")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []adminstore.Site{{ID: "remark42"}, {ID: "blog"}}, sites)
+	resp, _ = send(ts, http.MethodPost, "/api/v1/admin/sites/blog")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp, _ = send(ts, http.MethodPost, "/api/v1/admin/sites/.blog")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, sites = send(ts, http.MethodPut, "/api/v1/admin/sites/blog?enabled=0")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []adminstore.Site{{ID: "remark42"}, {ID: "blog", Disabled: true}}, sites)
+	resp, _ = send(ts, http.MethodPut, "/api/v1/admin/sites/bad?enabled=1")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, sites = send(ts, http.MethodPut, "/api/v1/admin/sites/blog?rename=news")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []adminstore.Site{{ID: "remark42"}, {ID: "news", Disabled: true}}, sites)
+	resp, _ = send(ts, http.MethodPut, "/api/v1/admin/sites/news?rename=remark42")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp, _ = send(ts, http.MethodPut, "/api/v1/admin/sites/news?rename=a/b")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, sites = send(ts, http.MethodDelete, "/api/v1/admin/sites/news")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []adminstore.Site{{ID: "remark42"}}, sites)
+	resp, _ = send(ts, http.MethodDelete, "/api/v1/admin/sites/news")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	ops := []string{}
+	for _, siteID := range []string{"blog", "news"} {
+		entries, err := srv.AuditStore.List(audit.Request{SiteID: siteID, Action: audit.ActionSite})
+		require.NoError(t, err)
+		for _, e := range entries {
+			assert.Equal(t, "admin", e.Actor.ID)
+			ops = append(ops, siteID+":"+e.Params["op"]+e.Params["to"])
+		}
+	}
+	assert.ElementsMatch(t, []string{"blog:create", "blog:disable", "blog:renamenews", "news:delete"}, ops)
+}
+
+// fakeSiteManager keeps sites in memory
+type fakeSiteManager struct {
+	sites []adminstore.Site
+}
+
+func (f *fakeSiteManager) List() []adminstore.Site { return f.sites }
+
+func (f *fakeSiteManager) Create(siteID string) error {
+	if _, ok := f.find(siteID); ok {
+		return fmt.Errorf("%s: %w", siteID, adminstore.ErrSiteExists)
+	}
+	f.sites = append(f.sites, adminstore.Site{ID: siteID})
+	return nil
+}
+
+func (f *fakeSiteManager) SetEnabled(siteID string, enabled bool) error {
+	i, ok := f.find(siteID)
+	if !ok {
+		return fmt.Errorf("%s: %w", siteID, adminstore.ErrSiteNotFound)
+	}
+	f.sites[i].Disabled = !enabled
+	return nil
+}
+
+func (f *fakeSiteManager) Rename(siteID, newID string) error {
+	i, ok := f.find(siteID)
+	if !ok {
+		return fmt.Errorf("%s: %w", siteID, adminstore.ErrSiteNotFound)
+	}
+	if _, ok := f.find(newID); ok {
+		return fmt.Errorf("%s: %w", newID, adminstore.ErrSiteExists)
+	}
+	f.sites[i].ID = newID
+	return nil
+}
+
+func (f *fakeSiteManager) Delete(siteID string) error {
+	i, ok := f.find(siteID)
+	if !ok {
+		return fmt.Errorf("%s: %w", siteID, adminstore.ErrSiteNotFound)
+	}
+	f.sites = append(f.sites[:i], f.sites[i+1:]...)
+	return nil
+}
+
+func (f *fakeSiteManager) find(siteID string) (int, bool) {
+	for i, s := range f.sites {
+		if s.ID == siteID {
+			return i, true
+		}
+	}
+	return 0, false
+}
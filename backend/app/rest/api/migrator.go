@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"fmt"
@@ -19,6 +20,7 @@ import (
 
 	"github.com/umputun/remark42/backend/app/migrator"
 	"github.com/umputun/remark42/backend/app/rest"
+	"github.com/umputun/remark42/backend/app/store/audit"
 )
 
 // Migrator rest with import and export controllers
@@ -30,6 +32,7 @@ type Migrator struct {
 	NativeExporter    migrator.Exporter
 	URLMapperMaker    migrator.MapperMaker
 	KeyStore          KeyStore
+	AuditStore        audit.Store
 
 	busy map[string]bool
 	lock sync.Mutex
@@ -59,6 +62,7 @@ func (m *Migrator) importCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 
 	go m.runImport(siteID, r.URL.Query().Get("provider"), tmpfile) // import runs in background and sets busy flag for site
+	addAudit(m.AuditStore, r, audit.Entry{Action: audit.ActionImport, Params: map[string]string{"provider": r.URL.Query().Get("provider")}})
 
 	render.Status(r, http.StatusAccepted)
 	render.JSON(w, r, R.JSON{"status": "import request accepted"})
@@ -94,6 +98,7 @@ func (m *Migrator) importFormCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 
 	go m.runImport(siteID, r.URL.Query().Get("provider"), tmpfile) // import runs in background and sets busy flag for site
+	addAudit(m.AuditStore, r, audit.Entry{Action: audit.ActionImport, Params: map[string]string{"provider": r.URL.Query().Get("provider")}})
 
 	render.Status(r, http.StatusAccepted)
 	render.JSON(w, r, R.JSON{"status": "import request accepted"})
@@ -160,13 +165,19 @@ func (m *Migrator) exportCtrl(w http.ResponseWriter, r *http.Request) {
 func (m *Migrator) remapCtrl(w http.ResponseWriter, r *http.Request) {
 	siteID := r.URL.Query().Get("site")
 
+	rules, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "remap failed, can't read rules", rest.ErrDecode)
+		return
+	}
+	defer r.Body.Close()
+
 	// create new url-mapper from given rules in body
-	mapper, err := m.URLMapperMaker(r.Body)
+	mapper, err := m.URLMapperMaker(bytes.NewReader(rules))
 	if err != nil {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "remap failed, bad given rules", rest.ErrDecode)
 		return
 	}
-	defer r.Body.Close()
 
 	// start remap procedure with mapper
 	go func() {
@@ -207,6 +218,7 @@ func (m *Migrator) remapCtrl(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[DEBUG] convert request completed. site=%s, comments=%d", siteID, size)
 	}()
 
+	addAudit(m.AuditStore, r, audit.Entry{Action: audit.ActionRemap, Params: map[string]string{"rules": string(rules)}})
 	render.Status(r, http.StatusAccepted)
 	render.JSON(w, r, R.JSON{"status": "convert request accepted"})
 }
@@ -26,9 +26,12 @@ import (
 	"github.com/rakyll/statik/fs"
 
 	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/replica"
 	"github.com/umputun/remark42/backend/app/rest"
 	"github.com/umputun/remark42/backend/app/rest/proxy"
 	"github.com/umputun/remark42/backend/app/store"
+	adminstore "github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/audit"
 	"github.com/umputun/remark42/backend/app/store/image"
 	"github.com/umputun/remark42/backend/app/store/service"
 	"github.com/umputun/remark42/backend/app/templates"
@@ -47,6 +50,10 @@ type Rest struct {
 	NotifyService    *notify.Service
 	ImageService     *image.Service
 	Streamer         *Streamer
+	AuditStore       audit.Store
+	SiteManager      SiteManager      // creates and removes sites at runtime, disabled if not set
+	Replica          *replica.Replica // set in read-only replica mode
+	PrimaryProxy     http.Handler     // sends requests replica can't serve to primary, required with Replica
 
 	AnonVote        bool
 	WebRoot         string
@@ -200,6 +207,9 @@ func (s *Rest) routes() chi.Router {
 		})
 		router.Use(corsMiddleware.Handler)
 	}
+	if s.Replica != nil {
+		router.Use(s.proxyToPrimary)
+	}
 
 	ipFn := func(ip string) string { return store.HashValue(ip, s.SharedSecret)[:12] } // logger uses it for anonymization
 	logInfoWithBody := logger.New(logger.Log(log.Default()), logger.WithBody, logger.IPfn(ipFn), logger.Prefix("[INFO]")).Handler
@@ -238,13 +248,16 @@ func (s *Rest) routes() chi.Router {
 			ropen.Get("/config", s.configCtrl)
 			ropen.Get("/find", s.pubRest.findCommentsCtrl)
 			ropen.Get("/id/{id}", s.pubRest.commentByIDCtrl)
+			ropen.Get("/id/{id}/history", s.pubRest.commentHistoryCtrl)
 			ropen.Get("/comments", s.pubRest.findUserCommentsCtrl)
+			ropen.Get("/profile/{userid}", s.pubRest.profileCtrl)
 			ropen.Get("/last/{limit}", s.pubRest.lastCommentsCtrl)
 			ropen.Get("/count", s.pubRest.countCtrl)
 			ropen.Post("/counts", s.pubRest.countMultiCtrl)
 			ropen.Get("/list", s.pubRest.listCtrl)
 			ropen.Post("/preview", s.pubRest.previewCommentCtrl)
 			ropen.Get("/info", s.pubRest.infoCtrl)
+			ropen.Get("/search", s.pubRest.searchCtrl)
 			ropen.Get("/img", s.ImageProxy.Handler)
 
 			ropen.Route("/rss", func(rrss chi.Router) {
@@ -297,6 +310,23 @@ func (s *Rest) routes() chi.Router {
 			radmin.Get("/blocked", s.adminRest.blockedUsersCtrl)
 			radmin.Put("/readonly", s.adminRest.setReadOnlyCtrl)
 			radmin.Put("/title/{id}", s.adminRest.setTitleCtrl)
+			radmin.Get("/pending", s.adminRest.pendingCommentsCtrl)
+			radmin.Put("/approve/{id}", s.adminRest.approveCommentCtrl)
+			radmin.Put("/reject/{id}", s.adminRest.rejectCommentCtrl)
+			radmin.Get("/reports", s.adminRest.reportedCommentsCtrl)
+			radmin.Delete("/reports/{id}", s.adminRest.dismissReportsCtrl)
+			radmin.Get("/audit", s.adminRest.auditCtrl)
+			radmin.Get("/notify/queue", s.adminRest.notifyQueueCtrl)
+			radmin.Put("/notify/queue/{id}", s.adminRest.notifyRetryCtrl)
+			radmin.Get("/changes", s.adminRest.changesCtrl)
+			radmin.Get("/changes/head", s.adminRest.changesHeadCtrl)
+			radmin.Post("/retention", s.adminRest.retentionCtrl)
+			radmin.With(basicAdminOnly).Get("/sites", s.adminRest.sitesCtrl)
+			radmin.With(basicAdminOnly).Post("/sites/{id}", s.adminRest.createSiteCtrl)
+			radmin.With(basicAdminOnly).Put("/sites/{id}", s.adminRest.updateSiteCtrl)
+			radmin.With(basicAdminOnly).Delete("/sites/{id}", s.adminRest.deleteSiteCtrl)
+			radmin.Get("/settings", s.adminRest.getSettingsCtrl)
+			radmin.Put("/settings", s.adminRest.setSettingsCtrl)
 
 			// migrator
 			radmin.Get("/export", s.adminRest.migrator.exportCtrl)
@@ -316,11 +346,23 @@ func (s *Rest) routes() chi.Router {
 			rauth.Put("/comment/{id}", s.privRest.updateCommentCtrl)
 			rauth.Post("/comment", s.privRest.createCommentCtrl)
 			rauth.Put("/vote/{id}", s.privRest.voteCtrl)
+			rauth.Put("/reaction/{id}", s.privRest.reactionCtrl)
+			rauth.Post("/report/{id}", s.privRest.reportCtrl)
 			rauth.With(rejectAnonUser).Post("/deleteme", s.privRest.deleteMeCtrl)
 			rauth.With(rejectAnonUser).Get("/email", s.privRest.getEmailCtrl)
 			rauth.With(rejectAnonUser).Post("/email/subscribe", s.privRest.sendEmailConfirmationCtrl)
 			rauth.With(rejectAnonUser).Post("/email/confirm", s.privRest.setConfirmedEmailCtrl)
+			rauth.With(rejectAnonUser).Get("/email/subscriptions", s.privRest.subscriptionsCtrl)
+			rauth.With(rejectAnonUser).Put("/email/subscription", s.privRest.subscribeCtrl)
+			rauth.With(rejectAnonUser).Delete("/email/subscription", s.privRest.unsubscribeCtrl)
+			rauth.With(rejectAnonUser).Get("/email/digest", s.privRest.getDigestCtrl)
+			rauth.With(rejectAnonUser).Put("/email/digest", s.privRest.setDigestCtrl)
 			rauth.With(rejectAnonUser).Delete("/email", s.privRest.deleteEmailCtrl)
+			rauth.With(rejectAnonUser).Get("/profile", s.privRest.getProfileCtrl)
+			rauth.With(rejectAnonUser).Put("/profile", s.privRest.setProfileCtrl)
+			rauth.Get("/mute", s.privRest.mutedUsersCtrl)
+			rauth.Put("/mute/{userid}", s.privRest.muteCtrl)
+			rauth.Delete("/mute/{userid}", s.privRest.muteCtrl)
 		})
 
 		// protected routes, anonymous rejected
@@ -357,6 +399,7 @@ func (s *Rest) controllerGroups() (public, private, admin, rss) {
 		imageService:     s.ImageService,
 		commentFormatter: s.CommentFormatter,
 		readOnlyAge:      s.ReadOnlyAge,
+		emojiEnabled:     s.EmojiEnabled,
 		webRoot:          s.WebRoot,
 		streamer:         s.Streamer,
 	}
@@ -371,6 +414,7 @@ func (s *Rest) controllerGroups() (public, private, admin, rss) {
 		notifyService:    s.NotifyService,
 		remarkURL:        s.RemarkURL,
 		anonVote:         s.AnonVote,
+		emojiEnabled:     s.EmojiEnabled,
 		templates:        templates.NewFS(),
 	}
 
@@ -380,6 +424,9 @@ func (s *Rest) controllerGroups() (public, private, admin, rss) {
 		cache:         s.Cache,
 		authenticator: s.Authenticator,
 		readOnlyAge:   s.ReadOnlyAge,
+		notifyService: s.NotifyService,
+		auditStore:    s.AuditStore,
+		siteManager:   s.SiteManager,
 	}
 
 	rssGrp := rss{
@@ -399,43 +446,63 @@ func (s *Rest) updateLimiter() float64 {
 	return lmt
 }
 
+// siteOptions returns global options of the server with settings of the site applied
+func (s *Rest) siteOptions(siteID string) adminstore.SiteOptions {
+	return s.DataService.SiteOptions(siteID, adminstore.SiteOptions{
+		MaxCommentSize: s.DataService.MaxCommentSize,
+		EditDuration:   s.DataService.EditDuration,
+		LowScore:       s.ScoreThresholds.Low,
+		CriticalScore:  s.ScoreThresholds.Critical,
+		PositiveScore:  s.DataService.PositiveScore,
+		ReadOnlyAge:    s.ReadOnlyAge,
+		MaxVotes:       s.DataService.MaxVotes,
+		AnonVote:       s.AnonVote,
+		EmojiEnabled:   s.EmojiEnabled,
+		Reactions:      s.DataService.Reactions,
+	})
+}
+
 // GET /config?site=siteID - returns configuration
 func (s *Rest) configCtrl(w http.ResponseWriter, r *http.Request) {
 	siteID := r.URL.Query().Get("site")
 
 	admins, _ := s.DataService.AdminStore.Admins(siteID)
 	emails, _ := s.DataService.AdminStore.Email(siteID)
+	opts := s.siteOptions(siteID)
 
 	cnf := struct {
-		Version            string   `json:"version"`
-		EditDuration       int      `json:"edit_duration"`
-		MaxCommentSize     int      `json:"max_comment_size"`
-		Admins             []string `json:"admins"`
-		AdminEmail         string   `json:"admin_email"`
-		Auth               []string `json:"auth_providers"`
-		AnonVote           bool     `json:"anon_vote"`
-		LowScore           int      `json:"low_score"`
-		CriticalScore      int      `json:"critical_score"`
-		PositiveScore      bool     `json:"positive_score"`
-		ReadOnlyAge        int      `json:"readonly_age"`
-		MaxImageSize       int      `json:"max_image_size"`
-		EmailNotifications bool     `json:"email_notifications"`
-		EmojiEnabled       bool     `json:"emoji_enabled"`
-		SimpleView         bool     `json:"simple_view"`
+		Version            string              `json:"version"`
+		EditDuration       int                 `json:"edit_duration"`
+		MaxCommentSize     int                 `json:"max_comment_size"`
+		Admins             []string            `json:"admins"`
+		AdminEmail         string              `json:"admin_email"`
+		Auth               []string            `json:"auth_providers"`
+		AnonVote           bool                `json:"anon_vote"`
+		LowScore           int                 `json:"low_score"`
+		CriticalScore      int                 `json:"critical_score"`
+		PositiveScore      bool                `json:"positive_score"`
+		ReadOnlyAge        int                 `json:"readonly_age"`
+		MaxImageSize       int                 `json:"max_image_size"`
+		EmailNotifications bool                `json:"email_notifications"`
+		EmojiEnabled       bool                `json:"emoji_enabled"`
+		Reactions          []string            `json:"reactions"`
+		SimpleView         bool                `json:"simple_view"`
+		Replica            *replica.SiteStatus `json:"replica,omitempty"`
 	}{
 		Version:            s.Version,
-		EditDuration:       int(s.DataService.EditDuration.Seconds()),
-		MaxCommentSize:     s.DataService.MaxCommentSize,
+		EditDuration:       int(opts.EditDuration.Seconds()),
+		MaxCommentSize:     opts.MaxCommentSize,
 		Admins:             admins,
 		AdminEmail:         emails,
-		LowScore:           s.ScoreThresholds.Low,
-		CriticalScore:      s.ScoreThresholds.Critical,
-		PositiveScore:      s.DataService.PositiveScore,
-		ReadOnlyAge:        s.ReadOnlyAge,
+		LowScore:           opts.LowScore,
+		CriticalScore:      opts.CriticalScore,
+		PositiveScore:      opts.PositiveScore,
+		ReadOnlyAge:        opts.ReadOnlyAge,
 		MaxImageSize:       s.ImageService.MaxSize,
 		EmailNotifications: s.EmailNotifications,
-		EmojiEnabled:       s.EmojiEnabled,
-		AnonVote:           s.AnonVote,
+		EmojiEnabled:       opts.EmojiEnabled,
+		Reactions:          opts.Reactions,
+		AnonVote:           opts.AnonVote,
 		SimpleView:         s.SimpleView,
 	}
 
@@ -444,9 +511,17 @@ func (s *Rest) configCtrl(w http.ResponseWriter, r *http.Request) {
 		cnf.Auth = append(cnf.Auth, ap.Name())
 	}
 
+	if s.Replica != nil {
+		st := s.Replica.Status(siteID)
+		cnf.Replica = &st
+	}
+
 	if cnf.Admins == nil { // prevent json serialization to nil
 		cnf.Admins = []string{}
 	}
+	if cnf.Reactions == nil {
+		cnf.Reactions = []string{}
+	}
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, cnf)
 }
@@ -533,6 +608,52 @@ func URLKeyWithUser(r *http.Request) string {
 	return key
 }
 
+// mutedKey adds hash of users muted by the viewer to the cache key. Changes of muted users don't need cache flush,
+// and viewers muted the same users share cached response
+func mutedKey(key string, muted []string) string {
+	if len(muted) == 0 {
+		return key
+	}
+	return key + "!!muted!!" + store.EncodeID(strings.Join(muted, ","))
+}
+
+// markMuted sets Muted flag of comments written by muted users, to collapse them on the viewer's side
+func markMuted(comments []store.Comment, muted []string) []store.Comment {
+	if len(muted) == 0 {
+		return comments
+	}
+	users := make(map[string]bool, len(muted))
+	for _, m := range muted {
+		users[m] = true
+	}
+	for i := range comments {
+		comments[i].Muted = users[comments[i].User.ID]
+	}
+	return comments
+}
+
+// proxyToPrimary is a middleware of read-only replica sending to primary all writes
+// and reads of data not replicated, i.e. search, history, pictures, avatars and admin api
+func (s *Rest) proxyToPrimary(next http.Handler) http.Handler {
+	primaryOnly := []string{"/auth/", "/avatar/", "/api/v1/avatar/", "/api/v1/admin/", "/api/v1/picture/",
+		"/api/v1/search", "/api/v1/email", "/email/"}
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions ||
+			strings.HasSuffix(r.URL.Path, "/history") {
+			s.PrimaryProxy.ServeHTTP(w, r)
+			return
+		}
+		for _, prefix := range primaryOnly {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				s.PrimaryProxy.ServeHTTP(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
 // rejectAnonUser is a middleware rejecting anonymous users
 func rejectAnonUser(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
@@ -576,6 +697,23 @@ func matchSiteID(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// basicAdminOnly is a middleware allowing basic auth admin user only, i.e. for actions affecting all sites
+func basicAdminOnly(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user, err := rest.GetUserInfo(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if user.Name != "admin" || user.ID != "admin" {
+			http.Error(w, "Access denied", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
 // cacheControl is a middleware setting cache expiration. Using url+version as etag
 func cacheControl(expiration time.Duration, version string) func(http.Handler) http.Handler {
 
@@ -622,6 +760,9 @@ func parseError(err error, defaultCode int) (code int) {
 	case strings.HasPrefix(err.Error(), "parent comment with reply can't be edited"):
 		code = rest.ErrCommentEditChanged
 
+	// report errors
+	case strings.Contains(err.Error(), "can not report his own comment"):
+		code = rest.ErrReportSelf
 	}
 
 	return code
@@ -21,10 +21,12 @@ import (
 	log "github.com/go-pkgz/lgr"
 	R "github.com/go-pkgz/rest"
 	"github.com/hashicorp/go-multierror"
+	"github.com/kyokomi/emoji"
 
 	"github.com/umputun/remark42/backend/app/notify"
 	"github.com/umputun/remark42/backend/app/rest"
 	"github.com/umputun/remark42/backend/app/store"
+	adminstore "github.com/umputun/remark42/backend/app/store/admin"
 	"github.com/umputun/remark42/backend/app/store/engine"
 	"github.com/umputun/remark42/backend/app/store/image"
 	"github.com/umputun/remark42/backend/app/store/service"
@@ -41,6 +43,7 @@ type private struct {
 	authenticator    *auth.Service
 	remarkURL        string
 	anonVote         bool
+	emojiEnabled     bool
 	templates        templates.FileReader
 }
 
@@ -48,16 +51,31 @@ type privStore interface {
 	Create(comment store.Comment) (commentID string, err error)
 	EditComment(locator store.Locator, commentID string, req service.EditRequest) (comment store.Comment, err error)
 	Vote(req service.VoteReq) (comment store.Comment, err error)
+	Report(req service.ReportRequest) (comment store.Comment, first bool, err error)
 	Get(locator store.Locator, commentID string, user store.User) (store.Comment, error)
 	User(siteID, userID string, limit, skip int, user store.User) ([]store.Comment, error)
 	GetUserEmail(siteID string, userID string) (string, error)
 	SetUserEmail(siteID string, userID string, value string) (string, error)
+	Subscribe(locator store.Locator, userID, commentID string) (store.Subscription, error)
+	Unsubscribe(locator store.Locator, userID, commentID string) error
+	UnsubscribeByID(siteID, userID, subscriptionID string) error
+	Subscriptions(locator store.Locator, userID string) ([]store.Subscription, error)
+	GetUserDigest(siteID, userID string) (store.DigestMode, error)
+	SetUserDigest(siteID, userID string, mode store.DigestMode) (store.DigestMode, error)
+	GetUserProfile(siteID, userID string) (service.ProfileDetails, error)
+	SetUserProfile(siteID, userID string, details service.ProfileDetails) (service.ProfileDetails, error)
+	MutedUsers(siteID, userID string) ([]string, error)
+	Mute(siteID, userID, mutedID string) ([]string, error)
+	Unmute(siteID, userID, mutedID string) ([]string, error)
 	DeleteUserDetail(siteID string, userID string, detail engine.UserDetail) error
 	ValidateComment(c *store.Comment) error
 	IsVerified(siteID string, userID string) bool
 	IsReadOnly(locator store.Locator) bool
 	IsBlocked(siteID string, userID string) bool
+	IsShadowBlocked(siteID string, userID string) bool
 	Info(locator store.Locator, readonlyAge int) (store.PostInfo, error)
+	SiteOptions(siteID string, global adminstore.SiteOptions) adminstore.SiteOptions
+	React(req service.ReactReq) (comment store.Comment, err error)
 }
 
 // POST /comment - adds comment, resets all immutable fields
@@ -87,6 +105,9 @@ func (s *private) createCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	comment = s.commentFormatter.Format(comment)
+	if s.siteOptions(comment.Locator.SiteID).EmojiEnabled {
+		comment.Text = emoji.Sprint(comment.Text)
+	}
 
 	// check if user blocked
 	if s.dataService.IsBlocked(comment.Locator.SiteID, comment.User.ID) {
@@ -104,6 +125,18 @@ func (s *private) createCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid comment", rest.ErrCommentValidation)
 		return
 	}
+	if err == service.ErrSpamDetected {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "comment rejected", rest.ErrCommentSpam)
+		return
+	}
+	var rateErr *service.RateLimitError
+	if errors.As(err, &rateErr) {
+		retryAfter := int((rateErr.RetryAfter + time.Second - 1) / time.Second) // in seconds, rounded up
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err,
+			fmt.Sprintf("too many comments, retry after %d seconds", retryAfter), rest.ErrRateLimited)
+		return
+	}
 	if err != nil {
 		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't save comment", rest.ErrInternal)
 		return
@@ -118,7 +151,8 @@ func (s *private) createCommentCtrl(w http.ResponseWriter, r *http.Request) {
 	s.cache.Flush(cache.Flusher(comment.Locator.SiteID).
 		Scopes(comment.Locator.URL, lastCommentsScope, comment.User.ID, comment.Locator.SiteID))
 
-	if s.notifyService != nil {
+	// pending comment notifies on approval, comments of shadow blocked user don't notify anyone
+	if s.notifyService != nil && !finalComment.Pending && !s.dataService.IsShadowBlocked(comment.Locator.SiteID, comment.User.ID) {
 		s.notifyService.Submit(notify.Request{Comment: finalComment})
 	}
 
@@ -161,11 +195,16 @@ func (s *private) updateCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	text := s.commentFormatter.FormatText(edit.Text)
+	if s.siteOptions(locator.SiteID).EmojiEnabled {
+		text = emoji.Sprint(text)
+	}
 	editReq := service.EditRequest{
-		Text:    s.commentFormatter.FormatText(edit.Text),
-		Orig:    edit.Text,
-		Summary: edit.Summary,
-		Delete:  edit.Delete,
+		Text:     text,
+		Orig:     edit.Text,
+		Summary:  edit.Summary,
+		Delete:   edit.Delete,
+		EditorID: user.ID,
 	}
 
 	res, err := s.dataService.EditComment(locator, id, editReq)
@@ -173,6 +212,10 @@ func (s *private) updateCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid comment", rest.ErrCommentValidation)
 		return
 	}
+	if err == service.ErrSpamDetected {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "comment rejected", rest.ErrCommentSpam)
+		return
+	}
 
 	if err != nil {
 		code := parseError(err, rest.ErrCommentRejected)
@@ -180,7 +223,14 @@ func (s *private) updateCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.SiteID, locator.URL, lastCommentsScope, user.ID))
+	s.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.SiteID, locator.URL, lastCommentsScope, user.ID, currComment.User.ID))
+	if s.notifyService != nil && !s.dataService.IsShadowBlocked(locator.SiteID, currComment.User.ID) {
+		event := notify.EventUpdate
+		if edit.Delete {
+			event = notify.EventDelete
+		}
+		s.notifyService.Submit(notify.Request{Comment: res, Event: event})
+	}
 	render.JSON(w, r, res)
 }
 
@@ -205,11 +255,11 @@ func (s *private) userInfoCtrl(w http.ResponseWriter, r *http.Request) {
 // PUT /vote/{id}?site=siteID&url=post-url&vote=1 - vote for/against comment
 func (s *private) voteCtrl(w http.ResponseWriter, r *http.Request) {
 	user := rest.MustGetUserInfo(r)
-	if !s.anonVote && strings.HasPrefix(user.ID, "anonymous_") {
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	if !s.siteOptions(locator.SiteID).AnonVote && strings.HasPrefix(user.ID, "anonymous_") {
 		http.Error(w, "Access denied", http.StatusForbidden)
 		return
 	}
-	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
 	id := chi.URLParam(r, "id")
 	log.Printf("[DEBUG] vote for comment %s", id)
 
@@ -240,9 +290,89 @@ func (s *private) voteCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	s.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL, comment.User.ID))
+	if s.notifyService != nil {
+		s.notifyService.Submit(notify.Request{Comment: comment, Event: notify.EventVote})
+	}
 	render.JSON(w, r, R.JSON{"id": comment.ID, "score": comment.Score})
 }
 
+// PUT /reaction/{id}?site=siteID&url=post-url&reaction=👍, adds reaction of the user, remove=1 removes it
+func (s *private) reactionCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	if !s.siteOptions(locator.SiteID).AnonVote && strings.HasPrefix(user.ID, "anonymous_") {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	log.Printf("[DEBUG] reaction for comment %s", id)
+
+	if s.isReadOnly(locator) {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("rejected"), "old post, read-only", rest.ErrReadOnly)
+		return
+	}
+
+	if s.dataService.IsBlocked(locator.SiteID, user.ID) {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("rejected"), "user blocked", rest.ErrUserBlocked)
+		return
+	}
+
+	req := service.ReactReq{
+		Locator:   locator,
+		CommentID: id,
+		UserID:    user.ID,
+		Reaction:  r.URL.Query().Get("reaction"),
+		Remove:    r.URL.Query().Get("remove") == "1",
+	}
+	comment, err := s.dataService.React(req)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't react to comment", rest.ErrReactionRejected)
+		return
+	}
+	s.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL, comment.User.ID))
+	render.JSON(w, r, R.JSON{"id": comment.ID, "reactions": comment.Reactions, "reacted": comment.Reacted})
+}
+
+// reportCtrl reports comment to admins, body is {"reason": "spam|abuse|offtopic|other", "text": "optional details"}
+// POST /report/{id}?site=siteID&url=post-url
+func (s *private) reportCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	id := chi.URLParam(r, "id")
+	log.Printf("[DEBUG] report for comment %s", id)
+
+	req := struct {
+		Reason store.ReportReason `json:"reason"`
+		Text   string             `json:"text"`
+	}{}
+	if err := render.DecodeJSON(http.MaxBytesReader(w, r.Body, hardBodyLimit), &req); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind report", rest.ErrDecode)
+		return
+	}
+
+	if s.dataService.IsBlocked(locator.SiteID, user.ID) {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("rejected"), "user blocked", rest.ErrUserBlocked)
+		return
+	}
+
+	comment, first, err := s.dataService.Report(service.ReportRequest{Locator: locator, CommentID: id, User: user,
+		Reason: req.Reason, Text: req.Text})
+	if err != nil {
+		code := parseError(err, rest.ErrReportRejected)
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't report comment", code)
+		return
+	}
+	if comment.Pending { // hidden after too many reports
+		s.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL, lastCommentsScope, comment.User.ID))
+	}
+
+	if first && s.notifyService != nil {
+		s.notifyService.Submit(notify.Request{Comment: comment, Report: &store.Report{Locator: comment.Locator,
+			CommentID: comment.ID, UserID: user.ID, Reason: req.Reason, Text: req.Text, Timestamp: time.Now()}})
+	}
+	render.JSON(w, r, R.JSON{"id": comment.ID, "reported": true})
+}
+
 // getEmailCtrl gets email address for authenticated user.
 // GET /email?site=siteID
 func (s *private) getEmailCtrl(w http.ResponseWriter, r *http.Request) {
@@ -375,13 +505,23 @@ func (s *private) emailUnsubscribeCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 
 	elems := strings.Split(confClaims.Handshake.ID, "::")
-	if len(elems) != 2 {
+	if len(elems) != 2 && len(elems) != 3 {
 		rest.SendErrorHTML(w, r, http.StatusBadRequest, errors.New(confClaims.Handshake.ID), "invalid handshake token", rest.ErrInternal, s.templates)
 		return
 	}
 	userID := elems[0]
 	address := elems[1]
 
+	if len(elems) == 3 { // unsubscribe from single post or thread, email kept
+		log.Printf("[DEBUG] unsubscribe user %s from %s", userID, elems[2])
+		if err = s.dataService.UnsubscribeByID(siteID, userID, elems[2]); err != nil {
+			rest.SendErrorHTML(w, r, http.StatusConflict, err, "user does not have this subscription", rest.ErrInternal, s.templates)
+			return
+		}
+		s.renderUnsubscribed(w, r)
+		return
+	}
+
 	existingAddress, err := s.dataService.GetUserEmail(siteID, userID)
 	if err != nil {
 		log.Printf("[WARN] can't read email for %s, %v", userID, err)
@@ -415,6 +555,11 @@ func (s *private) emailUnsubscribeCtrl(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	s.renderUnsubscribed(w, r)
+}
+
+// renderUnsubscribed responds with unsubscribe confirmation page
+func (s *private) renderUnsubscribed(w http.ResponseWriter, r *http.Request) {
 	// MustExecute behaves like template.Execute, but panics if an error occurs.
 	MustExecute := func(tmpl *template.Template, wr io.Writer, data interface{}) {
 		if err := tmpl.Execute(wr, data); err != nil {
@@ -435,6 +580,159 @@ func (s *private) emailUnsubscribeCtrl(w http.ResponseWriter, r *http.Request) {
 	render.HTML(w, r, msg.String())
 }
 
+// GET /email/subscriptions?site=siteID - list of user's email subscriptions to posts and threads
+func (s *private) subscriptionsCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+
+	subs, err := s.dataService.Subscriptions(store.Locator{SiteID: siteID}, user.ID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get subscriptions", rest.ErrSiteNotFound)
+		return
+	}
+	render.JSON(w, r, subs)
+}
+
+// PUT /email/subscription?site=siteID&url=post-url&id=comment-id - subscribe to all new comments of the post,
+// or to the thread of the comment if id set. Requires confirmed email
+func (s *private) subscribeCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	commentID := r.URL.Query().Get("id")
+
+	address, err := s.dataService.GetUserEmail(locator.SiteID, user.ID)
+	if err != nil {
+		log.Printf("[WARN] can't read email for %s, %v", user.ID, err)
+	}
+	if address == "" {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.New("no email"), "confirmed email address is required", rest.ErrNoEmail)
+		return
+	}
+
+	log.Printf("[DEBUG] subscribe user %s to %s %s", user.ID, locator.URL, commentID)
+	sub, err := s.dataService.Subscribe(locator, user.ID, commentID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't subscribe", rest.ErrActionRejected)
+		return
+	}
+	render.JSON(w, r, sub)
+}
+
+// DELETE /email/subscription?site=siteID&url=post-url&id=comment-id - unsubscribe from the post or from the thread
+func (s *private) unsubscribeCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	commentID := r.URL.Query().Get("id")
+
+	log.Printf("[DEBUG] unsubscribe user %s from %s %s", user.ID, locator.URL, commentID)
+	if err := s.dataService.Unsubscribe(locator, user.ID, commentID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't unsubscribe", rest.ErrActionRejected)
+		return
+	}
+	render.JSON(w, r, R.JSON{"url": locator.URL, "id": commentID, "subscribed": false})
+}
+
+// GET /email/digest?site=siteID - delivery mode of user's email notifications
+func (s *private) getDigestCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+
+	mode, err := s.dataService.GetUserDigest(siteID, user.ID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get digest mode", rest.ErrSiteNotFound)
+		return
+	}
+	render.JSON(w, r, R.JSON{"digest": mode})
+}
+
+// PUT /email/digest?site=siteID&mode=immediate|hourly|daily - sets delivery mode of user's email notifications
+func (s *private) setDigestCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+	mode := store.DigestMode(r.URL.Query().Get("mode"))
+
+	log.Printf("[DEBUG] set digest mode %s for user %s", mode, user.ID)
+	mode, err := s.dataService.SetUserDigest(siteID, user.ID, mode)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set digest mode", rest.ErrActionRejected)
+		return
+	}
+	render.JSON(w, r, R.JSON{"digest": mode})
+}
+
+// GET /profile?site=siteID - profile details of the user, bio and website
+func (s *private) getProfileCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+
+	details, err := s.dataService.GetUserProfile(siteID, user.ID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get profile", rest.ErrSiteNotFound)
+		return
+	}
+	render.JSON(w, r, details)
+}
+
+// PUT /profile?site=siteID - sets profile details of the user, body is {"bio": "about me", "website": "https://example.com"}
+// empty value removes the detail
+func (s *private) setProfileCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+
+	details := service.ProfileDetails{}
+	if err := render.DecodeJSON(http.MaxBytesReader(w, r.Body, hardBodyLimit), &details); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind profile", rest.ErrDecode)
+		return
+	}
+	if s.dataService.IsBlocked(siteID, user.ID) {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("rejected"), "user blocked", rest.ErrUserBlocked)
+		return
+	}
+
+	log.Printf("[DEBUG] set profile for user %s", user.ID)
+	details, err := s.dataService.SetUserProfile(siteID, user.ID, details)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set profile", rest.ErrActionRejected)
+		return
+	}
+	s.cache.Flush(cache.Flusher(siteID).Scopes(user.ID))
+	render.JSON(w, r, details)
+}
+
+// GET /mute?site=siteID - list of users muted by the user
+func (s *private) mutedUsersCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+
+	muted, err := s.dataService.MutedUsers(siteID, user.ID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get muted users", rest.ErrSiteNotFound)
+		return
+	}
+	render.JSON(w, r, R.JSON{"muted": muted})
+}
+
+// PUT /mute/{userid}?site=siteID - mutes user, comments of muted users collapsed in comments of post and omitted
+// from last comments and replies feed of the user. DELETE /mute/{userid}?site=siteID unmutes user
+func (s *private) muteCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+	mutedID := chi.URLParam(r, "userid")
+
+	unmute := r.Method == http.MethodDelete
+	log.Printf("[DEBUG] mute user %s for %s, unmute=%v", mutedID, user.ID, unmute)
+	mute := s.dataService.Mute
+	if unmute {
+		mute = s.dataService.Unmute
+	}
+	muted, err := mute(siteID, user.ID, mutedID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't change muted users", rest.ErrActionRejected)
+		return
+	}
+	render.JSON(w, r, R.JSON{"muted": muted})
+}
+
 // DELETE /email?site=siteID - removes user's email
 func (s *private) deleteEmailCtrl(w http.ResponseWriter, r *http.Request) {
 	user := rest.MustGetUserInfo(r)
@@ -577,11 +875,17 @@ func (s *private) savePictureCtrl(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *private) isReadOnly(locator store.Locator) bool {
-	if s.readOnlyAge > 0 {
+	if readOnlyAge := s.siteOptions(locator.SiteID).ReadOnlyAge; readOnlyAge > 0 {
 		// check RO by age
-		if info, e := s.dataService.Info(locator, s.readOnlyAge); e == nil && info.ReadOnly {
+		if info, e := s.dataService.Info(locator, readOnlyAge); e == nil && info.ReadOnly {
 			return true
 		}
 	}
 	return s.dataService.IsReadOnly(locator) // ro manually
 }
+
+// siteOptions returns options of the site, global options with site settings applied
+func (s *private) siteOptions(siteID string) adminstore.SiteOptions {
+	return s.dataService.SiteOptions(siteID, adminstore.SiteOptions{ReadOnlyAge: s.readOnlyAge, AnonVote: s.anonVote,
+		EmojiEnabled: s.emojiEnabled})
+}
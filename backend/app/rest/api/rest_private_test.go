@@ -11,6 +11,8 @@ import (
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
 	"testing"
@@ -25,8 +27,12 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/rest"
 	"github.com/umputun/remark42/backend/app/store"
 	"github.com/umputun/remark42/backend/app/store/image"
+	"github.com/umputun/remark42/backend/app/store/limiter"
+	"github.com/umputun/remark42/backend/app/store/service"
+	"github.com/umputun/remark42/backend/app/store/spam"
 )
 
 // gopher png for test, from https://golang.org/src/image/png/example_test.go
@@ -54,6 +60,36 @@ func TestRest_Create(t *testing.T) {
 	assert.True(t, len(c["id"].(string)) > 8)
 }
 
+func TestRest_CreateWithMentions(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	srv.CommentFormatter.Mentions, srv.CommentFormatter.MaxMentions = srv.DataService, 5
+
+	create := func(text, token string) store.Comment {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment", strings.NewReader(
+			fmt.Sprintf(`{"text": %q, "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`, text)))
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, token)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		c := store.Comment{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&c))
+		require.NoError(t, resp.Body.Close())
+		return c
+	}
+
+	first := create("first comment", adminUmputunToken)
+	c := create("@umputun, thanks and @nobody", devToken)
+	assert.Equal(t, fmt.Sprintf(`<p><a href="https://radio-t.com/blah1#remark42__comment-%s" rel="nofollow">@umputun</a>, `+
+		"thanks and @nobody</p>\n", first.ID), c.Text)
+	assert.Equal(t, []string{"github_ef0f706a7"}, c.Mentions)
+
+	srv.CommentFormatter.MaxMentions = 0
+	c = create("@umputun, thanks", devToken)
+	assert.Equal(t, "<p>@umputun, thanks</p>\n", c.Text, "mentions disabled")
+	assert.Nil(t, c.Mentions)
+}
+
 func TestRest_CreateOldPost(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
@@ -138,6 +174,61 @@ func TestRest_CreateWithRestrictedWord(t *testing.T) {
 	assert.Equal(t, "invalid comment", c["details"])
 }
 
+func TestRest_CreateSpam(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	akismet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("true"))
+	}))
+	defer akismet.Close()
+	srv.DataService.SpamFilter.Checker = spam.NewAkismet(spam.AkismetParams{URL: akismet.URL, Key: "key"})
+	srv.DataService.SpamFilter.Threshold = 0.9
+	srv.DataService.SpamFilter.Reject = true
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment",
+		strings.NewReader(`{"text": "buy pills", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`))
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, devToken) // admin comments not checked
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	c := R.JSON{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&c))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "comment rejected as spam", c["error"])
+	assert.Equal(t, float64(rest.ErrCommentSpam), c["code"])
+}
+
+func TestRest_CreateRateLimited(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	srv.DataService.RateLimit.Policy = func(string) service.RateLimitPolicy {
+		return service.RateLimitPolicy{RateLimits: service.RateLimits{Interval: time.Minute}}
+	}
+	srv.DataService.RateLimit.Limiter = &limiter.Limiter{Store: limiter.NewMemStore()}
+
+	create := func() *http.Response {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment",
+			strings.NewReader(`{"text": "test 123", "locator":{"url": "https://radio-t.com/blah1", "site": "remark42"}}`))
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, devToken)
+		require.NoError(t, err)
+		return resp
+	}
+	resp := create()
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = create()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+	c := R.JSON{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&c))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "too many comments, retry after 60 seconds", c["details"])
+	assert.Equal(t, float64(rest.ErrRateLimited), c["code"])
+}
+
 func TestRest_CreateRejected(t *testing.T) {
 
 	ts, _, teardown := startupT(t)
@@ -461,6 +552,75 @@ func TestRest_Vote(t *testing.T) {
 	assert.Equal(t, map[string]bool(nil), cr.Votes)
 }
 
+func TestRest_Reaction(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	id := addComment(t, c, ts)
+
+	react := func(reaction, token, extra string) (int, R.JSON) {
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/api/v1/reaction/%s?site=remark42&url=https://radio-t.com/blah&reaction=%s%s",
+			ts.URL, id, url.QueryEscape(reaction), extra), nil)
+		require.NoError(t, err)
+		req.Header.Add("X-JWT", token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res := R.JSON{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, res
+	}
+
+	code, _ := react("👍", devToken, "")
+	assert.Equal(t, http.StatusBadRequest, code, "reactions disabled")
+
+	srv.DataService.Reactions = []string{"👍", "😂"}
+	code, res := react("👍", devToken, "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"👍": 1.0}, res["reactions"])
+	assert.Equal(t, []interface{}{"👍"}, res["reacted"])
+	code, res = react("👍", devToken, "")
+	assert.Equal(t, http.StatusBadRequest, code, "second reaction of the same type rejected")
+	assert.Equal(t, float64(rest.ErrReactionRejected), res["code"])
+	code, _ = react("😂", devToken, "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = react("😂", adminUmputunToken, "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = react("🔥", adminUmputunToken, "")
+	assert.Equal(t, http.StatusBadRequest, code, "not in the set")
+
+	body, code := getWithDevAuth(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah&format=tree")
+	require.Equal(t, http.StatusOK, code)
+	tree := struct {
+		Nodes []struct {
+			Comment store.Comment `json:"comment"`
+		} `json:"comments"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(body), &tree))
+	require.Equal(t, 1, len(tree.Nodes))
+	assert.Equal(t, map[string]int{"👍": 1, "😂": 2}, tree.Nodes[0].Comment.Reactions)
+	assert.Equal(t, []string{"👍", "😂"}, tree.Nodes[0].Comment.Reacted)
+	assert.Nil(t, tree.Nodes[0].Comment.ReactedBy)
+
+	code, res = react("😂", devToken, "&remove=1")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"👍": 1.0, "😂": 1.0}, res["reactions"])
+	assert.Equal(t, []interface{}{"👍"}, res["reacted"])
+
+	body, code = get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code)
+	comments := commentsWithInfo{}
+	require.NoError(t, json.Unmarshal([]byte(body), &comments))
+	require.Equal(t, 1, len(comments.Comments))
+	assert.Equal(t, map[string]int{"👍": 1, "😂": 1}, comments.Comments[0].Reactions)
+	assert.Nil(t, comments.Comments[0].Reacted, "anonymous reader")
+
+	body, code = get(t, ts.URL+"/api/v1/config?site=remark42")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"reactions":["👍","😂"]`)
+}
+
 func TestRest_AnonVote(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
@@ -519,6 +679,200 @@ func (fs *MockFS) ReadFile(path string) ([]byte, error) {
 	return []byte(fmt.Sprintf("template %s", path)), nil
 }
 
+func TestRest_Report(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	srv.DataService.ReportThreshold = map[string]int{"remark42": 2}
+	mockDestination := &notify.MockDest{}
+	srv.privRest.notifyService = notify.NewService(srv.DataService, 1, mockDestination)
+	defer srv.privRest.notifyService.Close()
+
+	c := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	id := addComment(t, c, ts)
+
+	report := func(body, tkn string) (int, R.JSON) {
+		req, err := http.NewRequest(http.MethodPost,
+			fmt.Sprintf("%s/api/v1/report/%s?site=remark42&url=https://radio-t.com/blah", ts.URL, id), strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, tkn)
+		require.NoError(t, err)
+		res := R.JSON{}
+		_ = json.NewDecoder(resp.Body).Decode(&res)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, res
+	}
+
+	code, _ := report(`{"reason":"spam"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, res := report(`{"reason":"spam"}`, devToken)
+	assert.Equal(t, http.StatusBadRequest, code, "own comment")
+	assert.Equal(t, float64(rest.ErrReportSelf), res["code"])
+
+	code, res = report(`{"reason":"bad"}`, adminUmputunToken)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, float64(rest.ErrReportRejected), res["code"])
+
+	code, _ = report(`{"reason":`, adminUmputunToken)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, res = report(`{"reason":"abuse","text":"rude"}`, adminUmputunToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, R.JSON{"id": id, "reported": true}, res)
+	time.Sleep(time.Millisecond * 30)
+	require.Equal(t, 2, len(mockDestination.Get()), "new comment and report notifications")
+	reported := mockDestination.Get()[1]
+	require.NotNil(t, reported.Report)
+	assert.Equal(t, id, reported.Comment.ID)
+	assert.Equal(t, store.ReportAbuse, reported.Report.Reason)
+	assert.Equal(t, "rude", reported.Report.Text)
+
+	code, _ = report(`{"reason":"spam"}`, anonToken)
+	assert.Equal(t, http.StatusOK, code)
+	time.Sleep(time.Millisecond * 30)
+	assert.Equal(t, 2, len(mockDestination.Get()), "only the first report notifies")
+
+	body, code := get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code)
+	comments := commentsWithInfo{}
+	require.NoError(t, json.Unmarshal([]byte(body), &comments))
+	assert.Equal(t, 0, len(comments.Comments), "hidden after reaching threshold")
+}
+
+func TestRest_SetProfile(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	addComment(t, c, ts)
+	res, code := get(t, ts.URL+"/api/v1/profile/dev?site=remark42")
+	require.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, res, `"bio"`)
+
+	send := func(method, body, tkn string) (int, R.JSON) {
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/profile?site=remark42", strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, tkn)
+		require.NoError(t, err)
+		res := R.JSON{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, res
+	}
+
+	code, resp := send(http.MethodPut, `{"bio":"<b>about</b> me","website":"https://example.com"}`, devToken)
+	require.Equal(t, http.StatusOK, code, resp)
+	assert.Equal(t, R.JSON{"bio": "about me", "website": "https://example.com"}, resp)
+	code, resp = send(http.MethodGet, "", devToken)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, R.JSON{"bio": "about me", "website": "https://example.com"}, resp)
+
+	res, code = get(t, ts.URL+"/api/v1/profile/dev?site=remark42")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, res, `"bio":"about me","website":"https://example.com"`, "cached profile flushed")
+
+	code, resp = send(http.MethodPut, `{"website":"javascript:alert(1)"}`, devToken)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, float64(rest.ErrActionRejected), resp["code"])
+	code, _ = send(http.MethodPut, `{"bio":`, devToken)
+	assert.Equal(t, http.StatusBadRequest, code, "bad json")
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/profile?site=remark42", strings.NewReader(`{"bio":"about me"}`))
+	require.NoError(t, err)
+	r, err := sendReq(t, req, "")
+	require.NoError(t, err)
+	require.NoError(t, r.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, r.StatusCode)
+
+	require.NoError(t, srv.DataService.SetBlock("remark42", "dev", true, time.Hour))
+	code, resp = send(http.MethodPut, `{"bio":"spam"}`, devToken)
+	assert.Equal(t, http.StatusForbidden, code, "blocked user can't change profile")
+	assert.Equal(t, float64(rest.ErrUserBlocked), resp["code"])
+
+	details, err := srv.DataService.GetUserProfile("remark42", "dev")
+	require.NoError(t, err)
+	assert.Equal(t, service.ProfileDetails{Bio: "about me", Website: "https://example.com"}, details)
+}
+
+func TestRest_Mute(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	locator := store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}
+	id := addComment(t, store.Comment{Text: "test test #1", Locator: locator}, ts)
+	_, err := srv.DataService.Create(store.Comment{Text: "reply from spammer", ParentID: id, Locator: locator,
+		User: store.User{ID: "spammer", Name: "spammer"}})
+	require.NoError(t, err)
+
+	send := func(method, url string) (int, R.JSON) {
+		req, e := http.NewRequest(method, ts.URL+url, nil)
+		require.NoError(t, e)
+		resp, e := sendReq(t, req, devToken)
+		require.NoError(t, e)
+		res := R.JSON{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, res
+	}
+	findMuted := func(body string) (muted []string) {
+		resp := commentsWithInfo{}
+		require.NoError(t, json.Unmarshal([]byte(body), &resp))
+		require.Equal(t, 2, len(resp.Comments), "muted comments collapsed, not omitted")
+		for _, c := range resp.Comments {
+			if c.Muted {
+				muted = append(muted, c.User.ID)
+			}
+		}
+		return muted
+	}
+
+	// cache responses before mute
+	body, code := getWithDevAuth(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, findMuted(body))
+	body, code = get(t, ts.URL+"/api/v1/rss/reply?user=dev&site=remark42")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "reply from spammer")
+
+	code, res := send(http.MethodPut, "/api/v1/mute/spammer?site=remark42")
+	require.Equal(t, http.StatusOK, code, res)
+	assert.Equal(t, R.JSON{"muted": []interface{}{"spammer"}}, res)
+	code, res = send(http.MethodGet, "/api/v1/mute?site=remark42")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, R.JSON{"muted": []interface{}{"spammer"}}, res)
+	code, res = send(http.MethodPut, "/api/v1/mute/dev?site=remark42")
+	assert.Equal(t, http.StatusBadRequest, code, "can't mute self")
+	assert.Equal(t, float64(rest.ErrActionRejected), res["code"])
+
+	body, code = getWithDevAuth(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"spammer"}, findMuted(body))
+	body, code = get(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, findMuted(body), "nothing muted for anonymous viewer")
+
+	body, code = getWithDevAuth(t, ts.URL+"/api/v1/last/10?site=remark42")
+	require.Equal(t, http.StatusOK, code)
+	last := []store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &last))
+	require.Equal(t, 1, len(last), "muted omitted from last comments")
+	assert.Equal(t, "dev", last[0].User.ID)
+	body, code = get(t, ts.URL+"/api/v1/last/10?site=remark42")
+	require.Equal(t, http.StatusOK, code)
+	require.NoError(t, json.Unmarshal([]byte(body), &last))
+	assert.Equal(t, 2, len(last))
+
+	body, code = get(t, ts.URL+"/api/v1/rss/reply?user=dev&site=remark42")
+	require.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, body, "reply from spammer", "muted omitted from replies feed")
+
+	code, res = send(http.MethodDelete, "/api/v1/mute/spammer?site=remark42")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, R.JSON{"muted": []interface{}{}}, res)
+	body, code = getWithDevAuth(t, ts.URL+"/api/v1/find?site=remark42&url=https://radio-t.com/blah")
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, findMuted(body), "unmuted")
+}
+
 func TestRest_Email(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
@@ -590,6 +944,159 @@ func TestRest_Email(t *testing.T) {
 	}
 }
 
+func TestRest_EmailSubscription(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	srv.privRest.templates = &MockFS{}
+
+	c := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}
+	id := addComment(t, c, ts)
+
+	send := func(method, url, tkn string) (int, []byte) {
+		req, err := http.NewRequest(method, ts.URL+url, nil)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, tkn)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, body
+	}
+	postURL := "/api/v1/email/subscription?site=remark42&url=https://radio-t.com/blah"
+
+	code, body := send(http.MethodPut, postURL, devToken)
+	assert.Equal(t, http.StatusBadRequest, code, "no confirmed email")
+	assert.Contains(t, string(body), fmt.Sprintf(`"code":%d`, rest.ErrNoEmail))
+	code, _ = send(http.MethodPut, postURL, anonToken)
+	assert.Equal(t, http.StatusForbidden, code, "anonymous can't subscribe")
+	code, _ = send(http.MethodPut, postURL, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	_, err := srv.DataService.SetUserEmail("remark42", "dev", "good@example.com")
+	require.NoError(t, err)
+	code, _ = send(http.MethodPut, postURL, devToken)
+	assert.Equal(t, http.StatusOK, code)
+	code, body = send(http.MethodPut, postURL+"&id="+id, devToken)
+	assert.Equal(t, http.StatusOK, code)
+	threadSub := store.Subscription{}
+	require.NoError(t, json.Unmarshal(body, &threadSub))
+	assert.Equal(t, id, threadSub.CommentID)
+	code, _ = send(http.MethodPut, postURL+"&id=bad", devToken)
+	assert.Equal(t, http.StatusBadRequest, code, "no such comment")
+
+	subscriptions := func() (res []store.Subscription) {
+		code, body := send(http.MethodGet, "/api/v1/email/subscriptions?site=remark42", devToken)
+		require.Equal(t, http.StatusOK, code)
+		require.NoError(t, json.Unmarshal(body, &res))
+		return res
+	}
+	assert.Equal(t, 2, len(subscriptions()))
+
+	// unsubscribe link from the email about reply in the thread
+	claims := token.Claims{
+		Handshake: &token.Handshake{ID: "dev::good@example.com::" + threadSub.ID()},
+		StandardClaims: jwt.StandardClaims{
+			Audience:  "remark42",
+			ExpiresAt: time.Now().Add(10 * time.Minute).Unix(),
+			NotBefore: time.Now().Add(-1 * time.Minute).Unix(),
+			Issuer:    "remark42",
+		},
+	}
+	tkn, err := srv.Authenticator.TokenService().Token(claims)
+	require.NoError(t, err)
+	code, _ = send(http.MethodPost, "/email/unsubscribe.html?site=remark42&tkn="+tkn, "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = send(http.MethodPost, "/email/unsubscribe.html?site=remark42&tkn="+tkn, "")
+	assert.Equal(t, http.StatusConflict, code, "already unsubscribed")
+	subs := subscriptions()
+	require.Equal(t, 1, len(subs))
+	assert.Equal(t, "", subs[0].CommentID, "post subscription kept")
+	email, err := srv.DataService.GetUserEmail("remark42", "dev")
+	require.NoError(t, err)
+	assert.Equal(t, "good@example.com", email, "email kept")
+
+	code, _ = send(http.MethodDelete, postURL, devToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 0, len(subscriptions()))
+}
+
+func TestRest_EmailDigest(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	send := func(method, url, tkn string) (int, []byte) {
+		req, err := http.NewRequest(method, ts.URL+url, nil)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, tkn)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, body
+	}
+
+	code, body := send(http.MethodGet, "/api/v1/email/digest?site=remark42", devToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"digest":"immediate"}`+"\n", string(body), "immediate by default")
+
+	code, body = send(http.MethodPut, "/api/v1/email/digest?site=remark42&mode=daily", devToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"digest":"daily"}`+"\n", string(body))
+	code, body = send(http.MethodGet, "/api/v1/email/digest?site=remark42", devToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"digest":"daily"}`+"\n", string(body))
+
+	code, body = send(http.MethodPut, "/api/v1/email/digest?site=remark42&mode=weekly", devToken)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, string(body), fmt.Sprintf(`"code":%d`, rest.ErrActionRejected))
+	code, _ = send(http.MethodPut, "/api/v1/email/digest?site=remark42&mode=hourly", anonToken)
+	assert.Equal(t, http.StatusForbidden, code, "anonymous can't set digest mode")
+}
+
+func TestRest_NotifyEvents(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	mockDestination := &notify.MockDest{}
+	srv.privRest.notifyService = notify.NewService(srv.DataService, 1, mockDestination)
+	srv.adminRest.notifyService = srv.privRest.notifyService
+	defer srv.privRest.notifyService.Close()
+
+	loc := "?site=remark42&url=https://radio-t.com/blah"
+	id := addComment(t, store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}, ts)
+	time.Sleep(50 * time.Millisecond)
+
+	send := func(method, url, body string) {
+		req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, devToken)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusOK, resp.StatusCode, url)
+		time.Sleep(50 * time.Millisecond)
+	}
+	send(http.MethodPut, "/api/v1/comment/"+id+loc, `{"text":"updated text"}`)
+	send(http.MethodPut, "/api/v1/vote/"+id+loc+"&vote=1", "")
+
+	req, err := http.NewRequest(http.MethodDelete, ts.URL+"/api/v1/admin/comment/"+id+loc, nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	time.Sleep(50 * time.Millisecond)
+
+	reqs := mockDestination.Get()
+	require.Equal(t, 4, len(reqs))
+	assert.Equal(t, notify.Event(""), reqs[0].Event, "new comment")
+	assert.Equal(t, notify.EventUpdate, reqs[1].Event)
+	assert.Equal(t, "updated text", reqs[1].Comment.Orig)
+	assert.Equal(t, notify.EventVote, reqs[2].Event)
+	assert.Equal(t, 1, reqs[2].Comment.Score)
+	assert.Equal(t, notify.EventDelete, reqs[3].Event)
+	assert.Equal(t, id, reqs[3].Comment.ID)
+}
+
 func TestRest_EmailNotification(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
@@ -17,18 +17,25 @@ import (
 	cache "github.com/go-pkgz/lcw"
 	log "github.com/go-pkgz/lgr"
 	R "github.com/go-pkgz/rest"
+	"github.com/kyokomi/emoji"
 	"github.com/pkg/errors"
 
 	"github.com/umputun/remark42/backend/app/rest"
 	"github.com/umputun/remark42/backend/app/store"
+	adminstore "github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/history"
 	"github.com/umputun/remark42/backend/app/store/image"
+	"github.com/umputun/remark42/backend/app/store/search"
 	"github.com/umputun/remark42/backend/app/store/service"
 )
 
+const profileCommentsLimit = 10 // default number of recent comments in user's profile
+
 type public struct {
 	dataService      pubStore
 	cache            LoadingCache
 	readOnlyAge      int
+	emojiEnabled     bool
 	commentFormatter *store.CommentFormatter
 	imageService     *image.Service
 	streamer         *Streamer
@@ -42,13 +49,18 @@ type pubStore interface {
 	Last(siteID string, limit int, since time.Time, user store.User) ([]store.Comment, error)
 	User(siteID, userID string, limit, skip int, user store.User) ([]store.Comment, error)
 	UserCount(siteID, userID string) (int, error)
+	Profile(siteID, userID string, limit int, user store.User) (service.UserProfile, error)
+	MutedUsers(siteID, userID string) ([]string, error)
 	Count(locator store.Locator) (int, error)
 	List(siteID string, limit int, skip int) ([]store.PostInfo, error)
 	Info(locator store.Locator, readonlyAge int) (store.PostInfo, error)
+	SiteOptions(siteID string, global adminstore.SiteOptions) adminstore.SiteOptions
 
 	ValidateComment(c *store.Comment) error
 	IsReadOnly(locator store.Locator) bool
 	Counts(siteID string, postIDs []string) ([]store.PostInfo, error)
+	Search(req search.Request) (search.Result, error)
+	History(locator store.Locator, commentID string, user store.User) ([]history.Version, error)
 }
 
 // GET /find?site=siteID&url=post-url&format=[tree|plain]&sort=[+/-time|+/-score|+/-controversy]&view=[user|all]&since=unix_ts_msec
@@ -73,17 +85,18 @@ func (s *public) findCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("[DEBUG] get comments for %+v, sort %s, format %s, since %v", locator, sort, format, since)
 
-	key := cache.NewKey(locator.SiteID).ID(URLKeyWithUser(r)).Scopes(locator.SiteID, locator.URL)
+	muted := s.mutedUsers(r, locator.SiteID)
+	key := cache.NewKey(locator.SiteID).ID(mutedKey(URLKeyWithUser(r), muted)).Scopes(locator.SiteID, locator.URL)
 	data, err := s.cache.Get(key, func() ([]byte, error) {
 		comments, e := s.dataService.FindSince(locator, sort, rest.GetUserOrEmpty(r), since)
 		if e != nil {
 			comments = []store.Comment{} // error should clear comments and continue for post info
 		}
-		comments = s.applyView(comments, view)
+		comments = s.applyView(markMuted(comments, muted), view)
 		var b []byte
 		switch format {
 		case "tree":
-			tree := service.MakeTree(comments, sort, s.readOnlyAge)
+			tree := service.MakeTree(comments, sort, s.siteOptions(locator.SiteID).ReadOnlyAge)
 			if tree.Nodes == nil { // eliminate json nil serialization
 				tree.Nodes = []*service.Node{}
 			}
@@ -93,7 +106,7 @@ func (s *public) findCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 			b, e = encodeJSONWithHTML(tree)
 		default:
 			withInfo := commentsWithInfo{Comments: comments}
-			if info, ee := s.dataService.Info(locator, s.readOnlyAge); ee == nil {
+			if info, ee := s.dataService.Info(locator, s.siteOptions(locator.SiteID).ReadOnlyAge); ee == nil {
 				withInfo.Info = info
 			}
 			b, e = encodeJSONWithHTML(withInfo)
@@ -132,6 +145,9 @@ func (s *public) previewCommentCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 
 	comment = s.commentFormatter.Format(comment)
+	if s.siteOptions(comment.Locator.SiteID).EmojiEnabled {
+		comment.Text = emoji.Sprint(comment.Text)
+	}
 	comment.Sanitize()
 	render.HTML(w, r, comment.Text)
 }
@@ -142,7 +158,7 @@ func (s *public) infoCtrl(w http.ResponseWriter, r *http.Request) {
 
 	key := cache.NewKey(locator.SiteID).ID(URLKey(r)).Scopes(locator.SiteID, locator.URL)
 	data, err := s.cache.Get(key, func() ([]byte, error) {
-		info, e := s.dataService.Info(locator, s.readOnlyAge)
+		info, e := s.dataService.Info(locator, s.siteOptions(locator.SiteID).ReadOnlyAge)
 		if e != nil {
 			return nil, e
 		}
@@ -177,7 +193,7 @@ func (s *public) infoStreamCtrl(w http.ResponseWriter, r *http.Request) {
 		return func() (event string, data []byte, upd bool, err error) {
 			key := cache.NewKey(locator.SiteID).ID(URLKey(r)).Scopes(locator.SiteID, locator.URL)
 			data, err = s.cache.Get(key, func() ([]byte, error) {
-				info, e := s.dataService.Info(locator, s.readOnlyAge)
+				info, e := s.dataService.Info(locator, s.siteOptions(locator.SiteID).ReadOnlyAge)
 				if e != nil {
 					return nil, e
 				}
@@ -219,15 +235,17 @@ func (s *public) lastCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	key := cache.NewKey(siteID).ID(URLKey(r)).Scopes(lastCommentsScope)
+	muted := s.mutedUsers(r, siteID)
+	key := cache.NewKey(siteID).ID(mutedKey(URLKey(r), muted)).Scopes(lastCommentsScope)
 	data, err := s.cache.Get(key, func() ([]byte, error) {
 		comments, e := s.dataService.Last(siteID, limit, sinceTime, rest.GetUserOrEmpty(r))
 		if e != nil {
 			return nil, e
 		}
 		// filter deleted from last comments view. Blocked marked as deleted and will sneak in without
-		filterDeleted := filterComments(comments, func(c store.Comment) bool { return !c.Deleted })
-		return encodeJSONWithHTML(filterDeleted)
+		// comments of muted users omitted
+		filtered := filterComments(markMuted(comments, muted), func(c store.Comment) bool { return !c.Deleted && !c.Muted })
+		return encodeJSONWithHTML(filtered)
 	})
 
 	if err != nil {
@@ -240,6 +258,42 @@ func (s *public) lastCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GET /search?site=siteID&q=query&url=post-url&user=user-id&from=unix_ts_msec&to=unix_ts_msec&limit=20&skip=10
+// full-text search of comments, the most relevant first. Query is a list of words and "quoted phrases", all required.
+// Deleted and pending comments found for admins only
+func (s *public) searchCtrl(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	user := rest.GetUserOrEmpty(r)
+	req := search.Request{SiteID: query.Get("site"), Query: query.Get("q"), URL: query.Get("url"),
+		UserID: query.Get("user"), Admin: user.Admin}
+	req.Limit, _ = strconv.Atoi(query.Get("limit"))
+	req.Skip, _ = strconv.Atoi(query.Get("skip"))
+	for param, ts := range map[string]*time.Time{"from": &req.From, "to": &req.To} {
+		if v := query.Get(param); v != "" {
+			msec, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't translate "+param+" parameter", rest.ErrDecode)
+				return
+			}
+			*ts = time.Unix(0, msec*1000000)
+		}
+	}
+
+	res, err := s.dataService.Search(req)
+	switch {
+	case errors.Cause(err) == search.ErrEmptyQuery:
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't search", rest.ErrDecode)
+		return
+	case errors.Cause(err) == service.ErrSearchDisabled:
+		rest.SendErrorJSON(w, r, http.StatusNotImplemented, err, "can't search", rest.ErrActionRejected)
+		return
+	case err != nil:
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't search", rest.ErrInternal)
+		return
+	}
+	render.JSON(w, r, res)
+}
+
 // GET /stream/last?site=siteID&since=unix_ts_ms - stream of last comments last comments for the siteID, across all posts
 func (s *public) lastCommentsStreamCtrl(w http.ResponseWriter, r *http.Request) {
 	siteID := r.URL.Query().Get("site")
@@ -290,7 +344,11 @@ func (s *public) commentByIDCtrl(w http.ResponseWriter, r *http.Request) {
 
 	comment, err := s.dataService.Get(store.Locator{SiteID: siteID, URL: url}, id, rest.GetUserOrEmpty(r))
 	if err != nil {
-		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get comment by id", rest.ErrCommentNotFound)
+		code := http.StatusBadRequest
+		if errors.Is(err, service.ErrCommentNotFound) {
+			code = http.StatusNotFound
+		}
+		rest.SendErrorJSON(w, r, code, err, "can't get comment by id", rest.ErrCommentNotFound)
 		return
 	}
 	render.Status(r, http.StatusOK)
@@ -300,6 +358,28 @@ func (s *public) commentByIDCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GET /id/{id}/history?site=siteID&url=post-url - returns all revisions of the comment, oldest first,
+// each one with changes from the previous revision
+func (s *public) commentHistoryCtrl(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+	log.Printf("[DEBUG] get history of comment %s, %+v", id, locator)
+
+	versions, err := s.dataService.History(locator, id, rest.GetUserOrEmpty(r))
+	if errors.Cause(err) == service.ErrHistoryDisabled {
+		rest.SendErrorJSON(w, r, http.StatusNotImplemented, err, "can't get comment history", rest.ErrActionRejected)
+		return
+	}
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get comment history", rest.ErrCommentNotFound)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	if err = R.RenderJSONWithHTML(w, r, versions); err != nil {
+		log.Printf("[WARN] can't render history of comment %s", id)
+	}
+}
+
 // GET /comments?site=siteID&user=id - returns comments for given userID
 func (s *public) findUserCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 
@@ -343,6 +423,35 @@ func (s *public) findUserCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GET /profile/{userid}?site=siteID&limit=N - get profile of the user with N recent comments, 10 by default
+func (s *public) profileCtrl(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userid")
+	siteID := r.URL.Query().Get("site")
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = profileCommentsLimit
+	}
+
+	key := cache.NewKey(siteID).ID(URLKeyWithUser(r)).Scopes(userID, siteID)
+	data, err := s.cache.Get(key, func() ([]byte, error) {
+		profile, e := s.dataService.Profile(siteID, userID, limit, rest.GetUserOrEmpty(r))
+		if e != nil {
+			return nil, e
+		}
+		return encodeJSONWithHTML(profile)
+	})
+
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, err, "can't get profile", rest.ErrCommentNotFound)
+		return
+	}
+
+	if err = R.RenderJSONFromBytes(w, r, data); err != nil {
+		log.Printf("[WARN] can't render profile of user %s", userID)
+	}
+}
+
 // GET /count?site=siteID&url=post-url - get number of comments for given post
 func (s *public) countCtrl(w http.ResponseWriter, r *http.Request) {
 	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
@@ -482,6 +591,20 @@ func (s *public) applyView(comments []store.Comment, view string) []store.Commen
 	return comments
 }
 
+// mutedUsers returns users muted by the current user, empty for anonymous request
+func (s *public) mutedUsers(r *http.Request, siteID string) []string {
+	user, err := rest.GetUserInfo(r)
+	if err != nil {
+		return nil
+	}
+	muted, err := s.dataService.MutedUsers(siteID, user.ID)
+	if err != nil {
+		log.Printf("[WARN] can't get muted users of %s, %v", user.ID, err)
+		return nil
+	}
+	return muted
+}
+
 func (s *public) parseSince(r *http.Request) (time.Time, error) {
 	sinceTS := time.Time{}
 	if since := r.URL.Query().Get("since"); since != "" {
@@ -493,3 +616,8 @@ func (s *public) parseSince(r *http.Request) (time.Time, error) {
 	}
 	return sinceTS, nil
 }
+
+// siteOptions returns options of the site, global options with site settings applied
+func (s *public) siteOptions(siteID string) adminstore.SiteOptions {
+	return s.dataService.SiteOptions(siteID, adminstore.SiteOptions{ReadOnlyAge: s.readOnlyAge, EmojiEnabled: s.emojiEnabled})
+}
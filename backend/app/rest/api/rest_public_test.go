@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -16,8 +17,11 @@ import (
 	R "github.com/go-pkgz/rest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
 
 	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/history"
+	"github.com/umputun/remark42/backend/app/store/search"
 	"github.com/umputun/remark42/backend/app/store/service"
 )
 
@@ -382,6 +386,34 @@ func TestRest_FindUserComments(t *testing.T) {
 	assert.True(t, resp.Comments[1].Timestamp.After(resp.Comments[2].Timestamp))
 }
 
+func TestRest_Profile(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}
+	addComment(t, c, ts)
+	id := addComment(t, c, ts)
+	_, err := srv.DataService.SetUserProfile("remark42", "dev", service.ProfileDetails{Bio: "about me", Website: "https://example.com"})
+	require.NoError(t, err)
+
+	res, code := get(t, ts.URL+"/api/v1/profile/dev?site=remark42&limit=1")
+	require.Equal(t, http.StatusOK, code, res)
+	profile := service.UserProfile{}
+	require.NoError(t, json.Unmarshal([]byte(res), &profile))
+	assert.Equal(t, "dev", profile.ID)
+	assert.Equal(t, "developer one", profile.Name)
+	assert.Equal(t, 2, profile.Count)
+	assert.False(t, profile.Joined.IsZero())
+	assert.Equal(t, "about me", profile.Bio)
+	assert.Equal(t, "https://example.com", profile.Website)
+	require.Equal(t, 1, len(profile.Recent), "limited to 1 comment")
+	assert.Equal(t, id, profile.Recent[0].ID)
+	assert.Equal(t, "", profile.Recent[0].User.IP, "ip hidden")
+
+	_, code = get(t, ts.URL+"/api/v1/profile/blah?site=remark42")
+	assert.Equal(t, http.StatusNotFound, code, "no comments of user blah")
+}
+
 func TestRest_UserInfo(t *testing.T) {
 	ts, _, teardown := startupT(t)
 	defer teardown()
@@ -925,3 +957,124 @@ func postComment(t *testing.T, url string) {
 	require.NoError(t, err)
 	require.Equal(t, http.StatusCreated, resp.StatusCode, string(b))
 }
+
+func TestRest_Search(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	_, code := get(t, ts.URL+"/api/v1/search?site=remark42&q=test")
+	assert.Equal(t, http.StatusNotImplemented, code, "no search index")
+
+	indexFile := os.TempDir() + "/test-remark-rest-search.db"
+	_ = os.Remove(indexFile)
+	defer os.Remove(indexFile)
+	idx, err := search.NewIndex(indexFile, bolt.Options{})
+	require.NoError(t, err)
+	srv.DataService.SearchIndex = idx
+
+	c1 := store.Comment{Text: "searching **comments** is easy", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}
+	c2 := store.Comment{Text: "another comment", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah2"}}
+	id1, id2 := addComment(t, c1, ts), addComment(t, c2, ts)
+
+	find := func(query string) (res search.Result) {
+		body, code := get(t, ts.URL+"/api/v1/search?site=remark42&"+query)
+		require.Equal(t, http.StatusOK, code, body)
+		require.NoError(t, json.Unmarshal([]byte(body), &res))
+		return res
+	}
+	res := find("q=comment")
+	assert.Equal(t, 2, res.Total)
+	require.Equal(t, 2, len(res.Hits))
+	assert.Equal(t, id2, res.Hits[0].ID, "newest first")
+	assert.Equal(t, "https://radio-t.com/blah2", res.Hits[0].URL)
+	assert.Equal(t, "dev", res.Hits[0].UserID)
+	assert.Equal(t, "searching <mark>comments</mark> is easy", res.Hits[1].Snippet)
+
+	res = find("q=%22easy+comments%22")
+	assert.Equal(t, 0, res.Total, "no such phrase")
+	res = find("q=%22comments+is+easy%22")
+	require.Equal(t, 1, res.Total)
+	assert.Equal(t, id1, res.Hits[0].ID)
+	res = find("q=comment&url=https://radio-t.com/blah1")
+	assert.Equal(t, 1, res.Total)
+	res = find("q=comment&user=other")
+	assert.Equal(t, 0, res.Total)
+	res = find(fmt.Sprintf("q=comment&from=%d", time.Now().Add(time.Hour).Unix()*1000))
+	assert.Equal(t, 0, res.Total)
+	res = find("q=comment&limit=1&skip=1")
+	assert.Equal(t, 2, res.Total)
+	require.Equal(t, 1, len(res.Hits))
+	assert.Equal(t, id1, res.Hits[0].ID)
+
+	require.NoError(t, srv.DataService.Delete(c1.Locator, id1, store.SoftDelete))
+	res = find("q=easy")
+	assert.Equal(t, 0, res.Total, "deleted comment hidden")
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/search?site=remark42&q=easy", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	res = search.Result{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, 1, res.Total, "deleted comment found by admin")
+	assert.True(t, res.Hits[0].Deleted)
+
+	time.Sleep(time.Second) // let open routes limiter to refill
+	_, code = get(t, ts.URL+"/api/v1/search?site=remark42&q=the")
+	assert.Equal(t, http.StatusBadRequest, code, "stop words only")
+	_, code = get(t, ts.URL+"/api/v1/search?site=remark42&q=comment&from=bad")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestRest_CommentHistory(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "original text", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah1"}}
+	id1 := addComment(t, c1, ts)
+	_, code := get(t, ts.URL+"/api/v1/id/"+id1+"/history?site=remark42&url=https://radio-t.com/blah1")
+	assert.Equal(t, http.StatusNotImplemented, code, "no history store")
+
+	historyFile := os.TempDir() + "/test-remark-rest-history.db"
+	_ = os.Remove(historyFile)
+	defer os.Remove(historyFile)
+	historyStore, err := history.NewBoltStorage(historyFile, bolt.Options{})
+	require.NoError(t, err)
+	srv.DataService.HistoryStore = historyStore
+
+	edit := func(text, token string) int {
+		req, e := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/comment/"+id1+"?site=remark42&url=https://radio-t.com/blah1",
+			strings.NewReader(`{"text":"`+text+`","summary":"my edit"}`))
+		require.NoError(t, e)
+		req.Header.Add("X-JWT", token)
+		resp, e := http.DefaultClient.Do(req)
+		require.NoError(t, e)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusOK, edit("edited text", devToken))
+	require.Equal(t, http.StatusForbidden, edit("edited by admin", adminUmputunToken), "admin can't edit comments of others")
+	require.Equal(t, http.StatusOK, edit("edited text, again", devToken))
+
+	body, code := get(t, ts.URL+"/api/v1/id/"+id1+"/history?site=remark42&url=https://radio-t.com/blah1")
+	require.Equal(t, http.StatusOK, code, body)
+	versions := []history.Version{}
+	require.NoError(t, json.Unmarshal([]byte(body), &versions))
+	require.Equal(t, 3, len(versions))
+	assert.Equal(t, "original text", versions[0].Orig)
+	assert.Equal(t, "<p>original text</p>\n", versions[0].Text)
+	assert.Equal(t, "dev", versions[0].EditorID)
+	assert.Equal(t, "edited text", versions[1].Orig)
+	assert.Equal(t, "my edit", versions[1].Summary)
+	assert.Equal(t, []history.Change{{Op: history.OpDelete, Text: "original"}, {Op: history.OpInsert, Text: "edited"},
+		{Op: history.OpEqual, Text: " text"}}, versions[1].Changes)
+	assert.Equal(t, "dev", versions[2].EditorID)
+	assert.Equal(t, "dev", versions[2].UserID)
+	assert.Equal(t, []history.Change{{Op: history.OpEqual, Text: "edited "}, {Op: history.OpDelete, Text: "text"},
+		{Op: history.OpInsert, Text: "text, again"}}, versions[2].Changes)
+
+	_, code = get(t, ts.URL+"/api/v1/id/bad/history?site=remark42&url=https://radio-t.com/blah1")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -29,10 +29,12 @@ import (
 
 	"github.com/umputun/remark42/backend/app/migrator"
 	"github.com/umputun/remark42/backend/app/notify"
+	"github.com/umputun/remark42/backend/app/replica"
 	"github.com/umputun/remark42/backend/app/rest"
 	"github.com/umputun/remark42/backend/app/rest/proxy"
 	"github.com/umputun/remark42/backend/app/store"
 	adminstore "github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/audit"
 	"github.com/umputun/remark42/backend/app/store/engine"
 	"github.com/umputun/remark42/backend/app/store/image"
 	"github.com/umputun/remark42/backend/app/store/service"
@@ -225,6 +227,67 @@ func TestRest_rejectAnonUser(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode, "real user")
 }
 
+func TestRest_proxyToPrimary(t *testing.T) {
+	_, srv, teardown := startupT(t)
+	defer teardown()
+
+	var proxied []string
+	srv.Replica = &replica.Replica{Sites: []string{"remark42"}}
+	srv.PrimaryProxy = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	send := func(method, url string) int {
+		req, err := http.NewRequest(method, ts.URL+url, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	tbl := []struct {
+		method, url string
+		proxied     bool
+	}{
+		{http.MethodPost, "/api/v1/comment?site=remark42", true},
+		{http.MethodPut, "/api/v1/vote/123?site=remark42&url=https://radio-t.com/blah&vote=1", true},
+		{http.MethodGet, "/api/v1/search?site=remark42&query=test", true},
+		{http.MethodGet, "/api/v1/id/123/history?site=remark42&url=https://radio-t.com/blah", true},
+		{http.MethodGet, "/api/v1/admin/changes?site=remark42", true},
+		{http.MethodGet, "/api/v1/email?site=remark42", true},
+		{http.MethodGet, "/auth/github/login", true},
+		{http.MethodGet, "/email/unsubscribe.html?site=remark42&tkn=123", true},
+		{http.MethodGet, "/api/v1/find?site=remark42&url=https://radio-t.com/blah", false},
+		{http.MethodGet, "/api/v1/last/10?site=remark42", false},
+		{http.MethodGet, "/api/v1/count?site=remark42&url=https://radio-t.com/blah", false},
+		{http.MethodGet, "/api/v1/rss/site?site=remark42", false},
+	}
+	for i, tt := range tbl {
+		proxied = nil
+		code := send(tt.method, tt.url)
+		if tt.proxied {
+			assert.Equal(t, http.StatusAccepted, code, "#%d %s", i, tt.url)
+			assert.Equal(t, 1, len(proxied), "#%d %s", i, tt.url)
+			continue
+		}
+		assert.Equal(t, http.StatusOK, code, "#%d %s", i, tt.url)
+		assert.Equal(t, 0, len(proxied), "#%d %s", i, tt.url)
+	}
+
+	time.Sleep(time.Second) // open routes limited to 10 requests per second
+	body, code := get(t, ts.URL+"/api/v1/config?site=remark42")
+	require.Equal(t, http.StatusOK, code)
+	cnf := struct {
+		Replica replica.SiteStatus `json:"replica"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(body), &cnf))
+	assert.Equal(t, "remark42", cnf.Replica.SiteID)
+}
+
 func Test_URLKey(t *testing.T) {
 	tbl := []struct {
 		url  string
@@ -357,6 +420,11 @@ func startupT(t *testing.T) (ts *httptest.Server, srv *Rest, teardown func()) {
 	b, err := engine.NewBoltDB(bolt.Options{}, engine.BoltSite{FileName: testDB, SiteID: "remark42"})
 	require.NoError(t, err)
 
+	auditDB, err := randomPath(tmp, "test-remark-audit", ".db")
+	require.NoError(t, err)
+	auditStore, err := audit.NewBoltStorage(auditDB, bolt.Options{})
+	require.NoError(t, err)
+
 	memCache := cache.NewScache(cache.NewNopCache())
 
 	astore := adminstore.NewStaticStore("123456", []string{"remark42"}, []string{"a1", "a2"}, "admin@remark-42.com")
@@ -395,12 +463,14 @@ func startupT(t *testing.T) (ts *httptest.Server, srv *Rest, teardown func()) {
 		Migrator: &Migrator{
 			DisqusImporter:    &migrator.Disqus{DataStore: dataStore},
 			WordPressImporter: &migrator.WordPress{DataStore: dataStore},
-			NativeImporter:    &migrator.Native{DataStore: dataStore},
-			NativeExporter:    &migrator.Native{DataStore: dataStore},
+			NativeImporter:    &migrator.Native{DataStore: dataStore, AuditStore: auditStore},
+			NativeExporter:    &migrator.Native{DataStore: dataStore, AuditStore: auditStore},
 			URLMapperMaker:    migrator.NewURLMapper,
 			Cache:             memCache,
 			KeyStore:          astore,
+			AuditStore:        auditStore,
 		},
+		AuditStore: auditStore,
 		Streamer: &Streamer{
 			Refresh:   100 * time.Millisecond,
 			TimeOut:   5 * time.Second,
@@ -416,7 +486,9 @@ func startupT(t *testing.T) (ts *httptest.Server, srv *Rest, teardown func()) {
 	teardown = func() {
 		ts.Close()
 		require.NoError(t, srv.DataService.Close())
+		require.NoError(t, auditStore.Close())
 		_ = os.Remove(testDB)
+		_ = os.Remove(auditDB)
 		_ = os.RemoveAll(tmp + "/ava-remark42")
 		_ = os.RemoveAll(tmp + "/pics-remark42")
 	}
@@ -24,11 +24,15 @@ type rssStore interface {
 	Last(siteID string, limit int, since time.Time, user store.User) ([]store.Comment, error)
 	Get(locator store.Locator, commentID string, user store.User) (store.Comment, error)
 	UserReplies(siteID, userID string, limit int, duration time.Duration) ([]store.Comment, string, error)
+	MutedUsers(siteID, userID string) ([]string, error)
 }
 
 const maxRssItems = 20
 const maxReplyDuration = 31 * 24 * time.Hour
 
+// feeds cached for all readers, so built for anonymous user, without pending comments or comments of shadow blocked users
+var rssUser = store.User{}
+
 // ui uses links like <post-url>#remark42__comment-<comment-id>
 const uiNav = "#remark42__comment-"
 
@@ -39,7 +43,7 @@ func (s *rss) postCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 
 	key := cache.NewKey(locator.SiteID).ID(URLKey(r)).Scopes(locator.SiteID, locator.URL)
 	data, err := s.cache.Get(key, func() ([]byte, error) {
-		comments, e := s.dataService.Find(locator, "-time", rest.GetUserOrEmpty(r))
+		comments, e := s.dataService.Find(locator, "-time", rssUser)
 		if e != nil {
 			return nil, e
 		}
@@ -70,7 +74,7 @@ func (s *rss) siteCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 
 	key := cache.NewKey(siteID).ID(URLKey(r)).Scopes(siteID, lastCommentsScope)
 	data, err := s.cache.Get(key, func() ([]byte, error) {
-		comments, e := s.dataService.Last(siteID, maxRssItems, time.Time{}, rest.GetUserOrEmpty(r))
+		comments, e := s.dataService.Last(siteID, maxRssItems, time.Time{}, rssUser)
 		if e != nil {
 			return nil, e
 		}
@@ -100,13 +104,18 @@ func (s *rss) repliesCtrl(w http.ResponseWriter, r *http.Request) {
 	siteID := r.URL.Query().Get("site")
 	log.Printf("[DEBUG] get rss replies to user %s for site %s", userID, siteID)
 
-	key := cache.NewKey(siteID).ID(URLKey(r)).Scopes(siteID, lastCommentsScope)
+	muted, err := s.dataService.MutedUsers(siteID, userID)
+	if err != nil {
+		log.Printf("[WARN] can't get muted users of %s, %v", userID, err)
+	}
+	key := cache.NewKey(siteID).ID(mutedKey(URLKey(r), muted)).Scopes(siteID, lastCommentsScope)
 	data, err := s.cache.Get(key, func() (res []byte, e error) {
 
 		replies, userName, e := s.dataService.UserReplies(siteID, userID, maxRssItems, maxReplyDuration)
 		if e != nil {
 			return nil, errors.Wrap(e, "can't get last comments")
 		}
+		replies = filterComments(markMuted(replies, muted), func(c store.Comment) bool { return !c.Muted }) // omit replies of muted users
 
 		feed, e := s.toRssFeed(siteID, replies, "replies to "+userName)
 		if e != nil {
@@ -58,6 +58,23 @@ func TestServer_RssPost(t *testing.T) {
 	assert.Equal(t, 400, code)
 }
 
+func TestServer_RssHidden(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	srv.DataService.Moderation.Sites = []string{"remark42"}
+
+	addComment(t, store.Comment{Text: "pending text", Locator: store.Locator{SiteID: "remark42", URL: "https://radio-t.com/blah"}}, ts)
+
+	for _, url := range []string{"/api/v1/rss/post?site=remark42&url=https://radio-t.com/blah", "/api/v1/rss/site?site=remark42"} {
+		res, code := getWithDevAuth(t, ts.URL+url)
+		require.Equal(t, 200, code)
+		assert.NotContains(t, res, "pending text", "feed built for anonymous user")
+		res, code = get(t, ts.URL+url)
+		require.Equal(t, 200, code)
+		assert.NotContains(t, res, "pending text", "author's feed not cached for others")
+	}
+}
+
 func TestServer_RssSite(t *testing.T) {
 	ts, rst, teardown := startupT(t)
 	defer teardown()
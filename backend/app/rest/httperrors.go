@@ -38,6 +38,12 @@ const (
 	ErrVoteMinScore       = 16 // min score reached for the comment
 	ErrActionRejected     = 17 // general error for rejected actions
 	ErrAssetNotFound      = 18 // requested file not found
+	ErrCommentSpam        = 19 // comment rejected as spam
+	ErrReportRejected     = 20 // general error on report rejected
+	ErrReportSelf         = 21 // report of own comment
+	ErrNoEmail            = 22 // confirmed email required
+	ErrReactionRejected   = 23 // general error on reaction rejected
+	ErrRateLimited        = 24 // too many comments, retry later
 )
 
 // errTmplData store data for error message
@@ -4,6 +4,7 @@ package admin
 import (
 	"errors"
 	"strings"
+	"sync"
 
 	log "github.com/go-pkgz/lgr"
 )
@@ -34,6 +35,7 @@ type StaticStore struct {
 	email  string
 	key    string
 	sites  []string
+	lock   sync.RWMutex
 }
 
 // NewStaticStore makes StaticStore instance with given key
@@ -65,9 +67,21 @@ func (s *StaticStore) Email(string) (email string, err error) {
 	return s.email, nil
 }
 
-// Enabled if always true for StaticStore
+// SetSites replaces list of enabled sites, i.e. on site added or removed at runtime. Empty list disables all sites
+func (s *StaticStore) SetSites(sites []string) {
+	if sites == nil {
+		sites = []string{}
+	}
+	s.lock.Lock()
+	s.sites = sites
+	s.lock.Unlock()
+}
+
+// Enabled checks if site in list of enabled sites, always true if list not set
 func (s *StaticStore) Enabled(site string) (ok bool, err error) {
-	if len(s.sites) == 0 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.sites == nil {
 		return true, nil
 	}
 	for _, allowedSite := range s.sites {
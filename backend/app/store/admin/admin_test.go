@@ -29,3 +29,24 @@ func TestStaticStore_Get(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, false, enabled)
 }
+
+func TestStaticStore_SetSites(t *testing.T) {
+	ks := NewStaticStore("key123", []string{"s1"}, []string{"123"}, "aa@example.com")
+	enabled, err := ks.Enabled("s2")
+	assert.NoError(t, err)
+	assert.False(t, enabled)
+
+	ks.SetSites([]string{"s1", "s2"})
+	enabled, err = ks.Enabled("s2")
+	assert.NoError(t, err)
+	assert.True(t, enabled)
+
+	ks.SetSites(nil)
+	enabled, err = ks.Enabled("s1")
+	assert.NoError(t, err)
+	assert.False(t, enabled, "all sites disabled")
+
+	enabled, err = NewStaticKeyStore("key123").Enabled("s1")
+	assert.NoError(t, err)
+	assert.True(t, enabled, "any site enabled without list")
+}
@@ -0,0 +1,201 @@
+package admin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+)
+
+// errors returned by Registry, wrapped with site id
+var (
+	ErrSiteNotFound = errors.New("site not found")
+	ErrSiteExists   = errors.New("site already exists")
+)
+
+// Site is an entry of sites registry
+type Site struct {
+	ID       string    `json:"id"`
+	Disabled bool      `json:"disabled,omitempty"`
+	Deleted  bool      `json:"deleted,omitempty"` // deleted site kept, so site set by options not added back on restart
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Registry keeps list of sites managed at runtime in json file. Thread safe
+type Registry struct {
+	file  string
+	lock  sync.RWMutex
+	sites []Site
+}
+
+// siteIDRe allows site ids safe to be used as file names
+var siteIDRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// ValidSiteID checks if site id allowed for a new site
+func ValidSiteID(siteID string) bool {
+	return siteIDRe.MatchString(siteID)
+}
+
+// NewRegistry loads registry from the file, sites never registered before added enabled.
+// Deleted sites are not added back
+func NewRegistry(file string, sites []string) (*Registry, error) {
+	r := Registry{file: file, sites: []Site{}}
+	data, err := ioutil.ReadFile(file) // nolint
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "can't read %s", file)
+	}
+	if err == nil {
+		if err = json.Unmarshal(data, &r.sites); err != nil {
+			return nil, errors.Wrapf(err, "can't unmarshal %s", file)
+		}
+	}
+
+	added := false
+	for _, siteID := range sites {
+		if _, ok := r.find(siteID); ok {
+			continue
+		}
+		r.sites = append(r.sites, Site{ID: siteID, Created: time.Now(), Updated: time.Now()})
+		added = true
+	}
+	if added || os.IsNotExist(err) {
+		if err = r.save(); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("[DEBUG] sites registry %s, %d sites", file, len(r.sites))
+	return &r, nil
+}
+
+// List returns all sites but deleted, in order of creation
+func (r *Registry) List() []Site {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	res := []Site{}
+	for _, s := range r.sites {
+		if !s.Deleted {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// Enabled returns ids of enabled sites
+func (r *Registry) Enabled() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	res := []string{}
+	for _, s := range r.sites {
+		if !s.Deleted && !s.Disabled {
+			res = append(res, s.ID)
+		}
+	}
+	return res
+}
+
+// Get returns the site, deleted site is not found
+func (r *Registry) Get(siteID string) (Site, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	i, ok := r.find(siteID)
+	if !ok || r.sites[i].Deleted {
+		return Site{}, false
+	}
+	return r.sites[i], true
+}
+
+// Add registers new enabled site, site deleted before registered again
+func (r *Registry) Add(siteID string) error {
+	if !ValidSiteID(siteID) {
+		return errors.Errorf("invalid site id %q", siteID)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	i, ok := r.find(siteID)
+	if ok && !r.sites[i].Deleted {
+		return errors.Wrap(ErrSiteExists, siteID)
+	}
+	site := Site{ID: siteID, Created: time.Now(), Updated: time.Now()}
+	if ok {
+		r.sites[i] = site
+	} else {
+		r.sites = append(r.sites, site)
+	}
+	return r.save()
+}
+
+// SetDisabled disables or enables the site
+func (r *Registry) SetDisabled(siteID string, disabled bool) error {
+	return r.update(siteID, func(s *Site) { s.Disabled = disabled })
+}
+
+// Delete marks the site deleted
+func (r *Registry) Delete(siteID string) error {
+	return r.update(siteID, func(s *Site) { s.Deleted, s.Disabled = true, false })
+}
+
+// Rename changes id of the site, old id marked deleted
+func (r *Registry) Rename(siteID, newID string) error {
+	if !ValidSiteID(newID) {
+		return errors.Errorf("invalid site id %q", newID)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	i, ok := r.find(siteID)
+	if !ok || r.sites[i].Deleted {
+		return errors.Wrap(ErrSiteNotFound, siteID)
+	}
+	if j, ok := r.find(newID); ok && !r.sites[j].Deleted {
+		return errors.Wrap(ErrSiteExists, newID)
+	}
+	site := r.sites[i]
+	site.ID, site.Updated = newID, time.Now()
+	r.sites[i].Deleted, r.sites[i].Disabled, r.sites[i].Updated = true, false, time.Now()
+	if j, ok := r.find(newID); ok {
+		r.sites[j] = site
+	} else {
+		r.sites = append(r.sites, site)
+	}
+	return r.save()
+}
+
+func (r *Registry) update(siteID string, fn func(s *Site)) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	i, ok := r.find(siteID)
+	if !ok || r.sites[i].Deleted {
+		return errors.Wrap(ErrSiteNotFound, siteID)
+	}
+	fn(&r.sites[i])
+	r.sites[i].Updated = time.Now()
+	return r.save()
+}
+
+// find returns index of the site, deleted including. Should run under lock
+func (r *Registry) find(siteID string) (int, bool) {
+	for i, s := range r.sites {
+		if s.ID == siteID {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// save writes registry to temp file and renames it, so registry file is never partially written. Should run under lock
+func (r *Registry) save() error {
+	data, err := json.MarshalIndent(r.sites, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "can't marshal sites registry")
+	}
+	tmp := r.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return errors.Wrapf(err, "can't write %s", tmp)
+	}
+	return errors.Wrapf(os.Rename(tmp, r.file), "can't rename %s", tmp)
+}
@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	file := os.TempDir() + "/test-remark-sites.json"
+	defer os.Remove(file)
+	_ = os.Remove(file)
+
+	r, err := NewRegistry(file, []string{"s1", "s2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"s1", "s2"}, r.Enabled())
+
+	require.NoError(t, r.Add("s3"))
+	assert.EqualError(t, r.Add("s3"), "s3: site already exists")
+	assert.EqualError(t, r.Add("../s4"), `invalid site id "../s4"`)
+	require.NoError(t, r.SetDisabled("s2", true))
+	assert.EqualError(t, r.SetDisabled("bad", true), "bad: site not found")
+	assert.Equal(t, []string{"s1", "s3"}, r.Enabled())
+	s, ok := r.Get("s2")
+	require.True(t, ok)
+	assert.True(t, s.Disabled)
+
+	require.NoError(t, r.Rename("s3", "s4"))
+	assert.EqualError(t, r.Rename("s3", "s5"), "s3: site not found")
+	assert.EqualError(t, r.Rename("s4", "s1"), "s1: site already exists")
+	require.NoError(t, r.Delete("s1"))
+	_, ok = r.Get("s1")
+	assert.False(t, ok, "deleted site not found")
+	assert.Equal(t, []string{"s4"}, r.Enabled())
+	assert.Equal(t, 2, len(r.List()))
+
+	// registry loaded from file, deleted site set by options not added back
+	r, err = NewRegistry(file, []string{"s1", "s2", "s5"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"s4", "s5"}, r.Enabled())
+	ids := []string{}
+	for _, s := range r.List() {
+		ids = append(ids, s.ID)
+	}
+	assert.Equal(t, []string{"s2", "s4", "s5"}, ids)
+
+	// deleted site can be added again
+	require.NoError(t, r.Add("s1"))
+	assert.Equal(t, []string{"s1", "s4", "s5"}, r.Enabled())
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("bad json"), 0600))
+	_, err = NewRegistry(file, nil)
+	assert.Error(t, err)
+	_, err = NewRegistry("/dev/null/sites.json", []string{"s1"})
+	assert.Error(t, err)
+}
+
+func TestRegistry_ValidSiteID(t *testing.T) {
+	for id, valid := range map[string]bool{"remark": true, "my-blog.example.com": true, "blog_1": true, "": false,
+		".hidden": false, "a/b": false, "a b": false, "../x": false} {
+		assert.Equal(t, valid, ValidSiteID(id), id)
+	}
+}
@@ -75,3 +75,22 @@ func (r *RPC) OnEvent(siteID string, et EventType) error {
 	}
 	return nil
 }
+
+// Settings returns settings of the site
+func (r *RPC) Settings(siteID string) (settings Settings, err error) {
+	resp, err := r.Call("admin.settings", siteID)
+	if err != nil {
+		return Settings{}, err
+	}
+
+	if err := json.Unmarshal(*resp.Result, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
+
+// SetSettings replaces settings of the site
+func (r *RPC) SetSettings(siteID string, settings Settings) error {
+	_, err := r.Call("admin.set_settings", siteID, settings)
+	return err
+}
@@ -90,6 +90,32 @@ func TestRemote_OnEvent(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestRemote_Settings(t *testing.T) {
+	ts := testServer(t, `{"method":"admin.settings","params":"site-1","id":1}`,
+		`{"result":{"max_comment_size":100,"anon_vote":false,"restricted_words":null},"id":1}`)
+	defer ts.Close()
+	c := RPC{Client: jrpc.Client{API: ts.URL, Client: http.Client{}}}
+
+	var a SettingsStore = &c
+	_ = a
+
+	res, err := c.Settings("site-1")
+	assert.NoError(t, err)
+	size, no := 100, false
+	assert.Equal(t, Settings{MaxCommentSize: &size, AnonVote: &no}, res)
+}
+
+func TestRemote_SetSettings(t *testing.T) {
+	ts := testServer(t, `{"method":"admin.set_settings","params":["site-1",{"max_votes":10,"restricted_words":["bad"],"reactions":null}],"id":1}`,
+		`{"id":1}`)
+	defer ts.Close()
+	c := RPC{Client: jrpc.Client{API: ts.URL, Client: http.Client{}}}
+
+	votes := 10
+	err := c.SetSettings("site-1", Settings{MaxVotes: &votes, RestrictedWords: []string{"bad"}})
+	assert.NoError(t, err)
+}
+
 func testServer(t *testing.T, req, resp string) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		body, err := ioutil.ReadAll(r.Body)
@@ -0,0 +1,190 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+)
+
+// SettingsStore defines interface of per-site settings, overriding global options of the server
+type SettingsStore interface {
+	Settings(siteID string) (settings Settings, err error)
+	SetSettings(siteID string, settings Settings) error
+}
+
+// Settings of the site. Nil field is not overridden and global option used
+type Settings struct {
+	MaxCommentSize  *int     `json:"max_comment_size,omitempty"`
+	EditDuration    *int     `json:"edit_duration,omitempty"` // in seconds
+	LowScore        *int     `json:"low_score,omitempty"`
+	CriticalScore   *int     `json:"critical_score,omitempty"`
+	PositiveScore   *bool    `json:"positive_score,omitempty"`
+	ReadOnlyAge     *int     `json:"readonly_age,omitempty"` // in days
+	MaxVotes        *int     `json:"max_votes,omitempty"`
+	RestrictedWords []string `json:"restricted_words"` // empty list overrides global words, nil doesn't
+	AnonVote        *bool    `json:"anon_vote,omitempty"`
+	EmojiEnabled    *bool    `json:"emoji_enabled,omitempty"`
+	Reactions       []string `json:"reactions"` // empty list disables reactions, nil uses global set
+}
+
+// SiteOptions are effective options of the site, global options with site settings applied
+type SiteOptions struct {
+	MaxCommentSize  int
+	EditDuration    time.Duration
+	LowScore        int
+	CriticalScore   int
+	PositiveScore   bool
+	ReadOnlyAge     int
+	MaxVotes        int
+	RestrictedWords []string
+	AnonVote        bool
+	EmojiEnabled    bool
+	Reactions       []string
+}
+
+// Apply returns options with overrides of the settings
+func (s Settings) Apply(o SiteOptions) SiteOptions {
+	setInt := func(v *int, dst *int) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+	setBool := func(v *bool, dst *bool) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+	setInt(s.MaxCommentSize, &o.MaxCommentSize)
+	setInt(s.LowScore, &o.LowScore)
+	setInt(s.CriticalScore, &o.CriticalScore)
+	setInt(s.ReadOnlyAge, &o.ReadOnlyAge)
+	setInt(s.MaxVotes, &o.MaxVotes)
+	setBool(s.PositiveScore, &o.PositiveScore)
+	setBool(s.AnonVote, &o.AnonVote)
+	setBool(s.EmojiEnabled, &o.EmojiEnabled)
+	if s.EditDuration != nil {
+		o.EditDuration = time.Duration(*s.EditDuration) * time.Second
+	}
+	if s.RestrictedWords != nil {
+		o.RestrictedWords = s.RestrictedWords
+	}
+	if s.Reactions != nil {
+		o.Reactions = s.Reactions
+	}
+	return o
+}
+
+const maxReactionLen = 32 // in bytes, enough for emoji with modifiers
+
+// Validate checks settings values
+func (s Settings) Validate() error {
+	for name, v := range map[string]*int{"max_comment_size": s.MaxCommentSize, "edit_duration": s.EditDuration,
+		"readonly_age": s.ReadOnlyAge} {
+		if v != nil && *v < 0 {
+			return errors.Errorf("negative %s %d", name, *v)
+		}
+	}
+	if s.LowScore != nil && s.CriticalScore != nil && *s.CriticalScore > *s.LowScore {
+		return errors.Errorf("critical score %d is higher than low score %d", *s.CriticalScore, *s.LowScore)
+	}
+	seen := map[string]bool{}
+	for _, r := range s.Reactions {
+		if r == "" || len(r) > maxReactionLen {
+			return errors.Errorf("invalid reaction %q", r)
+		}
+		if seen[r] {
+			return errors.Errorf("duplicate reaction %q", r)
+		}
+		seen[r] = true
+	}
+	return nil
+}
+
+// Params returns overridden settings as strings, i.e. for audit log
+func (s Settings) Params() map[string]string {
+	res := map[string]string{}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return res
+	}
+	fields := map[string]interface{}{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return res
+	}
+	for k, v := range fields {
+		switch val := v.(type) {
+		case nil:
+			continue
+		case []interface{}:
+			words := make([]string, 0, len(val))
+			for _, w := range val {
+				words = append(words, fmt.Sprintf("%v", w))
+			}
+			sort.Strings(words)
+			res[k] = strings.Join(words, ",")
+		case float64:
+			res[k] = strconv.FormatFloat(val, 'f', -1, 64)
+		default:
+			res[k] = fmt.Sprintf("%v", val)
+		}
+	}
+	return res
+}
+
+// FileSettings implements SettingsStore with settings of all sites kept in json file. Thread safe
+type FileSettings struct {
+	file     string
+	lock     sync.RWMutex
+	settings map[string]Settings
+}
+
+// NewFileSettings loads settings from the file, missing file is empty settings
+func NewFileSettings(file string) (*FileSettings, error) {
+	res := FileSettings{file: file, settings: map[string]Settings{}}
+	data, err := ioutil.ReadFile(file) // nolint
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "can't read %s", file)
+	}
+	if err == nil {
+		if err = json.Unmarshal(data, &res.settings); err != nil {
+			return nil, errors.Wrapf(err, "can't unmarshal %s", file)
+		}
+	}
+	log.Printf("[DEBUG] site settings %s, %d sites", file, len(res.settings))
+	return &res, nil
+}
+
+// Settings returns settings of the site, empty if not set
+func (f *FileSettings) Settings(siteID string) (Settings, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.settings[siteID], nil
+}
+
+// SetSettings replaces settings of the site and saves all settings to the file
+func (f *FileSettings) SetSettings(siteID string, settings Settings) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.settings[siteID] = settings
+	if len(settings.Params()) == 0 { // nothing overridden
+		delete(f.settings, siteID)
+	}
+	data, err := json.MarshalIndent(f.settings, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "can't marshal site settings")
+	}
+	tmp := f.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return errors.Wrapf(err, "can't write %s", tmp)
+	}
+	return errors.Wrapf(os.Rename(tmp, f.file), "can't rename %s", tmp)
+}
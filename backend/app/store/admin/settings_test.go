@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettings_Apply(t *testing.T) {
+	size, age, edit, no := 100, 5, 60, false
+	global := SiteOptions{MaxCommentSize: 2048, EditDuration: 5 * time.Minute, LowScore: -5, CriticalScore: -10,
+		ReadOnlyAge: 0, MaxVotes: -1, RestrictedWords: []string{"bad"}, AnonVote: true, EmojiEnabled: true}
+
+	assert.Equal(t, global, Settings{}.Apply(global), "nothing overridden")
+
+	s := Settings{MaxCommentSize: &size, ReadOnlyAge: &age, EditDuration: &edit, AnonVote: &no, RestrictedWords: []string{},
+		Reactions: []string{"👍", "🔥"}}
+	assert.Equal(t, SiteOptions{MaxCommentSize: 100, EditDuration: time.Minute, LowScore: -5, CriticalScore: -10,
+		ReadOnlyAge: 5, MaxVotes: -1, RestrictedWords: []string{}, AnonVote: false, EmojiEnabled: true,
+		Reactions: []string{"👍", "🔥"}}, s.Apply(global))
+	assert.Equal(t, map[string]string{"max_comment_size": "100", "readonly_age": "5", "edit_duration": "60",
+		"anon_vote": "false", "restricted_words": "", "reactions": "👍,🔥"}, s.Params())
+	assert.Equal(t, map[string]string{}, Settings{}.Params())
+}
+
+func TestSettings_Validate(t *testing.T) {
+	neg, low, critical := -1, -5, -2
+	assert.NoError(t, Settings{}.Validate())
+	assert.EqualError(t, Settings{MaxCommentSize: &neg}.Validate(), "negative max_comment_size -1")
+	assert.NoError(t, Settings{LowScore: &neg}.Validate(), "negative scores allowed")
+	assert.EqualError(t, Settings{LowScore: &low, CriticalScore: &critical}.Validate(),
+		"critical score -2 is higher than low score -5")
+	assert.NoError(t, Settings{Reactions: []string{"👍", "❤️"}}.Validate())
+	assert.EqualError(t, Settings{Reactions: []string{"👍", ""}}.Validate(), `invalid reaction ""`)
+	assert.EqualError(t, Settings{Reactions: []string{"👍", "👍"}}.Validate(), `duplicate reaction "👍"`)
+}
+
+func TestFileSettings(t *testing.T) {
+	file := os.TempDir() + "/test-remark-settings.json"
+	defer os.Remove(file)
+	_ = os.Remove(file)
+
+	fs, err := NewFileSettings(file)
+	require.NoError(t, err)
+	var _ SettingsStore = fs
+
+	s, err := fs.Settings("site1")
+	require.NoError(t, err)
+	assert.Equal(t, Settings{}, s, "empty settings by default")
+
+	size, yes := 100, true
+	require.NoError(t, fs.SetSettings("site1", Settings{MaxCommentSize: &size, RestrictedWords: []string{}}))
+	require.NoError(t, fs.SetSettings("site2", Settings{EmojiEnabled: &yes}))
+
+	fs, err = NewFileSettings(file)
+	require.NoError(t, err)
+	s, err = fs.Settings("site1")
+	require.NoError(t, err)
+	assert.Equal(t, Settings{MaxCommentSize: &size, RestrictedWords: []string{}}, s, "settings loaded from file")
+
+	require.NoError(t, fs.SetSettings("site2", Settings{}))
+	data, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "site2", "empty settings removed")
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("bad json"), 0600))
+	_, err = NewFileSettings(file)
+	assert.Error(t, err)
+	fs.file = "/dev/null/settings.json"
+	assert.Error(t, fs.SetSettings("site1", Settings{}))
+}
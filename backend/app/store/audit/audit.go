@@ -0,0 +1,78 @@
+// Package audit keeps log of admin actions per site, i.e. who did what, to which comment, user or post and when.
+package audit
+
+import (
+	"time"
+)
+
+// Action defines type of admin action
+type Action string
+
+// enum of all actions
+const (
+	ActionDelete     Action = "delete"      // delete comment
+	ActionDeleteUser Action = "delete_user" // delete all comments of user
+	ActionDeleteMe   Action = "deleteme"    // delete all comments and details by user's request
+	ActionBlock      Action = "block"       // block or unblock user
+	ActionVerify     Action = "verify"      // set or reset verified status
+	ActionPin        Action = "pin"         // pin or unpin comment
+	ActionReadOnly   Action = "readonly"    // set or reset read-only status of post
+	ActionTitle      Action = "title"       // set comment's post title
+	ActionApprove    Action = "approve"     // approve pending comment
+	ActionReject     Action = "reject"      // reject pending comment
+	ActionDismiss    Action = "dismiss"     // dismiss user reports of comment
+	ActionImport     Action = "import"      // import comments
+	ActionRemap      Action = "remap"       // remap urls of comments
+	ActionRetry      Action = "retry"       // retry delivery of queued notification
+	ActionRetention  Action = "retention"   // remove personal data by retention policy
+	ActionSite       Action = "site"        // create, disable, enable, rename or delete site
+	ActionSettings   Action = "settings"    // set site settings
+)
+
+// Entry is a single record of audit log
+type Entry struct {
+	ID        string            `json:"id"`
+	SiteID    string            `json:"site"`
+	Timestamp time.Time         `json:"time"`
+	Action    Action            `json:"action"`
+	Actor     Actor             `json:"actor"`
+	CommentID string            `json:"comment_id,omitempty"`
+	UserID    string            `json:"user_id,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+}
+
+// Actor is a user made the action
+type Actor struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Request defines filters to list entries. Empty filter matches all entries, From and To are inclusive
+type Request struct {
+	SiteID  string
+	Action  Action
+	ActorID string
+	From    time.Time
+	To      time.Time
+	Limit   int
+	Skip    int
+}
+
+// Store defines interface to add and list audit entries
+type Store interface {
+	Add(entries ...Entry) error        // add entries, entry with the same ID and time replaced
+	List(req Request) ([]Entry, error) // list entries, sorted by time, newest first
+	Close() error
+}
+
+// match checks if entry matches request filters, except the time range
+func (r Request) match(e Entry) bool {
+	if r.Action != "" && e.Action != r.Action {
+		return false
+	}
+	if r.ActorID != "" && e.Actor.ID != r.ActorID {
+		return false
+	}
+	return true
+}
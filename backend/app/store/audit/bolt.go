@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// tsKeyFormat keeps keys sorted by time, entry ID appended to make them unique
+const tsKeyFormat = "2006-01-02T15:04:05.000000000Z"
+
+// Bolt implements Store with bolt db. Each site has its own bucket, key is ts!!id, value is json-serialized Entry
+type Bolt struct {
+	db *bolt.DB
+}
+
+// NewBoltStorage makes audit store in fileName
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to make boltdb for %s", fileName)
+	}
+	return &Bolt{db: db}, nil
+}
+
+// Add entries, missing ID and Timestamp filled automatically
+func (b *Bolt) Add(entries ...Entry) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		for _, e := range entries {
+			if e.SiteID == "" {
+				return errors.New("empty site id for audit entry")
+			}
+			if e.ID == "" {
+				e.ID = uuid.New().String()
+			}
+			if e.Timestamp.IsZero() {
+				e.Timestamp = time.Now()
+			}
+			bkt, err := tx.CreateBucketIfNotExists([]byte(e.SiteID))
+			if err != nil {
+				return errors.Wrapf(err, "can't make bucket for %s", e.SiteID)
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return errors.Wrapf(err, "can't marshal audit entry %s", e.ID)
+			}
+			if err = bkt.Put(entryKey(e), data); err != nil {
+				return errors.Wrapf(err, "can't put audit entry %s", e.ID)
+			}
+		}
+		return nil
+	})
+}
+
+// List entries for site matching request, newest first
+func (b *Bolt) List(req Request) (res []Entry, err error) {
+	res = []Entry{}
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(req.SiteID))
+		if bkt == nil {
+			return nil // nothing logged for site
+		}
+		c := bkt.Cursor()
+		k, v := c.Last()
+		if !req.To.IsZero() {
+			// seek to the first key after the range end and step back
+			k, v = c.Seek([]byte(req.To.UTC().Add(time.Nanosecond).Format(tsKeyFormat)))
+			if k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+		skipped := 0
+		for ; k != nil; k, v = c.Prev() {
+			if !req.From.IsZero() && bytes.Compare(k, []byte(req.From.UTC().Format(tsKeyFormat))) < 0 {
+				break
+			}
+			entry := Entry{}
+			if e := json.Unmarshal(v, &entry); e != nil {
+				return errors.Wrapf(e, "can't unmarshal audit entry %s", string(k))
+			}
+			if !req.match(entry) {
+				continue
+			}
+			if skipped < req.Skip {
+				skipped++
+				continue
+			}
+			res = append(res, entry)
+			if req.Limit > 0 && len(res) >= req.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+// Close bolt db
+func (b *Bolt) Close() error {
+	return errors.Wrap(b.db.Close(), "can't close audit db")
+}
+
+func entryKey(e Entry) []byte {
+	return []byte(e.Timestamp.UTC().Format(tsKeyFormat) + "!!" + e.ID)
+}
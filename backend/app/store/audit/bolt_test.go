@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+const testAuditDB = "/tmp/test-remark-audit.db"
+
+func TestBolt_AddList(t *testing.T) {
+	b, teardown := prepBolt(t)
+	defer teardown()
+
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	err := b.Add(
+		Entry{SiteID: "radio-t", Timestamp: ts, Action: ActionPin, Actor: Actor{ID: "admin1", Name: "Admin One"}, CommentID: "c1"},
+		Entry{SiteID: "radio-t", Timestamp: ts.Add(time.Minute), Action: ActionBlock, Actor: Actor{ID: "admin2"}, UserID: "u1",
+			Params: map[string]string{"block": "true"}},
+		Entry{SiteID: "radio-t", Timestamp: ts.Add(2 * time.Minute), Action: ActionPin, Actor: Actor{ID: "admin2"}, CommentID: "c2"},
+		Entry{SiteID: "other", Timestamp: ts, Action: ActionDelete, Actor: Actor{ID: "admin1"}, CommentID: "c3"},
+	)
+	require.NoError(t, err)
+
+	res, err := b.List(Request{SiteID: "radio-t"})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res))
+	assert.Equal(t, "c2", res[0].CommentID, "newest first")
+	assert.Equal(t, "u1", res[1].UserID)
+	assert.Equal(t, map[string]string{"block": "true"}, res[1].Params)
+	assert.Equal(t, "c1", res[2].CommentID)
+	assert.Equal(t, Actor{ID: "admin1", Name: "Admin One"}, res[2].Actor)
+	assert.NotEmpty(t, res[2].ID, "id filled")
+
+	res, err = b.List(Request{SiteID: "radio-t", Action: ActionPin})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "c2", res[0].CommentID)
+	assert.Equal(t, "c1", res[1].CommentID)
+
+	res, err = b.List(Request{SiteID: "radio-t", ActorID: "admin2"})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+
+	res, err = b.List(Request{SiteID: "radio-t", From: ts.Add(time.Minute), To: ts.Add(time.Minute)})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res), "inclusive range")
+	assert.Equal(t, ActionBlock, res[0].Action)
+
+	res, err = b.List(Request{SiteID: "radio-t", To: ts.Add(30 * time.Second)})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "c1", res[0].CommentID)
+
+	res, err = b.List(Request{SiteID: "radio-t", From: ts.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+
+	res, err = b.List(Request{SiteID: "radio-t", Skip: 1, Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "u1", res[0].UserID)
+
+	res, err = b.List(Request{SiteID: "bad"})
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{}, res)
+}
+
+func TestBolt_AddFailed(t *testing.T) {
+	b, teardown := prepBolt(t)
+	defer teardown()
+
+	err := b.Add(Entry{Action: ActionPin})
+	assert.EqualError(t, err, "empty site id for audit entry")
+
+	_, err = NewBoltStorage("/dev/null/bad.db", bolt.Options{})
+	assert.Error(t, err)
+}
+
+func TestBolt_AddDefaults(t *testing.T) {
+	b, teardown := prepBolt(t)
+	defer teardown()
+
+	require.NoError(t, b.Add(Entry{SiteID: "radio-t", Action: ActionVerify}))
+	res, err := b.List(Request{SiteID: "radio-t"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.NotEmpty(t, res[0].ID)
+	assert.True(t, time.Since(res[0].Timestamp) < time.Minute)
+}
+
+func prepBolt(t *testing.T) (b *Bolt, teardown func()) {
+	_ = os.Remove(testAuditDB)
+	b, err := NewBoltStorage(testAuditDB, bolt.Options{})
+	require.NoError(t, err)
+	return b, func() {
+		_ = b.Close()
+		_ = os.Remove(testAuditDB)
+	}
+}
@@ -22,10 +22,17 @@ type Comment struct {
 	VotedIPs    map[string]VotedIPInfo `json:"voted_ips,omitempty"` // voted ips (hashes) with TS
 	Vote        int                    `json:"vote"`                // vote for the current user, -1/1/0.
 	Controversy float64                `json:"controversy,omitempty"`
+	ReactedBy   map[string][]string    `json:"reacted_by,omitempty"` // ids of reacted users by reaction, admins only
+	Reactions   map[string]int         `json:"reactions,omitempty"`  // number of reacted users by reaction
+	Reacted     []string               `json:"reacted,omitempty"`    // reactions of the current user
+	Mentions    []string               `json:"mentions,omitempty"`   // ids of users mentioned in text
+	Muted       bool                   `json:"muted,omitempty"`      // author muted by the current user
 	Timestamp   time.Time              `json:"time" bson:"time"`
 	Edit        *Edit                  `json:"edit,omitempty" bson:"edit,omitempty"` // pointer to have empty default in json response
 	Pin         bool                   `json:"pin,omitempty" bson:"pin,omitempty"`
 	Deleted     bool                   `json:"delete,omitempty" bson:"delete"`
+	Pending     bool                   `json:"pending,omitempty" bson:"pending"`     // held for moderation, not approved yet
+	Spam        *SpamCheck             `json:"spam,omitempty" bson:"spam,omitempty"` // result of spam check, admins only
 	Imported    bool                   `json:"imported,omitempty" bson:"imported"`
 	PostTitle   string                 `json:"title,omitempty" bson:"title"`
 }
@@ -42,6 +49,57 @@ type Edit struct {
 	Summary   string    `json:"summary"`
 }
 
+// SpamCheck keeps result of spam check for audit
+type SpamCheck struct {
+	Timestamp time.Time `json:"time" bson:"time"`
+	Score     float64   `json:"score"`
+	Reasons   []string  `json:"reasons,omitempty"`
+	Flagged   bool      `json:"flagged,omitempty"` // score above threshold, comment held for review
+}
+
+// Report is a user's complaint about comment, one per user and comment
+type Report struct {
+	Locator   Locator      `json:"locator"`
+	CommentID string       `json:"comment_id"`
+	UserID    string       `json:"user_id"`
+	Reason    ReportReason `json:"reason"`
+	Text      string       `json:"text,omitempty"`
+	Timestamp time.Time    `json:"time"`
+}
+
+// ReportReason defines category of report
+type ReportReason string
+
+// enum of all report reasons
+const (
+	ReportSpam     ReportReason = "spam"
+	ReportAbuse    ReportReason = "abuse"
+	ReportOfftopic ReportReason = "offtopic"
+	ReportOther    ReportReason = "other"
+)
+
+// Valid checks if reason is one of known categories
+func (r ReportReason) Valid() bool {
+	switch r {
+	case ReportSpam, ReportAbuse, ReportOfftopic, ReportOther:
+		return true
+	}
+	return false
+}
+
+// Subscription is user's request for email notifications about all new comments of the post or of the thread
+type Subscription struct {
+	Locator   Locator   `json:"locator"`
+	UserID    string    `json:"user_id"`
+	CommentID string    `json:"comment_id,omitempty"` // root comment of the thread, the whole post if empty
+	Timestamp time.Time `json:"time"`
+}
+
+// ID makes subscription's id, unique per user
+func (s Subscription) ID() string {
+	return EncodeID(s.Locator.URL + "::" + s.CommentID)
+}
+
 // PostInfo holds summary for given post url
 type PostInfo struct {
 	URL      string    `json:"url"`
@@ -53,9 +111,10 @@ type PostInfo struct {
 
 // BlockedUser holds id and ts for blocked user
 type BlockedUser struct {
-	ID    string    `json:"id"`
-	Name  string    `json:"name"`
-	Until time.Time `json:"time"`
+	ID     string    `json:"id"`
+	Name   string    `json:"name"`
+	Until  time.Time `json:"time"`
+	Shadow bool      `json:"shadow,omitempty"` // comments of the user hidden from others, user not aware of block
 }
 
 // VotedIPInfo keeps timestamp and voting value (direction). Used as VotedIPs value
@@ -84,9 +143,15 @@ func (c *Comment) PrepareUntrusted() {
 	c.Timestamp = time.Time{} // reset time, force auto-gen
 	c.Votes = make(map[string]bool)
 	c.Score = 0
+	c.ReactedBy, c.Reactions, c.Reacted = nil, nil, nil
+	c.Mentions = nil
+	c.Muted = false
 	c.Edit = nil
 	c.Pin = false
 	c.Deleted = false
+	c.Pending = false
+	c.Spam = nil
+	c.Imported = false
 }
 
 // SetDeleted clears comment info, reset to deleted state. hard flag will clear all user info as well
@@ -95,6 +160,7 @@ func (c *Comment) SetDeleted(mode DeleteMode) {
 	c.Orig = ""
 	c.Score = 0
 	c.Votes = map[string]bool{}
+	c.ReactedBy = nil
 	c.Edit = nil
 	c.Deleted = true
 	c.Pin = false
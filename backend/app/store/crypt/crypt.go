@@ -0,0 +1,240 @@
+// Package crypt provides envelope encryption of sensitive values kept in the store, like user emails.
+// Each value encrypted with its own random data key, and the data key encrypted with the master key,
+// both kept together with id of the master key, i.e. enc1:key-id:encrypted-data-key:encrypted-value.
+// Values used for lookups, like hashes of voters' ips, encrypted deterministically with a key derived from
+// the master key, so the same value always encrypted the same way, i.e. enc1d:key-id:encrypted-value.
+// Master key is separate from the secret used for hashes, so leaked secret and store don't reveal them.
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	envelopePrefix      = "enc1:"
+	deterministicPrefix = "enc1d:"
+	minKeyLen           = 16
+)
+
+// ErrNoKey returned on decryption of encrypted value without keys
+var ErrNoKey = errors.New("value encrypted, but no encryption key set")
+
+// ErrWrongKey returned on decryption of value encrypted with unknown key
+var ErrWrongKey = errors.New("value encrypted with unknown key")
+
+// Crypter encrypts values with the current master key and decrypts values encrypted with the current
+// or any of old keys, so data encrypted before rotation, i.e. in backups, still readable
+type Crypter struct {
+	current *masterKey
+	keys    map[string]*masterKey // all keys by id, the current one included
+}
+
+type masterKey struct {
+	id     string      // first bytes of key's hash, kept with encrypted values to detect the key used
+	kek    cipher.AEAD // encrypts data keys
+	det    cipher.AEAD // encrypts deterministic values
+	detMAC []byte      // makes nonce of deterministic values
+}
+
+// New makes Crypter with the current key, used for encryption, and old keys used for decryption only.
+// Keys are arbitrary strings of at least 16 characters
+func New(key string, oldKeys ...string) (*Crypter, error) {
+	res := &Crypter{keys: map[string]*masterKey{}}
+	for i, k := range append([]string{key}, oldKeys...) {
+		mk, err := newMasterKey(k)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			res.current = mk
+		}
+		if _, found := res.keys[mk.id]; !found {
+			res.keys[mk.id] = mk
+		}
+	}
+	return res, nil
+}
+
+// KeyID returns id of the current key
+func (c *Crypter) KeyID() string {
+	return c.current.id
+}
+
+// Encrypt value with its own random data key. Empty value not encrypted
+func (c *Crypter) Encrypt(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", errors.Wrap(err, "can't make data key")
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(c.current.kek, dek, []byte(c.current.id))
+	if err != nil {
+		return "", errors.Wrap(err, "can't encrypt data key")
+	}
+	sealed, err := seal(aead, []byte(value), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "can't encrypt value")
+	}
+	return envelopePrefix + c.current.id + ":" + encode(wrapped) + ":" + encode(sealed), nil
+}
+
+// EncryptDeterministic encrypts value the same way each time, so encrypted values can be compared.
+// Nonce made from hmac of the value. Empty value not encrypted
+func (c *Crypter) EncryptDeterministic(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, c.current.detMAC)
+	_, _ = mac.Write([]byte(value))
+	nonce := mac.Sum(nil)[:c.current.det.NonceSize()]
+	sealed := c.current.det.Seal(nonce, nonce, []byte(value), []byte(c.current.id))
+	return deterministicPrefix + c.current.id + ":" + encode(sealed)
+}
+
+// Decrypt value encrypted with any known key. Not encrypted value returned as is
+func (c *Crypter) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if c == nil {
+		return "", ErrNoKey
+	}
+
+	if strings.HasPrefix(value, deterministicPrefix) {
+		parts := strings.Split(strings.TrimPrefix(value, deterministicPrefix), ":")
+		if len(parts) != 2 {
+			return "", errors.New("malformed encrypted value")
+		}
+		mk, err := c.key(parts[0])
+		if err != nil {
+			return "", err
+		}
+		res, err := open(mk.det, parts[1], []byte(mk.id))
+		return string(res), err
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, envelopePrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("malformed encrypted value")
+	}
+	mk, err := c.key(parts[0])
+	if err != nil {
+		return "", err
+	}
+	dek, err := open(mk.kek, parts[1], []byte(mk.id))
+	if err != nil {
+		return "", errors.Wrap(err, "can't decrypt data key")
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	res, err := open(aead, parts[2], nil)
+	return string(res), err
+}
+
+// Reencrypt decrypts value with from and encrypts it with to the same way it was encrypted before, deterministically or not.
+// Nil from means value not encrypted yet, nil to decrypts value
+func Reencrypt(value string, from, to *Crypter) (string, error) {
+	plain, err := from.Decrypt(value)
+	if err != nil || to == nil {
+		return plain, err
+	}
+	if strings.HasPrefix(value, deterministicPrefix) {
+		return to.EncryptDeterministic(plain), nil
+	}
+	return to.Encrypt(plain)
+}
+
+// IsEncrypted checks if value encrypted by Crypter
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix) || strings.HasPrefix(value, deterministicPrefix)
+}
+
+// IsCurrent checks if value encrypted with the current key
+func (c *Crypter) IsCurrent(value string) bool {
+	return c != nil && (strings.HasPrefix(value, envelopePrefix+c.current.id+":") ||
+		strings.HasPrefix(value, deterministicPrefix+c.current.id+":"))
+}
+
+func (c *Crypter) key(id string) (*masterKey, error) {
+	mk, found := c.keys[id]
+	if !found {
+		return nil, errors.Wrapf(ErrWrongKey, "key %s", id)
+	}
+	return mk, nil
+}
+
+// newMasterKey derives keys for data keys and deterministic values from the master key
+func newMasterKey(key string) (*masterKey, error) {
+	if len(key) < minKeyLen {
+		return nil, errors.Errorf("encryption key should be at least %d characters", minKeyLen)
+	}
+	derive := func(purpose string) []byte {
+		h := sha256.Sum256([]byte("remark42-" + purpose + ":" + key))
+		return h[:]
+	}
+	kek, err := newAEAD(derive("kek"))
+	if err != nil {
+		return nil, err
+	}
+	det, err := newAEAD(derive("det"))
+	if err != nil {
+		return nil, err
+	}
+	return &masterKey{id: hex.EncodeToString(derive("id"))[:8], kek: kek, det: det, detMAC: derive("mac")}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't make cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	return aead, errors.Wrap(err, "can't make gcm")
+}
+
+// seal encrypts data with random nonce, nonce kept at the beginning of the result
+func seal(aead cipher.AEAD, data, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, additional), nil
+}
+
+// open decodes and decrypts data made by seal
+func open(aead cipher.AEAD, encoded string, additional []byte) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't decode encrypted value")
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted value too short")
+	}
+	res, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additional)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't decrypt value")
+	}
+	return res, nil
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
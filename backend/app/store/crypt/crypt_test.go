@@ -0,0 +1,159 @@
+package crypt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrypter_EncryptDecrypt(t *testing.T) {
+	c, err := New("0123456789abcdef-key")
+	require.NoError(t, err)
+	assert.Equal(t, 8, len(c.KeyID()))
+
+	enc, err := c.Encrypt("user@example.com")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(enc, "enc1:"+c.KeyID()+":"), enc)
+	assert.NotContains(t, enc, "user@example.com")
+	assert.True(t, IsEncrypted(enc))
+	assert.True(t, c.IsCurrent(enc))
+
+	enc2, err := c.Encrypt("user@example.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, enc, enc2, "random data key and nonce")
+
+	for _, v := range []string{enc, enc2} {
+		dec, e := c.Decrypt(v)
+		require.NoError(t, e)
+		assert.Equal(t, "user@example.com", dec)
+	}
+
+	enc, err = c.Encrypt("")
+	require.NoError(t, err)
+	assert.Equal(t, "", enc, "empty value not encrypted")
+
+	dec, err := c.Decrypt("plain@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "plain@example.com", dec, "not encrypted value as is")
+	assert.False(t, c.IsCurrent("plain@example.com"))
+}
+
+func TestCrypter_EncryptDeterministic(t *testing.T) {
+	c, err := New("0123456789abcdef-key")
+	require.NoError(t, err)
+
+	enc := c.EncryptDeterministic("ip-hash-1")
+	assert.True(t, strings.HasPrefix(enc, "enc1d:"+c.KeyID()+":"), enc)
+	assert.Equal(t, enc, c.EncryptDeterministic("ip-hash-1"), "the same value encrypted the same way")
+	assert.NotEqual(t, enc, c.EncryptDeterministic("ip-hash-2"))
+	assert.Equal(t, "", c.EncryptDeterministic(""))
+	assert.True(t, c.IsCurrent(enc))
+
+	dec, err := c.Decrypt(enc)
+	require.NoError(t, err)
+	assert.Equal(t, "ip-hash-1", dec)
+
+	other, err := New("another-key-0123456789")
+	require.NoError(t, err)
+	assert.NotEqual(t, enc, other.EncryptDeterministic("ip-hash-1"), "depends on key")
+}
+
+func TestCrypter_WrongKey(t *testing.T) {
+	c, err := New("0123456789abcdef-key")
+	require.NoError(t, err)
+	other, err := New("another-key-0123456789")
+	require.NoError(t, err)
+
+	enc, err := c.Encrypt("user@example.com")
+	require.NoError(t, err)
+	_, err = other.Decrypt(enc)
+	assert.True(t, errors.Is(err, ErrWrongKey), err)
+	_, err = other.Decrypt(c.EncryptDeterministic("ip-hash"))
+	assert.True(t, errors.Is(err, ErrWrongKey), err)
+
+	var noKey *Crypter
+	_, err = noKey.Decrypt(enc)
+	assert.Equal(t, ErrNoKey, err)
+	dec, err := noKey.Decrypt("plain")
+	require.NoError(t, err)
+	assert.Equal(t, "plain", dec)
+
+	// key id matches, but value tampered
+	parts := strings.Split(enc, ":")
+	parts[3] = parts[3][:len(parts[3])-2] + "AA"
+	_, err = c.Decrypt(strings.Join(parts, ":"))
+	assert.Error(t, err)
+	_, err = c.Decrypt("enc1:" + c.KeyID() + ":bad")
+	assert.EqualError(t, err, "malformed encrypted value")
+	_, err = c.Decrypt("enc1d:" + c.KeyID() + ":!!!")
+	assert.Error(t, err)
+
+	_, err = New("short")
+	assert.EqualError(t, err, "encryption key should be at least 16 characters")
+	_, err = New("0123456789abcdef-key", "short")
+	assert.Error(t, err)
+}
+
+func TestCrypter_OldKeys(t *testing.T) {
+	old, err := New("old-key-0123456789")
+	require.NoError(t, err)
+	enc, err := old.Encrypt("user@example.com")
+	require.NoError(t, err)
+	det := old.EncryptDeterministic("ip-hash")
+
+	c, err := New("new-key-0123456789", "old-key-0123456789")
+	require.NoError(t, err)
+	assert.NotEqual(t, old.KeyID(), c.KeyID())
+	assert.False(t, c.IsCurrent(enc))
+
+	dec, err := c.Decrypt(enc)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", dec, "decrypted with old key")
+	dec, err = c.Decrypt(det)
+	require.NoError(t, err)
+	assert.Equal(t, "ip-hash", dec)
+
+	enc, err = c.Encrypt("user@example.com")
+	require.NoError(t, err)
+	assert.True(t, c.IsCurrent(enc), "encrypted with the current key")
+	_, err = old.Decrypt(enc)
+	assert.True(t, errors.Is(err, ErrWrongKey))
+}
+
+func TestReencrypt(t *testing.T) {
+	old, err := New("old-key-0123456789")
+	require.NoError(t, err)
+	c, err := New("new-key-0123456789")
+	require.NoError(t, err)
+
+	// plain value encrypted
+	enc, err := Reencrypt("user@example.com", nil, old)
+	require.NoError(t, err)
+	assert.True(t, old.IsCurrent(enc))
+
+	// rotated to new key
+	enc, err = Reencrypt(enc, old, c)
+	require.NoError(t, err)
+	assert.True(t, c.IsCurrent(enc))
+	dec, err := c.Decrypt(enc)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", dec)
+
+	// deterministic value stays deterministic
+	det, err := Reencrypt(old.EncryptDeterministic("ip-hash"), old, c)
+	require.NoError(t, err)
+	assert.Equal(t, c.EncryptDeterministic("ip-hash"), det)
+
+	// decrypted completely
+	dec, err = Reencrypt(enc, c, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", dec)
+
+	_, err = Reencrypt(enc, old, c)
+	assert.True(t, errors.Is(err, ErrWrongKey), "wrong old key")
+	_, err = Reencrypt(enc, nil, c)
+	assert.Equal(t, ErrNoKey, err, "encrypted value without old key")
+}
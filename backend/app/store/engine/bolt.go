@@ -2,9 +2,12 @@ package engine
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/go-pkgz/lgr"
@@ -26,8 +29,24 @@ import (
 //  - blocking info sits in "block" bucket. Key is userID, value - ts
 //  - counts per post to keep number of comments. Key is post url, value - count
 //  - readonly per post to keep status of manually set RO posts. Key is post url, value - ts
+//  - pending comments held for moderation. Key is reference (post-url+commentID), value - ts
+//  - reports of comments in "reports" bucket. Key is commentID, value - list of reports
+//  - email subscriptions to posts and threads in "subscriptions" bucket. Key is userID!!subscriptionID, value - subscription
+//  - change log in "changes" bucket. Key is big-endian sequence number, value - Change
+//  - version of the schema in "meta" bucket, key "schema_version". Upgraded by migrations on open, see bolt_migrate.go
 type BoltDB struct {
-	dbs map[string]*bolt.DB
+	ChangesRetention ChangesRetention // limits of change log, unlimited if not set
+	SitesPath        string           // directory of files of sites added at runtime, file named {site}.db
+
+	dbs     map[string]*bolt.DB
+	options bolt.Options
+	lock    sync.RWMutex // protects dbs, sites can be added and removed at runtime
+}
+
+// ChangesRetention defines how long change log entries kept, entries dropped as soon as any limit exceeded
+type ChangesRetention struct {
+	MaxAge   time.Duration // drop entries older than this
+	MaxCount int           // keep this number of last entries only
 }
 
 const (
@@ -37,9 +56,15 @@ const (
 	userBucketName        = "users"
 	userDetailsBucketName = "user_details"
 	blocksBucketName      = "block"
+	shadowBucketName      = "shadow_block"
 	infoBucketName        = "info"
 	readonlyBucketName    = "readonly"
 	verifiedBucketName    = "verified"
+	pendingBucketName     = "pending"
+	reportsBucketName     = "reports"
+	subscrBucketName      = "subscriptions"
+	changesBucketName     = "changes"
+	metaBucketName        = "meta"
 
 	tsNano = "2006-01-02T15:04:05.000000000Z07:00"
 )
@@ -51,35 +76,94 @@ type BoltSite struct {
 }
 
 // NewBoltDB makes persistent boltdb-based store. For each site new boltdb file created
+// or existing one upgraded to the current schema version, see migrate
 func NewBoltDB(options bolt.Options, sites ...BoltSite) (*BoltDB, error) {
 	log.Printf("[INFO] bolt store for sites %+v, options %+v", sites, options)
-	result := BoltDB{dbs: make(map[string]*bolt.DB)}
+	result := BoltDB{dbs: make(map[string]*bolt.DB), options: options}
 	for _, site := range sites {
-		db, err := bolt.Open(site.FileName, 0600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+		db, err := result.open(site)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to make boltdb for %s", site.FileName)
+			return nil, err
 		}
+		result.dbs[site.SiteID] = db
+		log.Printf("[DEBUG] bolt store created for %s", site.SiteID)
+	}
+	return &result, nil
+}
 
-		// make top-level buckets
-		topBuckets := []string{postsBucketName, lastBucketName, userBucketName, userDetailsBucketName,
-			blocksBucketName, infoBucketName, readonlyBucketName, verifiedBucketName}
-		err = db.Update(func(tx *bolt.Tx) error {
-			for _, bktName := range topBuckets {
-				if _, e := tx.CreateBucketIfNotExists([]byte(bktName)); e != nil {
-					return errors.Wrapf(e, "failed to create top level bucket %s", bktName)
-				}
-			}
-			return nil
-		})
+// AddSite opens boltdb file of the site in SitesPath, new file created if not exists
+func (b *BoltDB) AddSite(siteID string) error {
+	if b.SitesPath == "" {
+		return errors.Errorf("can't add site %s, sites path not set", siteID)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, ok := b.dbs[siteID]; ok {
+		return errors.Errorf("site %s already opened", siteID)
+	}
+	db, err := b.open(BoltSite{SiteID: siteID, FileName: fmt.Sprintf("%s/%s.db", b.SitesPath, siteID)})
+	if err != nil {
+		return err
+	}
+	b.dbs[siteID] = db
+	log.Printf("[INFO] bolt store added for %s", siteID)
+	return nil
+}
 
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to create top level bucket)")
+// RemoveSite closes boltdb file of the site, and removes the file if drop set
+func (b *BoltDB) RemoveSite(siteID string, drop bool) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	db, ok := b.dbs[siteID]
+	if !ok {
+		return errors.Errorf("site %q not found", siteID)
+	}
+	delete(b.dbs, siteID)
+	fileName := db.Path()
+	if err := db.Close(); err != nil {
+		return errors.Wrapf(err, "can't close site %s", siteID)
+	}
+	log.Printf("[INFO] bolt store removed for %s, drop %v", siteID, drop)
+	if !drop {
+		return nil
+	}
+	return errors.Wrapf(os.Remove(fileName), "can't remove file of site %s", siteID)
+}
+
+// open makes boltdb file of the site with top-level buckets, or upgrades schema of the existing one
+func (b *BoltDB) open(site BoltSite) (*bolt.DB, error) {
+	db, err := bolt.Open(site.FileName, 0600, &b.options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to make boltdb for %s", site.FileName)
+	}
+
+	// make top-level buckets
+	topBuckets := []string{postsBucketName, lastBucketName, userBucketName, userDetailsBucketName,
+		blocksBucketName, infoBucketName, readonlyBucketName, verifiedBucketName, pendingBucketName, reportsBucketName,
+		subscrBucketName, changesBucketName, shadowBucketName}
+	err = db.Update(func(tx *bolt.Tx) error {
+		fresh := tx.Bucket([]byte(postsBucketName)) == nil
+		for _, bktName := range topBuckets {
+			if _, e := tx.CreateBucketIfNotExists([]byte(bktName)); e != nil {
+				return errors.Wrapf(e, "failed to create top level bucket %s", bktName)
+			}
 		}
+		if fresh { // new db made with the current schema, nothing to migrate
+			return b.setSchemaVersion(tx, len(boltMigrations))
+		}
+		return nil
+	})
 
-		result.dbs[site.SiteID] = db
-		log.Printf("[DEBUG] bolt store created for %s", site.SiteID)
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "failed to create top level bucket)")
 	}
-	return &result, nil
+
+	if err = b.migrate(db, site.FileName); err != nil {
+		_ = db.Close()
+		return nil, errors.Wrapf(err, "failed to migrate %s", site.FileName)
+	}
+	return db, nil
 }
 
 // Create saves new comment to store. Adds to posts bucket, reference to last and user bucket and increments count bucket
@@ -127,11 +211,18 @@ func (b *BoltDB) Create(comment store.Comment) (commentID string, err error) {
 			return errors.Wrapf(err, "failed to put user comment %s for %s", comment.ID, comment.User.ID)
 		}
 
+		// keep reference to pending comment, it is not counted until approved
+		if comment.Pending {
+			if err = tx.Bucket([]byte(pendingBucketName)).Put(ref, commentTS); err != nil {
+				return errors.Wrapf(err, "can't put reference %s to %s", ref, pendingBucketName)
+			}
+		}
+
 		// set info with the count for post url
 		if _, err = b.setInfo(tx, comment); err != nil {
 			return errors.Wrapf(err, "failed to set info for %s", comment.Locator)
 		}
-		return nil
+		return b.addChange(tx, Change{Event: ChangeCreate, Comment: &comment})
 	})
 
 	return comment.ID, err
@@ -184,6 +275,8 @@ func (b *BoltDB) Find(req FindRequest) (comments []store.Comment, err error) {
 				return nil
 			})
 		})
+	case req.Locator.SiteID != "" && req.Pending: // find pending comments for site
+		comments, err = b.pendingComments(req.Locator.SiteID, req.Limit, req.Skip)
 	case req.Locator.SiteID != "" && req.Locator.URL == "" && req.UserID == "": // find last comments for site
 		comments, err = b.lastComments(req.Locator.SiteID, req.Limit, req.Since)
 	case req.Locator.SiteID != "" && req.UserID != "": // find comments for user
@@ -211,7 +304,7 @@ func (b *BoltDB) Flag(req FlagRequest) (val bool, err error) {
 // and all site's details listing under the same function (and not to extend interface by two separate functions).
 func (b *BoltDB) UserDetail(req UserDetailRequest) ([]UserDetailEntry, error) {
 	switch req.Detail {
-	case UserEmail:
+	case UserEmail, UserDigest, UserBio, UserWebsite, UserMuted:
 		if req.UserID == "" {
 			return nil, errors.New("userid cannot be empty in request for single detail")
 		}
@@ -233,16 +326,96 @@ func (b *BoltDB) UserDetail(req UserDetailRequest) ([]UserDetailEntry, error) {
 	}
 }
 
+// Report adds report to comment and returns all reports of this comment, gets reports of comment
+// or all reports of site if CommentID not set
+func (b *BoltDB) Report(req ReportRequest) (res []store.Report, err error) {
+	bdb, err := b.db(req.Locator.SiteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Update != nil {
+		return b.addReport(bdb, *req.Update)
+	}
+
+	res = []store.Report{}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(reportsBucketName))
+		if req.CommentID != "" {
+			reports := []store.Report{}
+			if e := b.load(bucket, req.CommentID, &reports); e == nil {
+				res = reports
+			}
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			reports := []store.Report{}
+			if e := json.Unmarshal(v, &reports); e != nil {
+				return errors.Wrapf(e, "failed to unmarshal reports for %s", string(k))
+			}
+			res = append(res, reports...)
+			return nil
+		})
+	})
+	return res, err
+}
+
+// Subscription adds subscription and returns it, gets subscriptions of post if URL set, of user if UserID set
+// or all subscriptions of site
+func (b *BoltDB) Subscription(req SubscriptionRequest) (res []store.Subscription, err error) {
+	bdb, err := b.db(req.Locator.SiteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Update != nil {
+		sub := *req.Update
+		if sub.UserID == "" || sub.Locator.URL == "" {
+			return nil, errors.New("user id and url required for subscription")
+		}
+		err = bdb.Update(func(tx *bolt.Tx) error {
+			return b.save(tx.Bucket([]byte(subscrBucketName)), b.subscrKey(sub.UserID, sub.ID()), sub)
+		})
+		return []store.Subscription{sub}, errors.Wrapf(err, "failed to add subscription of %s", sub.UserID)
+	}
+
+	res = []store.Subscription{}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(subscrBucketName)).Cursor()
+		prefix := []byte{}
+		if req.UserID != "" {
+			prefix = []byte(b.subscrKey(req.UserID, ""))
+		}
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			sub := store.Subscription{}
+			if e := json.Unmarshal(v, &sub); e != nil {
+				return errors.Wrapf(e, "failed to unmarshal subscription %s", string(k))
+			}
+			if req.Locator.URL != "" && sub.Locator.URL != req.Locator.URL {
+				continue
+			}
+			res = append(res, sub)
+		}
+		return nil
+	})
+	return res, err
+}
+
 // Update for locator.URL with mutable part of comment
 func (b *BoltDB) Update(comment store.Comment) error {
 
 	getReq := GetRequest{Locator: comment.Locator, CommentID: comment.ID}
-	if curComment, err := b.Get(getReq); err == nil {
+	curComment, err := b.Get(getReq)
+	if err == nil {
 		// preserve immutable fields
 		comment.ParentID = curComment.ParentID
 		comment.Locator = curComment.Locator
 		comment.Timestamp = curComment.Timestamp
+		ip := comment.User.IP
 		comment.User = curComment.User
+		if ip == "" { // user's ip can be cleared, i.e. by retention policy
+			comment.User.IP = ""
+		}
 	}
 
 	bdb, err := b.db(comment.Locator.SiteID)
@@ -255,7 +428,15 @@ func (b *BoltDB) Update(comment store.Comment) error {
 		if e != nil {
 			return e
 		}
-		return b.save(bucket, comment.ID, comment)
+		if e = b.save(bucket, comment.ID, comment); e != nil {
+			return e
+		}
+		if curComment.Pending != comment.Pending && curComment.ID != "" {
+			if e = b.setPending(tx, comment); e != nil {
+				return e
+			}
+		}
+		return b.addChange(tx, Change{Event: ChangeUpdate, Comment: &comment})
 	})
 }
 
@@ -372,9 +553,12 @@ func (b *BoltDB) ListFlags(req FlagRequest) (res []interface{}, err error) {
 			return nil
 		})
 		return res, err
-	case Blocked:
+	case Blocked, ShadowBlocked:
 		err = bdb.View(func(tx *bolt.Tx) error {
-			bucket := tx.Bucket([]byte(blocksBucketName))
+			bucket, e := b.flagBucket(tx, req.Flag)
+			if e != nil {
+				return e
+			}
 			return bucket.ForEach(func(k []byte, v []byte) error {
 				ts, errParse := time.ParseInLocation(tsNano, string(v), time.Local)
 				if errParse != nil {
@@ -407,21 +591,68 @@ func (b *BoltDB) Delete(req DeleteRequest) error {
 	}
 
 	switch {
+	case req.Reports && req.CommentID != "": // delete reports of comment
+		return bdb.Update(func(tx *bolt.Tx) error {
+			return b.deleteReports(tx, req.CommentID)
+		})
+	case req.Subscription && req.UserID != "": // delete subscription(s) of user
+		return b.deleteSubscriptions(bdb, req.UserID, req.Locator, req.CommentID)
 	case req.UserDetail != "": // delete user detail
-		return b.deleteUserDetail(bdb, req.UserID, req.UserDetail)
+		e = b.deleteUserDetail(bdb, req.UserID, req.UserDetail)
 	case req.Locator.URL != "" && req.CommentID != "" && req.UserDetail == "": // delete comment
-		return b.deleteComment(bdb, req.Locator, req.CommentID, req.DeleteMode)
+		e = b.deleteComment(bdb, req.Locator, req.CommentID, req.DeleteMode)
 	case req.Locator.SiteID != "" && req.UserID != "" && req.CommentID == "" && req.UserDetail == "": // delete user
-		return b.deleteUser(bdb, req.Locator.SiteID, req.UserID, req.DeleteMode)
+		e = b.deleteUser(bdb, req.Locator.SiteID, req.UserID, req.DeleteMode)
 	case req.Locator.SiteID != "" && req.Locator.URL == "" && req.CommentID == "" && req.UserID == "" && req.UserDetail == "": // delete site
-		return b.deleteAll(bdb, req.Locator.SiteID)
+		e = b.deleteAll(bdb, req.Locator.SiteID)
+	default:
+		return errors.Errorf("invalid delete request %+v", req)
+	}
+	if e != nil {
+		return e
 	}
 
-	return errors.Errorf("invalid delete request %+v", req)
+	// deletes made in multiple transactions, so change logged after all of them
+	return bdb.Update(func(tx *bolt.Tx) error {
+		return b.addChange(tx, Change{Event: ChangeDelete, Delete: &req})
+	})
+}
+
+// Changes returns entries of site's change log with sequence number greater than req.Since, oldest first,
+// or the last entry only with req.Last
+func (b *BoltDB) Changes(req ChangesRequest) (res []Change, err error) {
+	bdb, err := b.db(req.Locator.SiteID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Limit <= 0 || req.Limit > changesLimit {
+		req.Limit = changesLimit
+	}
+
+	res = []Change{}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(changesBucketName)).Cursor()
+		k, v := c.Seek(b.seqKey(req.Since + 1))
+		if req.Last {
+			k, v = c.Last()
+			req.Limit = 1
+		}
+		for ; k != nil && len(res) < req.Limit; k, v = c.Next() {
+			change := Change{}
+			if e := json.Unmarshal(v, &change); e != nil {
+				return errors.Wrapf(e, "failed to unmarshal change %d", binary.BigEndian.Uint64(k))
+			}
+			res = append(res, change)
+		}
+		return nil
+	})
+	return res, err
 }
 
 // Close boltdb store
 func (b *BoltDB) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
 	errs := new(multierror.Error)
 	for site, db := range b.dbs {
 		err := errors.Wrapf(db.Close(), "can't close site %s", site)
@@ -543,6 +774,79 @@ func (b *BoltDB) userComments(siteID, userID string, limit, skip int) (comments
 	return comments, err
 }
 
+// pendingComments returns pending comments for given site, skipping deleted
+func (b *BoltDB) pendingComments(siteID string, limit, skip int) (comments []store.Comment, err error) {
+	comments = []store.Comment{}
+
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bdb.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(pendingBucketName)).ForEach(func(k, _ []byte) error {
+			url, commentID, e := b.parseRef(k)
+			if e != nil {
+				return e
+			}
+			postBkt, e := b.getPostBucket(tx, url)
+			if e != nil {
+				return e
+			}
+			comment := store.Comment{}
+			if e = b.load(postBkt, commentID, &comment); e != nil {
+				log.Printf("[WARN] can't load pending comment %s from store %s", commentID, url)
+				return nil
+			}
+			if !comment.Deleted {
+				comments = append(comments, comment)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	comments = SortComments(comments, "time")
+	if skip > 0 {
+		if skip >= len(comments) {
+			return []store.Comment{}, nil
+		}
+		comments = comments[skip:]
+	}
+	if limit > 0 && limit < len(comments) {
+		comments = comments[:limit]
+	}
+	return comments, nil
+}
+
+// setPending adds or removes comment's reference in pending bucket and updates post's count accordingly.
+// Should run in update tx
+func (b *BoltDB) setPending(tx *bolt.Tx, comment store.Comment) error {
+	ref := b.makeRef(comment)
+	pendingBkt := tx.Bucket([]byte(pendingBucketName))
+	if comment.Pending {
+		if err := pendingBkt.Put(ref, []byte(comment.Timestamp.Format(tsNano))); err != nil {
+			return errors.Wrapf(err, "can't put reference %s to %s", ref, pendingBucketName)
+		}
+		if comment.Deleted {
+			return nil
+		}
+		_, err := b.count(tx, comment.Locator.URL, -1)
+		return errors.Wrapf(err, "failed to decrement count for %s", comment.Locator)
+	}
+
+	if err := pendingBkt.Delete(ref); err != nil {
+		return errors.Wrapf(err, "can't delete key %s from bucket %s", ref, pendingBucketName)
+	}
+	if comment.Deleted {
+		return nil
+	}
+	_, err := b.count(tx, comment.Locator.URL, 1)
+	return errors.Wrapf(err, "failed to increment count for %s", comment.Locator)
+}
+
 func (b *BoltDB) checkFlag(req FlagRequest) (val bool) {
 
 	bdb, err := b.db(req.Locator.SiteID)
@@ -555,10 +859,13 @@ func (b *BoltDB) checkFlag(req FlagRequest) (val bool) {
 		key = req.UserID
 	}
 
-	if req.Flag == Blocked {
+	if req.Flag == Blocked || req.Flag == ShadowBlocked {
 		var blocked bool
 		_ = bdb.View(func(tx *bolt.Tx) error {
-			bucket := tx.Bucket([]byte(blocksBucketName))
+			bucket, e := b.flagBucket(tx, req.Flag)
+			if e != nil {
+				return e
+			}
 			v := bucket.Get([]byte(key))
 			if v == nil {
 				blocked = false
@@ -605,30 +912,24 @@ func (b *BoltDB) setFlag(req FlagRequest) (res bool, err error) {
 		}
 		switch req.Update {
 		case FlagTrue:
-			if req.Flag == Blocked {
-				val := time.Now().AddDate(100, 0, 0).Format(tsNano) // permanent is 100 year
+			val := time.Now().Format(tsNano)
+			if req.Flag == Blocked || req.Flag == ShadowBlocked {
+				val = time.Now().AddDate(100, 0, 0).Format(tsNano) // permanent is 100 year
 				if req.TTL > 0 {
 					val = time.Now().Add(req.TTL).Format(tsNano)
 				}
-				if e = bucket.Put([]byte(key), []byte(val)); e != nil {
-					return errors.Wrapf(e, "failed to put blocked to %s", key)
-				}
-				res = true
-				return nil
 			}
-
-			if e = bucket.Put([]byte(key), []byte(time.Now().Format(tsNano))); e != nil {
-				return errors.Wrapf(e, "failed to set flag %s for %s", req.Flag, req.Locator.URL)
+			if e = bucket.Put([]byte(key), []byte(val)); e != nil {
+				return errors.Wrapf(e, "failed to set flag %s for %s", req.Flag, key)
 			}
 			res = true
-			return nil
 		case FlagFalse:
 			if e = bucket.Delete([]byte(key)); e != nil {
-				return errors.Wrapf(e, "failed to clean flag %s for %s", req.Flag, req.Locator.URL)
+				return errors.Wrapf(e, "failed to clean flag %s for %s", req.Flag, key)
 			}
 			res = false
 		}
-		return nil
+		return b.addChange(tx, Change{Event: ChangeFlag, Flag: &req})
 	})
 
 	return res, err
@@ -640,6 +941,8 @@ func (b *BoltDB) flagBucket(tx *bolt.Tx, flag Flag) (bkt *bolt.Bucket, err error
 		bkt = tx.Bucket([]byte(readonlyBucketName))
 	case Blocked:
 		bkt = tx.Bucket([]byte(blocksBucketName))
+	case ShadowBlocked:
+		bkt = tx.Bucket([]byte(shadowBucketName))
 	case Verified:
 		bkt = tx.Bucket([]byte(verifiedBucketName))
 	default:
@@ -668,6 +971,14 @@ func (b *BoltDB) getUserDetail(req UserDetailRequest) (result []UserDetailEntry,
 			switch req.Detail {
 			case UserEmail:
 				result = []UserDetailEntry{{UserID: req.UserID, Email: entry.Email}}
+			case UserDigest:
+				result = []UserDetailEntry{{UserID: req.UserID, Digest: entry.Digest}}
+			case UserBio:
+				result = []UserDetailEntry{{UserID: req.UserID, Bio: entry.Bio}}
+			case UserWebsite:
+				result = []UserDetailEntry{{UserID: req.UserID, Website: entry.Website}}
+			case UserMuted:
+				result = []UserDetailEntry{{UserID: req.UserID, Muted: entry.Muted}}
 			}
 		}
 		return nil
@@ -708,11 +1019,21 @@ func (b *BoltDB) setUserDetail(req UserDetailRequest) (result []UserDetailEntry,
 	switch req.Detail {
 	case UserEmail:
 		entry.Email = req.Update
+	case UserDigest:
+		entry.Digest = req.Update
+	case UserBio:
+		entry.Bio = req.Update
+	case UserWebsite:
+		entry.Website = req.Update
+	case UserMuted:
+		entry.Muted = req.Update
 	}
 
 	err = bdb.Update(func(tx *bolt.Tx) error {
-		err = b.save(tx.Bucket([]byte(userDetailsBucketName)), req.UserID, entry)
-		return errors.Wrapf(err, "failed to update detail %s for %s in %s", req.Detail, req.UserID, req.Locator.SiteID)
+		if err = b.save(tx.Bucket([]byte(userDetailsBucketName)), req.UserID, entry); err != nil {
+			return errors.Wrapf(err, "failed to update detail %s for %s in %s", req.Detail, req.UserID, req.Locator.SiteID)
+		}
+		return b.addChange(tx, Change{Event: ChangeUserDetail, UserDetail: &req})
 	})
 
 	return []UserDetailEntry{entry}, err
@@ -741,6 +1062,11 @@ func (b *BoltDB) listDetails(loc store.Locator) (result []UserDetailEntry, err e
 
 // deleteUserDetail deletes requested UserDetail or whole UserDetailEntry
 func (b *BoltDB) deleteUserDetail(bdb *bolt.DB, userID string, userDetail UserDetail) error {
+	if userDetail == AllUserDetails { // subscriptions are useless without user details
+		if err := b.deleteSubscriptions(bdb, userID, store.Locator{}, ""); err != nil {
+			return err
+		}
+	}
 	var entry UserDetailEntry
 	err := bdb.View(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte(userDetailsBucketName))
@@ -765,6 +1091,14 @@ func (b *BoltDB) deleteUserDetail(bdb *bolt.DB, userID string, userDetail UserDe
 	switch userDetail {
 	case UserEmail:
 		entry.Email = ""
+	case UserDigest:
+		entry.Digest = ""
+	case UserBio:
+		entry.Bio = ""
+	case UserWebsite:
+		entry.Website = ""
+	case UserMuted:
+		entry.Muted = ""
 	case AllUserDetails:
 		entry = UserDetailEntry{UserID: userID}
 	}
@@ -797,6 +1131,7 @@ func (b *BoltDB) deleteComment(bdb *bolt.DB, locator store.Locator, commentID st
 		if e = b.load(postBkt, commentID, &comment); e != nil {
 			return errors.Wrapf(e, "can't load key %s from bucket %s", commentID, locator.URL)
 		}
+		wasDeleted := comment.Deleted
 		// set deleted status and clear fields
 		comment.SetDeleted(mode)
 
@@ -804,12 +1139,30 @@ func (b *BoltDB) deleteComment(bdb *bolt.DB, locator store.Locator, commentID st
 			return errors.Wrapf(e, "can't save deleted comment for key %s from bucket %s", commentID, locator.URL)
 		}
 
+		if e = b.deleteReports(tx, commentID); e != nil {
+			return e
+		}
+
 		// delete from "last" bucket
 		lastBkt := tx.Bucket([]byte(lastBucketName))
 		if e = lastBkt.Delete([]byte(commentID)); e != nil {
 			return errors.Wrapf(e, "can't delete key %s from bucket %s", commentID, lastBucketName)
 		}
 
+		// comment deleted before, i.e. hard delete of soft-deleted comment, already not counted
+		if wasDeleted {
+			return nil
+		}
+
+		// pending comment is not counted, just drop it from pending bucket
+		if comment.Pending {
+			ref := b.makeRef(comment)
+			if e = tx.Bucket([]byte(pendingBucketName)).Delete(ref); e != nil {
+				return errors.Wrapf(e, "can't delete key %s from bucket %s", ref, pendingBucketName)
+			}
+			return nil
+		}
+
 		// decrement comments count for post url
 		if _, e = b.count(tx, comment.Locator.URL, -1); e != nil {
 			return errors.Wrapf(e, "failed to decrement count for %s", comment.Locator)
@@ -819,11 +1172,63 @@ func (b *BoltDB) deleteComment(bdb *bolt.DB, locator store.Locator, commentID st
 	})
 }
 
+// addReport saves report of the user, replacing previous report of the same user to the same comment
+func (b *BoltDB) addReport(bdb *bolt.DB, report store.Report) (res []store.Report, err error) {
+	if report.CommentID == "" || report.UserID == "" {
+		return nil, errors.New("comment id and user id required for report")
+	}
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(reportsBucketName))
+		if e := b.load(bucket, report.CommentID, &res); e != nil {
+			res = []store.Report{} // no reports for comment yet
+		}
+		res = mergeReport(res, report)
+		return b.save(bucket, report.CommentID, res)
+	})
+	return res, errors.Wrapf(err, "failed to add report for %s", report.CommentID)
+}
+
+// deleteReports removes all reports of comment. Should run in update tx
+func (b *BoltDB) deleteReports(tx *bolt.Tx, commentID string) error {
+	err := tx.Bucket([]byte(reportsBucketName)).Delete([]byte(commentID))
+	return errors.Wrapf(err, "can't delete key %s from bucket %s", commentID, reportsBucketName)
+}
+
+// deleteSubscriptions removes user's subscription to the post or to the thread of the post, all subscriptions of user if no url
+func (b *BoltDB) deleteSubscriptions(bdb *bolt.DB, userID string, locator store.Locator, commentID string) error {
+	err := bdb.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(subscrBucketName))
+		if locator.URL != "" {
+			sub := store.Subscription{Locator: locator, CommentID: commentID}
+			return bucket.Delete([]byte(b.subscrKey(userID, sub.ID())))
+		}
+		prefix := []byte(b.subscrKey(userID, ""))
+		keys := [][]byte{}
+		c := bucket.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, k)
+		}
+		for _, k := range keys {
+			if e := bucket.Delete(k); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+	return errors.Wrapf(err, "can't delete subscriptions of %s", userID)
+}
+
+// subscrKey makes key for subscriptions bucket, allows prefix search by userID
+func (b *BoltDB) subscrKey(userID, subscriptionID string) string {
+	return userID + "!!" + subscriptionID
+}
+
 // deleteAll removes all top-level buckets for given siteID
 func (b *BoltDB) deleteAll(bdb *bolt.DB, siteID string) error {
 
 	// delete all buckets except blocked users
-	toDelete := []string{postsBucketName, lastBucketName, userBucketName, userDetailsBucketName, infoBucketName}
+	toDelete := []string{postsBucketName, lastBucketName, userBucketName, userDetailsBucketName, infoBucketName,
+		pendingBucketName, reportsBucketName, subscrBucketName}
 
 	// delete top-level buckets
 	err := bdb.Update(func(tx *bolt.Tx) error {
@@ -1006,13 +1411,67 @@ func (b *BoltDB) setInfo(tx *bolt.Tx, comment store.Comment) (store.PostInfo, er
 			LastTS:  comment.Timestamp,
 		}
 	}
-	info.Count++
+	if !comment.Pending {
+		info.Count++
+	}
 	info.LastTS = comment.Timestamp
 	err := b.save(infoBkt, comment.Locator.URL, &info)
 	return info, err
 }
 
+// addChange appends entry to change log and drops entries beyond retention limits. Should run in update tx
+func (b *BoltDB) addChange(tx *bolt.Tx, change Change) error {
+	bkt := tx.Bucket([]byte(changesBucketName))
+	seq, err := bkt.NextSequence()
+	if err != nil {
+		return errors.Wrap(err, "can't get next change sequence")
+	}
+	change.Seq, change.Timestamp = seq, time.Now()
+	data, err := json.Marshal(change)
+	if err != nil {
+		return errors.Wrapf(err, "can't marshal change %d", seq)
+	}
+	if err = bkt.Put(b.seqKey(seq), data); err != nil {
+		return errors.Wrapf(err, "failed to put change %d", seq)
+	}
+
+	// entries sorted by sequence, so expired ones are always at the beginning
+	r := b.ChangesRetention
+	if r.MaxAge <= 0 && r.MaxCount <= 0 {
+		return nil
+	}
+	var expired [][]byte
+	c := bkt.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if r.MaxCount > 0 && seq-binary.BigEndian.Uint64(k) >= uint64(r.MaxCount) {
+			expired = append(expired, k)
+			continue
+		}
+		entry := Change{}
+		if r.MaxAge > 0 && json.Unmarshal(v, &entry) == nil && entry.Timestamp.Before(change.Timestamp.Add(-r.MaxAge)) {
+			expired = append(expired, k)
+			continue
+		}
+		break
+	}
+	for _, k := range expired {
+		if err = bkt.Delete(k); err != nil {
+			return errors.Wrapf(err, "failed to delete expired change %d", binary.BigEndian.Uint64(k))
+		}
+	}
+	return nil
+}
+
+// seqKey makes key of change log entry, big-endian to keep entries sorted by sequence
+func (b *BoltDB) seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
 func (b *BoltDB) db(siteID string) (*bolt.DB, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
 	if res, ok := b.dbs[siteID]; ok {
 		return res, nil
 	}
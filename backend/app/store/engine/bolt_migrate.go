@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+const schemaVersionKey = "schema_version"
+
+// boltMigration is a single step of schema upgrade, applied in its own update tx
+type boltMigration struct {
+	name  string
+	apply func(b *BoltDB, tx *bolt.Tx) error
+}
+
+// boltMigrations is an ordered list of schema upgrades, version of the schema is the number of applied steps.
+// New steps should be appended only, existing steps never changed or removed.
+// Site db made before versioning has version 0.
+var boltMigrations = []boltMigration{
+	{name: "recount comments of posts", apply: (*BoltDB).recountPosts},
+}
+
+// SchemaVersion returns version of the schema of site db
+func (b *BoltDB) SchemaVersion(siteID string) (version int, err error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return 0, err
+	}
+	err = bdb.View(func(tx *bolt.Tx) (e error) {
+		version, e = b.schemaVersion(tx)
+		return e
+	})
+	return version, err
+}
+
+// migrate upgrades schema of site db to the current version, db file copied to fileName.v{version}.bak
+// before the first step. Each step applied with the version update in the same tx, so failed step changes nothing
+// and the next open starts from it again
+func (b *BoltDB) migrate(bdb *bolt.DB, fileName string) error {
+	var version int
+	err := bdb.View(func(tx *bolt.Tx) (e error) {
+		version, e = b.schemaVersion(tx)
+		return e
+	})
+	if err != nil {
+		return err
+	}
+	if version > len(boltMigrations) {
+		return errors.Errorf("schema version %d is newer than supported %d", version, len(boltMigrations))
+	}
+	if version == len(boltMigrations) {
+		return nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", fileName, version)
+	if err = bdb.View(func(tx *bolt.Tx) error { return tx.CopyFile(backup, 0600) }); err != nil { //nolint:gocritic //octalLiteral is OK as FileMode
+		return errors.Wrapf(err, "failed to backup %s to %s", fileName, backup)
+	}
+	log.Printf("[INFO] migrate %s from schema version %d to %d, backup %s", fileName, version, len(boltMigrations), backup)
+
+	for i := version; i < len(boltMigrations); i++ {
+		m, next := boltMigrations[i], i+1
+		err = bdb.Update(func(tx *bolt.Tx) error {
+			if e := m.apply(b, tx); e != nil {
+				return e
+			}
+			return b.setSchemaVersion(tx, next)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to migrate to schema version %d, %s", next, m.name)
+		}
+		log.Printf("[INFO] %s migrated to schema version %d, %s", fileName, next, m.name)
+	}
+	return nil
+}
+
+// schemaVersion returns version of the schema, 0 if not set
+func (b *BoltDB) schemaVersion(tx *bolt.Tx) (int, error) {
+	bkt := tx.Bucket([]byte(metaBucketName))
+	if bkt == nil {
+		return 0, nil
+	}
+	val := bkt.Get([]byte(schemaVersionKey))
+	if val == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(string(val))
+	return version, errors.Wrapf(err, "bad schema version %q", string(val))
+}
+
+// setSchemaVersion saves version of the schema. Should run in update tx
+func (b *BoltDB) setSchemaVersion(tx *bolt.Tx, version int) error {
+	bkt, err := tx.CreateBucketIfNotExists([]byte(metaBucketName))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create bucket %s", metaBucketName)
+	}
+	return errors.Wrapf(bkt.Put([]byte(schemaVersionKey), []byte(strconv.Itoa(version))),
+		"failed to set schema version %d", version)
+}
+
+// recountPosts sets count of each post to the number of its comments, not deleted and not pending.
+// Versions before schema versioning decremented count twice on hard delete of soft-deleted comment
+func (b *BoltDB) recountPosts(tx *bolt.Tx) error {
+	postsBkt := tx.Bucket([]byte(postsBucketName))
+	infoBkt := tx.Bucket([]byte(infoBucketName))
+	return postsBkt.ForEach(func(postURL, _ []byte) error {
+		postBkt := postsBkt.Bucket(postURL)
+		if postBkt == nil {
+			return nil
+		}
+		count := 0
+		err := postBkt.ForEach(func(k, v []byte) error {
+			comment := store.Comment{}
+			if e := json.Unmarshal(v, &comment); e != nil {
+				return errors.Wrapf(e, "failed to unmarshal comment %s", string(k))
+			}
+			if !comment.Deleted && !comment.Pending {
+				count++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		info := store.PostInfo{}
+		if err = b.load(infoBkt, string(postURL), &info); err != nil {
+			return nil // no info for post, nothing to fix
+		}
+		if info.Count == count {
+			return nil
+		}
+		log.Printf("[DEBUG] count of %s changed from %d to %d", string(postURL), info.Count, count)
+		info.Count = count
+		return b.save(infoBkt, string(postURL), &info)
+	})
+}
@@ -0,0 +1,186 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+func TestBoltDB_MigrateFresh(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+
+	version, err := b.SchemaVersion("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, len(boltMigrations), version)
+	_, err = os.Stat(testDB + ".v0.bak")
+	assert.True(t, os.IsNotExist(err), "no backup for new db")
+
+	_, err = b.SchemaVersion("bad")
+	assert.Error(t, err)
+}
+
+func TestBoltDB_MigrateFromV0(t *testing.T) {
+	defer os.Remove(testDB + ".v0.bak")
+	makeV0Fixture(t)
+
+	b, err := NewBoltDB(bolt.Options{}, BoltSite{FileName: testDB, SiteID: "radio-t"})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, b.Close())
+		_ = os.Remove(testDB)
+	}()
+
+	version, err := b.SchemaVersion("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, len(boltMigrations), version)
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	count, err := b.Count(FindRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "count fixed")
+	info, err := b.Info(InfoRequest{Locator: locator})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(info))
+	assert.Equal(t, 2, info[0].Count)
+	comments, err := b.Find(FindRequest{Locator: locator, Sort: "time"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(comments))
+	comments, err = b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(comments))
+
+	// buckets missing in old layout created
+	_, err = b.Subscription(SubscriptionRequest{Locator: locator, Update: &store.Subscription{Locator: locator, UserID: "user1"}})
+	assert.NoError(t, err)
+
+	// backup made before migration
+	bkp, err := bolt.Open(testDB+".v0.bak", 0600, &bolt.Options{ReadOnly: true})
+	require.NoError(t, err)
+	defer bkp.Close()
+	err = bkp.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket([]byte(metaBucketName)))
+		info := store.PostInfo{}
+		require.NoError(t, b.load(tx.Bucket([]byte(infoBucketName)), "https://radio-t.com", &info))
+		assert.Equal(t, 1, info.Count)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestBoltDB_MigrateSteps(t *testing.T) {
+	defer func(orig []boltMigration) { boltMigrations = orig }(boltMigrations)
+	defer os.Remove(testDB + ".v1.bak")
+	defer os.Remove(testDB + ".v2.bak")
+	b, _ := prep(t)
+	require.NoError(t, b.Close())
+	defer os.Remove(testDB)
+
+	var applied []string
+	step := func(name string, err error) boltMigration {
+		return boltMigration{name: name, apply: func(b *BoltDB, tx *bolt.Tx) error {
+			if err != nil {
+				return err
+			}
+			applied = append(applied, name)
+			_, e := tx.CreateBucketIfNotExists([]byte(name))
+			return e
+		}}
+	}
+	boltMigrations = []boltMigration{step("step1", nil), step("step2", nil), step("step3", errors.New("failed"))}
+
+	// step 1 applied to new db already, step 2 applied and step 3 failed
+	_, err := NewBoltDB(bolt.Options{}, BoltSite{FileName: testDB, SiteID: "radio-t"})
+	require.EqualError(t, err, fmt.Sprintf("failed to migrate %s: failed to migrate to schema version 3, step3: failed", testDB))
+	assert.Equal(t, []string{"step2"}, applied)
+	_, err = os.Stat(testDB + ".v1.bak")
+	assert.NoError(t, err)
+
+	// next open starts from failed step
+	applied = nil
+	boltMigrations[2] = step("step3", nil)
+	b, err = NewBoltDB(bolt.Options{}, BoltSite{FileName: testDB, SiteID: "radio-t"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"step3"}, applied)
+	version, err := b.SchemaVersion("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 3, version)
+	err = b.dbs["radio-t"].View(func(tx *bolt.Tx) error {
+		assert.NotNil(t, tx.Bucket([]byte("step2")))
+		assert.NotNil(t, tx.Bucket([]byte("step3")))
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+
+	// db of newer version rejected
+	boltMigrations = boltMigrations[:2]
+	_, err = NewBoltDB(bolt.Options{}, BoltSite{FileName: testDB, SiteID: "radio-t"})
+	require.EqualError(t, err, fmt.Sprintf("failed to migrate %s: schema version 3 is newer than supported 2", testDB))
+
+	// backup keeps db before migration
+	bkp, err := bolt.Open(testDB+".v1.bak", 0600, &bolt.Options{ReadOnly: true})
+	require.NoError(t, err)
+	defer bkp.Close()
+	err = bkp.View(func(tx *bolt.Tx) error {
+		version, e := b.schemaVersion(tx)
+		assert.Equal(t, 1, version)
+		assert.Nil(t, tx.Bucket([]byte("step2")))
+		return e
+	})
+	require.NoError(t, err)
+}
+
+// makeV0Fixture makes db with layout of versions before schema versioning, without meta, pending, reports,
+// subscriptions and changes buckets. Count of the post decremented twice for hard-deleted comment
+func makeV0Fixture(t *testing.T) {
+	_ = os.Remove(testDB)
+	db, err := bolt.Open(testDB, 0600, &bolt.Options{})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	ts := time.Date(2019, 12, 20, 15, 18, 22, 0, time.UTC)
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	comments := []store.Comment{
+		{ID: "id-1", Text: "text 1", Timestamp: ts, Locator: locator, User: store.User{ID: "user1", Name: "user name"}},
+		{ID: "id-2", Text: "", Timestamp: ts.Add(time.Minute), Locator: locator, Deleted: true,
+			User: store.User{ID: "user1", Name: "user name"}},
+		{ID: "id-3", Text: "text 3", Timestamp: ts.Add(2 * time.Minute), Locator: locator,
+			User: store.User{ID: "user1", Name: "user name"}},
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{postsBucketName, lastBucketName, userBucketName, userDetailsBucketName,
+			blocksBucketName, infoBucketName, readonlyBucketName, verifiedBucketName} {
+			_, e := tx.CreateBucket([]byte(name))
+			require.NoError(t, e)
+		}
+		postBkt, e := tx.Bucket([]byte(postsBucketName)).CreateBucket([]byte(locator.URL))
+		require.NoError(t, e)
+		userBkt, e := tx.Bucket([]byte(userBucketName)).CreateBucket([]byte("user1"))
+		require.NoError(t, e)
+		for _, c := range comments {
+			data, e := json.Marshal(c)
+			require.NoError(t, e)
+			require.NoError(t, postBkt.Put([]byte(c.ID), data))
+			ref := []byte(locator.URL + "!!" + c.ID)
+			require.NoError(t, userBkt.Put([]byte(c.Timestamp.Format(tsNano)), ref))
+			if !c.Deleted {
+				require.NoError(t, tx.Bucket([]byte(lastBucketName)).Put([]byte(c.Timestamp.Format(tsNano)), ref))
+			}
+		}
+		info, e := json.Marshal(store.PostInfo{URL: locator.URL, Count: 1, FirstTS: ts, LastTS: ts.Add(2 * time.Minute)})
+		require.NoError(t, e)
+		return tx.Bucket([]byte(infoBucketName)).Put([]byte(locator.URL), info)
+	})
+	require.NoError(t, err)
+}
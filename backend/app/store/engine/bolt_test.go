@@ -122,6 +122,30 @@ func TestBoltDB_Update(t *testing.T) {
 	assert.EqualError(t, err, `no bucket https://radio-t.com-bad in store`)
 }
 
+func TestBoltDB_UpdateClearIP(t *testing.T) {
+	var b, teardown = prep(t)
+	defer teardown()
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := b.Create(store.Comment{ID: "id-ip", Text: "some text", Timestamp: time.Date(2017, 12, 20, 15, 20, 0, 0, time.Local),
+		Locator: locator, User: store.User{ID: "user1", Name: "user name", IP: "ip-hash"}})
+	require.NoError(t, err)
+
+	comment, err := b.Get(getReq(locator, "id-ip"))
+	require.NoError(t, err)
+	comment.User.Name, comment.User.IP = "changed", "other-ip-hash"
+	require.NoError(t, b.Update(comment))
+	comment, err = b.Get(getReq(locator, "id-ip"))
+	require.NoError(t, err)
+	assert.Equal(t, store.User{ID: "user1", Name: "user name", IP: "ip-hash"}, comment.User, "user immutable")
+
+	comment.User.IP = ""
+	require.NoError(t, b.Update(comment))
+	comment, err = b.Get(getReq(locator, "id-ip"))
+	require.NoError(t, err)
+	assert.Equal(t, store.User{ID: "user1", Name: "user name"}, comment.User, "ip cleared")
+}
+
 func TestBoltDB_FindLast(t *testing.T) {
 	var b, teardown = prep(t)
 	defer teardown()
@@ -302,6 +326,259 @@ func TestBoltDB_CountPost(t *testing.T) {
 	assert.EqualError(t, err, `site "bad" not found`)
 }
 
+func TestBoltDB_Pending(t *testing.T) {
+	var b, teardown = prep(t)
+	defer teardown()
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	for i := 3; i <= 5; i++ {
+		c := store.Comment{ID: fmt.Sprintf("id-%d", i), Text: fmt.Sprintf("pending %d", i), Pending: true, Locator: locator,
+			Timestamp: time.Date(2017, 12, 20, 15, 18, 20+i, 0, time.Local), User: store.User{ID: "user2", Name: "user name"}}
+		_, err := b.Create(c)
+		require.NoError(t, err)
+	}
+
+	c, err := b.Count(FindRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 2, c, "pending comments not counted")
+	info, err := b.Info(InfoRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 2, info[0].Count)
+
+	res, err := b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Pending: true})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res))
+	assert.Equal(t, "id-3", res[0].ID, "sorted by time")
+	assert.True(t, res[0].Pending)
+
+	res, err = b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Pending: true, Limit: 1, Skip: 1})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "id-4", res[0].ID)
+
+	// approve
+	approved := res[0]
+	approved.Pending = false
+	require.NoError(t, b.Update(approved))
+	c, err = b.Count(FindRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 3, c, "approved comment counted")
+
+	// reject
+	err = b.Delete(DeleteRequest{Locator: locator, CommentID: "id-5", DeleteMode: store.SoftDelete})
+	require.NoError(t, err)
+	c, err = b.Count(FindRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 3, c, "rejected comment not counted")
+
+	res, err = b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Pending: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "id-3", res[0].ID)
+
+	_, err = b.Find(FindRequest{Locator: store.Locator{SiteID: "bad"}, Pending: true})
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestBoltDB_Report(t *testing.T) {
+	var b, teardown = prep(t)
+	defer teardown()
+
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	report := func(commentID, userID string, reason store.ReportReason) []store.Report {
+		ts = ts.Add(time.Minute)
+		res, err := b.Report(ReportRequest{Locator: loc, Update: &store.Report{Locator: loc, CommentID: commentID,
+			UserID: userID, Reason: reason, Timestamp: ts}})
+		require.NoError(t, err)
+		return res
+	}
+	assert.Equal(t, 1, len(report("id-1", "user2", store.ReportSpam)))
+	assert.Equal(t, 2, len(report("id-1", "user3", store.ReportSpam)))
+	res := report("id-1", "user2", store.ReportAbuse)
+	require.Equal(t, 2, len(res), "report of the same user replaced")
+	assert.Equal(t, "user3", res[0].UserID)
+	assert.Equal(t, store.ReportAbuse, res[1].Reason)
+	assert.Equal(t, 1, len(report("id-2", "user2", store.ReportOther)))
+
+	res, err := b.Report(ReportRequest{Locator: loc})
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(res), "all reports of site")
+	res, err = b.Report(ReportRequest{Locator: loc, CommentID: "id-2"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, store.Report{Locator: loc, CommentID: "id-2", UserID: "user2", Reason: store.ReportOther, Timestamp: ts}, res[0])
+
+	// dismiss reports
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, CommentID: "id-1", Reports: true}))
+	res, err = b.Report(ReportRequest{Locator: loc, CommentID: "id-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+	comment, err := b.Get(GetRequest{Locator: loc, CommentID: "id-1"})
+	require.NoError(t, err)
+	assert.False(t, comment.Deleted, "comment kept")
+
+	// reports removed with comment
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, CommentID: "id-2", DeleteMode: store.SoftDelete}))
+	res, err = b.Report(ReportRequest{Locator: loc})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+
+	_, err = b.Report(ReportRequest{Locator: loc, Update: &store.Report{CommentID: "id-1"}})
+	assert.EqualError(t, err, "comment id and user id required for report")
+	_, err = b.Report(ReportRequest{Locator: store.Locator{SiteID: "bad"}})
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestBoltDB_Changes(t *testing.T) {
+	var b, teardown = prep(t) // two comments created
+	defer teardown()
+
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	comment, err := b.Get(GetRequest{Locator: loc, CommentID: "id-1"})
+	require.NoError(t, err)
+	comment.Text = "updated text"
+	require.NoError(t, b.Update(comment))
+	_, err = b.Flag(FlagRequest{Locator: loc, Flag: ReadOnly, Update: FlagTrue})
+	require.NoError(t, err)
+	_, err = b.Flag(FlagRequest{Locator: loc, Flag: ReadOnly}) // read doesn't change anything
+	require.NoError(t, err)
+	_, err = b.UserDetail(UserDetailRequest{Locator: loc, UserID: "user1", Detail: UserEmail, Update: "user1@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, CommentID: "id-2", DeleteMode: store.SoftDelete}))
+
+	res, err := b.Changes(ChangesRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	require.Equal(t, 6, len(res))
+	for i, c := range res {
+		assert.Equal(t, uint64(i+1), c.Seq)
+		assert.True(t, time.Since(c.Timestamp) < time.Minute)
+	}
+	assert.Equal(t, ChangeCreate, res[0].Event)
+	assert.Equal(t, "id-1", res[0].Comment.ID)
+	assert.Equal(t, ChangeUpdate, res[2].Event)
+	assert.Equal(t, "updated text", res[2].Comment.Text)
+	assert.Equal(t, ChangeFlag, res[3].Event)
+	assert.Equal(t, FlagRequest{Locator: loc, Flag: ReadOnly, Update: FlagTrue}, *res[3].Flag)
+	assert.Equal(t, ChangeUserDetail, res[4].Event)
+	assert.Equal(t, "user1@example.com", res[4].UserDetail.Update)
+	assert.Equal(t, ChangeDelete, res[5].Event)
+	assert.Equal(t, "id-2", res[5].Delete.CommentID)
+
+	res, err = b.Changes(ChangesRequest{Locator: store.Locator{SiteID: "radio-t"}, Since: 2, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, uint64(3), res[0].Seq)
+	assert.Equal(t, uint64(4), res[1].Seq)
+
+	res, err = b.Changes(ChangesRequest{Locator: store.Locator{SiteID: "radio-t"}, Since: 2, Last: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res), "head of the log")
+	assert.Equal(t, uint64(6), res[0].Seq)
+
+	res, err = b.Changes(ChangesRequest{Locator: store.Locator{SiteID: "radio-t"}, Since: 6})
+	require.NoError(t, err)
+	assert.Equal(t, []Change{}, res)
+
+	require.NoError(t, b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}}))
+	res, err = b.Changes(ChangesRequest{Locator: store.Locator{SiteID: "radio-t"}, Since: 6})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res), "log kept on site deletion")
+	assert.Equal(t, ChangeDelete, res[0].Event)
+	assert.Equal(t, uint64(7), res[0].Seq)
+
+	_, err = b.Changes(ChangesRequest{Locator: store.Locator{SiteID: "bad"}})
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestBoltDB_ChangesRetention(t *testing.T) {
+	var b, teardown = prep(t) // two comments created
+	defer teardown()
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	verify := func() {
+		_, err := b.Flag(FlagRequest{Locator: loc, Flag: Verified, UserID: "user1", Update: FlagTrue})
+		require.NoError(t, err)
+	}
+
+	b.ChangesRetention = ChangesRetention{MaxCount: 3}
+	verify()
+	verify()
+	res, err := b.Changes(ChangesRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res), "last 3 entries kept")
+	assert.Equal(t, uint64(2), res[0].Seq)
+	assert.Equal(t, uint64(4), res[2].Seq)
+
+	b.ChangesRetention = ChangesRetention{MaxAge: 50 * time.Millisecond}
+	time.Sleep(100 * time.Millisecond)
+	verify()
+	res, err = b.Changes(ChangesRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res), "old entries dropped")
+	assert.Equal(t, uint64(5), res[0].Seq)
+}
+
+func TestBoltDB_Subscription(t *testing.T) {
+	var b, teardown = prep(t)
+	defer teardown()
+
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	subscribe := func(loc store.Locator, userID, commentID string) {
+		res, err := b.Subscription(SubscriptionRequest{Locator: loc, Update: &store.Subscription{Locator: loc, UserID: userID,
+			CommentID: commentID, Timestamp: ts}})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(res))
+		assert.Equal(t, userID, res[0].UserID)
+	}
+	subscribe(loc, "user1", "")
+	subscribe(loc, "user1", "")
+	subscribe(loc, "user1", "id-1")
+	subscribe(loc, "user2", "id-1")
+	subscribe(store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, "user2", "")
+
+	res, err := b.Subscription(SubscriptionRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(res), "all subscriptions of site, the same subscription replaced")
+
+	res, err = b.Subscription(SubscriptionRequest{Locator: loc})
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(res), "subscriptions of post")
+
+	res, err = b.Subscription(SubscriptionRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2"})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res), "subscriptions of user")
+
+	res, err = b.Subscription(SubscriptionRequest{Locator: loc, UserID: "user2"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res), "subscriptions of user to post")
+	assert.Equal(t, store.Subscription{Locator: loc, UserID: "user2", CommentID: "id-1", Timestamp: ts}, res[0])
+
+	// unsubscribe from thread
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, UserID: "user1", CommentID: "id-1", Subscription: true}))
+	res, err = b.Subscription(SubscriptionRequest{Locator: loc, UserID: "user1"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "", res[0].CommentID, "post subscription kept")
+
+	// unsubscribe from everything
+	require.NoError(t, b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2", Subscription: true}))
+	res, err = b.Subscription(SubscriptionRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+
+	// subscriptions removed with all user details
+	require.NoError(t, b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", UserDetail: AllUserDetails}))
+	res, err = b.Subscription(SubscriptionRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+
+	_, err = b.Subscription(SubscriptionRequest{Locator: loc, Update: &store.Subscription{Locator: loc}})
+	assert.EqualError(t, err, "user id and url required for subscription")
+	_, err = b.Subscription(SubscriptionRequest{Locator: store.Locator{SiteID: "bad"}})
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
 func TestBoltDB_CountUser(t *testing.T) {
 	var b, teardown = prep(t)
 	defer teardown()
@@ -574,6 +851,47 @@ func TestBolt_FlagListVerified(t *testing.T) {
 	assert.Error(t, err, "site \"radio-t-bad\" not found", "fail on wrong site")
 }
 
+func TestBolt_FlagShadowBlocked(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+
+	loc := store.Locator{SiteID: "radio-t"}
+	_, err := b.Flag(FlagRequest{Flag: ShadowBlocked, Locator: loc, UserID: "user1", Update: FlagTrue})
+	require.NoError(t, err)
+	_, err = b.Flag(FlagRequest{Flag: ShadowBlocked, Locator: loc, UserID: "user2", Update: FlagTrue, TTL: 150 * time.Millisecond})
+	require.NoError(t, err)
+
+	val, err := b.Flag(FlagRequest{Flag: ShadowBlocked, Locator: loc, UserID: "user1"})
+	require.NoError(t, err)
+	assert.True(t, val, "user1 shadow blocked")
+	val, err = b.Flag(FlagRequest{Flag: Blocked, Locator: loc, UserID: "user1"})
+	require.NoError(t, err)
+	assert.False(t, val, "user1 not blocked")
+
+	vv, err := b.ListFlags(FlagRequest{Flag: ShadowBlocked, Locator: loc})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(vv))
+	assert.Equal(t, "user1", vv[0].(store.BlockedUser).ID)
+	assert.Equal(t, "user2", vv[1].(store.BlockedUser).ID)
+	vv, err = b.ListFlags(FlagRequest{Flag: Blocked, Locator: loc})
+	require.NoError(t, err)
+	assert.Empty(t, vv)
+
+	time.Sleep(150 * time.Millisecond)
+	val, err = b.Flag(FlagRequest{Flag: ShadowBlocked, Locator: loc, UserID: "user2"})
+	require.NoError(t, err)
+	assert.False(t, val, "user2 block expired")
+	vv, err = b.ListFlags(FlagRequest{Flag: ShadowBlocked, Locator: loc})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(vv))
+
+	_, err = b.Flag(FlagRequest{Flag: ShadowBlocked, Locator: loc, UserID: "user1", Update: FlagFalse})
+	require.NoError(t, err)
+	val, err = b.Flag(FlagRequest{Flag: ShadowBlocked, Locator: loc, UserID: "user1"})
+	require.NoError(t, err)
+	assert.False(t, val, "user1 unblocked")
+}
+
 func TestBolt_FlagListBlocked(t *testing.T) {
 
 	b, teardown := prep(t)
@@ -667,6 +985,75 @@ func TestBoltDB_UserDetail(t *testing.T) {
 	}
 }
 
+func TestBoltDB_UserDigest(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+
+	loc := store.Locator{SiteID: "radio-t"}
+	_, err := b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserEmail, Update: "test@example.com"})
+	require.NoError(t, err)
+	result, err := b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserDigest, Update: "daily"})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Email: "test@example.com", Digest: "daily"}}, result)
+
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserDigest})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Digest: "daily"}}, result)
+
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, UserID: "u1", UserDetail: UserDigest}))
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, Detail: AllUserDetails})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Email: "test@example.com"}}, result, "email kept")
+}
+
+func TestBoltDB_UserProfileDetails(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+
+	loc := store.Locator{SiteID: "radio-t"}
+	_, err := b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserBio, Update: "some bio"})
+	require.NoError(t, err)
+	result, err := b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserWebsite, Update: "https://example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Bio: "some bio", Website: "https://example.com"}}, result)
+
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserBio})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Bio: "some bio"}}, result)
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserWebsite})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Website: "https://example.com"}}, result)
+
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, UserID: "u1", UserDetail: UserBio}))
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, Detail: AllUserDetails})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Website: "https://example.com"}}, result, "website kept")
+
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, UserID: "u1", UserDetail: UserWebsite}))
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, Detail: AllUserDetails})
+	require.NoError(t, err)
+	assert.Empty(t, result)
+}
+
+func TestBoltDB_UserMuted(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+
+	loc := store.Locator{SiteID: "radio-t"}
+	result, err := b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserMuted, Update: "u2,u3"})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Muted: "u2,u3"}}, result)
+
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserMuted})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Muted: "u2,u3"}}, result)
+
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, UserID: "u1", UserDetail: UserMuted}))
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, Detail: AllUserDetails})
+	require.NoError(t, err)
+	assert.Empty(t, result)
+}
+
 func TestBolt_DeleteComment(t *testing.T) {
 
 	b, teardown := prep(t)
@@ -742,6 +1129,31 @@ func TestBolt_DeleteHard(t *testing.T) {
 	assert.Equal(t, store.User{Name: "deleted", ID: "deleted", Picture: "", Admin: false, Blocked: false, IP: ""}, res[0].User)
 }
 
+func TestBolt_DeleteHardAfterSoft(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	res, err := b.Find(FindRequest{Locator: locator, Sort: "time"})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res), "initially 2 comments")
+
+	delReq := DeleteRequest{Locator: locator, CommentID: res[0].ID, DeleteMode: store.SoftDelete}
+	require.NoError(t, b.Delete(delReq))
+	count, err := b.Count(FindRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	delReq.DeleteMode = store.HardDelete
+	require.NoError(t, b.Delete(delReq))
+	count, err = b.Count(FindRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "not counted twice")
+	comment, err := b.Get(getReq(locator, res[0].ID))
+	require.NoError(t, err)
+	assert.Equal(t, store.User{Name: "deleted", ID: "deleted"}, comment.User)
+}
+
 func TestBolt_DeleteAll(t *testing.T) {
 
 	b, teardown := prep(t)
@@ -886,6 +1298,44 @@ func TestBoltDB_ref(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestBoltDB_AddRemoveSite(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+	var _ SiteManager = b
+	siteFile := os.TempDir() + "/site2.db"
+	defer os.Remove(siteFile)
+	_ = os.Remove(siteFile)
+
+	assert.EqualError(t, b.AddSite("site2"), "can't add site site2, sites path not set")
+	b.SitesPath = os.TempDir()
+	require.NoError(t, b.AddSite("site2"))
+	assert.EqualError(t, b.AddSite("site2"), "site site2 already opened")
+	locator := store.Locator{URL: "https://example.com", SiteID: "site2"}
+	_, err := b.Create(store.Comment{ID: "c1", Text: "text", Timestamp: time.Now(), Locator: locator, User: store.User{ID: "user1"}})
+	require.NoError(t, err)
+	version, err := b.SchemaVersion("site2")
+	require.NoError(t, err)
+	assert.Equal(t, len(boltMigrations), version)
+
+	// removed site file kept
+	require.NoError(t, b.RemoveSite("site2", false))
+	_, err = b.Get(getReq(locator, "c1"))
+	assert.EqualError(t, err, `site "site2" not found`)
+	require.NoError(t, b.AddSite("site2"))
+	_, err = b.Get(getReq(locator, "c1"))
+	require.NoError(t, err)
+
+	// dropped site file removed
+	require.NoError(t, b.RemoveSite("site2", true))
+	_, err = os.Stat(siteFile)
+	assert.True(t, os.IsNotExist(err))
+	assert.EqualError(t, b.RemoveSite("site2", true), `site "site2" not found`)
+
+	count, err := b.Count(FindRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "other site not affected")
+}
+
 func TestBoltDB_NewFailed(t *testing.T) {
 	_, err := NewBoltDB(bolt.Options{}, BoltSite{FileName: "/tmp/no-such-place/tmp.db", SiteID: "radio-t"})
 	assert.EqualError(t, err, "failed to make boltdb for /tmp/no-such-place/tmp.db: open /tmp/no-such-place/tmp.db: no such file or directory")
@@ -16,15 +16,18 @@ import (
 
 // Interface defines methods provided by low-level storage engine
 type Interface interface {
-	Create(comment store.Comment) (commentID string, err error) // create new comment, avoid dups by id
-	Update(comment store.Comment) error                         // update comment, mutable parts only
-	Get(req GetRequest) (store.Comment, error)                  // get comment by id
-	Find(req FindRequest) ([]store.Comment, error)              // find comments for locator or site
-	Info(req InfoRequest) ([]store.PostInfo, error)             // get post(s) meta info
-	Count(req FindRequest) (int, error)                         // get count for post or user
-	Delete(req DeleteRequest) error                             // Delete post(s), user, comment, user details, or everything
-	Flag(req FlagRequest) (bool, error)                         // set and get flags
-	ListFlags(req FlagRequest) ([]interface{}, error)           // get list of flagged keys, like blocked & verified user
+	Create(comment store.Comment) (commentID string, err error)         // create new comment, avoid dups by id
+	Update(comment store.Comment) error                                 // update comment, mutable parts only, user's ip can be cleared
+	Get(req GetRequest) (store.Comment, error)                          // get comment by id
+	Find(req FindRequest) ([]store.Comment, error)                      // find comments for locator or site
+	Info(req InfoRequest) ([]store.PostInfo, error)                     // get post(s) meta info
+	Count(req FindRequest) (int, error)                                 // get count for post or user
+	Delete(req DeleteRequest) error                                     // Delete post(s), user, comment, user details, or everything
+	Flag(req FlagRequest) (bool, error)                                 // set and get flags
+	ListFlags(req FlagRequest) ([]interface{}, error)                   // get list of flagged keys, like blocked & verified user
+	Report(req ReportRequest) ([]store.Report, error)                   // add report, get reports of comment or all reports of site
+	Subscription(req SubscriptionRequest) ([]store.Subscription, error) // add subscription, get subscriptions of post or user
+	Changes(req ChangesRequest) ([]Change, error)                       // get entries of site's change log after sequence number
 
 	// UserDetail sets or gets single detail value, or gets all details for requested site
 	// Returns list even for single entry request is a compromise in order to have both single detail getting and setting
@@ -34,6 +37,12 @@ type Interface interface {
 	Close() error // close storage engine
 }
 
+// SiteManager is implemented by engines able to add and remove sites at runtime
+type SiteManager interface {
+	AddSite(siteID string) error               // open store of the site, empty one made if not exists
+	RemoveSite(siteID string, drop bool) error // close store of the site, all data of the site removed if drop set
+}
+
 // GetRequest is the input for Get func
 type GetRequest struct {
 	Locator   store.Locator `json:"locator"`
@@ -44,6 +53,7 @@ type GetRequest struct {
 type FindRequest struct {
 	Locator store.Locator `json:"locator"`           // lack of URL means site operation
 	UserID  string        `json:"user_id,omitempty"` // presence of UserID treated as user-related find
+	Pending bool          `json:"pending,omitempty"` // find pending (not approved) comments for site
 	Sort    string        `json:"sort,omitempty"`    // sort order with +/-field syntax
 	Since   time.Time     `json:"since,omitempty"`   // time limit for found results
 	Limit   int           `json:"limit,omitempty"`
@@ -60,11 +70,13 @@ type InfoRequest struct {
 
 // DeleteRequest is the input for all delete operations (comments, sites, users)
 type DeleteRequest struct {
-	Locator    store.Locator    `json:"locator"` // lack of URL means site operation
-	CommentID  string           `json:"comment_id,omitempty"`
-	UserID     string           `json:"user_id,omitempty"`
-	UserDetail UserDetail       `json:"user_detail,omitempty"`
-	DeleteMode store.DeleteMode `json:"del_mode"`
+	Locator      store.Locator    `json:"locator"` // lack of URL means site operation
+	CommentID    string           `json:"comment_id,omitempty"`
+	UserID       string           `json:"user_id,omitempty"`
+	UserDetail   UserDetail       `json:"user_detail,omitempty"`
+	Reports      bool             `json:"reports,omitempty"`      // delete reports of the comment, not the comment itself
+	Subscription bool             `json:"subscription,omitempty"` // delete user's subscription to post or thread, all if no URL
+	DeleteMode   store.DeleteMode `json:"del_mode"`
 }
 
 // Flag defines type of binary attribute
@@ -82,15 +94,24 @@ const (
 
 // Enum of all flags
 const (
-	ReadOnly = Flag("readonly")
-	Verified = Flag("verified")
-	Blocked  = Flag("blocked")
+	ReadOnly      = Flag("readonly")
+	Verified      = Flag("verified")
+	Blocked       = Flag("blocked")
+	ShadowBlocked = Flag("shadow_blocked") // comments of the user visible to the user and admins only
 )
 
 // All possible user details
 const (
 	// UserEmail is a user email
 	UserEmail = UserDetail("email")
+	// UserDigest is a delivery mode of user's email notifications, immediate if not set
+	UserDigest = UserDetail("digest")
+	// UserBio is a short bio of user, shown in user's profile
+	UserBio = UserDetail("bio")
+	// UserWebsite is a link to user's website, shown in user's profile
+	UserWebsite = UserDetail("website")
+	// UserMuted is a comma separated list of users muted by user, comments of them hidden from the user
+	UserMuted = UserDetail("muted")
 	// AllUserDetails used for listing and deletion requests
 	AllUserDetails = UserDetail("all")
 )
@@ -104,13 +125,68 @@ type FlagRequest struct {
 	TTL     time.Duration `json:"ttl,omitempty"`     // ttl for time-sensitive flags only, like blocked for some period
 }
 
+// ReportRequest is the input for both adding and getting reports. Reports of comment removed with the comment
+type ReportRequest struct {
+	Locator   store.Locator `json:"locator"`              // site of reported comments
+	CommentID string        `json:"comment_id,omitempty"` // get reports of the comment, all reports of site if empty
+	Update    *store.Report `json:"update,omitempty"`     // add report, replaces previous report of the same user
+}
+
+// SubscriptionRequest is the input for both adding and getting subscriptions
+type SubscriptionRequest struct {
+	Locator store.Locator       `json:"locator"`           // site, all subscriptions of site if URL is empty
+	UserID  string              `json:"user_id,omitempty"` // get subscriptions of the user only
+	Update  *store.Subscription `json:"update,omitempty"`  // add subscription, replaces the same one
+}
+
+// ChangesRequest is the input to get entries of site's change log, ordered by sequence number
+type ChangesRequest struct {
+	Locator store.Locator `json:"locator"`         // site of changes
+	Since   uint64        `json:"since,omitempty"` // get entries with sequence number greater than since
+	Limit   int           `json:"limit,omitempty"` // max number of entries, changesLimit if not set
+	Last    bool          `json:"last,omitempty"`  // get the last entry only, head of the log, Since and Limit ignored
+}
+
+// ChangeEvent defines type of change log entry
+type ChangeEvent string
+
+// enum of all change events
+const (
+	ChangeCreate     ChangeEvent = "create"      // comment created
+	ChangeUpdate     ChangeEvent = "update"      // comment updated
+	ChangeDelete     ChangeEvent = "delete"      // comment(s), user, user details or site deleted
+	ChangeFlag       ChangeEvent = "flag"        // flag set or reset
+	ChangeUserDetail ChangeEvent = "user_detail" // user detail set
+)
+
+// Change is an entry of site's change log. Sequence number is unique and increasing within the site,
+// payload depends on the event: comment for create and update, request for delete, flag and user detail
+type Change struct {
+	Seq        uint64             `json:"seq"`
+	Timestamp  time.Time          `json:"time"`
+	Event      ChangeEvent        `json:"event"`
+	Comment    *store.Comment     `json:"comment,omitempty"`
+	Delete     *DeleteRequest     `json:"delete,omitempty"`
+	Flag       *FlagRequest       `json:"flag,omitempty"`
+	UserDetail *UserDetailRequest `json:"user_detail,omitempty"`
+}
+
 // UserDetail defines name of the user detail
 type UserDetail string
 
 // UserDetailEntry contains single user details entry
 type UserDetailEntry struct {
-	UserID string `json:"user_id"`         // duplicate user's id to use this structure not only embedded but separately
-	Email  string `json:"email,omitempty"` // UserEmail
+	UserID  string `json:"user_id"`           // duplicate user's id to use this structure not only embedded but separately
+	Email   string `json:"email,omitempty"`   // UserEmail
+	Digest  string `json:"digest,omitempty"`  // UserDigest
+	Bio     string `json:"bio,omitempty"`     // UserBio
+	Website string `json:"website,omitempty"` // UserWebsite
+	Muted   string `json:"muted,omitempty"`   // UserMuted
+}
+
+// Values returns all details of the entry by name, empty ones included. All of them encrypted with encryption enabled
+func (e UserDetailEntry) Values() map[UserDetail]string {
+	return map[UserDetail]string{UserEmail: e.Email, UserDigest: e.Digest, UserBio: e.Bio, UserWebsite: e.Website, UserMuted: e.Muted}
 }
 
 // UserDetailRequest is the input for both get/set for details, like email
@@ -123,10 +199,22 @@ type UserDetailRequest struct {
 
 const (
 	// limits
-	lastLimit = 1000
-	userLimit = 500
+	lastLimit    = 1000
+	userLimit    = 500
+	changesLimit = 1000
 )
 
+// mergeReport adds report to the end of the list, previous report of the same user removed
+func mergeReport(reports []store.Report, report store.Report) []store.Report {
+	res := make([]store.Report, 0, len(reports)+1)
+	for _, r := range reports {
+		if r.UserID != report.UserID {
+			res = append(res, r)
+		}
+	}
+	return append(res, report)
+}
+
 // SortComments is for engines can't sort data internally
 func SortComments(comments []store.Comment, sortFld string) []store.Comment {
 	sort.Slice(comments, func(i, j int) bool {
@@ -12,6 +12,29 @@ type MockInterface struct {
 	mock.Mock
 }
 
+// Changes provides a mock function with given fields: req
+func (_m *MockInterface) Changes(req ChangesRequest) ([]Change, error) {
+	ret := _m.Called(req)
+
+	var r0 []Change
+	if rf, ok := ret.Get(0).(func(ChangesRequest) []Change); ok {
+		r0 = rf(req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]Change)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(ChangesRequest) error); ok {
+		r1 = rf(req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Close provides a mock function with given fields:
 func (_m *MockInterface) Close() error {
 	ret := _m.Called()
@@ -193,6 +216,52 @@ func (_m *MockInterface) ListFlags(req FlagRequest) ([]interface{}, error) {
 	return r0, r1
 }
 
+// Report provides a mock function with given fields: req
+func (_m *MockInterface) Report(req ReportRequest) ([]store.Report, error) {
+	ret := _m.Called(req)
+
+	var r0 []store.Report
+	if rf, ok := ret.Get(0).(func(ReportRequest) []store.Report); ok {
+		r0 = rf(req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]store.Report)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(ReportRequest) error); ok {
+		r1 = rf(req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Subscription provides a mock function with given fields: req
+func (_m *MockInterface) Subscription(req SubscriptionRequest) ([]store.Subscription, error) {
+	ret := _m.Called(req)
+
+	var r0 []store.Subscription
+	if rf, ok := ret.Get(0).(func(SubscriptionRequest) []store.Subscription); ok {
+		r0 = rf(req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]store.Subscription)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(SubscriptionRequest) error); ok {
+		r1 = rf(req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Update provides a mock function with given fields: comment
 func (_m *MockInterface) Update(comment store.Comment) error {
 	ret := _m.Called(comment)
@@ -53,3 +53,9 @@ func TestEngine_sortComments(t *testing.T) {
 	assert.Equal(t, "1", cc[2].ID)
 	assert.Equal(t, "4", cc[3].ID)
 }
+
+func TestUserDetailEntry_Values(t *testing.T) {
+	e := UserDetailEntry{UserID: "u1", Email: "email", Digest: "digest", Bio: "bio", Website: "website", Muted: "muted"}
+	assert.Equal(t, map[UserDetail]string{UserEmail: "email", UserDigest: "digest", UserBio: "bio", UserWebsite: "website",
+		UserMuted: "muted"}, e.Values())
+}
@@ -94,6 +94,36 @@ func (r *RPC) UserDetail(req UserDetailRequest) (result []UserDetailEntry, err e
 	return result, err
 }
 
+// Report adds report or gets reports of comment or site
+func (r *RPC) Report(req ReportRequest) (result []store.Report, err error) {
+	resp, err := r.Call("store.report", req)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(*resp.Result, &result)
+	return result, err
+}
+
+// Subscription adds subscription or gets subscriptions of post, user or site
+func (r *RPC) Subscription(req SubscriptionRequest) (result []store.Subscription, err error) {
+	resp, err := r.Call("store.subscription", req)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(*resp.Result, &result)
+	return result, err
+}
+
+// Changes gets entries of site's change log after sequence number
+func (r *RPC) Changes(req ChangesRequest) (result []Change, err error) {
+	resp, err := r.Call("store.changes", req)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(*resp.Result, &result)
+	return result, err
+}
+
 // Count gets comments count by user or site
 func (r *RPC) Count(req FindRequest) (count int, err error) {
 	resp, err := r.Call("store.count", req)
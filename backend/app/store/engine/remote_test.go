@@ -160,6 +160,39 @@ func TestRemote_UserDetailWithErrorResult(t *testing.T) {
 	assert.EqualError(t, err, "failed")
 }
 
+func TestRemote_Report(t *testing.T) {
+	ts := testServer(t, `{"method":"store.report","params":{"locator":{"site":"site","url":""},"comment_id":"c1"},"id":1}`, `{"result":[{"locator":{"site":"site","url":"http://example.com/url"},"comment_id":"c1","user_id":"u1","reason":"spam","time":"2020-05-01T10:00:00Z"}]}`)
+	defer ts.Close()
+	c := RPC{Client: jrpc.Client{API: ts.URL, Client: http.Client{}}}
+
+	res, err := c.Report(ReportRequest{Locator: store.Locator{SiteID: "site"}, CommentID: "c1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []store.Report{{Locator: store.Locator{SiteID: "site", URL: "http://example.com/url"}, CommentID: "c1",
+		UserID: "u1", Reason: store.ReportSpam, Timestamp: time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)}}, res)
+}
+
+func TestRemote_Subscription(t *testing.T) {
+	ts := testServer(t, `{"method":"store.subscription","params":{"locator":{"site":"site","url":""},"user_id":"u1"},"id":1}`, `{"result":[{"locator":{"site":"site","url":"http://example.com/url"},"user_id":"u1","comment_id":"c1","time":"2020-05-01T10:00:00Z"}]}`)
+	defer ts.Close()
+	c := RPC{Client: jrpc.Client{API: ts.URL, Client: http.Client{}}}
+
+	res, err := c.Subscription(SubscriptionRequest{Locator: store.Locator{SiteID: "site"}, UserID: "u1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []store.Subscription{{Locator: store.Locator{SiteID: "site", URL: "http://example.com/url"}, UserID: "u1",
+		CommentID: "c1", Timestamp: time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)}}, res)
+}
+
+func TestRemote_Changes(t *testing.T) {
+	ts := testServer(t, `{"method":"store.changes","params":{"locator":{"site":"site","url":""},"since":10,"limit":2},"id":1}`, `{"result":[{"seq":11,"time":"2020-05-01T10:00:00Z","event":"delete","delete":{"locator":{"site":"site","url":""},"user_id":"u1","del_mode":1}}]}`)
+	defer ts.Close()
+	c := RPC{Client: jrpc.Client{API: ts.URL, Client: http.Client{}}}
+
+	res, err := c.Changes(ChangesRequest{Locator: store.Locator{SiteID: "site"}, Since: 10, Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{{Seq: 11, Timestamp: time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC), Event: ChangeDelete,
+		Delete: &DeleteRequest{Locator: store.Locator{SiteID: "site"}, UserID: "u1", DeleteMode: store.HardDelete}}}, res)
+}
+
 func TestRemote_Count(t *testing.T) {
 	ts := testServer(t, `{"method":"store.count","params":{"locator":{"url":"http://example.com/url"},"since":"0001-01-01T00:00:00Z"},"id":1}`, `{"result":11}`)
 	defer ts.Close()
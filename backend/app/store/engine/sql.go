@@ -0,0 +1,1080 @@
+package engine
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	_ "github.com/lib/pq"           // postgres driver
+	_ "github.com/mattn/go-sqlite3" // sqlite driver
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// SQLDB implements store.Interface on top of sql database, sqlite3 and postgres supported. Thread safe.
+// All sites share the same database, each table has site column. There are 5 tables:
+//  - comments keeps comment's json along with the fields used for lookups and ordering, i.e. url, user_id, ts, deleted and pending.
+//    Post info (count, first and last timestamps) calculated from this table on request
+//  - flags keeps flags (blocked, readonly, verified) with key set to userID or post url. For blocked users ts is the "until" time
+//  - user_details keeps UserDetailEntry json per user
+//  - reports keeps report json per comment and user
+//  - subscriptions keeps email subscription json per user and subscribed post or thread
+type SQLDB struct {
+	db     *sql.DB
+	driver string
+	sites  map[string]bool
+	lock   sync.RWMutex // protects sites, sites can be added and removed at runtime
+}
+
+// SQLParams defines connection params for sql store
+type SQLParams struct {
+	Driver string // sqlite3 or postgres
+	DSN    string // data source name, i.e. file name for sqlite3 or connection string for postgres
+}
+
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS comments (
+		site TEXT NOT NULL,
+		url TEXT NOT NULL,
+		id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		ts BIGINT NOT NULL,
+		deleted INTEGER NOT NULL DEFAULT 0,
+		pending INTEGER NOT NULL DEFAULT 0,
+		data TEXT NOT NULL,
+		PRIMARY KEY (site, url, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS comments_site_ts ON comments (site, ts)`,
+	`CREATE INDEX IF NOT EXISTS comments_site_user ON comments (site, user_id, ts)`,
+	`CREATE TABLE IF NOT EXISTS flags (
+		site TEXT NOT NULL,
+		flag TEXT NOT NULL,
+		key TEXT NOT NULL,
+		ts BIGINT NOT NULL,
+		PRIMARY KEY (site, flag, key)
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_details (
+		site TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (site, user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS reports (
+		site TEXT NOT NULL,
+		comment_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		ts BIGINT NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (site, comment_id, user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS subscriptions (
+		site TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		id TEXT NOT NULL,
+		url TEXT NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (site, user_id, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS subscriptions_site_url ON subscriptions (site, url)`,
+}
+
+// NewSQLDB makes persistent sql-based store. All sites kept in the same database
+func NewSQLDB(params SQLParams, sites ...string) (*SQLDB, error) {
+	log.Printf("[INFO] sql store for sites %+v, driver %s", sites, params.Driver)
+	if params.Driver != "sqlite3" && params.Driver != "postgres" {
+		return nil, errors.Errorf("unsupported sql driver %q", params.Driver)
+	}
+
+	db, err := sql.Open(params.Driver, params.DSN)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s db", params.Driver)
+	}
+	if params.Driver == "sqlite3" {
+		db.SetMaxOpenConns(1) // sqlite doesn't support concurrent writes
+	}
+	if err = db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, errors.Wrapf(err, "failed to connect to %s db", params.Driver)
+	}
+
+	for _, q := range sqlSchema {
+		if _, err = db.Exec(q); err != nil {
+			_ = db.Close()
+			return nil, errors.Wrap(err, "failed to create schema")
+		}
+	}
+
+	result := SQLDB{db: db, driver: params.Driver, sites: make(map[string]bool)}
+	for _, site := range sites {
+		result.sites[site] = true
+		log.Printf("[DEBUG] sql store created for %s", site)
+	}
+	return &result, nil
+}
+
+// AddSite allows site, all sites share the same database
+func (s *SQLDB) AddSite(siteID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.sites[siteID] {
+		return errors.Errorf("site %s already opened", siteID)
+	}
+	s.sites[siteID] = true
+	log.Printf("[INFO] sql store added for %s", siteID)
+	return nil
+}
+
+// RemoveSite disallows site, and deletes all its data including flags if drop set
+func (s *SQLDB) RemoveSite(siteID string, drop bool) error {
+	if err := s.checkSite(siteID); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	delete(s.sites, siteID)
+	s.lock.Unlock()
+	log.Printf("[INFO] sql store removed for %s, drop %v", siteID, drop)
+	if !drop {
+		return nil
+	}
+	if err := s.deleteAll(siteID); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(s.q(`DELETE FROM flags WHERE site=?`), siteID)
+	return errors.Wrapf(err, "failed to delete flags of site %s", siteID)
+}
+
+// Create saves new comment to store
+func (s *SQLDB) Create(comment store.Comment) (commentID string, err error) {
+	if err = s.checkSite(comment.Locator.SiteID); err != nil {
+		return "", err
+	}
+
+	if s.checkFlag(FlagRequest{Locator: comment.Locator, Flag: ReadOnly}) {
+		return "", errors.Errorf("post %s is read-only", comment.Locator.URL)
+	}
+
+	err = s.tx(func(tx *sql.Tx) error {
+		var exists bool
+		if exists, err = s.exists(tx, `SELECT 1 FROM comments WHERE site=? AND url=? AND id=?`,
+			comment.Locator.SiteID, comment.Locator.URL, comment.ID); err != nil {
+			return err
+		}
+		if exists {
+			return errors.Errorf("key %s already in store", comment.ID)
+		}
+
+		data, e := json.Marshal(comment)
+		if e != nil {
+			return errors.Wrap(e, "can't marshal comment")
+		}
+		_, e = tx.Exec(s.q(`INSERT INTO comments (site, url, id, user_id, ts, deleted, pending, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+			comment.Locator.SiteID, comment.Locator.URL, comment.ID, comment.User.ID, comment.Timestamp.UnixNano(),
+			boolToInt(comment.Deleted), boolToInt(comment.Pending), string(data))
+		return errors.Wrapf(e, "failed to put key %s to post %s", comment.ID, comment.Locator.URL)
+	})
+
+	return comment.ID, err
+}
+
+// Get returns comment for locator.URL and commentID string
+func (s *SQLDB) Get(req GetRequest) (comment store.Comment, err error) {
+	if err = s.checkSite(req.Locator.SiteID); err != nil {
+		return comment, err
+	}
+
+	err = s.tx(func(tx *sql.Tx) error {
+		comment, err = s.load(tx, req.Locator, req.CommentID)
+		return err
+	})
+	return comment, err
+}
+
+// Find returns all comments for given request and sorts results
+func (s *SQLDB) Find(req FindRequest) (comments []store.Comment, err error) {
+	if err = s.checkSite(req.Locator.SiteID); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case req.Locator.SiteID != "" && req.Locator.URL != "": // find post comments, i.e. for site and url
+		comments, err = s.postComments(req.Locator, req.Since)
+	case req.Locator.SiteID != "" && req.Pending: // find pending comments for site
+		comments, err = s.pendingComments(req.Locator.SiteID, req.Limit, req.Skip)
+	case req.Locator.SiteID != "" && req.Locator.URL == "" && req.UserID == "": // find last comments for site
+		comments, err = s.lastComments(req.Locator.SiteID, req.Limit, req.Since)
+	case req.Locator.SiteID != "" && req.UserID != "": // find comments for user
+		comments, err = s.userComments(req.Locator.SiteID, req.UserID, req.Limit, req.Skip)
+	default:
+		comments = []store.Comment{}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return SortComments(comments, req.Sort), nil
+}
+
+// Flag sets and gets flag values
+func (s *SQLDB) Flag(req FlagRequest) (val bool, err error) {
+	if req.Update == FlagNonSet { // read flag value, no update requested
+		return s.checkFlag(req), nil
+	}
+
+	// write flag value
+	return s.setFlag(req)
+}
+
+// UserDetail sets or gets single detail value, or gets all details for requested site.
+// Behaves the same way as BoltDB.UserDetail
+func (s *SQLDB) UserDetail(req UserDetailRequest) ([]UserDetailEntry, error) {
+	switch req.Detail {
+	case UserEmail, UserDigest, UserBio, UserWebsite, UserMuted:
+		if req.UserID == "" {
+			return nil, errors.New("userid cannot be empty in request for single detail")
+		}
+
+		if req.Update == "" { // read detail value, no update requested
+			return s.getUserDetail(req)
+		}
+
+		return s.setUserDetail(req)
+	case AllUserDetails:
+		// list of all details returned in case request is a read request
+		// (Update is not set) and does not have UserID
+		if req.Update == "" && req.UserID == "" { // read list of all details
+			return s.listDetails(req.Locator)
+		}
+		return nil, errors.New("unsupported request with userdetail all")
+	default:
+		return nil, errors.Errorf("unsupported detail %q", req.Detail)
+	}
+}
+
+// Report adds report to comment and returns all reports of this comment, gets reports of comment
+// or all reports of site if CommentID not set. Behaves the same way as BoltDB.Report
+func (s *SQLDB) Report(req ReportRequest) ([]store.Report, error) {
+	if err := s.checkSite(req.Locator.SiteID); err != nil {
+		return nil, err
+	}
+
+	if req.Update != nil {
+		if req.Update.CommentID == "" || req.Update.UserID == "" {
+			return nil, errors.New("comment id and user id required for report")
+		}
+		data, err := json.Marshal(req.Update)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't marshal report")
+		}
+		_, err = s.db.Exec(s.q(`INSERT INTO reports (site, comment_id, user_id, ts, data) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (site, comment_id, user_id) DO UPDATE SET ts=excluded.ts, data=excluded.data`),
+			req.Locator.SiteID, req.Update.CommentID, req.Update.UserID, req.Update.Timestamp.UnixNano(), string(data))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to add report for %s", req.Update.CommentID)
+		}
+		return s.reports(`SELECT data FROM reports WHERE site=? AND comment_id=? ORDER BY ts`, req.Locator.SiteID, req.Update.CommentID)
+	}
+
+	if req.CommentID != "" {
+		return s.reports(`SELECT data FROM reports WHERE site=? AND comment_id=? ORDER BY ts`, req.Locator.SiteID, req.CommentID)
+	}
+	return s.reports(`SELECT data FROM reports WHERE site=? ORDER BY comment_id, ts`, req.Locator.SiteID)
+}
+
+// Changes is not supported, sql engine doesn't keep change log
+func (s *SQLDB) Changes(req ChangesRequest) ([]Change, error) {
+	return nil, errors.Errorf("change log not supported by sql engine, site %s", req.Locator.SiteID)
+}
+
+// Subscription adds subscription and returns it, gets subscriptions of post if URL set, of user if UserID set
+// or all subscriptions of site. Behaves the same way as BoltDB.Subscription
+func (s *SQLDB) Subscription(req SubscriptionRequest) ([]store.Subscription, error) {
+	if err := s.checkSite(req.Locator.SiteID); err != nil {
+		return nil, err
+	}
+
+	if req.Update != nil {
+		sub := *req.Update
+		if sub.UserID == "" || sub.Locator.URL == "" {
+			return nil, errors.New("user id and url required for subscription")
+		}
+		data, err := json.Marshal(sub)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't marshal subscription")
+		}
+		_, err = s.db.Exec(s.q(`INSERT INTO subscriptions (site, user_id, id, url, data) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (site, user_id, id) DO UPDATE SET data=excluded.data`),
+			req.Locator.SiteID, sub.UserID, sub.ID(), sub.Locator.URL, string(data))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to add subscription of %s", sub.UserID)
+		}
+		return []store.Subscription{sub}, nil
+	}
+
+	query, args := `SELECT data FROM subscriptions WHERE site=?`, []interface{}{req.Locator.SiteID}
+	if req.Locator.URL != "" {
+		query, args = query+` AND url=?`, append(args, req.Locator.URL)
+	}
+	if req.UserID != "" {
+		query, args = query+` AND user_id=?`, append(args, req.UserID)
+	}
+	return s.subscriptions(query+` ORDER BY user_id, id`, args...)
+}
+
+// Update for locator.URL with mutable part of comment
+func (s *SQLDB) Update(comment store.Comment) error {
+	if err := s.checkSite(comment.Locator.SiteID); err != nil {
+		return err
+	}
+
+	return s.tx(func(tx *sql.Tx) error {
+		curComment, err := s.load(tx, comment.Locator, comment.ID)
+		if err != nil {
+			return err
+		}
+		// preserve immutable fields
+		comment.ParentID = curComment.ParentID
+		comment.Locator = curComment.Locator
+		comment.Timestamp = curComment.Timestamp
+		ip := comment.User.IP
+		comment.User = curComment.User
+		if ip == "" { // user's ip can be cleared, i.e. by retention policy
+			comment.User.IP = ""
+		}
+		return s.save(tx, comment)
+	})
+}
+
+// Count returns number of comments for post or user
+func (s *SQLDB) Count(req FindRequest) (count int, err error) {
+	if err = s.checkSite(req.Locator.SiteID); err != nil {
+		return 0, err
+	}
+
+	if req.Locator.URL != "" { // comment's count for post
+		err = s.db.QueryRow(s.q(`SELECT COUNT(*) FROM comments WHERE site=? AND url=? AND deleted=0 AND pending=0`),
+			req.Locator.SiteID, req.Locator.URL).Scan(&count)
+		return count, errors.Wrapf(err, "can't get count for %s", req.Locator.URL)
+	}
+
+	if req.UserID != "" { // comment's count for user
+		err = s.db.QueryRow(s.q(`SELECT COUNT(*) FROM comments WHERE site=? AND user_id=?`),
+			req.Locator.SiteID, req.UserID).Scan(&count)
+		if err != nil {
+			return 0, errors.Wrapf(err, "can't get count for user %s", req.UserID)
+		}
+		if count == 0 {
+			return 0, errors.Errorf("no comments for user %s in store for %s site", req.UserID, req.Locator.SiteID)
+		}
+		return count, nil
+	}
+
+	return 0, errors.Errorf("invalid count request %+v", req)
+}
+
+// Info get post(s) meta info
+func (s *SQLDB) Info(req InfoRequest) ([]store.PostInfo, error) {
+	if err := s.checkSite(req.Locator.SiteID); err != nil {
+		return []store.PostInfo{}, err
+	}
+
+	infoQuery := `SELECT url, SUM(CASE WHEN deleted=0 AND pending=0 THEN 1 ELSE 0 END), MIN(ts), MAX(ts) FROM comments `
+
+	if req.Locator.URL != "" { // post info
+		rows, err := s.db.Query(s.q(infoQuery+`WHERE site=? AND url=? GROUP BY url`), req.Locator.SiteID, req.Locator.URL)
+		if err != nil {
+			return []store.PostInfo{{}}, errors.Wrapf(err, "can't load info for %s", req.Locator.URL)
+		}
+		list, err := s.scanInfo(rows)
+		if err != nil {
+			return []store.PostInfo{{}}, errors.Wrapf(err, "can't load info for %s", req.Locator.URL)
+		}
+		info := store.PostInfo{}
+		if len(list) == 0 {
+			err = errors.Errorf("can't load info for %s: no value for %s", req.Locator.URL, req.Locator.URL)
+		} else {
+			info = list[0]
+		}
+
+		// set read-only from age and manual flag
+		readOnlyAge := req.ReadOnlyAge
+		info.ReadOnly = readOnlyAge > 0 && !info.FirstTS.IsZero() && info.FirstTS.AddDate(0, 0, readOnlyAge).Before(time.Now())
+		if s.checkFlag(FlagRequest{Locator: req.Locator, Flag: ReadOnly}) {
+			info.ReadOnly = true
+		}
+		return []store.PostInfo{info}, err
+	}
+
+	if req.Locator.URL == "" && req.Locator.SiteID != "" { // site info (list)
+		query := infoQuery + `WHERE site=? GROUP BY url ORDER BY url DESC`
+		args := []interface{}{req.Locator.SiteID}
+		switch {
+		case req.Limit > 0:
+			query += ` LIMIT ?`
+			args = append(args, req.Limit)
+		case req.Skip > 0 && s.driver == "sqlite3":
+			query += ` LIMIT -1` // sqlite requires limit for offset
+		}
+		if req.Skip > 0 {
+			query += ` OFFSET ?`
+			args = append(args, req.Skip)
+		}
+		rows, err := s.db.Query(s.q(query), args...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't load info for %s", req.Locator.SiteID)
+		}
+		return s.scanInfo(rows)
+	}
+
+	return nil, errors.Errorf("invalid info request %+v", req)
+}
+
+// ListFlags get list of flagged keys, like blocked & verified user
+// works for full locator (post flags) or with userID
+func (s *SQLDB) ListFlags(req FlagRequest) (res []interface{}, err error) {
+	if err = s.checkSite(req.Locator.SiteID); err != nil {
+		return nil, err
+	}
+
+	res = []interface{}{}
+	switch req.Flag {
+	case Verified:
+		keys, _, e := s.flagKeys(req.Locator.SiteID, Verified)
+		if e != nil {
+			return nil, e
+		}
+		for _, k := range keys {
+			res = append(res, k)
+		}
+		return res, nil
+	case Blocked, ShadowBlocked:
+		keys, ts, e := s.flagKeys(req.Locator.SiteID, req.Flag)
+		if e != nil {
+			return nil, e
+		}
+		for i, userID := range keys {
+			until := time.Unix(0, ts[i])
+			if !time.Now().Before(until) {
+				continue
+			}
+			// get user name from comment user section
+			userName := ""
+			findReq := FindRequest{Locator: store.Locator{SiteID: req.Locator.SiteID}, UserID: userID, Limit: 1}
+			userComments, errUser := s.Find(findReq)
+			if errUser == nil && len(userComments) > 0 {
+				userName = userComments[0].User.Name
+			}
+			res = append(res, store.BlockedUser{ID: userID, Name: userName, Until: until})
+		}
+		return res, nil
+	}
+	return nil, errors.Errorf("flag %s not listable", req.Flag)
+}
+
+// Delete post(s), user, comment, user details, or everything
+func (s *SQLDB) Delete(req DeleteRequest) error {
+	if err := s.checkSite(req.Locator.SiteID); err != nil {
+		return err
+	}
+
+	switch {
+	case req.Reports && req.CommentID != "": // delete reports of comment
+		_, err := s.db.Exec(s.q(`DELETE FROM reports WHERE site=? AND comment_id=?`), req.Locator.SiteID, req.CommentID)
+		return errors.Wrapf(err, "failed to delete reports for %s", req.CommentID)
+	case req.Subscription && req.UserID != "": // delete subscription(s) of user
+		if req.Locator.URL == "" {
+			_, err := s.db.Exec(s.q(`DELETE FROM subscriptions WHERE site=? AND user_id=?`), req.Locator.SiteID, req.UserID)
+			return errors.Wrapf(err, "failed to delete subscriptions of %s", req.UserID)
+		}
+		sub := store.Subscription{Locator: req.Locator, CommentID: req.CommentID}
+		_, err := s.db.Exec(s.q(`DELETE FROM subscriptions WHERE site=? AND user_id=? AND id=?`),
+			req.Locator.SiteID, req.UserID, sub.ID())
+		return errors.Wrapf(err, "failed to delete subscription of %s", req.UserID)
+	case req.UserDetail != "": // delete user detail
+		return s.deleteUserDetail(req.Locator.SiteID, req.UserID, req.UserDetail)
+	case req.Locator.URL != "" && req.CommentID != "" && req.UserDetail == "": // delete comment
+		return s.tx(func(tx *sql.Tx) error {
+			return s.deleteComment(tx, req.Locator, req.CommentID, req.DeleteMode)
+		})
+	case req.Locator.SiteID != "" && req.UserID != "" && req.CommentID == "" && req.UserDetail == "": // delete user
+		return s.deleteUser(req.Locator.SiteID, req.UserID, req.DeleteMode)
+	case req.Locator.SiteID != "" && req.Locator.URL == "" && req.CommentID == "" && req.UserID == "" && req.UserDetail == "": // delete site
+		return s.deleteAll(req.Locator.SiteID)
+	}
+
+	return errors.Errorf("invalid delete request %+v", req)
+}
+
+// Close sql store
+func (s *SQLDB) Close() error {
+	return errors.Wrap(s.db.Close(), "can't close sql store")
+}
+
+// postComments returns all comments for the post, optionally newer than since
+func (s *SQLDB) postComments(locator store.Locator, since time.Time) (comments []store.Comment, err error) {
+	comments = []store.Comment{}
+	err = s.tx(func(tx *sql.Tx) error {
+		if e := s.checkPost(tx, locator); e != nil {
+			return e
+		}
+		query, args := `SELECT data FROM comments WHERE site=? AND url=?`, []interface{}{locator.SiteID, locator.URL}
+		if !since.IsZero() {
+			query += ` AND ts>?`
+			args = append(args, since.UnixNano())
+		}
+		comments, err = s.query(tx, query, args...)
+		return err
+	})
+	return comments, err
+}
+
+// lastComments returns up to max last comments for given siteID, skips deleted comments
+func (s *SQLDB) lastComments(siteID string, max int, since time.Time) (comments []store.Comment, err error) {
+	if max > lastLimit || max == 0 {
+		max = lastLimit
+	}
+
+	err = s.tx(func(tx *sql.Tx) error {
+		query, args := `SELECT data FROM comments WHERE site=? AND deleted=0`, []interface{}{siteID}
+		if !since.IsZero() {
+			query += ` AND ts>?`
+			args = append(args, since.UnixNano())
+		}
+		query += ` ORDER BY ts DESC LIMIT ?`
+		args = append(args, max)
+		comments, err = s.query(tx, query, args...)
+		return err
+	})
+	return comments, err
+}
+
+// pendingComments returns pending comments for given site, skipping deleted
+func (s *SQLDB) pendingComments(siteID string, limit, skip int) (comments []store.Comment, err error) {
+	err = s.tx(func(tx *sql.Tx) error {
+		query, args := `SELECT data FROM comments WHERE site=? AND pending=1 AND deleted=0 ORDER BY ts`, []interface{}{siteID}
+		switch {
+		case limit > 0:
+			query += ` LIMIT ?`
+			args = append(args, limit)
+		case skip > 0 && s.driver == "sqlite3":
+			query += ` LIMIT -1` // sqlite requires limit for offset
+		}
+		if skip > 0 {
+			query += ` OFFSET ?`
+			args = append(args, skip)
+		}
+		comments, err = s.query(tx, query, args...)
+		return err
+	})
+	return comments, err
+}
+
+// userComments extracts all comments for given site and given userID, newest first
+func (s *SQLDB) userComments(siteID, userID string, limit, skip int) (comments []store.Comment, err error) {
+	if limit == 0 || limit > userLimit {
+		limit = userLimit
+	}
+	if skip < 0 {
+		skip = 0
+	}
+
+	err = s.tx(func(tx *sql.Tx) error {
+		exists, e := s.exists(tx, `SELECT 1 FROM comments WHERE site=? AND user_id=?`, siteID, userID)
+		if e != nil {
+			return e
+		}
+		if !exists {
+			return errors.Errorf("no comments for user %s in store", userID)
+		}
+		comments, err = s.query(tx, `SELECT data FROM comments WHERE site=? AND user_id=? ORDER BY ts DESC LIMIT ? OFFSET ?`,
+			siteID, userID, limit, skip)
+		return err
+	})
+	return comments, err
+}
+
+func (s *SQLDB) checkFlag(req FlagRequest) (val bool) {
+	if s.checkSite(req.Locator.SiteID) != nil {
+		return false
+	}
+
+	key := req.Locator.URL
+	if req.UserID != "" {
+		key = req.UserID
+	}
+
+	var ts int64
+	err := s.db.QueryRow(s.q(`SELECT ts FROM flags WHERE site=? AND flag=? AND key=?`),
+		req.Locator.SiteID, string(req.Flag), key).Scan(&ts)
+	if err != nil {
+		return false
+	}
+
+	if req.Flag == Blocked || req.Flag == ShadowBlocked {
+		return time.Now().Before(time.Unix(0, ts))
+	}
+	return true
+}
+
+func (s *SQLDB) setFlag(req FlagRequest) (res bool, err error) {
+	if err = s.checkSite(req.Locator.SiteID); err != nil {
+		return false, err
+	}
+
+	switch req.Flag {
+	case ReadOnly, Blocked, ShadowBlocked, Verified:
+	default:
+		return false, errors.Errorf("unsupported flag %v", req.Flag)
+	}
+
+	key := req.Locator.URL
+	if req.UserID != "" {
+		key = req.UserID
+	}
+
+	switch req.Update {
+	case FlagTrue:
+		ts := time.Now()
+		if req.Flag == Blocked || req.Flag == ShadowBlocked {
+			ts = time.Now().AddDate(100, 0, 0) // permanent is 100 year
+			if req.TTL > 0 {
+				ts = time.Now().Add(req.TTL)
+			}
+		}
+		_, err = s.db.Exec(s.q(`INSERT INTO flags (site, flag, key, ts) VALUES (?, ?, ?, ?)
+			ON CONFLICT (site, flag, key) DO UPDATE SET ts=excluded.ts`),
+			req.Locator.SiteID, string(req.Flag), key, ts.UnixNano())
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to set flag %s for %s", req.Flag, key)
+		}
+		return true, nil
+	case FlagFalse:
+		_, err = s.db.Exec(s.q(`DELETE FROM flags WHERE site=? AND flag=? AND key=?`), req.Locator.SiteID, string(req.Flag), key)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to clean flag %s for %s", req.Flag, key)
+		}
+	}
+	return false, nil
+}
+
+// flagKeys returns all keys with ts for given flag, sorted by key
+func (s *SQLDB) flagKeys(siteID string, flag Flag) (keys []string, ts []int64, err error) {
+	rows, err := s.db.Query(s.q(`SELECT key, ts FROM flags WHERE site=? AND flag=? ORDER BY key`), siteID, string(flag))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "can't list flag %s", flag)
+	}
+	defer rows.Close() // nolint
+
+	for rows.Next() {
+		var k string
+		var t int64
+		if err = rows.Scan(&k, &t); err != nil {
+			return nil, nil, errors.Wrapf(err, "can't scan flag %s", flag)
+		}
+		keys = append(keys, k)
+		ts = append(ts, t)
+	}
+	return keys, ts, errors.Wrapf(rows.Err(), "can't list flag %s", flag)
+}
+
+// getUserDetail returns UserDetailEntry with requested userDetail (omitting other details)
+// as an only element of the slice.
+func (s *SQLDB) getUserDetail(req UserDetailRequest) (result []UserDetailEntry, err error) {
+	if err = s.checkSite(req.Locator.SiteID); err != nil {
+		return result, err
+	}
+
+	entry, found, err := s.loadUserDetail(req.Locator.SiteID, req.UserID)
+	if err != nil || !found {
+		return result, err
+	}
+	switch req.Detail {
+	case UserEmail:
+		result = []UserDetailEntry{{UserID: req.UserID, Email: entry.Email}}
+	case UserDigest:
+		result = []UserDetailEntry{{UserID: req.UserID, Digest: entry.Digest}}
+	case UserBio:
+		result = []UserDetailEntry{{UserID: req.UserID, Bio: entry.Bio}}
+	case UserWebsite:
+		result = []UserDetailEntry{{UserID: req.UserID, Website: entry.Website}}
+	case UserMuted:
+		result = []UserDetailEntry{{UserID: req.UserID, Muted: entry.Muted}}
+	}
+	return result, nil
+}
+
+// setUserDetail sets requested userDetail, returning complete updated UserDetailEntry as an only
+// element of the slice in case of success
+func (s *SQLDB) setUserDetail(req UserDetailRequest) (result []UserDetailEntry, err error) {
+	if err = s.checkSite(req.Locator.SiteID); err != nil {
+		return result, err
+	}
+
+	entry, _, err := s.loadUserDetail(req.Locator.SiteID, req.UserID)
+	if err != nil {
+		return result, err
+	}
+
+	if entry.UserID == "" {
+		// new entry to be created, need to set UserID for it
+		entry.UserID = req.UserID
+	}
+
+	switch req.Detail {
+	case UserEmail:
+		entry.Email = req.Update
+	case UserDigest:
+		entry.Digest = req.Update
+	case UserBio:
+		entry.Bio = req.Update
+	case UserWebsite:
+		entry.Website = req.Update
+	case UserMuted:
+		entry.Muted = req.Update
+	}
+
+	err = s.saveUserDetail(req.Locator.SiteID, entry)
+	return []UserDetailEntry{entry}, errors.Wrapf(err, "failed to update detail %s for %s in %s", req.Detail, req.UserID, req.Locator.SiteID)
+}
+
+// listDetails lists all available users details for given site
+func (s *SQLDB) listDetails(loc store.Locator) (result []UserDetailEntry, err error) {
+	if err = s.checkSite(loc.SiteID); err != nil {
+		return result, err
+	}
+
+	rows, err := s.db.Query(s.q(`SELECT data FROM user_details WHERE site=? ORDER BY user_id`), loc.SiteID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't list user details for %s", loc.SiteID)
+	}
+	defer rows.Close() // nolint
+
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "can't scan user detail")
+		}
+		var entry UserDetailEntry
+		if err = json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal entry")
+		}
+		result = append(result, entry)
+	}
+	return result, errors.Wrapf(rows.Err(), "can't list user details for %s", loc.SiteID)
+}
+
+// deleteUserDetail deletes requested UserDetail or whole UserDetailEntry
+func (s *SQLDB) deleteUserDetail(siteID, userID string, userDetail UserDetail) error {
+	if userDetail == AllUserDetails { // subscriptions are useless without user details
+		if _, err := s.db.Exec(s.q(`DELETE FROM subscriptions WHERE site=? AND user_id=?`), siteID, userID); err != nil {
+			return errors.Wrapf(err, "failed to delete subscriptions of %s", userID)
+		}
+	}
+	entry, found, err := s.loadUserDetail(siteID, userID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		// absent entry means that we should not do anything
+		return nil
+	}
+
+	switch userDetail {
+	case UserEmail:
+		entry.Email = ""
+	case UserDigest:
+		entry.Digest = ""
+	case UserBio:
+		entry.Bio = ""
+	case UserWebsite:
+		entry.Website = ""
+	case UserMuted:
+		entry.Muted = ""
+	case AllUserDetails:
+		entry = UserDetailEntry{UserID: userID}
+	}
+
+	if entry == (UserDetailEntry{UserID: userID}) {
+		// if entry doesn't have non-empty details, we should delete it
+		_, err = s.db.Exec(s.q(`DELETE FROM user_details WHERE site=? AND user_id=?`), siteID, userID)
+		return errors.Wrapf(err, "failed to delete user detail %s for %s", userDetail, userID)
+	}
+
+	// updated entry is not empty and we need to store it's updated copy
+	return errors.Wrapf(s.saveUserDetail(siteID, entry), "failed to update detail %s for %s", userDetail, userID)
+}
+
+func (s *SQLDB) loadUserDetail(siteID, userID string) (entry UserDetailEntry, found bool, err error) {
+	var data string
+	err = s.db.QueryRow(s.q(`SELECT data FROM user_details WHERE site=? AND user_id=?`), siteID, userID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return entry, false, nil
+	}
+	if err != nil {
+		return entry, false, errors.Wrapf(err, "can't load user detail for %s", userID)
+	}
+	if err = json.Unmarshal([]byte(data), &entry); err != nil {
+		return entry, false, errors.Wrap(err, "failed to unmarshal entry")
+	}
+	return entry, true, nil
+}
+
+func (s *SQLDB) saveUserDetail(siteID string, entry UserDetailEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "can't marshal user detail")
+	}
+	_, err = s.db.Exec(s.q(`INSERT INTO user_details (site, user_id, data) VALUES (?, ?, ?)
+		ON CONFLICT (site, user_id) DO UPDATE SET data=excluded.data`), siteID, entry.UserID, string(data))
+	return err
+}
+
+func (s *SQLDB) deleteComment(tx *sql.Tx, locator store.Locator, commentID string, mode store.DeleteMode) error {
+	comment, err := s.load(tx, locator, commentID)
+	if err != nil {
+		return err
+	}
+	// set deleted status and clear fields
+	comment.SetDeleted(mode)
+	if err = s.save(tx, comment); err != nil {
+		return errors.Wrapf(err, "can't save deleted comment for key %s from post %s", commentID, locator.URL)
+	}
+	_, err = tx.Exec(s.q(`DELETE FROM reports WHERE site=? AND comment_id=?`), locator.SiteID, commentID)
+	return errors.Wrapf(err, "failed to delete reports for %s", commentID)
+}
+
+// deleteAll removes all comments, user details, reports and subscriptions for given siteID, flags are kept
+func (s *SQLDB) deleteAll(siteID string) error {
+	err := s.tx(func(tx *sql.Tx) error {
+		for _, table := range []string{"comments", "user_details", "reports", "subscriptions"} {
+			if _, e := tx.Exec(s.q(`DELETE FROM `+table+` WHERE site=?`), siteID); e != nil {
+				return errors.Wrapf(e, "failed to delete from %s", table)
+			}
+		}
+		return nil
+	})
+	return errors.Wrapf(err, "failed to delete all from site %s", siteID)
+}
+
+// deleteUser removes all comments and details for given user. Everything will be market as deleted
+// and in hard mode user name and userID will be changed to "deleted", user's comments won't be found by userID anymore
+func (s *SQLDB) deleteUser(siteID, userID string, mode store.DeleteMode) error {
+	err := s.tx(func(tx *sql.Tx) error {
+		comments, err := s.query(tx, `SELECT data FROM comments WHERE site=? AND user_id=?`, siteID, userID)
+		if err != nil {
+			return err
+		}
+		if len(comments) == 0 {
+			return errors.Errorf("unknown user %s", userID)
+		}
+		log.Printf("[DEBUG] comments for removal=%d", len(comments))
+
+		for _, c := range comments {
+			if e := s.deleteComment(tx, c.Locator, c.ID, mode); e != nil {
+				return errors.Wrapf(e, "failed to delete comment %s", c.ID)
+			}
+		}
+
+		// detach comments from user in hard mode
+		if mode == store.HardDelete {
+			if _, e := tx.Exec(s.q(`UPDATE comments SET user_id=? WHERE site=? AND user_id=?`), "", siteID, userID); e != nil {
+				return errors.Wrapf(e, "failed to delete user %s", userID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.deleteUserDetail(siteID, userID, AllUserDetails)
+}
+
+// reports runs select for data column of reports table
+func (s *SQLDB) reports(query string, args ...interface{}) (res []store.Report, err error) {
+	res = []store.Report{}
+	rows, err := s.db.Query(s.q(query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get reports")
+	}
+	defer rows.Close() // nolint
+
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "can't scan report")
+		}
+		report := store.Report{}
+		if err = json.Unmarshal([]byte(data), &report); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal report")
+		}
+		res = append(res, report)
+	}
+	return res, errors.Wrap(rows.Err(), "can't get reports")
+}
+
+// subscriptions runs select for data column of subscriptions table
+func (s *SQLDB) subscriptions(query string, args ...interface{}) (res []store.Subscription, err error) {
+	res = []store.Subscription{}
+	rows, err := s.db.Query(s.q(query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get subscriptions")
+	}
+	defer rows.Close() //nolint
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "can't scan subscription")
+		}
+		sub := store.Subscription{}
+		if err = json.Unmarshal([]byte(data), &sub); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal subscription")
+		}
+		res = append(res, sub)
+	}
+	return res, errors.Wrap(rows.Err(), "can't get subscriptions")
+}
+
+// load comment by locator and id, returns the same errors as bolt for missing post or comment
+func (s *SQLDB) load(tx *sql.Tx, locator store.Locator, commentID string) (comment store.Comment, err error) {
+	var data string
+	err = tx.QueryRow(s.q(`SELECT data FROM comments WHERE site=? AND url=? AND id=?`),
+		locator.SiteID, locator.URL, commentID).Scan(&data)
+	if err == sql.ErrNoRows {
+		if e := s.checkPost(tx, locator); e != nil {
+			return comment, e
+		}
+		return comment, errors.Errorf("no value for %s", commentID)
+	}
+	if err != nil {
+		return comment, errors.Wrapf(err, "can't load comment %s", commentID)
+	}
+	if err = json.Unmarshal([]byte(data), &comment); err != nil {
+		return comment, errors.Wrap(err, "failed to unmarshal")
+	}
+	return comment, nil
+}
+
+// save updates existing comment's data, deleted and pending status
+func (s *SQLDB) save(tx *sql.Tx, comment store.Comment) error {
+	data, err := json.Marshal(comment)
+	if err != nil {
+		return errors.Wrap(err, "can't marshal comment")
+	}
+	_, err = tx.Exec(s.q(`UPDATE comments SET data=?, deleted=?, pending=? WHERE site=? AND url=? AND id=?`),
+		string(data), boolToInt(comment.Deleted), boolToInt(comment.Pending), comment.Locator.SiteID, comment.Locator.URL, comment.ID)
+	return errors.Wrapf(err, "failed to save key %s", comment.ID)
+}
+
+// query runs select for data column and unmarshal results to comments
+func (s *SQLDB) query(tx *sql.Tx, query string, args ...interface{}) (comments []store.Comment, err error) {
+	comments = []store.Comment{}
+	rows, err := tx.Query(s.q(query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't query comments")
+	}
+	defer rows.Close() // nolint
+
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "can't scan comment")
+		}
+		comment := store.Comment{}
+		if err = json.Unmarshal([]byte(data), &comment); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal")
+		}
+		comments = append(comments, comment)
+	}
+	return comments, errors.Wrap(rows.Err(), "can't query comments")
+}
+
+func (s *SQLDB) scanInfo(rows *sql.Rows) (list []store.PostInfo, err error) {
+	defer rows.Close() // nolint
+	list = []store.PostInfo{}
+	for rows.Next() {
+		info := store.PostInfo{}
+		var firstTS, lastTS int64
+		if err = rows.Scan(&info.URL, &info.Count, &firstTS, &lastTS); err != nil {
+			return nil, errors.Wrap(err, "can't scan info")
+		}
+		info.FirstTS, info.LastTS = time.Unix(0, firstTS), time.Unix(0, lastTS)
+		list = append(list, info)
+	}
+	return list, errors.Wrap(rows.Err(), "can't scan info")
+}
+
+// checkPost returns error if post has no comments, the same way bolt reports missing post bucket
+func (s *SQLDB) checkPost(tx *sql.Tx, locator store.Locator) error {
+	exists, err := s.exists(tx, `SELECT 1 FROM comments WHERE site=? AND url=?`, locator.SiteID, locator.URL)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.Errorf("no bucket %s in store", locator.URL)
+	}
+	return nil
+}
+
+func (s *SQLDB) exists(tx *sql.Tx, query string, args ...interface{}) (bool, error) {
+	var one int
+	err := tx.QueryRow(s.q(query+` LIMIT 1`), args...).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "can't check existence")
+	}
+	return true, nil
+}
+
+// tx runs fn in transaction, commits on success and rolls back on error
+func (s *SQLDB) tx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "can't start transaction")
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "can't commit transaction")
+}
+
+func (s *SQLDB) checkSite(siteID string) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if !s.sites[siteID] {
+		return errors.Errorf("site %q not found", siteID)
+	}
+	return nil
+}
+
+// q rebinds query placeholders from "?" to "$N" for postgres
+func (s *SQLDB) q(query string) string {
+	if s.driver != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func boolToInt(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,1297 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+var testSQLDB = "/tmp/test-remark-sql.db"
+
+func TestSQLDB_CreateAndFind(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	var bb Interface = b
+	_ = bb
+
+	req := FindRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, Sort: "time"}
+	res, err := b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, `some text, <a href="http://radio-t.com">link</a>`, res[0].Text)
+	assert.Equal(t, "user1", res[0].User.ID)
+	t.Log(res[0].ID)
+
+	_, err = b.Create(store.Comment{ID: res[0].ID, Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}})
+	assert.Error(t, err)
+	assert.Equal(t, "key id-1 already in store", err.Error())
+
+	req = FindRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t-bad"}, Sort: "time"}
+	_, err = b.Find(req)
+	assert.EqualError(t, err, `site "radio-t-bad" not found`)
+
+	assert.NoError(t, b.Close())
+}
+
+func TestSQLDB_CreateFailedReadOnly(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	comment := store.Comment{
+		ID:        "id-ro",
+		Text:      `some text, <a href="http://radio-t.com">link</a>`,
+		Timestamp: time.Date(2017, 12, 20, 15, 18, 22, 0, time.Local),
+		Locator:   store.Locator{URL: "https://radio-t.com/ro", SiteID: "radio-t"},
+		User:      store.User{ID: "user1", Name: "user name"},
+	}
+
+	flagReq := FlagRequest{Locator: comment.Locator, Flag: ReadOnly, Update: FlagTrue}
+	v, err := b.Flag(flagReq)
+	require.NoError(t, err)
+	assert.Equal(t, true, v)
+
+	_, err = b.Create(comment)
+	assert.Error(t, err)
+	assert.Equal(t, "post https://radio-t.com/ro is read-only", err.Error())
+
+	flagReq = FlagRequest{Locator: comment.Locator, Flag: ReadOnly, Update: FlagFalse}
+	v, err = b.Flag(flagReq)
+	require.NoError(t, err)
+	assert.Equal(t, false, v)
+
+	_, err = b.Create(comment)
+	assert.NoError(t, err)
+}
+
+func TestSQLDB_Get(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	req := FindRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, Sort: "time"}
+	res, err := b.Find(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(res), "2 records initially")
+
+	comment, err := b.Get(getReq(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, res[1].ID))
+	assert.NoError(t, err)
+	assert.Equal(t, "some text2", comment.Text)
+
+	comment, err = b.Get(getReq(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "1234567"))
+	assert.Error(t, err)
+
+	_, err = b.Get(getReq(store.Locator{URL: "https://radio-t.com", SiteID: "bad"}, res[1].ID))
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestSQLDB_Update(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	req := FindRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, Sort: "time"}
+	res, err := b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(res), "2 records initially")
+
+	comment := res[0]
+	comment.Text = "abc 123"
+	comment.Score = 100
+	err = b.Update(comment)
+	assert.NoError(t, err)
+
+	comment, err = b.Get(getReq(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, res[0].ID))
+	assert.NoError(t, err)
+	assert.Equal(t, "abc 123", comment.Text)
+	assert.Equal(t, res[0].ID, comment.ID)
+	assert.Equal(t, 100, comment.Score)
+
+	comment.Locator.SiteID = "bad"
+	err = b.Update(comment)
+	assert.EqualError(t, err, `site "bad" not found`)
+
+	comment.Locator.SiteID = "radio-t"
+	comment.Locator.URL = "https://radio-t.com-bad"
+	err = b.Update(comment)
+	assert.EqualError(t, err, `no bucket https://radio-t.com-bad in store`)
+}
+
+func TestSQLDB_UpdateClearIP(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := b.Create(store.Comment{ID: "id-ip", Text: "some text", Timestamp: time.Date(2017, 12, 20, 15, 20, 0, 0, time.Local),
+		Locator: locator, User: store.User{ID: "user1", Name: "user name", IP: "ip-hash"}})
+	require.NoError(t, err)
+
+	comment, err := b.Get(getReq(locator, "id-ip"))
+	require.NoError(t, err)
+	comment.User.Name, comment.User.IP = "changed", "other-ip-hash"
+	require.NoError(t, b.Update(comment))
+	comment, err = b.Get(getReq(locator, "id-ip"))
+	require.NoError(t, err)
+	assert.Equal(t, store.User{ID: "user1", Name: "user name", IP: "ip-hash"}, comment.User, "user immutable")
+
+	comment.User.IP = ""
+	require.NoError(t, b.Update(comment))
+	comment, err = b.Get(getReq(locator, "id-ip"))
+	require.NoError(t, err)
+	assert.Equal(t, store.User{ID: "user1", Name: "user name"}, comment.User, "ip cleared")
+}
+
+func TestSQLDB_FindLast(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	req := FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Sort: "-time"}
+	res, err := b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "some text2", res[0].Text)
+
+	req.Limit = 1
+	res, err = b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "some text2", res[0].Text)
+
+	req.Locator.SiteID = "bad"
+	_, err = b.Find(req)
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestSQLDB_FindLastSince(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	ts := time.Date(2017, 12, 20, 15, 18, 21, 0, time.Local)
+	req := FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Sort: "-time", Since: ts}
+	res, err := b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "some text2", res[0].Text)
+
+	req.Since = time.Date(2017, 12, 20, 15, 18, 22, 0, time.Local)
+	res, err = b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "some text2", res[0].Text)
+
+	req.Since = time.Date(2017, 12, 20, 16, 18, 22, 0, time.Local)
+	res, err = b.Find(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+}
+
+func TestSQLDB_FindInPostSince(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	ts := time.Date(2017, 12, 20, 15, 18, 21, 0, time.Local)
+	req := FindRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, Sort: "-time", Since: ts}
+	res, err := b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "some text2", res[0].Text)
+
+	req.Since = time.Date(2017, 12, 20, 15, 18, 22, 0, time.Local)
+	res, err = b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "some text2", res[0].Text)
+
+	req.Since = time.Date(2017, 12, 20, 16, 18, 22, 0, time.Local)
+	res, err = b.Find(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+}
+
+func TestSQLDB_FindForUser(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	req := FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Sort: "-time", UserID: "user1", Limit: 5}
+	res, err := b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "some text2", res[0].Text, "sorted by -time")
+
+	req = FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Sort: "-time", UserID: "user1", Limit: 1}
+	res, err = b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(res), "allow 1 comment")
+	assert.Equal(t, "some text2", res[0].Text, "sorted by -time")
+
+	req = FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Sort: "-time", UserID: "user1", Limit: 1, Skip: 1}
+	res, err = b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(res), "allow 1 comment")
+	assert.Equal(t, `some text, <a href="http://radio-t.com">link</a>`, res[0].Text, "second comment")
+
+	req = FindRequest{Locator: store.Locator{SiteID: "bad"}, Sort: "-time", UserID: "user1", Limit: 1, Skip: 1}
+	_, err = b.Find(req)
+	assert.EqualError(t, err, `site "bad" not found`)
+
+	req = FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Sort: "-time", UserID: "userZ", Limit: 1, Skip: 1}
+	_, err = b.Find(req)
+	assert.EqualError(t, err, `no comments for user userZ in store`)
+}
+
+func TestSQLDB_FindForUserPagination(t *testing.T) {
+	_ = os.Remove(testSQLDB)
+	b, err := NewSQLDB(SQLParams{Driver: "sqlite3", DSN: testSQLDB}, "radio-t")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, b.Close())
+		_ = os.Remove(testSQLDB)
+	}()
+
+	c := store.Comment{
+		Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"},
+		User:    store.User{ID: "user1", Name: "user name"},
+	}
+
+	// write 200 comments
+	for i := 0; i < 200; i++ {
+		c.ID = fmt.Sprintf("id-%d", i)
+		c.Text = fmt.Sprintf("text #%d", i)
+		c.Timestamp = time.Date(2017, 12, 20, 15, 18, i, 0, time.Local)
+		_, err = b.Create(c)
+		require.NoError(t, err)
+	}
+
+	// get all comments
+	req := FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Sort: "-time", UserID: "user1"}
+	res, err := b.Find(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, len(res))
+	assert.Equal(t, "id-199", res[0].ID)
+
+	// seek 0, 5 comments
+	req.Limit = 5
+	res, err = b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 5, len(res))
+	assert.Equal(t, "id-199", res[0].ID)
+	assert.Equal(t, "id-195", res[4].ID)
+
+	// seek 10, 3 comments
+	req.Skip, req.Limit = 10, 3
+	res, err = b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 3, len(res))
+	assert.Equal(t, "id-189", res[0].ID)
+	assert.Equal(t, "id-187", res[2].ID)
+
+	// seek 195, ask 10 comments
+	req.Skip, req.Limit = 195, 10
+	res, err = b.Find(req)
+	assert.NoError(t, err)
+	require.Equal(t, 5, len(res))
+	assert.Equal(t, "id-4", res[0].ID)
+	assert.Equal(t, "id-0", res[4].ID)
+
+	// seek 255, ask 10 comments
+	req.Skip, req.Limit = 255, 10
+	res, err = b.Find(req)
+	assert.NoError(t, err)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+}
+
+func TestSQLDB_CountPost(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	req := FindRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}}
+	c, err := b.Count(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, c)
+
+	req = FindRequest{Locator: store.Locator{URL: "https://radio-t.com-xxx", SiteID: "radio-t"}}
+	c, err = b.Count(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, c)
+
+	req = FindRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "bad"}}
+	_, err = b.Count(req)
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestSQLDB_Pending(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	for i := 3; i <= 5; i++ {
+		c := store.Comment{ID: fmt.Sprintf("id-%d", i), Text: fmt.Sprintf("pending %d", i), Pending: true, Locator: locator,
+			Timestamp: time.Date(2017, 12, 20, 15, 18, 20+i, 0, time.Local), User: store.User{ID: "user2", Name: "user name"}}
+		_, err := b.Create(c)
+		require.NoError(t, err)
+	}
+
+	c, err := b.Count(FindRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 2, c, "pending comments not counted")
+	info, err := b.Info(InfoRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 2, info[0].Count)
+
+	res, err := b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Pending: true})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res))
+	assert.Equal(t, "id-3", res[0].ID, "sorted by time")
+	assert.True(t, res[0].Pending)
+
+	res, err = b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Pending: true, Limit: 1, Skip: 1})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "id-4", res[0].ID)
+
+	// approve
+	approved := res[0]
+	approved.Pending = false
+	require.NoError(t, b.Update(approved))
+	c, err = b.Count(FindRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 3, c, "approved comment counted")
+
+	// reject
+	err = b.Delete(DeleteRequest{Locator: locator, CommentID: "id-5", DeleteMode: store.SoftDelete})
+	require.NoError(t, err)
+	c, err = b.Count(FindRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 3, c, "rejected comment not counted")
+
+	res, err = b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Pending: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "id-3", res[0].ID)
+
+	_, err = b.Find(FindRequest{Locator: store.Locator{SiteID: "bad"}, Pending: true})
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestSQLDB_Report(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	report := func(commentID, userID string, reason store.ReportReason) []store.Report {
+		ts = ts.Add(time.Minute)
+		res, err := b.Report(ReportRequest{Locator: loc, Update: &store.Report{Locator: loc, CommentID: commentID,
+			UserID: userID, Reason: reason, Timestamp: ts}})
+		require.NoError(t, err)
+		return res
+	}
+	assert.Equal(t, 1, len(report("id-1", "user2", store.ReportSpam)))
+	assert.Equal(t, 2, len(report("id-1", "user3", store.ReportSpam)))
+	res := report("id-1", "user2", store.ReportAbuse)
+	require.Equal(t, 2, len(res), "report of the same user replaced")
+	assert.Equal(t, "user3", res[0].UserID)
+	assert.Equal(t, store.ReportAbuse, res[1].Reason)
+	assert.Equal(t, 1, len(report("id-2", "user2", store.ReportOther)))
+
+	res, err := b.Report(ReportRequest{Locator: loc})
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(res), "all reports of site")
+	res, err = b.Report(ReportRequest{Locator: loc, CommentID: "id-2"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, store.Report{Locator: loc, CommentID: "id-2", UserID: "user2", Reason: store.ReportOther, Timestamp: ts}, res[0])
+
+	// dismiss reports
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, CommentID: "id-1", Reports: true}))
+	res, err = b.Report(ReportRequest{Locator: loc, CommentID: "id-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+	comment, err := b.Get(GetRequest{Locator: loc, CommentID: "id-1"})
+	require.NoError(t, err)
+	assert.False(t, comment.Deleted, "comment kept")
+
+	// reports removed with comment
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, CommentID: "id-2", DeleteMode: store.SoftDelete}))
+	res, err = b.Report(ReportRequest{Locator: loc})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+
+	_, err = b.Report(ReportRequest{Locator: loc, Update: &store.Report{CommentID: "id-1"}})
+	assert.EqualError(t, err, "comment id and user id required for report")
+	_, err = b.Report(ReportRequest{Locator: store.Locator{SiteID: "bad"}})
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestSQLDB_Changes(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+	_, err := b.Changes(ChangesRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	assert.EqualError(t, err, "change log not supported by sql engine, site radio-t")
+}
+
+func TestSQLDB_Subscription(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	subscribe := func(loc store.Locator, userID, commentID string) {
+		res, err := b.Subscription(SubscriptionRequest{Locator: loc, Update: &store.Subscription{Locator: loc, UserID: userID,
+			CommentID: commentID, Timestamp: ts}})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(res))
+		assert.Equal(t, userID, res[0].UserID)
+	}
+	subscribe(loc, "user1", "")
+	subscribe(loc, "user1", "")
+	subscribe(loc, "user1", "id-1")
+	subscribe(loc, "user2", "id-1")
+	subscribe(store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, "user2", "")
+
+	res, err := b.Subscription(SubscriptionRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(res), "all subscriptions of site, the same subscription replaced")
+
+	res, err = b.Subscription(SubscriptionRequest{Locator: loc})
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(res), "subscriptions of post")
+
+	res, err = b.Subscription(SubscriptionRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2"})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res), "subscriptions of user")
+
+	res, err = b.Subscription(SubscriptionRequest{Locator: loc, UserID: "user2"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res), "subscriptions of user to post")
+	assert.Equal(t, store.Subscription{Locator: loc, UserID: "user2", CommentID: "id-1", Timestamp: ts}, res[0])
+
+	// unsubscribe from thread
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, UserID: "user1", CommentID: "id-1", Subscription: true}))
+	res, err = b.Subscription(SubscriptionRequest{Locator: loc, UserID: "user1"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "", res[0].CommentID, "post subscription kept")
+
+	// unsubscribe from everything
+	require.NoError(t, b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2", Subscription: true}))
+	res, err = b.Subscription(SubscriptionRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user2"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+
+	// subscriptions removed with all user details
+	require.NoError(t, b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", UserDetail: AllUserDetails}))
+	res, err = b.Subscription(SubscriptionRequest{Locator: store.Locator{SiteID: "radio-t"}})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+
+	_, err = b.Subscription(SubscriptionRequest{Locator: loc, Update: &store.Subscription{Locator: loc}})
+	assert.EqualError(t, err, "user id and url required for subscription")
+	_, err = b.Subscription(SubscriptionRequest{Locator: store.Locator{SiteID: "bad"}})
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestSQLDB_CountUser(t *testing.T) {
+	var b, teardown = prepSQL(t)
+	defer teardown()
+
+	req := FindRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1"}
+	c, err := b.Count(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, c)
+
+	req = FindRequest{Locator: store.Locator{SiteID: "bad"}, UserID: "user1"}
+	_, err = b.Count(req)
+	assert.EqualError(t, err, `site "bad" not found`)
+
+	req = FindRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "userZ"}
+	_, err = b.Count(req)
+	assert.EqualError(t, err, `no comments for user userZ in store for radio-t site`)
+}
+
+func TestSQLDB_InfoPost(t *testing.T) {
+	b, teardown := prepSQL(t) // two comments for https://radio-t.com
+	defer teardown()
+
+	ts := func(min int) time.Time { return time.Date(2017, 12, 20, 15, 18, min, 0, time.Local) }
+
+	// add one more for https://radio-t.com/2
+	comment := store.Comment{
+		ID:        "12345",
+		Text:      `some text, <a href="http://radio-t.com">link</a>`,
+		Timestamp: time.Date(2017, 12, 20, 15, 18, 24, 0, time.Local),
+		Locator:   store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"},
+		User:      store.User{ID: "user1", Name: "user name"},
+	}
+	_, err := b.Create(comment)
+	assert.NoError(t, err)
+
+	req := InfoRequest{Locator: store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, ReadOnlyAge: 0}
+	r, err := b.Info(req)
+	require.NoError(t, err)
+	assert.Equal(t, []store.PostInfo{{URL: "https://radio-t.com/2", Count: 1, FirstTS: ts(24), LastTS: ts(24)}}, r)
+
+	req = InfoRequest{Locator: store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, ReadOnlyAge: 10}
+	r, err = b.Info(req)
+	require.NoError(t, err)
+	assert.Equal(t, []store.PostInfo{{URL: "https://radio-t.com/2", Count: 1, FirstTS: ts(24), LastTS: ts(24),
+		ReadOnly: true}}, r)
+
+	req = InfoRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, ReadOnlyAge: 0}
+	r, err = b.Info(req)
+	require.NoError(t, err)
+	assert.Equal(t, []store.PostInfo{{URL: "https://radio-t.com", Count: 2, FirstTS: ts(22), LastTS: ts(23)}}, r)
+
+	req = InfoRequest{Locator: store.Locator{URL: "https://radio-t.com/error", SiteID: "radio-t"}, ReadOnlyAge: 0}
+	_, err = b.Info(req)
+	require.Error(t, err)
+
+	req = InfoRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t-error"}, ReadOnlyAge: 0}
+	_, err = b.Info(req)
+	require.Error(t, err)
+
+	fr := FlagRequest{Flag: ReadOnly, Locator: store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, Update: FlagTrue}
+	_, err = b.Flag(fr)
+	require.NoError(t, err)
+	req = InfoRequest{Locator: store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, ReadOnlyAge: 0}
+	r, err = b.Info(req)
+	require.NoError(t, err)
+	assert.Equal(t, []store.PostInfo{{URL: "https://radio-t.com/2", Count: 1, FirstTS: ts(24), LastTS: ts(24),
+		ReadOnly: true}}, r)
+}
+
+func TestSQLDB_InfoList(t *testing.T) {
+	b, teardown := prepSQL(t) // two comments for https://radio-t.com
+	defer teardown()
+
+	// add one more for https://radio-t.com/2
+	comment := store.Comment{
+		ID:        "12345",
+		Text:      `some text, <a href="http://radio-t.com">link</a>`,
+		Timestamp: time.Date(2017, 12, 20, 15, 18, 22, 0, time.Local),
+		Locator:   store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"},
+		User:      store.User{ID: "user1", Name: "user name"},
+	}
+	_, err := b.Create(comment)
+	assert.NoError(t, err)
+
+	ts := func(sec int) time.Time { return time.Date(2017, 12, 20, 15, 18, sec, 0, time.Local) }
+
+	req := InfoRequest{Locator: store.Locator{SiteID: "radio-t"}}
+	res, err := b.Info(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []store.PostInfo{{URL: "https://radio-t.com/2", Count: 1, FirstTS: ts(22), LastTS: ts(22)},
+		{URL: "https://radio-t.com", Count: 2, FirstTS: ts(22), LastTS: ts(23)}}, res)
+
+	req = InfoRequest{Locator: store.Locator{SiteID: "radio-t"}, Limit: -1, Skip: -1}
+	res, err = b.Info(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []store.PostInfo{{URL: "https://radio-t.com/2", Count: 1, FirstTS: ts(22), LastTS: ts(22)},
+		{URL: "https://radio-t.com", Count: 2, FirstTS: ts(22), LastTS: ts(23)}}, res)
+
+	req = InfoRequest{Locator: store.Locator{SiteID: "radio-t"}, Limit: 1}
+	res, err = b.Info(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []store.PostInfo{{URL: "https://radio-t.com/2", Count: 1, FirstTS: ts(22), LastTS: ts(22)}}, res)
+
+	req = InfoRequest{Locator: store.Locator{SiteID: "radio-t"}, Limit: 1, Skip: 1}
+	res, err = b.Info(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []store.PostInfo{{URL: "https://radio-t.com", Count: 2, FirstTS: ts(22), LastTS: ts(23)}}, res)
+
+	req = InfoRequest{Locator: store.Locator{SiteID: "bad"}, Limit: 1, Skip: 1}
+	_, err = b.Info(req)
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestSQLDB_FlagBlockedUser(t *testing.T) {
+
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	req := FlagRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1"}
+	val, err := b.Flag(req)
+	assert.NoError(t, err)
+	assert.False(t, val, "nothing blocked yet")
+
+	req = FlagRequest{Flag: Blocked, Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Update: FlagTrue}
+	_, err = b.Flag(req)
+	assert.NoError(t, err)
+	val, err = b.Flag(FlagRequest{Flag: Blocked, Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1"})
+	assert.NoError(t, err)
+	assert.True(t, val, "user1 blocked")
+
+	req = FlagRequest{Flag: Blocked, Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Update: FlagTrue}
+	_, err = b.Flag(req)
+	assert.NoError(t, err)
+	val, err = b.Flag(FlagRequest{Flag: Blocked, Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1"})
+	assert.NoError(t, err)
+	assert.True(t, val, "user1 still blocked")
+
+	req = FlagRequest{Flag: Blocked, Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Update: FlagFalse}
+	_, err = b.Flag(req)
+	assert.NoError(t, err)
+	val, err = b.Flag(FlagRequest{Flag: Blocked, Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1"})
+	assert.NoError(t, err)
+	assert.False(t, val, "user1 unblocked")
+
+	req = FlagRequest{Flag: Blocked, Locator: store.Locator{SiteID: "bad"}, UserID: "user1", Update: FlagTrue}
+	_, err = b.Flag(req)
+	assert.EqualError(t, err, `site "bad" not found`)
+
+	req = FlagRequest{Flag: Blocked, Locator: store.Locator{SiteID: "radio-t"}, UserID: "userX", Update: FlagTrue}
+	_, err = b.Flag(req)
+	assert.NoError(t, err, "non-existing user can't be blocked")
+
+	req = FlagRequest{Flag: Blocked, Locator: store.Locator{SiteID: "radio-t-bad"}, UserID: "user1"}
+	val, err = b.Flag(req)
+	assert.NoError(t, err)
+	assert.False(t, val, "nothing blocked on wrong site")
+}
+
+func TestSQLDB_FlagReadOnlyPost(t *testing.T) {
+
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	req := FlagRequest{Locator: store.Locator{SiteID: "radio-t", URL: "url-1"}, Flag: ReadOnly}
+	val, err := b.Flag(req)
+	assert.NoError(t, err)
+	assert.False(t, val, "nothing ro")
+
+	req = FlagRequest{Locator: store.Locator{SiteID: "radio-t", URL: "url-1"}, Flag: ReadOnly, Update: FlagTrue}
+	val, err = b.Flag(req)
+	assert.NoError(t, err)
+	assert.Equal(t, true, val)
+	req = FlagRequest{Locator: store.Locator{SiteID: "radio-t", URL: "url-1"}, Flag: ReadOnly}
+	val, err = b.Flag(req)
+	assert.NoError(t, err)
+	assert.True(t, val, "url-1 ro")
+
+	req = FlagRequest{Locator: store.Locator{SiteID: "radio-t", URL: "url-2"}, Flag: ReadOnly}
+	val, err = b.Flag(req)
+	assert.NoError(t, err)
+	assert.False(t, val, "url-2 still writable")
+
+	req = FlagRequest{Locator: store.Locator{SiteID: "radio-t", URL: "url-1"}, Flag: ReadOnly, Update: FlagFalse}
+	_, err = b.Flag(req)
+	assert.NoError(t, err)
+	req = FlagRequest{Locator: store.Locator{SiteID: "radio-t", URL: "url-1"}, Flag: ReadOnly}
+	val, err = b.Flag(req)
+	assert.NoError(t, err)
+	assert.False(t, val, "url-1 writable")
+
+	req = FlagRequest{Locator: store.Locator{SiteID: "bad", URL: "url-1"}, Flag: ReadOnly, Update: FlagFalse}
+	_, err = b.Flag(req)
+	assert.EqualError(t, err, `site "bad" not found`)
+
+	req = FlagRequest{Locator: store.Locator{SiteID: "radio-t-bad", URL: "url-1"}, Flag: ReadOnly}
+	val, err = b.Flag(req)
+	assert.NoError(t, err)
+	assert.False(t, val, "nothing ro on wrong site")
+}
+
+func TestSQLDB_FlagVerified(t *testing.T) {
+
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	isVerified := func(site, user string) bool {
+		req := FlagRequest{Flag: Verified, Locator: store.Locator{SiteID: site}, UserID: user}
+		v, err := b.Flag(req)
+		require.NoError(t, err)
+		return v
+	}
+
+	setVerified := func(site, user string, status FlagStatus) error {
+		req := FlagRequest{Flag: Verified, Locator: store.Locator{SiteID: site}, UserID: user, Update: status}
+		_, err := b.Flag(req)
+		return err
+	}
+
+	assert.False(t, isVerified("radio-t", "u1"), "nothing verified")
+
+	assert.NoError(t, setVerified("radio-t", "u1", FlagTrue))
+	assert.True(t, isVerified("radio-t", "u1"), "u1 verified")
+
+	assert.False(t, isVerified("radio-t", "u2"), "u2 still not verified")
+	assert.NoError(t, setVerified("radio-t", "u1", FlagFalse))
+	assert.False(t, isVerified("radio-t", "u1"), "u1 not verified anymore")
+
+	assert.EqualError(t, setVerified("bad", "u1", FlagTrue), `site "bad" not found`)
+	assert.NoError(t, setVerified("radio-t", "u1xyz", FlagFalse))
+
+	assert.False(t, isVerified("radio-t-bad", "u1"), "nothing verified on wrong site")
+
+	assert.NoError(t, setVerified("radio-t", "u1", FlagTrue))
+	assert.NoError(t, setVerified("radio-t", "u2", FlagTrue))
+	assert.NoError(t, setVerified("radio-t", "u3", FlagFalse))
+}
+
+func TestSQLDB_FlagListVerified(t *testing.T) {
+
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	toIDs := func(inp []interface{}) (res []string) {
+		res = make([]string, len(inp))
+		for i, v := range inp {
+			vv, ok := v.(string)
+			require.True(t, ok)
+			res[i] = vv
+		}
+		return res
+	}
+
+	setVerified := func(site, user string, status FlagStatus) error {
+		req := FlagRequest{Flag: Verified, Locator: store.Locator{SiteID: site}, UserID: user, Update: status}
+		_, err := b.Flag(req)
+		return err
+	}
+
+	ids, err := b.ListFlags(FlagRequest{Flag: Verified, Locator: store.Locator{SiteID: "radio-t"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, toIDs(ids), "verified list empty")
+
+	assert.NoError(t, setVerified("radio-t", "u1", FlagTrue))
+	assert.NoError(t, setVerified("radio-t", "u2", FlagTrue))
+	ids, err = b.ListFlags(FlagRequest{Flag: Verified, Locator: store.Locator{SiteID: "radio-t"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u1", "u2"}, toIDs(ids), "verified 2 ids")
+
+	_, err = b.ListFlags(FlagRequest{Flag: Verified, Locator: store.Locator{SiteID: "radio-t-bad"}})
+	assert.Error(t, err, "site \"radio-t-bad\" not found", "fail on wrong site")
+}
+
+func TestSQLDB_FlagShadowBlocked(t *testing.T) {
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	loc := store.Locator{SiteID: "radio-t"}
+	_, err := b.Flag(FlagRequest{Flag: ShadowBlocked, Locator: loc, UserID: "user1", Update: FlagTrue})
+	require.NoError(t, err)
+	_, err = b.Flag(FlagRequest{Flag: ShadowBlocked, Locator: loc, UserID: "user2", Update: FlagTrue, TTL: 150 * time.Millisecond})
+	require.NoError(t, err)
+
+	val, err := b.Flag(FlagRequest{Flag: ShadowBlocked, Locator: loc, UserID: "user1"})
+	require.NoError(t, err)
+	assert.True(t, val, "user1 shadow blocked")
+	val, err = b.Flag(FlagRequest{Flag: Blocked, Locator: loc, UserID: "user1"})
+	require.NoError(t, err)
+	assert.False(t, val, "user1 not blocked")
+
+	vv, err := b.ListFlags(FlagRequest{Flag: ShadowBlocked, Locator: loc})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(vv))
+	assert.Equal(t, "user1", vv[0].(store.BlockedUser).ID)
+	assert.Equal(t, "user2", vv[1].(store.BlockedUser).ID)
+	vv, err = b.ListFlags(FlagRequest{Flag: Blocked, Locator: loc})
+	require.NoError(t, err)
+	assert.Empty(t, vv)
+
+	time.Sleep(150 * time.Millisecond)
+	val, err = b.Flag(FlagRequest{Flag: ShadowBlocked, Locator: loc, UserID: "user2"})
+	require.NoError(t, err)
+	assert.False(t, val, "user2 block expired")
+	vv, err = b.ListFlags(FlagRequest{Flag: ShadowBlocked, Locator: loc})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(vv))
+
+	_, err = b.Flag(FlagRequest{Flag: ShadowBlocked, Locator: loc, UserID: "user1", Update: FlagFalse})
+	require.NoError(t, err)
+	val, err = b.Flag(FlagRequest{Flag: ShadowBlocked, Locator: loc, UserID: "user1"})
+	require.NoError(t, err)
+	assert.False(t, val, "user1 unblocked")
+}
+
+func TestSQLDB_FlagListBlocked(t *testing.T) {
+
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	setBlocked := func(site, user string, status FlagStatus, ttl time.Duration) error {
+		req := FlagRequest{Flag: Blocked, Locator: store.Locator{SiteID: site}, UserID: user, Update: status, TTL: ttl}
+		_, err := b.Flag(req)
+		return err
+	}
+
+	toBlocked := func(inp []interface{}) (res []store.BlockedUser) {
+		res = make([]store.BlockedUser, len(inp))
+		for i, v := range inp {
+			vv, ok := v.(store.BlockedUser)
+			require.True(t, ok)
+			res[i] = vv
+		}
+		return res
+	}
+	assert.NoError(t, setBlocked("radio-t", "user1", FlagTrue, 0))
+	assert.NoError(t, setBlocked("radio-t", "user2", FlagTrue, 150*time.Millisecond))
+	assert.NoError(t, setBlocked("radio-t", "user3", FlagFalse, 0))
+
+	vv, err := b.ListFlags(FlagRequest{Flag: Blocked, Locator: store.Locator{SiteID: "radio-t"}})
+	assert.NoError(t, err)
+
+	blockedList := toBlocked(vv)
+	require.Equal(t, 2, len(blockedList))
+	assert.Equal(t, "user1", blockedList[0].ID)
+	assert.Equal(t, "user2", blockedList[1].ID)
+	t.Logf("%+v", blockedList)
+
+	// check block expiration
+	time.Sleep(150 * time.Millisecond)
+	vv, err = b.ListFlags(FlagRequest{Flag: Blocked, Locator: store.Locator{SiteID: "radio-t"}})
+	assert.NoError(t, err)
+	blockedList = toBlocked(vv)
+	require.Equal(t, 1, len(blockedList))
+	assert.Equal(t, "user1", blockedList[0].ID)
+
+	_, err = b.ListFlags(FlagRequest{Flag: Blocked, Locator: store.Locator{SiteID: "bad"}})
+	assert.EqualError(t, err, `site "bad" not found`)
+
+}
+
+func TestSQLDB_UserDetail(t *testing.T) {
+
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	// add two entries to DB before we start
+	result, err := b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u1", Detail: UserEmail, Update: "test@example.com"})
+	assert.NoError(t, err, "No error inserting entry expected")
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u1", Email: "test@example.com"}}, result)
+	result, err = b.UserDetail(UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u2", Detail: UserEmail, Update: "other@example.com"})
+	assert.NoError(t, err, "No error inserting entry expected")
+	assert.ElementsMatch(t, []UserDetailEntry{{UserID: "u2", Email: "other@example.com"}}, result)
+
+	// stateless tests without changing the state we set up before
+	var testData = []struct {
+		req      UserDetailRequest
+		error    string
+		expected []UserDetailEntry
+	}{
+		{req: UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u1", Detail: UserEmail},
+			expected: []UserDetailEntry{{UserID: "u1", Email: "test@example.com"}}},
+		{req: UserDetailRequest{Locator: store.Locator{SiteID: "bad"}, UserID: "u1", Detail: UserEmail},
+			error: `site "bad" not found`},
+		{req: UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u1xyz", Detail: UserEmail}},
+		{req: UserDetailRequest{Detail: UserEmail, Update: "new_value"},
+			error: `userid cannot be empty in request for single detail`},
+		{req: UserDetailRequest{Detail: UserDetail("bad")},
+			error: `unsupported detail "bad"`},
+		{req: UserDetailRequest{Update: "not_relevant", Detail: AllUserDetails},
+			error: `unsupported request with userdetail all`},
+		{req: UserDetailRequest{Locator: store.Locator{SiteID: "bad"}, Detail: AllUserDetails},
+			error: `site "bad" not found`},
+		{req: UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, Detail: AllUserDetails},
+			expected: []UserDetailEntry{{UserID: "u1", Email: "test@example.com"}, {UserID: "u2", Email: "other@example.com"}}},
+	}
+
+	for i, x := range testData {
+		result, err := b.UserDetail(x.req)
+		if x.error != "" {
+			assert.EqualError(t, err, x.error, "Error should match expected for case %d", i)
+		} else {
+			assert.NoError(t, err, "Error is not expected expected for case %d", i)
+		}
+		assert.ElementsMatch(t, x.expected, result, "Result should match expected for case %d", i)
+	}
+}
+
+func TestSQLDB_UserDigest(t *testing.T) {
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	loc := store.Locator{SiteID: "radio-t"}
+	_, err := b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserEmail, Update: "test@example.com"})
+	require.NoError(t, err)
+	result, err := b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserDigest, Update: "daily"})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Email: "test@example.com", Digest: "daily"}}, result)
+
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserDigest})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Digest: "daily"}}, result)
+
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, UserID: "u1", UserDetail: UserDigest}))
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, Detail: AllUserDetails})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Email: "test@example.com"}}, result, "email kept")
+}
+
+func TestSQLDB_UserProfileDetails(t *testing.T) {
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	loc := store.Locator{SiteID: "radio-t"}
+	_, err := b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserBio, Update: "some bio"})
+	require.NoError(t, err)
+	result, err := b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserWebsite, Update: "https://example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Bio: "some bio", Website: "https://example.com"}}, result)
+
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserBio})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Bio: "some bio"}}, result)
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserWebsite})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Website: "https://example.com"}}, result)
+
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, UserID: "u1", UserDetail: UserBio}))
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, Detail: AllUserDetails})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Website: "https://example.com"}}, result, "website kept")
+
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, UserID: "u1", UserDetail: UserWebsite}))
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, Detail: AllUserDetails})
+	require.NoError(t, err)
+	assert.Empty(t, result)
+}
+
+func TestSQLDB_UserMuted(t *testing.T) {
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	loc := store.Locator{SiteID: "radio-t"}
+	result, err := b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserMuted, Update: "u2,u3"})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Muted: "u2,u3"}}, result)
+
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, UserID: "u1", Detail: UserMuted})
+	require.NoError(t, err)
+	assert.Equal(t, []UserDetailEntry{{UserID: "u1", Muted: "u2,u3"}}, result)
+
+	require.NoError(t, b.Delete(DeleteRequest{Locator: loc, UserID: "u1", UserDetail: UserMuted}))
+	result, err = b.UserDetail(UserDetailRequest{Locator: loc, Detail: AllUserDetails})
+	require.NoError(t, err)
+	assert.Empty(t, result)
+}
+
+func TestSQLDB_DeleteComment(t *testing.T) {
+
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	reqReq := FindRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, Sort: "time"}
+	res, err := b.Find(reqReq)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(res), "initially 2 comments")
+
+	count, err := b.Count(reqReq)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "count=2 initially")
+
+	delReq := DeleteRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"},
+		CommentID: res[0].ID, DeleteMode: store.SoftDelete}
+
+	err = b.Delete(delReq)
+	assert.NoError(t, err)
+
+	res, err = b.Find(reqReq)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "", res[0].Text)
+	assert.True(t, res[0].Deleted, "marked deleted")
+	assert.Equal(t, store.User{Name: "user name", ID: "user1", Picture: "", Admin: false, Blocked: false, IP: ""}, res[0].User)
+
+	assert.Equal(t, "some text2", res[1].Text)
+	assert.False(t, res[1].Deleted)
+
+	comments, err := b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(comments), "1 in last, 1 removed")
+
+	count, err = b.Count(reqReq)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	delReq.CommentID = "123456"
+	err = b.Delete(delReq)
+	assert.Error(t, err)
+
+	delReq.Locator.SiteID = "bad"
+	delReq.CommentID = res[0].ID
+	err = b.Delete(delReq)
+	assert.EqualError(t, err, `site "bad" not found`)
+
+	delReq.Locator = store.Locator{URL: "https://radio-t.com/bad", SiteID: "radio-t"}
+	err = b.Delete(delReq)
+	assert.EqualError(t, err, `no bucket https://radio-t.com/bad in store`)
+}
+
+func TestSQLDB_DeleteHard(t *testing.T) {
+
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	reqReq := FindRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, Sort: "time"}
+	res, err := b.Find(reqReq)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(res), "initially 2 comments")
+
+	delReq := DeleteRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"},
+		CommentID: res[0].ID, DeleteMode: store.HardDelete}
+	err = b.Delete(delReq)
+	assert.NoError(t, err)
+
+	res, err = b.Find(reqReq)
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "", res[0].Text)
+	assert.True(t, res[0].Deleted, "marked deleted")
+	assert.Equal(t, store.User{Name: "deleted", ID: "deleted", Picture: "", Admin: false, Blocked: false, IP: ""}, res[0].User)
+}
+
+func TestSQLDB_DeleteHardAfterSoft(t *testing.T) {
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	res, err := b.Find(FindRequest{Locator: locator, Sort: "time"})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res), "initially 2 comments")
+
+	delReq := DeleteRequest{Locator: locator, CommentID: res[0].ID, DeleteMode: store.SoftDelete}
+	require.NoError(t, b.Delete(delReq))
+	count, err := b.Count(FindRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	delReq.DeleteMode = store.HardDelete
+	require.NoError(t, b.Delete(delReq))
+	count, err = b.Count(FindRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "not counted twice")
+	comment, err := b.Get(getReq(locator, res[0].ID))
+	require.NoError(t, err)
+	assert.Equal(t, store.User{Name: "deleted", ID: "deleted"}, comment.User)
+}
+
+func TestSQLDB_DeleteAll(t *testing.T) {
+
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	delReq := DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}}
+	err := b.Delete(delReq)
+	assert.NoError(t, err)
+
+	comments, err := b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(comments), "nothing left")
+
+	delReq = DeleteRequest{Locator: store.Locator{SiteID: "bad"}}
+	err = b.Delete(delReq)
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestSQLDB_DeleteUserDetail(t *testing.T) {
+	var (
+		createUser = UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Detail: UserEmail, Update: "value1"}
+		readUser   = UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Detail: UserEmail}
+		emailSet   = []UserDetailEntry{{UserID: "user1", Email: "value1"}}
+	)
+
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	var testData = []struct {
+		delReq    DeleteRequest
+		detailReq UserDetailRequest
+		expected  []UserDetailEntry
+		err       string
+	}{
+		{delReq: DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", UserDetail: UserEmail},
+			detailReq: createUser, expected: emailSet},
+		{delReq: DeleteRequest{Locator: store.Locator{SiteID: "bad"}, UserID: "user1", UserDetail: UserEmail},
+			detailReq: readUser, expected: emailSet, err: `site "bad" not found`},
+		{delReq: DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", UserDetail: UserEmail},
+			detailReq: readUser},
+		{delReq: DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", UserDetail: AllUserDetails},
+			detailReq: createUser, expected: emailSet},
+		{delReq: DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", UserDetail: AllUserDetails},
+			detailReq: readUser},
+	}
+
+	for i, x := range testData {
+		err := b.Delete(x.delReq)
+		if x.err == "" {
+			require.NoError(t, err, "delete request #%d error", i)
+		} else {
+			require.EqualError(t, err, x.err, "delete request #%d error", i)
+		}
+
+		val, err := b.UserDetail(x.detailReq)
+		require.NoError(t, err, "user request #%d error", i)
+		require.Equal(t, x.expected, val, "user request #%d result", i)
+	}
+}
+
+func TestSQLDBAdmin_DeleteUserHard(t *testing.T) {
+
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	err := b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", DeleteMode: store.HardDelete})
+	require.NoError(t, err)
+
+	comments, err := b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}, Sort: "time"})
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(comments), "2 comments with deleted info")
+	assert.Equal(t, store.User{Name: "deleted", ID: "deleted", Picture: "", Admin: false, Blocked: false, IP: ""}, comments[0].User)
+	assert.Equal(t, store.User{Name: "deleted", ID: "deleted", Picture: "", Admin: false, Blocked: false, IP: ""}, comments[1].User)
+
+	c, err := b.Count(FindRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, c, "0 count")
+
+	_, err = b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Limit: 5})
+	assert.EqualError(t, err, "no comments for user user1 in store")
+
+	comments, err = b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Sort: "time"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(comments), "nothing left")
+
+	err = b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t-bad"}, UserID: "user1"})
+	assert.EqualError(t, err, `site "radio-t-bad" not found`)
+}
+
+func TestSQLDBAdmin_DeleteUserSoft(t *testing.T) {
+
+	b, teardown := prepSQL(t)
+	defer teardown()
+
+	err := b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", DeleteMode: store.SoftDelete})
+	require.NoError(t, err)
+
+	comments, err := b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}, Sort: "time"})
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(comments), "2 comments with deleted info")
+	assert.Equal(t, store.User{Name: "user name", ID: "user1", Picture: "", Admin: false, Blocked: false, IP: ""}, comments[0].User)
+	assert.Equal(t, store.User{Name: "user name", ID: "user1", Picture: "", Admin: false, Blocked: false, IP: ""}, comments[1].User)
+
+	c, err := b.Count(FindRequest{Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, c, "0 count")
+
+	comments, err = b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Limit: 5})
+	assert.NoError(t, err, "no comments for user user1 in store")
+	require.Equal(t, 2, len(comments), "2 comments with deleted info")
+	assert.True(t, comments[0].Deleted)
+	assert.True(t, comments[1].Deleted)
+	assert.Equal(t, "", comments[0].Text)
+	assert.Equal(t, "", comments[1].Text)
+
+	comments, err = b.Find(FindRequest{Locator: store.Locator{SiteID: "radio-t"}, Sort: "time"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(comments), "nothing left")
+
+	err = b.Delete(DeleteRequest{Locator: store.Locator{SiteID: "radio-t-bad"}, UserID: "user1"})
+	assert.EqualError(t, err, `site "radio-t-bad" not found`)
+}
+
+func TestSQLDB_AddRemoveSite(t *testing.T) {
+	b, teardown := prepSQL(t)
+	defer teardown()
+	var _ SiteManager = b
+
+	locator := store.Locator{URL: "https://example.com", SiteID: "site2"}
+	_, err := b.Create(store.Comment{ID: "c1", Text: "text", Locator: locator, User: store.User{ID: "user1"}})
+	require.EqualError(t, err, `site "site2" not found`)
+	require.NoError(t, b.AddSite("site2"))
+	assert.EqualError(t, b.AddSite("site2"), "site site2 already opened")
+	_, err = b.Create(store.Comment{ID: "c1", Text: "text", Timestamp: time.Now(), Locator: locator, User: store.User{ID: "user1"}})
+	require.NoError(t, err)
+	_, err = b.Flag(FlagRequest{Locator: store.Locator{SiteID: "site2"}, UserID: "user1", Flag: Verified, Update: FlagTrue})
+	require.NoError(t, err)
+
+	// removed site data kept
+	require.NoError(t, b.RemoveSite("site2", false))
+	_, err = b.Get(getReq(locator, "c1"))
+	assert.EqualError(t, err, `site "site2" not found`)
+	require.NoError(t, b.AddSite("site2"))
+	_, err = b.Get(getReq(locator, "c1"))
+	require.NoError(t, err)
+
+	// dropped site data removed
+	require.NoError(t, b.RemoveSite("site2", true))
+	assert.EqualError(t, b.RemoveSite("site2", true), `site "site2" not found`)
+	require.NoError(t, b.AddSite("site2"))
+	_, err = b.Get(getReq(locator, "c1"))
+	assert.Error(t, err)
+	verified, err := b.ListFlags(FlagRequest{Locator: store.Locator{SiteID: "site2"}, Flag: Verified})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(verified))
+
+	count, err := b.Count(FindRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "other site not affected")
+}
+
+func TestSQLDB_NewFailed(t *testing.T) {
+	_, err := NewSQLDB(SQLParams{Driver: "mysql", DSN: testSQLDB}, "radio-t")
+	assert.EqualError(t, err, `unsupported sql driver "mysql"`)
+
+	_, err = NewSQLDB(SQLParams{Driver: "sqlite3", DSN: "/tmp/no-such-place/tmp.db"}, "radio-t")
+	assert.Error(t, err)
+}
+
+func TestSQLDB_Rebind(t *testing.T) {
+	s := SQLDB{driver: "sqlite3"}
+	assert.Equal(t, "SELECT 1 WHERE a=? AND b=?", s.q("SELECT 1 WHERE a=? AND b=?"))
+	s = SQLDB{driver: "postgres"}
+	assert.Equal(t, "SELECT 1 WHERE a=$1 AND b=$2", s.q("SELECT 1 WHERE a=? AND b=?"))
+}
+
+func TestSQLDB_Reopen(t *testing.T) {
+	b, _ := prepSQL(t)
+	require.NoError(t, b.Close())
+	defer os.Remove(testSQLDB)
+
+	b, err := NewSQLDB(SQLParams{Driver: "sqlite3", DSN: testSQLDB}, "radio-t")
+	require.NoError(t, err)
+	defer b.Close()
+	res, err := b.Find(FindRequest{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, Sort: "time"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(res), "comments kept after reopen")
+}
+
+// makes new sqlite db, put two records
+func prepSQL(t *testing.T) (b *SQLDB, teardown func()) {
+	_ = os.Remove(testSQLDB)
+
+	sqlStore, err := NewSQLDB(SQLParams{Driver: "sqlite3", DSN: testSQLDB}, "radio-t")
+	require.NoError(t, err)
+	b = sqlStore
+
+	comment := store.Comment{
+		ID:        "id-1",
+		Text:      `some text, <a href="http://radio-t.com">link</a>`,
+		Timestamp: time.Date(2017, 12, 20, 15, 18, 22, 0, time.Local),
+		Locator:   store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"},
+		User:      store.User{ID: "user1", Name: "user name"},
+	}
+	_, err = b.Create(comment)
+	assert.NoError(t, err)
+
+	comment = store.Comment{
+		ID:        "id-2",
+		Text:      "some text2",
+		Timestamp: time.Date(2017, 12, 20, 15, 18, 23, 0, time.Local),
+		Locator:   store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"},
+		User:      store.User{ID: "user1", Name: "user name"},
+	}
+	_, err = b.Create(comment)
+	assert.NoError(t, err)
+
+	teardown = func() {
+		require.NoError(t, b.Close())
+		_ = os.Remove(testSQLDB)
+	}
+	return b, teardown
+}
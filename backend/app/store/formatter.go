@@ -3,18 +3,37 @@ package store
 import (
 	"net/url"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/Depado/bfchroma"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/alecthomas/chroma/formatters/html"
+	log "github.com/go-pkgz/lgr"
 	bf "github.com/russross/blackfriday/v2"
+	xhtml "golang.org/x/net/html"
 )
 
 // CommentFormatter implements all generic formatting ops on comment
 type CommentFormatter struct {
+	Mentions    MentionResolver // resolves @name mentions, mentions not linked if not set
+	MaxMentions int             // max number of users mentioned in one comment, 0 disables mentions
+
 	converters []CommentConverter
 }
 
+// MentionResolver returns users commented the post, used to resolve @name mentions
+type MentionResolver interface {
+	Commenters(locator Locator) ([]Commenter, error)
+}
+
+// Commenter is the user commented the post with id of the latest comment of the user
+type Commenter struct {
+	UserID    string
+	Name      string
+	CommentID string
+}
+
 // CommentConverter defines interface to convert some parts of commentHTML
 // Passed at creation time and does client-defined conversions, like image proxy link change
 type CommentConverter interface {
@@ -34,9 +53,10 @@ func NewCommentFormatter(converters ...CommentConverter) *CommentFormatter {
 	return &CommentFormatter{converters: converters}
 }
 
-// Format comment fields
+// Format comment fields, links mentions of users commented the same post
 func (f *CommentFormatter) Format(c Comment) Comment {
 	c.Text = f.FormatText(c.Text)
+	c = f.linkMentions(c)
 	return c
 }
 
@@ -96,6 +116,100 @@ func (f *CommentFormatter) shortenAutoLinks(commentHTML string, max int) (resHTM
 	return resHTML
 }
 
+const mentionNav = "#remark42__comment-"
+
+// linkMentions replaces @name of users commented the post by links to the latest comment of the user and sets
+// ids of mentioned users. Names in links and code are not changed, users above MaxMentions are not linked.
+func (f *CommentFormatter) linkMentions(c Comment) Comment {
+	c.Mentions = nil
+	if f.Mentions == nil || f.MaxMentions <= 0 || !strings.Contains(c.Text, "@") {
+		return c
+	}
+	commenters, err := f.Mentions.Commenters(c.Locator)
+	if err != nil || len(commenters) == 0 {
+		return c
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(c.Text))
+	if err != nil {
+		return c
+	}
+
+	linked := map[string]bool{} // user ids of linked mentions
+	var walk func(n *xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		for child := n.FirstChild; child != nil; {
+			next := child.NextSibling
+			switch {
+			case child.Type == xhtml.TextNode:
+				for _, node := range f.splitMentions(child.Data, commenters, &c, linked) {
+					n.InsertBefore(node, child)
+				}
+				n.RemoveChild(child)
+			case child.Type == xhtml.ElementNode && (child.Data == "a" || child.Data == "code" || child.Data == "pre"):
+			default:
+				walk(child)
+			}
+			child = next
+		}
+	}
+	body := doc.Find("body")
+	for _, n := range body.Nodes {
+		walk(n)
+	}
+	if len(linked) == 0 {
+		return c
+	}
+	res, err := body.Html()
+	if err != nil {
+		log.Printf("[WARN] can't render mentions of %s, %v", c.ID, err)
+		return c
+	}
+	c.Text = res
+	return c
+}
+
+// splitMentions splits text into text and link nodes, one link per mention.
+// Mention is @ followed by the longest name of commenter, case insensitive, not followed by letter or digit
+func (f *CommentFormatter) splitMentions(text string, commenters []Commenter, c *Comment, linked map[string]bool) []*xhtml.Node {
+	isWordRune := func(r rune, _ int) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' }
+	var res []*xhtml.Node
+	start := 0 // start of text not added to result yet
+	for i := 0; i < len(text); i++ {
+		if text[i] != '@' || (i > 0 && isWordRune(utf8.DecodeLastRuneInString(text[:i]))) {
+			continue
+		}
+		rest := text[i+1:]
+		var found *Commenter
+		for j, cm := range commenters {
+			if cm.Name == "" || len(cm.Name) > len(rest) || !strings.EqualFold(rest[:len(cm.Name)], cm.Name) {
+				continue
+			}
+			if len(cm.Name) < len(rest) && isWordRune(utf8.DecodeRuneInString(rest[len(cm.Name):])) {
+				continue
+			}
+			if found == nil || len(cm.Name) > len(found.Name) {
+				found = &commenters[j]
+			}
+		}
+		if found == nil || (!linked[found.UserID] && len(linked) >= f.MaxMentions) {
+			continue
+		}
+		if !linked[found.UserID] && found.UserID != c.User.ID {
+			c.Mentions = append(c.Mentions, found.UserID)
+		}
+		linked[found.UserID] = true
+
+		end := i + 1 + len(found.Name)
+		res = append(res, &xhtml.Node{Type: xhtml.TextNode, Data: text[start:i]})
+		link := &xhtml.Node{Type: xhtml.ElementNode, Data: "a",
+			Attr: []xhtml.Attribute{{Key: "href", Val: c.Locator.URL + mentionNav + found.CommentID}}}
+		link.AppendChild(&xhtml.Node{Type: xhtml.TextNode, Data: text[i:end]})
+		res = append(res, link)
+		start, i = end, end-1
+	}
+	return append(res, &xhtml.Node{Type: xhtml.TextNode, Data: text[start:]})
+}
+
 func (f *CommentFormatter) unEscape(txt string) (res string) {
 	elems := []struct {
 		from, to string
@@ -114,3 +114,47 @@ func TestFormatter_ShortenAutoLinks(t *testing.T) {
 		assert.Equalf(t, tt.out, got, "check #%d", n)
 	}
 }
+
+type mockMentions []Commenter
+
+func (m mockMentions) Commenters(Locator) ([]Commenter, error) { return m, nil }
+
+func TestFormatter_FormatMentions(t *testing.T) {
+	f := NewCommentFormatter()
+	f.Mentions = mockMentions{{UserID: "u1", Name: "Bob", CommentID: "c1"}, {UserID: "u2", Name: "Bob Smith", CommentID: "c2"},
+		{UserID: "u3", Name: "alice", CommentID: "c3"}, {UserID: "u4", Name: "Лена", CommentID: "c4"}}
+	f.MaxMentions = 2
+
+	tbl := []struct {
+		in, out  string
+		mentions []string
+		name     string
+	}{
+		{"hi @bob!", `<p>hi <a href="https://radio-t.com#remark42__comment-c1">@bob</a>!</p>` + "\n", []string{"u1"}, "simple"},
+		{"@Bob Smith, agree", `<p><a href="https://radio-t.com#remark42__comment-c2">@Bob Smith</a>, agree</p>` + "\n",
+			[]string{"u2"}, "longest name"},
+		{"@Лена, да", `<p><a href="https://radio-t.com#remark42__comment-c4">@Лена</a>, да</p>` + "\n", []string{"u4"}, "unicode"},
+		{"@bobby and mail bob@alice.com", "<p>@bobby and mail bob@alice.com</p>\n", nil, "not a name"},
+		{"@nobody", "<p>@nobody</p>\n", nil, "unknown"},
+		{"`@bob` and [@bob](http://example.com)", `<p><code>@bob</code> and <a href="http://example.com">@bob</a></p>` + "\n",
+			nil, "code and links"},
+		{"@bob @alice @Лена @bob", `<p><a href="https://radio-t.com#remark42__comment-c1">@bob</a> ` +
+			`<a href="https://radio-t.com#remark42__comment-c3">@alice</a> @Лена ` +
+			`<a href="https://radio-t.com#remark42__comment-c1">@bob</a></p>` + "\n", []string{"u1", "u3"}, "max mentions"},
+		{"@me", `<p><a href="https://radio-t.com#remark42__comment-c5">@me</a></p>` + "\n", nil, "self"},
+	}
+	f.Mentions = append(f.Mentions.(mockMentions), Commenter{UserID: "me", Name: "me", CommentID: "c5"})
+	for _, tt := range tbl {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := f.Format(Comment{Text: tt.in, User: User{ID: "me"}, Locator: Locator{SiteID: "radio-t", URL: "https://radio-t.com"}})
+			assert.Equal(t, tt.out, c.Text)
+			assert.Equal(t, tt.mentions, c.Mentions)
+		})
+	}
+
+	f.MaxMentions = 0
+	c := f.Format(Comment{Text: "@bob", Locator: Locator{SiteID: "radio-t", URL: "https://radio-t.com"}})
+	assert.Equal(t, "<p>@bob</p>\n", c.Text, "mentions disabled")
+	assert.Nil(t, c.Mentions)
+}
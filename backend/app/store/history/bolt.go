@@ -0,0 +1,155 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// tsKeyFormat keeps revisions of the comment sorted by time
+const tsKeyFormat = "2006-01-02T15:04:05.000000000Z"
+
+// Bolt implements Store with bolt db. Each site has its own bucket, key is comment-id!!ts,
+// value is json-serialized Revision
+type Bolt struct {
+	db *bolt.DB
+}
+
+// NewBoltStorage makes history store in fileName
+func NewBoltStorage(fileName string, options bolt.Options) (*Bolt, error) {
+	db, err := bolt.Open(fileName, 0600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to make boltdb for %s", fileName)
+	}
+	return &Bolt{db: db}, nil
+}
+
+// Add revisions, site, comment and time required
+func (b *Bolt) Add(revisions ...Revision) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		for _, r := range revisions {
+			if r.SiteID == "" || r.CommentID == "" || r.Timestamp.IsZero() {
+				return errors.New("site id, comment id and time required for revision")
+			}
+			bkt, err := tx.CreateBucketIfNotExists([]byte(r.SiteID))
+			if err != nil {
+				return errors.Wrapf(err, "can't make bucket for %s", r.SiteID)
+			}
+			data, err := json.Marshal(r)
+			if err != nil {
+				return errors.Wrapf(err, "can't marshal revision of %s", r.CommentID)
+			}
+			if err = bkt.Put(revisionKey(r), data); err != nil {
+				return errors.Wrapf(err, "can't put revision of %s", r.CommentID)
+			}
+		}
+		return nil
+	})
+}
+
+// List revisions of the comment, oldest first. Empty commentID lists revisions of all comments of the site
+func (b *Bolt) List(siteID, commentID string) (res []Revision, err error) {
+	res = []Revision{}
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil // nothing stored for site
+		}
+		prefix := []byte{}
+		if commentID != "" {
+			prefix = commentPrefix(commentID)
+		}
+		c := bkt.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			r := Revision{}
+			if e := json.Unmarshal(v, &r); e != nil {
+				return errors.Wrapf(e, "can't unmarshal revision %s", string(k))
+			}
+			res = append(res, r)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// Delete all revisions of comments
+func (b *Bolt) Delete(siteID string, commentIDs ...string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil
+		}
+		for _, id := range commentIDs {
+			var keys [][]byte
+			prefix := commentPrefix(id)
+			c := bkt.Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				keys = append(keys, k)
+			}
+			if err := deleteKeys(bkt, keys); err != nil {
+				return errors.Wrapf(err, "can't delete revisions of %s", id)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteUser deletes revisions of all comments of the user
+func (b *Bolt) DeleteUser(siteID, userID string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil
+		}
+		var keys [][]byte
+		err := bkt.ForEach(func(k, v []byte) error {
+			r := Revision{}
+			if e := json.Unmarshal(v, &r); e != nil {
+				return errors.Wrapf(e, "can't unmarshal revision %s", string(k))
+			}
+			if r.UserID == userID {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return errors.Wrapf(deleteKeys(bkt, keys), "can't delete revisions of user %s", userID)
+	})
+}
+
+// DeleteSite deletes all revisions of the site
+func (b *Bolt) DeleteSite(siteID string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(siteID)) == nil {
+			return nil
+		}
+		return errors.Wrapf(tx.DeleteBucket([]byte(siteID)), "can't delete revisions of site %s", siteID)
+	})
+}
+
+// Close bolt db
+func (b *Bolt) Close() error {
+	return errors.Wrap(b.db.Close(), "can't close history db")
+}
+
+// deleteKeys removes collected keys, keys can't be deleted while iterating with cursor
+func deleteKeys(bkt *bolt.Bucket, keys [][]byte) error {
+	for _, k := range keys {
+		if err := bkt.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func commentPrefix(commentID string) []byte {
+	return []byte(commentID + "!!")
+}
+
+func revisionKey(r Revision) []byte {
+	return append(commentPrefix(r.CommentID), r.Timestamp.UTC().Format(tsKeyFormat)...)
+}
@@ -0,0 +1,101 @@
+package history
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+const testHistoryDB = "/tmp/test-remark-history.db"
+
+func TestBolt_AddList(t *testing.T) {
+	b, teardown := prepBolt(t)
+	defer teardown()
+
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	err := b.Add(
+		Revision{SiteID: "radio-t", CommentID: "c1", UserID: "u1", EditorID: "u1", Timestamp: ts.Add(time.Minute), Orig: "edited"},
+		Revision{SiteID: "radio-t", CommentID: "c1", UserID: "u1", EditorID: "u1", Timestamp: ts, Orig: "original"},
+		Revision{SiteID: "radio-t", CommentID: "c2", UserID: "u2", EditorID: "admin", Timestamp: ts, Orig: "other"},
+		Revision{SiteID: "other", CommentID: "c1", UserID: "u1", EditorID: "u1", Timestamp: ts, Orig: "other site"},
+	)
+	require.NoError(t, err)
+
+	res, err := b.List("radio-t", "c1")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "original", res[0].Orig, "oldest first")
+	assert.Equal(t, "edited", res[1].Orig)
+
+	res, err = b.List("radio-t", "")
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(res), "all revisions of site")
+
+	require.NoError(t, b.Add(Revision{SiteID: "radio-t", CommentID: "c1", UserID: "u1", Timestamp: ts, Orig: "replaced"}))
+	res, err = b.List("radio-t", "c1")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res), "revision with the same time replaced")
+	assert.Equal(t, "replaced", res[0].Orig)
+
+	res, err = b.List("bad", "c1")
+	require.NoError(t, err)
+	assert.Equal(t, []Revision{}, res)
+
+	err = b.Add(Revision{SiteID: "radio-t", CommentID: "c1"})
+	assert.EqualError(t, err, "site id, comment id and time required for revision")
+
+	_, err = NewBoltStorage("/dev/null/bad.db", bolt.Options{})
+	assert.Error(t, err)
+}
+
+func TestBolt_Delete(t *testing.T) {
+	b, teardown := prepBolt(t)
+	defer teardown()
+
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, b.Add(
+		Revision{SiteID: "radio-t", CommentID: "c1", UserID: "u1", Timestamp: ts},
+		Revision{SiteID: "radio-t", CommentID: "c1", UserID: "u1", Timestamp: ts.Add(time.Minute)},
+		Revision{SiteID: "radio-t", CommentID: "c2", UserID: "u1", Timestamp: ts},
+		Revision{SiteID: "radio-t", CommentID: "c3", UserID: "u2", Timestamp: ts},
+		Revision{SiteID: "other", CommentID: "c4", UserID: "u1", Timestamp: ts},
+	))
+
+	require.NoError(t, b.Delete("radio-t", "c1", "bad"))
+	res, err := b.List("radio-t", "")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "c2", res[0].CommentID)
+
+	require.NoError(t, b.DeleteUser("radio-t", "u1"))
+	res, err = b.List("radio-t", "")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "c3", res[0].CommentID)
+	res, err = b.List("other", "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(res), "other site not affected")
+
+	require.NoError(t, b.DeleteSite("radio-t"))
+	res, err = b.List("radio-t", "")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+
+	assert.NoError(t, b.Delete("bad", "c1"))
+	assert.NoError(t, b.DeleteUser("bad", "u1"))
+	assert.NoError(t, b.DeleteSite("bad"))
+}
+
+func prepBolt(t *testing.T) (b *Bolt, teardown func()) {
+	_ = os.Remove(testHistoryDB)
+	b, err := NewBoltStorage(testHistoryDB, bolt.Options{})
+	require.NoError(t, err)
+	return b, func() {
+		_ = b.Close()
+		_ = os.Remove(testHistoryDB)
+	}
+}
@@ -0,0 +1,152 @@
+// Package history keeps revisions of edited comments, i.e. what was posted originally and each edit after,
+// and makes word-level diffs between revisions.
+package history
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Revision is a version of comment's text
+type Revision struct {
+	SiteID    string    `json:"site"`
+	CommentID string    `json:"comment_id"`
+	UserID    string    `json:"user_id"`   // author of the comment
+	EditorID  string    `json:"editor_id"` // user made the revision
+	Timestamp time.Time `json:"time"`
+	Orig      string    `json:"orig"` // original markdown
+	Text      string    `json:"text"` // rendered html
+	Summary   string    `json:"summary,omitempty"`
+}
+
+// Version is a revision with changes of its markdown from the previous revision
+type Version struct {
+	Revision
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// Op defines type of change
+type Op string
+
+// enum of all change types
+const (
+	OpEqual  Op = "="
+	OpInsert Op = "+"
+	OpDelete Op = "-"
+)
+
+// Change is a fragment of text kept, inserted or deleted
+type Change struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Store defines interface to keep revisions of comments
+type Store interface {
+	Add(revisions ...Revision) error                   // add revisions, revision of the same comment with the same time replaced
+	List(siteID, commentID string) ([]Revision, error) // revisions of the comment, oldest first, all revisions of the site for empty commentID
+	Delete(siteID string, commentIDs ...string) error  // delete all revisions of comments
+	DeleteUser(siteID, userID string) error            // delete revisions of all comments of the user
+	DeleteSite(siteID string) error                    // delete all revisions of the site
+	Close() error
+}
+
+// maxDiffSize limits number of compared pairs of words, longer texts reported as replaced completely
+const maxDiffSize = 4 * 1024 * 1024
+
+// Versions makes versions from revisions sorted oldest first, each version but the first has changes from the previous one
+func Versions(revisions []Revision) []Version {
+	res := make([]Version, 0, len(revisions))
+	for i, r := range revisions {
+		v := Version{Revision: r}
+		if i > 0 {
+			v.Changes = Diff(revisions[i-1].Orig, r.Orig)
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+// Diff makes word-level changes turning text a to text b, with the longest common subsequence of words kept
+func Diff(a, b string) []Change {
+	wa, wb := words(a), words(b)
+	if len(wa)*len(wb) > maxDiffSize {
+		return merge([]Change{{Op: OpDelete, Text: a}, {Op: OpInsert, Text: b}})
+	}
+
+	// lcs[i][j] is length of the longest common subsequence of wa[i:] and wb[j:]
+	lcs := make([][]int, len(wa)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(wb)+1)
+	}
+	for i := len(wa) - 1; i >= 0; i-- {
+		for j := len(wb) - 1; j >= 0; j-- {
+			switch {
+			case wa[i] == wb[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var res []Change
+	i, j := 0, 0
+	for i < len(wa) && j < len(wb) {
+		switch {
+		case wa[i] == wb[j]:
+			res = append(res, Change{Op: OpEqual, Text: wa[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			res = append(res, Change{Op: OpDelete, Text: wa[i]})
+			i++
+		default:
+			res = append(res, Change{Op: OpInsert, Text: wb[j]})
+			j++
+		}
+	}
+	for ; i < len(wa); i++ {
+		res = append(res, Change{Op: OpDelete, Text: wa[i]})
+	}
+	for ; j < len(wb); j++ {
+		res = append(res, Change{Op: OpInsert, Text: wb[j]})
+	}
+	return merge(res)
+}
+
+// words splits text to words and whitespaces between them, so joined words make the original text
+func words(text string) (res []string) {
+	start, space := 0, false
+	for i, r := range text {
+		if i > start && unicode.IsSpace(r) != space {
+			res = append(res, text[start:i])
+			start = i
+		}
+		space = unicode.IsSpace(r)
+	}
+	if start < len(text) {
+		res = append(res, text[start:])
+	}
+	return res
+}
+
+// merge joins consecutive changes of the same type and drops empty ones
+func merge(changes []Change) []Change {
+	res := []Change{}
+	var sb strings.Builder
+	for i, c := range changes {
+		sb.WriteString(c.Text)
+		if i < len(changes)-1 && changes[i+1].Op == c.Op {
+			continue
+		}
+		if sb.Len() > 0 {
+			res = append(res, Change{Op: c.Op, Text: sb.String()})
+		}
+		sb.Reset()
+	}
+	return res
+}
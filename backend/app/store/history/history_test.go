@@ -0,0 +1,41 @@
+package history
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	tbl := []struct {
+		a, b string
+		res  []Change
+	}{
+		{"", "", []Change{}},
+		{"same text", "same text", []Change{{OpEqual, "same text"}}},
+		{"", "new text", []Change{{OpInsert, "new text"}}},
+		{"old text", "", []Change{{OpDelete, "old text"}}},
+		{"some bad words here", "some words here", []Change{{OpEqual, "some "}, {OpDelete, "bad "}, {OpEqual, "words here"}}},
+		{"some words", "some good words", []Change{{OpEqual, "some "}, {OpInsert, "good "}, {OpEqual, "words"}}},
+		{"first line\nsecond", "first line\nthird", []Change{{OpEqual, "first line\n"}, {OpDelete, "second"}, {OpInsert, "third"}}},
+		{"привет  мир", "привет мир", []Change{{OpEqual, "привет"}, {OpDelete, "  "}, {OpInsert, " "}, {OpEqual, "мир"}}},
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, tt.res, Diff(tt.a, tt.b), "case #%d", i)
+	}
+
+	long := strings.Repeat("word ", 3000)
+	assert.Equal(t, []Change{{OpDelete, long}, {OpInsert, long + "more"}}, Diff(long, long+"more"), "too long for diff")
+}
+
+func TestVersions(t *testing.T) {
+	assert.Equal(t, []Version{}, Versions(nil))
+
+	res := Versions([]Revision{{CommentID: "c1", Orig: "first"}, {CommentID: "c1", Orig: "first edit"}, {CommentID: "c1", Orig: "edit"}})
+	assert.Equal(t, 3, len(res))
+	assert.Nil(t, res[0].Changes)
+	assert.Equal(t, []Change{{OpEqual, "first"}, {OpInsert, " edit"}}, res[1].Changes)
+	assert.Equal(t, []Change{{OpDelete, "first "}, {OpEqual, "edit"}}, res[2].Changes)
+	assert.Equal(t, "edit", res[2].Orig)
+}
@@ -0,0 +1,88 @@
+// Package limiter restricts rate of events, i.e. comments posted by user, with sliding window limits.
+// Times of recent events kept in Store, in memory for a single instance or in redis shared by all instances.
+package limiter
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Store keeps times of recent events per key
+type Store interface {
+	// Take checks all limits and records event with id for keys of the limits if none exceeded, in one atomic step.
+	// Returns time to wait and index of the limit causing the wait if event not allowed, keep sets how long
+	// events of each key kept
+	Take(id string, now time.Time, limits []Limit, keep map[string]time.Duration) (wait time.Duration, exceeded int, err error)
+	// Remove drops event with id from keys
+	Remove(id string, keys []string) error
+}
+
+// Limit allows up to Max events of Key within Window. Limit with Max=1 sets min interval between events
+type Limit struct {
+	Name   string // name of the limit, used in errors
+	Key    string
+	Max    int
+	Window time.Duration
+}
+
+// Enabled checks if limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Key != "" && l.Max > 0 && l.Window > 0
+}
+
+// Event recorded by Take, can be cancelled if not happened after all
+type Event struct {
+	ID   string
+	Keys []string
+}
+
+// Limiter checks and records events against limits
+type Limiter struct {
+	Store Store
+}
+
+// Take records event if it is allowed by all limits. Otherwise nothing recorded and Take returns time to wait
+// until event allowed and the limit causing the wait. Check and record done atomically, so concurrent events
+// can't pass the limits together
+func (l *Limiter) Take(now time.Time, limits ...Limit) (ev Event, wait time.Duration, limit Limit, err error) {
+	enabled := make([]Limit, 0, len(limits))
+	keep := map[string]time.Duration{} // events of the key kept for the longest window of its limits
+	for _, lim := range limits {
+		if !lim.Enabled() {
+			continue
+		}
+		enabled = append(enabled, lim)
+		if lim.Window > keep[lim.Key] {
+			keep[lim.Key] = lim.Window
+		}
+	}
+	if len(enabled) == 0 {
+		return Event{}, 0, Limit{}, nil
+	}
+
+	ev = Event{ID: uuid.New().String(), Keys: make([]string, 0, len(keep))}
+	for k := range keep {
+		ev.Keys = append(ev.Keys, k)
+	}
+	sort.Strings(ev.Keys)
+
+	wait, exceeded, err := l.Store.Take(ev.ID, now, enabled, keep)
+	if err != nil {
+		return Event{}, 0, Limit{}, errors.Wrapf(err, "can't take event of %v", ev.Keys)
+	}
+	if wait > 0 {
+		return Event{}, wait, enabled[exceeded], nil
+	}
+	return ev, 0, Limit{}, nil
+}
+
+// Cancel removes event recorded by Take
+func (l *Limiter) Cancel(ev Event) error {
+	if ev.ID == "" {
+		return nil
+	}
+	return errors.Wrapf(l.Store.Remove(ev.ID, ev.Keys), "can't cancel event of %v", ev.Keys)
+}
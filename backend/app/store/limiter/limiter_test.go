@@ -0,0 +1,88 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_Take(t *testing.T) {
+	testLimiterTake(t, &Limiter{Store: NewMemStore()})
+}
+
+func TestLimiter_Cancel(t *testing.T) {
+	testLimiterCancel(t, &Limiter{Store: NewMemStore()})
+}
+
+// testLimiterTake checks limits with the store of l, shared by tests of all stores
+func testLimiterTake(t *testing.T, l *Limiter) {
+	interval := Limit{Name: "interval", Key: "u1", Max: 1, Window: 30 * time.Second}
+	perHour := Limit{Name: "site", Key: "u1", Max: 3, Window: time.Hour}
+	perPost := Limit{Name: "post", Key: "u1!!post1", Max: 2, Window: time.Hour}
+
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	ev, wait, _, err := l.Take(ts, interval, perHour, perPost)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait, "nothing posted yet")
+	assert.Equal(t, []string{"u1", "u1!!post1"}, ev.Keys)
+	assert.NotEmpty(t, ev.ID)
+
+	ev, wait, lim, err := l.Take(ts.Add(10*time.Second), interval, perHour, perPost)
+	require.NoError(t, err)
+	assert.Equal(t, 20*time.Second, wait)
+	assert.Equal(t, "interval", lim.Name)
+	assert.Equal(t, Event{}, ev, "nothing recorded")
+
+	_, wait, _, err = l.Take(ts.Add(time.Minute), interval, perHour, perPost)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+	_, wait, lim, err = l.Take(ts.Add(2*time.Minute), interval, perHour, perPost)
+	require.NoError(t, err)
+	assert.Equal(t, 58*time.Minute, wait, "two comments on the post within hour")
+	assert.Equal(t, "post", lim.Name)
+
+	_, wait, _, err = l.Take(ts.Add(2*time.Minute), interval, perHour)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait, "other post allowed")
+	_, wait, lim, err = l.Take(ts.Add(3*time.Minute), interval, perHour)
+	require.NoError(t, err)
+	assert.Equal(t, 57*time.Minute, wait, "three comments on the site within hour")
+	assert.Equal(t, "site", lim.Name)
+
+	_, wait, _, err = l.Take(ts.Add(time.Hour+time.Second), interval, perHour, perPost)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait, "the first comment out of window")
+
+	ev, wait, _, err = l.Take(ts, Limit{Key: "u1", Window: time.Hour}, Limit{Key: "u1", Max: 1})
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait, "disabled limits")
+	assert.Equal(t, Event{}, ev)
+}
+
+// testLimiterCancel checks cancelled event not counted with the store of l, shared by tests of all stores
+func testLimiterCancel(t *testing.T, l *Limiter) {
+	perHour := Limit{Name: "site", Key: "u1", Max: 2, Window: time.Hour}
+	perPost := Limit{Name: "post", Key: "u1!!post1", Max: 1, Window: time.Hour}
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	_, wait, _, err := l.Take(ts, perHour, perPost)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+	ev, wait, _, err := l.Take(ts.Add(time.Minute), perHour)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+	_, wait, _, err = l.Take(ts.Add(2*time.Minute), perHour)
+	require.NoError(t, err)
+	assert.Equal(t, 58*time.Minute, wait)
+
+	require.NoError(t, l.Cancel(ev))
+	_, wait, _, err = l.Take(ts.Add(2*time.Minute), perHour, perPost)
+	require.NoError(t, err)
+	assert.Equal(t, 58*time.Minute, wait, "post limit still reached")
+	assert.NoError(t, l.Cancel(Event{}), "empty event ignored")
+	_, wait, _, err = l.Take(ts.Add(2*time.Minute), perHour)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait, "cancelled event not counted")
+}
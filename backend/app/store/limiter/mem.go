@@ -0,0 +1,91 @@
+package limiter
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const memCleanupInterval = time.Minute
+
+// MemStore implements Store in memory, for a single instance. Thread safe
+type MemStore struct {
+	lock    sync.Mutex
+	events  map[string][]memEvent // events of the key, oldest first
+	expires map[string]time.Time  // time after which all events of the key are outdated
+	cleaned time.Time
+}
+
+type memEvent struct {
+	id string
+	ts time.Time
+}
+
+// NewMemStore makes empty in-memory store
+func NewMemStore() *MemStore {
+	return &MemStore{events: map[string][]memEvent{}, expires: map[string]time.Time{}}
+}
+
+// Take checks limits and records event for all keys in keep if none of limits exceeded.
+// Events of the key older than its keep dropped, outdated keys removed once in a while
+func (m *MemStore) Take(id string, now time.Time, limits []Limit, keep map[string]time.Duration) (wait time.Duration, exceeded int, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	exceeded = -1
+	for i, lim := range limits {
+		events := m.events[lim.Key]
+		since := now.Add(-lim.Window)
+		first := sort.Search(len(events), func(i int) bool { return events[i].ts.After(since) })
+		if len(events)-first < lim.Max {
+			continue
+		}
+		// allowed again when the oldest of Max last events leaves the window
+		if w := events[len(events)-lim.Max].ts.Sub(since); w > wait {
+			wait, exceeded = w, i
+		}
+	}
+	if wait > 0 {
+		return wait, exceeded, nil
+	}
+
+	for key, k := range keep {
+		events := m.events[key]
+		pos := sort.Search(len(events), func(i int) bool { return events[i].ts.After(now) })
+		events = append(events, memEvent{})
+		copy(events[pos+1:], events[pos:])
+		events[pos] = memEvent{id: id, ts: now}
+		first := sort.Search(len(events), func(i int) bool { return events[i].ts.After(now.Add(-k)) })
+		m.events[key] = events[first:]
+		if exp := now.Add(k); exp.After(m.expires[key]) {
+			m.expires[key] = exp
+		}
+	}
+
+	if now.Sub(m.cleaned) > memCleanupInterval {
+		for k, exp := range m.expires {
+			if exp.Before(now) {
+				delete(m.events, k)
+				delete(m.expires, k)
+			}
+		}
+		m.cleaned = now
+	}
+	return 0, -1, nil
+}
+
+// Remove drops event with id from keys
+func (m *MemStore) Remove(id string, keys []string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, key := range keys {
+		events := m.events[key]
+		for i, e := range events {
+			if e.id == id {
+				m.events[key] = append(events[:i:i], events[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package limiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemStore_Take(t *testing.T) {
+	m := NewMemStore()
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	lim := Limit{Key: "k1", Max: 2, Window: time.Hour}
+	keep := map[string]time.Duration{"k1": time.Hour}
+
+	for _, e := range []struct {
+		id string
+		ts time.Time
+	}{{"e2", ts.Add(time.Minute)}, {"e1", ts}} {
+		wait, exceeded, err := m.Take(e.id, e.ts, []Limit{lim}, keep)
+		require.NoError(t, err)
+		assert.Equal(t, time.Duration(0), wait)
+		assert.Equal(t, -1, exceeded)
+	}
+	assert.Equal(t, []memEvent{{"e1", ts}, {"e2", ts.Add(time.Minute)}}, m.events["k1"], "kept in order of time")
+
+	wait, exceeded, err := m.Take("e3", ts.Add(2*time.Minute), []Limit{{Key: "k2", Max: 5, Window: time.Hour}, lim}, keep)
+	require.NoError(t, err)
+	assert.Equal(t, 58*time.Minute, wait)
+	assert.Equal(t, 1, exceeded)
+
+	_, _, err = m.Take("e4", ts.Add(time.Minute), nil, map[string]time.Duration{"k2": time.Minute})
+	require.NoError(t, err)
+	_, _, err = m.Take("e5", ts.Add(time.Hour+30*time.Second), []Limit{lim}, keep)
+	require.NoError(t, err)
+	assert.Equal(t, []memEvent{{"e2", ts.Add(time.Minute)}, {"e5", ts.Add(time.Hour + 30*time.Second)}}, m.events["k1"],
+		"old event dropped")
+	_, ok := m.events["k2"]
+	assert.False(t, ok, "outdated key removed")
+
+	require.NoError(t, m.Remove("e2", []string{"k1", "unknown"}))
+	assert.Equal(t, []memEvent{{"e5", ts.Add(time.Hour + 30*time.Second)}}, m.events["k1"])
+}
+
+func TestMemStore_TakeConcurrent(t *testing.T) {
+	l := Limiter{Store: NewMemStore()}
+	lim := Limit{Key: "u1", Max: 3, Window: time.Hour}
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, wait, _, err := l.Take(ts, lim)
+			require.NoError(t, err)
+			if wait == 0 {
+				lock.Lock()
+				allowed++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, allowed)
+}
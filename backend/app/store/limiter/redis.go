@@ -0,0 +1,116 @@
+package limiter
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/pkg/errors"
+)
+
+const redisKeyPrefix = "remark42-limiter!!"
+
+// takeScript checks limits and records event in one step, so concurrent instances can't pass limits together.
+// Scores are times in microseconds, passed as strings to keep them exact.
+// KEYS - keys of events, ARGV - event id, now, number of limits n, then key index, max and window start
+// for each limit, then score to drop events up to and expiration in ms for each key.
+// Returns wait in microseconds and 0-based index of exceeded limit, or 0 and -1 if event recorded
+var takeScript = redis.NewScript(`
+local n = tonumber(ARGV[3])
+local wait, exceeded = 0, -1
+for i = 0, n - 1 do
+	local key = KEYS[tonumber(ARGV[4 + i * 3])]
+	local max = tonumber(ARGV[5 + i * 3])
+	local since = ARGV[6 + i * 3]
+	local events = redis.call('ZRANGEBYSCORE', key, '(' .. since, '+inf', 'WITHSCORES')
+	local count = #events / 2
+	if count >= max then
+		local w = tonumber(events[(count - max) * 2 + 2]) - tonumber(since)
+		if w > wait then
+			wait, exceeded = w, i
+		end
+	end
+end
+if exceeded >= 0 then
+	return {wait, exceeded}
+end
+for j, key in ipairs(KEYS) do
+	local arg = 3 + n * 3 + (j - 1) * 2
+	redis.call('ZADD', key, ARGV[2], ARGV[1])
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', ARGV[arg + 1])
+	redis.call('PEXPIRE', key, ARGV[arg + 2])
+end
+return {0, -1}
+`)
+
+// RedisStore implements Store with redis, shared by all instances. Events of the key kept in sorted set
+// scored by time in microseconds, the set expires with the last event
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore makes store with redis at addr and checks connection
+func NewRedisStore(addr string) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping().Err(); err != nil {
+		_ = client.Close()
+		return nil, errors.Wrapf(err, "can't connect to redis %s", addr)
+	}
+	return &RedisStore{client: client}, nil
+}
+
+// Take checks limits and records event for all keys in keep if none of limits exceeded, with single lua script
+func (r *RedisStore) Take(id string, now time.Time, limits []Limit, keep map[string]time.Duration) (wait time.Duration, exceeded int, err error) {
+	keys := make([]string, 0, len(keep))
+	for k := range keep {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	idx := map[string]int{}
+	redisKeys := make([]string, len(keys))
+	for i, k := range keys {
+		idx[k] = i + 1 // lua arrays are 1-based
+		redisKeys[i] = redisKeyPrefix + k
+	}
+
+	usec := func(t time.Time) string { return strconv.FormatInt(t.UnixNano()/int64(time.Microsecond), 10) }
+	args := []interface{}{id, usec(now), len(limits)}
+	for _, lim := range limits {
+		args = append(args, idx[lim.Key], lim.Max, usec(now.Add(-lim.Window)))
+	}
+	for _, k := range keys {
+		args = append(args, usec(now.Add(-keep[k])), keep[k].Milliseconds())
+	}
+
+	res, err := takeScript.Run(r.client, redisKeys, args...).Result()
+	if err != nil {
+		return 0, -1, errors.Wrapf(err, "can't take event of %v", keys)
+	}
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != 2 {
+		return 0, -1, errors.Errorf("unexpected result %v of %v", res, keys)
+	}
+	w, ok1 := vals[0].(int64)
+	e, ok2 := vals[1].(int64)
+	if !ok1 || !ok2 {
+		return 0, -1, errors.Errorf("unexpected result %v of %v", res, keys)
+	}
+	return time.Duration(w) * time.Microsecond, int(e), nil
+}
+
+// Remove drops event with id from keys
+func (r *RedisStore) Remove(id string, keys []string) error {
+	_, err := r.client.Pipelined(func(pipe redis.Pipeliner) error {
+		for _, k := range keys {
+			pipe.ZRem(redisKeyPrefix+k, id)
+		}
+		return nil
+	})
+	return errors.Wrapf(err, "can't remove event of %v", keys)
+}
+
+// Close connection to redis
+func (r *RedisStore) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,95 @@
+package limiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStore_Take(t *testing.T) {
+	l, _ := prepRedisLimiter(t)
+	testLimiterTake(t, l)
+}
+
+func TestRedisStore_Cancel(t *testing.T) {
+	l, _ := prepRedisLimiter(t)
+	testLimiterCancel(t, l)
+}
+
+func TestRedisStore_Keys(t *testing.T) {
+	l, mr := prepRedisLimiter(t)
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	perHour := Limit{Key: "u1", Max: 3, Window: time.Hour}
+	interval := Limit{Key: "u1", Max: 1, Window: time.Second}
+	perPost := Limit{Key: "u1!!post1", Max: 2, Window: 30 * time.Minute}
+
+	ev1, _, _, err := l.Take(ts, perHour, interval, perPost)
+	require.NoError(t, err)
+	ev2, _, _, err := l.Take(ts.Add(time.Hour), perHour, interval, perPost)
+	require.NoError(t, err)
+
+	members, err := mr.ZMembers(redisKeyPrefix + "u1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{ev2.ID}, members, "event out of the longest window dropped")
+	score, err := mr.ZScore(redisKeyPrefix+"u1", ev2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, float64(ts.Add(time.Hour).UnixNano()/1000), score, "scored by time in microseconds")
+	assert.Equal(t, time.Hour, mr.TTL(redisKeyPrefix+"u1"), "key kept for the longest window")
+	assert.Equal(t, 30*time.Minute, mr.TTL(redisKeyPrefix+"u1!!post1"))
+	assert.NotEqual(t, ev1.ID, ev2.ID)
+
+	mr.FastForward(time.Hour)
+	assert.False(t, mr.Exists(redisKeyPrefix+"u1"), "expired with the last event")
+}
+
+func TestRedisStore_TakeConcurrent(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	// separate stores act as different instances sharing redis
+	lim := Limit{Key: "u1", Max: 3, Window: time.Hour}
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		store, err := NewRedisStore(mr.Addr())
+		require.NoError(t, err)
+		defer store.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, wait, _, err := (&Limiter{Store: store}).Take(ts, lim)
+			assert.NoError(t, err)
+			if wait == 0 {
+				lock.Lock()
+				allowed++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, allowed)
+}
+
+func TestRedisStore_WrongAddress(t *testing.T) {
+	_, err := NewRedisStore("127.0.0.1:1")
+	assert.Error(t, err)
+}
+
+func prepRedisLimiter(t *testing.T) (*Limiter, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	store, err := NewRedisStore(mr.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, store.Close())
+		mr.Close()
+	})
+	return &Limiter{Store: store}, mr
+}
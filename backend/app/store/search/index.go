@@ -0,0 +1,263 @@
+// Package search provides full-text index of comments with stemming and phrase queries.
+// Index kept in bolt db, each site has own bucket with two nested buckets: "docs" keeps indexed comments
+// by comment id and "terms" keeps positions of each term in each comment, key is term\x00comment-id.
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// Index is full-text index of comments in bolt db
+type Index struct {
+	db *bolt.DB
+}
+
+// doc is an indexed comment
+type doc struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	PostTitle string    `json:"title,omitempty"`
+	UserID    string    `json:"user_id"`
+	UserName  string    `json:"user_name"`
+	Timestamp time.Time `json:"time"`
+	Text      string    `json:"text"` // plain text of the comment, kept for deleted comments too
+	Deleted   bool      `json:"deleted,omitempty"`
+	Pending   bool      `json:"pending,omitempty"`
+}
+
+const (
+	docsBucketName  = "docs"
+	termsBucketName = "terms"
+	termSeparator   = "\x00"
+)
+
+// NewIndex makes search index in fileName
+func NewIndex(fileName string, options bolt.Options) (*Index, error) {
+	db, err := bolt.Open(fileName, 0600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to make boltdb for %s", fileName)
+	}
+	return &Index{db: db}, nil
+}
+
+// Index adds comments to the index or updates already indexed ones.
+// Text of deleted comment is cleared by engine, so previously indexed text kept for it.
+func (idx *Index) Index(comments ...store.Comment) error {
+	return idx.db.Update(func(tx *bolt.Tx) error {
+		for _, c := range comments {
+			if c.Locator.SiteID == "" || c.ID == "" {
+				return errors.New("site id and comment id required for indexed comment")
+			}
+			docs, terms, err := siteBuckets(tx, c.Locator.SiteID)
+			if err != nil {
+				return err
+			}
+			old, found, err := getDoc(docs, c.ID)
+			if err != nil {
+				return err
+			}
+			if found && c.Deleted {
+				old.Deleted = true
+				if err = putDoc(docs, old); err != nil {
+					return err
+				}
+				continue
+			}
+			if found {
+				if err = removeTerms(terms, old); err != nil {
+					return err
+				}
+			}
+			d := doc{ID: c.ID, URL: c.Locator.URL, PostTitle: c.PostTitle, UserID: c.User.ID, UserName: c.User.Name,
+				Timestamp: c.Timestamp, Text: plainText(c.Text), Deleted: c.Deleted, Pending: c.Pending}
+			if err = addTerms(terms, d); err != nil {
+				return err
+			}
+			if err = putDoc(docs, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete comments from the index. Soft-deleted comments marked as deleted and can be found by admins,
+// hard-deleted comments removed completely
+func (idx *Index) Delete(siteID string, mode store.DeleteMode, ids ...string) error {
+	return idx.db.Update(func(tx *bolt.Tx) error {
+		docs, terms, err := siteBuckets(tx, siteID)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			d, found, err := getDoc(docs, id)
+			if err != nil {
+				return err
+			}
+			if !found {
+				continue
+			}
+			if err = deleteDoc(docs, terms, d, mode); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteUser deletes all comments of the user from the index, the same way as Delete
+func (idx *Index) DeleteUser(siteID, userID string, mode store.DeleteMode) error {
+	return idx.db.Update(func(tx *bolt.Tx) error {
+		docs, terms, err := siteBuckets(tx, siteID)
+		if err != nil {
+			return err
+		}
+		var userDocs []doc
+		err = docs.ForEach(func(k, v []byte) error {
+			d := doc{}
+			if e := json.Unmarshal(v, &d); e != nil {
+				return errors.Wrapf(e, "can't unmarshal indexed comment %s", string(k))
+			}
+			if d.UserID == userID {
+				userDocs = append(userDocs, d)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, d := range userDocs {
+			if err = deleteDoc(docs, terms, d, mode); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteSite removes all indexed comments of the site
+func (idx *Index) DeleteSite(siteID string) error {
+	return idx.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(siteID)) == nil {
+			return nil
+		}
+		return errors.Wrapf(tx.DeleteBucket([]byte(siteID)), "can't delete index of site %s", siteID)
+	})
+}
+
+// Count returns number of indexed comments of the site
+func (idx *Index) Count(siteID string) (count int, err error) {
+	err = idx.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(siteID))
+		if bkt == nil {
+			return nil
+		}
+		count = bkt.Bucket([]byte(docsBucketName)).Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+// Close bolt db
+func (idx *Index) Close() error {
+	return errors.Wrap(idx.db.Close(), "can't close search index")
+}
+
+// siteBuckets returns docs and terms buckets of the site, creates them if missing
+func siteBuckets(tx *bolt.Tx, siteID string) (docs, terms *bolt.Bucket, err error) {
+	site, err := tx.CreateBucketIfNotExists([]byte(siteID))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "can't make bucket for %s", siteID)
+	}
+	if docs, err = site.CreateBucketIfNotExists([]byte(docsBucketName)); err != nil {
+		return nil, nil, errors.Wrapf(err, "can't make docs bucket for %s", siteID)
+	}
+	if terms, err = site.CreateBucketIfNotExists([]byte(termsBucketName)); err != nil {
+		return nil, nil, errors.Wrapf(err, "can't make terms bucket for %s", siteID)
+	}
+	return docs, terms, nil
+}
+
+func getDoc(docs *bolt.Bucket, id string) (d doc, found bool, err error) {
+	data := docs.Get([]byte(id))
+	if data == nil {
+		return d, false, nil
+	}
+	if err = json.Unmarshal(data, &d); err != nil {
+		return d, false, errors.Wrapf(err, "can't unmarshal indexed comment %s", id)
+	}
+	return d, true, nil
+}
+
+func putDoc(docs *bolt.Bucket, d doc) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrapf(err, "can't marshal indexed comment %s", d.ID)
+	}
+	return errors.Wrapf(docs.Put([]byte(d.ID), data), "can't put indexed comment %s", d.ID)
+}
+
+func deleteDoc(docs, terms *bolt.Bucket, d doc, mode store.DeleteMode) error {
+	if mode == store.SoftDelete {
+		d.Deleted = true
+		return putDoc(docs, d)
+	}
+	if err := removeTerms(terms, d); err != nil {
+		return err
+	}
+	return errors.Wrapf(docs.Delete([]byte(d.ID)), "can't delete indexed comment %s", d.ID)
+}
+
+// addTerms puts positions of all terms of the doc
+func addTerms(terms *bolt.Bucket, d doc) error {
+	positions := map[string][]int{}
+	for _, t := range tokenize(d.Text) {
+		positions[t.term] = append(positions[t.term], t.pos)
+	}
+	for term, pp := range positions {
+		data, err := json.Marshal(pp)
+		if err != nil {
+			return errors.Wrapf(err, "can't marshal positions of %q", term)
+		}
+		if err = terms.Put(termKey(term, d.ID), data); err != nil {
+			return errors.Wrapf(err, "can't put term %q of %s", term, d.ID)
+		}
+	}
+	return nil
+}
+
+// removeTerms deletes positions of all terms of the doc
+func removeTerms(terms *bolt.Bucket, d doc) error {
+	for _, t := range tokenize(d.Text) {
+		if err := terms.Delete(termKey(t.term, d.ID)); err != nil {
+			return errors.Wrapf(err, "can't delete term %q of %s", t.term, d.ID)
+		}
+	}
+	return nil
+}
+
+// postings returns positions of the term in each comment containing it, comment id -> positions
+func postings(terms *bolt.Bucket, term string) (map[string][]int, error) {
+	res := map[string][]int{}
+	prefix := []byte(term + termSeparator)
+	c := terms.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		var pp []int
+		if err := json.Unmarshal(v, &pp); err != nil {
+			return nil, errors.Wrapf(err, "can't unmarshal positions of %s", string(k))
+		}
+		res[string(k[len(prefix):])] = pp
+	}
+	return res, nil
+}
+
+func termKey(term, id string) []byte {
+	return []byte(term + termSeparator + id)
+}
@@ -0,0 +1,189 @@
+package search
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+const testIndexDB = "/tmp/test-remark-search.db"
+
+func TestIndex_Search(t *testing.T) {
+	idx, teardown := prepIndex(t)
+	defer teardown()
+
+	res, err := idx.Search(Request{SiteID: "remark", Query: "running"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Total, "stemmed, run and running and runs")
+	require.Equal(t, 3, len(res.Hits))
+	assert.Equal(t, "c3", res.Hits[0].ID, "two matches")
+	assert.Equal(t, "c2", res.Hits[1].ID, "newer first")
+	assert.Equal(t, "c1", res.Hits[2].ID)
+	assert.Equal(t, "<mark>Running</mark> in the rain is fun", res.Hits[1].Snippet)
+	assert.Equal(t, "https://example.com/post2", res.Hits[1].URL)
+	assert.Equal(t, "user2", res.Hits[1].UserName)
+
+	res, err = idx.Search(Request{SiteID: "remark", Query: "run rain"})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Total, "all words required")
+	assert.Equal(t, "c2", res.Hits[0].ID)
+
+	res, err = idx.Search(Request{SiteID: "remark", Query: `"fast runner"`})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Total, "phrase")
+	assert.Equal(t, "c3", res.Hits[0].ID)
+	res, err = idx.Search(Request{SiteID: "remark", Query: `"runner fast"`})
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Total, "wrong order of phrase")
+	res, err = idx.Search(Request{SiteID: "remark", Query: `"rain is fun" running`})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Total, "phrase with stop word")
+	assert.Equal(t, "c2", res.Hits[0].ID)
+	res, err = idx.Search(Request{SiteID: "remark", Query: `"rain fun"`})
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Total, "stop word counted in phrase")
+
+	res, err = idx.Search(Request{SiteID: "remark", Query: "run", URL: "https://example.com/post1"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Total)
+	res, err = idx.Search(Request{SiteID: "remark", Query: "run", UserID: "u2"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Total)
+	res, err = idx.Search(Request{SiteID: "remark", Query: "run", ExcludeUsers: []string{"u2"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Total, "comments of excluded user")
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	res, err = idx.Search(Request{SiteID: "remark", Query: "run", From: ts.Add(time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Total)
+	res, err = idx.Search(Request{SiteID: "remark", Query: "run", To: ts.Add(time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Total)
+
+	res, err = idx.Search(Request{SiteID: "remark", Query: "run", Limit: 1, Skip: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Total)
+	require.Equal(t, 1, len(res.Hits))
+	assert.Equal(t, "c2", res.Hits[0].ID)
+	res, err = idx.Search(Request{SiteID: "remark", Query: "run", Skip: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Total)
+	assert.Equal(t, 0, len(res.Hits))
+
+	res, err = idx.Search(Request{SiteID: "remark", Query: "pending"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Total, "pending comment hidden")
+	res, err = idx.Search(Request{SiteID: "remark", Query: "pending", Admin: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Total, "pending comment found by admin")
+	assert.True(t, res.Hits[0].Pending)
+
+	res, err = idx.Search(Request{SiteID: "other", Query: "run"})
+	require.NoError(t, err)
+	assert.Equal(t, Result{Hits: []Hit{}}, res)
+	_, err = idx.Search(Request{SiteID: "remark", Query: " the \"\" "})
+	assert.EqualError(t, err, "empty search query")
+}
+
+func TestIndex_UpdateDelete(t *testing.T) {
+	idx, teardown := prepIndex(t)
+	defer teardown()
+
+	c := store.Comment{ID: "c1", Locator: store.Locator{SiteID: "remark", URL: "https://example.com/post1"},
+		Text: "<p>walking now</p>", User: store.User{ID: "u1"}}
+	require.NoError(t, idx.Index(c))
+	res, err := idx.Search(Request{SiteID: "remark", Query: "run"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Total, "old text of updated comment not found")
+	res, err = idx.Search(Request{SiteID: "remark", Query: "walk"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Total)
+
+	c.Deleted, c.Text = true, ""
+	require.NoError(t, idx.Index(c))
+	res, err = idx.Search(Request{SiteID: "remark", Query: "walk"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Total, "deleted comment hidden")
+	res, err = idx.Search(Request{SiteID: "remark", Query: "walk", Admin: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Total, "deleted comment text kept for admin")
+	assert.True(t, res.Hits[0].Deleted)
+	assert.Equal(t, "<mark>walking</mark> now", res.Hits[0].Snippet)
+
+	require.NoError(t, idx.Delete("remark", store.SoftDelete, "c2", "bad"))
+	res, err = idx.Search(Request{SiteID: "remark", Query: "run", Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Total)
+	res, err = idx.Search(Request{SiteID: "remark", Query: "run"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Total)
+
+	require.NoError(t, idx.Delete("remark", store.HardDelete, "c2"))
+	res, err = idx.Search(Request{SiteID: "remark", Query: "run", Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Total, "hard-deleted comment removed")
+
+	require.NoError(t, idx.DeleteUser("remark", "u1", store.SoftDelete))
+	res, err = idx.Search(Request{SiteID: "remark", Query: "run"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Total)
+	count, err := idx.Count("remark")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	require.NoError(t, idx.DeleteUser("remark", "u1", store.HardDelete))
+	count, err = idx.Count("remark")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "only pending comment of u3 left")
+
+	require.NoError(t, idx.DeleteSite("remark"))
+	require.NoError(t, idx.DeleteSite("remark"))
+	count, err = idx.Count("remark")
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	assert.EqualError(t, idx.Index(store.Comment{ID: "c1"}), "site id and comment id required for indexed comment")
+}
+
+func TestIndex_Snippet(t *testing.T) {
+	text := strings.Repeat("word ", 30) + "found <b>here</b> " + strings.Repeat("tail ", 60)
+	s := snippet(text, map[string]bool{"found": true, "here": true, "tail": true})
+	assert.True(t, strings.HasPrefix(s, "... word word"), s)
+	assert.Contains(t, s, "<mark>found</mark> &lt;b&gt;<mark>here</mark>&lt;/b&gt; <mark>tail</mark>")
+	assert.True(t, strings.HasSuffix(s, "<mark>tail</mark> ..."), s)
+	assert.True(t, len([]rune(s)) < 200+60*len("<mark></mark>"), s)
+
+	assert.Equal(t, "no match", snippet("no match", map[string]bool{"other": true}))
+	assert.Equal(t, "кириллица <mark>найдена</mark>", snippet("кириллица найдена", map[string]bool{"найдена": true}))
+}
+
+func prepIndex(t *testing.T) (idx *Index, teardown func()) {
+	_ = os.Remove(testIndexDB)
+	idx, err := NewIndex(testIndexDB, bolt.Options{})
+	require.NoError(t, err)
+
+	ts := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	post1 := store.Locator{SiteID: "remark", URL: "https://example.com/post1"}
+	post2 := store.Locator{SiteID: "remark", URL: "https://example.com/post2"}
+	err = idx.Index(
+		store.Comment{ID: "c1", Locator: post1, Text: "<p>I run every day</p>", Timestamp: ts,
+			User: store.User{ID: "u1", Name: "user1"}},
+		store.Comment{ID: "c2", Locator: post2, Text: "<p>Running in the rain is fun</p>", Timestamp: ts.Add(time.Minute),
+			User: store.User{ID: "u2", Name: "user2"}},
+		store.Comment{ID: "c3", Locator: post1, Text: "<p>The fast runner runs, never stops to run</p>",
+			Timestamp: ts.Add(-time.Minute), User: store.User{ID: "u1", Name: "user1"}},
+		store.Comment{ID: "c4", Locator: post1, Text: "<p>pending comment</p>", Timestamp: ts, Pending: true,
+			User: store.User{ID: "u3", Name: "user3"}},
+	)
+	require.NoError(t, err)
+	return idx, func() {
+		_ = idx.Close()
+		_ = os.Remove(testIndexDB)
+	}
+}
@@ -0,0 +1,322 @@
+package search
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Request is a search query with filters. Query is a list of words and "quoted phrases",
+// all of them should be in the comment
+type Request struct {
+	SiteID string
+	Query  string
+	URL    string    // comments of the post only
+	UserID string    // comments of the user only
+	From   time.Time // comments created at or after
+	To     time.Time // comments created before
+	Admin  bool      // include deleted and pending comments
+	Limit  int
+	Skip   int
+
+	ExcludeUsers []string // comments of these users not found
+}
+
+// Result of the search, page of hits and total number of found comments
+type Result struct {
+	Total int   `json:"total"`
+	Hits  []Hit `json:"hits"`
+}
+
+// Hit is a found comment with highlighted snippet of its text
+type Hit struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	PostTitle string    `json:"title,omitempty"`
+	UserID    string    `json:"user_id"`
+	UserName  string    `json:"user_name"`
+	Timestamp time.Time `json:"time"`
+	Snippet   string    `json:"snippet"` // html-escaped, matched words wrapped with <mark>
+	Deleted   bool      `json:"deleted,omitempty"`
+	Pending   bool      `json:"pending,omitempty"`
+	score     int
+}
+
+// ErrEmptyQuery returned for query without words to search, i.e. empty or with stop words only
+var ErrEmptyQuery = errors.New("empty search query")
+
+// clause is a single word or a phrase of the query, offsets are positions of terms relative to the first one
+type clause struct {
+	terms   []string
+	offsets []int
+}
+
+const (
+	defaultLimit   = 20
+	maxLimit       = 100
+	snippetLen     = 200 // max length of snippet in runes
+	snippetContext = 60  // number of runes before the first match in snippet
+)
+
+// Search comments matching request, sorted by relevance, i.e. number of matches, and then by time, newest first
+func (idx *Index) Search(req Request) (res Result, err error) {
+	clauses := parseQuery(req.Query)
+	if len(clauses) == 0 {
+		return Result{}, ErrEmptyQuery
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultLimit
+	}
+	if req.Limit > maxLimit {
+		req.Limit = maxLimit
+	}
+
+	res.Hits = []Hit{}
+	var docs []doc
+	err = idx.db.View(func(tx *bolt.Tx) error {
+		site := tx.Bucket([]byte(req.SiteID))
+		if site == nil {
+			return nil // nothing indexed for site
+		}
+		scores, e := match(site.Bucket([]byte(termsBucketName)), clauses)
+		if e != nil {
+			return e
+		}
+		docsBkt := site.Bucket([]byte(docsBucketName))
+		for id, score := range scores {
+			d, found, e := getDoc(docsBkt, id)
+			if e != nil {
+				return e
+			}
+			if !found || !req.accepts(d) {
+				continue
+			}
+			docs = append(docs, d)
+			res.Hits = append(res.Hits, Hit{ID: d.ID, URL: d.URL, PostTitle: d.PostTitle, UserID: d.UserID,
+				UserName: d.UserName, Timestamp: d.Timestamp, Deleted: d.Deleted, Pending: d.Pending, score: score})
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "can't search %q", req.Query)
+	}
+
+	texts := map[string]string{}
+	for _, d := range docs {
+		texts[d.ID] = d.Text
+	}
+	sort.Slice(res.Hits, func(i, j int) bool {
+		if res.Hits[i].score != res.Hits[j].score {
+			return res.Hits[i].score > res.Hits[j].score
+		}
+		return res.Hits[i].Timestamp.After(res.Hits[j].Timestamp)
+	})
+	res.Total = len(res.Hits)
+	if req.Skip >= len(res.Hits) {
+		res.Hits = []Hit{}
+		return res, nil
+	}
+	res.Hits = res.Hits[req.Skip:]
+	if len(res.Hits) > req.Limit {
+		res.Hits = res.Hits[:req.Limit]
+	}
+
+	highlight := map[string]bool{}
+	for _, c := range clauses {
+		for _, t := range c.terms {
+			highlight[t] = true
+		}
+	}
+	for i := range res.Hits {
+		res.Hits[i].Snippet = snippet(texts[res.Hits[i].ID], highlight)
+	}
+	return res, nil
+}
+
+// accepts checks if indexed comment matches filters of the request
+func (req Request) accepts(d doc) bool {
+	switch {
+	case (d.Deleted || d.Pending) && !req.Admin:
+		return false
+	case req.URL != "" && d.URL != req.URL:
+		return false
+	case req.UserID != "" && d.UserID != req.UserID:
+		return false
+	case contains(d.UserID, req.ExcludeUsers):
+		return false
+	case !req.From.IsZero() && d.Timestamp.Before(req.From):
+		return false
+	case !req.To.IsZero() && !d.Timestamp.Before(req.To):
+		return false
+	}
+	return true
+}
+
+// match finds comments with all clauses and returns them with total number of matches, comment id -> score
+func match(terms *bolt.Bucket, clauses []clause) (map[string]int, error) {
+	var res map[string]int
+	for _, c := range clauses {
+		found, err := matchClause(terms, c)
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			res = found
+			continue
+		}
+		for id, score := range res {
+			if n, ok := found[id]; ok {
+				res[id] = score + n
+				continue
+			}
+			delete(res, id)
+		}
+	}
+	return res, nil
+}
+
+// matchClause finds comments with all terms of the clause at given offsets from the first one.
+// Returns number of matches for each found comment
+func matchClause(terms *bolt.Bucket, c clause) (map[string]int, error) {
+	first, err := postings(terms, c.terms[0])
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]int{}
+	for id, pp := range first {
+		res[id] = len(pp)
+	}
+	if len(c.terms) == 1 {
+		return res, nil
+	}
+
+	// phrase, keep positions of the first term followed by all other terms at their offsets
+	starts := first
+	for i := 1; i < len(c.terms); i++ {
+		next, err := postings(terms, c.terms[i])
+		if err != nil {
+			return nil, err
+		}
+		for id, pp := range starts {
+			positions := map[int]bool{}
+			for _, p := range next[id] {
+				positions[p] = true
+			}
+			var kept []int
+			for _, p := range pp {
+				if positions[p+c.offsets[i]] {
+					kept = append(kept, p)
+				}
+			}
+			if len(kept) == 0 {
+				delete(starts, id)
+				delete(res, id)
+				continue
+			}
+			starts[id], res[id] = kept, len(kept)
+		}
+	}
+	return res, nil
+}
+
+// parseQuery splits query to words and quoted phrases, stop words dropped
+func parseQuery(query string) (res []clause) {
+	for i, part := range strings.Split(query, `"`) {
+		tokens := tokenize(part)
+		if len(tokens) == 0 {
+			continue
+		}
+		if i%2 == 0 { // outside of quotes, each word is a separate clause
+			for _, t := range tokens {
+				res = append(res, clause{terms: []string{t.term}, offsets: []int{0}})
+			}
+			continue
+		}
+		c := clause{}
+		for _, t := range tokens {
+			c.terms = append(c.terms, t.term)
+			c.offsets = append(c.offsets, t.pos-tokens[0].pos)
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// snippet makes html-escaped fragment of the text around the first highlighted term,
+// with all highlighted terms wrapped with <mark>
+func snippet(text string, highlight map[string]bool) string {
+	tokens := tokenize(text)
+	var marked []token
+	for _, t := range tokens {
+		if highlight[t.term] {
+			marked = append(marked, t)
+		}
+	}
+
+	start, end := 0, len(text)
+	if len(marked) > 0 && utf8.RuneCountInString(text[:marked[0].start]) > snippetContext {
+		start = wordStart(text, marked[0].start, snippetContext)
+	}
+	if utf8.RuneCountInString(text[start:]) > snippetLen {
+		end = wordEnd(text, start, snippetLen)
+	}
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("... ")
+	}
+	pos := start
+	for _, t := range marked {
+		if t.start < start || t.end > end {
+			continue
+		}
+		sb.WriteString(html.EscapeString(text[pos:t.start]))
+		sb.WriteString("<mark>" + html.EscapeString(text[t.start:t.end]) + "</mark>")
+		pos = t.end
+	}
+	sb.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		sb.WriteString(" ...")
+	}
+	return sb.String()
+}
+
+// wordStart returns offset of the word starting about n runes before offset
+func wordStart(text string, offset, n int) int {
+	start := offset
+	for i := 0; i < n && start > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	if sp := strings.IndexByte(text[start:offset], ' '); sp >= 0 {
+		return start + sp + 1
+	}
+	return start
+}
+
+// wordEnd returns offset of the end of the last whole word within n runes after start
+func wordEnd(text string, start, n int) int {
+	end := start
+	for i := 0; i < n && end < len(text); i++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	if sp := strings.LastIndexByte(text[start:end], ' '); sp > 0 {
+		return start + sp
+	}
+	return end
+}
+
+func contains(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
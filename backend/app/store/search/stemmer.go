@@ -0,0 +1,265 @@
+package search
+
+// stem reduces english word to its stem with Porter stemming algorithm,
+// see https://tartarus.org/martin/PorterStemmer/def.txt. Word expected to be in lower case,
+// words with anything but ascii letters and words shorter than 3 letters returned as is
+func stem(word string) string {
+	if len(word) < 3 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	s := stemmer{b: []byte(word)}
+	s.step1ab()
+	if len(s.b) > 1 {
+		s.step1c()
+		s.step2()
+		s.step3()
+		s.step4()
+		s.step5()
+	}
+	return string(s.b)
+}
+
+// stemmer keeps word in b, the end of the word is always the last byte of b,
+// j is the end of the stem, set by ends
+type stemmer struct {
+	b []byte
+	j int
+}
+
+// suffix with its replacement
+type rule struct {
+	suffix, repl string
+}
+
+// cons checks if b[i] is a consonant
+func (s *stemmer) cons(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !s.cons(i-1)
+	}
+	return true
+}
+
+// m measures number of consonant sequences in b[0..j], i.e. m of [C](VC){m}[V]
+func (s *stemmer) m() int {
+	n, i := 0, 0
+	for ; i <= s.j && s.cons(i); i++ {
+	}
+	for i <= s.j {
+		for ; i <= s.j && !s.cons(i); i++ {
+		}
+		if i > s.j {
+			return n
+		}
+		n++
+		for ; i <= s.j && s.cons(i); i++ {
+		}
+	}
+	return n
+}
+
+// vowelInStem checks if b[0..j] contains a vowel
+func (s *stemmer) vowelInStem() bool {
+	for i := 0; i <= s.j; i++ {
+		if !s.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleC checks if b[i-1..i] is a double consonant
+func (s *stemmer) doubleC(i int) bool {
+	return i >= 1 && s.b[i] == s.b[i-1] && s.cons(i)
+}
+
+// cvc checks if b[i-2..i] is consonant-vowel-consonant and the last consonant is not w, x or y
+func (s *stemmer) cvc(i int) bool {
+	if i < 2 || !s.cons(i) || s.cons(i-1) || !s.cons(i-2) {
+		return false
+	}
+	ch := s.b[i]
+	return ch != 'w' && ch != 'x' && ch != 'y'
+}
+
+// ends checks if the word ends with suffix and sets j to the end of the stem
+func (s *stemmer) ends(suffix string) bool {
+	if len(suffix) > len(s.b) || string(s.b[len(s.b)-len(suffix):]) != suffix {
+		return false
+	}
+	s.j = len(s.b) - len(suffix) - 1
+	return true
+}
+
+// setTo replaces b[j+1..] with str
+func (s *stemmer) setTo(str string) {
+	s.b = append(s.b[:s.j+1], str...)
+}
+
+// replace the first matched suffix of rules, if stem has m() > 0
+func (s *stemmer) replace(rules ...rule) {
+	for _, r := range rules {
+		if s.ends(r.suffix) {
+			if s.m() > 0 {
+				s.setTo(r.repl)
+			}
+			return
+		}
+	}
+}
+
+func (s *stemmer) last() byte {
+	return s.b[len(s.b)-1]
+}
+
+// step1ab gets rid of plurals and -ed or -ing
+func (s *stemmer) step1ab() {
+	if s.last() == 's' {
+		switch {
+		case s.ends("sses"):
+			s.b = s.b[:len(s.b)-2]
+		case s.ends("ies"):
+			s.setTo("i")
+		case s.b[len(s.b)-2] != 's':
+			s.b = s.b[:len(s.b)-1]
+		}
+	}
+	if s.ends("eed") {
+		if s.m() > 0 {
+			s.b = s.b[:len(s.b)-1]
+		}
+		return
+	}
+	if !(s.ends("ed") || s.ends("ing")) || !s.vowelInStem() {
+		return
+	}
+	s.b = s.b[:s.j+1]
+	switch {
+	case s.ends("at"):
+		s.setTo("ate")
+	case s.ends("bl"):
+		s.setTo("ble")
+	case s.ends("iz"):
+		s.setTo("ize")
+	case s.doubleC(len(s.b) - 1):
+		if ch := s.last(); ch != 'l' && ch != 's' && ch != 'z' {
+			s.b = s.b[:len(s.b)-1]
+		}
+	default:
+		s.j = len(s.b) - 1
+		if s.m() == 1 && s.cvc(len(s.b)-1) {
+			s.b = append(s.b, 'e')
+		}
+	}
+}
+
+// step1c turns terminal y to i when there is another vowel in the stem
+func (s *stemmer) step1c() {
+	if s.ends("y") && s.vowelInStem() {
+		s.b[len(s.b)-1] = 'i'
+	}
+}
+
+// step2 maps double suffixes to single ones
+func (s *stemmer) step2() {
+	switch s.b[len(s.b)-2] {
+	case 'a':
+		s.replace(rule{"ational", "ate"}, rule{"tional", "tion"})
+	case 'c':
+		s.replace(rule{"enci", "ence"}, rule{"anci", "ance"})
+	case 'e':
+		s.replace(rule{"izer", "ize"})
+	case 'l':
+		s.replace(rule{"bli", "ble"}, rule{"alli", "al"}, rule{"entli", "ent"}, rule{"eli", "e"}, rule{"ousli", "ous"})
+	case 'o':
+		s.replace(rule{"ization", "ize"}, rule{"ation", "ate"}, rule{"ator", "ate"})
+	case 's':
+		s.replace(rule{"alism", "al"}, rule{"iveness", "ive"}, rule{"fulness", "ful"}, rule{"ousness", "ous"})
+	case 't':
+		s.replace(rule{"aliti", "al"}, rule{"iviti", "ive"}, rule{"biliti", "ble"})
+	case 'g':
+		s.replace(rule{"logi", "log"})
+	}
+}
+
+// step3 deals with -ic-, -full, -ness etc.
+func (s *stemmer) step3() {
+	switch s.last() {
+	case 'e':
+		s.replace(rule{"icate", "ic"}, rule{"ative", ""}, rule{"alize", "al"})
+	case 'i':
+		s.replace(rule{"iciti", "ic"})
+	case 'l':
+		s.replace(rule{"ical", "ic"}, rule{"ful", ""})
+	case 's':
+		s.replace(rule{"ness", ""})
+	}
+}
+
+// step4 takes off -ant, -ence etc., in context <c>vcvc<v>
+func (s *stemmer) step4() {
+	var suffixes []string
+	switch s.b[len(s.b)-2] {
+	case 'a':
+		suffixes = []string{"al"}
+	case 'c':
+		suffixes = []string{"ance", "ence"}
+	case 'e':
+		suffixes = []string{"er"}
+	case 'i':
+		suffixes = []string{"ic"}
+	case 'l':
+		suffixes = []string{"able", "ible"}
+	case 'n':
+		suffixes = []string{"ant", "ement", "ment", "ent"}
+	case 'o':
+		if s.ends("ion") && s.j >= 0 && (s.b[s.j] == 's' || s.b[s.j] == 't') {
+			break
+		}
+		suffixes = []string{"ou"}
+	case 's':
+		suffixes = []string{"ism"}
+	case 't':
+		suffixes = []string{"ate", "iti"}
+	case 'u':
+		suffixes = []string{"ous"}
+	case 'v':
+		suffixes = []string{"ive"}
+	case 'z':
+		suffixes = []string{"ize"}
+	default:
+		return
+	}
+	matched := len(suffixes) == 0 // "ion" matched
+	for _, suffix := range suffixes {
+		if s.ends(suffix) {
+			matched = true
+			break
+		}
+	}
+	if matched && s.m() > 1 {
+		s.b = s.b[:s.j+1]
+	}
+}
+
+// step5 removes final -e if m() > 1, and changes -ll to -l if m() > 1
+func (s *stemmer) step5() {
+	k := len(s.b) - 1
+	s.j = k
+	if s.b[k] == 'e' {
+		if a := s.m(); a > 1 || a == 1 && !s.cvc(k-1) {
+			s.b = s.b[:k]
+		}
+		return
+	}
+	if s.b[k] == 'l' && s.doubleC(k) && s.m() > 1 {
+		s.b = s.b[:k]
+	}
+}
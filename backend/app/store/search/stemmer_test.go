@@ -0,0 +1,24 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStem(t *testing.T) {
+	tbl := []struct{ word, stem string }{
+		{"caresses", "caress"}, {"ponies", "poni"}, {"ties", "ti"}, {"caress", "caress"}, {"cats", "cat"},
+		{"feed", "feed"}, {"agreed", "agre"}, {"plastered", "plaster"}, {"bled", "bled"}, {"motoring", "motor"},
+		{"sing", "sing"}, {"conflated", "conflat"}, {"troubled", "troubl"}, {"sized", "size"}, {"hopping", "hop"},
+		{"tanned", "tan"}, {"falling", "fall"}, {"hissing", "hiss"}, {"fizzed", "fizz"}, {"failing", "fail"},
+		{"filing", "file"}, {"happy", "happi"}, {"sky", "sky"}, {"relational", "relat"}, {"conditional", "condit"},
+		{"rational", "ration"}, {"generalization", "gener"}, {"running", "run"}, {"searches", "search"},
+		{"connection", "connect"}, {"connected", "connect"}, {"connecting", "connect"}, {"adjustment", "adjust"},
+		{"controll", "control"}, {"roll", "roll"}, {"probate", "probat"}, {"rate", "rate"}, {"cease", "ceas"},
+		{"hopefulness", "hope"}, {"electrical", "electr"}, {"go", "go"}, {"go2go", "go2go"}, {"привет", "привет"},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.stem, stem(tt.word), tt.word)
+	}
+}
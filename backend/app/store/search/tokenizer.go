@@ -0,0 +1,79 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// token is a single indexed word of the text
+type token struct {
+	term       string // normalized word, lower-cased and stemmed
+	pos        int    // position of the word in the text, stop words counted too
+	start, end int    // byte offsets of the word in the text
+}
+
+const maxTermLen = 64 // longer words are not indexed
+
+var apostrophes = strings.NewReplacer("'", "", "’", "")
+
+// stopWords are not indexed and ignored in queries
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true, "by": true,
+	"for": true, "if": true, "in": true, "into": true, "is": true, "it": true, "no": true, "not": true, "of": true,
+	"on": true, "or": true, "such": true, "that": true, "the": true, "their": true, "then": true, "there": true,
+	"these": true, "they": true, "this": true, "to": true, "was": true, "will": true, "with": true,
+}
+
+// tokenize splits text to words, drops stop words and normalizes the rest to terms
+func tokenize(text string) (res []token) {
+	pos := 0
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		// possessive 's dropped, apostrophes inside of the word removed, i.e. user's -> user, don't -> dont
+		word := strings.TrimSuffix(strings.TrimSuffix(strings.Trim(text[start:end], "'’"), "'s"), "’s")
+		word = strings.ToLower(apostrophes.Replace(word))
+		if word != "" && !stopWords[word] && utf8.RuneCountInString(word) <= maxTermLen {
+			res = append(res, token{term: stem(word), pos: pos, start: start, end: end})
+		}
+		if word != "" {
+			pos++
+		}
+		start = -1
+	}
+	for i, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r):
+			if start < 0 {
+				start = i
+			}
+		case (r == '\'' || r == '’') && start >= 0:
+			// apostrophe inside of the word, i.e. don't or user's
+		default:
+			flush(i)
+		}
+	}
+	flush(len(text))
+	return res
+}
+
+// plainText extracts text from html of comment, text of block elements separated by spaces
+func plainText(text string) string {
+	var sb strings.Builder
+	z := html.NewTokenizer(strings.NewReader(text))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(sb.String()), " ")
+		case html.TextToken:
+			sb.Write(z.Text())
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			sb.WriteString(" ")
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("The user's Comments, don't   connect to привет-мир!")
+	assert.Equal(t, []token{
+		{term: "user", pos: 1, start: 4, end: 10},
+		{term: "comment", pos: 2, start: 11, end: 19},
+		{term: "dont", pos: 3, start: 21, end: 26},
+		{term: "connect", pos: 4, start: 29, end: 36},
+		{term: "привет", pos: 6, start: 40, end: 52},
+		{term: "мир", pos: 7, start: 53, end: 59},
+	}, tokens)
+	assert.Empty(t, tokenize("the, a ... and"))
+}
+
+func TestPlainText(t *testing.T) {
+	assert.Equal(t, "first para second & <third> link",
+		plainText("<p>first para</p><p>second &amp; &lt;third&gt;</p>\n<a href=\"http://example.com\">link</a>"))
+	assert.Equal(t, "", plainText(""))
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/crypt"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// CheckEncryption verifies all user details of the site can be decrypted, i.e. the key is set if details encrypted
+// and details encrypted with the current or one of old keys. Used on start to fail safely with the wrong key
+func (s *DataStore) CheckEncryption(siteID string) error {
+	details, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, Detail: engine.AllUserDetails})
+	if err != nil {
+		return errors.Wrapf(err, "can't get user details for %s", siteID)
+	}
+	for _, d := range details {
+		for detail, v := range d.Values() {
+			if _, err = s.Encryption.Crypter.Decrypt(v); err != nil {
+				return errors.Wrapf(err, "can't decrypt %s of user %s on site %s", detail, d.UserID, siteID)
+			}
+		}
+	}
+	return nil
+}
+
+// encryptDetail encrypts value of user detail if encryption enabled
+func (s *DataStore) encryptDetail(value string) (string, error) {
+	if s.Encryption.Crypter == nil {
+		return value, nil
+	}
+	res, err := s.Encryption.Crypter.Encrypt(value)
+	return res, errors.Wrap(err, "can't encrypt user detail")
+}
+
+// decryptDetail decrypts value of user detail, fails for encrypted value without key or with unknown key
+func (s *DataStore) decryptDetail(value string) (string, error) {
+	res, err := s.Encryption.Crypter.Decrypt(value)
+	return res, errors.Wrap(err, "can't decrypt user detail")
+}
+
+// importDetail encrypts imported value of user detail with the current key. Imported value can be plain, i.e. from backup
+// made before encryption enabled, or encrypted with old key
+func (s *DataStore) importDetail(value string) (string, error) {
+	if s.Encryption.Crypter.IsCurrent(value) {
+		return value, nil
+	}
+	plain, err := s.decryptDetail(value)
+	if err != nil {
+		return "", err
+	}
+	return s.encryptDetail(plain)
+}
+
+// encryptIP encrypts hash of ip deterministically, so hashes of the same ip still equal, if encryption of ips enabled
+func (s *DataStore) encryptIP(ipHash string) string {
+	if s.Encryption.Crypter == nil || !s.Encryption.IPs {
+		return ipHash
+	}
+	return s.Encryption.Crypter.EncryptDeterministic(ipHash)
+}
+
+// prepareIP hashes ip of new comment, or decrypts hash of ip encrypted before, i.e. in imported comment,
+// and encrypts the hash with the current key if encryption of ips enabled
+func (s *DataStore) prepareIP(ip, secret string) (string, error) {
+	if !crypt.IsEncrypted(ip) {
+		return s.encryptIP(store.HashValue(ip, secret)), nil
+	}
+	ipHash, err := s.Encryption.Crypter.Decrypt(ip)
+	if err != nil {
+		return "", errors.Wrap(err, "can't decrypt ip hash")
+	}
+	return s.encryptIP(ipHash), nil
+}
+
+// decryptIP returns hash of ip, encrypted value returned as is if it can't be decrypted
+func (s *DataStore) decryptIP(ip string) string {
+	if ipHash, err := s.Encryption.Crypter.Decrypt(ip); err == nil {
+		return ipHash
+	}
+	return ip
+}
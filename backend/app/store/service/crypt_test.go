@@ -0,0 +1,223 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/crypt"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestService_EncryptedUserDetails(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	crypter, err := crypt.New("encryption-key-123456")
+	require.NoError(t, err)
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	b.Encryption.Crypter = crypter
+
+	email, err := b.SetUserEmail("radio-t", "u1", "test@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "test@example.com", email)
+	digest, err := b.SetUserDigest("radio-t", "u1", store.DigestDaily)
+	require.NoError(t, err)
+	assert.Equal(t, store.DigestDaily, digest)
+
+	// stored encrypted
+	details, err := eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, Detail: engine.AllUserDetails})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(details))
+	assert.True(t, crypter.IsCurrent(details[0].Email), details[0].Email)
+	assert.True(t, crypter.IsCurrent(details[0].Digest), details[0].Digest)
+
+	email, err = b.GetUserEmail("radio-t", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "test@example.com", email)
+	digest, err = b.GetUserDigest("radio-t", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, store.DigestDaily, digest)
+	require.NoError(t, b.CheckEncryption("radio-t"))
+
+	// exported encrypted
+	umetas, _, err := b.Metas("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(umetas))
+	assert.Equal(t, details[0].Email, umetas[0].Details.Email)
+
+	// no key or wrong key
+	b.Encryption.Crypter = nil
+	_, err = b.GetUserEmail("radio-t", "u1")
+	assert.EqualError(t, err, "can't decrypt user detail: value encrypted, but no encryption key set")
+	assert.Error(t, b.CheckEncryption("radio-t"))
+	b.Encryption.Crypter, err = crypt.New("another-key-123456789")
+	require.NoError(t, err)
+	_, err = b.GetUserEmail("radio-t", "u1")
+	assert.Error(t, err)
+	err = b.CheckEncryption("radio-t")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "of user u1 on site radio-t")
+
+	// rotated key, old one still decrypts
+	b.Encryption.Crypter, err = crypt.New("another-key-123456789", "encryption-key-123456")
+	require.NoError(t, err)
+	email, err = b.GetUserEmail("radio-t", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "test@example.com", email)
+	require.NoError(t, b.CheckEncryption("radio-t"))
+}
+
+func TestService_CheckEncryptionAllDetails(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	crypter, err := crypt.New("encryption-key-123456")
+	require.NoError(t, err)
+	other, err := crypt.New("another-key-123456789")
+	require.NoError(t, err)
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	b.Encryption.Crypter = crypter
+
+	for _, detail := range []engine.UserDetail{engine.UserBio, engine.UserWebsite, engine.UserMuted} {
+		value, e := other.Encrypt("some value")
+		require.NoError(t, e)
+		_, err = eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u1",
+			Detail: detail, Update: value})
+		require.NoError(t, err)
+		err = b.CheckEncryption("radio-t")
+		require.Error(t, err, "wrong key of %s", detail)
+		assert.Contains(t, err.Error(), "can't decrypt "+string(detail)+" of user u1 on site radio-t")
+
+		value, err = crypter.Encrypt("some value")
+		require.NoError(t, err)
+		_, err = eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "u1",
+			Detail: detail, Update: value})
+		require.NoError(t, err)
+		require.NoError(t, b.CheckEncryption("radio-t"))
+	}
+}
+
+func TestService_ImportEncryptedUserDetails(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	old, err := crypt.New("encryption-key-123456")
+	require.NoError(t, err)
+	crypter, err := crypt.New("another-key-123456789", "encryption-key-123456")
+	require.NoError(t, err)
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	b.Encryption.Crypter = crypter
+
+	oldEmail, err := old.Encrypt("u2@example.com")
+	require.NoError(t, err)
+	umetas := []UserMetaData{
+		{ID: "u1", Details: engine.UserDetailEntry{UserID: "u1", Email: "u1@example.com"}}, // backup made before encryption
+		{ID: "u2", Details: engine.UserDetailEntry{UserID: "u2", Email: oldEmail}},         // backup made before rotation
+	}
+	require.NoError(t, b.SetMetas("radio-t", umetas, nil))
+	details, err := eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, Detail: engine.AllUserDetails})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(details))
+	for _, d := range details {
+		assert.True(t, crypter.IsCurrent(d.Email), "re-encrypted with the current key")
+		email, e := b.GetUserEmail("radio-t", d.UserID)
+		require.NoError(t, e)
+		assert.Equal(t, d.UserID+"@example.com", email)
+	}
+
+	// backup encrypted with unknown key
+	unknown, err := crypt.New("unknown-key-123456789")
+	require.NoError(t, err)
+	unknownEmail, err := unknown.Encrypt("u3@example.com")
+	require.NoError(t, err)
+	err = b.SetMetas("radio-t", []UserMetaData{{ID: "u3", Details: engine.UserDetailEntry{UserID: "u3", Email: unknownEmail}}}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't import email of u3")
+	email, err := b.GetUserEmail("radio-t", "u3")
+	require.NoError(t, err)
+	assert.Equal(t, "", email, "not imported")
+}
+
+func TestService_EncryptedIPs(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	crypter, err := crypt.New("encryption-key-123456")
+	require.NoError(t, err)
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), MaxVotes: -1}
+	b.RestrictSameIPVotes.Enabled = true
+	b.Encryption.Crypter, b.Encryption.IPs = crypter, true
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	id, err := b.Create(store.Comment{Text: "some text", Locator: locator, User: store.User{ID: "user1", Name: "user", IP: "127.0.0.1"}})
+	require.NoError(t, err)
+	c, err := eng.Get(engine.GetRequest{Locator: locator, CommentID: id})
+	require.NoError(t, err)
+	assert.True(t, crypter.IsCurrent(c.User.IP), c.User.IP)
+	ipHash, err := crypter.Decrypt(c.User.IP)
+	require.NoError(t, err)
+	assert.Equal(t, store.HashValue("127.0.0.1", "secret 123"), ipHash)
+
+	_, err = b.Vote(VoteReq{Locator: locator, CommentID: "id-2", UserID: "user2", UserIP: "123", Val: true})
+	require.NoError(t, err)
+	c, err = eng.Get(engine.GetRequest{Locator: locator, CommentID: "id-2"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(c.VotedIPs))
+	for k := range c.VotedIPs {
+		assert.True(t, strings.HasPrefix(k, "enc1d:"), k)
+	}
+
+	// the same ip matched with encrypted hash
+	_, err = b.Vote(VoteReq{Locator: locator, CommentID: "id-2", UserID: "user3", UserIP: "123", Val: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already voted for id-2")
+
+	// ips not encrypted if disabled
+	b.Encryption.IPs = false
+	id, err = b.Create(store.Comment{Text: "some text", Locator: locator, User: store.User{ID: "user1", Name: "user", IP: "127.0.0.1"}})
+	require.NoError(t, err)
+	c, err = eng.Get(engine.GetRequest{Locator: locator, CommentID: id})
+	require.NoError(t, err)
+	assert.Equal(t, store.HashValue("127.0.0.1", "secret 123"), c.User.IP)
+}
+
+func TestService_ImportEncryptedIPs(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	old, err := crypt.New("encryption-key-123456")
+	require.NoError(t, err)
+	crypter, err := crypt.New("another-key-123456789", "encryption-key-123456")
+	require.NoError(t, err)
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	b.Encryption.Crypter, b.Encryption.IPs = crypter, true
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	ipHash, votedHash := store.HashValue("127.0.0.1", "secret 123"), store.HashValue("127.0.0.2", "secret 123")
+	imported := store.Comment{ID: "imported", Text: "some text", Locator: locator, Imported: true,
+		User:     store.User{ID: "user1", Name: "user", IP: old.EncryptDeterministic(ipHash)},
+		VotedIPs: map[string]store.VotedIPInfo{old.EncryptDeterministic(votedHash): {Value: true}}}
+	_, err = b.Create(imported)
+	require.NoError(t, err)
+	c, err := eng.Get(engine.GetRequest{Locator: locator, CommentID: "imported"})
+	require.NoError(t, err)
+	assert.Equal(t, crypter.EncryptDeterministic(ipHash), c.User.IP, "not hashed again, re-encrypted with the current key")
+	_, found := c.VotedIPs[crypter.EncryptDeterministic(votedHash)]
+	assert.True(t, found, "voted ips re-encrypted")
+
+	// admin sees hash of ip
+	c, err = b.Get(locator, "imported", store.User{ID: "admin", Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, ipHash, c.User.IP)
+	c, err = b.Get(locator, "imported", store.User{ID: "user2"})
+	require.NoError(t, err)
+	assert.Equal(t, "", c.User.IP)
+
+	// ip encrypted with unknown key
+	unknown, err := crypt.New("unknown-key-123456789")
+	require.NoError(t, err)
+	imported.ID, imported.User.IP = "imported-2", unknown.EncryptDeterministic(ipHash)
+	_, err = b.Create(imported)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't decrypt ip hash")
+}
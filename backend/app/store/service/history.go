@@ -0,0 +1,88 @@
+package service
+
+import (
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/history"
+)
+
+// ErrHistoryDisabled returned by History if history store is not set
+var ErrHistoryDisabled = errors.New("comment history disabled")
+
+// History returns all revisions of the comment, oldest first, with changes between them.
+// Comment never edited has a single revision. History of deleted comment available for admin only,
+// of pending comment and comment of shadow blocked user for admin and author only
+func (s *DataStore) History(locator store.Locator, commentID string, user store.User) ([]history.Version, error) {
+	if s.HistoryStore == nil {
+		return nil, ErrHistoryDisabled
+	}
+	comment, err := s.Engine.Get(engine.GetRequest{Locator: locator, CommentID: commentID})
+	if err != nil {
+		return nil, err
+	}
+	if !user.Admin && (comment.Deleted || len(s.visibleComments([]store.Comment{comment}, user)) == 0) {
+		return nil, errors.Errorf("no access to history of %s", commentID)
+	}
+	revisions, err := s.HistoryStore.List(locator.SiteID, commentID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get history of %s", commentID)
+	}
+	if len(revisions) == 0 {
+		revisions = append(revisions, revision(comment, comment.User.ID))
+	}
+	return history.Versions(revisions), nil
+}
+
+// addRevisions stores the edited comment as a new revision, with the original comment on the first edit.
+// Errors logged only
+func (s *DataStore) addRevisions(orig, edited store.Comment, editorID string) {
+	if s.HistoryStore == nil {
+		return
+	}
+	revisions, err := s.HistoryStore.List(orig.Locator.SiteID, orig.ID)
+	if err != nil {
+		log.Printf("[WARN] can't get history of %s, %v", orig.ID, err)
+		return
+	}
+	var add []history.Revision
+	if len(revisions) == 0 {
+		add = append(add, revision(orig, orig.User.ID))
+	}
+	add = append(add, revision(edited, editorID))
+	if err = s.HistoryStore.Add(add...); err != nil {
+		log.Printf("[WARN] can't add revision of %s, %v", orig.ID, err)
+	}
+}
+
+// purgeHistory deletes revisions of hard-deleted comments, by comment id, all comments of the user or the site.
+// Soft-deleted comments keep history for admins. Errors logged only
+func (s *DataStore) purgeHistory(req engine.DeleteRequest) {
+	if s.HistoryStore == nil || req.DeleteMode != store.HardDelete && (req.CommentID != "" || req.UserID != "") {
+		return
+	}
+	var err error
+	switch {
+	case req.CommentID != "":
+		err = s.HistoryStore.Delete(req.Locator.SiteID, req.CommentID)
+	case req.UserID != "":
+		err = s.HistoryStore.DeleteUser(req.Locator.SiteID, req.UserID)
+	default:
+		err = s.HistoryStore.DeleteSite(req.Locator.SiteID)
+	}
+	if err != nil {
+		log.Printf("[WARN] can't delete comments history, %v", err)
+	}
+}
+
+// revision makes revision from the comment, time of the last edit or creation used
+func revision(c store.Comment, editorID string) history.Revision {
+	r := history.Revision{SiteID: c.Locator.SiteID, CommentID: c.ID, UserID: c.User.ID, EditorID: editorID,
+		Timestamp: c.Timestamp, Orig: c.Orig, Text: c.Text}
+	if c.Edit != nil {
+		r.Timestamp, r.Summary = c.Edit.Timestamp, c.Edit.Summary
+	}
+	return r
+}
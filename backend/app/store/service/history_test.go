@@ -0,0 +1,83 @@
+package service
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/history"
+)
+
+func TestService_History(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	historyFile := os.TempDir() + "/test-remark-service-history.db"
+	_ = os.Remove(historyFile)
+	defer os.Remove(historyFile)
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := b.History(locator, "id-1", store.User{})
+	assert.Equal(t, ErrHistoryDisabled, err)
+
+	b.HistoryStore, err = history.NewBoltStorage(historyFile, bolt.Options{})
+	require.NoError(t, err)
+
+	id, err := b.Create(store.Comment{Orig: "first text", Text: "<p>first text</p>", Locator: locator,
+		User: store.User{ID: "user2"}})
+	require.NoError(t, err)
+	res, err := b.History(locator, id, store.User{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res), "not edited comment has a single revision")
+	assert.Equal(t, "first text", res[0].Orig)
+	assert.Equal(t, "user2", res[0].EditorID)
+
+	_, err = b.EditComment(locator, id, EditRequest{Orig: "first edited text", Text: "<p>first edited text</p>", Summary: "fix"})
+	require.NoError(t, err)
+	_, err = b.EditComment(locator, id, EditRequest{Orig: "edited text", Text: "<p>edited text</p>", EditorID: "admin"})
+	require.NoError(t, err)
+
+	res, err = b.History(locator, id, store.User{})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res))
+	assert.Equal(t, "first text", res[0].Orig, "original text kept")
+	assert.Equal(t, "<p>first text</p>", res[0].Text)
+	assert.Equal(t, "user2", res[0].UserID)
+	assert.Nil(t, res[0].Changes)
+	assert.Equal(t, "fix", res[1].Summary)
+	assert.Equal(t, "user2", res[1].EditorID)
+	assert.Equal(t, []history.Change{{Op: history.OpEqual, Text: "first "}, {Op: history.OpInsert, Text: "edited "},
+		{Op: history.OpEqual, Text: "text"}}, res[1].Changes)
+	assert.Equal(t, "admin", res[2].EditorID)
+	assert.Equal(t, "user2", res[2].UserID)
+	assert.Equal(t, []history.Change{{Op: history.OpDelete, Text: "first "}, {Op: history.OpEqual, Text: "edited text"}},
+		res[2].Changes)
+
+	require.NoError(t, b.Delete(locator, id, store.SoftDelete))
+	_, err = b.History(locator, id, store.User{ID: "user2"})
+	assert.EqualError(t, err, "no access to history of "+id, "deleted comment history hidden")
+	res, err = b.History(locator, id, store.User{Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(res), "history of soft-deleted comment kept for admin")
+
+	require.NoError(t, b.Delete(locator, id, store.HardDelete))
+	revisions, err := b.HistoryStore.List("radio-t", id)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(revisions), "history purged on hard delete")
+
+	_, err = b.EditComment(locator, "id-1", EditRequest{Orig: "edited"})
+	require.NoError(t, err)
+	require.NoError(t, b.DeleteUser("radio-t", "user1", store.HardDelete))
+	revisions, err = b.HistoryStore.List("radio-t", "")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(revisions), "history of user purged on hard delete")
+
+	_, err = b.History(locator, "bad", store.User{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+const maxMutedUsers = 500
+
+// MutedUsers returns sorted ids of users muted by the user, empty list if nobody muted
+func (s *DataStore) MutedUsers(siteID, userID string) ([]string, error) {
+	res, err := s.Engine.UserDetail(engine.UserDetailRequest{
+		Detail:  engine.UserMuted,
+		Locator: store.Locator{SiteID: siteID},
+		UserID:  userID,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get muted users of %s", userID)
+	}
+	if len(res) != 1 || res[0].Muted == "" {
+		return []string{}, nil
+	}
+	muted, err := s.decryptDetail(res[0].Muted)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(muted, ","), nil
+}
+
+// Mute adds user to the list of users muted by the user, returns updated list
+func (s *DataStore) Mute(siteID, userID, mutedID string) ([]string, error) {
+	if mutedID == "" || strings.Contains(mutedID, ",") {
+		return nil, errors.Errorf("invalid muted user id %q", mutedID)
+	}
+	if mutedID == userID {
+		return nil, errors.Errorf("user %s can't mute self", userID)
+	}
+	return s.updateMuted(siteID, userID, func(muted []string) ([]string, error) {
+		if contains(mutedID, muted) {
+			return muted, nil
+		}
+		if len(muted) >= maxMutedUsers {
+			return nil, errors.Errorf("too many muted users, %d max", maxMutedUsers)
+		}
+		return append(muted, mutedID), nil
+	})
+}
+
+// Unmute removes user from the list of users muted by the user, returns updated list
+func (s *DataStore) Unmute(siteID, userID, mutedID string) ([]string, error) {
+	return s.updateMuted(siteID, userID, func(muted []string) ([]string, error) {
+		res := make([]string, 0, len(muted))
+		for _, m := range muted {
+			if m != mutedID {
+				res = append(res, m)
+			}
+		}
+		return res, nil
+	})
+}
+
+// updateMuted changes list of users muted by the user with fn and saves it, empty list removed
+func (s *DataStore) updateMuted(siteID, userID string, fn func(muted []string) ([]string, error)) ([]string, error) {
+	lock := s.getScopedLocks("muted!!" + siteID + "!!" + userID) // prevents lost update of concurrent changes
+	lock.Lock()
+	defer lock.Unlock()
+
+	muted, err := s.MutedUsers(siteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if muted, err = fn(muted); err != nil {
+		return nil, err
+	}
+	if len(muted) == 0 {
+		return muted, s.DeleteUserDetail(siteID, userID, engine.UserMuted)
+	}
+	sort.Strings(muted)
+	encrypted, err := s.encryptDetail(strings.Join(muted, ","))
+	if err != nil {
+		return nil, err
+	}
+	req := engine.UserDetailRequest{Detail: engine.UserMuted, Locator: store.Locator{SiteID: siteID}, UserID: userID, Update: encrypted}
+	if _, err = s.Engine.UserDetail(req); err != nil {
+		return nil, errors.Wrapf(err, "can't set muted users of %s", userID)
+	}
+	return muted, nil
+}
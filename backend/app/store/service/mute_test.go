@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestService_Mute(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	muted, err := b.MutedUsers("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, muted)
+
+	muted, err = b.Mute("radio-t", "user1", "user3")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user3"}, muted)
+	muted, err = b.Mute("radio-t", "user1", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user2", "user3"}, muted)
+	muted, err = b.Mute("radio-t", "user1", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user2", "user3"}, muted, "muted twice")
+
+	_, err = b.Mute("radio-t", "user1", "user1")
+	assert.EqualError(t, err, "user user1 can't mute self")
+	_, err = b.Mute("radio-t", "user1", "")
+	assert.Error(t, err)
+	_, err = b.Mute("radio-t", "user1", "user4,user5")
+	assert.Error(t, err)
+
+	muted, err = b.MutedUsers("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user2", "user3"}, muted)
+	muted, err = b.MutedUsers("radio-t", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, muted, "muted users of other user")
+
+	muted, err = b.Unmute("radio-t", "user1", "user3")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user2"}, muted)
+	muted, err = b.Unmute("radio-t", "user1", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, muted)
+	details, err := eng.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, Detail: engine.AllUserDetails})
+	require.NoError(t, err)
+	assert.Empty(t, details, "empty list removed")
+}
+
+func TestService_MuteLimit(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	for i := 0; i < maxMutedUsers; i++ {
+		_, err := b.Mute("radio-t", "user1", fmt.Sprintf("user-%d", i))
+		require.NoError(t, err)
+	}
+	_, err := b.Mute("radio-t", "user1", "one-more")
+	assert.EqualError(t, err, fmt.Sprintf("too many muted users, %d max", maxMutedUsers))
+	muted, err := b.Mute("radio-t", "user1", "user-1")
+	require.NoError(t, err, "already muted")
+	assert.Equal(t, maxMutedUsers, len(muted))
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+const (
+	maxBioLen      = 300 // in runes
+	maxWebsiteLen  = 256
+	userCommentsPg = 500 // comments of user read from engine at once, engine doesn't return more
+)
+
+// ProfileDetails are parts of user profile set by user
+type ProfileDetails struct {
+	Bio     string `json:"bio,omitempty"`
+	Website string `json:"website,omitempty"`
+}
+
+// UserProfile keeps info about user on the site, built from user's comments and profile details
+type UserProfile struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Picture  string          `json:"picture"`
+	Verified bool            `json:"verified"`
+	Joined   time.Time       `json:"joined"`   // time of the first comment
+	Count    int             `json:"count"`    // number of comments, deleted excluded
+	Score    int             `json:"score"`    // total score of comments
+	Recent   []store.Comment `json:"comments"` // recent comments, the newest first
+	ProfileDetails
+}
+
+// Profile returns profile of the user with up to limit recent comments. Name and picture taken from
+// the latest comment of the user, so user without visible comments has no profile
+func (s *DataStore) Profile(siteID, userID string, limit int, user store.User) (UserProfile, error) {
+	res := UserProfile{ID: userID, Recent: []store.Comment{}}
+	comments, err := s.allUserComments(siteID, userID)
+	if err != nil {
+		return res, err
+	}
+	comments = s.visibleComments(comments, user)
+	comments = engine.SortComments(comments, "-time")
+
+	for _, c := range comments {
+		if c.Deleted {
+			continue
+		}
+		if res.Count == 0 {
+			res.Name, res.Picture = c.User.Name, c.User.Picture
+		}
+		if limit <= 0 || len(res.Recent) < limit {
+			res.Recent = append(res.Recent, c)
+		}
+		res.Joined = c.Timestamp
+		res.Count++
+		res.Score += c.Score
+	}
+	if res.Count == 0 {
+		return res, errors.Errorf("no comments of user %s", userID)
+	}
+	res.Recent = s.alterComments(res.Recent, user)
+	res.Verified = s.IsVerified(siteID, userID)
+
+	details, err := s.GetUserProfile(siteID, userID)
+	if err != nil {
+		return res, err
+	}
+	res.ProfileDetails = details
+	return res, nil
+}
+
+// allUserComments returns all comments of the user, read from engine page by page
+func (s *DataStore) allUserComments(siteID, userID string) (comments []store.Comment, err error) {
+	for skip := 0; ; skip += userCommentsPg {
+		req := engine.FindRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
+			Limit: userCommentsPg, Skip: skip, Sort: "-time"}
+		page, e := s.Engine.Find(req)
+		if e != nil {
+			return nil, errors.Wrapf(e, "can't get comments of %s", userID)
+		}
+		comments = append(comments, page...)
+		if len(page) < userCommentsPg {
+			return comments, nil
+		}
+	}
+}
+
+// GetUserProfile gets profile details set by user
+func (s *DataStore) GetUserProfile(siteID, userID string) (res ProfileDetails, err error) {
+	for detail, dst := range map[engine.UserDetail]*string{engine.UserBio: &res.Bio, engine.UserWebsite: &res.Website} {
+		entries, e := s.Engine.UserDetail(engine.UserDetailRequest{Detail: detail, Locator: store.Locator{SiteID: siteID}, UserID: userID})
+		if e != nil {
+			return ProfileDetails{}, errors.Wrapf(e, "can't get %s of %s", detail, userID)
+		}
+		if len(entries) != 1 {
+			continue
+		}
+		value := entries[0].Bio
+		if detail == engine.UserWebsite {
+			value = entries[0].Website
+		}
+		if value == "" {
+			continue
+		}
+		if *dst, e = s.decryptDetail(value); e != nil {
+			return ProfileDetails{}, e
+		}
+	}
+	return res, nil
+}
+
+// SetUserProfile sanitizes and sets profile details of user, empty detail removed. Returns saved details
+func (s *DataStore) SetUserProfile(siteID, userID string, details ProfileDetails) (ProfileDetails, error) {
+	details, err := sanitizeProfile(details)
+	if err != nil {
+		return ProfileDetails{}, err
+	}
+	for detail, value := range map[engine.UserDetail]string{engine.UserBio: details.Bio, engine.UserWebsite: details.Website} {
+		if value == "" {
+			if err = s.DeleteUserDetail(siteID, userID, detail); err != nil {
+				return ProfileDetails{}, errors.Wrapf(err, "can't delete %s of %s", detail, userID)
+			}
+			continue
+		}
+		encrypted, e := s.encryptDetail(value)
+		if e != nil {
+			return ProfileDetails{}, e
+		}
+		req := engine.UserDetailRequest{Detail: detail, Locator: store.Locator{SiteID: siteID}, UserID: userID, Update: encrypted}
+		if _, e = s.Engine.UserDetail(req); e != nil {
+			return ProfileDetails{}, errors.Wrapf(e, "can't set %s of %s", detail, userID)
+		}
+	}
+	return details, nil
+}
+
+// sanitizeProfile strips html from bio and allows website links with http or https scheme only
+func sanitizeProfile(details ProfileDetails) (ProfileDetails, error) {
+	details.Bio = strings.TrimSpace(bluemonday.StrictPolicy().Sanitize(details.Bio))
+	if utf8.RuneCountInString(details.Bio) > maxBioLen {
+		return ProfileDetails{}, errors.Errorf("bio is too long, %d runes max", maxBioLen)
+	}
+
+	details.Website = strings.TrimSpace(details.Website)
+	if details.Website == "" {
+		return details, nil
+	}
+	if len(details.Website) > maxWebsiteLen {
+		return ProfileDetails{}, errors.Errorf("website is too long, %d bytes max", maxWebsiteLen)
+	}
+	u, err := url.Parse(details.Website)
+	if err != nil {
+		return ProfileDetails{}, errors.Wrapf(err, "can't parse website %q", details.Website)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return ProfileDetails{}, errors.Errorf("website %q is not http(s) link", details.Website)
+	}
+	details.Website = u.String()
+	return details, nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/limiter"
+)
+
+// RateLimits restrict posting of user, zero value disables the limit
+type RateLimits struct {
+	Interval time.Duration // min interval between comments of user on the site
+	PerPost  int           // max comments of user on a post per hour
+	PerSite  int           // max comments of user on the site per hour
+}
+
+// Enabled checks if any of limits set
+func (l RateLimits) Enabled() bool {
+	return l.Interval > 0 || l.PerPost > 0 || l.PerSite > 0
+}
+
+// RateLimitPolicy defines posting limits of the site. New users get their own, usually stricter, limits
+type RateLimitPolicy struct {
+	RateLimits
+	NewUsers    RateLimits    // limits of new users, used instead of regular limits
+	NewAge      time.Duration // user is new until this time passed since the first comment on the site
+	NewApproved int           // user is new until this number of approved comments on the site
+}
+
+// Enabled checks if any of limits set
+func (p RateLimitPolicy) Enabled() bool {
+	return p.RateLimits.Enabled() || p.NewUsers.Enabled()
+}
+
+// RateLimitError returned by Create if user posts too often
+type RateLimitError struct {
+	Limit      string // interval, post or site
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("too many comments, %s limit reached, retry after %v", e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+// limitRate checks posting limits of the comment and records it for the limits in one atomic step, so concurrent
+// comments of the user, even posted to different instances, can't pass the limits together. Returns function
+// to be called when creation finished, cancelling the record if comment wasn't created.
+// Returns RateLimitError if comment exceeds the limits
+func (s *DataStore) limitRate(comment store.Comment) (done func(created bool), err error) {
+	limits := s.rateLimits(comment)
+	if len(limits) == 0 {
+		return func(bool) {}, nil
+	}
+	ev, wait, lim, err := s.RateLimit.Limiter.Take(time.Now(), limits...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't check rate limit of %s", comment.User.ID)
+	}
+	if wait > 0 {
+		return nil, &RateLimitError{Limit: lim.Name, RetryAfter: wait}
+	}
+	return func(created bool) {
+		if created {
+			return
+		}
+		if e := s.RateLimit.Limiter.Cancel(ev); e != nil {
+			log.Printf("[WARN] can't cancel rate limit record of %s, %v", comment.User.ID, e)
+		}
+	}, nil
+}
+
+// rateLimits returns limits applied to the comment, nil if comment is not limited
+func (s *DataStore) rateLimits(comment store.Comment) []limiter.Limit {
+	siteID, userID := comment.Locator.SiteID, comment.User.ID
+	if s.RateLimit.Policy == nil || s.RateLimit.Limiter == nil || comment.Imported {
+		return nil
+	}
+	policy := s.RateLimit.Policy(siteID)
+	if !policy.Enabled() || comment.User.Admin || s.IsAdmin(siteID, userID) {
+		return nil
+	}
+	limits := policy.RateLimits
+	if policy.NewUsers.Enabled() && s.isNewUser(siteID, userID, policy) {
+		limits = policy.NewUsers
+	}
+	siteKey := siteID + "!!" + userID
+	return []limiter.Limit{
+		{Name: "interval", Key: siteKey, Max: 1, Window: limits.Interval},
+		{Name: "post", Key: siteKey + "!!" + comment.Locator.URL, Max: limits.PerPost, Window: time.Hour},
+		{Name: "site", Key: siteKey, Max: limits.PerSite, Window: time.Hour},
+	}
+}
+
+// isNewUser checks if the first comment of user is younger than NewAge or user has fewer than NewApproved comments.
+// Comments read page by page from the latest one, only till both old enough and approved comments found
+func (s *DataStore) isNewUser(siteID, userID string, policy RateLimitPolicy) bool {
+	if policy.NewAge <= 0 && policy.NewApproved <= 0 {
+		return false
+	}
+	count, err := s.Engine.Count(engine.FindRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID})
+	if err != nil || count == 0 || count < policy.NewApproved {
+		return true // no comments for user yet or not enough to be approved
+	}
+	old, approved := policy.NewAge <= 0, 0
+	for skip := 0; ; skip += userCommentsPg {
+		req := engine.FindRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
+			Limit: userCommentsPg, Skip: skip, Sort: "-time"}
+		page, e := s.Engine.Find(req)
+		if e != nil {
+			return true
+		}
+		for _, c := range page {
+			old = old || time.Since(c.Timestamp) >= policy.NewAge
+			if !c.Pending && !c.Deleted {
+				approved++
+			}
+			if old && approved >= policy.NewApproved {
+				return false
+			}
+		}
+		if len(page) < userCommentsPg {
+			return true
+		}
+	}
+}
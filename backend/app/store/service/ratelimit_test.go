@@ -0,0 +1,157 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/limiter"
+)
+
+func TestService_RateLimit(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	b.RateLimit.Policy = sitePolicy("radio-t", RateLimitPolicy{RateLimits: RateLimits{PerPost: 2, PerSite: 3}})
+	b.RateLimit.Limiter = &limiter.Limiter{Store: limiter.NewMemStore()}
+
+	create := func(url, userID string) error {
+		_, err := b.Create(store.Comment{Text: "text", Locator: store.Locator{URL: url, SiteID: "radio-t"},
+			User: store.User{ID: userID, Name: userID}})
+		return err
+	}
+
+	require.NoError(t, create("https://radio-t.com/1", "user1"))
+	require.NoError(t, create("https://radio-t.com/1", "user1"))
+	err := create("https://radio-t.com/1", "user1")
+	require.Error(t, err)
+	var rateErr *RateLimitError
+	require.True(t, errors.As(err, &rateErr))
+	assert.Equal(t, "post", rateErr.Limit)
+	assert.True(t, rateErr.RetryAfter > 59*time.Minute && rateErr.RetryAfter <= time.Hour, rateErr.RetryAfter)
+
+	require.NoError(t, create("https://radio-t.com/2", "user1"), "other post")
+	err = create("https://radio-t.com/3", "user1")
+	require.True(t, errors.As(err, &rateErr))
+	assert.Equal(t, "site", rateErr.Limit)
+
+	require.NoError(t, create("https://radio-t.com/1", "user2"), "other user")
+	_, err = b.Create(store.Comment{Text: "text", Locator: store.Locator{URL: "https://radio-t.com/1", SiteID: "radio-t"},
+		User: store.User{ID: "user1", Name: "user1"}, Imported: true})
+	assert.NoError(t, err, "imported comment not limited")
+	_, err = b.Create(store.Comment{Text: "text", Locator: store.Locator{URL: "https://radio-t.com/1", SiteID: "radio-t"},
+		User: store.User{ID: "admin", Name: "admin", Admin: true}})
+	assert.NoError(t, err, "admin not limited")
+	assert.Nil(t, b.rateLimits(store.Comment{Locator: store.Locator{URL: "https://radio-t.com/1", SiteID: "other"},
+		User: store.User{ID: "user1", Name: "user1"}}), "other site not limited")
+}
+
+func TestService_RateLimitInterval(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	b.RateLimit.Policy = sitePolicy("radio-t", RateLimitPolicy{RateLimits: RateLimits{Interval: 100 * time.Millisecond}})
+	b.RateLimit.Limiter = &limiter.Limiter{Store: limiter.NewMemStore()}
+
+	comment := store.Comment{Text: "text", Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"},
+		User: store.User{ID: "user1", Name: "user1"}}
+	_, err := b.Create(comment)
+	require.NoError(t, err)
+	_, err = b.Create(comment)
+	var rateErr *RateLimitError
+	require.True(t, errors.As(err, &rateErr))
+	assert.Equal(t, "interval", rateErr.Limit)
+	assert.True(t, rateErr.RetryAfter > 0 && rateErr.RetryAfter <= 100*time.Millisecond, rateErr.RetryAfter)
+
+	time.Sleep(rateErr.RetryAfter)
+	_, err = b.Create(comment)
+	assert.NoError(t, err, "allowed after interval")
+}
+
+func TestService_RateLimitNotCreated(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"),
+		RestrictedWordsMatcher: NewRestrictedWordsMatcher(StaticRestrictedWordsLister{Words: []string{"duck"}})}
+	b.RateLimit.Policy = sitePolicy("radio-t", RateLimitPolicy{RateLimits: RateLimits{PerSite: 1}})
+	b.RateLimit.Limiter = &limiter.Limiter{Store: limiter.NewMemStore()}
+
+	comment := store.Comment{Text: "duck", Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"},
+		User: store.User{ID: "user1", Name: "user1"}}
+	_, err := b.Create(comment)
+	assert.Equal(t, ErrRestrictedWordsFound, err)
+	comment.Text = "text"
+	_, err = b.Create(comment)
+	assert.NoError(t, err, "rejected comment not counted")
+	_, err = b.Create(comment)
+	var rateErr *RateLimitError
+	assert.True(t, errors.As(err, &rateErr))
+}
+
+func TestService_RateLimitNewUsers(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	policy := RateLimitPolicy{RateLimits: RateLimits{PerSite: 3}, NewUsers: RateLimits{PerSite: 1}, NewApproved: 2}
+	b.RateLimit.Policy = sitePolicy("radio-t", policy)
+	b.RateLimit.Limiter = &limiter.Limiter{Store: limiter.NewMemStore()}
+
+	assert.False(t, b.isNewUser("radio-t", "user1", policy), "two approved comments")
+	assert.True(t, b.isNewUser("radio-t", "user2", policy), "no comments")
+	policy.NewAge = 24 * time.Hour
+	assert.False(t, b.isNewUser("radio-t", "user1", policy), "the first comment in 2017")
+	policy.NewAge = 24 * time.Hour * 365 * 100
+	assert.True(t, b.isNewUser("radio-t", "user1", policy), "too young")
+	policy.NewAge, policy.NewApproved = 0, 3
+	assert.True(t, b.isNewUser("radio-t", "user1", policy), "not enough comments")
+
+	counting := &findCountingEngine{Interface: eng}
+	b.Engine = counting
+	policy.NewAge, policy.NewApproved = 24*time.Hour, 1
+	assert.False(t, b.isNewUser("radio-t", "user1", policy))
+	assert.Equal(t, 1, counting.finds, "the latest comments only read")
+	b.Engine = eng
+
+	create := func(userID string) error {
+		_, err := b.Create(store.Comment{Text: "text", Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"},
+			User: store.User{ID: userID, Name: userID}})
+		return err
+	}
+	require.NoError(t, create("user2"))
+	err := create("user2")
+	var rateErr *RateLimitError
+	require.True(t, errors.As(err, &rateErr), "new user limited")
+	assert.Equal(t, "site", rateErr.Limit)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, create("user1"))
+	}
+	assert.Error(t, create("user1"))
+}
+
+// sitePolicy returns policy of the site, other sites not limited
+func sitePolicy(site string, policy RateLimitPolicy) func(string) RateLimitPolicy {
+	return func(siteID string) RateLimitPolicy {
+		if siteID != site {
+			return RateLimitPolicy{}
+		}
+		return policy
+	}
+}
+
+// findCountingEngine counts calls of Find
+type findCountingEngine struct {
+	engine.Interface
+	finds int
+}
+
+func (e *findCountingEngine) Find(req engine.FindRequest) ([]store.Comment, error) {
+	e.finds++
+	return e.Interface.Find(req)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// ReactReq is the request to add or remove reaction to the comment
+type ReactReq struct {
+	Locator   store.Locator
+	CommentID string
+	UserID    string
+	Reaction  string
+	Remove    bool
+}
+
+// React adds user's reaction to the comment, or removes it with Remove set. Reactions don't change score,
+// user can add each reaction of the site once. Returns comment with counts and reactions of the user
+func (s *DataStore) React(req ReactReq) (comment store.Comment, err error) {
+	if !contains(req.Reaction, s.storeOptions(req.Locator.SiteID).Reactions) {
+		return comment, errors.Errorf("reaction %q not allowed for site %s", req.Reaction, req.Locator.SiteID)
+	}
+
+	cLock := s.getScopedLocks(req.Locator.URL) // get lock for URL scope
+	cLock.Lock()                               // prevents race on reactions and votes
+	defer cLock.Unlock()
+
+	comment, err = s.Engine.Get(engine.GetRequest{Locator: req.Locator, CommentID: req.CommentID})
+	if err != nil {
+		return comment, err
+	}
+	if comment.Deleted {
+		return comment, errors.Errorf("comment %s deleted", req.CommentID)
+	}
+
+	users := comment.ReactedBy[req.Reaction]
+	reacted := contains(req.UserID, users)
+	switch {
+	case req.Remove && !reacted:
+		return comment, errors.Errorf("user %s has no reaction %s to %s", req.UserID, req.Reaction, req.CommentID)
+	case req.Remove:
+		res := make([]string, 0, len(users)-1)
+		for _, u := range users {
+			if u != req.UserID {
+				res = append(res, u)
+			}
+		}
+		users = res
+	case reacted:
+		return comment, errors.Errorf("user %s already reacted %s to %s", req.UserID, req.Reaction, req.CommentID)
+	default:
+		users = append(users, req.UserID)
+	}
+
+	if comment.ReactedBy == nil {
+		comment.ReactedBy = map[string][]string{}
+	}
+	comment.ReactedBy[req.Reaction] = users
+	if len(users) == 0 {
+		delete(comment.ReactedBy, req.Reaction)
+	}
+	comment.Locator = req.Locator
+	if err = s.Engine.Update(comment); err != nil {
+		return comment, errors.Wrapf(err, "can't update reactions of %s", req.CommentID)
+	}
+	return prepReactions(comment, store.User{ID: req.UserID}), nil
+}
+
+// prepReactions counts reactions and sets reactions of the user for client view.
+// List of reacted users kept for admins only, it is the part of export
+func prepReactions(c store.Comment, user store.User) store.Comment {
+	c.Reactions, c.Reacted = nil, nil
+	for reaction, users := range c.ReactedBy {
+		if len(users) == 0 {
+			continue
+		}
+		if c.Reactions == nil {
+			c.Reactions = map[string]int{}
+		}
+		c.Reactions[reaction] = len(users)
+		if user.ID != "" && contains(user.ID, users) {
+			c.Reacted = append(c.Reacted, reaction)
+		}
+	}
+	sort.Strings(c.Reacted)
+
+	if !user.Admin {
+		c.ReactedBy = nil // hide list of reacted users
+	}
+	return c
+}
+
+func contains(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
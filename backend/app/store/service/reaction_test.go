@@ -0,0 +1,77 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestService_React(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), Reactions: []string{"👍", "😂"}}
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	req := ReactReq{Locator: locator, CommentID: "id-1", UserID: "user2", Reaction: "👍"}
+	comment, err := b.React(req)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"👍": 1}, comment.Reactions)
+	assert.Equal(t, []string{"👍"}, comment.Reacted)
+	assert.Nil(t, comment.ReactedBy, "reacted users hidden")
+
+	_, err = b.React(req)
+	assert.EqualError(t, err, "user user2 already reacted 👍 to id-1")
+
+	req.Reaction = "😂"
+	_, err = b.React(req)
+	require.NoError(t, err)
+	req.UserID = "user1"
+	comment, err = b.React(req)
+	require.NoError(t, err, "own comment reaction allowed")
+	assert.Equal(t, map[string]int{"👍": 1, "😂": 2}, comment.Reactions)
+	assert.Equal(t, []string{"😂"}, comment.Reacted)
+	assert.Equal(t, 0, comment.Score, "score not changed")
+
+	req.Reaction = "🔥"
+	_, err = b.React(req)
+	assert.EqualError(t, err, `reaction "🔥" not allowed for site radio-t`)
+
+	req.Reaction, req.Remove = "👍", true
+	_, err = b.React(req)
+	assert.EqualError(t, err, "user user1 has no reaction 👍 to id-1")
+	req.UserID = "user2"
+	comment, err = b.React(req)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"😂": 2}, comment.Reactions)
+	assert.Equal(t, []string{"😂"}, comment.Reacted)
+
+	req.CommentID = "bad"
+	_, err = b.React(req)
+	assert.Error(t, err)
+
+	comments, err := b.Find(locator, "time", store.User{ID: "user1"})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(comments))
+	assert.Equal(t, map[string]int{"😂": 2}, comments[0].Reactions)
+	assert.Equal(t, []string{"😂"}, comments[0].Reacted)
+	assert.Nil(t, comments[0].ReactedBy)
+	assert.Nil(t, comments[1].Reactions)
+
+	comments, err = b.Find(locator, "time", store.User{Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"😂": {"user2", "user1"}}, comments[0].ReactedBy, "admin sees reacted users")
+	assert.Nil(t, comments[0].Reacted)
+
+	raw, err := eng.Get(engine.GetRequest{Locator: locator, CommentID: "id-1"})
+	require.NoError(t, err)
+	assert.Nil(t, raw.Reactions, "counts not stored")
+
+	b.Reactions = nil
+	_, err = b.React(ReactReq{Locator: locator, CommentID: "id-1", UserID: "user3", Reaction: "😂"})
+	assert.EqualError(t, err, `reaction "😂" not allowed for site radio-t`, "reactions disabled")
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// ReportRequest is the input for Report
+type ReportRequest struct {
+	Locator   store.Locator
+	CommentID string
+	User      store.User
+	Reason    store.ReportReason
+	Text      string
+}
+
+// ReportedComment keeps comment with all reports for admin's review
+type ReportedComment struct {
+	Comment store.Comment  `json:"comment"`
+	Reports []store.Report `json:"reports"`
+}
+
+const maxReportTextLen = 1000
+
+// Report adds user's report to the comment, previous report of the same user replaced.
+// Comment hidden as pending admin review as soon as number of reports reaches site's threshold.
+// Returns reported comment and first flag set for the very first report of the comment.
+func (s *DataStore) Report(req ReportRequest) (comment store.Comment, first bool, err error) {
+	if !req.Reason.Valid() {
+		return comment, false, errors.Errorf("unknown report reason %q", req.Reason)
+	}
+	if utf8.RuneCountInString(req.Text) > maxReportTextLen {
+		return comment, false, errors.Errorf("report text is too long, max %d", maxReportTextLen)
+	}
+
+	cLock := s.getScopedLocks(req.Locator.URL) // get lock for URL scope
+	cLock.Lock()                               // prevents race on reports and hiding
+	defer cLock.Unlock()
+
+	comment, err = s.Engine.Get(engine.GetRequest{Locator: req.Locator, CommentID: req.CommentID})
+	if err != nil {
+		return comment, false, err
+	}
+	if comment.Deleted {
+		return comment, false, errors.Errorf("comment %s deleted", req.CommentID)
+	}
+	if comment.User.ID == req.User.ID {
+		return comment, false, errors.Errorf("user %s can not report his own comment %s", req.User.ID, req.CommentID)
+	}
+
+	prev, err := s.Engine.Report(engine.ReportRequest{Locator: req.Locator, CommentID: req.CommentID})
+	if err != nil {
+		return comment, false, errors.Wrapf(err, "can't get reports of %s", req.CommentID)
+	}
+	report := store.Report{Locator: comment.Locator, CommentID: comment.ID, UserID: req.User.ID, Reason: req.Reason,
+		Text: req.Text, Timestamp: time.Now()}
+	reports, err := s.Engine.Report(engine.ReportRequest{Locator: req.Locator, Update: &report})
+	if err != nil {
+		return comment, false, errors.Wrapf(err, "can't add report to %s", req.CommentID)
+	}
+
+	threshold := s.ReportThreshold[comment.Locator.SiteID]
+	if threshold > 0 && len(reports) >= threshold && !comment.Pending && !s.IsAdmin(comment.Locator.SiteID, comment.User.ID) {
+		log.Printf("[INFO] comment %s hidden after %d reports", comment.ID, len(reports))
+		comment.Pending = true
+		if err = s.Engine.Update(comment); err != nil {
+			return comment, false, errors.Wrapf(err, "can't hide reported comment %s", req.CommentID)
+		}
+		s.indexComments(comment)
+	}
+	return comment, len(prev) == 0, nil
+}
+
+// Reported gets reported comments with reports, sorted by number of reports, the most reported first.
+// Comments with the same number of reports sorted by the last report, recent first
+func (s *DataStore) Reported(siteID string, limit, skip int) ([]ReportedComment, error) {
+	reports, err := s.Engine.Report(engine.ReportRequest{Locator: store.Locator{SiteID: siteID}})
+	if err != nil {
+		return nil, err
+	}
+
+	byComment := map[string][]store.Report{}
+	for _, r := range reports {
+		byComment[r.CommentID] = append(byComment[r.CommentID], r)
+	}
+	grouped := make([][]store.Report, 0, len(byComment))
+	for _, rr := range byComment {
+		grouped = append(grouped, rr)
+	}
+	lastTS := func(rr []store.Report) (res time.Time) {
+		for _, r := range rr {
+			if r.Timestamp.After(res) {
+				res = r.Timestamp
+			}
+		}
+		return res
+	}
+	sort.Slice(grouped, func(i, j int) bool {
+		if len(grouped[i]) == len(grouped[j]) {
+			return lastTS(grouped[i]).After(lastTS(grouped[j]))
+		}
+		return len(grouped[i]) > len(grouped[j])
+	})
+
+	if skip >= len(grouped) {
+		return []ReportedComment{}, nil
+	}
+	grouped = grouped[skip:]
+	if limit > 0 && limit < len(grouped) {
+		grouped = grouped[:limit]
+	}
+
+	res := make([]ReportedComment, 0, len(grouped))
+	for _, rr := range grouped {
+		comment, e := s.Engine.Get(engine.GetRequest{Locator: rr[0].Locator, CommentID: rr[0].CommentID})
+		if e != nil {
+			log.Printf("[WARN] can't get reported comment %s, %v", rr[0].CommentID, e)
+			continue
+		}
+		res = append(res, ReportedComment{Comment: s.alterComment(comment, store.User{Admin: true}), Reports: rr})
+	}
+	return res, nil
+}
+
+// DismissReports removes all reports of the comment
+func (s *DataStore) DismissReports(locator store.Locator, commentID string) error {
+	return s.Engine.Delete(engine.DeleteRequest{Locator: locator, CommentID: commentID, Reports: true})
+}
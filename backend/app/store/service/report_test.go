@@ -0,0 +1,134 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestService_Report(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	req := ReportRequest{Locator: locator, CommentID: "id-1", User: store.User{ID: "user2"}, Reason: store.ReportSpam, Text: "ads"}
+	comment, first, err := b.Report(req)
+	require.NoError(t, err)
+	assert.True(t, first)
+	assert.Equal(t, "id-1", comment.ID)
+
+	req.Reason = store.ReportAbuse
+	_, first, err = b.Report(req)
+	require.NoError(t, err)
+	assert.False(t, first, "report of the same user replaced")
+
+	req.User.ID = "user3"
+	_, first, err = b.Report(req)
+	require.NoError(t, err)
+	assert.False(t, first)
+
+	req.User.ID = "user1"
+	_, _, err = b.Report(req)
+	assert.EqualError(t, err, "user user1 can not report his own comment id-1")
+
+	req.User.ID, req.Reason = "user2", "bad"
+	_, _, err = b.Report(req)
+	assert.EqualError(t, err, `unknown report reason "bad"`)
+
+	req.Reason, req.Text = store.ReportOther, strings.Repeat("x", 1001)
+	_, _, err = b.Report(req)
+	assert.EqualError(t, err, "report text is too long, max 1000")
+
+	req.Text, req.CommentID = "", "id-2"
+	_, _, err = b.Report(req)
+	require.NoError(t, err)
+
+	req.CommentID = "bad"
+	_, _, err = b.Report(req)
+	assert.Error(t, err)
+
+	comments, err := b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(comments), "no threshold, nothing hidden")
+
+	reported, err := b.Reported("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(reported))
+	assert.Equal(t, "id-1", reported[0].Comment.ID, "most reported first")
+	require.Equal(t, 2, len(reported[0].Reports))
+	assert.Equal(t, store.ReportAbuse, reported[0].Reports[0].Reason, "replaced report of user2")
+	assert.Equal(t, "user3", reported[0].Reports[1].UserID)
+	assert.Equal(t, "id-2", reported[1].Comment.ID)
+
+	reported, err = b.Reported("radio-t", 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(reported))
+	assert.Equal(t, "id-2", reported[0].Comment.ID)
+
+	reported, err = b.Reported("radio-t", 0, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(reported))
+
+	require.NoError(t, b.DismissReports(locator, "id-1"))
+	reported, err = b.Reported("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(reported))
+	assert.Equal(t, "id-2", reported[0].Comment.ID)
+
+	require.NoError(t, b.Delete(locator, "id-2", store.SoftDelete))
+	reported, err = b.Reported("radio-t", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(reported), "reports of deleted comment removed")
+
+	req.CommentID = "id-2"
+	_, _, err = b.Report(req)
+	assert.EqualError(t, err, "comment id-2 deleted")
+}
+
+func TestService_ReportThreshold(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"),
+		ReportThreshold: map[string]int{"radio-t": 2}}
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	req := ReportRequest{Locator: locator, CommentID: "id-1", User: store.User{ID: "user2"}, Reason: store.ReportSpam}
+	comment, _, err := b.Report(req)
+	require.NoError(t, err)
+	assert.False(t, comment.Pending)
+
+	req.User.ID = "user3"
+	comment, _, err = b.Report(req)
+	require.NoError(t, err)
+	assert.True(t, comment.Pending, "hidden after 2 reports")
+
+	comments, err := b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(comments), "hidden comment not visible")
+	assert.Equal(t, "id-2", comments[0].ID)
+
+	pending, err := b.Pending("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(pending), "hidden comment waits for review")
+	assert.Equal(t, "id-1", pending[0].ID)
+
+	_, err = b.Approve(locator, "id-1")
+	require.NoError(t, err)
+	comments, err = b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(comments), "approved comment visible again")
+	reported, err := b.Reported("radio-t", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(reported), "reports dismissed on approve")
+
+	// one more report doesn't hide approved comment
+	comment, _, err = b.Report(req)
+	require.NoError(t, err)
+	assert.False(t, comment.Pending)
+}
@@ -6,6 +6,8 @@ import (
 	"unicode/utf8"
 
 	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark42/backend/app/store/admin"
 )
 
 // RestrictedWordsLister provides restricted words in comments per site
@@ -23,6 +25,24 @@ func (l StaticRestrictedWordsLister) List(_ string) (restricted []string, err er
 	return l.Words, nil
 }
 
+// SettingsRestrictedWordsLister provides restricted words from settings of the site, global words if not set for the site
+type SettingsRestrictedWordsLister struct {
+	Settings admin.SettingsStore
+	Words    []string
+}
+
+// List provides restricted words in comments of the site
+func (l SettingsRestrictedWordsLister) List(siteID string) (restricted []string, err error) {
+	settings, err := l.Settings.Settings(siteID)
+	if err != nil {
+		return nil, err
+	}
+	if settings.RestrictedWords != nil {
+		return settings.RestrictedWords, nil
+	}
+	return l.Words, nil
+}
+
 // RestrictedWordsMatcher matches comment text against restricted words
 type RestrictedWordsMatcher struct {
 	lister RestrictedWordsLister
@@ -1,9 +1,13 @@
 package service
 
 import (
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store/admin"
 )
 
 func TestMatcher_Tokenize(t *testing.T) {
@@ -75,3 +79,19 @@ func TestMatcher_DoNotMatchIfNoRestrictedWords(t *testing.T) {
 	text := "What the duck it that?"
 	assert.False(t, matcher.Match("fakeID", text))
 }
+
+func TestMatcher_SettingsLister(t *testing.T) {
+	file := os.TempDir() + "/test-remark-settings-words.json"
+	defer os.Remove(file)
+	_ = os.Remove(file)
+	settings, err := admin.NewFileSettings(file)
+	require.NoError(t, err)
+	require.NoError(t, settings.SetSettings("site1", admin.Settings{RestrictedWords: []string{"quack"}}))
+	require.NoError(t, settings.SetSettings("site2", admin.Settings{RestrictedWords: []string{}}))
+
+	matcher := NewRestrictedWordsMatcher(SettingsRestrictedWordsLister{Settings: settings, Words: []string{"duck"}})
+	assert.True(t, matcher.Match("site1", "What the quack it that?"))
+	assert.False(t, matcher.Match("site1", "What the duck it that?"), "global words overridden")
+	assert.False(t, matcher.Match("site2", "What the duck it that?"), "global words overridden with empty list")
+	assert.True(t, matcher.Match("site3", "What the duck it that?"), "global words for site without settings")
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"strconv"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+const retentionPageSize = 100
+
+// RetentionPolicy defines how long personal data of the site kept, zero duration keeps data forever
+type RetentionPolicy struct {
+	VotedIPs time.Duration // drop hashes of voters' ips after this time since the vote
+	UserIP   time.Duration // clear hash of author's ip of comments older than this
+	Emails   time.Duration // delete emails of users without comments and subscriptions for this time
+	Deleted  time.Duration // hard-delete soft-deleted comments older than this, clears author's name, id and ip
+}
+
+// Enabled checks if any of retention rules set
+func (p RetentionPolicy) Enabled() bool {
+	return p.VotedIPs > 0 || p.UserIP > 0 || p.Emails > 0 || p.Deleted > 0
+}
+
+// RetentionReport counts data removed by retention policy of the site, or to be removed in dry mode
+type RetentionReport struct {
+	SiteID   string `json:"site"`
+	Dry      bool   `json:"dry"`
+	VotedIPs int    `json:"voted_ips"` // comments with voters' ips dropped
+	UserIPs  int    `json:"user_ips"`  // comments with author's ip cleared
+	Emails   int    `json:"emails"`    // users with email deleted
+	Deleted  int    `json:"deleted"`   // soft-deleted comments hard-deleted
+}
+
+// Changed checks if anything removed
+func (r RetentionReport) Changed() bool {
+	return r.VotedIPs > 0 || r.UserIPs > 0 || r.Emails > 0 || r.Deleted > 0
+}
+
+// Params returns counts of removed data as strings, i.e. for audit log
+func (r RetentionReport) Params() map[string]string {
+	return map[string]string{"voted_ips": strconv.Itoa(r.VotedIPs), "user_ips": strconv.Itoa(r.UserIPs),
+		"emails": strconv.Itoa(r.Emails), "deleted": strconv.Itoa(r.Deleted)}
+}
+
+// ApplyRetention removes personal data of the site kept longer than retention policy of the site allows.
+// In dry mode nothing removed, only counted
+func (s *DataStore) ApplyRetention(siteID string, dry bool) (RetentionReport, error) {
+	policy := s.Retention[siteID]
+	report := RetentionReport{SiteID: siteID, Dry: dry}
+	now := time.Now()
+
+	if policy.VotedIPs > 0 || policy.UserIP > 0 || policy.Deleted > 0 {
+		for skip := 0; ; skip += retentionPageSize {
+			posts, err := s.Engine.Info(engine.InfoRequest{Locator: store.Locator{SiteID: siteID}, Limit: retentionPageSize, Skip: skip})
+			if err != nil {
+				return report, errors.Wrapf(err, "can't get list of posts for %s", siteID)
+			}
+			for _, post := range posts {
+				comments, e := s.Engine.Find(engine.FindRequest{Locator: store.Locator{SiteID: siteID, URL: post.URL}, Sort: "time"})
+				if e != nil {
+					return report, errors.Wrapf(e, "can't get comments of %s", post.URL)
+				}
+				for _, c := range comments {
+					if e = s.retainComment(c, policy, now, dry, &report); e != nil {
+						return report, e
+					}
+				}
+			}
+			if len(posts) < retentionPageSize {
+				break
+			}
+		}
+	}
+
+	if policy.Emails > 0 {
+		if err := s.retainEmails(siteID, now.Add(-policy.Emails), dry, &report); err != nil {
+			return report, err
+		}
+	}
+
+	log.Printf("[INFO] retention of %s, dry %v, voted ips=%d, user ips=%d, emails=%d, deleted=%d",
+		siteID, dry, report.VotedIPs, report.UserIPs, report.Emails, report.Deleted)
+	return report, nil
+}
+
+// retainComment hard-deletes soft-deleted comment, or drops ips of the comment, if they are too old
+func (s *DataStore) retainComment(c store.Comment, policy RetentionPolicy, now time.Time, dry bool, report *RetentionReport) error {
+	if c.Deleted {
+		if policy.Deleted == 0 || c.User.ID == "deleted" || c.Timestamp.After(now.Add(-policy.Deleted)) {
+			return nil
+		}
+		report.Deleted++
+		if dry {
+			return nil
+		}
+		req := engine.DeleteRequest{Locator: c.Locator, CommentID: c.ID, DeleteMode: store.HardDelete}
+		return errors.Wrapf(s.delete(req), "can't hard-delete comment %s", c.ID)
+	}
+
+	changed := false
+	if policy.UserIP > 0 && c.User.IP != "" && c.Timestamp.Before(now.Add(-policy.UserIP)) {
+		c.User.IP = ""
+		report.UserIPs++
+		changed = true
+	}
+	if policy.VotedIPs > 0 && len(c.VotedIPs) > 0 {
+		votedIPs := make(map[string]store.VotedIPInfo, len(c.VotedIPs))
+		for ipHash, v := range c.VotedIPs {
+			if v.Timestamp.After(now.Add(-policy.VotedIPs)) {
+				votedIPs[ipHash] = v
+			}
+		}
+		if len(votedIPs) < len(c.VotedIPs) {
+			c.VotedIPs = votedIPs
+			report.VotedIPs++
+			changed = true
+		}
+	}
+	if !changed || dry {
+		return nil
+	}
+	return errors.Wrapf(s.Engine.Update(c), "can't update comment %s", c.ID)
+}
+
+// retainEmails deletes emails of users without comments and subscriptions after the time
+func (s *DataStore) retainEmails(siteID string, since time.Time, dry bool, report *RetentionReport) error {
+	details, err := s.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, Detail: engine.AllUserDetails})
+	if err != nil {
+		return errors.Wrapf(err, "can't get user details of %s", siteID)
+	}
+	for _, d := range details {
+		if d.Email == "" {
+			continue
+		}
+		active, e := s.activeSince(siteID, d.UserID, since)
+		if e != nil {
+			return e
+		}
+		if active {
+			continue
+		}
+		report.Emails++
+		if dry {
+			continue
+		}
+		req := engine.DeleteRequest{Locator: store.Locator{SiteID: siteID}, UserID: d.UserID, UserDetail: engine.UserEmail}
+		if e = s.Engine.Delete(req); e != nil {
+			return errors.Wrapf(e, "can't delete email of %s", d.UserID)
+		}
+	}
+	return nil
+}
+
+// activeSince checks if user subscribed or commented after the time
+func (s *DataStore) activeSince(siteID, userID string, since time.Time) (bool, error) {
+	subscriptions, err := s.Engine.Subscription(engine.SubscriptionRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID})
+	if err != nil {
+		return false, errors.Wrapf(err, "can't get subscriptions of %s", userID)
+	}
+	for _, sub := range subscriptions {
+		if sub.Timestamp.After(since) {
+			return true, nil
+		}
+	}
+	// error returned for user without comments
+	comments, err := s.Engine.Find(engine.FindRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, Sort: "-time", Limit: 1})
+	return err == nil && len(comments) > 0 && comments[0].Timestamp.After(since), nil
+}
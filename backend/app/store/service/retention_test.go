@@ -0,0 +1,97 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestService_ApplyRetention(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	day := 24 * time.Hour
+
+	// old comment with ips, soft-deleted comment and fresh comment
+	old := store.Comment{ID: "old", Text: "old text", Timestamp: time.Now().Add(-100 * day), Locator: locator,
+		User: store.User{ID: "user2", Name: "user2", IP: "ip-hash-2"}, VotedIPs: map[string]store.VotedIPInfo{
+			"ip-hash-old": {Timestamp: time.Now().Add(-90 * day), Value: true},
+			"ip-hash-new": {Timestamp: time.Now().Add(-time.Hour), Value: true}}}
+	fresh := store.Comment{ID: "fresh", Text: "fresh text", Timestamp: time.Now().Add(-time.Hour), Locator: locator,
+		User: store.User{ID: "user3", Name: "user3", IP: "ip-hash-3"}}
+	for _, c := range []store.Comment{old, fresh} {
+		_, err := eng.Create(c)
+		require.NoError(t, err)
+	}
+	require.NoError(t, eng.Delete(engine.DeleteRequest{Locator: locator, CommentID: "id-1", DeleteMode: store.SoftDelete}))
+
+	// emails of inactive user1 and user2, active user3 and user4 subscribed recently
+	for _, userID := range []string{"user1", "user2", "user3", "user4"} {
+		_, err := b.SetUserEmail("radio-t", userID, userID+"@example.com")
+		require.NoError(t, err)
+	}
+	_, err := eng.Subscription(engine.SubscriptionRequest{Locator: locator,
+		Update: &store.Subscription{Locator: locator, UserID: "user4", Timestamp: time.Now()}})
+	require.NoError(t, err)
+
+	report, err := b.ApplyRetention("radio-t", false)
+	require.NoError(t, err)
+	assert.Equal(t, RetentionReport{SiteID: "radio-t"}, report, "no policy for site")
+	assert.False(t, report.Changed())
+
+	b.Retention = map[string]RetentionPolicy{"radio-t": {VotedIPs: 30 * day, UserIP: 30 * day, Emails: 60 * day, Deleted: 7 * day}}
+	assert.True(t, b.Retention["radio-t"].Enabled())
+	report, err = b.ApplyRetention("radio-t", true)
+	require.NoError(t, err)
+	expected := RetentionReport{SiteID: "radio-t", Dry: true, VotedIPs: 1, UserIPs: 1, Emails: 2, Deleted: 1}
+	assert.Equal(t, expected, report)
+	c, err := eng.Get(engine.GetRequest{Locator: locator, CommentID: "old"})
+	require.NoError(t, err)
+	assert.Equal(t, "ip-hash-2", c.User.IP, "nothing changed in dry mode")
+	assert.Equal(t, 2, len(c.VotedIPs))
+
+	report, err = b.ApplyRetention("radio-t", false)
+	require.NoError(t, err)
+	expected.Dry = false
+	assert.Equal(t, expected, report)
+	assert.True(t, report.Changed())
+
+	c, err = eng.Get(engine.GetRequest{Locator: locator, CommentID: "old"})
+	require.NoError(t, err)
+	assert.Equal(t, store.User{ID: "user2", Name: "user2"}, c.User, "ip cleared")
+	assert.Equal(t, []string{"ip-hash-new"}, keys(c.VotedIPs), "old vote's ip dropped")
+	c, err = eng.Get(engine.GetRequest{Locator: locator, CommentID: "fresh"})
+	require.NoError(t, err)
+	assert.Equal(t, "ip-hash-3", c.User.IP, "fresh comment kept")
+	c, err = eng.Get(engine.GetRequest{Locator: locator, CommentID: "id-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "deleted", c.User.ID, "soft-deleted comment hard-deleted")
+	count, err := eng.Count(engine.FindRequest{Locator: locator})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	for userID, email := range map[string]string{"user1": "", "user2": "", "user3": "user3@example.com", "user4": "user4@example.com"} {
+		res, e := b.GetUserEmail("radio-t", userID)
+		require.NoError(t, e)
+		assert.Equal(t, email, res, userID)
+	}
+
+	// nothing left to remove
+	report, err = b.ApplyRetention("radio-t", false)
+	require.NoError(t, err)
+	assert.False(t, report.Changed())
+}
+
+func keys(m map[string]store.VotedIPInfo) (res []string) {
+	for k := range m {
+		res = append(res, k)
+	}
+	return res
+}
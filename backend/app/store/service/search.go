@@ -0,0 +1,105 @@
+package service
+
+import (
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/search"
+)
+
+// ErrSearchDisabled returned by Search if search index is not set
+var ErrSearchDisabled = errors.New("search disabled")
+
+// Search comments of the site. Deleted comments and comments of shadow blocked users found for admin only.
+// Pending comments not indexed until approved
+func (s *DataStore) Search(req search.Request) (search.Result, error) {
+	if s.SearchIndex == nil {
+		return search.Result{}, ErrSearchDisabled
+	}
+	if !req.Admin {
+		for userID := range s.shadowBlocked(req.SiteID) {
+			req.ExcludeUsers = append(req.ExcludeUsers, userID)
+		}
+	}
+	return s.SearchIndex.Search(req)
+}
+
+// ReindexSearch adds all approved comments of the site to search index, used to build index for existing comments.
+// Returns number of indexed comments
+func (s *DataStore) ReindexSearch(siteID string) (count int, err error) {
+	if s.SearchIndex == nil {
+		return 0, ErrSearchDisabled
+	}
+	posts, err := s.Engine.Info(engine.InfoRequest{Locator: store.Locator{SiteID: siteID}})
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't get posts of %s", siteID)
+	}
+	for _, post := range posts {
+		comments, e := s.Engine.Find(engine.FindRequest{Locator: store.Locator{SiteID: siteID, URL: post.URL}})
+		if e != nil {
+			return count, errors.Wrapf(e, "can't get comments of %s", post.URL)
+		}
+		approved := filterApproved(comments)
+		if e = s.SearchIndex.Index(approved...); e != nil {
+			return count, errors.Wrapf(e, "can't index comments of %s", post.URL)
+		}
+		count += len(approved)
+	}
+	return count, nil
+}
+
+// indexComments updates comments in search index, errors logged only.
+// Pending comments removed from the index, they indexed again once approved
+func (s *DataStore) indexComments(comments ...store.Comment) {
+	if s.SearchIndex == nil {
+		return
+	}
+	approved := filterApproved(comments)
+	if err := s.SearchIndex.Index(approved...); err != nil {
+		log.Printf("[WARN] can't update search index, %v", err)
+	}
+	if len(approved) == len(comments) {
+		return
+	}
+	for _, c := range comments {
+		if !c.Pending {
+			continue
+		}
+		if err := s.SearchIndex.Delete(c.Locator.SiteID, store.HardDelete, c.ID); err != nil {
+			log.Printf("[WARN] can't delete pending comment %s from search index, %v", c.ID, err)
+		}
+	}
+}
+
+// filterApproved returns comments without pending ones
+func filterApproved(comments []store.Comment) []store.Comment {
+	res := make([]store.Comment, 0, len(comments))
+	for _, c := range comments {
+		if !c.Pending {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// unindexComments deletes comments from search index in given mode, by comment id or all comments of the user.
+// Errors logged only
+func (s *DataStore) unindexComments(req engine.DeleteRequest) {
+	if s.SearchIndex == nil {
+		return
+	}
+	var err error
+	switch {
+	case req.CommentID != "":
+		err = s.SearchIndex.Delete(req.Locator.SiteID, req.DeleteMode, req.CommentID)
+	case req.UserID != "":
+		err = s.SearchIndex.DeleteUser(req.Locator.SiteID, req.UserID, req.DeleteMode)
+	default:
+		err = s.SearchIndex.DeleteSite(req.Locator.SiteID)
+	}
+	if err != nil {
+		log.Printf("[WARN] can't delete from search index, %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/search"
+)
+
+func TestService_Search(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	indexFile := os.TempDir() + "/test-remark-service-search.db"
+	_ = os.Remove(indexFile)
+	defer os.Remove(indexFile)
+	idx, err := search.NewIndex(indexFile, bolt.Options{})
+	require.NoError(t, err)
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123"), SearchIndex: idx}
+	defer b.Close()
+
+	count, err := b.ReindexSearch("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "comments of prepared engine indexed")
+	res, err := b.Search(search.Request{SiteID: "radio-t", Query: "link"})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Total)
+	assert.Equal(t, "id-1", res.Hits[0].ID)
+	assert.Equal(t, "some text, <mark>link</mark>", res.Hits[0].Snippet)
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	id, err := b.Create(store.Comment{Text: "searching for comments", Locator: locator, User: store.User{ID: "user2"}})
+	require.NoError(t, err)
+	res, err = b.Search(search.Request{SiteID: "radio-t", Query: "search comment"})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Total, "created comment indexed")
+	assert.Equal(t, id, res.Hits[0].ID)
+
+	b.Moderation.Sites = []string{"radio-t"}
+	pendingID, err := b.Create(store.Comment{Text: "pending comment", Locator: locator, User: store.User{ID: "user3"}})
+	require.NoError(t, err)
+	res, err = b.Search(search.Request{SiteID: "radio-t", Query: "pending", Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Total, "pending comment not indexed")
+	count, err = b.ReindexSearch("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count, "pending comment not reindexed")
+	_, err = b.Approve(locator, pendingID)
+	require.NoError(t, err)
+	res, err = b.Search(search.Request{SiteID: "radio-t", Query: "pending"})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Total, "approved comment indexed")
+	b.Moderation.Sites = nil
+
+	_, err = b.EditComment(locator, id, EditRequest{Text: "edited text"})
+	require.NoError(t, err)
+	res, err = b.Search(search.Request{SiteID: "radio-t", Query: "search"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Total, "edited comment reindexed")
+	res, err = b.Search(search.Request{SiteID: "radio-t", Query: "edit"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Total)
+
+	require.NoError(t, b.Delete(locator, id, store.SoftDelete))
+	res, err = b.Search(search.Request{SiteID: "radio-t", Query: "edit"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Total, "deleted comment hidden")
+	res, err = b.Search(search.Request{SiteID: "radio-t", Query: "edit", Admin: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Total, "deleted comment found by admin")
+	assert.True(t, res.Hits[0].Deleted)
+
+	require.NoError(t, b.DeleteUser("radio-t", "user1", store.HardDelete))
+	res, err = b.Search(search.Request{SiteID: "radio-t", Query: "text", Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Total, "hard-deleted comments of user1 removed")
+
+	require.NoError(t, b.DeleteAll("radio-t"))
+	res, err = b.Search(search.Request{SiteID: "radio-t", Query: "text", Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Total)
+
+	b.SearchIndex = nil
+	_, err = b.Search(search.Request{SiteID: "radio-t", Query: "text"})
+	assert.Equal(t, ErrSearchDisabled, err)
+	_, err = b.ReindexSearch("radio-t")
+	assert.Equal(t, ErrSearchDisabled, err)
+	require.NoError(t, idx.Close())
+}
@@ -3,6 +3,7 @@
 package service
 
 import (
+	"io"
 	"math"
 	"sort"
 	"strings"
@@ -17,8 +18,12 @@ import (
 
 	"github.com/umputun/remark42/backend/app/store"
 	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/crypt"
 	"github.com/umputun/remark42/backend/app/store/engine"
+	"github.com/umputun/remark42/backend/app/store/history"
 	"github.com/umputun/remark42/backend/app/store/image"
+	"github.com/umputun/remark42/backend/app/store/limiter"
+	"github.com/umputun/remark42/backend/app/store/search"
 )
 
 // DataStore wraps store.Interface with additional methods
@@ -28,14 +33,38 @@ type DataStore struct {
 	AdminStore          admin.Store
 	MaxCommentSize      int
 	MaxVotes            int
+	Reactions           []string // allowed reactions, empty to disable
 	RestrictSameIPVotes struct {
 		Enabled  bool
 		Duration time.Duration
 	}
+	Moderation struct {
+		Sites           []string // sites with pre-moderation, new comments held as pending until approved
+		ApproveVerified bool     // don't hold comments of verified users
+		ApproveAfter    int      // don't hold comments of users with this number of approved comments, 0 to disable
+	}
+	SpamFilter struct {
+		Checker   SpamChecker
+		Threshold float64 // comments with score from this value considered as spam
+		Reject    bool    // reject spam instead of holding it for review
+	}
+	ReportThreshold        map[string]int             // per site number of reports to hide comment pending review, 0 to disable
+	Retention              map[string]RetentionPolicy // per site retention of personal data, kept forever if not set
 	PositiveScore          bool
 	TitleExtractor         *TitleExtractor
 	RestrictedWordsMatcher *RestrictedWordsMatcher
 	ImageService           *image.Service
+	SearchIndex            *search.Index
+	HistoryStore           history.Store
+	SettingsStore          admin.SettingsStore // per-site overrides of options, global options used if not set
+	Encryption             struct {
+		Crypter *crypt.Crypter // encrypts user details, disabled if not set
+		IPs     bool           // encrypt hashes of ips with Crypter too
+	}
+	RateLimit struct {
+		Policy  func(siteID string) RateLimitPolicy // posting limits of users on the site, not limited if not set
+		Limiter *limiter.Limiter                    // keeps recent comments of users, shared by instances with redis store
+	}
 
 	// granular locks
 	scopedLocks struct {
@@ -48,6 +77,11 @@ type DataStore struct {
 		lcw.LoadingCache
 		once sync.Once
 	}
+
+	shadowCache struct {
+		lcw.LoadingCache
+		once sync.Once
+	}
 }
 
 // UserMetaData keeps info about user flags and details
@@ -57,6 +91,10 @@ type UserMetaData struct {
 		Status bool      `json:"status"`
 		Until  time.Time `json:"until"`
 	} `json:"blocked"`
+	ShadowBlocked struct {
+		Status bool      `json:"status"`
+		Until  time.Time `json:"until"`
+	} `json:"shadow_blocked"`
 	Verified bool                   `json:"verified"`
 	Details  engine.UserDetailEntry `json:"details,omitempty"`
 }
@@ -78,9 +116,19 @@ var nonAdminUser = store.User{}
 // ErrRestrictedWordsFound returned in case comment text contains restricted words
 var ErrRestrictedWordsFound = errors.New("comment contains restricted words")
 
+// ErrCommentNotFound returned by Get in case comment is hidden from the user,
+// i.e. pending comment or comment of shadow blocked user
+var ErrCommentNotFound = errors.New("comment not found")
+
 // Create prepares comment and forward to Interface.Create
 func (s *DataStore) Create(comment store.Comment) (commentID string, err error) {
 
+	done, err := s.limitRate(comment)
+	if err != nil {
+		return "", err
+	}
+	defer func() { done(err == nil) }()
+
 	if comment, err = s.prepareNewComment(comment); err != nil {
 		return "", errors.Wrap(err, "failed to prepare comment")
 	}
@@ -101,8 +149,24 @@ func (s *DataStore) Create(comment store.Comment) (commentID string, err error)
 		comment.PostTitle = title
 	}()
 
+	if !comment.Imported { // imported comments keep moderation status and not checked for spam
+		comment.Pending = s.needsApproval(comment)
+		if err = s.checkSpam(&comment); err != nil {
+			return "", err
+		}
+	}
+
 	commentID, err = s.Engine.Create(comment)
 	s.submitImages(comment)
+	if err == nil {
+		s.indexComments(comment)
+	}
+	if err == nil && !comment.Pending && !comment.Deleted {
+		s.updateShadowCount(comment, 1)
+	}
+	if err == nil && !comment.Imported && !comment.Pending {
+		s.trainSpamTrusted(comment)
+	}
 
 	if e := s.AdminStore.OnEvent(comment.Locator.SiteID, admin.EvCreate); e != nil {
 		log.Printf("[WARN] failed to send create event, %s", e)
@@ -141,22 +205,29 @@ func (s *DataStore) FindSince(locator store.Locator, sortMethod string, user sto
 		comments = engine.SortComments(comments, sortMethod)
 	}
 
-	return comments, nil
+	return s.visibleComments(comments, user), nil
 }
 
-// Get comment by ID
+// Get comment by ID. Pending comment and comment of shadow blocked user returned to admins and the author only
 func (s *DataStore) Get(locator store.Locator, commentID string, user store.User) (store.Comment, error) {
 	c, err := s.Engine.Get(engine.GetRequest{Locator: locator, CommentID: commentID})
 	if err != nil {
 		return store.Comment{}, err
 	}
+	if len(s.visibleComments([]store.Comment{c}, user)) == 0 {
+		return store.Comment{}, errors.Wrapf(ErrCommentNotFound, "can't get comment %s", commentID)
+	}
 	return s.alterComment(c, user), nil
 }
 
 // Put updates comment, mutable parts only
 func (s *DataStore) Put(locator store.Locator, comment store.Comment) error {
 	comment.Locator = locator
-	return s.Engine.Update(comment)
+	if err := s.Engine.Update(comment); err != nil {
+		return err
+	}
+	s.indexComments(comment)
+	return nil
 }
 
 // GetUserEmail gets user email
@@ -170,24 +241,73 @@ func (s *DataStore) GetUserEmail(siteID, userID string) (string, error) {
 		return "", err
 	}
 	if len(res) == 1 {
-		return res[0].Email, nil
+		return s.decryptDetail(res[0].Email)
 	}
 	return "", nil
 }
 
 // SetUserEmail sets user email
 func (s *DataStore) SetUserEmail(siteID, userID, value string) (string, error) {
+	encrypted, err := s.encryptDetail(value)
+	if err != nil {
+		return "", err
+	}
 	res, err := s.Engine.UserDetail(engine.UserDetailRequest{
 		Detail:  engine.UserEmail,
 		Locator: store.Locator{SiteID: siteID},
 		UserID:  userID,
-		Update:  value,
+		Update:  encrypted,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(res) == 1 {
+		return s.decryptDetail(res[0].Email)
+	}
+	return "", nil
+}
+
+// GetUserDigest gets delivery mode of user's email notifications, immediate if not set
+func (s *DataStore) GetUserDigest(siteID, userID string) (store.DigestMode, error) {
+	res, err := s.Engine.UserDetail(engine.UserDetailRequest{
+		Detail:  engine.UserDigest,
+		Locator: store.Locator{SiteID: siteID},
+		UserID:  userID,
+	})
+	if err != nil {
+		return store.DigestImmediate, err
+	}
+	if len(res) == 1 && res[0].Digest != "" {
+		digest, e := s.decryptDetail(res[0].Digest)
+		return store.DigestMode(digest), e
+	}
+	return store.DigestImmediate, nil
+}
+
+// SetUserDigest sets delivery mode of user's email notifications
+func (s *DataStore) SetUserDigest(siteID, userID string, mode store.DigestMode) (store.DigestMode, error) {
+	if !mode.Valid() {
+		return "", errors.Errorf("unsupported digest mode %q", mode)
+	}
+	if mode == store.DigestImmediate { // default mode, no need to keep it
+		return mode, s.DeleteUserDetail(siteID, userID, engine.UserDigest)
+	}
+	encrypted, err := s.encryptDetail(string(mode))
+	if err != nil {
+		return "", err
+	}
+	res, err := s.Engine.UserDetail(engine.UserDetailRequest{
+		Detail:  engine.UserDigest,
+		Locator: store.Locator{SiteID: siteID},
+		UserID:  userID,
+		Update:  encrypted,
 	})
 	if err != nil {
 		return "", err
 	}
 	if len(res) == 1 {
-		return res[0].Email, nil
+		digest, e := s.decryptDetail(res[0].Digest)
+		return store.DigestMode(digest), e
 	}
 	return "", nil
 }
@@ -269,20 +389,35 @@ func (s *DataStore) prepareNewComment(comment store.Comment) (store.Comment, err
 	if comment.Votes == nil {
 		comment.Votes = make(map[string]bool)
 	}
+	// counts of reactions made on read from the list of reacted users, imported comment can have them
+	comment.Reactions, comment.Reacted = nil, nil
 	comment.Sanitize() // clear potentially dangerous js from all parts of comment
 
 	secret, err := s.getSecret(comment.Locator.SiteID)
 	if err != nil {
 		return store.Comment{}, errors.Wrapf(err, "can't get secret for site %s", comment.Locator.SiteID)
 	}
-	comment.User.HashIP(secret) // replace ip by hash
+	// replace ip by hash, imported comment can have hash encrypted already
+	if comment.User.IP, err = s.prepareIP(comment.User.IP, secret); err != nil {
+		return store.Comment{}, err
+	}
+	if len(comment.VotedIPs) > 0 { // imported comment, keys are hashes of ips
+		votedIPs := make(map[string]store.VotedIPInfo, len(comment.VotedIPs))
+		for ipHash, v := range comment.VotedIPs {
+			if ipHash, err = s.prepareIP(ipHash, secret); err != nil {
+				return store.Comment{}, err
+			}
+			votedIPs[ipHash] = v
+		}
+		comment.VotedIPs = votedIPs
+	}
 	return comment, nil
 }
 
 // DeleteAll removes all data from site
 func (s *DataStore) DeleteAll(siteID string) error {
 	req := engine.DeleteRequest{Locator: store.Locator{SiteID: siteID}}
-	return s.Engine.Delete(req)
+	return s.delete(req)
 }
 
 // SetPin pin/un-pin comment as special
@@ -334,13 +469,14 @@ func (s *DataStore) Vote(req VoteReq) (comment store.Comment, err error) {
 	if err != nil {
 		return store.Comment{}, errors.Wrapf(err, "can't get secret for site %s", comment.Locator.SiteID)
 	}
-	userIPHash := store.HashValue(req.UserIP, secret)
+	userIPHash := s.encryptIP(store.HashValue(req.UserIP, secret))
 	if s.isSameIPVote(req, userIPHash, comment) {
 		return comment, errors.Errorf("the same ip %s already voted for %s", userIPHash, req.CommentID)
 	}
 
-	maxVotes := s.MaxVotes // 0 value allowed and treated as "no comments allowed"
-	if s.MaxVotes < 0 {    // any negative value reset max votes to unlimited
+	opts := s.storeOptions(comment.Locator.SiteID)
+	maxVotes := opts.MaxVotes // 0 value allowed and treated as "no comments allowed"
+	if opts.MaxVotes < 0 {    // any negative value reset max votes to unlimited
 		maxVotes = UnlimitedVotes
 	}
 
@@ -348,7 +484,7 @@ func (s *DataStore) Vote(req VoteReq) (comment store.Comment, err error) {
 		return comment, errors.Errorf("maximum number of votes exceeded for comment %s", req.CommentID)
 	}
 
-	if s.PositiveScore && comment.Score <= 0 && !req.Val {
+	if opts.PositiveScore && comment.Score <= 0 && !req.Val {
 		return comment, errors.Errorf("minimal score reached for comment %s", req.CommentID)
 	}
 
@@ -428,10 +564,11 @@ func (s *DataStore) controversy(ups, downs int) float64 {
 
 // EditRequest contains fields needed for comment update
 type EditRequest struct {
-	Text    string
-	Orig    string
-	Summary string
-	Delete  bool
+	Text     string
+	Orig     string
+	Summary  string
+	Delete   bool
+	EditorID string // user made the edit, author of the comment if empty
 }
 
 // EditComment to edit text and update Edit info
@@ -442,7 +579,8 @@ func (s *DataStore) EditComment(locator store.Locator, commentID string, req Edi
 	}
 
 	// edit allowed in editDuration window only
-	if s.EditDuration > 0 && time.Now().After(comment.Timestamp.Add(s.EditDuration)) {
+	if editDuration := s.storeOptions(locator.SiteID).EditDuration; editDuration > 0 &&
+		time.Now().After(comment.Timestamp.Add(editDuration)) {
 		return comment, errors.Errorf("too late to edit %s", commentID)
 	}
 
@@ -456,13 +594,14 @@ func (s *DataStore) EditComment(locator store.Locator, commentID string, req Edi
 		}
 		comment.Deleted = true
 		delReq := engine.DeleteRequest{Locator: locator, CommentID: commentID, DeleteMode: store.SoftDelete}
-		return comment, s.Engine.Delete(delReq)
+		return comment, s.delete(delReq)
 	}
 
 	if s.RestrictedWordsMatcher != nil && s.RestrictedWordsMatcher.Match(comment.Locator.SiteID, req.Text) {
 		return comment, ErrRestrictedWordsFound
 	}
 
+	orig := comment
 	comment.Text = req.Text
 	comment.Orig = req.Orig
 	comment.Edit = &store.Edit{
@@ -472,12 +611,26 @@ func (s *DataStore) EditComment(locator store.Locator, commentID string, req Edi
 	comment.Locator = locator
 	comment.Sanitize()
 
+	if err = s.checkSpam(&comment); err != nil {
+		return comment, err
+	}
+
 	if e := s.AdminStore.OnEvent(comment.Locator.SiteID, admin.EvUpdate); e != nil {
 		log.Printf("[WARN] failed to send update event, %s", e)
 	}
 
-	err = s.Engine.Update(comment)
-	return comment, err
+	if err = s.Engine.Update(comment); err != nil {
+		return comment, err
+	}
+	s.indexComments(comment)
+	if !orig.Pending && comment.Pending {
+		s.updateShadowCount(comment, -1)
+	}
+	if req.EditorID == "" {
+		req.EditorID = comment.User.ID
+	}
+	s.addRevisions(orig, comment, req.EditorID)
+	return comment, nil
 }
 
 // HasReplies checks if there is any reply to the comments
@@ -540,6 +693,9 @@ func (s *DataStore) UserReplies(siteID, userID string, limit int, duration time.
 		if c.ParentID != "" && !c.Deleted && c.User.ID != userID { // not interested in replies to yourself
 			var pc store.Comment
 			if pc, e = s.Get(c.Locator, c.ParentID, nonAdminUser); e != nil {
+				if errors.Is(e, ErrCommentNotFound) {
+					continue // reply to hidden comment
+				}
 				return nil, "", errors.Wrap(e, "can't get parent comment")
 			}
 			if pc.User.ID == userID {
@@ -569,8 +725,11 @@ func (s *DataStore) SetTitle(locator store.Locator, commentID string) (comment s
 	}
 	comment.PostTitle = title
 	comment.Locator = locator
-	err = s.Engine.Update(comment)
-	return comment, err
+	if err = s.Engine.Update(comment); err != nil {
+		return comment, err
+	}
+	s.indexComments(comment)
+	return comment, nil
 }
 
 // Counts returns postID+count list for given comments
@@ -582,13 +741,13 @@ func (s *DataStore) Counts(siteID string, postIDs []string) ([]store.PostInfo, e
 			res = append(res, store.PostInfo{URL: p, Count: c})
 		}
 	}
-	return res, nil
+	return s.hideShadowCounts(siteID, res), nil
 }
 
 // ValidateComment checks if comment size below max and user fields set
 func (s *DataStore) ValidateComment(c *store.Comment) error {
-	maxSize := s.MaxCommentSize
-	if s.MaxCommentSize <= 0 {
+	maxSize := s.storeOptions(c.Locator.SiteID).MaxCommentSize
+	if maxSize <= 0 {
 		maxSize = defaultCommentMaxSize
 	}
 	if c.Orig == "" {
@@ -670,8 +829,13 @@ func (s *DataStore) SetBlock(siteID, userID string, status bool, ttl time.Durati
 	}
 	req := engine.FlagRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
 		Flag: engine.Blocked, Update: roStatus, TTL: ttl}
-	_, err := s.Engine.Flag(req)
-	return err
+	if _, err := s.Engine.Flag(req); err != nil {
+		return err
+	}
+	if status {
+		s.trainSpamUser(siteID, userID)
+	}
+	return nil
 }
 
 // BlockedUsers returns list with all blocked users for given siteID
@@ -696,37 +860,90 @@ func (s *DataStore) Info(locator store.Locator, readonlyAge int) (store.PostInfo
 	if len(res) == 0 {
 		return store.PostInfo{}, errors.Errorf("post %+v not found", locator)
 	}
-	return res[0], nil
+	return s.hideShadowCounts(locator.SiteID, res)[0], nil
+}
+
+// Changes returns entries of site's change log with sequence number greater than since, oldest first
+func (s *DataStore) Changes(siteID string, since uint64, limit int) ([]engine.Change, error) {
+	req := engine.ChangesRequest{Locator: store.Locator{SiteID: siteID}, Since: since, Limit: limit}
+	res, err := s.Engine.Changes(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get changes of %s", siteID)
+	}
+	return res, nil
+}
+
+// ChangesHead returns sequence number of the last entry of site's change log, 0 if the log is empty
+func (s *DataStore) ChangesHead(siteID string) (uint64, error) {
+	res, err := s.Engine.Changes(engine.ChangesRequest{Locator: store.Locator{SiteID: siteID}, Last: true})
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't get head of changes of %s", siteID)
+	}
+	if len(res) == 0 {
+		return 0, nil
+	}
+	return res[0].Seq, nil
 }
 
-// Delete comment by id
+// Delete comment by id. Used by admins only, deleted comment passed to spam checker as spam
 func (s *DataStore) Delete(locator store.Locator, commentID string, mode store.DeleteMode) error {
+	if comment, err := s.Engine.Get(engine.GetRequest{Locator: locator, CommentID: commentID}); err == nil {
+		s.trainSpam(comment, true)
+	}
 	if e := s.AdminStore.OnEvent(locator.SiteID, admin.EvDelete); e != nil {
 		log.Printf("[WARN] failed to send delete event, %s", e)
 	}
 	req := engine.DeleteRequest{Locator: locator, CommentID: commentID, DeleteMode: mode}
-	return s.Engine.Delete(req)
+	return s.delete(req)
 }
 
 // DeleteUser removes all comments from user
 func (s *DataStore) DeleteUser(siteID, userID string, mode store.DeleteMode) error {
 	req := engine.DeleteRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, DeleteMode: mode}
-	return s.Engine.Delete(req)
+	return s.delete(req)
+}
+
+// delete comments with engine, from search index, history and hidden counts of shadow blocked users
+func (s *DataStore) delete(req engine.DeleteRequest) error {
+	var comment store.Comment
+	if req.CommentID != "" {
+		comment, _ = s.Engine.Get(engine.GetRequest{Locator: req.Locator, CommentID: req.CommentID})
+	}
+	if err := s.Engine.Delete(req); err != nil {
+		return err
+	}
+	s.unindexComments(req)
+	s.purgeHistory(req)
+	switch {
+	case req.CommentID != "" && comment.ID != "" && !comment.Deleted && !comment.Pending:
+		s.updateShadowCount(comment, -1)
+	case req.CommentID == "": // all comments of user or site deleted
+		s.resetShadowState(req.Locator.SiteID)
+	}
+	return nil
 }
 
 // List of commented posts
 func (s *DataStore) List(siteID string, limit, skip int) ([]store.PostInfo, error) {
 	req := engine.InfoRequest{Locator: store.Locator{SiteID: siteID}, Limit: limit, Skip: skip}
-	return s.Engine.Info(req)
+	res, err := s.Engine.Info(req)
+	if err != nil {
+		return nil, err
+	}
+	return s.hideShadowCounts(siteID, res), nil
 }
 
-// Count gets number of comments for the post
+// Count gets number of comments for the post, comments of shadow blocked users excluded
 func (s *DataStore) Count(locator store.Locator) (int, error) {
 	req := engine.FindRequest{Locator: locator}
-	return s.Engine.Count(req)
+	count, err := s.Engine.Count(req)
+	if err != nil {
+		return 0, err
+	}
+	return s.hideShadowCounts(locator.SiteID, []store.PostInfo{{URL: locator.URL, Count: count}})[0].Count, nil
 }
 
-// Metas returns metadata for users and posts
+// Metas returns metadata for users and posts. User details returned as stored, encrypted if encryption enabled
 func (s *DataStore) Metas(siteID string) (umetas []UserMetaData, pmetas []PostMetaData, err error) {
 	umetas = []UserMetaData{}
 	pmetas = []PostMetaData{}
@@ -761,6 +978,21 @@ func (s *DataStore) Metas(siteID string) (umetas []UserMetaData, pmetas []PostMe
 		m[b.ID] = val
 	}
 
+	// process shadow blocked users
+	shadowBlocked, err := s.ShadowBlockedUsers(siteID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, b := range shadowBlocked {
+		val, ok := m[b.ID]
+		if !ok {
+			val = UserMetaData{ID: b.ID}
+		}
+		val.ShadowBlocked.Status = true
+		val.ShadowBlocked.Until = b.Until
+		m[b.ID] = val
+	}
+
 	// process verified users
 	verified, err := s.Engine.ListFlags(engine.FlagRequest{Locator: store.Locator{SiteID: siteID}, Flag: engine.Verified})
 	if err != nil {
@@ -814,13 +1046,29 @@ func (s *DataStore) SetMetas(siteID string, umetas []UserMetaData, pmetas []Post
 		if um.Blocked.Status {
 			errs = multierror.Append(errs, s.SetBlock(siteID, um.ID, true, time.Until(um.Blocked.Until)))
 		}
+		if um.ShadowBlocked.Status {
+			errs = multierror.Append(errs, s.SetShadowBlock(siteID, um.ID, true, time.Until(um.ShadowBlocked.Until)))
+		}
 		if um.Verified {
 			errs = multierror.Append(errs, s.SetVerified(siteID, um.ID, true))
 		}
 		// this code doesn't delete user details in case they are not set in import but present in DB already
-		if um.Details.Email != "" {
-			req := engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: um.ID, Detail: engine.UserEmail, Update: um.Details.Email}
-			_, err := s.Engine.UserDetail(req)
+		details := []struct {
+			detail engine.UserDetail
+			value  string
+		}{{engine.UserEmail, um.Details.Email}, {engine.UserDigest, um.Details.Digest}, {engine.UserBio, um.Details.Bio},
+			{engine.UserWebsite, um.Details.Website}, {engine.UserMuted, um.Details.Muted}}
+		for _, d := range details {
+			if d.value == "" {
+				continue
+			}
+			value, err := s.importDetail(d.value)
+			if err != nil {
+				errs = multierror.Append(errs, errors.Wrapf(err, "can't import %s of %s", d.detail, um.ID))
+				continue
+			}
+			req := engine.UserDetailRequest{Locator: store.Locator{SiteID: siteID}, UserID: um.ID, Detail: d.detail, Update: value}
+			_, err = s.Engine.UserDetail(req)
 			errs = multierror.Append(errs, err)
 		}
 	}
@@ -836,7 +1084,7 @@ func (s *DataStore) User(siteID, userID string, limit, skip int, user store.User
 	if err != nil {
 		return comments, err
 	}
-	return s.alterComments(comments, user), nil
+	return s.visibleComments(s.alterComments(comments, user), user), nil
 }
 
 // UserCount is comments count by user
@@ -845,6 +1093,29 @@ func (s *DataStore) UserCount(siteID, userID string) (int, error) {
 	return s.Engine.Count(req)
 }
 
+// Commenters returns users commented the post with the latest visible comment of each user, resolves mentions
+func (s *DataStore) Commenters(locator store.Locator) ([]store.Commenter, error) {
+	comments, err := s.Engine.Find(engine.FindRequest{Locator: locator, Sort: "time"})
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't find comments of %s", locator.URL)
+	}
+	res := []store.Commenter{}
+	idx := map[string]int{} // user id -> index in res
+	for _, c := range comments {
+		if c.Deleted || c.Pending {
+			continue
+		}
+		commenter := store.Commenter{UserID: c.User.ID, Name: c.User.Name, CommentID: c.ID}
+		if i, ok := idx[c.User.ID]; ok {
+			res[i] = commenter
+			continue
+		}
+		idx[c.User.ID] = len(res)
+		res = append(res, commenter)
+	}
+	return res, nil
+}
+
 // Last gets last comments for site, cross-post. Limited by count and optional since ts
 func (s *DataStore) Last(siteID string, limit int, since time.Time, user store.User) ([]store.Comment, error) {
 	req := engine.FindRequest{Locator: store.Locator{SiteID: siteID}, Limit: limit, Since: since, Sort: "-time"}
@@ -852,7 +1123,122 @@ func (s *DataStore) Last(siteID string, limit int, since time.Time, user store.U
 	if err != nil {
 		return comments, err
 	}
-	return s.alterComments(comments, user), nil
+	comments = s.alterComments(comments, user)
+	if !user.Admin {
+		// pending comments and comments of shadow blocked users hidden even from their authors,
+		// last comments of regular users cached for all of them
+		return s.visibleComments(comments, nonAdminUser), nil
+	}
+	// admins see comments of shadow blocked users marked, pending comments never included
+	return filterApproved(comments), nil
+}
+
+// IsModerated checks if new comments for the site held for approval
+func (s *DataStore) IsModerated(siteID string) bool {
+	for _, site := range s.Moderation.Sites {
+		if site == siteID {
+			return true
+		}
+	}
+	return false
+}
+
+// Pending gets comments waiting for approval, sorted by time, oldest first
+func (s *DataStore) Pending(siteID string, limit, skip int) ([]store.Comment, error) {
+	req := engine.FindRequest{Locator: store.Locator{SiteID: siteID}, Pending: true, Limit: limit, Skip: skip}
+	comments, err := s.Engine.Find(req)
+	if err != nil {
+		return comments, err
+	}
+	return s.alterComments(comments, store.User{Admin: true}), nil
+}
+
+// Approve publishes pending comment and returns it. Reports of the comment dismissed
+func (s *DataStore) Approve(locator store.Locator, commentID string) (store.Comment, error) {
+	comment, err := s.pendingComment(locator, commentID)
+	if err != nil {
+		return store.Comment{}, err
+	}
+	comment.Pending = false
+	if err = s.Engine.Update(comment); err != nil {
+		return store.Comment{}, errors.Wrapf(err, "can't approve comment %s", commentID)
+	}
+	s.indexComments(comment)
+	s.updateShadowCount(comment, 1)
+	if err = s.DismissReports(locator, commentID); err != nil {
+		log.Printf("[WARN] can't dismiss reports of approved comment %s, %v", commentID, err)
+	}
+	s.trainSpam(comment, false)
+	return comment, nil
+}
+
+// Reject deletes pending comment
+func (s *DataStore) Reject(locator store.Locator, commentID string) error {
+	if _, err := s.pendingComment(locator, commentID); err != nil {
+		return err
+	}
+	return s.Delete(locator, commentID, store.SoftDelete)
+}
+
+func (s *DataStore) pendingComment(locator store.Locator, commentID string) (store.Comment, error) {
+	comment, err := s.Engine.Get(engine.GetRequest{Locator: locator, CommentID: commentID})
+	if err != nil {
+		return store.Comment{}, err
+	}
+	if !comment.Pending || comment.Deleted {
+		return store.Comment{}, errors.Errorf("comment %s is not pending", commentID)
+	}
+	return comment, nil
+}
+
+// needsApproval checks if new comment should be held for moderation.
+// Comments from admins, verified users (optional) and users with enough approved comments (optional) published right away.
+func (s *DataStore) needsApproval(comment store.Comment) bool {
+	siteID, userID := comment.Locator.SiteID, comment.User.ID
+	if !s.IsModerated(siteID) || comment.User.Admin || s.IsAdmin(siteID, userID) {
+		return false
+	}
+	if s.Moderation.ApproveVerified && s.IsVerified(siteID, userID) {
+		return false
+	}
+	if s.Moderation.ApproveAfter <= 0 {
+		return true
+	}
+	comments, err := s.Engine.Find(engine.FindRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID})
+	if err != nil {
+		return true // no comments for user yet
+	}
+	approved := 0
+	for _, c := range comments {
+		if !c.Pending && !c.Deleted {
+			approved++
+		}
+	}
+	return approved < s.Moderation.ApproveAfter
+}
+
+// visibleComments removes pending comments and comments of shadow blocked users,
+// except for admins and authors of the comments
+func (s *DataStore) visibleComments(cc []store.Comment, user store.User) []store.Comment {
+	if len(cc) == 0 || user.Admin {
+		return cc
+	}
+	shadowBlocked := s.shadowBlocked(cc[0].Locator.SiteID)
+	hasHidden := false
+	for _, c := range cc {
+		hasHidden = hasHidden || c.Pending || shadowBlocked[c.User.ID]
+	}
+	if !hasHidden {
+		return cc
+	}
+	res := make([]store.Comment, 0, len(cc))
+	for _, c := range cc {
+		if (c.Pending || shadowBlocked[c.User.ID]) && (user.ID == "" || user.ID != c.User.ID) {
+			continue
+		}
+		res = append(res, c)
+	}
+	return res
 }
 
 // Close store service
@@ -861,9 +1247,26 @@ func (s *DataStore) Close() error {
 	if s.repliesCache.LoadingCache != nil {
 		errs = multierror.Append(errs, s.repliesCache.LoadingCache.Close())
 	}
+	if s.shadowCache.LoadingCache != nil {
+		errs = multierror.Append(errs, s.shadowCache.LoadingCache.Close())
+	}
 	if s.TitleExtractor != nil {
 		errs = multierror.Append(errs, s.TitleExtractor.Close())
 	}
+	if closer, ok := s.SpamFilter.Checker.(io.Closer); ok {
+		errs = multierror.Append(errs, closer.Close())
+	}
+	if s.RateLimit.Limiter != nil {
+		if closer, ok := s.RateLimit.Limiter.Store.(io.Closer); ok {
+			errs = multierror.Append(errs, closer.Close())
+		}
+	}
+	if s.SearchIndex != nil {
+		errs = multierror.Append(errs, s.SearchIndex.Close())
+	}
+	if s.HistoryStore != nil {
+		errs = multierror.Append(errs, s.HistoryStore.Close())
+	}
 	errs = multierror.Append(errs, s.Engine.Close())
 	return errs.ErrorOrNil()
 }
@@ -918,12 +1321,23 @@ func (s *DataStore) alterComment(c store.Comment, user store.User) (res store.Co
 		c.User.Verified, _ = s.Engine.Flag(verifReq)
 	}
 
+	// mark shadow blocked user for admins only, the user is not aware of the block
+	if user.Admin {
+		c.User.ShadowBlocked = s.isShadowBlockedCached(c.Locator.SiteID, c.User.ID)
+	}
+
 	// hide info from non-admins
 	if !user.Admin {
+		c.User.ShadowBlocked = false
 		c.User.IP = ""
+		c.Spam = nil
+	}
+	if user.Admin && c.User.IP != "" {
+		c.User.IP = s.decryptIP(c.User.IP)
 	}
 
 	c = s.prepVotes(c, user)
+	c = prepReactions(c, user)
 	return c
 }
 
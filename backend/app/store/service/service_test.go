@@ -200,6 +200,203 @@ func TestService_SetTitle(t *testing.T) {
 	require.EqualError(t, err, "no title extractor")
 }
 
+func TestService_CreatePending(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticStore("secret 123", nil, []string{"admin"}, "")}
+	b.Moderation.Sites = []string{"radio-t"}
+	b.Moderation.ApproveAfter = 2
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	pending := func(userID string) bool {
+		id, err := b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: userID, Name: "name"}})
+		require.NoError(t, err)
+		res, err := b.Engine.Get(getReq(locator, id))
+		require.NoError(t, err)
+		return res.Pending
+	}
+
+	assert.True(t, pending("user2"), "new user held")
+	assert.False(t, pending("user1"), "user with 2 approved comments")
+	assert.False(t, pending("admin"), "admin never held")
+
+	require.NoError(t, b.SetVerified("radio-t", "user3", true))
+	assert.True(t, pending("user3"), "verified held without ApproveVerified")
+	b.Moderation.ApproveVerified = true
+	assert.False(t, pending("user3"), "verified approved")
+
+	b.Moderation.Sites = []string{"other"}
+	assert.False(t, pending("user2"), "site not moderated")
+}
+
+func TestService_PendingApproveReject(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	b.Moderation.Sites = []string{"radio-t"}
+	assert.True(t, b.IsModerated("radio-t"))
+	assert.False(t, b.IsModerated("other"))
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	id1, err := b.Create(store.Comment{Text: "text 1", Locator: locator, User: store.User{ID: "user2", Name: "name"}})
+	require.NoError(t, err)
+	id2, err := b.Create(store.Comment{Text: "text 2", Locator: locator, User: store.User{ID: "user2", Name: "name"}})
+	require.NoError(t, err)
+
+	res, err := b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(res), "pending comments hidden from anonymous")
+	res, err = b.Find(locator, "time", store.User{ID: "user1"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(res), "pending comments hidden from other users")
+	res, err = b.Find(locator, "time", store.User{ID: "user2"})
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(res), "pending comments visible to author")
+	res, err = b.Find(locator, "time", store.User{ID: "admin", Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(res), "pending comments visible to admin")
+	res, err = b.Last("radio-t", 10, time.Time{}, store.User{ID: "user2"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(res), "pending comments not in last")
+	res, err = b.User("radio-t", "user2", 10, 0, store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res), "pending comments hidden in user's comments")
+
+	_, err = b.Get(locator, id1, store.User{})
+	assert.True(t, errors.Is(err, ErrCommentNotFound), "pending comment hidden from anonymous")
+	_, err = b.Get(locator, id1, store.User{ID: "user1"})
+	assert.True(t, errors.Is(err, ErrCommentNotFound), "pending comment hidden from other users")
+	c, err := b.Get(locator, id1, store.User{ID: "user2"})
+	require.NoError(t, err, "pending comment visible to author")
+	assert.Equal(t, "text 1", c.Text)
+	_, err = b.Get(locator, id1, store.User{ID: "admin", Admin: true})
+	assert.NoError(t, err, "pending comment visible to admin")
+
+	res, err = b.Pending("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, id1, res[0].ID)
+
+	c, err = b.Approve(locator, id1)
+	require.NoError(t, err)
+	assert.False(t, c.Pending)
+	assert.Equal(t, "text 1", c.Text)
+	_, err = b.Approve(locator, id1)
+	assert.EqualError(t, err, fmt.Sprintf("comment %s is not pending", id1))
+
+	require.NoError(t, b.Reject(locator, id2))
+	assert.Error(t, b.Reject(locator, id2), "already rejected")
+
+	res, err = b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res), "approved comment visible, rejected hidden")
+	assert.Equal(t, "text 1", res[2].Text)
+	res, err = b.Find(locator, "time", store.User{ID: "user2"})
+	require.NoError(t, err)
+	require.Equal(t, 4, len(res))
+	assert.True(t, res[3].Deleted, "rejected comment deleted")
+	count, err := b.Count(locator)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	res, err = b.Pending("radio-t", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+}
+
+func TestService_CreateSpam(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	checker := &mockSpamChecker{}
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	b.SpamFilter.Checker = checker
+	b.SpamFilter.Threshold = 0.9
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	id, err := b.Create(store.Comment{Text: "some spam", Locator: locator, User: store.User{ID: "user2", Name: "name"}})
+	require.NoError(t, err)
+	res, err := b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.True(t, res.Pending, "spam held for review")
+	require.NotNil(t, res.Spam)
+	assert.Equal(t, 1., res.Spam.Score)
+	assert.Equal(t, []string{"mock: spam"}, res.Spam.Reasons)
+	assert.True(t, res.Spam.Flagged)
+
+	c, err := b.Get(locator, id, store.User{ID: "user2"})
+	require.NoError(t, err)
+	assert.Nil(t, c.Spam, "spam check hidden from non-admins")
+	c, err = b.Get(locator, id, store.User{ID: "admin", Admin: true})
+	require.NoError(t, err)
+	assert.NotNil(t, c.Spam, "spam check visible to admins")
+
+	id, err = b.Create(store.Comment{Text: "some text", Locator: locator, User: store.User{ID: "user2", Name: "name"}})
+	require.NoError(t, err)
+	res, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.False(t, res.Pending)
+	require.NotNil(t, res.Spam)
+	assert.False(t, res.Spam.Flagged)
+
+	_, err = b.Create(store.Comment{Text: "spam import", Locator: locator, User: store.User{ID: "user2", Name: "name"},
+		Imported: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, checker.checks, "imported comment not checked")
+
+	b.SpamFilter.Reject = true
+	_, err = b.Create(store.Comment{Text: "more spam", Locator: locator, User: store.User{ID: "user2", Name: "name"}})
+	assert.Equal(t, ErrSpamDetected, err)
+
+	checker.err = errors.New("failed")
+	id, err = b.Create(store.Comment{Text: "spam with failed check", Locator: locator, User: store.User{ID: "user2", Name: "name"}})
+	require.NoError(t, err, "failed check doesn't reject comment")
+	res, err = b.Engine.Get(getReq(locator, id))
+	require.NoError(t, err)
+	assert.Nil(t, res.Spam)
+}
+
+func TestService_EditCommentSpam(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	b.SpamFilter.Checker = &mockSpamChecker{}
+	b.SpamFilter.Threshold = 0.5
+	b.SpamFilter.Reject = true
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	id, err := b.Create(store.Comment{Text: "some text", Locator: locator, User: store.User{ID: "user2", Name: "name"}})
+	require.NoError(t, err)
+	_, err = b.EditComment(locator, id, EditRequest{Orig: "spam", Text: "spam"})
+	assert.Equal(t, ErrSpamDetected, err)
+
+	b.SpamFilter.Reject = false
+	c, err := b.EditComment(locator, id, EditRequest{Orig: "spam", Text: "spam"})
+	require.NoError(t, err)
+	assert.True(t, c.Pending, "edited spam held for review")
+}
+
+func TestService_TrainSpam(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	checker := &mockSpamChecker{}
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	b.SpamFilter.Checker = checker
+	b.SpamFilter.Threshold = 0.9
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := b.Create(store.Comment{Text: "admin text", Locator: locator, User: store.User{ID: "admin", Name: "name", Admin: true}})
+	require.NoError(t, err)
+	id, err := b.Create(store.Comment{Text: "some spam", Locator: locator, User: store.User{ID: "user2", Name: "name"}})
+	require.NoError(t, err)
+	_, err = b.Approve(locator, id)
+	require.NoError(t, err)
+	require.NoError(t, b.Delete(locator, "id-1", store.SoftDelete))
+	require.NoError(t, b.SetBlock("radio-t", "user1", true, time.Hour))
+
+	assert.Equal(t, map[string]bool{"admin text": false, "some spam": false,
+		`some text, <a href="http://radio-t.com">link</a>`: true, "some text2": true}, checker.trained)
+}
+
 func TestService_Vote(t *testing.T) {
 
 	eng, teardown := prepStoreEngine(t)
@@ -849,7 +1046,8 @@ func TestService_SetMetas(t *testing.T) {
 	err := b.SetMetas("radio-t", umetas, pmetas)
 	assert.NoError(t, err, "empty metas")
 
-	um1 := UserMetaData{ID: "user1", Verified: true, Details: engine.UserDetailEntry{Email: "test@example.org"}}
+	um1 := UserMetaData{ID: "user1", Verified: true, Details: engine.UserDetailEntry{Email: "test@example.org", Digest: "hourly",
+		Bio: "my bio"}}
 	um2 := UserMetaData{ID: "user2"}
 	um2.Blocked.Status = true
 	um2.Blocked.Until = time.Now().AddDate(0, 1, 1)
@@ -864,6 +1062,12 @@ func TestService_SetMetas(t *testing.T) {
 	val, err := b.Engine.UserDetail(engine.UserDetailRequest{Locator: store.Locator{SiteID: "radio-t"}, UserID: "user1", Detail: engine.UserEmail})
 	assert.NoError(t, err)
 	assert.Equal(t, []engine.UserDetailEntry{{UserID: "user1", Email: "test@example.org"}}, val)
+	profile, err := b.GetUserProfile("radio-t", "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, ProfileDetails{Bio: "my bio"}, profile)
+	digest, err := b.GetUserDigest("radio-t", "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, store.DigestHourly, digest)
 }
 
 func TestService_UserDetailsOperations(t *testing.T) {
@@ -903,6 +1107,36 @@ func TestService_UserDetailsOperations(t *testing.T) {
 	assert.Empty(t, result)
 }
 
+func TestService_UserDigest(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	mode, err := b.GetUserDigest("radio-t", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, store.DigestImmediate, mode, "immediate by default")
+
+	mode, err = b.SetUserDigest("radio-t", "u1", store.DigestHourly)
+	require.NoError(t, err)
+	assert.Equal(t, store.DigestHourly, mode)
+	mode, err = b.GetUserDigest("radio-t", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, store.DigestHourly, mode)
+
+	_, err = b.SetUserDigest("radio-t", "u1", "weekly")
+	assert.EqualError(t, err, `unsupported digest mode "weekly"`)
+
+	mode, err = b.SetUserDigest("radio-t", "u1", store.DigestImmediate)
+	require.NoError(t, err)
+	assert.Equal(t, store.DigestImmediate, mode)
+	mode, err = b.GetUserDigest("radio-t", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, store.DigestImmediate, mode)
+
+	_, err = b.GetUserDigest("bad-site", "u1")
+	assert.Error(t, err)
+}
+
 func TestService_IsAdmin(t *testing.T) {
 
 	// two comments for https://radio-t.com
@@ -1103,6 +1337,41 @@ func TestService_Info(t *testing.T) {
 	assert.True(t, info.ReadOnly)
 }
 
+func TestService_Changes(t *testing.T) {
+	// two comments for https://radio-t.com, no reply
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticStore("secret 123", nil, []string{"user2"}, "user@email.com")}
+
+	changes, err := b.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(changes))
+	assert.Equal(t, engine.ChangeCreate, changes[0].Event)
+	assert.Equal(t, "id-1", changes[0].Comment.ID)
+	assert.Equal(t, "id-2", changes[1].Comment.ID)
+
+	err = b.Delete(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "id-1", store.SoftDelete)
+	require.NoError(t, err)
+	changes, err = b.Changes("radio-t", changes[1].Seq, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(changes))
+	assert.Equal(t, engine.ChangeDelete, changes[0].Event)
+	assert.Equal(t, "id-1", changes[0].Delete.CommentID)
+
+	changes, err = b.Changes("radio-t", 0, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(changes), "limited")
+
+	head, err := b.ChangesHead("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), head)
+	_, err = b.ChangesHead("bad-site")
+	assert.Error(t, err)
+
+	_, err = b.Changes("bad-site", 0, 0)
+	assert.Error(t, err)
+}
+
 func TestService_Delete(t *testing.T) {
 
 	// two comments for https://radio-t.com, no reply
@@ -1278,6 +1547,32 @@ func TestService_UserCount(t *testing.T) {
 	assert.EqualError(t, err, "no comments for user userBad in store for radio-t site")
 }
 
+func TestService_Commenters(t *testing.T) {
+	// two comments for https://radio-t.com, no reply
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	for _, c := range []store.Comment{
+		{ID: "id-3", User: store.User{ID: "user2", Name: "user2 name"}},
+		{ID: "id-4", User: store.User{ID: "user3", Name: "user3 name"}, Pending: true},
+		{ID: "id-5", User: store.User{ID: "user2", Name: "user2 name"}, Deleted: true},
+	} {
+		c.Text, c.Locator = "text", store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+		c.Timestamp = time.Now()
+		_, err := eng.Create(c)
+		require.NoError(t, err)
+	}
+
+	res, err := b.Commenters(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"})
+	require.NoError(t, err)
+	assert.Equal(t, []store.Commenter{{UserID: "user1", Name: "user name", CommentID: "id-2"},
+		{UserID: "user2", Name: "user2 name", CommentID: "id-3"}}, res, "latest visible comment of each user")
+
+	_, err = b.Commenters(store.Locator{URL: "https://radio-t.com/none", SiteID: "radio-t"})
+	assert.Error(t, err, "no post")
+}
+
 func TestService_DeleteAll(t *testing.T) {
 
 	// two comments for https://radio-t.com, no reply
@@ -1448,6 +1743,7 @@ func TestService_alterComment(t *testing.T) {
 	engineMock := engine.MockInterface{}
 	engineMock.On("Flag", engine.FlagRequest{Flag: engine.Blocked, UserID: "devid"}).Return(false, nil)
 	engineMock.On("Flag", engine.FlagRequest{Flag: engine.Verified, UserID: "devid"}).Return(false, nil)
+	engineMock.On("ListFlags", engine.FlagRequest{Flag: engine.ShadowBlocked}).Return([]interface{}{}, nil)
 	svc := DataStore{Engine: &engineMock}
 
 	r := svc.alterComment(store.Comment{ID: "123", User: store.User{IP: "127.0.0.1", ID: "devid"}},
@@ -1473,6 +1769,22 @@ func TestService_alterComment(t *testing.T) {
 		store.User{Name: "dev", ID: "devid", Admin: false})
 	assert.Equal(t, store.Comment{ID: "123", User: store.User{IP: "", Verified: true, Blocked: true, ID: "devid"},
 		Deleted: false}, r, "blocked")
+
+	engineMock = engine.MockInterface{}
+	engineMock.On("Flag", engine.FlagRequest{Flag: engine.Blocked, UserID: "devid"}).Return(false, nil)
+	engineMock.On("Flag", engine.FlagRequest{Flag: engine.Verified, UserID: "devid"}).Return(false, nil)
+	engineMock.On("ListFlags", engine.FlagRequest{Flag: engine.ShadowBlocked}).
+		Return([]interface{}{store.BlockedUser{ID: "devid", Until: time.Now().Add(time.Hour)}}, nil)
+	engineMock.On("Find", engine.FindRequest{UserID: "devid", Limit: userCommentsPg, Sort: "-time"}).Return([]store.Comment{}, nil)
+	svc = DataStore{Engine: &engineMock}
+	r = svc.alterComment(store.Comment{ID: "123", User: store.User{ID: "devid"}}, store.User{Name: "dev", ID: "devid", Admin: false})
+	assert.Equal(t, store.Comment{ID: "123", User: store.User{ID: "devid"}}, r, "shadow block not visible to user")
+	rr := svc.alterComments([]store.Comment{{ID: "123", User: store.User{ID: "devid"}}, {ID: "456", User: store.User{ID: "devid"}}},
+		store.User{Name: "admin", ID: "admin", Admin: true})
+	assert.Equal(t, []store.Comment{{ID: "123", User: store.User{ID: "devid", ShadowBlocked: true}},
+		{ID: "456", User: store.User{ID: "devid", ShadowBlocked: true}}}, rr, "shadow block marked for admin")
+	engineMock.AssertNumberOfCalls(t, "ListFlags", 1)
+	engineMock.AssertNotCalled(t, "Flag", engine.FlagRequest{Flag: engine.ShadowBlocked, UserID: "devid"})
 }
 
 func Benchmark_ServiceCreate(b *testing.B) {
@@ -1498,6 +1810,31 @@ func Benchmark_ServiceCreate(b *testing.B) {
 }
 
 // makes new boltdb, put two records
+type mockSpamChecker struct {
+	checks  int
+	err     error
+	trained map[string]bool
+}
+
+func (m *mockSpamChecker) Check(comment store.Comment) (score float64, reasons []string, err error) {
+	m.checks++
+	if m.err != nil {
+		return 0, nil, m.err
+	}
+	if strings.Contains(comment.Text, "spam") {
+		return 1, []string{"mock: spam"}, nil
+	}
+	return 0.1, nil, nil
+}
+
+func (m *mockSpamChecker) Train(comment store.Comment, spam bool) error {
+	if m.trained == nil {
+		m.trained = map[string]bool{}
+	}
+	m.trained[comment.Text] = spam
+	return nil
+}
+
 func prepStoreEngine(t *testing.T) (e engine.Interface, teardown func()) {
 	testDBLoc, err := ioutil.TempDir("", "test_image_r42")
 	require.NoError(t, err)
@@ -0,0 +1,50 @@
+package service
+
+import (
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+// ErrSettingsDisabled returned by Settings and SetSettings if settings store is not set
+var ErrSettingsDisabled = errors.New("site settings disabled")
+
+// Settings returns settings of the site, overriding global options
+func (s *DataStore) Settings(siteID string) (admin.Settings, error) {
+	if s.SettingsStore == nil {
+		return admin.Settings{}, ErrSettingsDisabled
+	}
+	return s.SettingsStore.Settings(siteID)
+}
+
+// SetSettings validates and replaces settings of the site
+func (s *DataStore) SetSettings(siteID string, settings admin.Settings) error {
+	if s.SettingsStore == nil {
+		return ErrSettingsDisabled
+	}
+	if err := settings.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid settings of %s", siteID)
+	}
+	return errors.Wrapf(s.SettingsStore.SetSettings(siteID, settings), "can't set settings of %s", siteID)
+}
+
+// SiteOptions returns options of the site, with settings of the site applied to given global options.
+// Global options returned if settings store not set or failed
+func (s *DataStore) SiteOptions(siteID string, global admin.SiteOptions) admin.SiteOptions {
+	if s.SettingsStore == nil {
+		return global
+	}
+	settings, err := s.SettingsStore.Settings(siteID)
+	if err != nil {
+		log.Printf("[WARN] can't get settings of %s, global options used, %v", siteID, err)
+		return global
+	}
+	return settings.Apply(global)
+}
+
+// storeOptions returns options of the site used by the store itself
+func (s *DataStore) storeOptions(siteID string) admin.SiteOptions {
+	return s.SiteOptions(siteID, admin.SiteOptions{MaxCommentSize: s.MaxCommentSize, EditDuration: s.EditDuration,
+		MaxVotes: s.MaxVotes, PositiveScore: s.PositiveScore, Reactions: s.Reactions})
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestService_SiteSettings(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, EditDuration: time.Hour, MaxCommentSize: 2000, MaxVotes: -1,
+		AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+
+	_, err := b.Settings("radio-t")
+	assert.Equal(t, ErrSettingsDisabled, err)
+	assert.Equal(t, ErrSettingsDisabled, b.SetSettings("radio-t", admin.Settings{}))
+	global := admin.SiteOptions{MaxCommentSize: 2000, ReadOnlyAge: 10}
+	assert.Equal(t, global, b.SiteOptions("radio-t", global), "global options without settings store")
+
+	file := os.TempDir() + "/test-remark-service-settings.json"
+	defer os.Remove(file)
+	_ = os.Remove(file)
+	b.SettingsStore, err = admin.NewFileSettings(file)
+	require.NoError(t, err)
+
+	size, neg, votes, edit := 10, -1, 0, 0
+	assert.EqualError(t, b.SetSettings("radio-t", admin.Settings{MaxCommentSize: &neg}),
+		"invalid settings of radio-t: negative max_comment_size -1")
+	require.NoError(t, b.SetSettings("radio-t", admin.Settings{MaxCommentSize: &size, MaxVotes: &votes, EditDuration: &edit}))
+	settings, err := b.Settings("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, admin.Settings{MaxCommentSize: &size, MaxVotes: &votes, EditDuration: &edit}, settings)
+	assert.Equal(t, admin.SiteOptions{MaxCommentSize: 10, ReadOnlyAge: 10}, b.SiteOptions("radio-t", global))
+	assert.Equal(t, global, b.SiteOptions("other", global), "global options for site without settings")
+
+	// max comment size of the site
+	c := store.Comment{Orig: "long text", User: store.User{ID: "id", Name: "name"}, Locator: store.Locator{SiteID: "radio-t"}}
+	assert.NoError(t, b.ValidateComment(&c))
+	c.Orig = "longer than 10"
+	assert.EqualError(t, b.ValidateComment(&c), "comment text exceeded max allowed size 10 (14)")
+	c.Locator.SiteID = "other"
+	assert.NoError(t, b.ValidateComment(&c))
+
+	// no votes allowed for the site
+	_, err = b.Vote(VoteReq{Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, CommentID: "id-1",
+		UserID: "user2", UserIP: "123", Val: true})
+	assert.EqualError(t, err, "maximum number of votes exceeded for comment id-1")
+
+	// unlimited edit duration of the site
+	res, err := b.Last("radio-t", 0, time.Time{}, store.User{})
+	require.NoError(t, err)
+	_, err = b.EditComment(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, res[0].ID,
+		EditRequest{Orig: "yyy", Text: "xxx", Summary: "my edit"})
+	assert.NoError(t, err, "comment made in 2017 can be edited")
+	b.EditDuration = time.Hour
+	require.NoError(t, b.SetSettings("radio-t", admin.Settings{}))
+	_, err = b.EditComment(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, res[0].ID,
+		EditRequest{Orig: "yyy", Text: "xxx", Summary: "my edit"})
+	assert.EqualError(t, err, "too late to edit "+res[0].ID, "global edit duration")
+}
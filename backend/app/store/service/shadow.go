@@ -0,0 +1,197 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lcw"
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// shadowCacheTTL sets how long shadow blocks of the site cached, changes made by other instances seen after it
+const shadowCacheTTL = time.Minute
+
+// IsShadowBlocked checks if user shadow blocked
+func (s *DataStore) IsShadowBlocked(siteID, userID string) bool {
+	req := engine.FlagRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, Flag: engine.ShadowBlocked}
+	ro, err := s.Engine.Flag(req)
+	return err == nil && ro
+}
+
+// SetShadowBlock set/reset shadow block for user. Shadow blocked user can post as usual,
+// but the comments visible to the user and admins only. Zero ttl blocks permanently
+func (s *DataStore) SetShadowBlock(siteID, userID string, status bool, ttl time.Duration) error {
+	roStatus := engine.FlagFalse
+	if status {
+		roStatus = engine.FlagTrue
+	}
+	req := engine.FlagRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID,
+		Flag: engine.ShadowBlocked, Update: roStatus, TTL: ttl}
+	if _, err := s.Engine.Flag(req); err != nil {
+		return err
+	}
+	s.resetShadowState(siteID)
+	if status {
+		s.trainSpamUser(siteID, userID)
+	}
+	return nil
+}
+
+// ShadowBlockedUsers returns list with all shadow blocked users for given siteID
+func (s *DataStore) ShadowBlockedUsers(siteID string) (res []store.BlockedUser, err error) {
+	blocked, err := s.Engine.ListFlags(engine.FlagRequest{Locator: store.Locator{SiteID: siteID}, Flag: engine.ShadowBlocked})
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get list of shadow blocked users for %s", siteID)
+	}
+	for _, v := range blocked {
+		u := v.(store.BlockedUser)
+		u.Shadow = true
+		res = append(res, u)
+	}
+	return res, nil
+}
+
+// shadowState keeps shadow blocked users of the site and numbers of their published comments,
+// to hide the comments and subtract them from counts of posts without reading them on each request
+type shadowState struct {
+	sync.Mutex
+	blocked map[string]time.Time      // shadow blocked users, blocked till the time
+	hidden  map[string]map[string]int // published comments of blocked user per post url
+}
+
+// shadowState returns cached shadow blocks of the site, loaded from engine if not cached.
+// Cached state updated on changes made by the instance and reloaded on shadowCacheTTL expiration
+func (s *DataStore) shadowState(siteID string) *shadowState {
+	s.shadowCache.once.Do(func() {
+		s.shadowCache.LoadingCache, _ = lcw.NewExpirableCache(lcw.TTL(shadowCacheTTL))
+	})
+	val, err := s.shadowCache.Get(siteID, func() (lcw.Value, error) {
+		return s.loadShadowState(siteID)
+	})
+	if err != nil {
+		log.Printf("[WARN] %v", err)
+		return &shadowState{blocked: map[string]time.Time{}, hidden: map[string]map[string]int{}}
+	}
+	return val.(*shadowState)
+}
+
+// loadShadowState reads shadow blocked users of the site and counts their published comments
+func (s *DataStore) loadShadowState(siteID string) (*shadowState, error) {
+	users, err := s.ShadowBlockedUsers(siteID)
+	if err != nil {
+		return nil, err
+	}
+	res := &shadowState{blocked: make(map[string]time.Time, len(users)), hidden: map[string]map[string]int{}}
+	for _, u := range users {
+		res.blocked[u.ID] = u.Until
+		comments, e := s.allUserComments(siteID, u.ID)
+		if e != nil {
+			log.Printf("[DEBUG] no comments of shadow blocked user %s, %v", u.ID, e)
+			continue
+		}
+		for _, c := range comments {
+			if !c.Deleted && !c.Pending {
+				res.add(c.User.ID, c.Locator.URL, 1)
+			}
+		}
+	}
+	return res, nil
+}
+
+// add changes number of published comments of blocked user on the post by delta
+func (st *shadowState) add(userID, url string, delta int) {
+	counts, ok := st.hidden[userID]
+	if !ok {
+		counts = map[string]int{}
+		st.hidden[userID] = counts
+	}
+	if counts[url] += delta; counts[url] <= 0 {
+		delete(counts, url)
+	}
+}
+
+// updateShadowCount changes number of hidden comments on the post by delta if author of the comment shadow blocked.
+// Nothing to update if state of the site not cached yet, it is counted on load
+func (s *DataStore) updateShadowCount(c store.Comment, delta int) {
+	if s.shadowCache.LoadingCache == nil {
+		return
+	}
+	val, ok := s.shadowCache.Peek(c.Locator.SiteID)
+	if !ok {
+		return
+	}
+	st := val.(*shadowState)
+	st.Lock()
+	defer st.Unlock()
+	if _, blocked := st.blocked[c.User.ID]; blocked {
+		st.add(c.User.ID, c.Locator.URL, delta)
+	}
+}
+
+// resetShadowState drops cached shadow blocks of the site, reloaded on next use
+func (s *DataStore) resetShadowState(siteID string) {
+	if s.shadowCache.LoadingCache != nil {
+		s.shadowCache.Delete(siteID)
+	}
+}
+
+// shadowBlocked returns set of users shadow blocked now on the site
+func (s *DataStore) shadowBlocked(siteID string) map[string]bool {
+	st := s.shadowState(siteID)
+	st.Lock()
+	defer st.Unlock()
+	now := time.Now()
+	res := make(map[string]bool, len(st.blocked))
+	for userID, until := range st.blocked {
+		if now.Before(until) {
+			res[userID] = true
+		}
+	}
+	return res
+}
+
+// isShadowBlockedCached checks if user shadow blocked with cached shadow blocks of the site
+func (s *DataStore) isShadowBlockedCached(siteID, userID string) bool {
+	st := s.shadowState(siteID)
+	st.Lock()
+	defer st.Unlock()
+	until, ok := st.blocked[userID]
+	return ok && time.Now().Before(until)
+}
+
+// shadowCounts returns number of published comments of shadow blocked users per post url.
+// Engine's counts include these comments, so they subtracted from counts shown to users.
+func (s *DataStore) shadowCounts(siteID string) map[string]int {
+	st := s.shadowState(siteID)
+	st.Lock()
+	defer st.Unlock()
+	now := time.Now()
+	res := map[string]int{}
+	for userID, until := range st.blocked {
+		if !now.Before(until) {
+			continue
+		}
+		for url, count := range st.hidden[userID] {
+			res[url] += count
+		}
+	}
+	return res
+}
+
+// hideShadowCounts subtracts comments of shadow blocked users from counts of posts
+func (s *DataStore) hideShadowCounts(siteID string, posts []store.PostInfo) []store.PostInfo {
+	hidden := s.shadowCounts(siteID)
+	if len(hidden) == 0 {
+		return posts
+	}
+	for i, p := range posts {
+		if posts[i].Count -= hidden[p.URL]; posts[i].Count < 0 {
+			posts[i].Count = 0
+		}
+	}
+	return posts
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+func TestService_ShadowBlock(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := eng.Create(store.Comment{ID: "id-3", Text: "text", Locator: locator, User: store.User{ID: "user2", Name: "user2"},
+		Timestamp: time.Date(2017, 12, 20, 15, 18, 24, 0, time.Local)})
+	require.NoError(t, err)
+
+	require.NoError(t, b.SetShadowBlock("radio-t", "user1", true, 0))
+	assert.True(t, b.IsShadowBlocked("radio-t", "user1"))
+	assert.False(t, b.IsBlocked("radio-t", "user1"), "not blocked in regular mode")
+	users, err := b.ShadowBlockedUsers("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(users))
+	assert.Equal(t, "user1", users[0].ID)
+	assert.True(t, users[0].Shadow)
+
+	res, err := b.Find(locator, "time", store.User{ID: "user2"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res), "comments of shadow blocked user hidden")
+	assert.Equal(t, "id-3", res[0].ID)
+	res, err = b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(res), "hidden from anonymous")
+
+	res, err = b.Find(locator, "time", store.User{ID: "user1"})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res), "visible to the user")
+	assert.False(t, res[0].User.ShadowBlocked, "user not aware of block")
+	assert.False(t, res[0].User.Blocked)
+
+	res, err = b.Find(locator, "time", store.User{ID: "admin", Admin: true})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res), "visible to admin")
+	assert.True(t, res[0].User.ShadowBlocked, "marked for admin")
+	assert.False(t, res[2].User.ShadowBlocked)
+
+	_, err = b.Get(locator, "id-1", store.User{})
+	assert.True(t, errors.Is(err, ErrCommentNotFound), "hidden from anonymous by id")
+	_, err = b.Get(locator, "id-1", store.User{ID: "user2"})
+	assert.True(t, errors.Is(err, ErrCommentNotFound), "hidden from other users by id")
+	c, err := b.Get(locator, "id-1", store.User{ID: "user1"})
+	require.NoError(t, err, "visible to the user by id")
+	assert.False(t, c.User.ShadowBlocked)
+	c, err = b.Get(locator, "id-1", store.User{ID: "admin", Admin: true})
+	require.NoError(t, err, "visible to admin by id")
+	assert.True(t, c.User.ShadowBlocked)
+
+	res, err = b.Last("radio-t", 10, time.Time{}, store.User{ID: "user1"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res), "hidden from last comments")
+	assert.Equal(t, "id-3", res[0].ID)
+	res, err = b.Last("radio-t", 10, time.Time{}, store.User{ID: "admin", Admin: true})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res), "last comments of admin")
+	assert.Equal(t, "id-3", res[0].ID)
+	assert.False(t, res[0].User.ShadowBlocked)
+	assert.True(t, res[1].User.ShadowBlocked, "marked for admin")
+
+	count, err := b.Count(locator)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	counts, err := b.Counts("radio-t", []string{"https://radio-t.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []store.PostInfo{{URL: "https://radio-t.com", Count: 1}}, counts)
+	info, err := b.Info(locator, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, info.Count)
+	posts, err := b.List("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(posts))
+	assert.Equal(t, 1, posts[0].Count)
+
+	umetas, _, err := b.Metas("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(umetas))
+	assert.True(t, umetas[0].ShadowBlocked.Status)
+	assert.False(t, umetas[0].Blocked.Status)
+
+	require.NoError(t, b.SetShadowBlock("radio-t", "user1", false, 0))
+	assert.False(t, b.IsShadowBlocked("radio-t", "user1"))
+	count, err = b.Count(locator)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count, "unblocked")
+
+	require.NoError(t, b.SetMetas("radio-t", umetas, nil))
+	assert.True(t, b.IsShadowBlocked("radio-t", "user1"), "imported")
+}
+
+func TestService_ShadowBlockTTL(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	require.NoError(t, b.SetShadowBlock("radio-t", "user1", true, 150*time.Millisecond))
+	res, err := b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+
+	time.Sleep(150 * time.Millisecond)
+	assert.False(t, b.IsShadowBlocked("radio-t", "user1"), "block expired")
+	res, err = b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(res), "comments visible again")
+}
+
+func TestService_ShadowBlockCounts(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	counting := &listFlagsCountingEngine{Interface: eng}
+	b := DataStore{Engine: counting, AdminStore: admin.NewStaticKeyStore("secret 123")}
+	defer b.Close()
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	require.NoError(t, b.SetShadowBlock("radio-t", "user1", true, 0))
+	count := func() int {
+		res, err := b.Count(locator)
+		require.NoError(t, err)
+		return res
+	}
+	assert.Equal(t, 0, count())
+	for i := 0; i < 3; i++ {
+		_, err := b.Find(locator, "time", store.User{})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, counting.listFlags, "shadow blocks read once")
+
+	id, err := b.Create(store.Comment{Text: "spam", Locator: locator, User: store.User{ID: "user1", Name: "user1"}})
+	require.NoError(t, err)
+	_, err = b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "user2", Name: "user2"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count(), "new comment of blocked user hidden")
+	require.NoError(t, b.Delete(locator, id, store.SoftDelete))
+	assert.Equal(t, 1, count(), "deleted comment not subtracted twice")
+	assert.Equal(t, 1, counting.listFlags, "counts updated without reading blocks again")
+
+	require.NoError(t, b.SetShadowBlock("radio-t", "user1", false, 0))
+	assert.Equal(t, 3, count(), "unblocked")
+	assert.Equal(t, 2, counting.listFlags, "blocks read again after change")
+
+	require.NoError(t, b.SetShadowBlock("radio-t", "user2", true, 0))
+	require.NoError(t, b.DeleteUser("radio-t", "user2", store.SoftDelete))
+	assert.Equal(t, 2, count(), "comments of deleted user not subtracted")
+}
+
+// listFlagsCountingEngine counts calls of ListFlags
+type listFlagsCountingEngine struct {
+	engine.Interface
+	listFlags int
+}
+
+func (e *listFlagsCountingEngine) ListFlags(req engine.FlagRequest) ([]interface{}, error) {
+	e.listFlags++
+	return e.Interface.ListFlags(req)
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// SpamChecker scores comments from 0 (ham) to 1 (spam) and learns from comments marked by admins
+type SpamChecker interface {
+	Check(comment store.Comment) (score float64, reasons []string, err error)
+	Train(comment store.Comment, spam bool) error
+}
+
+// ErrSpamDetected returned in case comment rejected by spam checker
+var ErrSpamDetected = errors.New("comment rejected as spam")
+
+const maxSpamTrainComments = 100
+
+// checkSpam sets spam check result to the comment. Comment above threshold held for review as pending
+// or rejected with ErrSpamDetected. Failed check doesn't prevent comment from posting.
+func (s *DataStore) checkSpam(comment *store.Comment) error {
+	if s.SpamFilter.Checker == nil || comment.User.Admin {
+		return nil
+	}
+	score, reasons, err := s.SpamFilter.Checker.Check(*comment)
+	if err != nil {
+		log.Printf("[WARN] spam check failed for %s, %v", comment.ID, err)
+		return nil
+	}
+	comment.Spam = &store.SpamCheck{Timestamp: time.Now(), Score: score, Reasons: reasons}
+	if score < s.SpamFilter.Threshold {
+		return nil
+	}
+	log.Printf("[INFO] comment %s from %s detected as spam, score %.2f, %v", comment.ID, comment.User.ID, score, reasons)
+	if s.SpamFilter.Reject {
+		return ErrSpamDetected
+	}
+	comment.Spam.Flagged = true
+	comment.Pending = true
+	return nil
+}
+
+// trainSpam passes comment marked by admin's action to spam checker, errors logged only
+func (s *DataStore) trainSpam(comment store.Comment, spam bool) {
+	if s.SpamFilter.Checker == nil || comment.Deleted || comment.Text == "" {
+		return
+	}
+	if err := s.SpamFilter.Checker.Train(comment, spam); err != nil {
+		log.Printf("[WARN] can't train spam checker with %s, %v", comment.ID, err)
+	}
+}
+
+// trainSpamTrusted marks comments of admins and verified users as ham
+func (s *DataStore) trainSpamTrusted(comment store.Comment) {
+	if s.SpamFilter.Checker == nil {
+		return
+	}
+	if comment.User.Admin || s.IsVerified(comment.Locator.SiteID, comment.User.ID) {
+		s.trainSpam(comment, false)
+	}
+}
+
+// trainSpamUser marks recent comments of the user as spam
+func (s *DataStore) trainSpamUser(siteID, userID string) {
+	if s.SpamFilter.Checker == nil {
+		return
+	}
+	req := engine.FindRequest{Locator: store.Locator{SiteID: siteID}, UserID: userID, Limit: maxSpamTrainComments}
+	comments, err := s.Engine.Find(req)
+	if err != nil {
+		log.Printf("[DEBUG] no comments to train spam checker for %s, %v", userID, err)
+		return
+	}
+	for _, c := range comments {
+		s.trainSpam(c, true)
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/engine"
+)
+
+// Subscribe adds user's email subscription to all new comments of the post,
+// or to all new comments in the thread started by commentID
+func (s *DataStore) Subscribe(locator store.Locator, userID, commentID string) (store.Subscription, error) {
+	if locator.URL == "" {
+		return store.Subscription{}, errors.New("post url required for subscription")
+	}
+	if commentID != "" {
+		comment, err := s.Engine.Get(engine.GetRequest{Locator: locator, CommentID: commentID})
+		if err != nil {
+			return store.Subscription{}, errors.Wrapf(err, "can't subscribe to thread of %s", commentID)
+		}
+		if comment.Deleted {
+			return store.Subscription{}, errors.Errorf("comment %s deleted", commentID)
+		}
+	}
+
+	sub := store.Subscription{Locator: locator, UserID: userID, CommentID: commentID, Timestamp: time.Now()}
+	res, err := s.Engine.Subscription(engine.SubscriptionRequest{Locator: locator, Update: &sub})
+	if err != nil {
+		return store.Subscription{}, err
+	}
+	if len(res) == 0 {
+		return store.Subscription{}, errors.Errorf("no subscription returned for %s", userID)
+	}
+	return res[0], nil
+}
+
+// Unsubscribe removes user's subscription to the post, or to the thread if commentID set
+func (s *DataStore) Unsubscribe(locator store.Locator, userID, commentID string) error {
+	if locator.URL == "" {
+		return errors.New("post url required to unsubscribe")
+	}
+	return s.Engine.Delete(engine.DeleteRequest{Locator: locator, UserID: userID, CommentID: commentID, Subscription: true})
+}
+
+// UnsubscribeByID removes user's subscription with given id, used by unsubscribe links
+func (s *DataStore) UnsubscribeByID(siteID, userID, subscriptionID string) error {
+	subs, err := s.Subscriptions(store.Locator{SiteID: siteID}, userID)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		if sub.ID() == subscriptionID {
+			return s.Unsubscribe(sub.Locator, userID, sub.CommentID)
+		}
+	}
+	return errors.Errorf("subscription %s not found for %s", subscriptionID, userID)
+}
+
+// Subscriptions gets subscriptions to the post if locator has URL, all site's subscriptions otherwise.
+// Limited to subscriptions of the user if userID set
+func (s *DataStore) Subscriptions(locator store.Locator, userID string) ([]store.Subscription, error) {
+	return s.Engine.Subscription(engine.SubscriptionRequest{Locator: locator, UserID: userID})
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+	"github.com/umputun/remark42/backend/app/store/admin"
+)
+
+func TestService_Subscribe(t *testing.T) {
+	eng, teardown := prepStoreEngine(t)
+	defer teardown()
+	b := DataStore{Engine: eng, AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	sub, err := b.Subscribe(locator, "user2", "")
+	require.NoError(t, err)
+	assert.Equal(t, "user2", sub.UserID)
+	assert.Equal(t, "", sub.CommentID)
+	assert.False(t, sub.Timestamp.IsZero())
+
+	sub, err = b.Subscribe(locator, "user2", "id-1")
+	require.NoError(t, err)
+	assert.Equal(t, "id-1", sub.CommentID)
+
+	_, err = b.Subscribe(locator, "user3", "bad")
+	assert.Error(t, err, "no such comment")
+	_, err = b.Subscribe(store.Locator{SiteID: "radio-t"}, "user3", "")
+	assert.EqualError(t, err, "post url required for subscription")
+
+	subs, err := b.Subscriptions(locator, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(subs))
+
+	require.NoError(t, b.Unsubscribe(locator, "user2", ""))
+	subs, err = b.Subscriptions(store.Locator{SiteID: "radio-t"}, "user2")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(subs))
+	assert.Equal(t, "id-1", subs[0].CommentID, "thread subscription kept")
+
+	assert.EqualError(t, b.UnsubscribeByID("radio-t", "user2", "bad"), "subscription bad not found for user2")
+	require.NoError(t, b.UnsubscribeByID("radio-t", "user2", subs[0].ID()))
+	subs, err = b.Subscriptions(store.Locator{SiteID: "radio-t"}, "user2")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(subs))
+
+	require.NoError(t, b.Delete(locator, "id-2", store.SoftDelete))
+	_, err = b.Subscribe(locator, "user2", "id-2")
+	assert.EqualError(t, err, "comment id-2 deleted")
+}
@@ -0,0 +1,102 @@
+package spam
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+// Akismet checks comments with Akismet-compatible service, see https://akismet.com/development/api/
+// Only hashed user's ip sent to the service, real ip never stored by remark42.
+type Akismet struct {
+	AkismetParams
+	client http.Client
+}
+
+// AkismetParams defines service location and credentials
+type AkismetParams struct {
+	URL     string // api url, i.e. https://rest.akismet.com
+	Key     string // api key
+	Blog    string // front page of the site
+	Timeout time.Duration
+}
+
+// NewAkismet makes Akismet client
+func NewAkismet(params AkismetParams) *Akismet {
+	params.URL = strings.TrimSuffix(params.URL, "/")
+	return &Akismet{AkismetParams: params, client: http.Client{Timeout: params.Timeout}}
+}
+
+// Check sends comment to comment-check. Spam reported with score 1, obvious spam ("discard" pro-tip) mentioned in reasons
+func (a *Akismet) Check(comment store.Comment) (score float64, reasons []string, err error) {
+	resp, body, err := a.post("comment-check", comment)
+	if err != nil {
+		return 0, nil, err
+	}
+	switch body {
+	case "true":
+		reasons = []string{"akismet: spam"}
+		if resp.Header.Get("X-akismet-pro-tip") == "discard" {
+			reasons = []string{"akismet: obvious spam"}
+		}
+		return 1, reasons, nil
+	case "false":
+		return 0, nil, nil
+	}
+	return 0, nil, errors.Errorf("unexpected akismet response %q, %s", body, resp.Header.Get("X-akismet-debug-help"))
+}
+
+// Train reports missed spam or false positive with submit-spam or submit-ham
+func (a *Akismet) Train(comment store.Comment, spam bool) error {
+	method := "submit-ham"
+	if spam {
+		method = "submit-spam"
+	}
+	_, _, err := a.post(method, comment)
+	return err
+}
+
+func (a *Akismet) post(method string, comment store.Comment) (resp *http.Response, body string, err error) {
+	commentType := "comment"
+	if comment.ParentID != "" {
+		commentType = "reply"
+	}
+	content := comment.Orig
+	if content == "" {
+		content = comment.Text
+	}
+	params := url.Values{
+		"api_key":          {a.Key},
+		"blog":             {a.Blog},
+		"blog_charset":     {"UTF-8"},
+		"user_ip":          {comment.User.IP},
+		"permalink":        {comment.Locator.URL},
+		"comment_type":     {commentType},
+		"comment_author":   {comment.User.Name},
+		"comment_content":  {content},
+		"comment_date_gmt": {comment.Timestamp.UTC().Format(time.RFC3339)},
+	}
+	if comment.User.Admin {
+		params.Set("user_role", "administrator")
+	}
+
+	resp, err = a.client.PostForm(a.URL+"/1.1/"+method, params)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "akismet %s request failed", method)
+	}
+	defer resp.Body.Close() // nolint
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "can't read akismet %s response", method)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", errors.Errorf("akismet %s failed with status %d", method, resp.StatusCode)
+	}
+	return resp, strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,86 @@
+package spam
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+func TestAkismet_Check(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/1.1/comment-check", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "key123", r.PostForm.Get("api_key"))
+		assert.Equal(t, "https://remark42.example.com", r.PostForm.Get("blog"))
+		assert.Equal(t, "https://radio-t.com/p/1", r.PostForm.Get("permalink"))
+		assert.Equal(t, "user name", r.PostForm.Get("comment_author"))
+		switch r.PostForm.Get("comment_content") {
+		case "spam":
+			_, _ = w.Write([]byte("true"))
+		case "obvious spam":
+			w.Header().Set("X-akismet-pro-tip", "discard")
+			_, _ = w.Write([]byte("true"))
+		case "ham":
+			assert.Equal(t, "reply", r.PostForm.Get("comment_type"))
+			_, _ = w.Write([]byte("false"))
+		default:
+			w.Header().Set("X-akismet-debug-help", "empty content")
+			_, _ = w.Write([]byte("invalid"))
+		}
+	}))
+	defer ts.Close()
+
+	a := NewAkismet(AkismetParams{URL: ts.URL + "/", Key: "key123", Blog: "https://remark42.example.com", Timeout: time.Second})
+	c := store.Comment{Text: "spam", User: store.User{Name: "user name", IP: "ip-hash"},
+		Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/p/1"}}
+
+	score, reasons, err := a.Check(c)
+	require.NoError(t, err)
+	assert.Equal(t, 1., score)
+	assert.Equal(t, []string{"akismet: spam"}, reasons)
+
+	c.Text = "obvious spam"
+	score, reasons, err = a.Check(c)
+	require.NoError(t, err)
+	assert.Equal(t, 1., score)
+	assert.Equal(t, []string{"akismet: obvious spam"}, reasons)
+
+	c.Text, c.ParentID = "<p>html</p>", "p1"
+	c.Orig = "ham"
+	score, reasons, err = a.Check(c)
+	require.NoError(t, err)
+	assert.Equal(t, 0., score)
+	assert.Empty(t, reasons)
+
+	c.Orig = ""
+	_, _, err = a.Check(c)
+	assert.EqualError(t, err, `unexpected akismet response "invalid", empty content`)
+}
+
+func TestAkismet_Train(t *testing.T) {
+	calls := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		if r.URL.Path == "/1.1/submit-ham" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("Thanks for making the web a better place."))
+	}))
+	defer ts.Close()
+
+	a := NewAkismet(AkismetParams{URL: ts.URL, Key: "key123"})
+	require.NoError(t, a.Train(store.Comment{Text: "spam"}, true))
+	assert.EqualError(t, a.Train(store.Comment{Text: "ham"}, false), "akismet submit-ham failed with status 500")
+	assert.Equal(t, []string{"/1.1/submit-spam", "/1.1/submit-ham"}, calls)
+
+	a = NewAkismet(AkismetParams{URL: "http://127.0.0.1:1", Key: "key123"})
+	_, _, err := a.Check(store.Comment{Text: "spam"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,188 @@
+// Package spam provides spam checkers for comments. Each checker returns score from 0 (ham) to 1 (spam)
+// with human-readable reasons and can be trained with comments marked as spam or ham by admins.
+package spam
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+const (
+	spamBucketName = "spam"  // token -> number of spam comments with this token
+	hamBucketName  = "ham"   // token -> number of ham comments with this token
+	docsBucketName = "total" // "spam" and "ham" -> number of trained comments
+)
+
+const (
+	maxInterestingTokens = 15  // number of most significant tokens used for score
+	minTokenLen          = 3   // shorter words ignored
+	maxTokenLen          = 32  // longer words ignored
+	reasonTokenProb      = 0.8 // tokens with higher spam probability reported as reasons
+)
+
+var (
+	reTags = regexp.MustCompile(`<[^>]*>`)
+	reHref = regexp.MustCompile(`href="(?:https?://)?([^/"?#]+)`)
+)
+
+// Bayes is a local naive bayesian classifier. Keeps token frequencies of trained spam and ham comments
+// in bolt db, shared by all sites. Score is 0 until trained with at least one spam and one ham comment.
+type Bayes struct {
+	db *bolt.DB
+}
+
+type tokenProb struct {
+	token string
+	prob  float64
+}
+
+// NewBayes makes classifier with bolt db in fileName
+func NewBayes(fileName string, options bolt.Options) (*Bayes, error) {
+	db, err := bolt.Open(fileName, 0600, &options) //nolint:gocritic //octalLiteral is OK as FileMode
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to make boltdb for %s", fileName)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bktName := range []string{spamBucketName, hamBucketName, docsBucketName} {
+			if _, e := tx.CreateBucketIfNotExists([]byte(bktName)); e != nil {
+				return errors.Wrapf(e, "failed to create top level bucket %s", bktName)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to initialize boltdb db %q buckets", fileName)
+	}
+	return &Bayes{db: db}, nil
+}
+
+// Check scores comment text. Probability of each token smoothed with Robinson's method
+// and the most significant tokens combined to the final score
+func (b *Bayes) Check(comment store.Comment) (score float64, reasons []string, err error) {
+	tokens := Tokenize(comment.Text)
+	probs := []tokenProb{}
+
+	err = b.db.View(func(tx *bolt.Tx) error {
+		spamDocs := getCount(tx.Bucket([]byte(docsBucketName)), spamBucketName)
+		hamDocs := getCount(tx.Bucket([]byte(docsBucketName)), hamBucketName)
+		if spamDocs == 0 || hamDocs == 0 {
+			return nil // not trained
+		}
+		spamBkt, hamBkt := tx.Bucket([]byte(spamBucketName)), tx.Bucket([]byte(hamBucketName))
+		for _, t := range tokens {
+			inSpam, inHam := getCount(spamBkt, t), getCount(hamBkt, t)
+			if inSpam+inHam == 0 {
+				continue // unknown token
+			}
+			spamFreq, hamFreq := float64(inSpam)/float64(spamDocs), float64(inHam)/float64(hamDocs)
+			p := spamFreq / (spamFreq + hamFreq)
+			n := float64(inSpam + inHam)
+			probs = append(probs, tokenProb{token: t, prob: (0.5 + n*p) / (1 + n)})
+		}
+		return nil
+	})
+	if err != nil || len(probs) == 0 {
+		return 0, nil, err
+	}
+
+	sort.Slice(probs, func(i, j int) bool {
+		di, dj := math.Abs(probs[i].prob-0.5), math.Abs(probs[j].prob-0.5)
+		if di == dj {
+			return probs[i].token < probs[j].token
+		}
+		return di > dj
+	})
+	if len(probs) > maxInterestingTokens {
+		probs = probs[:maxInterestingTokens]
+	}
+
+	lnSpam, lnHam := 0.0, 0.0
+	for _, tp := range probs {
+		lnSpam += math.Log(tp.prob)
+		lnHam += math.Log(1 - tp.prob)
+		if tp.prob >= reasonTokenProb {
+			reasons = append(reasons, fmt.Sprintf("bayes: token %q, %.2f", tp.token, tp.prob))
+		}
+	}
+	return 1 / (1 + math.Exp(lnHam-lnSpam)), reasons, nil
+}
+
+// Train updates token frequencies with comment's text
+func (b *Bayes) Train(comment store.Comment, spam bool) error {
+	tokens := Tokenize(comment.Text)
+	if len(tokens) == 0 {
+		return nil
+	}
+	bktName := hamBucketName
+	if spam {
+		bktName = spamBucketName
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(bktName))
+		for _, t := range tokens {
+			if err := incCount(bkt, t); err != nil {
+				return err
+			}
+		}
+		return incCount(tx.Bucket([]byte(docsBucketName)), bktName)
+	})
+}
+
+// Close bolt db
+func (b *Bayes) Close() error {
+	return errors.Wrap(b.db.Close(), "can't close spam db")
+}
+
+// Tokenize makes sorted list of unique lowercase words from comment's html. Hosts of links added as "link:host" tokens
+func Tokenize(html string) []string {
+	uniq := map[string]bool{}
+	for _, m := range reHref.FindAllStringSubmatch(html, -1) {
+		uniq["link:"+strings.ToLower(m[1])] = true
+	}
+
+	words := strings.FieldsFunc(reTags.ReplaceAllString(html, " "), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if l := utf8.RuneCountInString(w); l < minTokenLen || l > maxTokenLen {
+			continue
+		}
+		uniq[strings.ToLower(w)] = true
+	}
+
+	res := make([]string, 0, len(uniq))
+	for t := range uniq {
+		res = append(res, t)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func getCount(bkt *bolt.Bucket, key string) int {
+	val := bkt.Get([]byte(key))
+	if val == nil {
+		return 0
+	}
+	count, err := strconv.Atoi(string(val))
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+func incCount(bkt *bolt.Bucket, key string) error {
+	count := getCount(bkt, key) + 1
+	return errors.Wrapf(bkt.Put([]byte(key), []byte(strconv.Itoa(count))), "can't put count for %s", key)
+}
@@ -0,0 +1,111 @@
+package spam
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/umputun/remark42/backend/app/store"
+)
+
+const testBayesDB = "/tmp/test-remark-spam.db"
+
+func TestBayes_CheckNotTrained(t *testing.T) {
+	b, teardown := prepBayes(t)
+	defer teardown()
+
+	score, reasons, err := b.Check(store.Comment{Text: "buy cheap pills"})
+	require.NoError(t, err)
+	assert.Equal(t, 0., score)
+	assert.Empty(t, reasons)
+
+	require.NoError(t, b.Train(store.Comment{Text: "buy cheap pills"}, true))
+	score, _, err = b.Check(store.Comment{Text: "buy cheap pills"})
+	require.NoError(t, err)
+	assert.Equal(t, 0., score, "no ham trained")
+}
+
+func TestBayes_Check(t *testing.T) {
+	b, teardown := prepBayes(t)
+	defer teardown()
+
+	spam := []string{
+		`buy cheap pills at <a href="http://pills.example.com/buy">pharmacy</a>`,
+		`cheap pills, best price, visit <a href="http://pills.example.com">our shop</a>`,
+		`casino bonus, cheap and free money`,
+	}
+	ham := []string{
+		"great episode, thanks for the discussion about go generics",
+		"i think the discussion about testing was too short",
+		"thanks, interesting episode about databases and go",
+	}
+	for _, text := range spam {
+		require.NoError(t, b.Train(store.Comment{Text: text}, true))
+	}
+	for _, text := range ham {
+		require.NoError(t, b.Train(store.Comment{Text: text}, false))
+	}
+
+	score, reasons, err := b.Check(store.Comment{Text: `cheap pills <a href="http://pills.example.com/new">here</a>`})
+	require.NoError(t, err)
+	assert.True(t, score > 0.9, score)
+	assert.Contains(t, reasons, `bayes: token "link:pills.example.com", 0.83`)
+
+	score, reasons, err = b.Check(store.Comment{Text: "thanks for the episode about go"})
+	require.NoError(t, err)
+	assert.True(t, score < 0.1, score)
+	assert.Empty(t, reasons)
+
+	score, _, err = b.Check(store.Comment{Text: "something completely different"})
+	require.NoError(t, err)
+	assert.Equal(t, 0., score, "unknown tokens")
+}
+
+func TestBayes_Reopen(t *testing.T) {
+	b, teardown := prepBayes(t)
+	defer teardown()
+	require.NoError(t, b.Train(store.Comment{Text: "cheap pills"}, true))
+	require.NoError(t, b.Train(store.Comment{Text: "good episode"}, false))
+	require.NoError(t, b.Close())
+
+	b2, err := NewBayes(testBayesDB, bolt.Options{})
+	require.NoError(t, err)
+	score, _, err := b2.Check(store.Comment{Text: "cheap pills"})
+	require.NoError(t, err)
+	assert.True(t, score > 0.5, score)
+	b.db = b2.db // closed by teardown
+}
+
+func TestBayes_NewFailed(t *testing.T) {
+	_, err := NewBayes("/dev/null/bad.db", bolt.Options{})
+	assert.Error(t, err)
+}
+
+func TestTokenize(t *testing.T) {
+	tbl := []struct {
+		inp string
+		out []string
+	}{
+		{"", []string{}},
+		{"Hello, World! hello", []string{"hello", "world"}},
+		{"a an the Привет мир", []string{"the", "мир", "привет"}},
+		{`<p>see <a href="https://Example.com/path?q=1">link</a></p>`, []string{"link", "link:example.com", "see"}},
+		{"too long " + "abcdefghijklmnopqrstuvwxyzabcdefgh", []string{"long", "too"}},
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, tt.out, Tokenize(tt.inp), "case #%d", i)
+	}
+}
+
+func prepBayes(t *testing.T) (b *Bayes, teardown func()) {
+	_ = os.Remove(testBayesDB)
+	b, err := NewBayes(testBayesDB, bolt.Options{})
+	require.NoError(t, err)
+	return b, func() {
+		_ = b.Close()
+		_ = os.Remove(testBayesDB)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"hash/crc64"
 	"io"
 	"regexp"
+	"time"
 
 	log "github.com/go-pkgz/lgr"
 )
@@ -21,11 +22,42 @@ type User struct {
 	IP                string `json:"ip,omitempty"`
 	Admin             bool   `json:"admin"`
 	Blocked           bool   `json:"block,omitempty"`
+	ShadowBlocked     bool   `json:"shadow_block,omitempty"` // set for admins only
 	Verified          bool   `json:"verified,omitempty"`
 	EmailSubscription bool   `json:"email_subscription,omitempty"`
 	SiteID            string `json:"site_id,omitempty"`
 }
 
+// DigestMode defines delivery of user's email notifications
+type DigestMode string
+
+// enum of all digest modes
+const (
+	DigestImmediate DigestMode = "immediate"
+	DigestHourly    DigestMode = "hourly"
+	DigestDaily     DigestMode = "daily"
+)
+
+// Valid checks if mode is one of known digest modes
+func (d DigestMode) Valid() bool {
+	switch d {
+	case DigestImmediate, DigestHourly, DigestDaily:
+		return true
+	}
+	return false
+}
+
+// Period returns how long notifications collected before sending them as digest, zero for immediate delivery
+func (d DigestMode) Period() time.Duration {
+	switch d {
+	case DigestHourly:
+		return time.Hour
+	case DigestDaily:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
 var reValidSha = regexp.MustCompile("^[a-fA-F0-9]{40}$")
 var reValidCrc64 = regexp.MustCompile("^[a-fA-F0-9]{16}$")
 
@@ -4,6 +4,7 @@ import (
 	"crypto/sha1"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -58,6 +59,18 @@ func TestUser_HashFailed(t *testing.T) {
 
 }
 
+func TestUser_DigestMode(t *testing.T) {
+	assert.True(t, DigestImmediate.Valid())
+	assert.True(t, DigestDaily.Valid())
+	assert.False(t, DigestMode("weekly").Valid())
+	assert.False(t, DigestMode("").Valid())
+
+	assert.Equal(t, time.Duration(0), DigestImmediate.Period())
+	assert.Equal(t, time.Hour, DigestHourly.Period())
+	assert.Equal(t, 24*time.Hour, DigestDaily.Period())
+	assert.Equal(t, time.Duration(0), DigestMode("bad").Period())
+}
+
 type mockHash struct{}
 
 func (mock mockHash) Sum(_ []byte) []byte               { return nil }
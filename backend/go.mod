@@ -6,6 +6,7 @@ require (
 	github.com/Depado/bfchroma v1.2.0
 	github.com/PuerkitoBio/goquery v1.5.1
 	github.com/alecthomas/chroma v0.7.2
+	github.com/alicebob/miniredis/v2 v2.11.4
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/didip/tollbooth/v6 v6.0.1
 	github.com/didip/tollbooth_chi v0.0.0-20200524181329-8b84cd7183d9
@@ -19,10 +20,13 @@ require (
 	github.com/go-pkgz/repeater v1.1.3
 	github.com/go-pkgz/rest v1.5.0
 	github.com/go-pkgz/syncs v1.1.1
+	github.com/go-redis/redis/v7 v7.2.0
 	github.com/google/uuid v1.1.1
 	github.com/gorilla/feeds v1.1.1
 	github.com/hashicorp/go-multierror v1.1.0
 	github.com/kyokomi/emoji v2.2.1+incompatible
+	github.com/lib/pq v1.7.0
+	github.com/mattn/go-sqlite3 v1.14.0
 	github.com/microcosm-cc/bluemonday v1.0.2
 	github.com/pkg/errors v0.9.1
 	github.com/rakyll/statik v0.1.7
@@ -141,6 +141,48 @@ const messages = defineMessages({
       code: 18,
     },
   },
+  19: {
+    id: 'errors.19',
+    defaultMessage: `Comment looks like spam and was rejected.`,
+    description: {
+      code: 19,
+    },
+  },
+  20: {
+    id: 'errors.20',
+    defaultMessage: `Report rejected. Please try again a bit later.`,
+    description: {
+      code: 20,
+    },
+  },
+  21: {
+    id: 'errors.21',
+    defaultMessage: `You cannot report your own comment.`,
+    description: {
+      code: 21,
+    },
+  },
+  22: {
+    id: 'errors.22',
+    defaultMessage: `Confirmed email address is required.`,
+    description: {
+      code: 22,
+    },
+  },
+  23: {
+    id: 'errors.23',
+    defaultMessage: `Reaction rejected. Please try again a bit later.`,
+    description: {
+      code: 23,
+    },
+  },
+  24: {
+    id: 'errors.24',
+    defaultMessage: `Too many comments. Please try again a bit later.`,
+    description: {
+      code: 24,
+    },
+  },
 });
 
 /**